@@ -0,0 +1,651 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.1
+// source: api/adminapi/admin.proto
+
+package adminapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	KmeshAdmin_GetAuthz_FullMethodName              = "/adminapi.KmeshAdmin/GetAuthz"
+	KmeshAdmin_SetAuthz_FullMethodName              = "/adminapi.KmeshAdmin/SetAuthz"
+	KmeshAdmin_ConfigDump_FullMethodName            = "/adminapi.KmeshAdmin/ConfigDump"
+	KmeshAdmin_BpfMapDump_FullMethodName            = "/adminapi.KmeshAdmin/BpfMapDump"
+	KmeshAdmin_ListLoggers_FullMethodName           = "/adminapi.KmeshAdmin/ListLoggers"
+	KmeshAdmin_GetLoggerLevel_FullMethodName        = "/adminapi.KmeshAdmin/GetLoggerLevel"
+	KmeshAdmin_SetLoggerLevel_FullMethodName        = "/adminapi.KmeshAdmin/SetLoggerLevel"
+	KmeshAdmin_ExplainAuthz_FullMethodName          = "/adminapi.KmeshAdmin/ExplainAuthz"
+	KmeshAdmin_GetServiceLoad_FullMethodName        = "/adminapi.KmeshAdmin/GetServiceLoad"
+	KmeshAdmin_CheckPrerequisites_FullMethodName    = "/adminapi.KmeshAdmin/CheckPrerequisites"
+	KmeshAdmin_ListEnrolledWorkloads_FullMethodName = "/adminapi.KmeshAdmin/ListEnrolledWorkloads"
+	KmeshAdmin_SimulateLocality_FullMethodName      = "/adminapi.KmeshAdmin/SimulateLocality"
+	KmeshAdmin_GetStatus_FullMethodName             = "/adminapi.KmeshAdmin/GetStatus"
+	KmeshAdmin_ListConnections_FullMethodName       = "/adminapi.KmeshAdmin/ListConnections"
+)
+
+// KmeshAdminClient is the client API for KmeshAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// KmeshAdmin is the admin service of the kmesh daemon, served on localhost only.
+type KmeshAdminClient interface {
+	// GetAuthz returns whether authorization is offloaded to the xdp program.
+	GetAuthz(ctx context.Context, in *GetAuthzRequest, opts ...grpc.CallOption) (*AuthzStatus, error)
+	// SetAuthz enables or disables offloading authorization to the xdp program.
+	SetAuthz(ctx context.Context, in *SetAuthzRequest, opts ...grpc.CallOption) (*AuthzStatus, error)
+	// ConfigDump dumps the configuration received from the control plane.
+	ConfigDump(ctx context.Context, in *ConfigDumpRequest, opts ...grpc.CallOption) (*ConfigDumpResponse, error)
+	// BpfMapDump dumps the content of the bpf maps.
+	BpfMapDump(ctx context.Context, in *BpfMapDumpRequest, opts ...grpc.CallOption) (*BpfMapDumpResponse, error)
+	// ListLoggers returns the names of all the loggers.
+	ListLoggers(ctx context.Context, in *ListLoggersRequest, opts ...grpc.CallOption) (*ListLoggersResponse, error)
+	// GetLoggerLevel returns the level of a logger.
+	GetLoggerLevel(ctx context.Context, in *GetLoggerLevelRequest, opts ...grpc.CallOption) (*LoggerLevel, error)
+	// SetLoggerLevel sets the level of a logger.
+	SetLoggerLevel(ctx context.Context, in *LoggerLevel, opts ...grpc.CallOption) (*LoggerLevel, error)
+	// ExplainAuthz evaluates the loaded authorization policies on a connection without sending traffic.
+	ExplainAuthz(ctx context.Context, in *ExplainAuthzRequest, opts ...grpc.CallOption) (*AuthzExplanation, error)
+	// GetServiceLoad returns the active connections of the services and the rate they are opened at.
+	GetServiceLoad(ctx context.Context, in *GetServiceLoadRequest, opts ...grpc.CallOption) (*GetServiceLoadResponse, error)
+	// CheckPrerequisites probes whether the kernel of the node provides the features kmesh relies on.
+	CheckPrerequisites(ctx context.Context, in *CheckPrerequisitesRequest, opts ...grpc.CallOption) (*PrerequisitesReport, error)
+	// ListEnrolledWorkloads returns the pods of the node that should be managed by kmesh and their enrollment.
+	ListEnrolledWorkloads(ctx context.Context, in *ListEnrolledWorkloadsRequest, opts ...grpc.CallOption) (*ListEnrolledWorkloadsResponse, error)
+	// SimulateLocality ranks the endpoints of a service by locality for a client on a node and returns
+	// the ones its connections are routed to, without sending traffic.
+	SimulateLocality(ctx context.Context, in *SimulateLocalityRequest, opts ...grpc.CallOption) (*LocalitySimulation, error)
+	// GetStatus returns the mode the daemon runs in, its version and the kernel of its node.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*DaemonStatus, error)
+	// ListConnections returns the tcp connections tracked by the data plane and the backend each of them
+	// is routed to.
+	ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error)
+}
+
+type kmeshAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKmeshAdminClient(cc grpc.ClientConnInterface) KmeshAdminClient {
+	return &kmeshAdminClient{cc}
+}
+
+func (c *kmeshAdminClient) GetAuthz(ctx context.Context, in *GetAuthzRequest, opts ...grpc.CallOption) (*AuthzStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthzStatus)
+	err := c.cc.Invoke(ctx, KmeshAdmin_GetAuthz_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) SetAuthz(ctx context.Context, in *SetAuthzRequest, opts ...grpc.CallOption) (*AuthzStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthzStatus)
+	err := c.cc.Invoke(ctx, KmeshAdmin_SetAuthz_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) ConfigDump(ctx context.Context, in *ConfigDumpRequest, opts ...grpc.CallOption) (*ConfigDumpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigDumpResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_ConfigDump_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) BpfMapDump(ctx context.Context, in *BpfMapDumpRequest, opts ...grpc.CallOption) (*BpfMapDumpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BpfMapDumpResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_BpfMapDump_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) ListLoggers(ctx context.Context, in *ListLoggersRequest, opts ...grpc.CallOption) (*ListLoggersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLoggersResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_ListLoggers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) GetLoggerLevel(ctx context.Context, in *GetLoggerLevelRequest, opts ...grpc.CallOption) (*LoggerLevel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoggerLevel)
+	err := c.cc.Invoke(ctx, KmeshAdmin_GetLoggerLevel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) SetLoggerLevel(ctx context.Context, in *LoggerLevel, opts ...grpc.CallOption) (*LoggerLevel, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoggerLevel)
+	err := c.cc.Invoke(ctx, KmeshAdmin_SetLoggerLevel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) ExplainAuthz(ctx context.Context, in *ExplainAuthzRequest, opts ...grpc.CallOption) (*AuthzExplanation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthzExplanation)
+	err := c.cc.Invoke(ctx, KmeshAdmin_ExplainAuthz_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) GetServiceLoad(ctx context.Context, in *GetServiceLoadRequest, opts ...grpc.CallOption) (*GetServiceLoadResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetServiceLoadResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_GetServiceLoad_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) CheckPrerequisites(ctx context.Context, in *CheckPrerequisitesRequest, opts ...grpc.CallOption) (*PrerequisitesReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PrerequisitesReport)
+	err := c.cc.Invoke(ctx, KmeshAdmin_CheckPrerequisites_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) ListEnrolledWorkloads(ctx context.Context, in *ListEnrolledWorkloadsRequest, opts ...grpc.CallOption) (*ListEnrolledWorkloadsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListEnrolledWorkloadsResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_ListEnrolledWorkloads_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) SimulateLocality(ctx context.Context, in *SimulateLocalityRequest, opts ...grpc.CallOption) (*LocalitySimulation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LocalitySimulation)
+	err := c.cc.Invoke(ctx, KmeshAdmin_SimulateLocality_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*DaemonStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DaemonStatus)
+	err := c.cc.Invoke(ctx, KmeshAdmin_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kmeshAdminClient) ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConnectionsResponse)
+	err := c.cc.Invoke(ctx, KmeshAdmin_ListConnections_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KmeshAdminServer is the server API for KmeshAdmin service.
+// All implementations must embed UnimplementedKmeshAdminServer
+// for forward compatibility.
+//
+// KmeshAdmin is the admin service of the kmesh daemon, served on localhost only.
+type KmeshAdminServer interface {
+	// GetAuthz returns whether authorization is offloaded to the xdp program.
+	GetAuthz(context.Context, *GetAuthzRequest) (*AuthzStatus, error)
+	// SetAuthz enables or disables offloading authorization to the xdp program.
+	SetAuthz(context.Context, *SetAuthzRequest) (*AuthzStatus, error)
+	// ConfigDump dumps the configuration received from the control plane.
+	ConfigDump(context.Context, *ConfigDumpRequest) (*ConfigDumpResponse, error)
+	// BpfMapDump dumps the content of the bpf maps.
+	BpfMapDump(context.Context, *BpfMapDumpRequest) (*BpfMapDumpResponse, error)
+	// ListLoggers returns the names of all the loggers.
+	ListLoggers(context.Context, *ListLoggersRequest) (*ListLoggersResponse, error)
+	// GetLoggerLevel returns the level of a logger.
+	GetLoggerLevel(context.Context, *GetLoggerLevelRequest) (*LoggerLevel, error)
+	// SetLoggerLevel sets the level of a logger.
+	SetLoggerLevel(context.Context, *LoggerLevel) (*LoggerLevel, error)
+	// ExplainAuthz evaluates the loaded authorization policies on a connection without sending traffic.
+	ExplainAuthz(context.Context, *ExplainAuthzRequest) (*AuthzExplanation, error)
+	// GetServiceLoad returns the active connections of the services and the rate they are opened at.
+	GetServiceLoad(context.Context, *GetServiceLoadRequest) (*GetServiceLoadResponse, error)
+	// CheckPrerequisites probes whether the kernel of the node provides the features kmesh relies on.
+	CheckPrerequisites(context.Context, *CheckPrerequisitesRequest) (*PrerequisitesReport, error)
+	// ListEnrolledWorkloads returns the pods of the node that should be managed by kmesh and their enrollment.
+	ListEnrolledWorkloads(context.Context, *ListEnrolledWorkloadsRequest) (*ListEnrolledWorkloadsResponse, error)
+	// SimulateLocality ranks the endpoints of a service by locality for a client on a node and returns
+	// the ones its connections are routed to, without sending traffic.
+	SimulateLocality(context.Context, *SimulateLocalityRequest) (*LocalitySimulation, error)
+	// GetStatus returns the mode the daemon runs in, its version and the kernel of its node.
+	GetStatus(context.Context, *GetStatusRequest) (*DaemonStatus, error)
+	// ListConnections returns the tcp connections tracked by the data plane and the backend each of them
+	// is routed to.
+	ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error)
+	mustEmbedUnimplementedKmeshAdminServer()
+}
+
+// UnimplementedKmeshAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedKmeshAdminServer struct{}
+
+func (UnimplementedKmeshAdminServer) GetAuthz(context.Context, *GetAuthzRequest) (*AuthzStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuthz not implemented")
+}
+func (UnimplementedKmeshAdminServer) SetAuthz(context.Context, *SetAuthzRequest) (*AuthzStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAuthz not implemented")
+}
+func (UnimplementedKmeshAdminServer) ConfigDump(context.Context, *ConfigDumpRequest) (*ConfigDumpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfigDump not implemented")
+}
+func (UnimplementedKmeshAdminServer) BpfMapDump(context.Context, *BpfMapDumpRequest) (*BpfMapDumpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BpfMapDump not implemented")
+}
+func (UnimplementedKmeshAdminServer) ListLoggers(context.Context, *ListLoggersRequest) (*ListLoggersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLoggers not implemented")
+}
+func (UnimplementedKmeshAdminServer) GetLoggerLevel(context.Context, *GetLoggerLevelRequest) (*LoggerLevel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLoggerLevel not implemented")
+}
+func (UnimplementedKmeshAdminServer) SetLoggerLevel(context.Context, *LoggerLevel) (*LoggerLevel, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLoggerLevel not implemented")
+}
+func (UnimplementedKmeshAdminServer) ExplainAuthz(context.Context, *ExplainAuthzRequest) (*AuthzExplanation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExplainAuthz not implemented")
+}
+func (UnimplementedKmeshAdminServer) GetServiceLoad(context.Context, *GetServiceLoadRequest) (*GetServiceLoadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetServiceLoad not implemented")
+}
+func (UnimplementedKmeshAdminServer) CheckPrerequisites(context.Context, *CheckPrerequisitesRequest) (*PrerequisitesReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckPrerequisites not implemented")
+}
+func (UnimplementedKmeshAdminServer) ListEnrolledWorkloads(context.Context, *ListEnrolledWorkloadsRequest) (*ListEnrolledWorkloadsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEnrolledWorkloads not implemented")
+}
+func (UnimplementedKmeshAdminServer) SimulateLocality(context.Context, *SimulateLocalityRequest) (*LocalitySimulation, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SimulateLocality not implemented")
+}
+func (UnimplementedKmeshAdminServer) GetStatus(context.Context, *GetStatusRequest) (*DaemonStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedKmeshAdminServer) ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConnections not implemented")
+}
+func (UnimplementedKmeshAdminServer) mustEmbedUnimplementedKmeshAdminServer() {}
+func (UnimplementedKmeshAdminServer) testEmbeddedByValue()                    {}
+
+// UnsafeKmeshAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KmeshAdminServer will
+// result in compilation errors.
+type UnsafeKmeshAdminServer interface {
+	mustEmbedUnimplementedKmeshAdminServer()
+}
+
+func RegisterKmeshAdminServer(s grpc.ServiceRegistrar, srv KmeshAdminServer) {
+	// If the following call pancis, it indicates UnimplementedKmeshAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&KmeshAdmin_ServiceDesc, srv)
+}
+
+func _KmeshAdmin_GetAuthz_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAuthzRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).GetAuthz(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_GetAuthz_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).GetAuthz(ctx, req.(*GetAuthzRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_SetAuthz_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetAuthzRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).SetAuthz(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_SetAuthz_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).SetAuthz(ctx, req.(*SetAuthzRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_ConfigDump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigDumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).ConfigDump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_ConfigDump_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).ConfigDump(ctx, req.(*ConfigDumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_BpfMapDump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BpfMapDumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).BpfMapDump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_BpfMapDump_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).BpfMapDump(ctx, req.(*BpfMapDumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_ListLoggers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLoggersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).ListLoggers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_ListLoggers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).ListLoggers(ctx, req.(*ListLoggersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_GetLoggerLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLoggerLevelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).GetLoggerLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_GetLoggerLevel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).GetLoggerLevel(ctx, req.(*GetLoggerLevelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_SetLoggerLevel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoggerLevel)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).SetLoggerLevel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_SetLoggerLevel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).SetLoggerLevel(ctx, req.(*LoggerLevel))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_ExplainAuthz_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainAuthzRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).ExplainAuthz(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_ExplainAuthz_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).ExplainAuthz(ctx, req.(*ExplainAuthzRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_GetServiceLoad_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServiceLoadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).GetServiceLoad(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_GetServiceLoad_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).GetServiceLoad(ctx, req.(*GetServiceLoadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_CheckPrerequisites_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckPrerequisitesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).CheckPrerequisites(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_CheckPrerequisites_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).CheckPrerequisites(ctx, req.(*CheckPrerequisitesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_ListEnrolledWorkloads_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEnrolledWorkloadsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).ListEnrolledWorkloads(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_ListEnrolledWorkloads_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).ListEnrolledWorkloads(ctx, req.(*ListEnrolledWorkloadsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_SimulateLocality_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SimulateLocalityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).SimulateLocality(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_SimulateLocality_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).SimulateLocality(ctx, req.(*SimulateLocalityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KmeshAdmin_ListConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KmeshAdminServer).ListConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KmeshAdmin_ListConnections_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KmeshAdminServer).ListConnections(ctx, req.(*ListConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KmeshAdmin_ServiceDesc is the grpc.ServiceDesc for KmeshAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KmeshAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "adminapi.KmeshAdmin",
+	HandlerType: (*KmeshAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetAuthz",
+			Handler:    _KmeshAdmin_GetAuthz_Handler,
+		},
+		{
+			MethodName: "SetAuthz",
+			Handler:    _KmeshAdmin_SetAuthz_Handler,
+		},
+		{
+			MethodName: "ConfigDump",
+			Handler:    _KmeshAdmin_ConfigDump_Handler,
+		},
+		{
+			MethodName: "BpfMapDump",
+			Handler:    _KmeshAdmin_BpfMapDump_Handler,
+		},
+		{
+			MethodName: "ListLoggers",
+			Handler:    _KmeshAdmin_ListLoggers_Handler,
+		},
+		{
+			MethodName: "GetLoggerLevel",
+			Handler:    _KmeshAdmin_GetLoggerLevel_Handler,
+		},
+		{
+			MethodName: "SetLoggerLevel",
+			Handler:    _KmeshAdmin_SetLoggerLevel_Handler,
+		},
+		{
+			MethodName: "ExplainAuthz",
+			Handler:    _KmeshAdmin_ExplainAuthz_Handler,
+		},
+		{
+			MethodName: "GetServiceLoad",
+			Handler:    _KmeshAdmin_GetServiceLoad_Handler,
+		},
+		{
+			MethodName: "CheckPrerequisites",
+			Handler:    _KmeshAdmin_CheckPrerequisites_Handler,
+		},
+		{
+			MethodName: "ListEnrolledWorkloads",
+			Handler:    _KmeshAdmin_ListEnrolledWorkloads_Handler,
+		},
+		{
+			MethodName: "SimulateLocality",
+			Handler:    _KmeshAdmin_SimulateLocality_Handler,
+		},
+		{
+			MethodName: "GetStatus",
+			Handler:    _KmeshAdmin_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListConnections",
+			Handler:    _KmeshAdmin_ListConnections_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "api/adminapi/admin.proto",
+}
@@ -86,6 +86,7 @@ struct map_mng g_map_mng = {0};
 static int update_bpf_map(struct op_context *ctx);
 static void *create_struct(struct op_context *ctx, int *err);
 static int del_bpf_map(struct op_context *ctx);
+static int del_bpf_map_fields(struct op_context *ctx);
 static int free_outter_map_entry(struct op_context *ctx, unsigned int *outer_key);
 
 static int normalize_key(struct op_context *ctx, void *key, const char *map_name)
@@ -651,15 +652,24 @@ static int update_bpf_map(struct op_context *ctx)
     return ret;
 }
 
+/*
+ * The new value is written to fresh inner map entries before it replaces the
+ * old one in a single update of the outer map, so the bpf programs see either
+ * the old value or the new one. The inner map entries of the old value are
+ * freed afterwards; on failure the old value is left in place.
+ */
 int deserial_update_elem(void *key, void *value)
 {
     int ret;
     const char *map_name = NULL;
     struct op_context context = {.map_object = NULL};
+    struct op_context old_context;
     const ProtobufCMessageDescriptor *desc;
     struct bpf_map_info info = {0};
     int map_fd = 0;
     unsigned int id;
+    void *old_value = NULL;
+    bool has_old = false;
 
     if (!key || !value)
         return -EINVAL;
@@ -683,27 +693,36 @@ int deserial_update_elem(void *key, void *value)
         goto end;
     }
 
-    deserial_delete_elem(key, desc);
-
     init_op_context(context, key, value, desc, map_fd, &info);
 
     context.map_object = calloc(1, g_map_mng.inner_infos[MAP_TYPE_MAX - 1].value_size);
-    if (context.map_object == NULL) {
+    old_value = calloc(1, info.value_size);
+    if (context.map_object == NULL || old_value == NULL) {
         ret = -errno;
         goto end;
     }
 
     normalize_key(&context, key, map_name);
+    has_old = bpf_map_lookup_elem(map_fd, context.key, old_value) == 0;
 
     ret = update_bpf_map(&context);
-    if (ret)
-        deserial_delete_elem(key, desc);
+    if (ret) {
+        LOG_ERR("%s update failed:%d, the old value is kept", map_name, ret);
+        goto end;
+    }
+
+    if (has_old) {
+        init_op_context(old_context, context.key, old_value, desc, map_fd, &info);
+        (void)del_bpf_map_fields(&old_context);
+    }
 
 end:
     if (context.key != NULL)
         free(context.key);
     if (context.map_object != NULL)
         free(context.map_object);
+    if (old_value != NULL)
+        free(old_value);
     if (map_fd > 0)
         close(map_fd);
     return ret;
@@ -1197,10 +1216,6 @@ static int field_del(struct op_context *ctx, const ProtobufCFieldDescriptor *fie
     switch (field->type) {
     case PROTOBUF_C_TYPE_MESSAGE:
     case PROTOBUF_C_TYPE_STRING:
-        ret = bpf_map_lookup_elem(ctx->curr_fd, ctx->key, ctx->value);
-        if (ret < 0)
-            return ret;
-
         outer_key = (unsigned int *)((char *)ctx->value + field->offset);
         if (!valid_outer_key(ctx, *outer_key))
             return -EINVAL;
@@ -1225,16 +1240,13 @@ static int field_del(struct op_context *ctx, const ProtobufCFieldDescriptor *fie
     return 0;
 }
 
-static int del_bpf_map(struct op_context *ctx)
+// free the inner map entries of the value already read into ctx->value
+static int del_bpf_map_fields(struct op_context *ctx)
 {
     int ret;
     unsigned int i;
     const ProtobufCMessageDescriptor *desc = ctx->desc;
 
-    ret = bpf_map_lookup_elem(ctx->curr_fd, ctx->key, ctx->value);
-    if (ret < 0)
-        return ret;
-
     for (i = 0; i < desc->n_fields; i++) {
         const ProtobufCFieldDescriptor *field = desc->fields + i;
 
@@ -1244,18 +1256,27 @@ static int del_bpf_map(struct op_context *ctx)
         switch (field->label) {
         case PROTOBUF_C_LABEL_REPEATED:
             ret = repeat_field_del(ctx, field);
-            if (ret)
-                goto end;
             break;
         default:
             ret = field_del(ctx, field);
-            if (ret)
-                goto end;
             break;
         }
+        if (ret)
+            return ret;
     }
 
-end:
+    return 0;
+}
+
+static int del_bpf_map(struct op_context *ctx)
+{
+    int ret;
+
+    ret = bpf_map_lookup_elem(ctx->curr_fd, ctx->key, ctx->value);
+    if (ret < 0)
+        return ret;
+
+    (void)del_bpf_map_fields(ctx);
     return bpf_map_delete_elem(ctx->curr_fd, ctx->key);
 }
 
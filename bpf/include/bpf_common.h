@@ -55,6 +55,22 @@ struct sock_storage_data {
     bool has_set_ip;
     // original dst info
     struct bpf_sock_tuple sk_tuple;
+    // backend marked as failed if the connection fails to establish
+    __u32 backend_uid;
+    // timeout of the connection attempt, 0 means the kernel default
+    __u32 connect_timeout_ms;
+    // the connection is reported to the daemon, which closes it once idle for that long, 0 means never
+    __u32 idle_timeout_ms;
+    // DSCP the packets of the connection are marked with, 0 leaves them unmarked
+    __u32 dscp;
+    // service whose bandwidth limits the connection, 0 if none
+    __u32 bandwidth_service_id;
+    // locality tier the backend was picked from, its prio + 1, 0 if the service is not balanced by locality
+    __u32 locality_tier;
+    // id of the connection, assigned at its start, its authz verdict and accesslog entries carry it
+    __u64 conn_id;
+    // the connection is authorized by the daemon, which is told when it closes
+    bool auth_requested;
 };
 
 struct {
@@ -64,6 +80,13 @@ struct {
     __type(value, struct sock_storage_data);
 } map_of_sock_storage SEC(".maps");
 
+// assign_conn_id gives the connection its id the first time it is seen
+static inline void assign_conn_id(struct sock_storage_data *storage)
+{
+    if (!storage->conn_id)
+        storage->conn_id = ((__u64)bpf_get_prandom_u32() << 32) | bpf_get_prandom_u32();
+}
+
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
     __uint(key_size, sizeof(__u32));
@@ -96,6 +119,20 @@ struct {
     __uint(map_flags, BPF_F_NO_PREALLOC);
 } kmesh_map1600 SEC(".maps");
 
+/*
+ * Set by the daemon before loading on the kernels without ring buffers, the maps declared as ring buffers
+ * are then created as perf event arrays. Being read-only, the verifier prunes the path the kernel lacks.
+ */
+const volatile __u32 perf_event_fallback = 0;
+
+// output an event to a map declared as a ring buffer, ctx is the context of the program
+static inline long kmesh_event_output(void *ctx, void *map, void *data, __u64 size)
+{
+    if (perf_event_fallback)
+        return bpf_perf_event_output(ctx, map, BPF_F_CURRENT_CPU, data, size);
+    return bpf_ringbuf_output(map, data, size, 0);
+}
+
 /*
  * From v5.4, bpf_get_netns_cookie can be called for bpf cgroup hooks, from v5.15, it can be called for bpf sockops
  * hook. Therefore, ensure that function is correctly used.
@@ -62,6 +62,16 @@ struct kmesh_context {
     struct ip_addr dnat_ip;
     __u32 dnat_port;
     bool via_waypoint;
+    // backend to blame if the connection fails to establish and to count it active for, 0 if the service
+    // neither retries nor balances the least connections
+    __u32 backend_uid;
+    __u32 connect_timeout_ms;
+    __u32 idle_timeout_ms;
+    __u32 dscp;
+    // service whose bandwidth limits the connection, 0 if none
+    __u32 bandwidth_service_id;
+    // locality tier the endpoint was picked from, its prio + 1, 0 if the service is not balanced by locality
+    __u32 locality_tier;
 };
 
 typedef struct {
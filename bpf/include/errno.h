@@ -32,4 +32,8 @@
 #define ENOSPC 28 /* No space left on device */
 #endif
 
+#ifndef EHOSTUNREACH
+#define EHOSTUNREACH 113 /* No route to host */
+#endif
+
 #endif // _ERRNO_H_
\ No newline at end of file
@@ -109,6 +109,7 @@ type KmeshCgroupSkbMapSpecs struct {
 	KmAuthReq     *ebpf.MapSpec `ebpf:"km_auth_req"`
 	KmAuthRes     *ebpf.MapSpec `ebpf:"km_auth_res"`
 	KmBackend     *ebpf.MapSpec `ebpf:"km_backend"`
+	KmCtStats     *ebpf.MapSpec `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.MapSpec `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.MapSpec `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.MapSpec `ebpf:"km_log_event"`
@@ -133,6 +134,7 @@ type KmeshCgroupSkbVariableSpecs struct {
 	BpfLogLevel          *ebpf.VariableSpec `ebpf:"bpf_log_level"`
 	EnableMonitoring     *ebpf.VariableSpec `ebpf:"enable_monitoring"`
 	EnablePeriodicReport *ebpf.VariableSpec `ebpf:"enable_periodic_report"`
+	PerfEventFallback    *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
 }
 
 // KmeshCgroupSkbObjects contains all objects after they have been loaded into the kernel.
@@ -158,6 +160,7 @@ type KmeshCgroupSkbMaps struct {
 	KmAuthReq     *ebpf.Map `ebpf:"km_auth_req"`
 	KmAuthRes     *ebpf.Map `ebpf:"km_auth_res"`
 	KmBackend     *ebpf.Map `ebpf:"km_backend"`
+	KmCtStats     *ebpf.Map `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.Map `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.Map `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.Map `ebpf:"km_log_event"`
@@ -180,6 +183,7 @@ func (m *KmeshCgroupSkbMaps) Close() error {
 		m.KmAuthReq,
 		m.KmAuthRes,
 		m.KmBackend,
+		m.KmCtStats,
 		m.KmEndpoint,
 		m.KmFrontend,
 		m.KmLogEvent,
@@ -205,6 +209,7 @@ type KmeshCgroupSkbVariables struct {
 	BpfLogLevel          *ebpf.Variable `ebpf:"bpf_log_level"`
 	EnableMonitoring     *ebpf.Variable `ebpf:"enable_monitoring"`
 	EnablePeriodicReport *ebpf.Variable `ebpf:"enable_periodic_report"`
+	PerfEventFallback    *ebpf.Variable `ebpf:"perf_event_fallback"`
 }
 
 // KmeshCgroupSkbPrograms contains all programs after they have been loaded into the kernel.
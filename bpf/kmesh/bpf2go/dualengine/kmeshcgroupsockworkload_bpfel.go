@@ -106,34 +106,38 @@ type KmeshCgroupSockWorkloadProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshCgroupSockWorkloadMapSpecs struct {
-	KmAuthReq     *ebpf.MapSpec `ebpf:"km_auth_req"`
-	KmAuthRes     *ebpf.MapSpec `ebpf:"km_auth_res"`
-	KmBackend     *ebpf.MapSpec `ebpf:"km_backend"`
-	KmCgrTailcall *ebpf.MapSpec `ebpf:"km_cgr_tailcall"`
-	KmEndpoint    *ebpf.MapSpec `ebpf:"km_endpoint"`
-	KmFrontend    *ebpf.MapSpec `ebpf:"km_frontend"`
-	KmLogEvent    *ebpf.MapSpec `ebpf:"km_log_event"`
-	KmManage      *ebpf.MapSpec `ebpf:"km_manage"`
-	KmPerfInfo    *ebpf.MapSpec `ebpf:"km_perf_info"`
-	KmPerfMap     *ebpf.MapSpec `ebpf:"km_perf_map"`
-	KmService     *ebpf.MapSpec `ebpf:"km_service"`
-	KmSockstorage *ebpf.MapSpec `ebpf:"km_sockstorage"`
-	KmTcpProbe    *ebpf.MapSpec `ebpf:"km_tcp_probe"`
-	KmTmpbuf      *ebpf.MapSpec `ebpf:"km_tmpbuf"`
-	KmWlpolicy    *ebpf.MapSpec `ebpf:"km_wlpolicy"`
-	KmXdpTailcall *ebpf.MapSpec `ebpf:"km_xdp_tailcall"`
-	KmeshMap1600  *ebpf.MapSpec `ebpf:"kmesh_map1600"`
-	KmeshMap192   *ebpf.MapSpec `ebpf:"kmesh_map192"`
-	KmeshMap296   *ebpf.MapSpec `ebpf:"kmesh_map296"`
-	KmeshMap64    *ebpf.MapSpec `ebpf:"kmesh_map64"`
+	KmAuthReq      *ebpf.MapSpec `ebpf:"km_auth_req"`
+	KmAuthRes      *ebpf.MapSpec `ebpf:"km_auth_res"`
+	KmBackend      *ebpf.MapSpec `ebpf:"km_backend"`
+	KmCgrTailcall  *ebpf.MapSpec `ebpf:"km_cgr_tailcall"`
+	KmCtStats      *ebpf.MapSpec `ebpf:"km_ct_stats"`
+	KmEndpoint     *ebpf.MapSpec `ebpf:"km_endpoint"`
+	KmFrontend     *ebpf.MapSpec `ebpf:"km_frontend"`
+	KmLogEvent     *ebpf.MapSpec `ebpf:"km_log_event"`
+	KmManage       *ebpf.MapSpec `ebpf:"km_manage"`
+	KmPerfInfo     *ebpf.MapSpec `ebpf:"km_perf_info"`
+	KmPerfMap      *ebpf.MapSpec `ebpf:"km_perf_map"`
+	KmRedirectPort *ebpf.MapSpec `ebpf:"km_redirect_port"`
+	KmService      *ebpf.MapSpec `ebpf:"km_service"`
+	KmSockstorage  *ebpf.MapSpec `ebpf:"km_sockstorage"`
+	KmTcpProbe     *ebpf.MapSpec `ebpf:"km_tcp_probe"`
+	KmTmpbuf       *ebpf.MapSpec `ebpf:"km_tmpbuf"`
+	KmWlpolicy     *ebpf.MapSpec `ebpf:"km_wlpolicy"`
+	KmXdpTailcall  *ebpf.MapSpec `ebpf:"km_xdp_tailcall"`
+	KmeshMap1600   *ebpf.MapSpec `ebpf:"kmesh_map1600"`
+	KmeshMap192    *ebpf.MapSpec `ebpf:"kmesh_map192"`
+	KmeshMap296    *ebpf.MapSpec `ebpf:"kmesh_map296"`
+	KmeshMap64     *ebpf.MapSpec `ebpf:"kmesh_map64"`
 }
 
 // KmeshCgroupSockWorkloadVariableSpecs contains global variables before they are loaded into the kernel.
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshCgroupSockWorkloadVariableSpecs struct {
-	BpfLogLevel      *ebpf.VariableSpec `ebpf:"bpf_log_level"`
-	EnableMonitoring *ebpf.VariableSpec `ebpf:"enable_monitoring"`
+	BpfLogLevel        *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	EnableMonitoring   *ebpf.VariableSpec `ebpf:"enable_monitoring"`
+	PerfEventFallback  *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
+	RedirectPortFilter *ebpf.VariableSpec `ebpf:"redirect_port_filter"`
 }
 
 // KmeshCgroupSockWorkloadObjects contains all objects after they have been loaded into the kernel.
@@ -156,26 +160,28 @@ func (o *KmeshCgroupSockWorkloadObjects) Close() error {
 //
 // It can be passed to LoadKmeshCgroupSockWorkloadObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshCgroupSockWorkloadMaps struct {
-	KmAuthReq     *ebpf.Map `ebpf:"km_auth_req"`
-	KmAuthRes     *ebpf.Map `ebpf:"km_auth_res"`
-	KmBackend     *ebpf.Map `ebpf:"km_backend"`
-	KmCgrTailcall *ebpf.Map `ebpf:"km_cgr_tailcall"`
-	KmEndpoint    *ebpf.Map `ebpf:"km_endpoint"`
-	KmFrontend    *ebpf.Map `ebpf:"km_frontend"`
-	KmLogEvent    *ebpf.Map `ebpf:"km_log_event"`
-	KmManage      *ebpf.Map `ebpf:"km_manage"`
-	KmPerfInfo    *ebpf.Map `ebpf:"km_perf_info"`
-	KmPerfMap     *ebpf.Map `ebpf:"km_perf_map"`
-	KmService     *ebpf.Map `ebpf:"km_service"`
-	KmSockstorage *ebpf.Map `ebpf:"km_sockstorage"`
-	KmTcpProbe    *ebpf.Map `ebpf:"km_tcp_probe"`
-	KmTmpbuf      *ebpf.Map `ebpf:"km_tmpbuf"`
-	KmWlpolicy    *ebpf.Map `ebpf:"km_wlpolicy"`
-	KmXdpTailcall *ebpf.Map `ebpf:"km_xdp_tailcall"`
-	KmeshMap1600  *ebpf.Map `ebpf:"kmesh_map1600"`
-	KmeshMap192   *ebpf.Map `ebpf:"kmesh_map192"`
-	KmeshMap296   *ebpf.Map `ebpf:"kmesh_map296"`
-	KmeshMap64    *ebpf.Map `ebpf:"kmesh_map64"`
+	KmAuthReq      *ebpf.Map `ebpf:"km_auth_req"`
+	KmAuthRes      *ebpf.Map `ebpf:"km_auth_res"`
+	KmBackend      *ebpf.Map `ebpf:"km_backend"`
+	KmCgrTailcall  *ebpf.Map `ebpf:"km_cgr_tailcall"`
+	KmCtStats      *ebpf.Map `ebpf:"km_ct_stats"`
+	KmEndpoint     *ebpf.Map `ebpf:"km_endpoint"`
+	KmFrontend     *ebpf.Map `ebpf:"km_frontend"`
+	KmLogEvent     *ebpf.Map `ebpf:"km_log_event"`
+	KmManage       *ebpf.Map `ebpf:"km_manage"`
+	KmPerfInfo     *ebpf.Map `ebpf:"km_perf_info"`
+	KmPerfMap      *ebpf.Map `ebpf:"km_perf_map"`
+	KmRedirectPort *ebpf.Map `ebpf:"km_redirect_port"`
+	KmService      *ebpf.Map `ebpf:"km_service"`
+	KmSockstorage  *ebpf.Map `ebpf:"km_sockstorage"`
+	KmTcpProbe     *ebpf.Map `ebpf:"km_tcp_probe"`
+	KmTmpbuf       *ebpf.Map `ebpf:"km_tmpbuf"`
+	KmWlpolicy     *ebpf.Map `ebpf:"km_wlpolicy"`
+	KmXdpTailcall  *ebpf.Map `ebpf:"km_xdp_tailcall"`
+	KmeshMap1600   *ebpf.Map `ebpf:"kmesh_map1600"`
+	KmeshMap192    *ebpf.Map `ebpf:"kmesh_map192"`
+	KmeshMap296    *ebpf.Map `ebpf:"kmesh_map296"`
+	KmeshMap64     *ebpf.Map `ebpf:"kmesh_map64"`
 }
 
 func (m *KmeshCgroupSockWorkloadMaps) Close() error {
@@ -184,12 +190,14 @@ func (m *KmeshCgroupSockWorkloadMaps) Close() error {
 		m.KmAuthRes,
 		m.KmBackend,
 		m.KmCgrTailcall,
+		m.KmCtStats,
 		m.KmEndpoint,
 		m.KmFrontend,
 		m.KmLogEvent,
 		m.KmManage,
 		m.KmPerfInfo,
 		m.KmPerfMap,
+		m.KmRedirectPort,
 		m.KmService,
 		m.KmSockstorage,
 		m.KmTcpProbe,
@@ -207,8 +215,10 @@ func (m *KmeshCgroupSockWorkloadMaps) Close() error {
 //
 // It can be passed to LoadKmeshCgroupSockWorkloadObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshCgroupSockWorkloadVariables struct {
-	BpfLogLevel      *ebpf.Variable `ebpf:"bpf_log_level"`
-	EnableMonitoring *ebpf.Variable `ebpf:"enable_monitoring"`
+	BpfLogLevel        *ebpf.Variable `ebpf:"bpf_log_level"`
+	EnableMonitoring   *ebpf.Variable `ebpf:"enable_monitoring"`
+	PerfEventFallback  *ebpf.Variable `ebpf:"perf_event_fallback"`
+	RedirectPortFilter *ebpf.Variable `ebpf:"redirect_port_filter"`
 }
 
 // KmeshCgroupSockWorkloadPrograms contains all programs after they have been loaded into the kernel.
@@ -103,7 +103,8 @@ type KmeshSendmsgMapSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshSendmsgVariableSpecs struct {
-	BpfLogLevel *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	BpfLogLevel       *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
 }
 
 // KmeshSendmsgObjects contains all objects after they have been loaded into the kernel.
@@ -153,7 +154,8 @@ func (m *KmeshSendmsgMaps) Close() error {
 //
 // It can be passed to LoadKmeshSendmsgObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshSendmsgVariables struct {
-	BpfLogLevel *ebpf.Variable `ebpf:"bpf_log_level"`
+	BpfLogLevel       *ebpf.Variable `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.Variable `ebpf:"perf_event_fallback"`
 }
 
 // KmeshSendmsgPrograms contains all programs after they have been loaded into the kernel.
@@ -103,7 +103,8 @@ type KmeshSendmsgCompatMapSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshSendmsgCompatVariableSpecs struct {
-	BpfLogLevel *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	BpfLogLevel       *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
 }
 
 // KmeshSendmsgCompatObjects contains all objects after they have been loaded into the kernel.
@@ -153,7 +154,8 @@ func (m *KmeshSendmsgCompatMaps) Close() error {
 //
 // It can be passed to LoadKmeshSendmsgCompatObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshSendmsgCompatVariables struct {
-	BpfLogLevel *ebpf.Variable `ebpf:"bpf_log_level"`
+	BpfLogLevel       *ebpf.Variable `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.Variable `ebpf:"perf_event_fallback"`
 }
 
 // KmeshSendmsgCompatPrograms contains all programs after they have been loaded into the kernel.
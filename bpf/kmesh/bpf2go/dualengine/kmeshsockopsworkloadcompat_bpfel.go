@@ -108,6 +108,7 @@ type KmeshSockopsWorkloadCompatMapSpecs struct {
 	KmAuthReq     *ebpf.MapSpec `ebpf:"km_auth_req"`
 	KmAuthRes     *ebpf.MapSpec `ebpf:"km_auth_res"`
 	KmBackend     *ebpf.MapSpec `ebpf:"km_backend"`
+	KmCtStats     *ebpf.MapSpec `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.MapSpec `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.MapSpec `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.MapSpec `ebpf:"km_log_event"`
@@ -130,10 +131,11 @@ type KmeshSockopsWorkloadCompatMapSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshSockopsWorkloadCompatVariableSpecs struct {
-	BpfLogLevel      *ebpf.VariableSpec `ebpf:"bpf_log_level"`
-	EnableMonitoring *ebpf.VariableSpec `ebpf:"enable_monitoring"`
-	NodeIp           *ebpf.VariableSpec `ebpf:"node_ip"`
-	PodGateway       *ebpf.VariableSpec `ebpf:"pod_gateway"`
+	BpfLogLevel       *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	EnableMonitoring  *ebpf.VariableSpec `ebpf:"enable_monitoring"`
+	NodeIp            *ebpf.VariableSpec `ebpf:"node_ip"`
+	PerfEventFallback *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
+	PodGateway        *ebpf.VariableSpec `ebpf:"pod_gateway"`
 }
 
 // KmeshSockopsWorkloadCompatObjects contains all objects after they have been loaded into the kernel.
@@ -159,6 +161,7 @@ type KmeshSockopsWorkloadCompatMaps struct {
 	KmAuthReq     *ebpf.Map `ebpf:"km_auth_req"`
 	KmAuthRes     *ebpf.Map `ebpf:"km_auth_res"`
 	KmBackend     *ebpf.Map `ebpf:"km_backend"`
+	KmCtStats     *ebpf.Map `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.Map `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.Map `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.Map `ebpf:"km_log_event"`
@@ -182,6 +185,7 @@ func (m *KmeshSockopsWorkloadCompatMaps) Close() error {
 		m.KmAuthReq,
 		m.KmAuthRes,
 		m.KmBackend,
+		m.KmCtStats,
 		m.KmEndpoint,
 		m.KmFrontend,
 		m.KmLogEvent,
@@ -205,10 +209,11 @@ func (m *KmeshSockopsWorkloadCompatMaps) Close() error {
 //
 // It can be passed to LoadKmeshSockopsWorkloadCompatObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshSockopsWorkloadCompatVariables struct {
-	BpfLogLevel      *ebpf.Variable `ebpf:"bpf_log_level"`
-	EnableMonitoring *ebpf.Variable `ebpf:"enable_monitoring"`
-	NodeIp           *ebpf.Variable `ebpf:"node_ip"`
-	PodGateway       *ebpf.Variable `ebpf:"pod_gateway"`
+	BpfLogLevel       *ebpf.Variable `ebpf:"bpf_log_level"`
+	EnableMonitoring  *ebpf.Variable `ebpf:"enable_monitoring"`
+	NodeIp            *ebpf.Variable `ebpf:"node_ip"`
+	PerfEventFallback *ebpf.Variable `ebpf:"perf_event_fallback"`
+	PodGateway        *ebpf.Variable `ebpf:"pod_gateway"`
 }
 
 // KmeshSockopsWorkloadCompatPrograms contains all programs after they have been loaded into the kernel.
@@ -99,6 +99,7 @@ type KmeshXDPAuthMapSpecs struct {
 	KmAuthzPolicy *ebpf.MapSpec `ebpf:"km_authz_policy"`
 	KmBackend     *ebpf.MapSpec `ebpf:"km_backend"`
 	KmCgrTailcall *ebpf.MapSpec `ebpf:"km_cgr_tailcall"`
+	KmCtStats     *ebpf.MapSpec `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.MapSpec `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.MapSpec `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.MapSpec `ebpf:"km_log_event"`
@@ -119,8 +120,9 @@ type KmeshXDPAuthMapSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type KmeshXDPAuthVariableSpecs struct {
-	AuthzOffload *ebpf.VariableSpec `ebpf:"authz_offload"`
-	BpfLogLevel  *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	AuthzOffload      *ebpf.VariableSpec `ebpf:"authz_offload"`
+	BpfLogLevel       *ebpf.VariableSpec `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.VariableSpec `ebpf:"perf_event_fallback"`
 }
 
 // KmeshXDPAuthObjects contains all objects after they have been loaded into the kernel.
@@ -148,6 +150,7 @@ type KmeshXDPAuthMaps struct {
 	KmAuthzPolicy *ebpf.Map `ebpf:"km_authz_policy"`
 	KmBackend     *ebpf.Map `ebpf:"km_backend"`
 	KmCgrTailcall *ebpf.Map `ebpf:"km_cgr_tailcall"`
+	KmCtStats     *ebpf.Map `ebpf:"km_ct_stats"`
 	KmEndpoint    *ebpf.Map `ebpf:"km_endpoint"`
 	KmFrontend    *ebpf.Map `ebpf:"km_frontend"`
 	KmLogEvent    *ebpf.Map `ebpf:"km_log_event"`
@@ -171,6 +174,7 @@ func (m *KmeshXDPAuthMaps) Close() error {
 		m.KmAuthzPolicy,
 		m.KmBackend,
 		m.KmCgrTailcall,
+		m.KmCtStats,
 		m.KmEndpoint,
 		m.KmFrontend,
 		m.KmLogEvent,
@@ -192,8 +196,9 @@ func (m *KmeshXDPAuthMaps) Close() error {
 //
 // It can be passed to LoadKmeshXDPAuthObjects or ebpf.CollectionSpec.LoadAndAssign.
 type KmeshXDPAuthVariables struct {
-	AuthzOffload *ebpf.Variable `ebpf:"authz_offload"`
-	BpfLogLevel  *ebpf.Variable `ebpf:"bpf_log_level"`
+	AuthzOffload      *ebpf.Variable `ebpf:"authz_offload"`
+	BpfLogLevel       *ebpf.Variable `ebpf:"bpf_log_level"`
+	PerfEventFallback *ebpf.Variable `ebpf:"perf_event_fallback"`
 }
 
 // KmeshXDPAuthPrograms contains all programs after they have been loaded into the kernel.
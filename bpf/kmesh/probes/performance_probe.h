@@ -39,19 +39,15 @@ struct {
     __uint(max_entries, RINGBUF_SIZE);
 } kmesh_perf_info SEC(".maps");
 
-static inline void performance_report(struct operation_usage_data *data)
+static inline void performance_report(void *ctx, struct operation_usage_data *data)
 {
-    struct operation_usage_data *info = NULL;
-    info = bpf_ringbuf_reserve(&kmesh_perf_info, sizeof(struct operation_usage_data), 0);
-    if (!info) {
-        BPF_LOG(ERR, PROBE, "bpf_ringbuf_reserve map proformance info failed\n");
-        return;
-    }
-    info->start_time = data->start_time;
-    info->end_time = data->end_time;
-    info->operation_type = data->operation_type;
-    info->pid_tgid = data->pid_tgid;
-    bpf_ringbuf_submit(info, 0);
+    struct operation_usage_data info = {0};
+    info.start_time = data->start_time;
+    info.end_time = data->end_time;
+    info.operation_type = data->operation_type;
+    info.pid_tgid = data->pid_tgid;
+    if (kmesh_event_output(ctx, &kmesh_perf_info, &info, sizeof(info)))
+        BPF_LOG(ERR, PROBE, "output map proformance info failed\n");
 }
 
 static inline void observe_on_operation_start(__u32 operation_type, struct kmesh_context *kmesh_ctx)
@@ -86,7 +82,7 @@ static inline void observe_on_operation_end(__u32 operation_type, struct kmesh_c
     if (data) {
         data->end_time = bpf_ktime_get_ns();
         data->pid_tgid = pid_tgid;
-        performance_report(data);
+        performance_report(ctx, data);
     }
     bpf_map_delete_elem(&kmesh_perf_map, &key);
     return;
@@ -16,6 +16,13 @@ static inline bool is_monitoring_enable()
     return enable_monitoring == 1;
 }
 
+// connections with an idle timeout are reported even when monitoring is disabled,
+// the daemon relies on the reports to know which connections to reap once idle
+static inline bool is_report_needed(struct sock_storage_data *storage)
+{
+    return is_monitoring_enable() || storage->idle_timeout_ms;
+}
+
 static inline void observe_on_pre_connect(struct bpf_sock *sk)
 {
     struct sock_storage_data *storage = NULL;
@@ -29,12 +36,14 @@ static inline void observe_on_pre_connect(struct bpf_sock *sk)
     }
 
     storage->connect_ns = bpf_ktime_get_ns();
+    assign_conn_id(storage);
     return;
 }
 
-static inline void observe_on_connect_established(struct bpf_sock *sk, __u8 direction)
+static inline void observe_on_connect_established(void *ctx, struct bpf_sock *sk, __u8 direction)
 {
-    if (!is_monitoring_enable()) {
+    // only outbound connections can have an idle timeout
+    if (!is_monitoring_enable() && direction == INBOUND) {
         return;
     }
 
@@ -53,20 +62,21 @@ static inline void observe_on_connect_established(struct bpf_sock *sk, __u8 dire
         BPF_LOG(ERR, PROBE, "on connect: bpf_sk_storage_get failed\n");
         return;
     }
+    if (!is_report_needed(storage))
+        return;
 
     // INBOUND scenario
-    if (direction == INBOUND)
+    if (direction == INBOUND) {
         storage->connect_ns = bpf_ktime_get_ns();
+        assign_conn_id(storage);
+    }
     storage->direction = direction;
     storage->connect_success = true;
-    tcp_report(sk, tcp_sock, storage, BPF_TCP_ESTABLISHED);
+    tcp_report(ctx, sk, tcp_sock, storage, BPF_TCP_ESTABLISHED);
 }
 
-static inline void observe_on_close(struct bpf_sock *sk)
+static inline void observe_on_close(void *ctx, struct bpf_sock *sk)
 {
-    if (!is_monitoring_enable()) {
-        return;
-    }
     struct bpf_tcp_sock *tcp_sock = NULL;
     struct sock_storage_data *storage = NULL;
     if (!sk)
@@ -80,11 +90,13 @@ static inline void observe_on_close(struct bpf_sock *sk)
         // maybe the connection is established before kmesh start
         return;
     }
+    if (!is_report_needed(storage))
+        return;
 
-    tcp_report(sk, tcp_sock, storage, BPF_TCP_CLOSE);
+    tcp_report(ctx, sk, tcp_sock, storage, BPF_TCP_CLOSE);
 }
 
-static inline void observe_on_data(struct bpf_sock *sk)
+static inline void observe_on_data(void *ctx, struct bpf_sock *sk)
 {
     struct bpf_tcp_sock *tcp_sock = NULL;
     struct sock_storage_data *storage = NULL;
@@ -102,7 +114,7 @@ static inline void observe_on_data(struct bpf_sock *sk)
     }
     __u64 now = bpf_ktime_get_ns();
     if ((storage->last_report_ns != 0) && (now - storage->last_report_ns > LONG_CONN_THRESHOLD_TIME)) {
-        tcp_report(sk, tcp_sock, storage, BPF_TCP_ESTABLISHED);
+        tcp_report(ctx, sk, tcp_sock, storage, BPF_TCP_ESTABLISHED);
     }
 }
 #endif
\ No newline at end of file
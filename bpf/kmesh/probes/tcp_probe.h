@@ -45,10 +45,13 @@ struct tcp_probe_info {
     __u64 start_ns;
     __u64 last_report_ns; /*timestamp of the last metrics report*/
     __u32 protocol;
-    __u32 srtt_us;       /* smoothed round trip time << 3 in usecs until last_report_ns */
-    __u32 rtt_min;       /* min round trip time in usecs until last_report_ns */
-    __u32 total_retrans; /* Total retransmits from start to last_report_ns */
-    __u32 lost_out;      /* Lost packets from start to last_report_ns	*/
+    __u32 srtt_us;         /* smoothed round trip time << 3 in usecs until last_report_ns */
+    __u32 rtt_min;         /* min round trip time in usecs until last_report_ns */
+    __u32 total_retrans;   /* Total retransmits from start to last_report_ns */
+    __u32 lost_out;        /* Lost packets from start to last_report_ns	*/
+    __u32 idle_timeout_ms; /* idle timeout of the connection, 0 if not set */
+    __u32 locality_tier;   /* locality tier the backend was picked from, its prio + 1, 0 if none */
+    __u64 conn_id;         /* id of the connection, also carried by its authz verdict */
 };
 
 struct {
@@ -127,17 +130,11 @@ construct_orig_dst_info(struct bpf_sock *sk, struct sock_storage_data *storage,
     }
 }
 
-static inline void
-tcp_report(struct bpf_sock *sk, struct bpf_tcp_sock *tcp_sock, struct sock_storage_data *storage, __u32 state)
+static inline void tcp_report(
+    void *ctx, struct bpf_sock *sk, struct bpf_tcp_sock *tcp_sock, struct sock_storage_data *storage, __u32 state)
 {
-    struct tcp_probe_info *info = NULL;
-
-    // store tuple
-    info = bpf_ringbuf_reserve(&map_of_tcp_probe, sizeof(struct tcp_probe_info), 0);
-    if (!info) {
-        BPF_LOG(ERR, PROBE, "bpf_ringbuf_reserve tcp_report failed\n");
-        return;
-    }
+    struct tcp_probe_info info_buf = {0};
+    struct tcp_probe_info *info = &info_buf;
 
     construct_tuple(sk, &info->tuple, storage->direction);
     info->start_ns = storage->connect_ns;
@@ -151,10 +148,14 @@ tcp_report(struct bpf_sock *sk, struct bpf_tcp_sock *tcp_sock, struct sock_stora
     }
 
     construct_orig_dst_info(sk, storage, info);
+    info->idle_timeout_ms = storage->idle_timeout_ms;
+    info->locality_tier = storage->locality_tier;
+    info->conn_id = storage->conn_id;
     info->last_report_ns = bpf_ktime_get_ns();
     info->duration = info->last_report_ns - storage->connect_ns;
     storage->last_report_ns = info->last_report_ns;
-    bpf_ringbuf_submit(info, 0);
+    if (kmesh_event_output(ctx, &map_of_tcp_probe, info, sizeof(*info)))
+        BPF_LOG(ERR, PROBE, "output tcp_report failed\n");
 }
 
 #endif
\ No newline at end of file
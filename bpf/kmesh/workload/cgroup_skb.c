@@ -10,6 +10,7 @@
 #include "bpf_common.h"
 #include "probe.h"
 #include "config.h"
+#include "bandwidth.h"
 
 volatile __u32 enable_periodic_report = 0;
 
@@ -18,12 +19,25 @@ static inline bool is__periodic_report_enable()
     return enable_periodic_report == 1;
 }
 
-SEC("cgroup_skb/ingress")
-int cgroup_skb_ingress_prog(struct __sk_buff *skb)
+static inline void observe_on_skb(struct __sk_buff *skb, struct bpf_sock *sk)
 {
     if (!is_monitoring_enable() || !is__periodic_report_enable()) {
-        return SK_PASS;
+        return;
+    }
+
+    if (sock_conn_from_sim(skb)) {
+        return;
     }
+
+    if (!is_managed_by_kmesh_skb(skb))
+        return;
+
+    observe_on_data(skb, sk);
+}
+
+SEC("cgroup_skb/ingress")
+int cgroup_skb_ingress_prog(struct __sk_buff *skb)
+{
     if (skb->family != AF_INET && skb->family != AF_INET6)
         return SK_PASS;
 
@@ -31,23 +45,17 @@ int cgroup_skb_ingress_prog(struct __sk_buff *skb)
     if (!sk)
         return SK_PASS;
 
-    if (sock_conn_from_sim(skb)) {
-        return SK_PASS;
-    }
-
-    if (!is_managed_by_kmesh_skb(skb))
-        return SK_PASS;
+    observe_on_skb(skb, sk);
 
-    observe_on_data(sk);
+    // the packets received can only be dropped, the sender slows down on the loss
+    if (bandwidth_limit(skb, sk, BANDWIDTH_INGRESS) == BANDWIDTH_DROP)
+        return SK_DROP;
     return SK_PASS;
 }
 
 SEC("cgroup_skb/egress")
 int cgroup_skb_egress_prog(struct __sk_buff *skb)
 {
-    if (!is_monitoring_enable() || !is__periodic_report_enable()) {
-        return SK_PASS;
-    }
     if (skb->family != AF_INET && skb->family != AF_INET6)
         return SK_PASS;
 
@@ -55,15 +63,17 @@ int cgroup_skb_egress_prog(struct __sk_buff *skb)
     if (!sk)
         return SK_PASS;
 
-    if (sock_conn_from_sim(skb)) {
-        return SK_PASS;
-    }
+    observe_on_skb(skb, sk);
 
-    if (!is_managed_by_kmesh_skb(skb))
+    // tcp reduces its window on the congestion notification, the packets are throttled rather than dropped
+    switch (bandwidth_limit(skb, sk, BANDWIDTH_EGRESS)) {
+    case BANDWIDTH_THROTTLE:
+        return CGROUP_SKB_PASS_CN;
+    case BANDWIDTH_DROP:
+        return CGROUP_SKB_DROP_CN;
+    default:
         return SK_PASS;
-
-    observe_on_data(sk);
-    return SK_PASS;
+    }
 }
 
 char _license[] SEC("license") = "Dual BSD/GPL";
@@ -10,6 +10,7 @@
 #include "frontend.h"
 #include "bpf_common.h"
 #include "probe.h"
+#include "redirect_port.h"
 
 static inline int sock_traffic_control(struct kmesh_context *kmesh_ctx)
 {
@@ -48,7 +49,7 @@ static inline int sock_traffic_control(struct kmesh_context *kmesh_ctx)
 
     ret = frontend_manager(kmesh_ctx, frontend_v);
     if (ret != 0) {
-        if (ret != -ENOENT)
+        if (ret != -ENOENT && ret != -EHOSTUNREACH)
             BPF_LOG(ERR, KMESH, "frontend_manager failed, ret:%d\n", ret);
         return ret;
     }
@@ -71,6 +72,12 @@ static inline int set_original_dst_info(struct kmesh_context *kmesh_ctx)
     if (kmesh_ctx->via_waypoint) {
         storage->via_waypoint = true;
     }
+    storage->backend_uid = kmesh_ctx->backend_uid;
+    storage->connect_timeout_ms = kmesh_ctx->connect_timeout_ms;
+    storage->idle_timeout_ms = kmesh_ctx->idle_timeout_ms;
+    storage->dscp = kmesh_ctx->dscp;
+    storage->bandwidth_service_id = kmesh_ctx->bandwidth_service_id;
+    storage->locality_tier = kmesh_ctx->locality_tier;
 
     if (ctx->family == AF_INET && !storage->has_set_ip) {
         storage->sk_tuple.ipv4.daddr = kmesh_ctx->orig_dst_addr.ip4;
@@ -98,12 +105,15 @@ int cgroup_connect4_prog(struct bpf_sock_addr *ctx)
         return CGROUP_SOCK_OK;
     }
 
-    if (ctx->protocol != IPPROTO_TCP)
+    if (ctx->protocol != IPPROTO_TCP || !is_redirect_port(ctx->user_port))
         return CGROUP_SOCK_OK;
 
     observe_on_pre_connect(ctx->sk);
 
     int ret = sock_traffic_control(&kmesh_ctx);
+    // the connections to an unavailable service fail right away
+    if (ret == -EHOSTUNREACH)
+        return CGROUP_SOCK_ERR;
     if (ret) {
         return CGROUP_SOCK_OK;
     }
@@ -138,12 +148,15 @@ int cgroup_connect6_prog(struct bpf_sock_addr *ctx)
     }
 
     BPF_LOG(DEBUG, KMESH, "enter cgroup/connect6\n");
-    if (ctx->protocol != IPPROTO_TCP)
+    if (ctx->protocol != IPPROTO_TCP || !is_redirect_port(ctx->user_port))
         return CGROUP_SOCK_OK;
 
     observe_on_pre_connect(ctx->sk);
 
     int ret = sock_traffic_control(&kmesh_ctx);
+    // the connections to an unavailable service fail right away
+    if (ret == -EHOSTUNREACH)
+        return CGROUP_SOCK_ERR;
     if (ret) {
         return CGROUP_SOCK_OK;
     }
@@ -13,6 +13,9 @@
 
 #define AUTH_ALLOW      0
 #define AUTH_DENY       1
+// the daemon queues the connection beyond the kmesh.net/max-connections of its service, its packets are dropped
+// and retransmitted by the peer until the daemon admits it
+#define AUTH_QUEUED     2
 #define UNMATCHED       0
 #define MATCHED         1
 #define UNSUPPORTED     2
@@ -67,6 +70,8 @@ struct MatchIpParams {
     __u32 n_not_ips;
     // Type of IP addresses (srcIP/dstIp).
     int ip_type;
+    // IP version of the connection, an ip block only applies to the connections of its family.
+    __u8 ip_version;
 };
 
 static inline Istio__Security__Authorization *map_lookup_authz(__u32 policyKey)
@@ -239,7 +244,8 @@ static inline __u32 convert_ipv6_to_ip6addr(struct ip_addr *rule_addr, const str
 
     for (int i = 0; i < 4; i++) {
         for (int j = 0; j < 4; j++) {
-            rule_addr->ip6[i] |= (v6addr[i * 4 + j] << (i * 8));
+            // the words are kept in network order, as the addresses of the tuple
+            rule_addr->ip6[i] |= (v6addr[i * 4 + j] << (j * 8));
         }
     }
 
@@ -268,7 +274,8 @@ static inline int match_ipv4_rule(__u32 ruleIp, __u32 preFixLen, struct bpf_sock
     if (preFixLen > 32) {
         return UNMATCHED;
     }
-    mask = 0xFFFFFFFF << (32 - preFixLen);
+    // shifting by 32 is undefined, the /0 block matches any address
+    mask = preFixLen ? 0xFFFFFFFF << (32 - preFixLen) : 0;
     if ((ruleIp & mask) == (bpf_ntohl(targetIP) & mask)) {
         return MATCHED;
     }
@@ -290,14 +297,22 @@ static inline int match_ipv6_rule(struct ip_addr *rule_addr, struct ip_addr *tar
     return UNMATCHED;
 }
 
-static inline int
-match_ip_rule(struct ProtobufCBinaryData *addrInfo, __u32 preFixLen, struct bpf_sock_tuple *tuple_info, __u8 type)
+static inline int match_ip_rule(
+    struct ProtobufCBinaryData *addrInfo,
+    __u32 preFixLen,
+    struct bpf_sock_tuple *tuple_info,
+    __u8 type,
+    __u8 ip_version)
 {
     if (!addrInfo || addrInfo->len == 0) {
         return UNMATCHED;
     }
 
     if (addrInfo->len == IPV4_BYTE_LEN) {
+        // the ipv4 blocks do not match the ipv6 connections, nor the ipv6 blocks the ipv4 ones
+        if (ip_version != IPV4_VERSION) {
+            return UNMATCHED;
+        }
         __u32 rule_ip = convert_ipv4_to_u32(addrInfo, false);
         return match_ipv4_rule(rule_ip, preFixLen, tuple_info, type);
     } else if (addrInfo->len == IPV6_BYTE_LEN) {
@@ -310,9 +325,16 @@ match_ip_rule(struct ProtobufCBinaryData *addrInfo, __u32 preFixLen, struct bpf_
                 return UNMATCHED;
             }
             if (is_ipv4_mapped_addr(rule_addr.ip6)) {
+                // the prefix of an ipv4-mapped block counts the 96 bits of the mapping
+                if (ip_version != IPV4_VERSION || preFixLen < 96) {
+                    return UNMATCHED;
+                }
                 __u32 rule_ip = convert_ipv4_to_u32(addrInfo, true);
-                return match_ipv4_rule(rule_ip, preFixLen, tuple_info, type);
+                return match_ipv4_rule(rule_ip, preFixLen - 96, tuple_info, type);
             } else {
+                if (ip_version != IPV6_VERSION) {
+                    return UNMATCHED;
+                }
                 if (type & TYPE_SRCIP) {
                     IP6_COPY(target_addr.ip6, tuple_info->ipv6.saddr);
                 } else if (type & TYPE_DSTIP) {
@@ -369,7 +391,7 @@ static inline int match_ip_common(struct MatchIpParams *params)
                 continue;
             }
 
-            if (match_ip_rule(&notIp->address, notIp->length, params->tuple_info, params->ip_type) == MATCHED) {
+            if (match_ip_rule(&notIp->address, notIp->length, params->tuple_info, params->ip_type, params->ip_version) == MATCHED) {
                 return UNMATCHED;
             }
         }
@@ -401,7 +423,7 @@ static inline int match_ip_common(struct MatchIpParams *params)
                 continue;
             }
 
-            if (match_ip_rule(&ip->address, ip->length, params->tuple_info, params->ip_type) == MATCHED) {
+            if (match_ip_rule(&ip->address, ip->length, params->tuple_info, params->ip_type, params->ip_version) == MATCHED) {
                 return MATCHED;
             }
         }
@@ -409,7 +431,7 @@ static inline int match_ip_common(struct MatchIpParams *params)
     return UNMATCHED;
 }
 
-static inline int match_src_ip(Istio__Security__Match *match, struct bpf_sock_tuple *tuple_info)
+static inline int match_src_ip(Istio__Security__Match *match, struct xdp_info *info, struct bpf_sock_tuple *tuple_info)
 {
     if (!match || !tuple_info) {
         return UNMATCHED;
@@ -422,11 +444,12 @@ static inline int match_src_ip(Istio__Security__Match *match, struct bpf_sock_tu
         .n_ips = match->n_source_ips,
         .n_not_ips = match->n_not_source_ips,
         .ip_type = TYPE_SRCIP,
+        .ip_version = info->iph->version,
     };
     return match_ip_common(&params);
 }
 
-static inline int match_dst_ip(Istio__Security__Match *match, struct bpf_sock_tuple *tuple_info)
+static inline int match_dst_ip(Istio__Security__Match *match, struct xdp_info *info, struct bpf_sock_tuple *tuple_info)
 {
     if (!match || !tuple_info) {
         return UNMATCHED;
@@ -439,13 +462,14 @@ static inline int match_dst_ip(Istio__Security__Match *match, struct bpf_sock_tu
         .n_ips = match->n_destination_ips,
         .n_not_ips = match->n_not_destination_ips,
         .ip_type = TYPE_DSTIP,
+        .ip_version = info->iph->version,
     };
     return match_ip_common(&params);
 }
 
-static inline int match_IPs(Istio__Security__Match *match, struct bpf_sock_tuple *tuple_info)
+static inline int match_IPs(Istio__Security__Match *match, struct xdp_info *info, struct bpf_sock_tuple *tuple_info)
 {
-    return match_src_ip(match, tuple_info) && match_dst_ip(match, tuple_info);
+    return match_src_ip(match, info, tuple_info) && match_dst_ip(match, info, tuple_info);
 }
 
 static int match_check(Istio__Security__Match *match, struct xdp_info *info, struct bpf_sock_tuple *tuple_info)
@@ -454,7 +478,7 @@ static int match_check(Istio__Security__Match *match, struct xdp_info *info, str
 
     // if multiple types are set, they are AND-ed, all matched is a match
     // todo: add other match types
-    matchResult = match_dst_ports(match, info, tuple_info) && match_IPs(match, tuple_info);
+    matchResult = match_dst_ports(match, info, tuple_info) && match_IPs(match, info, tuple_info);
     return matchResult;
 }
 
@@ -465,6 +489,17 @@ bool need_tail_call_to_user(Istio__Security__Match *match)
     return match->n_namespaces || match->n_not_namespaces || match->n_principals || match->n_not_principals;
 }
 
+/* istiod converts a `when` condition on an L7 attribute, like request.headers or
+ * connection.sni, into a match without any field. Such a condition can only be
+ * evaluated by the waypoint, so the match is skipped as in userspace.
+ */
+static inline bool is_empty_match(Istio__Security__Match *match)
+{
+    return !match->n_destination_ips && !match->n_not_destination_ips && !match->n_source_ips
+        && !match->n_not_source_ips && !match->n_destination_ports && !match->n_not_destination_ports
+        && !need_tail_call_to_user(match);
+}
+
 static int clause_match_check(
     Istio__Security__Clause *cl,
     struct xdp_info *info,
@@ -489,7 +524,7 @@ static int clause_match_check(
             break;
         }
         match = (Istio__Security__Match *)KMESH_GET_PTR_VAL((void *)*((__u64 *)matchsPtr + i), Istio__Security__Match);
-        if (!match) {
+        if (!match || is_empty_match(match)) {
             continue;
         }
         // if any match matches, it is a match
@@ -582,6 +617,18 @@ int policies_check(struct xdp_md *ctx)
             return XDP_PASS;
         }
         return match_ctx->auth_result;
+    } else if (policy->n_rules == 0) {
+        // a policy without rules matches nothing, an ALLOW one still denies
+        // the connections no other ALLOW policy matches
+        if (match_ctx->auth_result == XDP_PASS) {
+            match_ctx->auth_result = policy->action == ISTIO__SECURITY__ACTION__DENY ? XDP_PASS : XDP_DROP;
+        }
+        match_ctx->policy_index++;
+        ret = bpf_map_update_elem(&kmesh_tc_args, &tuple_key, match_ctx, BPF_ANY);
+        if (ret < 0) {
+            return XDP_PASS;
+        }
+        bpf_tail_call(ctx, &map_of_xdp_tailcall, TAIL_CALL_POLICIES_CHECK);
     } else {
         rulesPtr = KMESH_GET_PTR_VAL(policy->rules, void *);
         if (!rulesPtr) {
@@ -687,6 +734,8 @@ int policy_check(struct xdp_md *ctx)
         __u32 auth_result = match_ctx->action == ISTIO__SECURITY__ACTION__DENY ? AUTH_DENY : AUTH_ALLOW;
         if (bpf_map_update_elem(&map_of_auth_result, &tuple_key, &auth_result, BPF_ANY) != 0) {
             BPF_LOG(ERR, AUTH, "failed to update auth result in map_of_auth_result");
+        } else {
+            conntrack_stat_inc(CONNTRACK_STAT_INSERTED);
         }
         return match_ctx->action == ISTIO__SECURITY__ACTION__DENY ? XDP_DROP : XDP_PASS;
     }
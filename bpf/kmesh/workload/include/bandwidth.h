@@ -0,0 +1,77 @@
+/* SPDX-License-Identifier: (GPL-2.0-only OR BSD-2-Clause) */
+/* Copyright Authors of Kmesh */
+
+#ifndef __KMESH_BANDWIDTH_H__
+#define __KMESH_BANDWIDTH_H__
+
+#include "bpf_common.h"
+#include "workload.h"
+
+#define NSEC_PER_SEC (1000ULL * 1000 * 1000)
+// traffic beyond the bandwidth of a service let through in a burst, as the time to send it at the bandwidth
+#define BANDWIDTH_BURST_NS (10ULL * 1000 * 1000)
+// the packets beyond twice the burst are dropped, the sender did not slow down when notified of congestion
+#define BANDWIDTH_DROP_NS (2 * BANDWIDTH_BURST_NS)
+
+// verdicts of a cgroup_skb egress program notifying tcp of congestion, which then reduces its window
+#define CGROUP_SKB_DROP_CN 2
+#define CGROUP_SKB_PASS_CN 3
+
+enum bandwidth_verdict {
+    BANDWIDTH_PASS = 0,
+    BANDWIDTH_THROTTLE,
+    BANDWIDTH_DROP,
+};
+
+/*
+ * charge a packet of len bytes to the token bucket of the direction of the service. The bucket is kept as
+ * the time the bytes charged so far are drained at, at the bandwidth of the service: the bucket holds the
+ * tokens of the burst while it is no later than now, and it runs out of tokens beyond the burst.
+ */
+static inline int bandwidth_charge(service_value *service_v, __u32 direction, __u32 len)
+{
+    __u64 rate, now, tat;
+
+    if (direction > BANDWIDTH_INGRESS)
+        return BANDWIDTH_PASS;
+    rate = service_v->bandwidth[direction];
+    if (!rate)
+        return BANDWIDTH_PASS;
+
+    now = bpf_ktime_get_ns();
+    tat = service_v->bandwidth_tat_ns[direction];
+    if (tat < now)
+        tat = now;
+    if (tat - now > BANDWIDTH_DROP_NS) {
+        __sync_fetch_and_add(&service_v->bandwidth_throttled[direction], 1);
+        return BANDWIDTH_DROP;
+    }
+
+    // concurrent packets may overwrite each other's charge, the bucket then lets a few bytes more through
+    service_v->bandwidth_tat_ns[direction] = tat + (__u64)len * NSEC_PER_SEC / rate;
+    if (tat - now > BANDWIDTH_BURST_NS) {
+        __sync_fetch_and_add(&service_v->bandwidth_throttled[direction], 1);
+        return BANDWIDTH_THROTTLE;
+    }
+    return BANDWIDTH_PASS;
+}
+
+// bandwidth_limit returns the verdict of the kmesh.net/bandwidth of the service the connection of the packet goes to
+static inline int bandwidth_limit(struct __sk_buff *skb, struct bpf_sock *sk, __u32 direction)
+{
+    struct sock_storage_data *storage = NULL;
+    service_key service_k = {0};
+    service_value *service_v = NULL;
+
+    storage = bpf_sk_storage_get(&map_of_sock_storage, sk, 0, 0);
+    if (!storage || !storage->bandwidth_service_id)
+        return BANDWIDTH_PASS;
+
+    service_k.service_id = storage->bandwidth_service_id;
+    service_v = bpf_map_lookup_elem(&map_of_service, &service_k);
+    if (!service_v)
+        return BANDWIDTH_PASS;
+    return bandwidth_charge(service_v, direction, skb->len);
+}
+
+#endif
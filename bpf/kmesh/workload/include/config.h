@@ -13,6 +13,7 @@
 #define MAP_SIZE_OF_DSTINFO       8192
 #define MAP_SIZE_OF_AUTH_TAILCALL 100000
 #define MAP_SIZE_OF_AUTH_POLICY   512
+#define MAP_SIZE_OF_REDIRECT_PORT 1024
 
 // rename map to avoid truncation when name length exceeds BPF_OBJ_NAME_LEN = 16
 #define map_of_frontend      km_frontend
@@ -20,6 +21,7 @@
 #define map_of_endpoint      km_endpoint
 #define map_of_backend       km_backend
 #define map_of_auth_result   km_auth_res
+#define map_of_ct_stats      km_ct_stats
 #define map_of_auth_req      km_auth_req
 #define map_of_tcp_probe     km_tcp_probe
 #define map_of_authz_policy  km_authz_policy
@@ -30,5 +32,6 @@
 #define map_of_wl_policy     km_wlpolicy
 #define kmesh_perf_map       km_perf_map
 #define kmesh_perf_info      km_perf_info
+#define map_of_redirect_port km_redirect_port
 
 #endif // _CONFIG_H_
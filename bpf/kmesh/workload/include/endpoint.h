@@ -12,8 +12,31 @@ static inline endpoint_value *map_lookup_endpoint(const endpoint_key *key)
     return kmesh_map_lookup_elem(&map_of_endpoint, key);
 }
 
+static inline bool backend_connect_failed(backend_value *backend_v)
+{
+    return backend_v->connect_fail_ns != 0 && bpf_ktime_get_ns() - backend_v->connect_fail_ns < CONNECT_FAIL_EJECT_NS;
+}
+
+// a backend is ejected by the outlier detection of the service once it failed connection establishment
+// outlier_consecutive_errors times in a row, until outlier_ejection_ms passed since its last failure
+static inline bool backend_ejected(backend_value *backend_v, service_value *service_v)
+{
+    if (service_v->outlier_consecutive_errors == 0
+        || backend_v->connect_fail_count < service_v->outlier_consecutive_errors)
+        return false;
+    return bpf_ktime_get_ns() - backend_v->connect_fail_ns < (__u64)service_v->outlier_ejection_ms * 1000 * 1000;
+}
+
+// endpoint_manager routes the connection to the backend of the endpoint. If avoid_failed is set and the
+// backend recently failed connection establishment, or avoid_ejected is set and the backend is ejected by
+// the outlier detection of the service, -EAGAIN is returned so that another one can be picked.
 static inline int endpoint_manager(
-    struct kmesh_context *kmesh_ctx, endpoint_value *endpoint_v, __u32 service_id, service_value *service_v)
+    struct kmesh_context *kmesh_ctx,
+    endpoint_value *endpoint_v,
+    __u32 service_id,
+    service_value *service_v,
+    bool avoid_failed,
+    bool avoid_ejected)
 {
     int ret = 0;
     backend_key backend_k = {0};
@@ -26,6 +49,16 @@ static inline int endpoint_manager(
         return -ENOENT;
     }
 
+    if (avoid_failed && backend_connect_failed(backend_v)) {
+        BPF_LOG(DEBUG, ENDPOINT, "svc %u skip backend %u which recently failed to connect", service_id, backend_k.backend_uid);
+        return -EAGAIN;
+    }
+
+    if (avoid_ejected && backend_ejected(backend_v, service_v)) {
+        BPF_LOG(DEBUG, ENDPOINT, "svc %u skip backend %u ejected by outlier detection", service_id, backend_k.backend_uid);
+        return -EAGAIN;
+    }
+
     ret = backend_manager(kmesh_ctx, backend_v, service_id, service_v);
     if (ret != 0) {
         if (ret != -ENOENT)
@@ -39,6 +72,12 @@ static inline int endpoint_manager(
         return ret;
     }
 
+    // sockops records the connect result of the backend for the failed backend repicks and the outlier detection,
+    // and counts the active connections of the backend for the least connection load balancing
+    if ((service_v->failed_backend_repicks || service_v->outlier_consecutive_errors
+         || service_v->lb_algorithm == LB_ALGORITHM_LEAST_CONN)
+        && !kmesh_ctx->via_waypoint)
+        kmesh_ctx->backend_uid = backend_k.backend_uid;
     return 0;
 }
 
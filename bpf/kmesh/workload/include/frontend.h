@@ -52,7 +52,7 @@ static inline int frontend_manager(struct kmesh_context *kmesh_ctx, frontend_val
     } else {
         ret = service_manager(kmesh_ctx, frontend_v->upstream_id, service_v);
         if (ret != 0) {
-            if (ret != -ENOENT)
+            if (ret != -ENOENT && ret != -EHOSTUNREACH)
                 BPF_LOG(ERR, FRONTEND, "service_manager failed, ret:%d\n", ret);
             return ret;
         }
@@ -0,0 +1,37 @@
+/* SPDX-License-Identifier: (GPL-2.0-only OR BSD-2-Clause) */
+/* Copyright Authors of Kmesh */
+
+#ifndef __KMESH_REDIRECT_PORT_H__
+#define __KMESH_REDIRECT_PORT_H__
+
+#include "bpf_common.h"
+#include "config.h"
+
+/*
+ * Set by the daemon before loading when --redirect-ports is given, only the connections to the destination
+ * ports in map_of_redirect_port are then managed by kmesh. Being read-only, the verifier prunes the lookup
+ * when all the ports are redirected.
+ */
+const volatile __u32 redirect_port_filter = 0;
+
+// the destination ports redirected, in host byte order, filled in by the daemon
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, __u32);
+    __type(value, __u32);
+    __uint(max_entries, MAP_SIZE_OF_REDIRECT_PORT);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+} map_of_redirect_port SEC(".maps");
+
+// whether the connections to the destination port, in network byte order as in bpf_sock_addr, are managed by kmesh
+static inline bool is_redirect_port(__u32 user_port)
+{
+    __u32 port;
+
+    if (!redirect_port_filter)
+        return true;
+    port = bpf_ntohs((__u16)user_port);
+    return bpf_map_lookup_elem(&map_of_redirect_port, &port) != NULL;
+}
+
+#endif
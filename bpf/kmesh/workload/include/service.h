@@ -12,30 +12,154 @@ static inline service_value *map_lookup_service(const service_key *key)
     return kmesh_map_lookup_elem(&map_of_service, key);
 }
 
-static inline int lb_random_handle(struct kmesh_context *kmesh_ctx, __u32 service_id, service_value *service_v)
+// jump consistent hash of key over count buckets, growing the buckets only moves the keys to the new ones
+static inline __u32 jump_consistent_hash(__u64 key, __u32 count)
 {
-    int ret = 0;
+    int i;
+    __u64 b = 0, j = 0;
+
+    for (i = 0; i < MAX_HASH_JUMPS; i++) {
+        b = j;
+        key = key * 2862933555777941757ULL + 1;
+        j = ((b + 1) << 31) / ((key >> 33) + 1);
+        if (j >= count)
+            break;
+    }
+    return b;
+}
+
+// pick the index of an endpoint among the count ones of the prio by the algorithm of the service,
+// the attempts after the first one are random
+static inline __u32 lb_pick_index(struct kmesh_context *kmesh_ctx, service_value *service_v, __u32 count, int attempt)
+{
+    __u32 index;
+
+    if (attempt > 0)
+        return bpf_get_prandom_u32() % count + 1;
+
+    switch (service_v->lb_algorithm) {
+    case LB_ALGORITHM_ROUND_ROBIN:
+        // concurrent connects may pick the same endpoint, which only skews a round
+        index = service_v->round_robin_index;
+        __sync_fetch_and_add(&service_v->round_robin_index, 1);
+        return index % count + 1;
+    case LB_ALGORITHM_RING_HASH:
+        // the connections of a client pod stick to the same endpoint
+        return jump_consistent_hash(bpf_get_netns_cookie(kmesh_ctx->ctx), count) + 1;
+    default:
+        return bpf_get_prandom_u32() % count + 1;
+    }
+}
+
+static inline __u32 endpoint_active_connections(endpoint_value *endpoint_v)
+{
+    backend_key backend_k = {0};
+    backend_value *backend_v = NULL;
+
+    backend_k.backend_uid = endpoint_v->backend_uid;
+    backend_v = map_lookup_backend(&backend_k);
+    return backend_v ? backend_v->active_connections : 0;
+}
+
+// pick the endpoint with the fewer active connections among the picked one and another random one,
+// the power of two choices avoids the herding of all the clients onto the least loaded endpoint
+static inline endpoint_value *lb_least_conn_endpoint(endpoint_key *endpoint_k, endpoint_value *endpoint_v, __u32 count)
+{
+    endpoint_key other_k = *endpoint_k;
+    endpoint_value *other_v = NULL;
+
+    if (count < 2)
+        return endpoint_v;
+    // any endpoint but the picked one
+    other_k.backend_index = (endpoint_k->backend_index + bpf_get_prandom_u32() % (count - 1)) % count + 1;
+    other_v = map_lookup_endpoint(&other_k);
+    if (other_v && endpoint_active_connections(other_v) < endpoint_active_connections(endpoint_v)) {
+        endpoint_k->backend_index = other_k.backend_index;
+        return other_v;
+    }
+    return endpoint_v;
+}
+
+// pick an endpoint among the count ones of the prio by the algorithm of the service, in proportion
+// to their weight: an endpoint is accepted with the probability of its weight over the max weight
+// of the service. The weights do not apply to the ring hash, which must pick the same endpoint.
+static inline endpoint_value *lb_pick_endpoint(
+    struct kmesh_context *kmesh_ctx, endpoint_key *endpoint_k, service_value *service_v, __u32 count, int attempt)
+{
+    int i;
+    endpoint_value *endpoint_v = NULL;
+    __u32 weight;
+
+    for (i = 0; i < MAX_WEIGHTED_PICKS; i++) {
+        endpoint_k->backend_index = lb_pick_index(kmesh_ctx, service_v, count, attempt);
+        endpoint_v = map_lookup_endpoint(endpoint_k);
+        if (endpoint_v && service_v->lb_algorithm == LB_ALGORITHM_LEAST_CONN)
+            endpoint_v = lb_least_conn_endpoint(endpoint_k, endpoint_v, count);
+        if (!endpoint_v || service_v->max_endpoint_weight <= 1
+            || (service_v->lb_algorithm == LB_ALGORITHM_RING_HASH && attempt == 0))
+            return endpoint_v;
+
+        weight = endpoint_v->weight ? endpoint_v->weight : 1;
+        if (bpf_get_prandom_u32() % service_v->max_endpoint_weight < weight)
+            return endpoint_v;
+    }
+    // too many endpoints were rejected, keep the last one picked
+    return endpoint_v;
+}
+
+// pick an endpoint of the prio, picking again at random up to failed_backend_repicks times if the chosen backend
+// recently failed connection establishment, and up to MAX_BACKEND_REPICKS times if it is ejected
+static inline int
+lb_select_endpoint(struct kmesh_context *kmesh_ctx, __u32 service_id, service_value *service_v, __u32 prio)
+{
+    __u32 i;
+    int ret = -ENOENT;
     endpoint_key endpoint_k = {0};
     endpoint_value *endpoint_v = NULL;
-    int rand_k = 0;
+    __u32 count;
 
-    if (service_v->prio_endpoint_count[0] == 0)
-        return 0;
+    if (prio >= PRIO_COUNT)
+        return -ENOENT;
+    count = service_v->prio_endpoint_count[prio];
+    if (count == 0)
+        return -ENOENT;
 
     endpoint_k.service_id = service_id;
-    endpoint_k.prio = 0; // for random handle，all endpoints are saved with highest priority
+    endpoint_k.prio = prio;
 
-    rand_k = bpf_get_prandom_u32() % service_v->prio_endpoint_count[0] + 1;
-    endpoint_k.backend_index = rand_k;
-    endpoint_v = map_lookup_endpoint(&endpoint_k);
-    if (!endpoint_v) {
-        BPF_LOG(WARN, SERVICE, "lb_random_handle select endpoint [%u/%u] failed", service_id, endpoint_k.backend_index);
-        return -ENOENT;
+#pragma unroll
+    for (i = 0; i <= MAX_BACKEND_REPICKS; i++) {
+        endpoint_v = lb_pick_endpoint(kmesh_ctx, &endpoint_k, service_v, count, i);
+        if (!endpoint_v) {
+            BPF_LOG(WARN, SERVICE, "select endpoint [%u/%u/%u] failed", service_id, prio, endpoint_k.backend_index);
+            return -ENOENT;
+        }
+
+        BPF_LOG(DEBUG, SERVICE, "select endpoint [%u/%u/%u]", service_id, prio, endpoint_k.backend_index);
+        // the last attempt takes the backend whatever its state
+        ret = endpoint_manager(
+            kmesh_ctx,
+            endpoint_v,
+            service_id,
+            service_v,
+            i < service_v->failed_backend_repicks,
+            i < MAX_BACKEND_REPICKS);
+        if (ret != -EAGAIN)
+            break;
     }
 
-    BPF_LOG(DEBUG, SERVICE, "lb_random_handle select endpoint [%u/%u]", service_id, endpoint_k.backend_index);
+    return ret;
+}
 
-    ret = endpoint_manager(kmesh_ctx, endpoint_v, service_id, service_v);
+static inline int lb_random_handle(struct kmesh_context *kmesh_ctx, __u32 service_id, service_value *service_v)
+{
+    int ret = 0;
+
+    if (service_v->prio_endpoint_count[0] == 0)
+        return 0;
+
+    // for random handle，all endpoints are saved with highest priority
+    ret = lb_select_endpoint(kmesh_ctx, service_id, service_v, 0);
     if (ret != 0) {
         if (ret != -ENOENT)
             BPF_LOG(ERR, SERVICE, "endpoint_manager failed, ret:%d\n", ret);
@@ -45,22 +169,14 @@ static inline int lb_random_handle(struct kmesh_context *kmesh_ctx, __u32 servic
     return 0;
 }
 
-// TODO: reuse with lb_random_handle
 static inline int lb_locality_strict_handle(struct kmesh_context *kmesh_ctx, __u32 service_id, service_value *service_v)
 {
     int ret = -ENOENT;
-    endpoint_key endpoint_k = {0};
-    endpoint_value *endpoint_v = NULL;
-    endpoint_k.service_id = service_id;
 
-    if (service_v->prio_endpoint_count[0]) {
-        endpoint_k.backend_index = bpf_get_prandom_u32() % service_v->prio_endpoint_count[0] + 1;
-        endpoint_v = map_lookup_endpoint(&endpoint_k);
-        if (endpoint_v) {
-            BPF_LOG(DEBUG, SERVICE, "locality lb strict select endpoint [%u/%u]", service_id, endpoint_k.backend_index);
-            ret = endpoint_manager(kmesh_ctx, endpoint_v, service_id, service_v);
-        }
-    }
+    if (service_v->prio_endpoint_count[0])
+        ret = lb_select_endpoint(kmesh_ctx, service_id, service_v, 0);
+    if (ret == 0)
+        kmesh_ctx->locality_tier = 1;
 
     if (ret) {
         kmesh_ctx->dnat_ip = (struct ip_addr){0};
@@ -71,30 +187,38 @@ static inline int lb_locality_strict_handle(struct kmesh_context *kmesh_ctx, __u
     return ret;
 }
 
+// select the first prio to try according to the configured prio load,
+// spilling part of the traffic to lower prios when the higher ones are not healthy enough
+static inline int lb_locality_failover_start_prio(service_value *service_v)
+{
+    int i;
+    __u32 acc = 0;
+    __u32 rand_k = bpf_get_prandom_u32() % 100;
+
+    // #pragma unroll
+    for (i = 0; i < PRIO_COUNT; i++) {
+        acc += service_v->prio_load[i];
+        if (rand_k < acc && service_v->prio_endpoint_count[i])
+            return i;
+    }
+    return 0;
+}
+
 static inline int
 lb_locality_failover_handle(struct kmesh_context *kmesh_ctx, __u32 service_id, service_value *service_v)
 {
-    int i, ret = -ENOENT;
-    endpoint_key endpoint_k = {0};
-    endpoint_value *endpoint_v = NULL;
-    endpoint_k.service_id = service_id;
+    int i, start, ret = -ENOENT;
+    start = lb_locality_failover_start_prio(service_v);
 
     // #pragma unroll
     for (i = 0; i < PRIO_COUNT; i++) {
-        if (service_v->prio_endpoint_count[i] == 0)
+        if (i < start || service_v->prio_endpoint_count[i] == 0)
             continue;
 
-        endpoint_k.prio = i;
-        endpoint_k.backend_index = bpf_get_prandom_u32() % service_v->prio_endpoint_count[i] + 1;
-        endpoint_v = map_lookup_endpoint(&endpoint_k);
-        if (!endpoint_v) {
-            ret = -ENOENT;
-            break;
-        }
-
-        BPF_LOG(
-            DEBUG, SERVICE, "locality lb failover select endpoint [%u/%u/%u]", service_id, i, endpoint_k.backend_index);
-        ret = endpoint_manager(kmesh_ctx, endpoint_v, service_id, service_v);
+        ret = lb_select_endpoint(kmesh_ctx, service_id, service_v, i);
+        // tag the connection with the tier it failed over to, reported in the accesslog
+        if (ret == 0)
+            kmesh_ctx->locality_tier = i + 1;
         break;
     }
 
@@ -107,6 +231,16 @@ static inline int service_manager(struct kmesh_context *kmesh_ctx, __u32 service
 {
     int ret = 0;
 
+    // also applies to the connections to the waypoint
+    kmesh_ctx->idle_timeout_ms = service_v->idle_timeout_ms;
+    kmesh_ctx->dscp = service_v->dscp;
+    if (service_v->bandwidth[BANDWIDTH_EGRESS] || service_v->bandwidth[BANDWIDTH_INGRESS])
+        kmesh_ctx->bandwidth_service_id = service_id;
+    if (service_v->unavailable) {
+        BPF_LOG(WARN, SERVICE, "service [%u] has too few healthy endpoints, refuse the connection\n", service_id);
+        return -EHOSTUNREACH;
+    }
+
     if (service_v->wp_addr.ip4 != 0 && service_v->waypoint_port != 0) {
         BPF_LOG(
             DEBUG,
@@ -122,6 +256,7 @@ static inline int service_manager(struct kmesh_context *kmesh_ctx, __u32 service
     }
 
     BPF_LOG(DEBUG, SERVICE, "service [%u] lb policy [%u]", service_id, service_v->lb_policy);
+    kmesh_ctx->connect_timeout_ms = service_v->connect_timeout_ms;
 
     switch (service_v->lb_policy) {
     case LB_POLICY_RANDOM:
@@ -12,6 +12,21 @@
 #define RINGBUF_SIZE              (1 << 12)
 #define PRIO_COUNT                7
 #define MAX_MEMBER_NUM_PER_POLICY 4
+#define MAX_BACKEND_REPICKS       3
+#define MAX_WEIGHTED_PICKS        16
+#define MAX_HASH_JUMPS            64
+// algorithm picking the endpoint among the ones of a prio, like the loadBalancer of a DestinationRule
+#define LB_ALGORITHM_RANDOM      0
+#define LB_ALGORITHM_ROUND_ROBIN 1
+#define LB_ALGORITHM_LEAST_CONN  2
+#define LB_ALGORITHM_RING_HASH   3
+// directions of the bandwidth of a service, as seen by its clients
+#define BANDWIDTH_EGRESS     0
+#define BANDWIDTH_INGRESS    1
+#define BANDWIDTH_DIRECTIONS 2
+// a backend which failed connection establishment within this window is avoided by services with failed backend repicks.
+// The failed connection itself is not retried, sockops only learns the failure once the connect returned it.
+#define CONNECT_FAIL_EJECT_NS (5ULL * 1000 * 1000 * 1000)
 
 #pragma pack(1)
 // frontend map
@@ -37,6 +52,31 @@ typedef struct {
     __u32 target_port[MAX_PORT_COUNT];
     struct ip_addr wp_addr;
     __u32 waypoint_port;
+    __u32 prio_load[PRIO_COUNT]; // percent of traffic for each prio in failover mode, all zero means plain failover
+    // number of other backends to pick when the selected one recently failed to connect
+    __u32 failed_backend_repicks;
+    __u32 connect_timeout_ms;  // timeout of a single connection attempt, 0 means the kernel default
+    __u32 idle_timeout_ms;     // connections idle for longer are closed by the daemon, 0 means never
+    __u32 max_endpoint_weight; // largest weight of the endpoints, they are picked evenly if it is 0 or 1
+    // connect failures in a row which eject a backend, 0 disables outlier detection
+    __u32 outlier_consecutive_errors;
+    // time an ejected backend stays out of the load balancing since its last failure
+    __u32 outlier_ejection_ms;
+    // DSCP the packets of the connections to the service are marked with, 0 leaves them unmarked
+    __u32 dscp;
+    __u32 lb_algorithm;
+    // next endpoint picked by the round robin, written by the connect programs
+    __u32 round_robin_index;
+    // bytes per second the clients on the node may send to the service and receive from it, by direction,
+    // 0 is unlimited
+    __u32 bandwidth[BANDWIDTH_DIRECTIONS];
+    // packets throttled or dropped by the bandwidth, written by the cgroup_skb programs
+    __u32 bandwidth_throttled[BANDWIDTH_DIRECTIONS];
+    // set by the daemon while the service has fewer healthy endpoints than its kmesh.net/min-healthy-endpoints,
+    // the new connections to it are refused
+    __u32 unavailable;
+    // time the bytes sent or received so far are drained at, written by the cgroup_skb programs
+    __u64 bandwidth_tat_ns[BANDWIDTH_DIRECTIONS];
 } service_value;
 
 // endpoint map
@@ -48,6 +88,7 @@ typedef struct {
 
 typedef struct {
     __u32 backend_uid; // workload_uid to uint32
+    __u32 weight;      // relative weight of the endpoint among the ones of its prio, 0 means 1
 } endpoint_value;
 
 // backend map
@@ -60,6 +101,9 @@ typedef struct {
     __u32 service[MAX_SERVICE_COUNT];
     struct ip_addr wp_addr;
     __u32 waypoint_port;
+    __u64 connect_fail_ns;    // last time a connection to the backend failed to establish, written by sockops
+    __u32 connect_fail_count; // connections to the backend which failed to establish in a row, written by sockops
+    __u32 active_connections; // connections to the backend established and not closed yet, written by sockops
 } backend_value;
 #pragma pack()
 
@@ -95,21 +139,47 @@ struct {
     __uint(map_flags, BPF_F_NO_PREALLOC);
 } map_of_backend SEC(".maps");
 
+// the conntrack of the authz verdicts. When it is full, the least recently used flows are evicted
+// instead of failing the update, the daemon sizes it with --max-conntrack-entries
 struct {
-    __uint(type, BPF_MAP_TYPE_HASH);
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
     __type(key, struct bpf_sock_tuple);
     __type(value, __u32);
     __uint(max_entries, MAP_SIZE_OF_AUTH);
-    __uint(map_flags, BPF_F_NO_PREALLOC);
 } map_of_auth_result SEC(".maps");
 
+// counters of map_of_auth_result, for the daemon to tell the flows evicted from the ones deleted
+#define CONNTRACK_STAT_INSERTED 0
+#define CONNTRACK_STAT_DELETED  1
+#define CONNTRACK_STAT_MAX      2
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, __u32);
+    __type(value, __u64);
+    __uint(max_entries, CONNTRACK_STAT_MAX);
+} map_of_ct_stats SEC(".maps");
+
+static inline void conntrack_stat_inc(__u32 stat)
+{
+    __u64 *count = bpf_map_lookup_elem(&map_of_ct_stats, &stat);
+    if (count)
+        (*count)++;
+}
+
 struct {
     __uint(type, BPF_MAP_TYPE_RINGBUF);
     __uint(max_entries, RINGBUF_SIZE);
 } map_of_auth_req SEC(".maps");
 
+// authz_offload of a workload, whether its policies are enforced in xdp or in the daemon
+#define AUTHZ_OFFLOAD_NODE     0 // as set for the node
+#define AUTHZ_OFFLOAD_ENABLED  1
+#define AUTHZ_OFFLOAD_DISABLED 2
+
 typedef struct {
     __u32 policyIds[MAX_MEMBER_NUM_PER_POLICY];
+    __u32 authz_offload;
 } wl_policies_v;
 
 struct {
@@ -2,6 +2,9 @@
 /* Copyright Authors of Kmesh */
 
 #include <linux/bpf.h>
+#include <linux/in.h>
+#include <linux/in6.h>
+#include <linux/tcp.h>
 #include <sys/socket.h>
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_endian.h>
@@ -14,9 +17,14 @@
 
 #define FORMAT_IP_LENGTH (16)
 
+// type of the message telling the daemon that a connection it authorized closed, after IPV4 and IPV6
+#define AUTH_MSG_CONN_CLOSED 2
+
 struct ringbuf_msg_type {
     __u32 type;
     struct bpf_sock_tuple tuple;
+    // id of the connection, the verdict is logged with it
+    __u64 conn_id;
 };
 
 struct {
@@ -113,18 +121,18 @@ static inline void clean_auth_map(struct bpf_sock_ops *skops)
     // In this way, auth can be performed normally.
     extract_skops_to_tuple_reverse(skops, &tuple_key);
     int ret = bpf_map_delete_elem(&map_of_auth_result, &tuple_key);
-    if (ret && ret != -ENOENT)
+    if (!ret)
+        conntrack_stat_inc(CONNTRACK_STAT_DELETED);
+    else if (ret != -ENOENT)
         BPF_LOG(ERR, SOCKOPS, "map_of_auth_result bpf_map_delete_elem failed, ret: %d", ret);
 }
 
 // insert an IP tuple into the ringbuf
 static inline void auth_ip_tuple(struct bpf_sock_ops *skops)
 {
-    struct ringbuf_msg_type *msg = bpf_ringbuf_reserve(&map_of_auth_req, sizeof(*msg), 0);
-    if (!msg) {
-        BPF_LOG(WARN, SOCKOPS, "can not alloc new mem in map_of_auth_req");
-        return;
-    }
+    struct ringbuf_msg_type msg_buf = {0};
+    struct ringbuf_msg_type *msg = &msg_buf;
+    struct sock_storage_data *storage = NULL;
     // auth run PASSIVE ESTABLISHED CB now. In this state cb
     // tuple info src is server info, dst is client info
     // During the auth, src must set the client info and dst set
@@ -135,7 +143,34 @@ static inline void auth_ip_tuple(struct bpf_sock_ops *skops)
     if (is_ipv4_mapped_addr(skops->local_ip6)) {
         (*msg).type = IPV4;
     }
-    bpf_ringbuf_submit(msg, 0);
+    // the connection has no id yet if it is not observed
+    if (skops->sk) {
+        storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, BPF_LOCAL_STORAGE_GET_F_CREATE);
+        if (storage) {
+            assign_conn_id(storage);
+            storage->auth_requested = true;
+            (*msg).conn_id = storage->conn_id;
+        }
+    }
+    if (kmesh_event_output(skops, &map_of_auth_req, msg, sizeof(*msg)))
+        BPF_LOG(WARN, SOCKOPS, "can not alloc new mem in map_of_auth_req");
+}
+
+// tell the daemon that a connection it authorized closed, to free its slot in the connection limit of its service
+static inline void auth_conn_closed(struct bpf_sock_ops *skops)
+{
+    struct ringbuf_msg_type msg = {0};
+    struct sock_storage_data *storage = NULL;
+
+    if (!skops->sk)
+        return;
+    storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, 0);
+    if (!storage || !storage->auth_requested)
+        return;
+    msg.type = AUTH_MSG_CONN_CLOSED;
+    msg.conn_id = storage->conn_id;
+    if (kmesh_event_output(skops, &map_of_auth_req, &msg, sizeof(msg)))
+        BPF_LOG(WARN, SOCKOPS, "can not alloc new mem in map_of_auth_req");
 }
 
 // update sockmap to trigger sk_msg prog to encode metadata before sending to waypoint
@@ -149,6 +184,109 @@ static inline void enable_encoding_metadata(struct bpf_sock_ops *skops)
         BPF_LOG(ERR, SOCKOPS, "enable encoding metadata failed!, err is %d", err);
 }
 
+// bound the connection attempt and watch for its failure if the service avoids the backends failing to connect
+static inline void prepare_connect_watch(struct bpf_sock_ops *skops)
+{
+    struct sock_storage_data *storage = NULL;
+    int timeout;
+
+    if (!skops->sk)
+        return;
+    storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, 0);
+    if (!storage)
+        return;
+
+    if (storage->connect_timeout_ms) {
+        // TCP_USER_TIMEOUT also bounds the SYN retransmissions
+        timeout = storage->connect_timeout_ms;
+        if (bpf_setsockopt(skops, IPPROTO_TCP, TCP_USER_TIMEOUT, &timeout, sizeof(timeout)))
+            BPF_LOG(ERR, SOCKOPS, "set connect timeout %d failed\n", timeout);
+    }
+    if (storage->backend_uid && bpf_sock_ops_cb_flags_set(skops, BPF_SOCK_OPS_STATE_CB_FLAG) != 0)
+        BPF_LOG(ERR, SOCKOPS, "set sockops cb failed!\n");
+}
+
+// mark the packets of the connection with the DSCP of its service, the SYN included
+static inline void mark_dscp(struct bpf_sock_ops *skops)
+{
+    struct sock_storage_data *storage = NULL;
+    int tos;
+
+    if (!skops->sk)
+        return;
+    storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, 0);
+    if (!storage || !storage->dscp)
+        return;
+
+    // the DSCP is the upper 6 bits of the TOS and traffic class, the ECN bits are left to the kernel
+    tos = storage->dscp << 2;
+    if (skops->family == AF_INET) {
+        if (bpf_setsockopt(skops, IPPROTO_IP, IP_TOS, &tos, sizeof(tos)))
+            BPF_LOG(ERR, SOCKOPS, "set dscp %u failed\n", storage->dscp);
+    } else if (bpf_setsockopt(skops, IPPROTO_IPV6, IPV6_TCLASS, &tos, sizeof(tos))) {
+        BPF_LOG(ERR, SOCKOPS, "set dscp %u failed\n", storage->dscp);
+    }
+}
+
+// update the connect state of the backend, new connections avoid it for a while after a failure
+static inline void record_connect_result(struct bpf_sock_ops *skops, bool success)
+{
+    struct sock_storage_data *storage = NULL;
+    backend_key backend_k = {0};
+    backend_value *backend_v = NULL;
+    int timeout = 0;
+
+    if (!skops->sk)
+        return;
+    storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, 0);
+    if (!storage)
+        return;
+
+    // the connect timeout must not apply to the established connection
+    if (success && storage->connect_timeout_ms)
+        bpf_setsockopt(skops, IPPROTO_TCP, TCP_USER_TIMEOUT, &timeout, sizeof(timeout));
+
+    if (!storage->backend_uid)
+        return;
+    backend_k.backend_uid = storage->backend_uid;
+    backend_v = kmesh_map_lookup_elem(&map_of_backend, &backend_k);
+    if (!backend_v)
+        return;
+
+    if (!success) {
+        BPF_LOG(DEBUG, SOCKOPS, "backend %u failed to connect", backend_k.backend_uid);
+        backend_v->connect_fail_ns = bpf_ktime_get_ns();
+        __sync_fetch_and_add(&backend_v->connect_fail_count, 1);
+    } else {
+        // the least connection load balancing picks the backend by its active connections
+        __sync_fetch_and_add(&backend_v->active_connections, 1);
+        if (backend_v->connect_fail_ns) {
+            backend_v->connect_fail_ns = 0;
+            backend_v->connect_fail_count = 0;
+        }
+    }
+}
+
+// release the active connection counted on the backend when the established connection closes
+static inline void record_connection_close(struct bpf_sock_ops *skops)
+{
+    struct sock_storage_data *storage = NULL;
+    backend_key backend_k = {0};
+    backend_value *backend_v = NULL;
+
+    if (!skops->sk)
+        return;
+    storage = bpf_sk_storage_get(&map_of_sock_storage, skops->sk, 0, 0);
+    if (!storage || !storage->backend_uid)
+        return;
+    backend_k.backend_uid = storage->backend_uid;
+    backend_v = kmesh_map_lookup_elem(&map_of_backend, &backend_k);
+    // the backend value may have been rewritten by the daemon since the connection was counted
+    if (!backend_v || backend_v->active_connections == 0)
+        return;
+    __sync_fetch_and_add(&backend_v->active_connections, -1);
+}
+
 SEC("sockops")
 int sockops_prog(struct bpf_sock_ops *skops)
 {
@@ -158,11 +296,16 @@ int sockops_prog(struct bpf_sock_ops *skops)
     switch (skops->op) {
     case BPF_SOCK_OPS_TCP_CONNECT_CB:
         skops_handle_kmesh_managed_process(skops);
+        if (is_managed_by_kmesh(skops)) {
+            prepare_connect_watch(skops);
+            mark_dscp(skops);
+        }
         break;
     case BPF_SOCK_OPS_ACTIVE_ESTABLISHED_CB:
         if (!is_managed_by_kmesh(skops))
             break;
-        observe_on_connect_established(skops->sk, OUTBOUND);
+        observe_on_connect_established(skops, skops->sk, OUTBOUND);
+        record_connect_result(skops, true);
         if (bpf_sock_ops_cb_flags_set(skops, BPF_SOCK_OPS_STATE_CB_FLAG) != 0)
             BPF_LOG(ERR, SOCKOPS, "set sockops cb failed!\n");
         struct bpf_sock *sk = (struct bpf_sock *)skops->sk;
@@ -182,15 +325,22 @@ int sockops_prog(struct bpf_sock_ops *skops)
     case BPF_SOCK_OPS_PASSIVE_ESTABLISHED_CB:
         if (!is_managed_by_kmesh(skops) || skip_specific_probe(skops))
             break;
-        observe_on_connect_established(skops->sk, INBOUND);
+        observe_on_connect_established(skops, skops->sk, INBOUND);
         if (bpf_sock_ops_cb_flags_set(skops, BPF_SOCK_OPS_STATE_CB_FLAG) != 0)
             BPF_LOG(ERR, SOCKOPS, "set sockops cb failed!\n");
         auth_ip_tuple(skops);
         break;
     case BPF_SOCK_OPS_STATE_CB:
         if (skops->args[1] == BPF_TCP_CLOSE) {
-            observe_on_close(skops->sk);
+            // the state cb is only enabled before establishment for connections to services avoiding failed backends
+            if (skops->args[0] == BPF_TCP_SYN_SENT) {
+                record_connect_result(skops, false);
+                break;
+            }
+            record_connection_close(skops);
+            observe_on_close(skops, skops->sk);
             clean_auth_map(skops);
+            auth_conn_closed(skops);
         }
         break;
     default:
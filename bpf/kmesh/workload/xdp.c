@@ -42,16 +42,27 @@ static inline int should_shutdown(struct xdp_info *info, struct bpf_sock_tuple *
                 "auth denied, src ip: %s, port: %u\n",
                 ip2str(&tuple_info->ipv6.saddr[0], false),
                 bpf_ntohs(tuple_info->ipv6.sport));
-        bpf_map_delete_elem(&map_of_auth_result, tuple_info);
+        if (!bpf_map_delete_elem(&map_of_auth_result, tuple_info))
+            conntrack_stat_inc(CONNTRACK_STAT_DELETED);
         return AUTH_FORBID;
     }
     return AUTH_PASS;
 }
 
+// the packets of a connection queued by the daemon are held until it is admitted
+static inline bool is_queued(struct bpf_sock_tuple *tuple_info)
+{
+    __u32 *value = bpf_map_lookup_elem(&map_of_auth_result, tuple_info);
+    return value && *value == AUTH_QUEUED;
+}
+
 volatile __u32 authz_offload = 1;
 
-static bool is_authz_offload_enabled()
+// the kmesh.net/authz label of a workload overrides the authz offload of the node
+static bool is_authz_offload_enabled(wl_policies_v *policies)
 {
+    if (policies && policies->authz_offload != AUTHZ_OFFLOAD_NODE)
+        return policies->authz_offload == AUTHZ_OFFLOAD_ENABLED;
     return authz_offload == 1;
 }
 
@@ -80,11 +91,6 @@ static inline wl_policies_v *get_workload_policies(struct xdp_info *info, struct
 SEC("xdp_auth")
 int xdp_authz(struct xdp_md *ctx)
 {
-    if (!is_authz_offload_enabled()) {
-        bpf_tail_call(ctx, &map_of_xdp_tailcall, TAIL_CALL_AUTH_IN_USER_SPACE);
-        return XDP_PASS;
-    }
-
     struct match_context match_ctx = {0};
     struct bpf_sock_tuple tuple_key = {0};
     struct xdp_info info = {0};
@@ -98,9 +104,14 @@ int xdp_authz(struct xdp_md *ctx)
 
     // never failed
     parser_tuple(&info, &tuple_key);
+    policies = get_workload_policies(&info, &tuple_key);
+    if (!is_authz_offload_enabled(policies)) {
+        bpf_tail_call(ctx, &map_of_xdp_tailcall, TAIL_CALL_AUTH_IN_USER_SPACE);
+        return XDP_PASS;
+    }
+
     int *value = bpf_map_lookup_elem(&map_of_auth_result, &tuple_key);
     if (!value) {
-        policies = get_workload_policies(&info, &tuple_key);
         if (!policies) {
             return XDP_PASS;
         }
@@ -117,6 +128,7 @@ int xdp_authz(struct xdp_md *ctx)
         bpf_tail_call(ctx, &map_of_xdp_tailcall, TAIL_CALL_POLICIES_CHECK);
         return XDP_PASS;
     } else {
+        // the packets of the denied and of the queued connections are dropped alike
         return *value ? XDP_DROP : XDP_PASS;
     }
 }
@@ -135,6 +147,8 @@ int xdp_shutdown_in_userspace(struct xdp_md *ctx)
     // never failed
     parser_tuple(&info, &tuple_info);
 
+    if (is_queued(&tuple_info))
+        return XDP_DROP;
     if (should_shutdown(&info, &tuple_info) == AUTH_FORBID)
         shutdown_tuple(&info);
 
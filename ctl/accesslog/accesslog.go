@@ -0,0 +1,329 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const (
+	requestTimeout = 10 * time.Second
+
+	// waypointAccessLog is the marker of the records of the waypoint-access-log EnvoyFilter
+	waypointAccessLog = "waypoint"
+	// kmeshAccessLog is the marker of the records of the accesslog of a kmesh daemon
+	kmeshAccessLog = "kmesh"
+
+	// KmeshAccesslogPrefix prefixes the accesslog entries in the log of a kmesh daemon
+	KmeshAccesslogPrefix = "accesslog: "
+	// KmeshVerdictPrefix prefixes the authz verdicts in the log of a kmesh daemon
+	KmeshVerdictPrefix = "authz: "
+	// prefix of the details envoy reports when the rbac filters deny a connection or a request
+	rbacDenied = "rbac_access_denied"
+
+	VerdictAllow = "ALLOW"
+	VerdictDeny  = "DENY"
+)
+
+var log = logger.NewLoggerScope("kmeshctl/accesslog")
+
+var (
+	namespace string
+	identity  string
+	connId    string
+	tail      int64
+	output    string
+)
+
+// Record is an access log record of a waypoint, the fields are the ones of the json_format
+// of the waypoint-access-log EnvoyFilter installed with Kmesh. The accesslog entries of a kmesh
+// daemon are read into the same fields.
+type Record struct {
+	AccessLog          string `json:"kmesh_access_log"`
+	StartTime          string `json:"start_time"`
+	Protocol           string `json:"protocol"`
+	SourceAddress      string `json:"source_address"`
+	DestinationAddress string `json:"destination_address"`
+	UpstreamHost       string `json:"upstream_host"`
+	// PeerIdentity is the SPIFFE identity the peer authenticated with over HBONE mTLS,
+	// empty if the connection is not mutually authenticated
+	PeerIdentity                 string `json:"peer_identity"`
+	Method                       string `json:"method"`
+	Path                         string `json:"path"`
+	ResponseCode                 int    `json:"response_code"`
+	ResponseFlags                string `json:"response_flags"`
+	ResponseCodeDetails          string `json:"response_code_details"`
+	ConnectionTerminationDetails string `json:"connection_termination_details"`
+	BytesReceived                uint64 `json:"bytes_received"`
+	BytesSent                    uint64 `json:"bytes_sent"`
+	// Duration is in milliseconds
+	Duration uint64 `json:"duration"`
+	// ConnectionId is the id a kmesh daemon logs the connection with, in its accesslog entries and its
+	// authz verdict. It is empty for the records of a waypoint.
+	ConnectionId string `json:"conn_id,omitempty"`
+	// State is the tcp state of the connection when a kmesh daemon logged it, empty for the records of a waypoint
+	State string `json:"state,omitempty"`
+}
+
+// Layer is L7 for the http requests, L4 for the tcp connections
+func (r *Record) Layer() string {
+	if r.Protocol != "" {
+		return "L7"
+	}
+	return "L4"
+}
+
+// Verdict is DENY if the authorization policies denied the connection or the request. The verdicts of
+// the connections to the workloads are not in the accesslog of kmesh, they are joined by kmeshctl authz log.
+func (r *Record) Verdict() string {
+	if r.AccessLog == kmeshAccessLog {
+		return "-"
+	}
+	if strings.HasPrefix(r.ResponseCodeDetails, rbacDenied) || strings.HasPrefix(r.ConnectionTerminationDetails, rbacDenied) {
+		return VerdictDeny
+	}
+	return VerdictAllow
+}
+
+// entry is a record along with its verdict, for the json output
+type entry struct {
+	*Record
+	Layer   string `json:"layer"`
+	Verdict string `json:"verdict"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "accesslog <pod>",
+		Short: "Show the access log of a waypoint with the identity of the peers",
+		Long: `Show the connections and requests handled by a waypoint along with the SPIFFE identity their peer
+authenticated with over HBONE mTLS and the L4/L7 verdict of the authorization policies, to correlate the
+authorization decisions with the principals. The records are written by the waypoint-access-log EnvoyFilter
+installed with Kmesh, the other lines of the waypoint log are ignored.
+
+The accesslog of a kmesh daemon pod is shown too, with the id of each connection. Its authz verdict
+carries the same id, see kmeshctl authz log.`,
+		Example: `# Show the access log of a waypoint of the default namespace
+kmeshctl accesslog <waypoint-pod> -n default
+
+# Show the last 100 records of the connections of a peer
+kmeshctl accesslog <waypoint-pod> -n default --tail 100 --identity spiffe://cluster.local/ns/default/sa/sleep
+
+# Print the records in json
+kmeshctl accesslog <waypoint-pod> -n default -o json
+
+# Show the accesslog entries of a connection of a kmesh daemon
+kmeshctl accesslog <kmesh-daemon-pod> -n kmesh-system --conn-id 0123456789abcdef`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runAccessLog(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "default", "namespace of the waypoint pod")
+	cmd.Flags().StringVar(&identity, "identity", "", "only show the records of the peer with this SPIFFE identity")
+	cmd.Flags().StringVar(&connId, "conn-id", "", "only show the records of the connection with this id, logged by kmesh")
+	cmd.Flags().Int64Var(&tail, "tail", -1, "number of lines of the waypoint log to read, all of them if negative")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runAccessLog(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	opts := &corev1.PodLogOptions{}
+	if tail >= 0 {
+		opts.TailLines = &tail
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	data, err := cli.Kube().CoreV1().Pods(namespace).GetLogs(podName, opts).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of pod %s/%s: %w", namespace, podName, err)
+	}
+
+	records, err := ParseRecords(bytes.NewReader(data), identity)
+	if err != nil {
+		return err
+	}
+	if connId != "" {
+		records = slices.DeleteFunc(records, func(r *Record) bool { return r.ConnectionId != connId })
+	}
+	entries := make([]entry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, entry{Record: r, Layer: r.Layer(), Verdict: r.Verdict()})
+	}
+	return utils.PrintOutput(w, output, entries, func() error {
+		return printRecords(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), records)
+	})
+}
+
+// ParseRecords reads the access log records from the log of a waypoint, keeping the ones of the
+// peer identity if it is not empty
+func ParseRecords(r io.Reader, identity string) ([]*Record, error) {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if fields, ok := ParseEntry(string(line), KmeshAccesslogPrefix); ok {
+			record := kmeshRecord(fields)
+			if identity == "" {
+				records = append(records, record)
+			}
+			continue
+		}
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		record := &Record{}
+		if err := json.Unmarshal(line, record); err != nil || record.AccessLog != waypointAccessLog {
+			continue
+		}
+		if identity != "" && record.PeerIdentity != identity {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the waypoint log: %w", err)
+	}
+	return records, nil
+}
+
+// ParseEntry parses a line a kmesh daemon logged with the prefix, "<prefix><time> field=value, field=value",
+// into its fields, the time is the "time" field
+func ParseEntry(line, prefix string) (map[string]string, bool) {
+	entry, ok := strings.CutPrefix(line, prefix)
+	if !ok {
+		return nil, false
+	}
+	first := strings.Index(entry, "=")
+	if first < 0 {
+		return nil, false
+	}
+	start := strings.LastIndex(entry[:first], " ")
+	if start < 0 {
+		return nil, false
+	}
+	fields := map[string]string{"time": entry[:start]}
+	var last string
+	for _, field := range strings.Split(entry[start+1:], ", ") {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			// a value containing a comma, only the last field may have one
+			if last != "" {
+				fields[last] += ", " + field
+			}
+			continue
+		}
+		fields[name], last = value, name
+	}
+	return fields, true
+}
+
+// kmeshRecord is the record of an accesslog entry of a kmesh daemon
+func kmeshRecord(fields map[string]string) *Record {
+	record := &Record{
+		AccessLog:          kmeshAccessLog,
+		StartTime:          fields["start_time"],
+		SourceAddress:      dashToEmpty(fields["src.addr"]),
+		DestinationAddress: dashToEmpty(fields["dst.addr"]),
+		ConnectionId:       dashToEmpty(fields["conn_id"]),
+		State:              fields["state"],
+	}
+	if record.StartTime == "" {
+		record.StartTime = fields["time"]
+	}
+	record.BytesSent, _ = strconv.ParseUint(fields["sent_bytes"], 10, 64)
+	record.BytesReceived, _ = strconv.ParseUint(fields["received_bytes"], 10, 64)
+	if ms, err := strconv.ParseFloat(strings.TrimSuffix(fields["duration"], "ms"), 64); err == nil {
+		record.Duration = uint64(ms)
+	}
+	return record
+}
+
+func printRecords(w *tabwriter.Writer, records []*Record) error {
+	// the records of kmesh carry the id of their connection
+	withConnId := slices.ContainsFunc(records, func(r *Record) bool { return r.ConnectionId != "" })
+	header := "START TIME\tSOURCE\tPEER IDENTITY\tDESTINATION\tLAYER\tVERDICT\tDETAILS"
+	if withConnId {
+		header += "\tCONN ID"
+	}
+	fmt.Fprintln(w, header)
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s", r.StartTime, orDash(r.SourceAddress), orDash(r.PeerIdentity),
+			orDash(r.DestinationAddress), r.Layer(), r.Verdict(), details(r))
+		if withConnId {
+			fmt.Fprintf(w, "\t%s", orDash(r.ConnectionId))
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// details is the policy denying the record, or the request and its response code for L7
+func details(r *Record) string {
+	switch {
+	case strings.HasPrefix(r.ResponseCodeDetails, rbacDenied):
+		return r.ResponseCodeDetails
+	case strings.HasPrefix(r.ConnectionTerminationDetails, rbacDenied):
+		return r.ConnectionTerminationDetails
+	case r.Protocol != "":
+		return fmt.Sprintf("%s %s %d", r.Method, r.Path, r.ResponseCode)
+	case r.AccessLog == kmeshAccessLog:
+		return fmt.Sprintf("%s sent=%d received=%d %dms", r.State, r.BytesSent, r.BytesReceived, r.Duration)
+	}
+	return "-"
+}
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
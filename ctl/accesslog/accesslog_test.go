@@ -0,0 +1,101 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a waypoint log with a mutually authenticated L4 connection, a request denied by a policy
+// and a connection without mTLS among the other logs of envoy
+const waypointLog = `2024-08-01T10:00:00.000000Z	info	Workload SDS socket not found. Starting Istio SDS Server
+{"kmesh_access_log":"waypoint","start_time":"2024-08-01T10:00:01.000Z","protocol":null,"source_address":"10.244.1.5:43012","destination_address":"10.244.2.7:9090","upstream_host":"10.244.2.7:9090","peer_identity":"spiffe://cluster.local/ns/default/sa/sleep","method":null,"path":null,"response_code":0,"response_flags":"-","response_code_details":null,"connection_termination_details":null,"bytes_received":120,"bytes_sent":1024,"duration":15}
+{"kmesh_access_log":"waypoint","start_time":"2024-08-01T10:00:02.000Z","protocol":"HTTP/1.1","source_address":"10.244.1.6:51234","destination_address":"10.244.2.7:8080","upstream_host":null,"peer_identity":"spiffe://cluster.local/ns/default/sa/curl","method":"GET","path":"/admin","response_code":403,"response_flags":"-","response_code_details":"rbac_access_denied_matched_policy[ns[default]-policy[deny-admin]-rule[0]]","connection_termination_details":null,"bytes_received":0,"bytes_sent":19,"duration":1}
+{"start_time":"2024-08-01T10:00:03.000Z","message":"not an access log record"}
+{"kmesh_access_log":"waypoint","start_time":"2024-08-01T10:00:04.000Z","protocol":null,"source_address":"10.244.1.7:40000","destination_address":"10.244.2.7:9090","upstream_host":null,"peer_identity":null,"method":null,"path":null,"response_code":0,"response_flags":"-","response_code_details":null,"connection_termination_details":"rbac_access_denied_matched_policy[none]","bytes_received":0,"bytes_sent":0,"duration":0}
+`
+
+func TestParseRecords(t *testing.T) {
+	records, err := ParseRecords(strings.NewReader(waypointLog), "")
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+
+	// the identity of the mutually authenticated connection is logged
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/sleep", records[0].PeerIdentity)
+	assert.Equal(t, "L4", records[0].Layer())
+	assert.Equal(t, VerdictAllow, records[0].Verdict())
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/curl", records[1].PeerIdentity)
+	assert.Equal(t, "L7", records[1].Layer())
+	assert.Equal(t, VerdictDeny, records[1].Verdict())
+	assert.Empty(t, records[2].PeerIdentity)
+	assert.Equal(t, VerdictDeny, records[2].Verdict())
+
+	records, err = ParseRecords(strings.NewReader(waypointLog), "spiffe://cluster.local/ns/default/sa/sleep")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "10.244.1.5:43012", records[0].SourceAddress)
+}
+
+func TestPrintRecords(t *testing.T) {
+	records, err := ParseRecords(strings.NewReader(waypointLog), "")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, printRecords(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), records))
+	assert.Equal(t, `START TIME                 SOURCE             PEER IDENTITY                                DESTINATION       LAYER   VERDICT   DETAILS
+2024-08-01T10:00:01.000Z   10.244.1.5:43012   spiffe://cluster.local/ns/default/sa/sleep   10.244.2.7:9090   L4      ALLOW     -
+2024-08-01T10:00:02.000Z   10.244.1.6:51234   spiffe://cluster.local/ns/default/sa/curl    10.244.2.7:8080   L7      DENY      rbac_access_denied_matched_policy[ns[default]-policy[deny-admin]-rule[0]]
+2024-08-01T10:00:04.000Z   10.244.1.7:40000   -                                            10.244.2.7:9090   L4      DENY      rbac_access_denied_matched_policy[none]
+`, buf.String())
+}
+
+// a kmesh daemon log with the accesslog entries of a connection and its authz verdict
+const kmeshLog = `authz: 2024-07-04 20:14:01 +0000 UTC conn_id=0123456789abcdef, src.addr=10.244.0.1:40000, dst.addr=10.244.0.2:8080, verdict=ALLOW, reason=no ALLOW policy applies to the workload
+accesslog: 2024-07-04 20:14:06 +0000 UTC src.addr=10.244.0.1:40000, src.workload=sleep, src.namespace=default, dst.addr=10.244.0.2:8080, dst.service=-, dst.workload=httpbin, dst.namespace=default, start_time=2024-07-04 20:14:01 +0000 UTC, direction=INBOUND, state=BPF_TCP_CLOSE, sent_bytes=10, received_bytes=20, packet_loss=0, retransmissions=0, srtt=50us, min_rtt=40us, duration=5000ms, protocol=tcp, conn_id=0123456789abcdef
+accesslog: 2024-07-04 20:14:07 +0000 UTC src.addr=10.244.0.3:40001, dst.addr=10.244.0.2:8080, state=BPF_TCP_CLOSE
+`
+
+func TestParseKmeshRecords(t *testing.T) {
+	records, err := ParseRecords(strings.NewReader(kmeshLog), "")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	// the entries of kmesh are logged with the id of their connection, the verdict is in the authz log
+	assert.Equal(t, "0123456789abcdef", records[0].ConnectionId)
+	assert.Equal(t, "2024-07-04 20:14:01 +0000 UTC", records[0].StartTime)
+	assert.Equal(t, uint64(5000), records[0].Duration)
+	assert.Equal(t, "-", records[0].Verdict())
+	assert.Empty(t, records[1].ConnectionId)
+
+	var buf bytes.Buffer
+	require.NoError(t, printRecords(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), records))
+	assert.Equal(t, `START TIME                      SOURCE             PEER IDENTITY   DESTINATION       LAYER   VERDICT   DETAILS                                    CONN ID
+2024-07-04 20:14:01 +0000 UTC   10.244.0.1:40000   -               10.244.0.2:8080   L4      -         BPF_TCP_CLOSE sent=10 received=20 5000ms   0123456789abcdef
+2024-07-04 20:14:07 +0000 UTC   10.244.0.3:40001   -               10.244.0.2:8080   L4      -         BPF_TCP_CLOSE sent=0 received=0 0ms        -
+`, buf.String())
+
+	// the entries of kmesh have no peer identity
+	records, err = ParseRecords(strings.NewReader(kmeshLog), "spiffe://cluster.local/ns/default/sa/sleep")
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
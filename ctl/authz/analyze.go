@@ -0,0 +1,289 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"istio.io/api/security/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/auth"
+)
+
+// xdpMaxMembers is how many rules of a policy, clauses of a rule, matches of a clause and values of a
+// field the xdp authz evaluates, MAX_MEMBER_NUM_PER_POLICY of the bpf programs
+const xdpMaxMembers = 4
+
+// where the rules of a policy are enforced
+const (
+	enforcedByXdp       = "xdp"
+	enforcedByUserspace = "userspace"
+	enforcedByWaypoint  = "waypoint"
+)
+
+// policyAnalysis is the result of kmeshctl authz analyze
+type policyAnalysis struct {
+	Policy string `json:"policy"`
+	Action string `json:"action"`
+	// Offloads is whether all the rules of the policy are enforced in xdp
+	Offloads bool `json:"offloads"`
+	// EnforcedAt are the waypoints the policy is attached to with targetRefs, empty if it selects workloads
+	EnforcedAt []string       `json:"enforcedAt,omitempty"`
+	Reasons    []string       `json:"reasons,omitempty"`
+	Rules      []ruleAnalysis `json:"rules,omitempty"`
+}
+
+type ruleAnalysis struct {
+	// Rule is the index of the rule in the policy
+	Rule       int      `json:"rule"`
+	EnforcedBy string   `json:"enforcedBy"`
+	Offloads   bool     `json:"offloads"`
+	Reasons    []string `json:"reasons"`
+}
+
+// NewAnalyzeCmd creates a command to report whether the rules of an authorization policy offload to xdp.
+func NewAnalyzeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze -f <policy.yaml>",
+		Short: "Report whether the rules of an authorization policy are enforced in xdp, in userspace or by a waypoint",
+		Long: `Convert an istio AuthorizationPolicy the same way istiod does for kmesh and report, for each of its
+rules, where it is enforced with the reasons why, without connecting to the cluster:
+
+  xdp        the rule only matches the addresses and ports of the connections, it is offloaded to xdp
+  userspace  the rule matches the namespaces or principals of the sources, which xdp cannot see,
+             the connections are authorized by the kmesh daemon
+  waypoint   the rule matches HTTP fields, only a waypoint enforces it. kmesh never matches such an
+             ALLOW rule and enforces such a DENY rule without its HTTP fields
+
+A rule with more members than the xdp authz evaluates does not offload either. A policy attached with
+targetRefs is only enforced by the waypoints it is attached to: a Gateway is the waypoint itself, a Service
+or a ServiceEntry the waypoint it uses, and the istio-waypoint GatewayClass all the waypoints.`,
+		Example: `# Check whether a policy offloads to xdp
+kmeshctl authz analyze -f deny-8080.yaml
+
+# Print the analysis in json
+kmeshctl authz analyze -f deny-8080.yaml -o json
+
+# Check which waypoint enforces a policy attached with targetRefs
+kmeshctl authz analyze -f waypoint-policy.yaml`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runAnalyze(cmd.OutOrStdout()); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&policyFile, "file", "f", "", "file of the istio AuthorizationPolicy")
+	utils.AddOutputFlag(cmd, &output)
+	cmd.Flags().StringVar(&rootNamespace, "root-namespace", "istio-system", "root namespace of istio, its policies apply to the whole mesh")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func runAnalyze(w io.Writer) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	ap, err := readPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+	analysis, err := analyzePolicy(ap, rootNamespace)
+	if err != nil {
+		return fmt.Errorf("unsupported policy %s/%s: %w", ap.Namespace, ap.Name, err)
+	}
+
+	return utils.PrintOutput(w, output, analysis, func() error {
+		fmt.Fprint(w, formatAnalysis(analysis))
+		return nil
+	})
+}
+
+// analyzePolicy reports where each rule of the policy is enforced
+func analyzePolicy(ap *securityclient.AuthorizationPolicy, rootNamespace string) (*policyAnalysis, error) {
+	spec := &ap.Spec
+	analysis := &policyAnalysis{
+		Policy: ap.Namespace + "/" + ap.Name,
+		Action: spec.GetAction().String(),
+	}
+	points, err := resolveTargetRefs(spec, ap.Namespace, rootNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(points) > 0 {
+		// all the rules are enforced at the waypoints, whatever they match
+		analysis.EnforcedAt = points
+		analysis.Reasons = []string{"the policy has targetRefs, only the waypoints it is attached to enforce it, not kmesh"}
+		for i := range spec.GetRules() {
+			analysis.Rules = append(analysis.Rules, ruleAnalysis{
+				Rule:       i,
+				EnforcedBy: enforcedByWaypoint,
+				Reasons:    []string{"enforced by " + strings.Join(points, ", ")},
+			})
+		}
+		return analysis, nil
+	}
+	var action security.Action
+	switch spec.GetAction() {
+	case v1beta1.AuthorizationPolicy_ALLOW:
+		action = security.Action_ALLOW
+	case v1beta1.AuthorizationPolicy_DENY:
+		action = security.Action_DENY
+	default:
+		return nil, fmt.Errorf("the %s action is not supported by kmesh", spec.GetAction())
+	}
+
+	analysis.Offloads = true
+	rules := spec.GetRules()
+	switch {
+	case len(rules) == 0:
+		analysis.Reasons = append(analysis.Reasons, "the policy has no rules, it matches no connection")
+	case len(rules) > xdpMaxMembers:
+		analysis.Offloads = false
+		analysis.Reasons = append(analysis.Reasons, fmt.Sprintf("the policy has %d rules, xdp only evaluates the first %d",
+			len(rules), xdpMaxMembers))
+	}
+	for i, rule := range rules {
+		ra := analyzeRule(i, rule, action)
+		analysis.Offloads = analysis.Offloads && ra.Offloads
+		analysis.Rules = append(analysis.Rules, ra)
+	}
+	return analysis, nil
+}
+
+func analyzeRule(index int, rule *v1beta1.Rule, action security.Action) ruleAnalysis {
+	ra := ruleAnalysis{Rule: index, EnforcedBy: enforcedByXdp}
+	clauses, httpFields := auth.ConvertRule(rule)
+
+	if len(httpFields) > 0 {
+		ra.EnforcedBy = enforcedByWaypoint
+		reason := fmt.Sprintf("matches the HTTP fields %s, only a waypoint enforces them", strings.Join(httpFields, ", "))
+		if action == security.Action_ALLOW {
+			reason += ", kmesh never matches the rule"
+		} else {
+			reason += ", kmesh enforces the rule without them"
+		}
+		ra.Reasons = append(ra.Reasons, reason)
+	}
+	if identities := identityFields(clauses); len(identities) > 0 {
+		if ra.EnforcedBy == enforcedByXdp {
+			ra.EnforcedBy = enforcedByUserspace
+		}
+		ra.Reasons = append(ra.Reasons, fmt.Sprintf("matches the source %s, which xdp cannot see, "+
+			"the connections are authorized in userspace", strings.Join(identities, ", ")))
+	}
+	limits := memberLimits(clauses)
+	ra.Reasons = append(ra.Reasons, limits...)
+
+	ra.Offloads = ra.EnforcedBy == enforcedByXdp && len(limits) == 0
+	if ra.Offloads {
+		ra.Reasons = append(ra.Reasons, "only matches the addresses and ports of the connections")
+	}
+	return ra
+}
+
+// identityFields returns the fields of the clauses matching the identity of the sources
+func identityFields(clauses []*security.Clause) []string {
+	var namespaces, principals bool
+	for _, clause := range clauses {
+		for _, match := range clause.GetMatches() {
+			namespaces = namespaces || len(match.GetNamespaces()) > 0 || len(match.GetNotNamespaces()) > 0
+			principals = principals || len(match.GetPrincipals()) > 0 || len(match.GetNotPrincipals()) > 0
+		}
+	}
+	var fields []string
+	if namespaces {
+		fields = append(fields, "namespaces")
+	}
+	if principals {
+		fields = append(fields, "principals")
+	}
+	return fields
+}
+
+// memberLimits returns why the clauses exceed the members the xdp authz evaluates
+func memberLimits(clauses []*security.Clause) []string {
+	var reasons []string
+	if len(clauses) > xdpMaxMembers {
+		reasons = append(reasons, fmt.Sprintf("has %d conditions, xdp only evaluates the first %d", len(clauses), xdpMaxMembers))
+	}
+	for _, clause := range clauses {
+		if len(clause.GetMatches()) > xdpMaxMembers {
+			reasons = append(reasons, fmt.Sprintf("has %d alternatives in a condition, xdp only evaluates the first %d",
+				len(clause.GetMatches()), xdpMaxMembers))
+		}
+		for _, match := range clause.GetMatches() {
+			for _, field := range []struct {
+				name string
+				n    int
+			}{
+				{"destination ports", len(match.GetDestinationPorts())},
+				{"not destination ports", len(match.GetNotDestinationPorts())},
+				{"source ips", len(match.GetSourceIps())},
+				{"not source ips", len(match.GetNotSourceIps())},
+				{"destination ips", len(match.GetDestinationIps())},
+				{"not destination ips", len(match.GetNotDestinationIps())},
+			} {
+				if field.n > xdpMaxMembers {
+					reasons = append(reasons, fmt.Sprintf("matches %d %s, xdp only evaluates the first %d",
+						field.n, field.name, xdpMaxMembers))
+				}
+			}
+		}
+	}
+	return reasons
+}
+
+// formatAnalysis prints the policy and a table of its rules
+func formatAnalysis(a *policyAnalysis) string {
+	var sb strings.Builder
+	offloads := "no"
+	if a.Offloads {
+		offloads = "yes"
+	}
+	fmt.Fprintf(&sb, "Policy:      %s (%s)\n", a.Policy, a.Action)
+	fmt.Fprintf(&sb, "Offloads:    %s\n", offloads)
+	for _, point := range a.EnforcedAt {
+		fmt.Fprintf(&sb, "Enforced at: %s\n", point)
+	}
+	for _, reason := range a.Reasons {
+		fmt.Fprintf(&sb, "Reason:      %s\n", reason)
+	}
+	if len(a.Rules) == 0 {
+		return sb.String()
+	}
+
+	sb.WriteString("\n")
+	tw := tabwriter.NewWriter(&sb, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "RULE\tENFORCED BY\tOFFLOADS\tREASONS")
+	for _, r := range a.Rules {
+		offloads := "no"
+		if r.Offloads {
+			offloads = "yes"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", r.Rule, r.EnforcedBy, offloads, strings.Join(r.Reasons, "; "))
+	}
+	tw.Flush()
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/ctl/utils"
+)
+
+const mixedPolicy = `apiVersion: security.istio.io/v1
+kind: AuthorizationPolicy
+metadata:
+  name: httpbin
+  namespace: sample
+spec:
+  action: ALLOW
+  rules:
+  - from:
+    - source:
+        ipBlocks: ["10.244.0.0/16"]
+    to:
+    - operation:
+        ports: ["8080"]
+  - from:
+    - source:
+        namespaces: ["sample"]
+  - to:
+    - operation:
+        methods: ["GET"]
+        ports: ["8080"]
+  - to:
+    - operation:
+        ports: ["80", "81", "82", "83", "84"]
+`
+
+func TestAnalyzePolicy(t *testing.T) {
+	ap, err := readPolicy(writePolicy(t, mixedPolicy))
+	require.NoError(t, err)
+
+	analysis, err := analyzePolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.Equal(t, &policyAnalysis{
+		Policy:   "sample/httpbin",
+		Action:   "ALLOW",
+		Offloads: false,
+		Rules: []ruleAnalysis{
+			{Rule: 0, EnforcedBy: enforcedByXdp, Offloads: true,
+				Reasons: []string{"only matches the addresses and ports of the connections"}},
+			{Rule: 1, EnforcedBy: enforcedByUserspace,
+				Reasons: []string{"matches the source namespaces, which xdp cannot see, the connections are authorized in userspace"}},
+			{Rule: 2, EnforcedBy: enforcedByWaypoint,
+				Reasons: []string{"matches the HTTP fields methods, only a waypoint enforces them, kmesh never matches the rule"}},
+			{Rule: 3, EnforcedBy: enforcedByXdp,
+				Reasons: []string{"matches 5 destination ports, xdp only evaluates the first 4"}},
+		},
+	}, analysis)
+
+	// a DENY rule is enforced without its HTTP fields
+	ap, err = readPolicy(writePolicy(t, denyPolicy))
+	require.NoError(t, err)
+	analysis, err = analyzePolicy(ap, "istio-system")
+	require.NoError(t, err)
+	require.Len(t, analysis.Rules, 1)
+	assert.Equal(t, enforcedByWaypoint, analysis.Rules[0].EnforcedBy)
+	assert.Equal(t, []string{
+		"matches the HTTP fields methods, only a waypoint enforces them, kmesh enforces the rule without them",
+		"matches the source principals, which xdp cannot see, the connections are authorized in userspace",
+	}, analysis.Rules[0].Reasons)
+
+	ap.Spec.Rules = nil
+	analysis, err = analyzePolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.True(t, analysis.Offloads)
+	assert.Equal(t, []string{"the policy has no rules, it matches no connection"}, analysis.Reasons)
+
+	ap.Spec.Action = 3 // AUDIT
+	_, err = analyzePolicy(ap, "istio-system")
+	assert.Error(t, err)
+}
+
+func TestRunAnalyze(t *testing.T) {
+	policyFile = writePolicy(t, mixedPolicy)
+	defer func() { policyFile, output = "", "" }()
+
+	var buf bytes.Buffer
+	output = ""
+	require.NoError(t, runAnalyze(&buf))
+	assert.Equal(t, `Policy:      sample/httpbin (ALLOW)
+Offloads:    no
+
+RULE  ENFORCED BY  OFFLOADS  REASONS
+0     xdp          yes       only matches the addresses and ports of the connections
+1     userspace    no        matches the source namespaces, which xdp cannot see, the connections are authorized in userspace
+2     waypoint     no        matches the HTTP fields methods, only a waypoint enforces them, kmesh never matches the rule
+3     xdp          no        matches 5 destination ports, xdp only evaluates the first 4
+`, buf.String())
+
+	buf.Reset()
+	output = utils.OutputJson
+	require.NoError(t, runAnalyze(&buf))
+	var analysis policyAnalysis
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &analysis))
+	assert.Len(t, analysis.Rules, 4)
+	assert.False(t, analysis.Offloads)
+}
@@ -19,21 +19,21 @@ package authz
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"kmesh.net/kmesh/api/v2/adminapi"
 	"kmesh.net/kmesh/ctl/utils"
 	"kmesh.net/kmesh/pkg/kube"
 	"kmesh.net/kmesh/pkg/logger"
 )
 
 const (
-	patternAuthz = "/authz"
+	requestTimeout = 10 * time.Second
 )
 
 var log = logger.NewLoggerScope("kmeshctl/authz")
@@ -48,6 +48,11 @@ func NewCmd() *cobra.Command {
 	authzCmd.AddCommand(NewEnableCmd())
 	authzCmd.AddCommand(NewDisableCmd())
 	authzCmd.AddCommand(NewStatusCmd())
+	authzCmd.AddCommand(NewExplainCmd())
+	authzCmd.AddCommand(NewReplayCmd())
+	authzCmd.AddCommand(NewTestCmd())
+	authzCmd.AddCommand(NewAnalyzeCmd())
+	authzCmd.AddCommand(NewLogCmd())
 
 	return authzCmd
 }
@@ -57,11 +62,12 @@ func NewEnableCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "enable [podNames...]",
 		Short:   "Enable xdp authz eBPF program for Kmesh's authz offloading",
+		Long:    "Enable xdp authz eBPF program for Kmesh's authz offloading on the nodes of the Kmesh daemons. The kmesh.net/authz label of a pod, enabled or disabled, overrides it for the pod.",
 		Example: "kmeshctl authz enable\nkmeshctl authz enable pod1 pod2",
 		Args:    cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			// If no pod names are given, apply to all kmesh daemon pods.
-			SetAuthzForPods(args, "true")
+			SetAuthzForPods(args, true)
 			log.Info("Authorization has been enabled.")
 		},
 	}
@@ -76,7 +82,7 @@ func NewDisableCmd() *cobra.Command {
 		Example: "kmeshctl authz disable\nkmeshctl authz disable pod1 pod2",
 		Args:    cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			SetAuthzForPods(args, "false")
+			SetAuthzForPods(args, false)
 			log.Info("Authorization has been disabled.")
 		},
 	}
@@ -93,8 +99,7 @@ func NewStatusCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			cli, err := utils.CreateKubeClient()
 			if err != nil {
-				log.Errorf("failed to create cli client: %v", err)
-				os.Exit(1)
+				utils.Exit(log, fmt.Errorf("failed to create cli client: %w", err))
 			}
 
 			// Determine which pods to query.
@@ -102,8 +107,7 @@ func NewStatusCmd() *cobra.Command {
 			if len(args) == 0 {
 				podList, err := cli.PodsForSelector(context.TODO(), utils.KmeshNamespace, utils.KmeshLabel)
 				if err != nil {
-					log.Errorf("failed to get kmesh podList: %v", err)
-					os.Exit(1)
+					utils.Exit(log, fmt.Errorf("failed to get kmesh podList: %w", err))
 				}
 				for _, pod := range podList.Items {
 					podNames = append(podNames, pod.GetName())
@@ -119,11 +123,12 @@ func NewStatusCmd() *cobra.Command {
 			}
 			statuses := make([]podStatus, 0, len(podNames))
 
-			// Collect the status for each pod.
+			// Collect the status for each pod, the pods which failed make the command fail after the table.
+			var errs []error
 			for _, podName := range podNames {
 				status, err := fetchAuthzStatus(cli, podName)
 				if err != nil {
-					log.Errorf("failed to get authz status for pod %s: %v", podName, err)
+					errs = append(errs, fmt.Errorf("failed to get authz status for pod %s: %w", podName, err))
 					continue
 				}
 				statuses = append(statuses, podStatus{Pod: podName, Status: status})
@@ -138,6 +143,9 @@ func NewStatusCmd() *cobra.Command {
 			}
 			tw.Flush()
 			fmt.Print(buf.String())
+			if len(errs) > 0 {
+				utils.Exit(log, errors.Join(errs...))
+			}
 		},
 	}
 	return cmd
@@ -145,104 +153,69 @@ func NewStatusCmd() *cobra.Command {
 
 // SetAuthzForPods applies the authz setting (enable/disable) for the given pod(s).
 // If no pod names are specified, it applies the setting to all kmesh daemon pods.
-func SetAuthzForPods(podNames []string, info string) {
+// It is applied to every pod, and exits with the code of the failures once done.
+func SetAuthzForPods(podNames []string, enabled bool) {
 	cli, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to create cli client: %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to create cli client: %w", err))
 	}
 
 	if len(podNames) == 0 {
 		// Apply to all kmesh daemon pods.
 		podList, err := cli.PodsForSelector(context.TODO(), utils.KmeshNamespace, utils.KmeshLabel)
 		if err != nil {
-			log.Errorf("failed to get kmesh podList: %v", err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to get kmesh podList: %w", err))
 		}
 		for _, pod := range podList.Items {
-			SetAuthzPerKmeshDaemon(cli, pod.GetName(), info)
-		}
-	} else {
-		// Process for specified pods.
-		for _, podName := range podNames {
-			SetAuthzPerKmeshDaemon(cli, podName, info)
+			podNames = append(podNames, pod.GetName())
 		}
 	}
-}
 
-// SetAuthzPerKmeshDaemon sends a POST request to a specific kmesh daemon pod
-// to set the authz flag based on the info parameter ("true" or "false").
-func SetAuthzPerKmeshDaemon(cli kube.CLIClient, podName, info string) {
-	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
-	if err != nil {
-		log.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
-	}
-	if err := fw.Start(); err != nil {
-		log.Errorf("failed to start port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
+	var errs []error
+	for _, podName := range podNames {
+		if err := SetAuthzPerKmeshDaemon(cli, podName, enabled); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	defer fw.Close()
-
-	url := fmt.Sprintf("http://%s%s?enable=%s", fw.Address(), patternAuthz, info)
-
-	req, err := http.NewRequest(http.MethodPost, url, nil)
-	if err != nil {
-		log.Errorf("Error creating request: %v", err)
-		return
+	if len(errs) > 0 {
+		utils.Exit(log, errors.Join(errs...))
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// SetAuthzPerKmeshDaemon calls the admin api of a specific kmesh daemon pod
+// to enable or disable authz offloading.
+func SetAuthzPerKmeshDaemon(cli kube.CLIClient, podName string, enabled bool) error {
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
 	if err != nil {
-		log.Errorf("failed to make HTTP request: %v", err)
-		return
+		return err
 	}
-	defer resp.Body.Close()
+	defer client.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Errorf("Error: received status code %d", resp.StatusCode)
-		return
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if _, err := client.SetAuthz(ctx, &adminapi.SetAuthzRequest{Enabled: enabled}); err != nil {
+		return fmt.Errorf("failed to set authz for pod %s: %w", podName, err)
 	}
+	return nil
 }
 
-// fetchAuthzStatus sends a GET request to a specific kmesh daemon pod
+// fetchAuthzStatus calls the admin api of a specific kmesh daemon pod
 // to retrieve the current authz status and returns it.
 func fetchAuthzStatus(cli kube.CLIClient, podName string) (string, error) {
-	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
 	if err != nil {
-		return "", fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %v", podName, err)
-	}
-	if err := fw.Start(); err != nil {
-		return "", fmt.Errorf("failed to start port forwarder for Kmesh daemon pod %s: %v", podName, err)
-	}
-	defer fw.Close()
-
-	url := fmt.Sprintf("http://%s%s", fw.Address(), patternAuthz)
-
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return "", err
 	}
+	defer client.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	status, err := client.GetAuthz(ctx, &adminapi.GetAuthzRequest{})
 	if err != nil {
-		return "", fmt.Errorf("failed to make HTTP request: %v", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("received status code %d", resp.StatusCode)
+	if status.GetEnabled() {
+		return "enabled", nil
 	}
-
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
-
-	status := string(bodyBytes)
-	return status, nil
+	return "disabled", nil
 }
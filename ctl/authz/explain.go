@@ -0,0 +1,136 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+)
+
+var (
+	src    string
+	dst    string
+	port   uint32
+	output string
+)
+
+// NewExplainCmd creates a command to explain the authorization verdict of a connection.
+func NewExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain <kmesh-daemon-pod>",
+		Short: "Explain which authorization policy allows or denies a connection",
+		Long: `Evaluate the authorization policies loaded by a kmesh daemon on the connection from --src
+to --port of the --dst workload and print the policy and rule deciding the verdict, without sending
+any traffic. The evaluation is the same as the userspace authorization of the data plane.
+--dst must be the ip of a workload, not of a service. Only dual-engine mode is supported.`,
+		Example: `# Explain why 10.244.0.5 cannot connect to port 8080 of the workload 10.244.1.3
+kmeshctl authz explain <kmesh-daemon-pod> --src 10.244.0.5 --dst 10.244.1.3 --port 8080
+
+# Print the explanation in json
+kmeshctl authz explain <kmesh-daemon-pod> --src 10.244.0.5 --dst 10.244.1.3 --port 8080 -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runExplain(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&src, "src", "", "source ip of the connection")
+	cmd.Flags().StringVar(&dst, "dst", "", "ip of the destination workload")
+	cmd.Flags().Uint32Var(&port, "port", 0, "destination port of the connection")
+	utils.AddOutputFlag(cmd, &output)
+	_ = cmd.MarkFlagRequired("src")
+	_ = cmd.MarkFlagRequired("dst")
+	_ = cmd.MarkFlagRequired("port")
+	return cmd
+}
+
+func runExplain(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	// validate locally to fail before connecting to the daemon
+	if _, err := netip.ParseAddr(src); err != nil {
+		return fmt.Errorf("invalid --src: %w", err)
+	}
+	if _, err := netip.ParseAddr(dst); err != nil {
+		return fmt.Errorf("invalid --dst: %w", err)
+	}
+	if port == 0 || port > 65535 {
+		return fmt.Errorf("invalid --port %d", port)
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: src, Dst: dst, Port: port})
+	if err != nil {
+		return fmt.Errorf("failed to explain authorization on pod %s: %w", podName, err)
+	}
+
+	return utils.PrintOutput(w, output, resp, func() error {
+		fmt.Fprint(w, formatExplanation(resp))
+		return nil
+	})
+}
+
+// formatExplanation prints the verdict, the deciding policy and the fields of its matched rule
+func formatExplanation(resp *adminapi.AuthzExplanation) string {
+	var sb strings.Builder
+	verdict := "DENY"
+	if resp.GetAllowed() {
+		verdict = "ALLOW"
+	}
+	fmt.Fprintf(&sb, "Verdict:     %s\n", verdict)
+	fmt.Fprintf(&sb, "Reason:      %s\n", resp.GetReason())
+	fmt.Fprintf(&sb, "Source:      %s%s\n", src, optional(resp.GetSourceIdentity()))
+	fmt.Fprintf(&sb, "Destination: %s%s\n", netip.AddrPortFrom(netip.MustParseAddr(dst), uint16(port)),
+		optional(resp.GetDestinationWorkload()))
+	if resp.GetPolicy() == "" {
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "Policy:      %s (%s)\n", resp.GetPolicy(), resp.GetAction())
+	fmt.Fprintf(&sb, "Rule:        %d\n", resp.GetRule())
+	for _, line := range strings.Split(strings.TrimSpace(resp.GetRuleJson()), "\n") {
+		fmt.Fprintf(&sb, "  %s\n", line)
+	}
+	return sb.String()
+}
+
+func optional(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " (" + s + ")"
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestFormatExplanation(t *testing.T) {
+	src, dst, port = "10.244.0.5", "10.244.1.3", 8080
+
+	denied := &adminapi.AuthzExplanation{
+		Reason:              "a rule of the DENY policy matched",
+		Policy:              "default/deny-8080",
+		Action:              "DENY",
+		RuleJson:            "{\n  \"clauses\": []\n}",
+		SourceIdentity:      "spiffe://cluster.local/ns/default/sa/sleep",
+		DestinationWorkload: "cluster0//Pod/default/httpbin",
+	}
+	assert.Equal(t, `Verdict:     DENY
+Reason:      a rule of the DENY policy matched
+Source:      10.244.0.5 (spiffe://cluster.local/ns/default/sa/sleep)
+Destination: 10.244.1.3:8080 (cluster0//Pod/default/httpbin)
+Policy:      default/deny-8080 (DENY)
+Rule:        0
+  {
+    "clauses": []
+  }
+`, formatExplanation(denied))
+
+	allowed := &adminapi.AuthzExplanation{
+		Allowed:             true,
+		Reason:              "no ALLOW policy applies to the destination workload",
+		Rule:                -1,
+		DestinationWorkload: "cluster0//Pod/default/httpbin",
+	}
+	assert.Equal(t, `Verdict:     ALLOW
+Reason:      no ALLOW policy applies to the destination workload
+Source:      10.244.0.5
+Destination: 10.244.1.3:8080 (cluster0//Pod/default/httpbin)
+`, formatExplanation(allowed))
+}
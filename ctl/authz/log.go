@@ -0,0 +1,177 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+
+	"kmesh.net/kmesh/ctl/accesslog"
+	"kmesh.net/kmesh/ctl/utils"
+)
+
+var (
+	logTail   int64
+	logConnId string
+)
+
+// VerdictRecord is an authz verdict logged by a kmesh daemon, joined with the outcome of its connection
+type VerdictRecord struct {
+	Time         string `json:"time"`
+	ConnectionId string `json:"connId,omitempty"`
+	Source       string `json:"source"`
+	Destination  string `json:"destination"`
+	Verdict      string `json:"verdict"`
+	Reason       string `json:"reason"`
+	// Outcome is the last accesslog record of the connection, nil if it is not in the log
+	Outcome *accesslog.Record `json:"outcome,omitempty"`
+}
+
+// NewLogCmd creates a command to show the authz verdicts logged by a kmesh daemon.
+func NewLogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log <kmesh-daemon-pod>",
+		Short: "Show the authz verdicts of the connections along with their outcome",
+		Long: `Show the authz verdicts logged by a kmesh daemon, each joined with the outcome of its connection
+from the accesslog by the id the data plane assigned to the connection at its start. The verdicts
+and the accesslog are only logged while the accesslog is enabled, see kmeshctl monitoring.`,
+		Example: `# Show the authz verdicts of a kmesh daemon
+kmeshctl authz log <kmesh-daemon-pod>
+
+# Show the verdict of a connection
+kmeshctl authz log <kmesh-daemon-pod> --conn-id 0123456789abcdef
+
+# Print the verdicts in json
+kmeshctl authz log <kmesh-daemon-pod> -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runLog(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&logConnId, "conn-id", "", "only show the verdict of the connection with this id")
+	cmd.Flags().Int64Var(&logTail, "tail", -1, "number of lines of the kmesh daemon log to read, all of them if negative")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runLog(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	opts := &corev1.PodLogOptions{}
+	if logTail >= 0 {
+		opts.TailLines = &logTail
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	data, err := cli.Kube().CoreV1().Pods(utils.KmeshNamespace).GetLogs(podName, opts).DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get logs of pod %s/%s: %w", utils.KmeshNamespace, podName, err)
+	}
+
+	verdicts, err := ParseVerdicts(data, logConnId)
+	if err != nil {
+		return err
+	}
+	return utils.PrintOutput(w, output, verdicts, func() error {
+		return printVerdicts(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), verdicts)
+	})
+}
+
+// ParseVerdicts reads the authz verdicts from the log of a kmesh daemon and joins each with the last
+// accesslog record of its connection, keeping the verdict of the connection connId if it is not empty
+func ParseVerdicts(data []byte, connId string) ([]*VerdictRecord, error) {
+	records, err := accesslog.ParseRecords(bytes.NewReader(data), "")
+	if err != nil {
+		return nil, err
+	}
+	// the records of a connection are logged periodically until it is closed, the last one is its outcome
+	outcomes := make(map[string]*accesslog.Record)
+	for _, record := range records {
+		if record.ConnectionId != "" {
+			outcomes[record.ConnectionId] = record
+		}
+	}
+
+	var verdicts []*VerdictRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields, ok := accesslog.ParseEntry(string(bytes.TrimSpace(scanner.Bytes())), accesslog.KmeshVerdictPrefix)
+		if !ok {
+			continue
+		}
+		verdict := &VerdictRecord{
+			Time:         fields["time"],
+			ConnectionId: fields["conn_id"],
+			Source:       fields["src.addr"],
+			Destination:  fields["dst.addr"],
+			Verdict:      fields["verdict"],
+			Reason:       fields["reason"],
+		}
+		// the connections established before the data plane assigned ids have none
+		if verdict.ConnectionId == "-" {
+			verdict.ConnectionId = ""
+		}
+		if connId != "" && verdict.ConnectionId != connId {
+			continue
+		}
+		if verdict.ConnectionId != "" {
+			verdict.Outcome = outcomes[verdict.ConnectionId]
+		}
+		verdicts = append(verdicts, verdict)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the kmesh daemon log: %w", err)
+	}
+	return verdicts, nil
+}
+
+func printVerdicts(w *tabwriter.Writer, verdicts []*VerdictRecord) error {
+	fmt.Fprintln(w, "TIME\tCONN ID\tSOURCE\tDESTINATION\tVERDICT\tREASON\tOUTCOME")
+	for _, v := range verdicts {
+		outcome := "-"
+		if v.Outcome != nil {
+			outcome = fmt.Sprintf("%s sent=%d received=%d %dms", v.Outcome.State, v.Outcome.BytesSent,
+				v.Outcome.BytesReceived, v.Outcome.Duration)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", v.Time, orDash(v.ConnectionId), orDash(v.Source),
+			orDash(v.Destination), v.Verdict, orDash(v.Reason), outcome)
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a kmesh daemon log with the verdicts of a connection allowed then closed, of a denied one and of
+// one established before the data plane assigned ids, among the other logs of the daemon
+const daemonLog = `time="2024-07-04T20:14:00Z" level=info msg="start to watch the workloads" subsys=controller
+authz: 2024-07-04 20:14:01 +0000 UTC conn_id=0123456789abcdef, src.addr=10.244.0.1:40000, dst.addr=10.244.0.2:8080, verdict=ALLOW, reason=no ALLOW policy applies to the workload
+authz: 2024-07-04 20:14:02 +0000 UTC conn_id=00000000deadbeef, src.addr=10.244.0.3:40001, dst.addr=10.244.0.2:8080, verdict=DENY, reason=authorization policy default/deny-sleep
+accesslog: 2024-07-04 20:14:06 +0000 UTC src.addr=10.244.0.1:40000, src.workload=sleep, src.namespace=default, dst.addr=10.244.0.2:8080, dst.service=httpbin.default.svc.cluster.local, dst.workload=httpbin, dst.namespace=default, start_time=2024-07-04 20:14:01 +0000 UTC, direction=INBOUND, state=BPF_TCP_ESTABLISHED, sent_bytes=10, received_bytes=20, packet_loss=0, retransmissions=0, srtt=50us, min_rtt=40us, duration=5000ms, protocol=tcp, conn_id=0123456789abcdef
+accesslog: 2024-07-04 20:14:08 +0000 UTC src.addr=10.244.0.1:40000, src.workload=sleep, src.namespace=default, dst.addr=10.244.0.2:8080, dst.service=httpbin.default.svc.cluster.local, dst.workload=httpbin, dst.namespace=default, start_time=2024-07-04 20:14:01 +0000 UTC, direction=INBOUND, state=BPF_TCP_CLOSE, sent_bytes=5, received_bytes=7, packet_loss=0, retransmissions=0, srtt=50us, min_rtt=40us, duration=7000.5ms, protocol=tcp, conn_id=0123456789abcdef
+authz: 2024-07-04 20:14:09 +0000 UTC conn_id=-, src.addr=10.244.0.4:40002, dst.addr=10.244.0.2:8080, verdict=DENY, reason=all the new connections are denied, the policies are being resynced
+`
+
+func TestParseVerdicts(t *testing.T) {
+	verdicts, err := ParseVerdicts([]byte(daemonLog), "")
+	require.NoError(t, err)
+	require.Len(t, verdicts, 3)
+
+	// the verdict of the connection is joined with its last accesslog record by the id of the connection
+	assert.Equal(t, "0123456789abcdef", verdicts[0].ConnectionId)
+	assert.Equal(t, "ALLOW", verdicts[0].Verdict)
+	require.NotNil(t, verdicts[0].Outcome)
+	assert.Equal(t, verdicts[0].ConnectionId, verdicts[0].Outcome.ConnectionId)
+	assert.Equal(t, "BPF_TCP_CLOSE", verdicts[0].Outcome.State)
+	assert.Equal(t, uint64(7000), verdicts[0].Outcome.Duration)
+
+	// the denied connection was not logged in the accesslog
+	assert.Equal(t, "DENY", verdicts[1].Verdict)
+	assert.Equal(t, "authorization policy default/deny-sleep", verdicts[1].Reason)
+	assert.Nil(t, verdicts[1].Outcome)
+
+	// a connection without an id is not joined, its reason is kept whole
+	assert.Empty(t, verdicts[2].ConnectionId)
+	assert.Equal(t, "all the new connections are denied, the policies are being resynced", verdicts[2].Reason)
+	assert.Nil(t, verdicts[2].Outcome)
+
+	verdicts, err = ParseVerdicts([]byte(daemonLog), "00000000deadbeef")
+	require.NoError(t, err)
+	require.Len(t, verdicts, 1)
+	assert.Equal(t, "10.244.0.3:40001", verdicts[0].Source)
+}
+
+func TestPrintVerdicts(t *testing.T) {
+	verdicts, err := ParseVerdicts([]byte(daemonLog), "")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, printVerdicts(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), verdicts))
+	assert.Equal(t, `TIME                            CONN ID            SOURCE             DESTINATION       VERDICT   REASON                                                                OUTCOME
+2024-07-04 20:14:01 +0000 UTC   0123456789abcdef   10.244.0.1:40000   10.244.0.2:8080   ALLOW     no ALLOW policy applies to the workload                               BPF_TCP_CLOSE sent=5 received=7 7000ms
+2024-07-04 20:14:02 +0000 UTC   00000000deadbeef   10.244.0.3:40001   10.244.0.2:8080   DENY      authorization policy default/deny-sleep                               -
+2024-07-04 20:14:09 +0000 UTC   -                  10.244.0.4:40002   10.244.0.2:8080   DENY      all the new connections are denied, the policies are being resynced   -
+`, buf.String())
+}
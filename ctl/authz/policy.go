@@ -0,0 +1,81 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"slices"
+
+	"istio.io/api/security/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+)
+
+// convertPolicy converts an istio AuthorizationPolicy to the policy istiod pushes to kmesh, the same way
+// istiod does for ztunnel. It also returns the HTTP fields of the policy, which cannot be enforced on the
+// connections: the rules of an ALLOW policy with HTTP fields never match, a DENY policy ignores them.
+func convertPolicy(ap *securityclient.AuthorizationPolicy, rootNamespace string) (*security.Authorization, []string, error) {
+	spec := &ap.Spec
+	if len(policyTargetRefs(spec)) > 0 {
+		points, err := resolveTargetRefs(spec, ap.Namespace, rootNamespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, targetRefsError(points)
+	}
+
+	scope := security.Scope_WORKLOAD_SELECTOR
+	if spec.GetSelector() == nil {
+		scope = security.Scope_NAMESPACE
+		if ap.Namespace == rootNamespace {
+			scope = security.Scope_GLOBAL
+		}
+	}
+	var action security.Action
+	switch spec.GetAction() {
+	case v1beta1.AuthorizationPolicy_ALLOW:
+		action = security.Action_ALLOW
+	case v1beta1.AuthorizationPolicy_DENY:
+		action = security.Action_DENY
+	default:
+		return nil, nil, fmt.Errorf("the %s action is not supported by kmesh", spec.GetAction())
+	}
+
+	policy := &security.Authorization{
+		Name:      ap.Name,
+		Namespace: ap.Namespace,
+		Scope:     scope,
+		Action:    action,
+	}
+	var httpFields []string
+	for _, rule := range spec.GetRules() {
+		clauses, fields := auth.ConvertRule(rule)
+		for _, field := range fields {
+			if !slices.Contains(httpFields, field) {
+				httpFields = append(httpFields, field)
+			}
+		}
+		// an ALLOW rule with HTTP fields never matches
+		if action == security.Action_ALLOW && len(fields) > 0 {
+			continue
+		}
+		policy.Rules = append(policy.Rules, &security.Rule{Clauses: clauses})
+	}
+	return policy, httpFields, nil
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/yaml"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+const pollInterval = time.Second
+
+var (
+	policyFile    string
+	expect        string
+	dryRun        bool
+	rootNamespace string
+	waitTimeout   time.Duration
+)
+
+// testVerdict is the result of kmeshctl authz test
+type testVerdict struct {
+	Policy   string `json:"policy"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	DryRun   bool   `json:"dryRun"`
+	Expected string `json:"expected"`
+	Observed string `json:"observed"`
+	Reason   string `json:"reason"`
+	// DecidingPolicy is the policy deciding the observed verdict, empty if no policy matched
+	DecidingPolicy string `json:"decidingPolicy,omitempty"`
+	Pass           bool   `json:"pass"`
+}
+
+// NewTestCmd creates a command to apply an authorization policy and check its verdict on a connection.
+func NewTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test <kmesh-daemon-pod> --policy <policy.yaml>",
+		Short: "Apply an authorization policy and check the verdict of a connection against the expected one",
+		Long: `Apply an istio AuthorizationPolicy, wait for the kmesh daemon to load it, then evaluate the
+authorization policies on the connection from --src to --port of the --dst workload and compare the verdict
+with --expect, without sending any traffic. With --dry-run the policy is evaluated as if it were loaded
+instead of being applied. The command exits with an error if the verdict is not the expected one, for CI.
+The daemon should run on the node of the --dst workload. Only dual-engine mode is supported.`,
+		Example: `# Check that the policy denies 10.244.0.5 to connect to port 8080 of the workload 10.244.1.3
+kmeshctl authz test <kmesh-daemon-pod> --policy deny-8080.yaml --src 10.244.0.5 --dst 10.244.1.3 --port 8080 --expect deny
+
+# Evaluate the policy without applying it and print the verdict in json
+kmeshctl authz test <kmesh-daemon-pod> --policy deny-8080.yaml --src 10.244.0.5 --dst 10.244.1.3 --port 8080 --expect deny --dry-run -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runTest(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&policyFile, "policy", "", "file of the istio AuthorizationPolicy")
+	cmd.Flags().StringVar(&src, "src", "", "source ip of the connection")
+	cmd.Flags().StringVar(&dst, "dst", "", "ip of the destination workload")
+	cmd.Flags().Uint32Var(&port, "port", 0, "destination port of the connection")
+	cmd.Flags().StringVar(&expect, "expect", "", "expected verdict, one of: allow, deny")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "evaluate the policy without applying it")
+	cmd.Flags().StringVar(&rootNamespace, "root-namespace", "istio-system", "root namespace of istio, its policies apply to the whole mesh")
+	cmd.Flags().DurationVar(&waitTimeout, "timeout", 30*time.Second, "how long to wait for the daemon to load the applied policy")
+	utils.AddOutputFlag(cmd, &output)
+	for _, flag := range []string{"policy", "src", "dst", "port", "expect"} {
+		_ = cmd.MarkFlagRequired(flag)
+	}
+	return cmd
+}
+
+func runTest(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	expected := strings.ToUpper(expect)
+	if expected != "ALLOW" && expected != "DENY" {
+		return fmt.Errorf("invalid --expect %q, must be allow or deny", expect)
+	}
+	dstAddr, err := netip.ParseAddr(dst)
+	if err != nil {
+		return fmt.Errorf("invalid --dst: %w", err)
+	}
+	if _, err := netip.ParseAddr(src); err != nil {
+		return fmt.Errorf("invalid --src: %w", err)
+	}
+	if port == 0 || port > 65535 {
+		return fmt.Errorf("invalid --port %d", port)
+	}
+	ap, err := readPolicy(policyFile)
+	if err != nil {
+		return err
+	}
+	candidate, httpFields, err := convertPolicy(ap, rootNamespace)
+	if err != nil {
+		return fmt.Errorf("unsupported policy %s/%s: %w", ap.Namespace, ap.Name, err)
+	}
+	if len(httpFields) > 0 {
+		log.Warnf("kmesh does not enforce the HTTP fields %s of the policy, its ALLOW rules using them never match "+
+			"and its DENY rules ignore them", strings.Join(httpFields, ", "))
+	}
+	candidateJson, err := protojson.Marshal(candidate)
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy: %w", err)
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	ctx := context.Background()
+	selectsDst := true
+	if selector := ap.Spec.GetSelector(); selector != nil {
+		if selectsDst, err = selectsAddress(ctx, cli, ap.Namespace, selector.GetMatchLabels(), dstAddr); err != nil {
+			return err
+		}
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	req := &adminapi.ExplainAuthzRequest{
+		Src:                      src,
+		Dst:                      dst,
+		Port:                     port,
+		PolicyJson:               string(candidateJson),
+		PolicySelectsDestination: selectsDst,
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	want, err := client.ExplainAuthz(reqCtx, req)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to evaluate the policy on pod %s: %w", podName, err)
+	}
+
+	observed := want
+	if !dryRun {
+		if err := applyPolicy(ctx, cli, ap); err != nil {
+			return err
+		}
+		loaded := &adminapi.ExplainAuthzRequest{Src: src, Dst: dst, Port: port}
+		if observed, err = waitVerdict(ctx, client.ExplainAuthz, loaded, want, waitTimeout); err != nil {
+			return fmt.Errorf("policy %s/%s applied, but %w", ap.Namespace, ap.Name, err)
+		}
+	}
+
+	verdict := newTestVerdict(ap, expected, observed)
+	err = utils.PrintOutput(w, output, verdict, func() error {
+		fmt.Fprint(w, formatTestVerdict(verdict))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !verdict.Pass {
+		return fmt.Errorf("the connection is %s, expected %s", verdictOf(observed), expected)
+	}
+	return nil
+}
+
+// readPolicy reads an AuthorizationPolicy, in the default namespace if it sets none
+func readPolicy(file string) (*securityclient.AuthorizationPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+	ap := &securityclient.AuthorizationPolicy{}
+	if err := yaml.Unmarshal(data, ap); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", file, err)
+	}
+	if ap.Kind != "" && ap.Kind != "AuthorizationPolicy" {
+		return nil, fmt.Errorf("%s is a %s, not an AuthorizationPolicy", file, ap.Kind)
+	}
+	if ap.Name == "" {
+		return nil, fmt.Errorf("policy %s has no name", file)
+	}
+	if ap.Namespace == "" {
+		ap.Namespace = "default"
+	}
+	return ap, nil
+}
+
+// selectsAddress returns whether the pod with the ip addr in namespace matches the labels
+func selectsAddress(ctx context.Context, cli kube.CLIClient, namespace string, matchLabels map[string]string, addr netip.Addr) (bool, error) {
+	pods, err := cli.Kube().CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(matchLabels).String(),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list the pods selected by the policy: %w", err)
+	}
+	for _, pod := range pods.Items {
+		for _, podIP := range pod.Status.PodIPs {
+			if ip, err := netip.ParseAddr(podIP.IP); err == nil && ip == addr {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func applyPolicy(ctx context.Context, cli kube.CLIClient, ap *securityclient.AuthorizationPolicy) error {
+	apc := cli.Istio().SecurityV1().AuthorizationPolicies(ap.Namespace)
+	existing, err := apc.Get(ctx, ap.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		ap.ResourceVersion = ""
+		_, err = apc.Create(ctx, ap, metav1.CreateOptions{FieldManager: "kmeshctl"})
+	} else if err == nil {
+		ap.ResourceVersion = existing.ResourceVersion
+		_, err = apc.Update(ctx, ap, metav1.UpdateOptions{FieldManager: "kmeshctl"})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply policy %s/%s: %w", ap.Namespace, ap.Name, err)
+	}
+	return nil
+}
+
+// waitVerdict evaluates the loaded policies until their verdict is the one evaluated with the applied
+// policy, the daemon has then loaded it. It returns at once if the policy does not change the verdict.
+func waitVerdict(ctx context.Context, explain explainFunc, req *adminapi.ExplainAuthzRequest,
+	want *adminapi.AuthzExplanation, timeout time.Duration) (*adminapi.AuthzExplanation, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		resp, err := explain(ctx, req)
+		if err == nil && resp.GetAllowed() == want.GetAllowed() && resp.GetPolicy() == want.GetPolicy() {
+			return resp, nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate the loaded policies: %w", err)
+			}
+			return nil, fmt.Errorf("the daemon has not loaded it within %v", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+func newTestVerdict(ap *securityclient.AuthorizationPolicy, expected string, observed *adminapi.AuthzExplanation) *testVerdict {
+	return &testVerdict{
+		Policy:         ap.Namespace + "/" + ap.Name,
+		Src:            src,
+		Dst:            netip.AddrPortFrom(netip.MustParseAddr(dst), uint16(port)).String(),
+		DryRun:         dryRun,
+		Expected:       expected,
+		Observed:       verdictOf(observed),
+		Reason:         observed.GetReason(),
+		DecidingPolicy: observed.GetPolicy(),
+		Pass:           verdictOf(observed) == expected,
+	}
+}
+
+// formatTestVerdict prints the expected and the observed verdicts
+func formatTestVerdict(v *testVerdict) string {
+	var sb strings.Builder
+	result := "FAIL"
+	if v.Pass {
+		result = "PASS"
+	}
+	mode := "applied"
+	if v.DryRun {
+		mode = "dry-run"
+	}
+	fmt.Fprintf(&sb, "Result:      %s\n", result)
+	fmt.Fprintf(&sb, "Policy:      %s (%s)\n", v.Policy, mode)
+	fmt.Fprintf(&sb, "Connection:  %s -> %s\n", v.Src, v.Dst)
+	fmt.Fprintf(&sb, "Expected:    %s\n", v.Expected)
+	fmt.Fprintf(&sb, "Observed:    %s\n", v.Observed)
+	fmt.Fprintf(&sb, "Reason:      %s%s\n", v.Reason, optional(v.DecidingPolicy))
+	return sb.String()
+}
+
+func verdictOf(resp *adminapi.AuthzExplanation) string {
+	if resp.GetAllowed() {
+		return "ALLOW"
+	}
+	return "DENY"
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+const denyPolicy = `apiVersion: security.istio.io/v1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-sleep
+spec:
+  action: DENY
+  selector:
+    matchLabels:
+      app: httpbin
+  rules:
+  - from:
+    - source:
+        principals: ["cluster.local/ns/default/sa/sleep", "*"]
+        notIpBlocks: ["10.244.0.0/16"]
+    to:
+    - operation:
+        ports: ["8080"]
+        methods: ["GET"]
+    when:
+    - key: destination.ip
+      values: ["10.244.1.3"]
+`
+
+func writePolicy(t *testing.T, policy string) string {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(policy), 0o600))
+	return file
+}
+
+func TestConvertPolicy(t *testing.T) {
+	ap, err := readPolicy(writePolicy(t, denyPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, "default", ap.Namespace)
+
+	policy, httpFields, err := convertPolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"methods"}, httpFields)
+	// the DENY rule is enforced without its HTTP fields
+	want := &security.Authorization{
+		Name:      "deny-sleep",
+		Namespace: "default",
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{
+			Clauses: []*security.Clause{
+				{Matches: []*security.Match{{DestinationPorts: []uint32{8080}}}},
+				{Matches: []*security.Match{{
+					Principals: []*security.StringMatch{
+						{MatchType: &security.StringMatch_Exact{Exact: "cluster.local/ns/default/sa/sleep"}},
+						{},
+					},
+					NotSourceIps: []*security.Address{{Address: []byte{10, 244, 0, 0}, Length: 16}},
+				}}},
+				{Matches: []*security.Match{{
+					DestinationIps: []*security.Address{{Address: []byte{10, 244, 1, 3}, Length: 32}},
+				}}},
+			},
+		}},
+	}
+	assert.True(t, proto.Equal(want, policy), policy.String())
+
+	// the ALLOW rule with HTTP fields never matches
+	ap.Spec.Action = 0
+	policy, _, err = convertPolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.Equal(t, security.Action_ALLOW, policy.GetAction())
+	assert.Empty(t, policy.GetRules())
+
+	ap.Spec.Selector = nil
+	ap.Namespace = "istio-system"
+	policy, _, err = convertPolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.Equal(t, security.Scope_GLOBAL, policy.GetScope())
+
+	ap.Spec.Action = 3 // AUDIT
+	_, _, err = convertPolicy(ap, "istio-system")
+	assert.Error(t, err)
+}
+
+func TestReadPolicy(t *testing.T) {
+	_, err := readPolicy(writePolicy(t, "kind: PeerAuthentication\nmetadata:\n  name: strict\n"))
+	assert.ErrorContains(t, err, "not an AuthorizationPolicy")
+	_, err = readPolicy(writePolicy(t, "kind: AuthorizationPolicy\n"))
+	assert.ErrorContains(t, err, "has no name")
+	_, err = readPolicy(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestWaitVerdict(t *testing.T) {
+	want := &adminapi.AuthzExplanation{Reason: "a rule of the DENY policy matched", Policy: "default/deny-sleep"}
+	// the daemon loads the policy at the third evaluation
+	calls := 0
+	explain := func(ctx context.Context, req *adminapi.ExplainAuthzRequest, opts ...grpc.CallOption) (*adminapi.AuthzExplanation, error) {
+		calls++
+		if calls < 3 {
+			return &adminapi.AuthzExplanation{Allowed: true, Reason: "no ALLOW policy applies to the destination workload"}, nil
+		}
+		return want, nil
+	}
+	got, err := waitVerdict(context.Background(), explain, &adminapi.ExplainAuthzRequest{}, want, 10*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	_, err = waitVerdict(context.Background(), explain, &adminapi.ExplainAuthzRequest{}, want, 10*time.Millisecond)
+	assert.ErrorContains(t, err, "has not loaded it")
+}
+
+func TestFormatTestVerdict(t *testing.T) {
+	src, dst, port, dryRun = "10.244.0.5", "10.244.1.3", 8080, true
+	ap, err := readPolicy(writePolicy(t, denyPolicy))
+	require.NoError(t, err)
+
+	verdict := newTestVerdict(ap, "ALLOW", &adminapi.AuthzExplanation{
+		Reason: "a rule of the DENY policy matched",
+		Policy: "default/deny-sleep",
+	})
+	assert.False(t, verdict.Pass)
+	assert.Equal(t, `Result:      FAIL
+Policy:      default/deny-sleep (dry-run)
+Connection:  10.244.0.5 -> 10.244.1.3:8080
+Expected:    ALLOW
+Observed:    DENY
+Reason:      a rule of the DENY policy matched (default/deny-sleep)
+`, formatTestVerdict(verdict))
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/controller/trace"
+)
+
+var from string
+
+// decision is a captured authorization verdict of the connections from Src to Dst
+type decision struct {
+	Src     netip.Addr     `json:"src"`
+	Dst     netip.AddrPort `json:"dst"`
+	Verdict string         `json:"verdict"`
+	// Count is the number of captured connections with the verdict
+	Count int `json:"count"`
+}
+
+// verdictChange is a captured decision whose verdict changed with the current policies
+type verdictChange struct {
+	decision
+	NewVerdict string `json:"newVerdict"`
+	Reason     string `json:"reason"`
+	// Policy is the policy deciding the new verdict, empty if no policy matched
+	Policy string `json:"policy,omitempty"`
+}
+
+type explainFunc func(ctx context.Context, req *adminapi.ExplainAuthzRequest, opts ...grpc.CallOption) (*adminapi.AuthzExplanation, error)
+
+// NewReplayCmd creates a command to replay captured authorization decisions against the current policies.
+func NewReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <kmesh-daemon-pod> --from <bundle.ndjson>",
+		Short: "Replay captured authorization decisions and report the verdicts changed by the current policies",
+		Long: `Evaluate the authorization policies loaded by a kmesh daemon on the connections of a bundle of
+captured decisions and print the ones whose verdict changed, without sending any traffic. The bundle is
+the output of kmeshctl trace -o json, only its policy events are replayed. The evaluation is the same as
+the userspace authorization of the data plane. Only dual-engine mode is supported.`,
+		Example: `# Capture the decisions on the traffic to httpbin, edit the policies, then replay them
+kmeshctl trace <kmesh-daemon-pod> --dst httpbin --timeout 10m -o json > bundle.ndjson
+kmeshctl authz replay <kmesh-daemon-pod> --from bundle.ndjson
+
+# Print the changed verdicts in json
+kmeshctl authz replay <kmesh-daemon-pod> --from bundle.ndjson -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runReplay(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&from, "from", "", "bundle of captured decisions, in the json output format of kmeshctl trace")
+	utils.AddOutputFlag(cmd, &output)
+	_ = cmd.MarkFlagRequired("from")
+	return cmd
+}
+
+func runReplay(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	f, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer f.Close()
+	decisions, err := readDecisions(f)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle %s: %w", from, err)
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	changes, err := replay(context.Background(), client.ExplainAuthz, decisions)
+	if err != nil {
+		return fmt.Errorf("failed to replay on pod %s: %w", podName, err)
+	}
+	return utils.PrintOutput(w, output, changes, func() error {
+		printChanges(w, decisions, changes)
+		return nil
+	})
+}
+
+// readDecisions reads the policy events of a trace, the decisions on the same connection
+// tuple with the same verdict are merged
+func readDecisions(r io.Reader) ([]*decision, error) {
+	var decisions []*decision
+	seen := make(map[decision]*decision)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var ev trace.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Type != trace.EventTypePolicy {
+			continue
+		}
+		src, err := netip.ParseAddr(ev.Source)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid source: %w", line, err)
+		}
+		dst, err := netip.ParseAddrPort(ev.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid destination: %w", line, err)
+		}
+		if ev.Verdict != "ALLOW" && ev.Verdict != "DENY" {
+			return nil, fmt.Errorf("line %d: invalid verdict %q", line, ev.Verdict)
+		}
+
+		key := decision{Src: src, Dst: dst, Verdict: ev.Verdict}
+		if d, ok := seen[key]; ok {
+			d.Count++
+			continue
+		}
+		d := &decision{Src: src, Dst: dst, Verdict: ev.Verdict, Count: 1}
+		seen[key] = d
+		decisions = append(decisions, d)
+	}
+	return decisions, scanner.Err()
+}
+
+// replay evaluates the current policies on the connections of the decisions and returns the changed verdicts
+func replay(ctx context.Context, explain explainFunc, decisions []*decision) ([]verdictChange, error) {
+	changes := []verdictChange{}
+	for _, d := range decisions {
+		reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+		resp, err := explain(reqCtx, &adminapi.ExplainAuthzRequest{
+			Src:  d.Src.String(),
+			Dst:  d.Dst.Addr().String(),
+			Port: uint32(d.Dst.Port()),
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to explain %s -> %s: %w", d.Src, d.Dst, err)
+		}
+		verdict := "DENY"
+		if resp.GetAllowed() {
+			verdict = "ALLOW"
+		}
+		if verdict != d.Verdict {
+			changes = append(changes, verdictChange{decision: *d, NewVerdict: verdict, Reason: resp.GetReason(), Policy: resp.GetPolicy()})
+		}
+	}
+	return changes, nil
+}
+
+// printChanges prints the changed verdicts as a diff of the old and new ones
+func printChanges(w io.Writer, decisions []*decision, changes []verdictChange) {
+	connections := 0
+	for _, d := range decisions {
+		connections += d.Count
+	}
+	for _, c := range changes {
+		fmt.Fprintf(w, "- %-5s %s -> %s (%d connections)\n", c.Verdict, c.Src, c.Dst, c.Count)
+		fmt.Fprintf(w, "+ %-5s %s -> %s: %s%s\n", c.NewVerdict, c.Src, c.Dst, c.Reason, optional(c.Policy))
+	}
+	fmt.Fprintf(w, "%d of the %d replayed connection tuples (%d connections) changed verdict\n", len(changes), len(decisions), connections)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+const bundle = `{"time":"2024-01-01T00:00:00Z","type":"policy","source":"10.244.0.5","destination":"10.244.1.3:8080","verdict":"ALLOW","reason":"no policy matched"}
+{"time":"2024-01-01T00:00:01Z","type":"connection","source":"10.244.0.5:40000","destination":"10.244.1.3:8080","state":"TCP_ESTABLISHED"}
+{"time":"2024-01-01T00:00:02Z","type":"policy","source":"10.244.0.5","destination":"10.244.1.3:8080","verdict":"ALLOW","reason":"no policy matched"}
+
+{"time":"2024-01-01T00:00:03Z","type":"policy","source":"10.244.0.6","destination":"10.244.1.3:9090","verdict":"DENY","reason":"a rule of the DENY policy matched"}
+`
+
+func TestReadDecisions(t *testing.T) {
+	decisions, err := readDecisions(strings.NewReader(bundle))
+	require.NoError(t, err)
+	assert.Equal(t, []*decision{
+		{Src: netip.MustParseAddr("10.244.0.5"), Dst: netip.MustParseAddrPort("10.244.1.3:8080"), Verdict: "ALLOW", Count: 2},
+		{Src: netip.MustParseAddr("10.244.0.6"), Dst: netip.MustParseAddrPort("10.244.1.3:9090"), Verdict: "DENY", Count: 1},
+	}, decisions)
+
+	_, err = readDecisions(strings.NewReader(`{"type":"policy","source":"10.244.0.5","destination":"10.244.1.3","verdict":"ALLOW"}`))
+	assert.ErrorContains(t, err, "line 1: invalid destination")
+	_, err = readDecisions(strings.NewReader("not json"))
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestReplay(t *testing.T) {
+	decisions, err := readDecisions(strings.NewReader(bundle))
+	require.NoError(t, err)
+
+	// the current policies deny the traffic to port 8080 only
+	explain := func(ctx context.Context, req *adminapi.ExplainAuthzRequest, opts ...grpc.CallOption) (*adminapi.AuthzExplanation, error) {
+		if req.Port == 8080 {
+			return &adminapi.AuthzExplanation{Reason: "a rule of the DENY policy matched", Policy: "default/deny-8080"}, nil
+		}
+		return &adminapi.AuthzExplanation{Allowed: true, Reason: "no policy matched"}, nil
+	}
+	changes, err := replay(context.Background(), explain, decisions)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "DENY", changes[0].NewVerdict)
+	assert.Equal(t, "default/deny-8080", changes[0].Policy)
+	assert.Equal(t, "ALLOW", changes[1].NewVerdict)
+
+	var buf bytes.Buffer
+	printChanges(&buf, decisions, changes)
+	assert.Equal(t, `- ALLOW 10.244.0.5 -> 10.244.1.3:8080 (2 connections)
++ DENY  10.244.0.5 -> 10.244.1.3:8080: a rule of the DENY policy matched (default/deny-8080)
+- DENY  10.244.0.6 -> 10.244.1.3:9090 (1 connections)
++ ALLOW 10.244.0.6 -> 10.244.1.3:9090: no policy matched
+2 of the 2 replayed connection tuples (3 connections) changed verdict
+`, buf.String())
+}
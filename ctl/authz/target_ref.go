@@ -0,0 +1,94 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"fmt"
+	"strings"
+
+	"istio.io/api/security/v1beta1"
+	typev1beta1 "istio.io/api/type/v1beta1"
+	"istio.io/istio/pkg/config/constants"
+)
+
+// the groups of the kinds a policy can be attached to with targetRefs
+const (
+	gatewayGroup    = "gateway.networking.k8s.io"
+	networkingGroup = "networking.istio.io"
+)
+
+// policyTargetRefs returns the targetRefs of the policy, including the deprecated targetRef
+func policyTargetRefs(spec *v1beta1.AuthorizationPolicy) []*typev1beta1.PolicyTargetReference {
+	refs := spec.GetTargetRefs()
+	if ref := spec.GetTargetRef(); ref != nil {
+		refs = append([]*typev1beta1.PolicyTargetReference{ref}, refs...)
+	}
+	return refs
+}
+
+// resolveTargetRef returns the enforcement point of a policy of namespace attached with ref. Like istiod,
+// the policies attached to a Gateway are enforced by that waypoint, the ones attached to a Service or a
+// ServiceEntry by the waypoint the service uses, and the ones of the root namespace attached to the
+// istio-waypoint GatewayClass by all the waypoints. kmesh only enforces the policies selecting workloads.
+func resolveTargetRef(ref *typev1beta1.PolicyTargetReference, namespace, rootNamespace string) (string, error) {
+	if ref.GetNamespace() != "" && ref.GetNamespace() != namespace {
+		return "", fmt.Errorf("the targetRef %s %s is in namespace %s, it must be in the namespace of the policy %s",
+			ref.GetKind(), ref.GetName(), ref.GetNamespace(), namespace)
+	}
+	name := namespace + "/" + ref.GetName()
+	switch {
+	case ref.GetGroup() == gatewayGroup && ref.GetKind() == "Gateway":
+		return "waypoint " + name, nil
+	case ref.GetGroup() == gatewayGroup && ref.GetKind() == "GatewayClass":
+		if ref.GetName() != constants.WaypointGatewayClassName {
+			return "", fmt.Errorf("the targetRef GatewayClass %s is not supported, only %s is", ref.GetName(), constants.WaypointGatewayClassName)
+		}
+		if namespace != rootNamespace {
+			return "", fmt.Errorf("the targetRef GatewayClass %s only applies to the policies of the root namespace %s",
+				ref.GetName(), rootNamespace)
+		}
+		return "all the waypoints", nil
+	case (ref.GetGroup() == "" || ref.GetGroup() == "core") && ref.GetKind() == "Service":
+		return "the waypoint of service " + name, nil
+	case ref.GetGroup() == networkingGroup && ref.GetKind() == "ServiceEntry":
+		return "the waypoint of service entry " + name, nil
+	}
+	group := ref.GetGroup()
+	if group == "" {
+		group = "core"
+	}
+	return "", fmt.Errorf("the targetRef kind %s of group %s is not supported", ref.GetKind(), group)
+}
+
+// resolveTargetRefs returns the enforcement points of the policy attached with targetRefs, none if it selects workloads
+func resolveTargetRefs(spec *v1beta1.AuthorizationPolicy, namespace, rootNamespace string) ([]string, error) {
+	var points []string
+	for _, ref := range policyTargetRefs(spec) {
+		point, err := resolveTargetRef(ref, namespace, rootNamespace)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// targetRefsError is the error of the commands evaluating the policies kmesh enforces on a policy attached
+// to the enforcement points with targetRefs
+func targetRefsError(points []string) error {
+	return fmt.Errorf("the policy has targetRefs, it is enforced by %s, not by kmesh", strings.Join(points, ", "))
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authz
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	typev1beta1 "istio.io/api/type/v1beta1"
+)
+
+const waypointPolicy = `apiVersion: security.istio.io/v1
+kind: AuthorizationPolicy
+metadata:
+  name: waypoint-deny
+  namespace: sample
+spec:
+  targetRefs:
+  - kind: Gateway
+    group: gateway.networking.k8s.io
+    name: waypoint
+  action: DENY
+  rules:
+  - to:
+    - operation:
+        ports: ["8080"]
+  - to:
+    - operation:
+        methods: ["DELETE"]
+`
+
+func TestResolveTargetRef(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       *typev1beta1.PolicyTargetReference
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "waypoint",
+			ref:       &typev1beta1.PolicyTargetReference{Group: gatewayGroup, Kind: "Gateway", Name: "waypoint"},
+			namespace: "sample",
+			want:      "waypoint sample/waypoint",
+		},
+		{
+			name:      "service",
+			ref:       &typev1beta1.PolicyTargetReference{Kind: "Service", Name: "httpbin"},
+			namespace: "sample",
+			want:      "the waypoint of service sample/httpbin",
+		},
+		{
+			name:      "service entry",
+			ref:       &typev1beta1.PolicyTargetReference{Group: networkingGroup, Kind: "ServiceEntry", Name: "external"},
+			namespace: "sample",
+			want:      "the waypoint of service entry sample/external",
+		},
+		{
+			name:      "all the waypoints",
+			ref:       &typev1beta1.PolicyTargetReference{Group: gatewayGroup, Kind: "GatewayClass", Name: "istio-waypoint"},
+			namespace: "istio-system",
+			want:      "all the waypoints",
+		},
+		{
+			name:      "gateway class out of the root namespace",
+			ref:       &typev1beta1.PolicyTargetReference{Group: gatewayGroup, Kind: "GatewayClass", Name: "istio-waypoint"},
+			namespace: "sample",
+			wantErr:   true,
+		},
+		{
+			name:      "other gateway class",
+			ref:       &typev1beta1.PolicyTargetReference{Group: gatewayGroup, Kind: "GatewayClass", Name: "istio"},
+			namespace: "istio-system",
+			wantErr:   true,
+		},
+		{
+			name:      "other namespace",
+			ref:       &typev1beta1.PolicyTargetReference{Group: gatewayGroup, Kind: "Gateway", Name: "waypoint", Namespace: "other"},
+			namespace: "sample",
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported kind",
+			ref:       &typev1beta1.PolicyTargetReference{Kind: "Pod", Name: "httpbin"},
+			namespace: "sample",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveTargetRef(tt.ref, tt.namespace, "istio-system")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWaypointPolicy(t *testing.T) {
+	ap, err := readPolicy(writePolicy(t, waypointPolicy))
+	require.NoError(t, err)
+
+	// all the rules are enforced by the waypoint, the L4 ones included
+	analysis, err := analyzePolicy(ap, "istio-system")
+	require.NoError(t, err)
+	assert.Equal(t, &policyAnalysis{
+		Policy:     "sample/waypoint-deny",
+		Action:     "DENY",
+		EnforcedAt: []string{"waypoint sample/waypoint"},
+		Reasons:    []string{"the policy has targetRefs, only the waypoints it is attached to enforce it, not kmesh"},
+		Rules: []ruleAnalysis{
+			{Rule: 0, EnforcedBy: enforcedByWaypoint, Reasons: []string{"enforced by waypoint sample/waypoint"}},
+			{Rule: 1, EnforcedBy: enforcedByWaypoint, Reasons: []string{"enforced by waypoint sample/waypoint"}},
+		},
+	}, analysis)
+
+	var out bytes.Buffer
+	_, _ = out.WriteString(formatAnalysis(analysis))
+	assert.Equal(t, `Policy:      sample/waypoint-deny (DENY)
+Offloads:    no
+Enforced at: waypoint sample/waypoint
+Reason:      the policy has targetRefs, only the waypoints it is attached to enforce it, not kmesh
+
+RULE  ENFORCED BY  OFFLOADS  REASONS
+0     waypoint     no        enforced by waypoint sample/waypoint
+1     waypoint     no        enforced by waypoint sample/waypoint
+`, out.String())
+
+	// kmesh does not enforce it at the workloads
+	_, _, err = convertPolicy(ap, "istio-system")
+	assert.EqualError(t, err, "the policy has targetRefs, it is enforced by waypoint sample/waypoint, not by kmesh")
+}
@@ -0,0 +1,228 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpftrace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const (
+	tracePipePath = "/sys/kernel/debug/tracing/trace_pipe"
+	// bpfLoggerName is the logger of the kmesh daemon controlling the log level of the bpf programs
+	bpfLoggerName = "bpf"
+
+	requestTimeout = 10 * time.Second
+)
+
+var log = logger.NewLoggerScope("kmeshctl/bpftrace")
+
+var (
+	level  string
+	module string
+	output string
+)
+
+var (
+	// traceLineRegexp matches a line of the trace pipe printed by bpf_trace_printk, e.g.
+	//   curl-12345   [002] d..31 98765.432100: bpf_trace_printk: [KMESH] DEBUG: origin dst 10.0.0.1:80
+	// the tgid and the flags columns depend on the kernel and the tracing options
+	traceLineRegexp = regexp.MustCompile(`^\s*(.+)-(\d+)\s+(?:\(\s*[-\d]+\)\s+)?\[(\d+)\]\s+(?:\S+\s+)?(\d+\.\d+):\s+bpf_trace_printk:\s?(.*)$`)
+	// kmeshMessageRegexp matches a message printed by BPF_LOG of the kmesh bpf programs
+	kmeshMessageRegexp = regexp.MustCompile(`^\[([A-Za-z_]+)\] (ERR|WARN|INFO|DEBUG): (.*)$`)
+)
+
+// Entry is a message printed to the trace pipe by a kmesh bpf program
+type Entry struct {
+	Timestamp string `json:"timestamp"`
+	Task      string `json:"task"`
+	Pid       int    `json:"pid"`
+	Cpu       int    `json:"cpu"`
+	Module    string `json:"module"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bpf-trace <kmesh-daemon-pod>",
+		Short: "Tail the messages printed to the bpf trace pipe by the kmesh bpf programs",
+		Long: `Tail the kernel's bpf trace pipe on the node of a kmesh daemon and print the messages of the
+kmesh bpf programs readably, the output of the other bpf programs is skipped. The log level of
+the kmesh bpf programs is raised to --level while tracing and restored on exit.
+
+The bpf programs print to the trace pipe on kernels older than 5.13, newer kernels send the
+messages to the kmesh daemon which logs them, see kubectl logs.`,
+		Example: `# Tail the debug messages of the kmesh bpf programs
+kmeshctl bpf-trace <kmesh-daemon-pod>
+
+# Tail the warnings of the sockops program only
+kmeshctl bpf-trace <kmesh-daemon-pod> --level warn --module SOCKOPS
+
+# Print the messages in json, one per line
+kmeshctl bpf-trace <kmesh-daemon-pod> -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runBpfTrace(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&level, "level", "debug", "log level of the kmesh bpf programs while tracing, one of: error, warn, info, debug")
+	cmd.Flags().StringVar(&module, "module", "", "only print the messages of this module of the bpf programs, e.g. KMESH, empty prints all")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runBpfTrace(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	previous, err := setBpfLogLevel(client, level)
+	if err != nil {
+		return err
+	}
+	// the messages of the bpf programs cost on the hot path, never leave them raised
+	defer func() {
+		if _, err := setBpfLogLevel(client, previous); err != nil {
+			log.Errorf("failed to restore the bpf log level %s: %v", previous, err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	go func() {
+		err := cli.PodExec(ctx, podName, utils.KmeshNamespace, "", []string{"cat", tracePipePath}, pw, &stderr)
+		if err != nil && stderr.Len() > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		_ = pw.CloseWithError(err)
+	}()
+
+	fmt.Fprintf(os.Stderr, "tailing %s on %s with bpf log level %s, press Ctrl+C to stop\n", tracePipePath, podName, level)
+	err = StreamTrace(pr, w, module, output == utils.OutputJson)
+	// Ctrl+C is the way to stop tailing, not a failure
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the trace pipe of pod %s/%s: %w", utils.KmeshNamespace, podName, err)
+	}
+	return nil
+}
+
+// setBpfLogLevel sets the log level of the kmesh bpf programs and returns the previous one
+func setBpfLogLevel(client adminapi.KmeshAdminClient, level string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	previous, err := client.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: bpfLoggerName})
+	if err != nil {
+		return "", fmt.Errorf("failed to get bpf log level: %w", err)
+	}
+	if previous.GetLevel() == level {
+		return level, nil
+	}
+	if _, err := client.SetLoggerLevel(ctx, &adminapi.LoggerLevel{Name: bpfLoggerName, Level: level}); err != nil {
+		return "", fmt.Errorf("failed to set bpf log level: %w", err)
+	}
+	return previous.GetLevel(), nil
+}
+
+// StreamTrace reads the trace pipe from r until it is closed and writes the messages of the kmesh
+// bpf programs to w, those of module only if it is not empty, one per line formatted or in json
+func StreamTrace(r io.Reader, w io.Writer, module string, asJson bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entry, ok := ParseTraceLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if module != "" && !strings.EqualFold(entry.Module, module) {
+			continue
+		}
+		if asJson {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("failed to marshal trace entry: %w", err)
+			}
+			fmt.Fprintln(w, string(data))
+			continue
+		}
+		fmt.Fprintln(w, formatEntry(entry))
+	}
+	return scanner.Err()
+}
+
+// ParseTraceLine parses a line of the trace pipe, it returns false if the line is not printed by BPF_LOG
+func ParseTraceLine(line string) (*Entry, bool) {
+	match := traceLineRegexp.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+	if match == nil {
+		return nil, false
+	}
+	msg := kmeshMessageRegexp.FindStringSubmatch(strings.TrimSpace(match[5]))
+	if msg == nil {
+		return nil, false
+	}
+	pid, _ := strconv.Atoi(match[2])
+	cpu, _ := strconv.Atoi(match[3])
+	return &Entry{
+		Timestamp: match[4],
+		Task:      strings.TrimSpace(match[1]),
+		Pid:       pid,
+		Cpu:       cpu,
+		Module:    msg[1],
+		Level:     msg[2],
+		Message:   strings.TrimSpace(msg[3]),
+	}, true
+}
+
+// formatEntry prints an entry in a single human readable line
+func formatEntry(e *Entry) string {
+	return fmt.Sprintf("%s %-5s %-10s %s comm=%s pid=%d cpu=%d", e.Timestamp, e.Level, "["+e.Module+"]",
+		e.Message, e.Task, e.Pid, e.Cpu)
+}
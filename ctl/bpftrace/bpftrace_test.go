@@ -0,0 +1,119 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpftrace
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const syntheticTrace = `           <...>-12345   [002] d..31 98765.432100: bpf_trace_printk: [KMESH] DEBUG: origin dst 10.0.0.1:80
+   kworker/u8:2-301     [000] ....  98765.500000: bpf_trace_printk: hello from another program
+            curl-2345    (   2345) [001] d.s1 98766.000001: bpf_trace_printk: [SOCKOPS] WARN: auth ip tuple failed, ret:-2
+
+ some garbage which is not a trace line
+   sleep-77 [003] 98767.250000: bpf_trace_printk: [AUTH] ERR: map update failed
+`
+
+// lineWriter hands over each line written by StreamTrace as soon as it is written
+type lineWriter chan string
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w <- line
+	}
+	return len(p), nil
+}
+
+func TestStreamTrace(t *testing.T) {
+	t.Run("streams the kmesh messages formatted as they are printed", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		lines := make(lineWriter, 10)
+		done := make(chan error, 1)
+		go func() {
+			done <- StreamTrace(pr, lines, "", false)
+		}()
+
+		expected := []string{
+			"98765.432100 DEBUG [KMESH]    origin dst 10.0.0.1:80 comm=<...> pid=12345 cpu=2",
+			"",
+			"98766.000001 WARN  [SOCKOPS]  auth ip tuple failed, ret:-2 comm=curl pid=2345 cpu=1",
+			"",
+			"",
+			"98767.250000 ERR   [AUTH]     map update failed comm=sleep pid=77 cpu=3",
+		}
+		// the trace pipe never ends, each message has to be printed before the next one is read
+		for i, line := range strings.Split(strings.TrimSuffix(syntheticTrace, "\n"), "\n") {
+			_, err := pw.Write([]byte(line + "\n"))
+			require.NoError(t, err)
+			if expected[i] == "" {
+				continue
+			}
+			select {
+			case got := <-lines:
+				assert.Equal(t, expected[i], got)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("line %d was not streamed", i)
+			}
+		}
+		require.NoError(t, pw.Close())
+		require.NoError(t, <-done)
+		assert.Empty(t, lines)
+	})
+
+	t.Run("filters by module case insensitively", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, StreamTrace(strings.NewReader(syntheticTrace), &buf, "sockops", false))
+		assert.Equal(t, "98766.000001 WARN  [SOCKOPS]  auth ip tuple failed, ret:-2 comm=curl pid=2345 cpu=1\n", buf.String())
+	})
+
+	t.Run("prints json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, StreamTrace(strings.NewReader(syntheticTrace), &buf, "AUTH", true))
+		assert.Equal(t, `{"timestamp":"98767.250000","task":"sleep","pid":77,"cpu":3,"module":"AUTH","level":"ERR","message":"map update failed"}`+"\n",
+			buf.String())
+	})
+
+	t.Run("returns the error of the trace pipe", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		_ = pw.CloseWithError(io.ErrUnexpectedEOF)
+		assert.ErrorIs(t, StreamTrace(pr, io.Discard, "", false), io.ErrUnexpectedEOF)
+	})
+}
+
+func TestParseTraceLine(t *testing.T) {
+	entry, ok := ParseTraceLine("  kmesh-daemon-1-4242 [010] d..2. 12.000001: bpf_trace_printk: [BACKEND] INFO: backend 10.244.0.3 selected\n")
+	require.True(t, ok)
+	assert.Equal(t, &Entry{
+		Timestamp: "12.000001",
+		Task:      "kmesh-daemon-1",
+		Pid:       4242,
+		Cpu:       10,
+		Module:    "BACKEND",
+		Level:     "INFO",
+		Message:   "backend 10.244.0.3 selected",
+	}, entry)
+
+	_, ok = ParseTraceLine("  curl-1 [000] 12.000001: bpf_trace_printk: [KMESH] TRACE: not a bpf log level")
+	assert.False(t, ok)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/bpf/preflight"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/check")
+
+var (
+	node   string
+	output string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check that the kernel of a node provides the features Kmesh relies on",
+		Long: `Probe the kernel version, the bpf program types (cgroup/sock_addr, sockops, cgroup_skb, xdp), the bpf
+map types (ringbuf, lpm_trie) and cgroup v2 support, and print a pass/fail report with remediation hints.
+Without --node the kernel kmeshctl runs on is probed, which does not need Kmesh to be installed: run it as root
+on the node before installing Kmesh. With --node the kmesh daemon pod probes the kernel of its node, and
+reports the bpf programs the verifier of that kernel recently rejected with the end of the verifier log.
+The command exits with 6 when a check fails.`,
+		Example: `# Check the kernel of the local node before installing Kmesh
+sudo kmeshctl check
+
+# Check the kernel of the node of a kmesh daemon
+kmeshctl check --node <kmesh-daemon-pod>
+
+# Print the report in json
+kmeshctl check --node <kmesh-daemon-pod> -o json`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			report, err := runCheck()
+			if err != nil {
+				utils.Exit(log, err)
+			}
+			if err := printReport(cmd.OutOrStdout(), report); err != nil {
+				utils.Exit(log, err)
+			}
+			if !report.Passed {
+				utils.Exit(log, utils.NewError(utils.ExitCheckFailed, "the kernel check failed"))
+			}
+		},
+	}
+	cmd.Flags().StringVar(&node, "node", "", "kmesh daemon pod probing the kernel of its node, the local kernel if empty")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runCheck() (*preflight.Report, error) {
+	if err := utils.ValidateOutput(output); err != nil {
+		return nil, err
+	}
+	if node == "" {
+		return preflight.Run(preflight.NewHostProber()), nil
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, node)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.CheckPrerequisites(ctx, &adminapi.CheckPrerequisitesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check prerequisites on pod %s: %w", node, err)
+	}
+	report := &preflight.Report{Passed: resp.GetPassed()}
+	for _, check := range resp.GetChecks() {
+		report.Checks = append(report.Checks, preflight.CheckResult{
+			Name:        check.GetName(),
+			Passed:      check.GetPassed(),
+			Message:     check.GetMessage(),
+			Remediation: check.GetRemediation(),
+		})
+	}
+	return report, nil
+}
+
+func printReport(w io.Writer, report *preflight.Report) error {
+	return utils.PrintOutput(w, output, report, func() error {
+		fmt.Fprint(w, formatReport(report))
+		return nil
+	})
+}
+
+// formatReport prints a line per check, followed by the remediation of the failed ones
+func formatReport(report *preflight.Report) string {
+	var sb strings.Builder
+	for _, check := range report.Checks {
+		result := "PASS"
+		if !check.Passed {
+			result = "FAIL"
+		}
+		// the verifier logs reported by the daemon span several lines
+		message := strings.ReplaceAll(check.Message, "\n", "\n       ")
+		fmt.Fprintf(&sb, "[%s] %s: %s\n", result, check.Name, message)
+		if check.Remediation != "" {
+			fmt.Fprintf(&sb, "       hint: %s\n", check.Remediation)
+		}
+	}
+	if report.Passed {
+		fmt.Fprintf(&sb, "\nAll %d checks passed\n", len(report.Checks))
+	} else {
+		fmt.Fprintf(&sb, "\n%d of %d checks failed\n", report.Failed(), len(report.Checks))
+	}
+	return sb.String()
+}
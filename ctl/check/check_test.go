@@ -0,0 +1,71 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/pkg/bpf/preflight"
+)
+
+func TestFormatReport(t *testing.T) {
+	report := &preflight.Report{
+		Passed: false,
+		Checks: []preflight.CheckResult{
+			{Name: "kernel version", Passed: true, Message: "5.10.0-153.12.0.92.oe2203sp2.x86_64"},
+			{Name: "bpf program xdp", Passed: false, Message: "probe failed: operation not permitted",
+				Remediation: "run the check as root, probing bpf features requires CAP_BPF and CAP_SYS_ADMIN"},
+			{Name: "bpf map ringbuf", Passed: false, Message: "not supported by the kernel", Remediation: "upgrade the kernel to 5.8 or later"},
+			{Name: "cgroup v2", Passed: true, Message: "supported"},
+		},
+	}
+	assert.Equal(t, `[PASS] kernel version: 5.10.0-153.12.0.92.oe2203sp2.x86_64
+[FAIL] bpf program xdp: probe failed: operation not permitted
+       hint: run the check as root, probing bpf features requires CAP_BPF and CAP_SYS_ADMIN
+[FAIL] bpf map ringbuf: not supported by the kernel
+       hint: upgrade the kernel to 5.8 or later
+[PASS] cgroup v2: supported
+
+2 of 4 checks failed
+`, formatReport(report))
+
+	// the verifier log reported by the daemon is indented under the check
+	report = &preflight.Report{
+		Passed: false,
+		Checks: []preflight.CheckResult{{Name: "bpf verifier", Passed: false,
+			Message:     "bpf program cgroup_connect4_prog rejected by the verifier: permission denied: R2 !read_ok\n  0: (95) exit\n  R2 !read_ok",
+			Remediation: "run a supported kernel"}},
+	}
+	assert.Equal(t, `[FAIL] bpf verifier: bpf program cgroup_connect4_prog rejected by the verifier: permission denied: R2 !read_ok
+         0: (95) exit
+         R2 !read_ok
+       hint: run a supported kernel
+
+1 of 1 checks failed
+`, formatReport(report))
+
+	report = &preflight.Report{
+		Passed: true,
+		Checks: []preflight.CheckResult{{Name: "cgroup v2", Passed: true, Message: "supported"}},
+	}
+	assert.Equal(t, `[PASS] cgroup v2: supported
+
+All 1 checks passed
+`, formatReport(report))
+}
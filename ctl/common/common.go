@@ -19,19 +19,46 @@ package common
 import (
 	"github.com/spf13/cobra"
 
+	"kmesh.net/kmesh/ctl/accesslog"
 	"kmesh.net/kmesh/ctl/authz"
+	"kmesh.net/kmesh/ctl/bpftrace"
+	"kmesh.net/kmesh/ctl/check"
+	"kmesh.net/kmesh/ctl/compare"
+	"kmesh.net/kmesh/ctl/conntrack"
 	"kmesh.net/kmesh/ctl/dump"
+	"kmesh.net/kmesh/ctl/endpoints"
+	"kmesh.net/kmesh/ctl/gc"
+	"kmesh.net/kmesh/ctl/locality"
 	logcmd "kmesh.net/kmesh/ctl/log"
+	"kmesh.net/kmesh/ctl/metrics"
 	"kmesh.net/kmesh/ctl/monitoring"
+	"kmesh.net/kmesh/ctl/outliers"
+	"kmesh.net/kmesh/ctl/profile"
+	"kmesh.net/kmesh/ctl/restart"
+	"kmesh.net/kmesh/ctl/resync"
 	"kmesh.net/kmesh/ctl/secret"
+	"kmesh.net/kmesh/ctl/status"
+	"kmesh.net/kmesh/ctl/topology"
+	"kmesh.net/kmesh/ctl/trace"
 	"kmesh.net/kmesh/ctl/version"
 	"kmesh.net/kmesh/ctl/waypoint"
+	"kmesh.net/kmesh/ctl/workloads"
 )
 
 func GetRootCommand() *cobra.Command {
 	rootCmd := &cobra.Command{
-		Use:          "kmeshctl",
-		Short:        "Kmesh command line tools to operate and debug Kmesh",
+		Use:   "kmeshctl",
+		Short: "Kmesh command line tools to operate and debug Kmesh",
+		Long: `Kmesh command line tools to operate and debug Kmesh.
+
+The commands exit with one of the following codes, the failures are logged with their reason:
+  0  success
+  1  error, any other failure
+  2  pod-not-found, the kmesh daemon pod or another kubernetes resource does not exist
+  3  daemon-unreachable, the kmesh daemon does not answer
+  4  permission-denied, the kubernetes api or the kmesh daemon refuses the request
+  5  diverged, kmeshctl compare found the two kmesh daemons diverge
+  6  check-failed, a check of kmeshctl check failed`,
 		SilenceUsage: true,
 		CompletionOptions: cobra.CompletionOptions{
 			DisableDefaultCmd: true,
@@ -45,6 +72,23 @@ func GetRootCommand() *cobra.Command {
 	rootCmd.AddCommand(monitoring.NewCmd())
 	rootCmd.AddCommand(authz.NewCmd())
 	rootCmd.AddCommand(secret.NewCmd())
+	rootCmd.AddCommand(trace.NewCmd())
+	rootCmd.AddCommand(metrics.NewCmd())
+	rootCmd.AddCommand(accesslog.NewCmd())
+	rootCmd.AddCommand(check.NewCmd())
+	rootCmd.AddCommand(restart.NewCmd())
+	rootCmd.AddCommand(endpoints.NewCmd())
+	rootCmd.AddCommand(workloads.NewCmd())
+	rootCmd.AddCommand(profile.NewCmd())
+	rootCmd.AddCommand(locality.NewCmd())
+	rootCmd.AddCommand(status.NewCmd())
+	rootCmd.AddCommand(compare.NewCmd())
+	rootCmd.AddCommand(conntrack.NewCmd())
+	rootCmd.AddCommand(resync.NewCmd())
+	rootCmd.AddCommand(topology.NewCmd())
+	rootCmd.AddCommand(gc.NewCmd())
+	rootCmd.AddCommand(outliers.NewCmd())
+	rootCmd.AddCommand(bpftrace.NewCmd())
 
 	return rootCmd
 }
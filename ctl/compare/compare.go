@@ -0,0 +1,271 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compare
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"istio.io/istio/pkg/util/sets"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/kube"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 30 * time.Second
+
+// the kinds of the compared resources
+const (
+	kindService   = "service"
+	kindEndpoints = "endpoints"
+	kindPolicy    = "policy"
+)
+
+var log = logger.NewLoggerScope("kmeshctl/compare")
+
+var output string
+
+// configDump is the part of the dual-engine config dump of a daemon which is compared
+type configDump struct {
+	Workloads []struct {
+		Uid      string   `json:"uid"`
+		Services []string `json:"services"`
+	} `json:"workloads"`
+	Services []map[string]any `json:"services"`
+	Policies []map[string]any `json:"policies"`
+}
+
+// divergence is a resource the two daemons do not see the same
+type divergence struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// OnlyIn is the pod of the only daemon which has the resource
+	OnlyIn string `json:"onlyIn,omitempty"`
+	// Fields are the fields of the resource which differ
+	Fields []string `json:"fields,omitempty"`
+	// Endpoints are the endpoints of the service only one of the daemons has, by pod
+	Endpoints map[string][]string `json:"endpoints,omitempty"`
+}
+
+type comparison struct {
+	Pods        [2]string    `json:"pods"`
+	Divergences []divergence `json:"divergences"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare <kmesh-daemon-pod> <kmesh-daemon-pod>",
+		Short: "Compare the services, endpoints and authorization policies two kmesh daemons see",
+		Long: `Compare the services, the endpoints of the services and the authorization policies in the config
+dumps of two kmesh daemons, and show the ones only one of them has or they see differently. Every daemon
+receives the same resources from istiod, so a divergence points at a daemon which missed part of an xds
+push. The command exits with 5 when the daemons diverge. Only dual-engine mode is supported.`,
+		Example: `# Compare two kmesh daemons
+kmeshctl compare <kmesh-daemon-pod> <kmesh-daemon-pod>
+
+# Print the divergences in json
+kmeshctl compare <kmesh-daemon-pod> <kmesh-daemon-pod> -o json`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			diverged, err := runCompare(cmd.OutOrStdout(), args[0], args[1])
+			if err != nil {
+				utils.Exit(log, err)
+			}
+			if diverged {
+				utils.Exit(log, utils.NewError(utils.ExitDiverged, "kmesh daemons %s and %s diverge", args[0], args[1]))
+			}
+		},
+	}
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+// runCompare prints the divergences of the daemons of the two pods and reports whether there are any
+func runCompare(w io.Writer, podA, podB string) (bool, error) {
+	if err := utils.ValidateOutput(output); err != nil {
+		return false, err
+	}
+	if podA == podB {
+		return false, fmt.Errorf("the pods to compare are the same")
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return false, fmt.Errorf("failed to create cli client: %w", err)
+	}
+	dumpA, err := getConfigDump(cli, podA)
+	if err != nil {
+		return false, err
+	}
+	dumpB, err := getConfigDump(cli, podB)
+	if err != nil {
+		return false, err
+	}
+	c := comparison{Pods: [2]string{podA, podB}, Divergences: compare(dumpA, dumpB, podA, podB)}
+
+	err = utils.PrintOutput(w, output, c, func() error {
+		return printComparison(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), c)
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(c.Divergences) > 0, nil
+}
+
+func getConfigDump(cli kube.CLIClient, podName string) (*configDump, error) {
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_DUAL_ENGINE})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump the config of pod %s: %w", podName, err)
+	}
+	dump := &configDump{}
+	if err := json.Unmarshal([]byte(resp.GetJson()), dump); err != nil {
+		return nil, fmt.Errorf("failed to parse the config dump of pod %s: %w", podName, err)
+	}
+	return dump, nil
+}
+
+// compare returns the divergences of the two config dumps sorted by kind and name
+func compare(a, b *configDump, podA, podB string) []divergence {
+	var divergences []divergence
+	divergences = append(divergences, compareResources(kindService, keyBy(a.Services, "hostname"), keyBy(b.Services, "hostname"), podA, podB)...)
+	divergences = append(divergences, compareEndpoints(endpointsOf(a), endpointsOf(b), podA, podB)...)
+	divergences = append(divergences, compareResources(kindPolicy, keyBy(a.Policies, "name"), keyBy(b.Policies, "name"), podA, podB)...)
+	return divergences
+}
+
+// keyBy keys the resources by namespace/<field>
+func keyBy(resources []map[string]any, field string) map[string]map[string]any {
+	keyed := make(map[string]map[string]any, len(resources))
+	for _, r := range resources {
+		keyed[fmt.Sprintf("%v/%v", r["namespace"], r[field])] = r
+	}
+	return keyed
+}
+
+func compareResources(kind string, a, b map[string]map[string]any, podA, podB string) []divergence {
+	var divergences []divergence
+	for _, name := range sortedUnion(a, b) {
+		ra, inA := a[name]
+		rb, inB := b[name]
+		switch {
+		case !inB:
+			divergences = append(divergences, divergence{Kind: kind, Name: name, OnlyIn: podA})
+		case !inA:
+			divergences = append(divergences, divergence{Kind: kind, Name: name, OnlyIn: podB})
+		default:
+			var fields []string
+			for _, field := range sortedUnion(ra, rb) {
+				if !reflect.DeepEqual(ra[field], rb[field]) {
+					fields = append(fields, field)
+				}
+			}
+			if len(fields) > 0 {
+				divergences = append(divergences, divergence{Kind: kind, Name: name, Fields: fields})
+			}
+		}
+	}
+	return divergences
+}
+
+// endpointsOf returns the uids of the workloads of each service
+func endpointsOf(dump *configDump) map[string]sets.Set[string] {
+	endpoints := make(map[string]sets.Set[string])
+	for _, workload := range dump.Workloads {
+		for _, service := range workload.Services {
+			if endpoints[service] == nil {
+				endpoints[service] = sets.New[string]()
+			}
+			endpoints[service].Insert(workload.Uid)
+		}
+	}
+	return endpoints
+}
+
+func compareEndpoints(a, b map[string]sets.Set[string], podA, podB string) []divergence {
+	var divergences []divergence
+	for _, service := range sortedUnion(a, b) {
+		onlyInA, onlyInB := a[service].Difference(b[service]), b[service].Difference(a[service])
+		if onlyInA.Len() == 0 && onlyInB.Len() == 0 {
+			continue
+		}
+		d := divergence{Kind: kindEndpoints, Name: service, Endpoints: map[string][]string{}}
+		if onlyInA.Len() > 0 {
+			d.Endpoints[podA] = sets.SortedList(onlyInA)
+		}
+		if onlyInB.Len() > 0 {
+			d.Endpoints[podB] = sets.SortedList(onlyInB)
+		}
+		divergences = append(divergences, d)
+	}
+	return divergences
+}
+
+func sortedUnion[V any](a, b map[string]V) []string {
+	keys := sets.New[string]()
+	for k := range a {
+		keys.Insert(k)
+	}
+	for k := range b {
+		keys.Insert(k)
+	}
+	return sets.SortedList(keys)
+}
+
+func printComparison(w *tabwriter.Writer, c comparison) error {
+	if len(c.Divergences) == 0 {
+		fmt.Fprintf(w, "%s and %s see the same services, endpoints and policies\n", c.Pods[0], c.Pods[1])
+		return w.Flush()
+	}
+	fmt.Fprintln(w, "KIND\tNAME\tDIVERGENCE")
+	for _, d := range c.Divergences {
+		var divergence string
+		switch {
+		case d.OnlyIn != "":
+			divergence = "only in " + d.OnlyIn
+		case len(d.Fields) > 0:
+			divergence = strings.Join(d.Fields, ",") + " differ"
+		default:
+			var parts []string
+			for _, pod := range c.Pods {
+				if uids := d.Endpoints[pod]; len(uids) > 0 {
+					parts = append(parts, strings.Join(uids, ",")+" only in "+pod)
+				}
+			}
+			divergence = strings.Join(parts, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", d.Kind, d.Name, divergence)
+	}
+	fmt.Fprintf(w, "\n%s and %s diverge on %d resource(s)\n", c.Pods[0], c.Pods[1], len(c.Divergences))
+	return w.Flush()
+}
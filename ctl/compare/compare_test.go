@@ -0,0 +1,83 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dumpA = `{
+	"workloads": [
+		{"uid": "cluster0//Pod/default/foo-1", "services": ["default/foo.default.svc.cluster.local"]},
+		{"uid": "cluster0//Pod/default/foo-2", "services": ["default/foo.default.svc.cluster.local"]},
+		{"uid": "cluster0//Pod/default/bar-1", "services": ["default/bar.default.svc.cluster.local"]}
+	],
+	"services": [
+		{"name": "foo", "namespace": "default", "hostname": "foo.default.svc.cluster.local", "vips": ["/10.96.0.10"],
+			"ports": [{"service_port": 80, "target_port": 8080}], "waypoint": {"destination": ""}},
+		{"name": "bar", "namespace": "default", "hostname": "bar.default.svc.cluster.local", "vips": ["/10.96.0.11"],
+			"ports": [{"service_port": 80, "target_port": 8080}], "waypoint": {"destination": ""}}
+	],
+	"policies": [
+		{"name": "deny-sleep", "namespace": "default", "scope": "NAMESPACE", "action": "DENY", "rules": []}
+	]
+}`
+
+func parseDump(t *testing.T, data string) *configDump {
+	dump := &configDump{}
+	require.NoError(t, json.Unmarshal([]byte(data), dump))
+	return dump
+}
+
+func TestCompare(t *testing.T) {
+	a := parseDump(t, dumpA)
+	assert.Empty(t, compare(a, parseDump(t, dumpA), "kmesh-a", "kmesh-b"))
+
+	// the daemon of kmesh-b sees other endpoints of foo, other ports of bar and missed the deny-sleep policy
+	b := parseDump(t, dumpA)
+	b.Workloads = b.Workloads[1:]
+	b.Workloads[0].Uid = "cluster0//Pod/default/foo-3"
+	b.Services[1]["ports"] = []any{map[string]any{"service_port": 80.0, "target_port": 9090.0}}
+	b.Policies = nil
+
+	divergences := compare(a, b, "kmesh-a", "kmesh-b")
+	assert.Equal(t, []divergence{
+		{Kind: kindService, Name: "default/bar.default.svc.cluster.local", Fields: []string{"ports"}},
+		{Kind: kindEndpoints, Name: "default/foo.default.svc.cluster.local", Endpoints: map[string][]string{
+			"kmesh-a": {"cluster0//Pod/default/foo-1", "cluster0//Pod/default/foo-2"},
+			"kmesh-b": {"cluster0//Pod/default/foo-3"},
+		}},
+		{Kind: kindPolicy, Name: "default/deny-sleep", OnlyIn: "kmesh-a"},
+	}, divergences)
+
+	var buf bytes.Buffer
+	require.NoError(t, printComparison(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0),
+		comparison{Pods: [2]string{"kmesh-a", "kmesh-b"}, Divergences: divergences}))
+	assert.Equal(t, `KIND        NAME                                    DIVERGENCE
+service     default/bar.default.svc.cluster.local   ports differ
+endpoints   default/foo.default.svc.cluster.local   cluster0//Pod/default/foo-1,cluster0//Pod/default/foo-2 only in kmesh-a; cluster0//Pod/default/foo-3 only in kmesh-b
+policy      default/deny-sleep                      only in kmesh-a
+
+kmesh-a and kmesh-b diverge on 3 resource(s)
+`, buf.String())
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conntrack
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/conntrack")
+
+var (
+	src    string
+	dst    string
+	output string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "conntrack <kmesh-daemon-pod>",
+		Short: "Show the connections tracked by the data plane and the backend each of them is routed to",
+		Long: `Show the tcp connections tracked by the data plane of a kmesh daemon, those reported established and not
+closed yet, with their 5-tuple, the backend each of them is routed to, their tcp state and age. The destination
+is the address the client connected to, the address of the service for the connections to a service. Only
+dual-engine mode is supported and monitoring must be enabled.`,
+		Example: `# Show the connections tracked by the daemon
+kmeshctl conntrack <kmesh-daemon-pod>
+
+# Show the connections of a client to a service, matching either the service address or the backends
+kmeshctl conntrack <kmesh-daemon-pod> --src 10.244.0.5 --dst 10.96.0.10
+
+# Print the connections in json
+kmeshctl conntrack <kmesh-daemon-pod> --dst 10.244.1.3 -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runConntrack(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&src, "src", "", "source ip of the connections, all the connections if empty")
+	cmd.Flags().StringVar(&dst, "dst", "", "destination or backend ip of the connections, all the connections if empty")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runConntrack(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ListConnections(ctx, &adminapi.ListConnectionsRequest{Src: src, Dst: dst})
+	if err != nil {
+		return fmt.Errorf("failed to list connections from pod %s: %w", podName, err)
+	}
+	if !resp.GetMonitoringEnabled() {
+		log.Warnf("monitoring is disabled on pod %s, connections are not tracked, enable it with `kmeshctl monitoring %s --all enable`", podName, podName)
+	}
+
+	return utils.PrintOutput(w, output, resp, func() error {
+		return printConnections(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), resp.GetConnections())
+	})
+}
+
+func printConnections(w *tabwriter.Writer, conns []*adminapi.Connection) error {
+	fmt.Fprintln(w, "PROTOCOL\tSOURCE\tDESTINATION\tBACKEND\tDIRECTION\tSTATE\tAGE")
+	for _, conn := range conns {
+		age := (time.Duration(conn.GetAgeMs()) * time.Millisecond).Round(time.Second)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", conn.GetProtocol(), conn.GetSource(), conn.GetDestination(),
+			conn.GetBackend(), conn.GetDirection(), conn.GetState(), age)
+	}
+	return w.Flush()
+}
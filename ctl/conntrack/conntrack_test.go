@@ -0,0 +1,47 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conntrack
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestPrintConnections(t *testing.T) {
+	var buf bytes.Buffer
+	err := printConnections(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), []*adminapi.Connection{
+		{
+			Protocol: "tcp", Source: "10.244.0.5:40002", Destination: "10.96.0.10:80", Backend: "10.244.2.7:8080",
+			Direction: "OUTBOUND", State: "BPF_TCP_ESTABLISHED", AgeMs: 95400,
+		},
+		{
+			Protocol: "tcp", Source: "10.244.0.5:40001", Destination: "10.244.1.3:8080", Backend: "10.244.1.3:8080",
+			Direction: "INBOUND", State: "BPF_TCP_FIN_WAIT1", AgeMs: 300,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `PROTOCOL   SOURCE             DESTINATION       BACKEND           DIRECTION   STATE                 AGE
+tcp        10.244.0.5:40002   10.96.0.10:80     10.244.2.7:8080   OUTBOUND    BPF_TCP_ESTABLISHED   1m35s
+tcp        10.244.0.5:40001   10.244.1.3:8080   10.244.1.3:8080   INBOUND     BPF_TCP_FIN_WAIT1     0s
+`, buf.String())
+}
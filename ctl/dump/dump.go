@@ -17,24 +17,51 @@
 package dump
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"kmesh.net/kmesh/api/v2/adminapi"
 	"kmesh.net/kmesh/ctl/utils"
-	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/adminclient"
 	"kmesh.net/kmesh/pkg/logger"
 )
 
 const (
-	configDumpPrefix = "/debug/config_dump"
+	requestTimeout = 30 * time.Second
+
+	// ExportSchemaVersion is the version of the format of the file written by dump --all.
+	// It is increased on every incompatible change, so that tooling can tell the formats apart.
+	ExportSchemaVersion = 1
 )
 
 var log = logger.NewLoggerScope("kmeshctl/dump")
 
+var (
+	all bool
+	out string
+)
+
+// Export is the config and the bpf maps of a kmesh daemon written by dump --all for offline analysis.
+type Export struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Pod           string    `json:"pod"`
+	Mode          string    `json:"mode"`
+	Version       string    `json:"version,omitempty"`
+	Kernel        string    `json:"kernel,omitempty"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Config is the config dump of the daemon, the workload cache in dual-engine mode
+	Config json.RawMessage `json:"config"`
+	// BpfMaps is the dump of the bpf maps of the daemon
+	BpfMaps json.RawMessage `json:"bpfMaps"`
+}
+
 func NewCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "dump",
@@ -43,52 +70,151 @@ func NewCmd() *cobra.Command {
 kmeshctl dump <kmesh-daemon-pod> kernel-native
 	  
 # Dual Engine mode:
-kmeshctl dump <kmesh-daemon-pod> dual-engine`,
-		Args: cobra.ExactArgs(2),
+kmeshctl dump <kmesh-daemon-pod> dual-engine
+
+# Export the config and the bpf maps to a file for offline analysis or bug reports:
+kmeshctl dump <kmesh-daemon-pod> --all --out ./maps.json`,
+		Args: cobra.RangeArgs(1, 2),
 		Run: func(cmd *cobra.Command, args []string) {
-			_ = RunDump(cmd, args)
+			if err := RunDump(cmd, args); err != nil {
+				utils.Exit(log, err)
+			}
 		},
 	}
+	cmd.Flags().BoolVar(&all, "all", false, "export the config and the bpf maps in a single json file, the mode defaults to the one of the daemon")
+	cmd.Flags().StringVar(&out, "out", "", "file the export of --all is written to, stdout if empty")
 	return cmd
 }
 
 func RunDump(cmd *cobra.Command, args []string) error {
 	podName := args[0]
-	mode := args[1]
-	if mode != constants.KernelNativeMode && mode != constants.DualEngineMode {
-		log.Errorf("Error: Argument must be 'kernel-native' or 'dual-engine'")
-		os.Exit(1)
+	if len(args) < 2 && !all {
+		return fmt.Errorf("the mode must be 'kernel-native' or 'dual-engine'")
+	}
+	mode := adminapi.Mode_MODE_UNSPECIFIED
+	if len(args) > 1 {
+		var err error
+		if mode, err = adminclient.ParseMode(args[1]); err != nil {
+			return fmt.Errorf("argument must be 'kernel-native' or 'dual-engine'")
+		}
 	}
 
 	cli, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to create cli client: %v", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to create cli client: %w", err)
 	}
 
-	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
 	if err != nil {
-		log.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if all {
+		export, err := exportDaemon(ctx, client, podName, mode)
+		if err != nil {
+			return err
+		}
+		if out == "" {
+			return WriteExport(cmd.OutOrStdout(), export)
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", out, err)
+		}
+		defer f.Close()
+		return WriteExport(f, export)
 	}
-	if err := fw.Start(); err != nil {
-		log.Errorf("failed to start port forwarder for Kmesh daemon pod %s: %v", podName, err)
+
+	resp, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: mode})
+	if err != nil {
+		return fmt.Errorf("failed to dump config: %w", err)
 	}
 
-	url := fmt.Sprintf("http://%s%s/%s", fw.Address(), configDumpPrefix, mode)
-	resp, err := http.Get(url)
+	fmt.Println(resp.GetJson())
+	return nil
+}
+
+// exportDaemon collects the config and the bpf maps of the daemon, in the mode it runs in if mode is unspecified
+func exportDaemon(ctx context.Context, client adminapi.KmeshAdminClient, podName string, mode adminapi.Mode) (*Export, error) {
+	status, err := client.GetStatus(ctx, &adminapi.GetStatusRequest{})
 	if err != nil {
-		log.Errorf("failed to make HTTP request: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to get the status of pod %s: %w", podName, err)
+	}
+	if mode == adminapi.Mode_MODE_UNSPECIFIED {
+		mode = status.GetMode()
+		if mode == adminapi.Mode_MODE_UNSPECIFIED {
+			return nil, fmt.Errorf("the controller of pod %s is not started yet", podName)
+		}
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	config, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: mode})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump config: %w", err)
+	}
+	bpfMaps, err := client.BpfMapDump(ctx, &adminapi.BpfMapDumpRequest{Mode: mode})
 	if err != nil {
-		log.Errorf("failed to read HTTP response body: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to dump the bpf maps: %w", err)
 	}
 
-	fmt.Println(string(body))
-	return nil
+	return NewExport(podName, mode, status, config.GetJson(), bpfMaps.GetJson(), time.Now())
+}
+
+// NewExport returns the export of the config and bpf map dumps of a daemon in mode
+func NewExport(podName string, mode adminapi.Mode, status *adminapi.DaemonStatus, config, bpfMaps string, timestamp time.Time) (*Export, error) {
+	export := &Export{
+		SchemaVersion: ExportSchemaVersion,
+		Pod:           podName,
+		Mode:          adminclient.FormatMode(mode),
+		Version:       status.GetVersion(),
+		Kernel:        status.GetKernel(),
+		Timestamp:     timestamp.UTC(),
+	}
+	var err error
+	if export.Config, err = compact(config); err != nil {
+		return nil, fmt.Errorf("invalid config dump: %w", err)
+	}
+	if export.BpfMaps, err = compact(bpfMaps); err != nil {
+		return nil, fmt.Errorf("invalid bpf map dump: %w", err)
+	}
+	return export, nil
+}
+
+func WriteExport(w io.Writer, export *Export) error {
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export: %w", err)
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadExport parses an export written by WriteExport, and rejects the ones of another schema version
+func ReadExport(r io.Reader) (*Export, error) {
+	export := &Export{}
+	if err := json.NewDecoder(r).Decode(export); err != nil {
+		return nil, fmt.Errorf("failed to parse export: %w", err)
+	}
+	if export.SchemaVersion != ExportSchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d of export, expected %d", export.SchemaVersion, ExportSchemaVersion)
+	}
+	var err error
+	if export.Config, err = compact(string(export.Config)); err != nil {
+		return nil, fmt.Errorf("invalid config of export: %w", err)
+	}
+	if export.BpfMaps, err = compact(string(export.BpfMaps)); err != nil {
+		return nil, fmt.Errorf("invalid bpf maps of export: %w", err)
+	}
+	return export, nil
+}
+
+// compact validates a dump, and removes its insignificant space so that it compares equal whatever its indentation
+func compact(dump string) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(dump)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
@@ -0,0 +1,121 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dump
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+const (
+	testConfigDump = `{
+    "workloads": [
+        {
+            "uid": "cluster0//Pod/default/sleep",
+            "addresses": ["10.244.0.2"]
+        }
+    ],
+    "services": [],
+    "policies": []
+}`
+	testBpfDump = `{
+    "backends": [
+        {
+            "ip": "10.244.0.2",
+            "services": ["default/sleep.default.svc.cluster.local"]
+        }
+    ]
+}`
+)
+
+type fakeAdminClient struct {
+	adminapi.KmeshAdminClient
+	mode adminapi.Mode
+}
+
+func (f *fakeAdminClient) GetStatus(context.Context, *adminapi.GetStatusRequest, ...grpc.CallOption) (*adminapi.DaemonStatus, error) {
+	return &adminapi.DaemonStatus{Mode: f.mode, Version: "v1.1.0", Kernel: "6.6.0"}, nil
+}
+
+func (f *fakeAdminClient) ConfigDump(_ context.Context, req *adminapi.ConfigDumpRequest, _ ...grpc.CallOption) (*adminapi.ConfigDumpResponse, error) {
+	return &adminapi.ConfigDumpResponse{Mode: req.GetMode(), Json: testConfigDump}, nil
+}
+
+func (f *fakeAdminClient) BpfMapDump(_ context.Context, req *adminapi.BpfMapDumpRequest, _ ...grpc.CallOption) (*adminapi.BpfMapDumpResponse, error) {
+	return &adminapi.BpfMapDumpResponse{Mode: req.GetMode(), Json: testBpfDump}, nil
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	export, err := exportDaemon(context.TODO(), &fakeAdminClient{mode: adminapi.Mode_DUAL_ENGINE}, "kmesh-abcde", adminapi.Mode_MODE_UNSPECIFIED)
+	require.NoError(t, err)
+	assert.Equal(t, ExportSchemaVersion, export.SchemaVersion)
+	assert.Equal(t, "kmesh-abcde", export.Pod)
+	assert.Equal(t, "dual-engine", export.Mode)
+	assert.Equal(t, "v1.1.0", export.Version)
+	assert.JSONEq(t, testConfigDump, string(export.Config))
+	assert.JSONEq(t, testBpfDump, string(export.BpfMaps))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteExport(&buf, export))
+	parsed, err := ReadExport(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, export, parsed)
+
+	// the dumps are parsed by the structures of the daemon
+	var backends struct {
+		Backends []struct {
+			Ip       string   `json:"ip"`
+			Services []string `json:"services"`
+		} `json:"backends"`
+	}
+	require.NoError(t, json.Unmarshal(parsed.BpfMaps, &backends))
+	require.Len(t, backends.Backends, 1)
+	assert.Equal(t, "10.244.0.2", backends.Backends[0].Ip)
+}
+
+func TestExportDaemon_notStarted(t *testing.T) {
+	_, err := exportDaemon(context.TODO(), &fakeAdminClient{}, "kmesh-abcde", adminapi.Mode_MODE_UNSPECIFIED)
+	assert.ErrorContains(t, err, "not started")
+
+	export, err := exportDaemon(context.TODO(), &fakeAdminClient{}, "kmesh-abcde", adminapi.Mode_KERNEL_NATIVE)
+	require.NoError(t, err)
+	assert.Equal(t, "kernel-native", export.Mode)
+}
+
+func TestNewExport_invalidDump(t *testing.T) {
+	status := &adminapi.DaemonStatus{Mode: adminapi.Mode_DUAL_ENGINE}
+	_, err := NewExport("kmesh-abcde", adminapi.Mode_DUAL_ENGINE, status, "{", testBpfDump, time.Now())
+	assert.ErrorContains(t, err, "invalid config dump")
+	_, err = NewExport("kmesh-abcde", adminapi.Mode_DUAL_ENGINE, status, testConfigDump, "", time.Now())
+	assert.ErrorContains(t, err, "invalid bpf map dump")
+}
+
+func TestReadExport_schemaVersion(t *testing.T) {
+	_, err := ReadExport(bytes.NewBufferString(`{"schemaVersion": 2, "config": {}, "bpfMaps": {}}`))
+	assert.ErrorContains(t, err, "unsupported schema version 2")
+	_, err = ReadExport(bytes.NewBufferString(`not json`))
+	assert.ErrorContains(t, err, "failed to parse export")
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoints
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/endpoints")
+
+var (
+	output     string
+	showHealth bool
+)
+
+// backend is the part of a backend of the dual-engine bpf map dump shown by the command
+type backend struct {
+	Ip              string   `json:"ip"`
+	Services        []string `json:"services"`
+	ConnectFailures uint32   `json:"connectFailures,omitempty"`
+	EjectedBy       []string `json:"ejectedBy,omitempty"`
+	// Health is set with --show-health
+	Health *endpointHealth `json:"health,omitempty"`
+}
+
+// endpointHealth is the health of an endpoint as last received from xds by the daemon
+type endpointHealth struct {
+	Addresses      []string `json:"addresses,omitempty"`
+	Healthy        bool     `json:"healthy"`
+	LastHealthy    string   `json:"lastHealthy,omitempty"`
+	LastTransition string   `json:"lastTransition,omitempty"`
+	Transitions    uint32   `json:"transitions,omitempty"`
+}
+
+type bpfDump struct {
+	Backends       []backend        `json:"backends"`
+	EndpointHealth []endpointHealth `json:"endpointHealth"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "endpoints <kmesh-daemon-pod> [<namespace>/<service-hostname>]",
+		Short: "Show the backends the data plane balances the connections over and their health",
+		Long: `Show the backends in the bpf maps of a kmesh daemon with the services they belong to, the connections
+to them which failed to establish in a row and the services whose outlier detection, set by the
+kmesh.net/outlier-detection annotation, currently ejects them. An ejected backend gets no new connection
+of the service until its ejection time passed since its last failure. With --show-health, the readiness
+of the backends received from xds is shown too, with when they were last ready, when their readiness last
+changed and how many times it did, to spot the flapping ones. Only dual-engine mode is supported.`,
+		Example: `# Show the backends of all the services
+kmeshctl endpoints <kmesh-daemon-pod>
+
+# Show the backends of the foo service of the default namespace
+kmeshctl endpoints <kmesh-daemon-pod> default/foo.default.svc.cluster.local
+
+# Show when the backends were last ready and how often their readiness changed
+kmeshctl endpoints <kmesh-daemon-pod> --show-health
+
+# Print the backends in json
+kmeshctl endpoints <kmesh-daemon-pod> -o json`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var service string
+			if len(args) > 1 {
+				service = args[1]
+			}
+			if err := runEndpoints(cmd.OutOrStdout(), args[0], service); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	utils.AddOutputFlag(cmd, &output)
+	cmd.Flags().BoolVar(&showHealth, "show-health", false, "show the readiness history of the backends")
+	return cmd
+}
+
+func runEndpoints(w io.Writer, podName, service string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.BpfMapDump(ctx, &adminapi.BpfMapDumpRequest{Mode: adminapi.Mode_DUAL_ENGINE})
+	if err != nil {
+		return fmt.Errorf("failed to dump the bpf maps of pod %s: %w", podName, err)
+	}
+	var dump bpfDump
+	if err := json.Unmarshal([]byte(resp.GetJson()), &dump); err != nil {
+		return fmt.Errorf("failed to parse the bpf map dump: %w", err)
+	}
+	backends := filterBackends(dump.Backends, service)
+	if showHealth {
+		addHealth(backends, dump.EndpointHealth)
+	}
+
+	return utils.PrintOutput(w, output, backends, func() error {
+		return printBackends(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), backends, showHealth)
+	})
+}
+
+// filterBackends returns the backends of the service sorted by ip, all of them if service is empty
+func filterBackends(backends []backend, service string) []backend {
+	filtered := make([]backend, 0, len(backends))
+	for _, b := range backends {
+		if service == "" || slices.Contains(b.Services, service) {
+			filtered = append(filtered, b)
+		}
+	}
+	slices.SortFunc(filtered, func(a, b backend) int {
+		return strings.Compare(a.Ip, b.Ip)
+	})
+	return filtered
+}
+
+// addHealth sets the health of the backends from the one of the endpoints with their address
+func addHealth(backends []backend, health []endpointHealth) {
+	byAddress := make(map[string]*endpointHealth)
+	for i := range health {
+		for _, addr := range health[i].Addresses {
+			byAddress[addr] = &health[i]
+		}
+	}
+	for i := range backends {
+		backends[i].Health = byAddress[backends[i].Ip]
+	}
+}
+
+func printBackends(w *tabwriter.Writer, backends []backend, showHealth bool) error {
+	if showHealth {
+		fmt.Fprintln(w, "BACKEND\tSERVICES\tCONNECT FAILURES\tSTATUS\tREADY\tLAST READY\tLAST TRANSITION\tTRANSITIONS")
+	} else {
+		fmt.Fprintln(w, "BACKEND\tSERVICES\tCONNECT FAILURES\tSTATUS")
+	}
+	for _, b := range backends {
+		status := "HEALTHY"
+		if len(b.EjectedBy) > 0 {
+			status = "EJECTED by " + strings.Join(b.EjectedBy, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s", b.Ip, strings.Join(b.Services, ","), b.ConnectFailures, status)
+		if showHealth {
+			ready, lastReady, lastTransition, transitions := "-", "-", "-", "-"
+			if h := b.Health; h != nil {
+				ready = "no"
+				if h.Healthy {
+					ready = "yes"
+				}
+				lastReady = cmp.Or(h.LastHealthy, "-")
+				lastTransition = cmp.Or(h.LastTransition, "-")
+				transitions = strconv.FormatUint(uint64(h.Transitions), 10)
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", ready, lastReady, lastTransition, transitions)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
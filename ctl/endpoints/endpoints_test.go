@@ -0,0 +1,76 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintBackends(t *testing.T) {
+	data := `{"backends": [
+		{"ip": "10.244.0.6", "serviceCount": 1, "services": ["default/foo.default.svc.cluster.local"]},
+		{"ip": "10.244.0.5", "serviceCount": 2, "services": ["default/foo.default.svc.cluster.local", "default/bar.default.svc.cluster.local"],
+			"connectFailures": 5, "ejectedBy": ["default/foo.default.svc.cluster.local"]},
+		{"ip": "10.244.0.7", "serviceCount": 1, "services": ["default/bar.default.svc.cluster.local"], "connectFailures": 1}
+	]}`
+	var dump bpfDump
+	require.NoError(t, json.Unmarshal([]byte(data), &dump))
+
+	var buf bytes.Buffer
+	require.NoError(t, printBackends(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), filterBackends(dump.Backends, ""), false))
+	assert.Equal(t, `BACKEND      SERVICES                                                                      CONNECT FAILURES   STATUS
+10.244.0.5   default/foo.default.svc.cluster.local,default/bar.default.svc.cluster.local   5                  EJECTED by default/foo.default.svc.cluster.local
+10.244.0.6   default/foo.default.svc.cluster.local                                         0                  HEALTHY
+10.244.0.7   default/bar.default.svc.cluster.local                                         1                  HEALTHY
+`, buf.String())
+
+	backends := filterBackends(dump.Backends, "default/bar.default.svc.cluster.local")
+	require.Len(t, backends, 2)
+	assert.Equal(t, "10.244.0.5", backends[0].Ip)
+	assert.Equal(t, "10.244.0.7", backends[1].Ip)
+}
+
+func TestPrintBackendsHealth(t *testing.T) {
+	data := `{"backends": [
+		{"ip": "10.244.0.5", "serviceCount": 1, "services": ["default/foo.default.svc.cluster.local"]},
+		{"ip": "10.244.0.6", "serviceCount": 1, "services": ["default/foo.default.svc.cluster.local"]},
+		{"ip": "10.244.0.7", "serviceCount": 1, "services": ["default/foo.default.svc.cluster.local"]}
+	], "endpointHealth": [
+		{"uid": "cluster0//Pod/default/foo-1", "addresses": ["10.244.0.5"], "healthy": true,
+			"lastHealthy": "2024-07-04T20:14:00Z", "lastTransition": "2024-07-04T20:10:00Z", "transitions": 4},
+		{"uid": "cluster0//Pod/default/foo-2", "addresses": ["10.244.0.6"], "healthy": false,
+			"lastHealthy": "2024-07-04T20:12:00Z", "lastTransition": "2024-07-04T20:12:00Z", "transitions": 1}
+	]}`
+	var dump bpfDump
+	require.NoError(t, json.Unmarshal([]byte(data), &dump))
+	backends := filterBackends(dump.Backends, "")
+	addHealth(backends, dump.EndpointHealth)
+
+	var buf bytes.Buffer
+	require.NoError(t, printBackends(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), backends, true))
+	assert.Equal(t, `BACKEND      SERVICES                                CONNECT FAILURES   STATUS    READY   LAST READY             LAST TRANSITION        TRANSITIONS
+10.244.0.5   default/foo.default.svc.cluster.local   0                  HEALTHY   yes     2024-07-04T20:14:00Z   2024-07-04T20:10:00Z   4
+10.244.0.6   default/foo.default.svc.cluster.local   0                  HEALTHY   no      2024-07-04T20:12:00Z   2024-07-04T20:12:00Z   1
+10.244.0.7   default/foo.default.svc.cluster.local   0                  HEALTHY   -       -                      -                      -
+`, buf.String())
+}
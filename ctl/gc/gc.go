@@ -0,0 +1,116 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const patternMapGC = "/debug/gc"
+
+var log = logger.NewLoggerScope("kmeshctl/gc")
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc <kmesh-daemon-pod>",
+		Short: "Remove the stale entries of the bpf maps of a kmesh daemon",
+		Long: `Remove the entries of the bpf maps of a kmesh daemon with no backing service or workload
+received from xds, which deletes racing with other updates may leave behind. The daemon also
+removes them every 5 minutes, the number of entries removed is exported by map in the
+kmesh_map_gc_removed_total metric. Only dual-engine mode is supported.`,
+		Example: `# Remove the stale entries of the bpf maps of a kmesh daemon
+kmeshctl gc <kmesh-daemon-pod>`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runGC(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	return cmd
+}
+
+func runGC(w io.Writer, podName string) error {
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	if err != nil {
+		return fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	removed, err := requestGC(fw.Address())
+	if err != nil {
+		return err
+	}
+	printRemoved(w, removed)
+	return nil
+}
+
+// requestGC asks the daemon whose status server listens on address to remove the stale entries
+// of its bpf maps, and returns the number of entries removed by map
+func requestGC(address string) (map[string]int, error) {
+	resp, err := http.Post(fmt.Sprintf("http://%s%s", address, patternMapGC), "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to gc: %s", strings.TrimSpace(string(body)))
+	}
+	removed := map[string]int{}
+	if err := json.Unmarshal(body, &removed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the removed entries: %w", err)
+	}
+	return removed, nil
+}
+
+func printRemoved(w io.Writer, removed map[string]int) {
+	names := make([]string, 0, len(removed))
+	for name := range removed {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAP\tREMOVED")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d\n", name, removed[name])
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package gc
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/ctl/utils"
+)
+
+func TestRequestGC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, patternMapGC, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"backend": 2, "frontend": 3, "endpoint": 0}`))
+	}))
+	defer srv.Close()
+
+	removed, err := requestGC(strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"backend": 2, "frontend": 3, "endpoint": 0}, removed)
+
+	var out bytes.Buffer
+	printRemoved(&out, removed)
+	assert.Equal(t, "MAP       REMOVED\nbackend   2\nendpoint  0\nfrontend  3\n", out.String())
+}
+
+func TestRequestGCError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("\tInvalid Client Mode\n"))
+	}))
+	defer srv.Close()
+
+	_, err := requestGC(strings.TrimPrefix(srv.URL, "http://"))
+	assert.EqualError(t, err, "failed to gc: Invalid Client Mode")
+}
+
+func TestRequestGCDaemonUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	address := strings.TrimPrefix(srv.URL, "http://")
+	srv.Close()
+
+	_, err := requestGC(address)
+	require.Error(t, err)
+	assert.Equal(t, utils.ExitDaemonUnreachable, utils.ExitCode(err))
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locality
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/locality")
+
+var (
+	service    string
+	clientNode string
+	output     string
+)
+
+// NewCmd returns the root locality command with its subcommands.
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "locality",
+		Short: "Inspect the locality load balancing of the services",
+	}
+	cmd.AddCommand(NewSimulateCmd())
+	return cmd
+}
+
+// NewSimulateCmd creates a command to show where the connections of a client on a node to a service go.
+func NewSimulateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "simulate <kmesh-daemon-pod>",
+		Short: "Show the locality tiers and endpoints the connections of a client on a node are routed to",
+		Long: `Rank the endpoints of the --service by locality for a client running on the --client-node, with the
+workloads and services known to a kmesh daemon, and print the tiers with the percent of the connections
+each receives, without sending any traffic. The ranking is the one the data plane of the client node uses,
+the locality of the node is learned from the workloads running on it. Endpoints of a tier receiving
+connections are SELECTED, the others are on STANDBY for failover. Only dual-engine mode is supported.`,
+		Example: `# Show where a client on node worker-1 connects to the foo service of the default namespace
+kmeshctl locality simulate <kmesh-daemon-pod> --service default/foo --client-node worker-1
+
+# Print the simulation in json
+kmeshctl locality simulate <kmesh-daemon-pod> --service default/foo --client-node worker-1 -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runSimulate(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&service, "service", "", "service to simulate, <namespace>/<name> or <name> of the default namespace")
+	cmd.Flags().StringVar(&clientNode, "client-node", "", "node the client runs on")
+	utils.AddOutputFlag(cmd, &output)
+	_ = cmd.MarkFlagRequired("service")
+	_ = cmd.MarkFlagRequired("client-node")
+	return cmd
+}
+
+func runSimulate(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	namespace, name := "default", service
+	if ns, n, ok := strings.Cut(service, "/"); ok {
+		namespace, name = ns, n
+	}
+	if namespace == "" || name == "" {
+		return fmt.Errorf("invalid --service %q", service)
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.SimulateLocality(ctx, &adminapi.SimulateLocalityRequest{Namespace: namespace, Name: name, ClientNode: clientNode})
+	if err != nil {
+		return fmt.Errorf("failed to simulate locality load balancing on pod %s: %w", podName, err)
+	}
+
+	return utils.PrintOutput(w, output, resp, func() error {
+		return printSimulation(w, namespace+"/"+name, resp)
+	})
+}
+
+// printSimulation prints the tiers of the simulation, the closest first, with one row per endpoint
+func printSimulation(w io.Writer, service string, resp *adminapi.LocalitySimulation) error {
+	mode := strings.ToLower(resp.GetMode())
+	if mode == "unspecified_mode" {
+		mode = "random"
+	}
+	fmt.Fprintf(w, "Service:     %s (%s)\n", service, mode)
+	if resp.GetClientLocality() != "" {
+		fmt.Fprintf(w, "Client node: %s (%s)\n", clientNode, resp.GetClientLocality())
+	} else {
+		fmt.Fprintf(w, "Client node: %s\n", clientNode)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "TIER\tLOAD\tENDPOINT\tADDRESS\tNODE\tLOCALITY\tSTATUS")
+	for _, tier := range resp.GetTiers() {
+		for _, ep := range tier.GetEndpoints() {
+			status := "STANDBY"
+			if !ep.GetHealthy() {
+				status = "UNHEALTHY"
+			} else if tier.GetLoad() > 0 {
+				status = "SELECTED"
+			}
+			fmt.Fprintf(tw, "%d\t%d%%\t%s/%s\t%s\t%s\t%s\t%s\n", tier.GetPriority(), tier.GetLoad(),
+				ep.GetNamespace(), ep.GetName(), ep.GetAddress(), ep.GetNode(), ep.GetLocality(), status)
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locality
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestPrintSimulation(t *testing.T) {
+	clientNode = "worker-1"
+	resp := &adminapi.LocalitySimulation{
+		Mode:           "FAILOVER",
+		ClientLocality: "r1/z1/s1",
+		Tiers: []*adminapi.LocalityTier{
+			{Priority: 0, Load: 100, Endpoints: []*adminapi.LocalityEndpoint{
+				{Namespace: "default", Name: "foo-a", Address: "10.244.0.5", Node: "worker-1", Locality: "r1/z1/s1", Healthy: true},
+				{Namespace: "default", Name: "foo-b", Address: "10.244.0.6", Node: "worker-1", Locality: "r1/z1/s1"},
+			}},
+			{Priority: 1, Endpoints: []*adminapi.LocalityEndpoint{
+				{Namespace: "default", Name: "foo-c", Address: "10.244.1.5", Node: "worker-2", Locality: "r1/z2/s1", Healthy: true},
+			}},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printSimulation(&buf, "default/foo", resp))
+	assert.Equal(t, `Service:     default/foo (failover)
+Client node: worker-1 (r1/z1/s1)
+
+TIER   LOAD   ENDPOINT        ADDRESS      NODE       LOCALITY   STATUS
+0      100%   default/foo-a   10.244.0.5   worker-1   r1/z1/s1   SELECTED
+0      100%   default/foo-b   10.244.0.6   worker-1   r1/z1/s1   UNHEALTHY
+1      0%     default/foo-c   10.244.1.5   worker-2   r1/z2/s1   STANDBY
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, printSimulation(&buf, "default/foo", &adminapi.LocalitySimulation{Mode: "UNSPECIFIED_MODE"}))
+	assert.Equal(t, "Service:     default/foo (random)\nClient node: worker-1\n\nTIER   LOAD   ENDPOINT   ADDRESS   NODE   LOCALITY   STATUS\n", buf.String())
+}
@@ -17,31 +17,25 @@
 package logs
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"kmesh.net/kmesh/api/v2/adminapi"
 	"kmesh.net/kmesh/ctl/utils"
 	"kmesh.net/kmesh/pkg/logger"
 )
 
 const (
-	patternLoggers = "/debug/loggers"
+	requestTimeout = 10 * time.Second
 )
 
 var log = logger.NewLoggerScope("kmeshctl/log")
 
-type LoggerInfo struct {
-	Name  string `json:"name,omitempty"`
-	Level string `json:"level,omitempty"`
-}
-
 func NewCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "log",
@@ -63,97 +57,51 @@ kmeshctl log <kmesh-daemon-pod> default`,
 	return cmd
 }
 
-func GetJson(url string, val any) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed making GET request(%s): %v", url, err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed reading response body(%s): %v", url, err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received status code %d, Response body: %s", resp.StatusCode, body)
-	}
-
-	err = json.Unmarshal(body, val)
+func GetLoggerNames(client adminapi.KmeshAdminClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ListLoggers(ctx, &adminapi.ListLoggersRequest{})
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal response body: %v", err)
-	}
-
-	return nil
-}
-
-func GetLoggerNames(url string) {
-	var loggerNames []string
-	if err := GetJson(url, &loggerNames); err != nil {
-		log.Errorf("failed to get logger names: %v", err)
-		return
+		utils.Exit(log, fmt.Errorf("failed to get logger names: %w", err))
 	}
 
 	fmt.Printf("Existing Loggers:\n")
-	for _, logger := range loggerNames {
+	for _, logger := range resp.GetNames() {
 		fmt.Printf("\t%s\n", logger)
 	}
 }
 
-func GetLoggerLevel(url string) {
-	var loggerInfo LoggerInfo
-	if err := GetJson(url, &loggerInfo); err != nil {
-		log.Errorf("failed to get logger level: %v", err)
-		return
+func GetLoggerLevel(client adminapi.KmeshAdminClient, loggerName string) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	loggerInfo, err := client.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: loggerName})
+	if err != nil {
+		utils.Exit(log, fmt.Errorf("failed to get logger level: %w", err))
 	}
 
-	fmt.Printf("Logger Name: %s\n", loggerInfo.Name)
-	fmt.Printf("Logger Level: %s\n", loggerInfo.Level)
+	fmt.Printf("Logger Name: %s\n", loggerInfo.GetName())
+	fmt.Printf("Logger Level: %s\n", loggerInfo.GetLevel())
 }
 
-func SetLoggerLevel(url string, setFlag string) {
+func SetLoggerLevel(client adminapi.KmeshAdminClient, setFlag string) {
 	if !strings.Contains(setFlag, ":") {
-		log.Errorf("Invalid set flag, which should be loggerName:loggerLevel (e.g. default:debug)")
-		os.Exit(1)
+		utils.Exit(log, errors.New("Invalid set flag, which should be loggerName:loggerLevel (e.g. default:debug)"))
 	}
 	splits := strings.Split(setFlag, ":")
 	loggerName := splits[0]
 	loggerLevel := splits[1]
 
-	loggerInfo := LoggerInfo{
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	loggerInfo, err := client.SetLoggerLevel(ctx, &adminapi.LoggerLevel{
 		Name:  loggerName,
 		Level: loggerLevel,
-	}
-	data, err := json.Marshal(loggerInfo)
-	if err != nil {
-		log.Errorf("Error marshaling logger info: %v", err)
-		return
-	}
-
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(data))
-	if err != nil {
-		log.Errorf("Error creating request: %v", err)
-		return
-	}
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	})
 	if err != nil {
-		log.Errorf("failed to make HTTP request: %v", err)
-		return
+		utils.Exit(log, fmt.Errorf("failed to set logger level: %w", err))
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Errorf("Error: received status code %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Errorf("failed to read HTTP response body: %v", err)
-		return
-	}
-	fmt.Println(string(body))
+	fmt.Printf("Logger Name: %s\n", loggerInfo.GetName())
+	fmt.Printf("Logger Level: %s\n", loggerInfo.GetLevel())
 }
 
 func RunGetOrSetLoggerLevel(cmd *cobra.Command, args []string) {
@@ -161,32 +109,23 @@ func RunGetOrSetLoggerLevel(cmd *cobra.Command, args []string) {
 
 	cli, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to create cli client: %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to create cli client: %w", err))
 	}
 
-	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
 	if err != nil {
-		log.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
-	}
-	if err := fw.Start(); err != nil {
-		log.Errorf("failed to start port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
+		utils.Exit(log, err)
 	}
-	defer fw.Close()
-
-	url := fmt.Sprintf("http://%s%s", fw.Address(), patternLoggers)
+	defer client.Close()
 
 	setFlag, _ := cmd.Flags().GetString("set")
 	if setFlag == "" {
 		if len(args) >= 2 {
-			url += fmt.Sprintf("?name=%s", args[1])
-			GetLoggerLevel(url)
+			GetLoggerLevel(client, args[1])
 		} else {
-			GetLoggerNames(url)
+			GetLoggerNames(client)
 		}
 	} else {
-		SetLoggerLevel(url, setFlag)
+		SetLoggerLevel(client, setFlag)
 	}
 }
@@ -20,11 +20,12 @@ import (
 	"os"
 
 	"kmesh.net/kmesh/ctl/common"
+	"kmesh.net/kmesh/ctl/utils"
 )
 
 func main() {
 	rootCmd := common.GetRootCommand()
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(utils.ExitCode(err))
 	}
 }
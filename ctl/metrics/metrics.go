@@ -0,0 +1,111 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/metrics")
+
+var (
+	service   string
+	namespace string
+	output    string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "metrics <kmesh-daemon-pod>",
+		Short: "Show the active connections of the services and the rate they are opened at",
+		Long: `Show the active connections of the services and the rate they are opened at, as counted by the data plane
+of a kmesh daemon. The source reporter counts the connections of the clients on the node of the daemon,
+the destination reporter the connections to the backends on the node. The same loads are exported to prometheus
+as kmesh_tcp_service_active_connections and kmesh_tcp_service_connections_opened_total, to autoscale the
+services on their connections through a custom metrics adapter. Only dual-engine mode is supported and
+monitoring must be enabled.`,
+		Example: `# Show the connections to the services of all the namespaces
+kmeshctl metrics <kmesh-daemon-pod>
+
+# Show the connections to the foo service of the default namespace
+kmeshctl metrics <kmesh-daemon-pod> --service foo -n default
+
+# Print the loads in json
+kmeshctl metrics <kmesh-daemon-pod> --service foo -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runMetrics(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&service, "service", "", "name of the service, all the services if empty")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "namespace of the services, all the namespaces if empty")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runMetrics(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.GetServiceLoad(ctx, &adminapi.GetServiceLoadRequest{Namespace: namespace, Name: service})
+	if err != nil {
+		return fmt.Errorf("failed to get service load from pod %s: %w", podName, err)
+	}
+	if !resp.GetMonitoringEnabled() {
+		log.Warnf("monitoring is disabled on pod %s, connections are not counted, enable it with `kmeshctl monitoring %s --all enable`", podName, podName)
+	}
+
+	return utils.PrintOutput(w, output, resp, func() error {
+		return printServiceLoads(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), resp.GetLoads())
+	})
+}
+
+func printServiceLoads(w *tabwriter.Writer, loads []*adminapi.ServiceLoad) error {
+	fmt.Fprintln(w, "NAMESPACE\tSERVICE\tREPORTER\tACTIVE\tOPENED\tRATE(/s)")
+	for _, load := range loads {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%.2f\n", load.GetNamespace(), load.GetName(), load.GetReporter(),
+			load.GetActiveConnections(), load.GetOpenedConnections(), load.GetConnectionRate())
+	}
+	return w.Flush()
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestPrintServiceLoads(t *testing.T) {
+	var buf bytes.Buffer
+	err := printServiceLoads(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), []*adminapi.ServiceLoad{
+		{Namespace: "default", Name: "foo", Reporter: "destination", ActiveConnections: 60, OpenedConnections: 125, ConnectionRate: 25},
+		{Namespace: "default", Name: "foo", Reporter: "source", ActiveConnections: 3, OpenedConnections: 4, ConnectionRate: 0.2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `NAMESPACE   SERVICE   REPORTER      ACTIVE   OPENED   RATE(/s)
+default     foo       destination   60       125      25.00
+default     foo       source        3        4        0.20
+`, buf.String())
+}
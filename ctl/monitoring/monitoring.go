@@ -19,10 +19,10 @@ package monitoring
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -92,8 +92,7 @@ kmeshctl monitoring --all enable/disable`,
 func ControlMonitoring(cmd *cobra.Command, args []string) {
 	client, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to create cli client: %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to create cli client: %w", err))
 	}
 	accesslogFlag, _ := cmd.Flags().GetString("accesslog")
 	allFlag, _ := cmd.Flags().GetString("all")
@@ -123,8 +122,7 @@ func ControlMonitoring(cmd *cobra.Command, args []string) {
 		// Perform operations on all kmesh daemons.
 		podList, err := client.PodsForSelector(context.TODO(), utils.KmeshNamespace, utils.KmeshLabel)
 		if err != nil {
-			log.Errorf("failed to get kmesh podList: %v", err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to get kmesh podList: %w", err))
 		}
 		for _, pod := range podList.Items {
 			if allFlag != "" {
@@ -160,18 +158,15 @@ func SetObservabilityPerKmeshDaemon(cli kube.CLIClient, podName, info string, ob
 	} else if info == "disable" {
 		status = "false"
 	} else {
-		log.Errorf("Error: Argument must be 'enable' or 'disable'")
-		os.Exit(1)
+		utils.Exit(log, errors.New("argument must be 'enable' or 'disable'"))
 	}
 
 	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
 	if err != nil {
-		log.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err))
 	}
-	if err := fw.Start(); err != nil {
-		log.Errorf("failed to start port forwarder for Kmesh daemon pod %s: %v", podName, err)
-		os.Exit(1)
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		utils.Exit(log, err)
 	}
 	defer fw.Close()
 
@@ -179,32 +174,29 @@ func SetObservabilityPerKmeshDaemon(cli kube.CLIClient, podName, info string, ob
 
 	req, err := http.NewRequest(http.MethodPost, url, nil)
 	if err != nil {
-		log.Errorf("Error creating request: %v", err)
-		return
+		utils.Exit(log, fmt.Errorf("failed to create request: %w", err))
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Errorf("failed to make HTTP request: %v", err)
-		return
+		utils.Exit(log, fmt.Errorf("failed to make HTTP request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Errorf("Error: received status code %d", resp.StatusCode)
-		if observablityType == MONITORING {
-			return
-		}
-		bodyBytes, readErr := io.ReadAll(resp.Body)
-		if readErr != nil {
-			log.Errorf("Error reading response body: %v", readErr)
-			return
-		}
-		bodyString := string(bodyBytes)
-		if resp.StatusCode == http.StatusBadRequest && bytes.Contains(bodyBytes, []byte(fmt.Sprintf("Kmesh monitoring is disable, cannot enable %s.", observablityType))) {
-			log.Errorf("failed to enable %s: %v. Need to start Kmesh's Monitoring. Please run `kmeshctl monitoring -h` for more help.", observablityType, bodyString)
+		err := fmt.Errorf("received status code %d from Kmesh daemon pod %s", resp.StatusCode, podName)
+		if observablityType != MONITORING {
+			bodyBytes, readErr := io.ReadAll(resp.Body)
+			if readErr != nil {
+				utils.Exit(log, fmt.Errorf("failed to read response body: %w", readErr))
+			}
+			bodyString := string(bodyBytes)
+			if resp.StatusCode == http.StatusBadRequest && bytes.Contains(bodyBytes, []byte(fmt.Sprintf("Kmesh monitoring is disable, cannot enable %s.", observablityType))) {
+				err = fmt.Errorf("failed to enable %s: %s, Kmesh's Monitoring needs to be started, please run `kmeshctl monitoring -h` for more help", observablityType, bodyString)
+			}
 		}
+		utils.Exit(log, err)
 	}
 }
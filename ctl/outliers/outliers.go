@@ -0,0 +1,168 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outliers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const patternOutliers = "/debug/outliers"
+
+var log = logger.NewLoggerScope("kmeshctl/outliers")
+
+var (
+	output         string
+	clearEjections bool
+)
+
+// ejection is a backend the outlier detection of a service ejects, as returned by the daemon
+type ejection struct {
+	Service         string `json:"service"`
+	Backend         string `json:"backend"`
+	Ip              string `json:"ip"`
+	ConnectFailures uint32 `json:"connectFailures"`
+	Reason          string `json:"reason"`
+	RemainingMs     int64  `json:"remainingMs"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "outliers <kmesh-daemon-pod> [<namespace>/<service-hostname>]",
+		Short: "List and re-admit the backends ejected by the outlier detection",
+		Long: `List the backends the outlier detection of the services, set by the kmesh.net/outlier-detection annotation,
+currently ejects in the bpf maps of a kmesh daemon, with the reason and the time left until they get new
+connections again. With --clear the connect failures of the ejected backends are reset, which re-admits them
+right away in all the services ejecting them instead of waiting for their ejection time. Only dual-engine
+mode is supported.`,
+		Example: `# List the ejected backends of all the services
+kmeshctl outliers <kmesh-daemon-pod>
+
+# List the ejected backends of the foo service of the default namespace
+kmeshctl outliers <kmesh-daemon-pod> default/foo.default.svc.cluster.local
+
+# Re-admit the ejected backends of the foo service
+kmeshctl outliers <kmesh-daemon-pod> default/foo.default.svc.cluster.local --clear
+
+# Print the ejected backends in json
+kmeshctl outliers <kmesh-daemon-pod> -o json`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var service string
+			if len(args) > 1 {
+				service = args[1]
+			}
+			if err := runOutliers(cmd.OutOrStdout(), args[0], service); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	utils.AddOutputFlag(cmd, &output)
+	cmd.Flags().BoolVar(&clearEjections, "clear", false, "re-admit the ejected backends")
+	return cmd
+}
+
+func runOutliers(w io.Writer, podName, service string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	if err != nil {
+		return fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	ejections, err := requestOutliers(fw.Address(), service, clearEjections)
+	if err != nil {
+		return err
+	}
+	return printEjections(w, ejections, clearEjections)
+}
+
+// requestOutliers returns the backends ejected by the outlier detection of the daemon whose status server
+// listens on address, the ones of service only if not empty. With readmit they are re-admitted.
+func requestOutliers(address, service string, readmit bool) ([]ejection, error) {
+	u := fmt.Sprintf("http://%s%s", address, patternOutliers)
+	if service != "" {
+		u += "?" + url.Values{"service": {service}}.Encode()
+	}
+	var (
+		resp *http.Response
+		err  error
+	)
+	if readmit {
+		resp, err = http.Post(u, "", nil)
+	} else {
+		resp, err = http.Get(u)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HTTP response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the outliers: %s", strings.TrimSpace(string(body)))
+	}
+	var ejections []ejection
+	if err := json.Unmarshal(body, &ejections); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the outliers: %w", err)
+	}
+	return ejections, nil
+}
+
+func printEjections(w io.Writer, ejections []ejection, cleared bool) error {
+	return utils.PrintOutput(w, output, ejections, func() error {
+		if len(ejections) == 0 {
+			fmt.Fprintln(w, "No backend is ejected")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVICE\tIP\tBACKEND\tFAILURES\tREMAINING\tREASON")
+		for _, e := range ejections {
+			remaining := (time.Duration(e.RemainingMs) * time.Millisecond).String()
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", e.Service, e.Ip, e.Backend, e.ConnectFailures, remaining, e.Reason)
+		}
+		_ = tw.Flush()
+		if cleared {
+			fmt.Fprintf(w, "\nRe-admitted %d ejected backends\n", len(ejections))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package outliers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ejectionsJson = `[
+    {
+        "service": "default/foo.default.svc.cluster.local",
+        "backend": "Kubernetes//Pod/default/foo-1",
+        "ip": "10.244.0.5",
+        "connectFailures": 5,
+        "reason": "5 connect failures in a row, ejected from 5 for 30s",
+        "remainingMs": 12500
+    }
+]`
+
+func TestRequestOutliers(t *testing.T) {
+	var method, service string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, patternOutliers, r.URL.Path)
+		method = r.Method
+		service = r.URL.Query().Get("service")
+		_, _ = w.Write([]byte(ejectionsJson))
+	}))
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "http://")
+
+	ejections, err := requestOutliers(address, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodGet, method)
+	assert.Empty(t, service)
+	assert.Equal(t, []ejection{{
+		Service:         "default/foo.default.svc.cluster.local",
+		Backend:         "Kubernetes//Pod/default/foo-1",
+		Ip:              "10.244.0.5",
+		ConnectFailures: 5,
+		Reason:          "5 connect failures in a row, ejected from 5 for 30s",
+		RemainingMs:     12500,
+	}}, ejections)
+
+	// --clear re-admits the ejected backends of the service
+	_, err = requestOutliers(address, "default/foo.default.svc.cluster.local", true)
+	require.NoError(t, err)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "default/foo.default.svc.cluster.local", service)
+}
+
+func TestRequestOutliersError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte("\tInvalid Client Mode\n"))
+	}))
+	defer srv.Close()
+
+	_, err := requestOutliers(strings.TrimPrefix(srv.URL, "http://"), "", false)
+	assert.EqualError(t, err, "failed to get the outliers: Invalid Client Mode")
+}
+
+func TestPrintEjections(t *testing.T) {
+	ejections := []ejection{{
+		Service:         "default/foo.default.svc.cluster.local",
+		Backend:         "Kubernetes//Pod/default/foo-1",
+		Ip:              "10.244.0.5",
+		ConnectFailures: 5,
+		Reason:          "5 connect failures in a row, ejected from 5 for 30s",
+		RemainingMs:     12500,
+	}}
+
+	var out bytes.Buffer
+	require.NoError(t, printEjections(&out, ejections, false))
+	assert.Equal(t, `SERVICE                                IP          BACKEND                        FAILURES  REMAINING  REASON
+default/foo.default.svc.cluster.local  10.244.0.5  Kubernetes//Pod/default/foo-1  5         12.5s      5 connect failures in a row, ejected from 5 for 30s
+`, out.String())
+
+	out.Reset()
+	require.NoError(t, printEjections(&out, ejections, true))
+	assert.True(t, strings.HasSuffix(out.String(), "\nRe-admitted 1 ejected backends\n"))
+
+	out.Reset()
+	require.NoError(t, printEjections(&out, nil, false))
+	assert.Equal(t, "No backend is ejected\n", out.String())
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/profile")
+
+// profileTypes are the supported profiles and the pprof endpoints serving them
+var profileTypes = map[string]string{
+	"cpu":       "profile",
+	"heap":      "heap",
+	"allocs":    "allocs",
+	"goroutine": "goroutine",
+	"block":     "block",
+	"mutex":     "mutex",
+}
+
+var (
+	profileType string
+	seconds     int
+	file        string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile <kmesh-daemon-pod>",
+		Short: "Collect a go runtime profile of a kmesh daemon",
+		Long: `Collect a go runtime profile of a kmesh daemon to a local file, to be analyzed with go tool pprof.
+The cpu profile is sampled for the given seconds, the other profiles are a snapshot.
+The kmesh daemon serves the profiles only when started with --enable-pprof.`,
+		Example: `# Collect a cpu profile of 30 seconds to <kmesh-daemon-pod>-cpu.pprof
+kmeshctl profile <kmesh-daemon-pod> --type cpu --seconds 30
+
+# Collect a heap profile to heap.pprof
+kmeshctl profile <kmesh-daemon-pod> --type heap --file heap.pprof`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runProfile(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&profileType, "type", "cpu", "type of the profile, one of: cpu, heap, allocs, goroutine, block, mutex")
+	cmd.Flags().IntVar(&seconds, "seconds", 30, "duration of the cpu profile in seconds")
+	cmd.Flags().StringVar(&file, "file", "", "file to write the profile to, <kmesh-daemon-pod>-<type>.pprof if empty")
+	return cmd
+}
+
+func runProfile(w io.Writer, podName string) error {
+	if file == "" {
+		file = fmt.Sprintf("%s-%s.pprof", podName, profileType)
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	fw, err := cli.NewPortForwarder(podName, utils.KmeshNamespace, "", 0, utils.KmeshPprofPort)
+	if err != nil {
+		return fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if profileType == "cpu" {
+		fmt.Fprintf(w, "collecting the cpu profile of %s for %d seconds\n", podName, seconds)
+	}
+	if err := collectProfile(fw.Address(), profileType, seconds, file); err != nil {
+		return fmt.Errorf("failed to collect the %s profile of pod %s: %w", profileType, podName, err)
+	}
+	fmt.Fprintf(w, "%s profile written to %s\n", profileType, file)
+	return nil
+}
+
+// collectProfile gets the profile of type from the pprof endpoint at address and writes it to file
+func collectProfile(address, profileType string, seconds int, file string) error {
+	endpoint, ok := profileTypes[profileType]
+	if !ok {
+		return fmt.Errorf("unsupported profile type %q", profileType)
+	}
+	url := fmt.Sprintf("http://%s/debug/pprof/%s", address, endpoint)
+	timeout := requestTimeout
+	if profileType == "cpu" {
+		if seconds <= 0 {
+			return fmt.Errorf("invalid seconds %d, should be positive", seconds)
+		}
+		url += fmt.Sprintf("?seconds=%d", seconds)
+		timeout += time.Duration(seconds) * time.Second
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the profile: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("pprof is not served, is the kmesh daemon started with --enable-pprof?")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if err := validateProfile(data); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// validateProfile checks data is a gzip compressed protobuf, the format of the pprof profiles
+func validateProfile(data []byte) error {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("invalid profile: %w", err)
+	}
+	for len(raw) > 0 {
+		_, _, n := protowire.ConsumeField(raw)
+		if n < 0 {
+			return fmt.Errorf("invalid profile: %v", protowire.ParseError(n))
+		}
+		raw = raw[n:]
+	}
+	return nil
+}
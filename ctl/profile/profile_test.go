@@ -0,0 +1,63 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package profile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectProfile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	for _, profileType := range []string{"cpu", "heap", "goroutine"} {
+		t.Run(profileType, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), profileType+".pprof")
+			require.NoError(t, collectProfile(address, profileType, 1, file))
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			assert.NoError(t, validateProfile(data))
+		})
+	}
+
+	file := filepath.Join(t.TempDir(), "trace.pprof")
+	assert.ErrorContains(t, collectProfile(address, "trace", 1, file), "unsupported profile type")
+	assert.ErrorContains(t, collectProfile(address, "cpu", 0, file), "invalid seconds")
+	assert.NoFileExists(t, file)
+
+	// the daemon does not serve pprof without --enable-pprof
+	notServed := httptest.NewServer(http.NotFoundHandler())
+	defer notServed.Close()
+	assert.ErrorContains(t, collectProfile(strings.TrimPrefix(notServed.URL, "http://"), "heap", 1, file), "--enable-pprof")
+}
+
+func TestValidateProfile(t *testing.T) {
+	assert.ErrorContains(t, validateProfile([]byte("<html>not a profile</html>")), "invalid profile")
+}
@@ -0,0 +1,248 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const (
+	DaemonSetName = "kmesh"
+
+	// the annotation `kubectl rollout restart` patches the pod template with
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+)
+
+var log = logger.NewLoggerScope("kmeshctl/restart")
+
+// pollInterval is the interval the rollout status is polled at
+var pollInterval = 2 * time.Second
+
+var (
+	node         string
+	stallTimeout time.Duration
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Restart the Kmesh daemons and wait for them to be ready",
+		Long: `Restart the Kmesh daemons by rolling the Kmesh DaemonSet, like kubectl rollout restart does, and wait
+for the rollout to complete. The daemons are restarted node by node, following the update strategy of the
+DaemonSet, and each daemon is given its termination grace period to drain its node. The progress is reported
+as the daemons become ready. With --node only the daemon of the given node is restarted.
+The command fails when the rollout makes no progress within --timeout.`,
+		Example: `# Restart the Kmesh daemons of all the nodes
+kmeshctl restart
+
+# Restart the Kmesh daemon of a node
+kmeshctl restart --node <node>`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cli, err := utils.CreateKubeClient()
+			if err != nil {
+				utils.Exit(log, fmt.Errorf("failed to create cli client: %w", err))
+			}
+
+			if node != "" {
+				err = RestartNode(context.Background(), cli.Kube(), cmd.OutOrStdout(), node)
+			} else {
+				err = RestartDaemonSet(context.Background(), cli.Kube(), cmd.OutOrStdout())
+			}
+			if err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&node, "node", "", "node whose Kmesh daemon is restarted, all the nodes if empty")
+	cmd.Flags().DurationVar(&stallTimeout, "timeout", 5*time.Minute, "time the rollout may make no progress for before the restart fails")
+	return cmd
+}
+
+// RestartDaemonSet rolls the Kmesh DaemonSet and waits for the daemons of all the nodes to be restarted
+func RestartDaemonSet(ctx context.Context, client kubernetes.Interface, w io.Writer) error {
+	// the daemons running before the restart, by node
+	before, err := daemonsByNode(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`,
+		restartedAtAnnotation, time.Now().Format(time.RFC3339))
+	_, err = client.AppsV1().DaemonSets(utils.KmeshNamespace).Patch(ctx, DaemonSetName, types.StrategicMergePatchType,
+		[]byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch daemonset %s/%s: %w", utils.KmeshNamespace, DaemonSetName, err)
+	}
+	fmt.Fprintf(w, "Restarting the Kmesh daemons of %d nodes\n", len(before))
+
+	restarted := make(map[string]bool, len(before))
+	var lastStatus string
+	return waitForProgress(ctx, func() (bool, bool, error) {
+		progressed := false
+		daemons, err := daemonsByNode(ctx, client)
+		if err != nil {
+			return false, false, err
+		}
+		for nodeName, pod := range daemons {
+			if restarted[nodeName] || !podReady(pod) {
+				continue
+			}
+			if old, ok := before[nodeName]; ok && old.UID == pod.UID {
+				continue
+			}
+			restarted[nodeName] = true
+			progressed = true
+			fmt.Fprintf(w, "Kmesh daemon %s on node %s is ready\n", pod.Name, nodeName)
+		}
+
+		ds, err := client.AppsV1().DaemonSets(utils.KmeshNamespace).Get(ctx, DaemonSetName, metav1.GetOptions{})
+		if err != nil {
+			return false, false, fmt.Errorf("failed to get daemonset %s/%s: %w", utils.KmeshNamespace, DaemonSetName, err)
+		}
+		done, status := rolloutStatus(ds)
+		if status != lastStatus {
+			lastStatus = status
+			progressed = true
+			fmt.Fprintln(w, status)
+		}
+		return done, progressed, nil
+	})
+}
+
+// RestartNode deletes the Kmesh daemon of the node and waits for the DaemonSet to start a new one
+func RestartNode(ctx context.Context, client kubernetes.Interface, w io.Writer, nodeName string) error {
+	daemons, err := daemonsByNode(ctx, client)
+	if err != nil {
+		return err
+	}
+	old, ok := daemons[nodeName]
+	if !ok {
+		return fmt.Errorf("no Kmesh daemon runs on node %s", nodeName)
+	}
+
+	// the deletion honors the termination grace period of the daemon, which drains the node meanwhile
+	if err := client.CoreV1().Pods(utils.KmeshNamespace).Delete(ctx, old.Name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("failed to delete Kmesh daemon %s: %w", old.Name, err)
+	}
+	fmt.Fprintf(w, "Restarting Kmesh daemon %s on node %s\n", old.Name, nodeName)
+
+	var lastPod string
+	return waitForProgress(ctx, func() (bool, bool, error) {
+		daemons, err := daemonsByNode(ctx, client)
+		if err != nil {
+			return false, false, err
+		}
+		pod, ok := daemons[nodeName]
+		if !ok || pod.UID == old.UID {
+			return false, false, nil
+		}
+		if podReady(pod) {
+			fmt.Fprintf(w, "Kmesh daemon %s on node %s is ready\n", pod.Name, nodeName)
+			return true, true, nil
+		}
+		if pod.Name != lastPod {
+			lastPod = pod.Name
+			fmt.Fprintf(w, "Waiting for Kmesh daemon %s on node %s to be ready\n", pod.Name, nodeName)
+			return false, true, nil
+		}
+		return false, false, nil
+	})
+}
+
+// waitForProgress polls the check until it reports done, it fails when the check reports no progress within the stall timeout
+func waitForProgress(ctx context.Context, check func() (done bool, progressed bool, err error)) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	lastProgress := time.Now()
+	for {
+		done, progressed, err := check()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		if progressed {
+			lastProgress = time.Now()
+		} else if time.Since(lastProgress) > stallTimeout {
+			return fmt.Errorf("the rollout made no progress for %v, check the Kmesh daemons with `kubectl -n %s get pods -l %s`",
+				stallTimeout, utils.KmeshNamespace, utils.KmeshLabel)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolloutStatus returns whether the rollout of the DaemonSet is complete and a message about its progress
+func rolloutStatus(ds *appsv1.DaemonSet) (bool, string) {
+	if ds.Generation > ds.Status.ObservedGeneration {
+		return false, "Waiting for the restart to be observed by the DaemonSet controller"
+	}
+	desired := ds.Status.DesiredNumberScheduled
+	if ds.Status.UpdatedNumberScheduled < desired {
+		return false, fmt.Sprintf("%d of %d Kmesh daemons restarted", ds.Status.UpdatedNumberScheduled, desired)
+	}
+	if ds.Status.NumberAvailable < desired {
+		return false, fmt.Sprintf("%d of %d restarted Kmesh daemons available", ds.Status.NumberAvailable, desired)
+	}
+	return true, fmt.Sprintf("All %d Kmesh daemons restarted", desired)
+}
+
+// daemonsByNode returns the running Kmesh daemons, by the node they run on
+func daemonsByNode(ctx context.Context, client kubernetes.Interface) (map[string]*corev1.Pod, error) {
+	pods, err := client.CoreV1().Pods(utils.KmeshNamespace).List(ctx, metav1.ListOptions{LabelSelector: utils.KmeshLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Kmesh daemons: %w", err)
+	}
+	daemons := make(map[string]*corev1.Pod, len(pods.Items))
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		daemons[pod.Spec.NodeName] = pod
+	}
+	return daemons, nil
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
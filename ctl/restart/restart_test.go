@@ -0,0 +1,131 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package restart
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kmesh.net/kmesh/ctl/utils"
+)
+
+func daemon(name, nodeName string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: utils.KmeshNamespace,
+			UID:       types.UID(name),
+			Labels:    map[string]string{"app": "kmesh"},
+		},
+		Spec: corev1.PodSpec{NodeName: nodeName},
+		Status: corev1.PodStatus{
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Generation: 2}}
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 1, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}
+	done, status := rolloutStatus(ds)
+	assert.False(t, done)
+	assert.Equal(t, "Waiting for the restart to be observed by the DaemonSet controller", status)
+
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 1, NumberAvailable: 2}
+	done, status = rolloutStatus(ds)
+	assert.False(t, done)
+	assert.Equal(t, "1 of 3 Kmesh daemons restarted", status)
+
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 2}
+	done, status = rolloutStatus(ds)
+	assert.False(t, done)
+	assert.Equal(t, "2 of 3 restarted Kmesh daemons available", status)
+
+	ds.Status = appsv1.DaemonSetStatus{ObservedGeneration: 2, DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3}
+	done, status = rolloutStatus(ds)
+	assert.True(t, done)
+	assert.Equal(t, "All 3 Kmesh daemons restarted", status)
+}
+
+func TestRestartNode(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	stallTimeout = 5 * time.Second
+	client := fake.NewSimpleClientset(daemon("kmesh-a", "node-a", true), daemon("kmesh-b", "node-b", true))
+
+	// the daemonset controller starts a new daemon once the old one is deleted
+	go func() {
+		pods := client.CoreV1().Pods(utils.KmeshNamespace)
+		for {
+			if _, err := pods.Get(context.Background(), "kmesh-a", metav1.GetOptions{}); err != nil {
+				break
+			}
+			time.Sleep(pollInterval)
+		}
+		_, _ = pods.Create(context.Background(), daemon("kmesh-c", "node-a", false), metav1.CreateOptions{})
+		time.Sleep(5 * pollInterval)
+		_, _ = pods.Update(context.Background(), daemon("kmesh-c", "node-a", true), metav1.UpdateOptions{})
+	}()
+
+	var out bytes.Buffer
+	require.NoError(t, RestartNode(context.Background(), client, &out, "node-a"))
+	assert.Equal(t, `Restarting Kmesh daemon kmesh-a on node node-a
+Waiting for Kmesh daemon kmesh-c on node node-a to be ready
+Kmesh daemon kmesh-c on node node-a is ready
+`, out.String())
+
+	// the daemon of the other node is left alone
+	_, err := client.CoreV1().Pods(utils.KmeshNamespace).Get(context.Background(), "kmesh-b", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	assert.ErrorContains(t, RestartNode(context.Background(), client, &out, "node-x"), "no Kmesh daemon runs on node node-x")
+}
+
+func TestRestartDaemonSetStalled(t *testing.T) {
+	pollInterval = 10 * time.Millisecond
+	stallTimeout = 100 * time.Millisecond
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: DaemonSetName, Namespace: utils.KmeshNamespace},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 1, NumberAvailable: 1},
+	}
+	client := fake.NewSimpleClientset(ds, daemon("kmesh-a", "node-a", true))
+
+	// no controller rolls the daemonset, so the restart stalls
+	var out bytes.Buffer
+	err := RestartDaemonSet(context.Background(), client, &out)
+	assert.ErrorContains(t, err, "the rollout made no progress for 100ms")
+	assert.Equal(t, `Restarting the Kmesh daemons of 1 nodes
+0 of 1 Kmesh daemons restarted
+`, out.String())
+
+	got, err := client.AppsV1().DaemonSets(utils.KmeshNamespace).Get(context.Background(), DaemonSetName, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, got.Spec.Template.Annotations, restartedAtAnnotation)
+}
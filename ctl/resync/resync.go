@@ -0,0 +1,89 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package resync
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const patternResync = "/debug/resync"
+
+var log = logger.NewLoggerScope("kmeshctl/resync")
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resync <kmesh-daemon-pod>",
+		Short: "Force a kmesh daemon to resync its xds state",
+		Long: `Force a kmesh daemon to drop the state it received from xds and resubscribe, when the state
+looks stale. The daemon receives the full state from istiod again and applies it to the bpf maps,
+the services, workloads and authorization policies istiod no longer has are removed. The connections
+are served with the state loaded meanwhile. Only dual-engine mode is supported.`,
+		Example: `# Resync the xds state of a kmesh daemon
+kmeshctl resync <kmesh-daemon-pod>`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runResync(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	return cmd
+}
+
+func runResync(w io.Writer, podName string) error {
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	if err != nil {
+		return fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	if err := requestResync(fw.Address()); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Kmesh daemon %s is resyncing its xds state\n", podName)
+	return nil
+}
+
+// requestResync asks the daemon whose status server listens on address to resync
+func requestResync(address string) error {
+	resp, err := http.Post(fmt.Sprintf("http://%s%s", address, patternResync), "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to resync: %s", strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -20,7 +20,8 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
-	"os"
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -67,8 +68,7 @@ func GeneralSecret(cmd *cobra.Command, args []string) {
 
 	clientset, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to connect k8s client, %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to connect k8s client, %w", err))
 	}
 
 	ipSecKey.AeadKeyName = AeadAlgoName
@@ -76,19 +76,16 @@ func GeneralSecret(cmd *cobra.Command, args []string) {
 	aeadKeyArg, _ := cmd.Flags().GetString("key")
 
 	if strings.Compare(aeadKeyArg, "") == 0 {
-		log.Errorf("no param --key or -k, we need a encryption key")
-		os.Exit(1)
+		utils.Exit(log, errors.New("no param --key or -k, we need a encryption key"))
 	}
 
 	aeadKey, err := hex.DecodeString(aeadKeyArg)
 	if err != nil {
-		log.Errorf("invalid input argument, %v, input: %v", err, aeadKeyArg)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("invalid input argument, %v, input: %v", err, aeadKeyArg))
 	}
 
 	if len(aeadKey) != 36 {
-		log.Errorf("The key length is not enough!. It requires 36 characters(256-bit key + 32-bit salt)")
-		os.Exit(1)
+		utils.Exit(log, errors.New("The key length is not enough!. It requires 36 characters(256-bit key + 32-bit salt)"))
 	}
 
 	ipSecKey.AeadKey = aeadKey
@@ -98,23 +95,20 @@ func GeneralSecret(cmd *cobra.Command, args []string) {
 	secretOld, err := clientset.Kube().CoreV1().Secrets(utils.KmeshNamespace).Get(context.TODO(), SecretName, metav1.GetOptions{})
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			log.Errorf("failed to get secret: %v, %v", SecretName, err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to get secret: %v, %w", SecretName, err))
 		}
 		ipSecKey.Spi = 1
 	} else {
 		err = json.Unmarshal(secretOld.Data["ipSec"], &ipSecKeyOld)
 		if err != nil {
-			log.Errorf("failed to unmarshal secret: %v, %v", secretOld, err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to unmarshal secret: %v, %w", secretOld, err))
 		}
 		ipSecKey.Spi = ipSecKeyOld.Spi + 1
 	}
 
 	secretData, err := json.Marshal(ipSecKey)
 	if err != nil {
-		log.Errorf("failed to convert ipsec key to secret data, %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to convert ipsec key to secret data, %w", err))
 	}
 
 	secret := &corev1.Secret{
@@ -130,14 +124,12 @@ func GeneralSecret(cmd *cobra.Command, args []string) {
 	if ipSecKey.Spi == 1 {
 		_, err = clientset.Kube().CoreV1().Secrets(utils.KmeshNamespace).Create(context.TODO(), secret, metav1.CreateOptions{})
 		if err != nil {
-			log.Errorf("failed to create %v secret, %v", SecretName, err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to create %v secret, %w", SecretName, err))
 		}
 	} else {
 		_, err = clientset.Kube().CoreV1().Secrets(utils.KmeshNamespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
 		if err != nil {
-			log.Errorf("failed to update %v secret, %v", SecretName, err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to update %v secret, %w", SecretName, err))
 		}
 	}
 }
@@ -0,0 +1,142 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/adminclient"
+	"kmesh.net/kmesh/pkg/kube"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/status")
+
+var output string
+
+// daemonStatus is the status of a kmesh daemon, error tells why it could not be queried
+type daemonStatus struct {
+	Pod     string `json:"pod"`
+	Node    string `json:"node"`
+	Mode    string `json:"mode,omitempty"`
+	Version string `json:"version,omitempty"`
+	Kernel  string `json:"kernel,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status [<kmesh-daemon-pod>]",
+		Short: "Show the mode each kmesh daemon runs in, its version and the kernel of its node",
+		Long: `Show the mode each kmesh daemon runs in, kernel-native or dual-engine, with its version and the kernel
+of its node. The mode is the one of the controller the daemon started, a daemon whose controller has not
+started yet has no mode. Without a pod all the kmesh daemons are shown.`,
+		Example: `# Show the status of all the kmesh daemons
+kmeshctl status
+
+# Show the status of a kmesh daemon
+kmeshctl status <kmesh-daemon-pod>
+
+# Print the status in json
+kmeshctl status -o json`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runStatus(cmd.OutOrStdout(), args); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runStatus(w io.Writer, args []string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	podList, err := cli.PodsForSelector(context.TODO(), utils.KmeshNamespace, utils.KmeshLabel)
+	if err != nil {
+		return fmt.Errorf("failed to get kmesh daemon pods: %w", err)
+	}
+
+	var statuses []daemonStatus
+	for _, pod := range podList.Items {
+		if len(args) > 0 && pod.Name != args[0] {
+			continue
+		}
+		statuses = append(statuses, getStatus(cli, pod.Name, pod.Spec.NodeName))
+	}
+	if len(args) > 0 && len(statuses) == 0 {
+		return fmt.Errorf("kmesh daemon pod %s not found", args[0])
+	}
+
+	return utils.PrintOutput(w, output, statuses, func() error {
+		return printStatus(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), statuses)
+	})
+}
+
+func getStatus(cli kube.CLIClient, podName, node string) daemonStatus {
+	status := daemonStatus{Pod: podName, Node: node}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.GetStatus(ctx, &adminapi.GetStatusRequest{})
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to get the status: %v", err)
+		return status
+	}
+	status.Mode = adminclient.FormatMode(resp.GetMode())
+	status.Version = resp.GetVersion()
+	status.Kernel = resp.GetKernel()
+	return status
+}
+
+func printStatus(w *tabwriter.Writer, statuses []daemonStatus) error {
+	fmt.Fprintln(w, "POD\tNODE\tMODE\tVERSION\tKERNEL\tERROR")
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	for _, s := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Pod, orDash(s.Node), orDash(s.Mode), orDash(s.Version),
+			orDash(s.Kernel), orDash(s.Error))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintStatus(t *testing.T) {
+	var buf bytes.Buffer
+	err := printStatus(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), []daemonStatus{
+		{Pod: "kmesh-5xk2p", Node: "worker-1", Mode: "dual-engine", Version: "v1.1.0", Kernel: "6.1.0-18-amd64"},
+		{Pod: "kmesh-9fq7d", Node: "worker-2", Mode: "kernel-native", Version: "v1.1.0", Kernel: "5.10.0-153.12.0.92.oe2203sp2.x86_64"},
+		{Pod: "kmesh-h2rzc", Node: "worker-3", Error: "failed to get the status: connection refused"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `POD           NODE       MODE            VERSION   KERNEL                                ERROR
+kmesh-5xk2p   worker-1   dual-engine     v1.1.0    6.1.0-18-amd64                        -
+kmesh-9fq7d   worker-2   kernel-native   v1.1.0    5.10.0-153.12.0.92.oe2203sp2.x86_64   -
+kmesh-h2rzc   worker-3   -               -         -                                     failed to get the status: connection refused
+`, buf.String())
+}
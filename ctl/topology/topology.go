@@ -0,0 +1,272 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/kube"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+
+	outputDot = "dot"
+)
+
+var log = logger.NewLoggerScope("kmeshctl/topology")
+
+var output string
+
+// configDump is the part of the dual-engine config dump of a daemon listing the services
+type configDump struct {
+	Services []struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		Hostname  string `json:"hostname"`
+	} `json:"services"`
+}
+
+// topology is how the connections from the node of a daemon to the services are spread over their backends
+type topology struct {
+	Pod      string            `json:"pod"`
+	Node     string            `json:"node"`
+	Services []serviceTopology `json:"services"`
+}
+
+type serviceTopology struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Hostname  string `json:"hostname"`
+	// Mode is the locality load balancing mode, random if none
+	Mode     string `json:"mode"`
+	Locality string `json:"locality,omitempty"`
+	Tiers    []tier `json:"tiers"`
+	// Failovers are the edges from a tier to the one its connections fail over to
+	Failovers []failover `json:"failovers,omitempty"`
+}
+
+type tier struct {
+	Priority uint32    `json:"priority"`
+	Load     uint32    `json:"load"`
+	Backends []backend `json:"backends"`
+}
+
+type backend struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Address   string `json:"address"`
+	Node      string `json:"node,omitempty"`
+	Locality  string `json:"locality,omitempty"`
+	Healthy   bool   `json:"healthy"`
+}
+
+type failover struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "topology <kmesh-daemon-pod> [<namespace>/<service-name>]",
+		Short: "Export the services, their locality tiers and backends as seen by a kmesh daemon as a graph",
+		Long: `Export the services known to a kmesh daemon with their backends grouped in the locality tiers the
+data plane of the daemon's node ranks them in, as a Graphviz graph to render with dot, e.g.
+kmeshctl topology <pod> | dot -Tsvg > topology.svg. Each edge from a service to a tier is labeled with
+the percent of the connections the tier receives, dashed edges between tiers are the failovers of the
+services in failover mode and unhealthy backends are drawn in red. Only dual-engine mode is supported.`,
+		Example: `# Export the topology of all the services
+kmeshctl topology <kmesh-daemon-pod> > topology.dot
+
+# Render the topology of the foo service of the default namespace
+kmeshctl topology <kmesh-daemon-pod> default/foo | dot -Tpng > foo.png
+
+# Print the topology in json
+kmeshctl topology <kmesh-daemon-pod> -o json`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var service string
+			if len(args) > 1 {
+				service = args[1]
+			}
+			if err := runTopology(cmd.OutOrStdout(), args[0], service); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", outputDot, "output format, one of: dot|json")
+	return cmd
+}
+
+func runTopology(w io.Writer, podName, service string) error {
+	if err := utils.ValidateOutput(output, outputDot); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	topo, err := getTopology(cli, podName, service)
+	if err != nil {
+		return err
+	}
+
+	return utils.PrintOutput(w, output, topo, func() error {
+		return printDot(w, topo)
+	})
+}
+
+// getTopology simulates the locality load balancing of the services, the one <namespace>/<name> only
+// if service is not empty, for a client on the node of the daemon
+func getTopology(cli kube.CLIClient, podName, service string) (*topology, error) {
+	pod, err := cli.Kube().CoreV1().Pods(utils.KmeshNamespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kmesh daemon pod %s: %w", podName, err)
+	}
+
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_DUAL_ENGINE})
+	if err != nil {
+		return nil, fmt.Errorf("failed to dump the config of pod %s: %w", podName, err)
+	}
+	var dump configDump
+	if err := json.Unmarshal([]byte(resp.GetJson()), &dump); err != nil {
+		return nil, fmt.Errorf("failed to parse the config dump of pod %s: %w", podName, err)
+	}
+
+	topo := &topology{Pod: podName, Node: pod.Spec.NodeName}
+	for _, svc := range dump.Services {
+		if service != "" && service != svc.Namespace+"/"+svc.Name {
+			continue
+		}
+		simulation, err := client.SimulateLocality(ctx, &adminapi.SimulateLocalityRequest{
+			Namespace:  svc.Namespace,
+			Name:       svc.Name,
+			ClientNode: topo.Node,
+		})
+		if err != nil {
+			log.Warnf("skip service %s/%s: %v", svc.Namespace, svc.Name, err)
+			continue
+		}
+		topo.Services = append(topo.Services, newServiceTopology(svc.Namespace, svc.Name, svc.Hostname, simulation))
+	}
+	if service != "" && len(topo.Services) == 0 {
+		return nil, fmt.Errorf("service %s not found in pod %s", service, podName)
+	}
+	slices.SortFunc(topo.Services, func(a, b serviceTopology) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return topo, nil
+}
+
+func newServiceTopology(namespace, name, hostname string, simulation *adminapi.LocalitySimulation) serviceTopology {
+	st := serviceTopology{
+		Namespace: namespace,
+		Name:      name,
+		Hostname:  hostname,
+		Mode:      strings.ToLower(simulation.GetMode()),
+		Locality:  simulation.GetClientLocality(),
+	}
+	if st.Mode == "unspecified_mode" {
+		st.Mode = "random"
+	}
+	for _, t := range simulation.GetTiers() {
+		ti := tier{Priority: t.GetPriority(), Load: t.GetLoad()}
+		for _, ep := range t.GetEndpoints() {
+			ti.Backends = append(ti.Backends, backend{
+				Namespace: ep.GetNamespace(),
+				Name:      ep.GetName(),
+				Address:   ep.GetAddress(),
+				Node:      ep.GetNode(),
+				Locality:  ep.GetLocality(),
+				Healthy:   ep.GetHealthy(),
+			})
+		}
+		// the connections only fail over from a tier to the next non-empty one in failover mode
+		if st.Mode == "failover" && len(st.Tiers) > 0 {
+			st.Failovers = append(st.Failovers, failover{From: st.Tiers[len(st.Tiers)-1].Priority, To: ti.Priority})
+		}
+		st.Tiers = append(st.Tiers, ti)
+	}
+	return st
+}
+
+// printDot prints the topology as a Graphviz digraph with a cluster per service
+func printDot(w io.Writer, topo *topology) error {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n")
+	b.WriteString("  rankdir=LR;\n")
+	fmt.Fprintf(&b, "  label=%q;\n", fmt.Sprintf("kmesh daemon %s on node %s", topo.Pod, topo.Node))
+	b.WriteString("  node [fontname=\"Helvetica\"];\n")
+	for _, svc := range topo.Services {
+		id := svc.Namespace + "/" + svc.Name
+		label := fmt.Sprintf("%s (%s)", id, svc.Mode)
+		if svc.Locality != "" {
+			label += "\nclient locality " + svc.Locality
+		}
+		fmt.Fprintf(&b, "  subgraph %q {\n", "cluster_"+id)
+		fmt.Fprintf(&b, "    label=%q;\n", label)
+		fmt.Fprintf(&b, "    %q [shape=box, label=%q];\n", "svc:"+id, svc.Hostname)
+		for _, t := range svc.Tiers {
+			tierId := fmt.Sprintf("tier:%s/%d", id, t.Priority)
+			style := "solid"
+			if t.Load == 0 {
+				style = "dashed"
+			}
+			fmt.Fprintf(&b, "    %q [shape=ellipse, style=%s, label=%q];\n", tierId, style, fmt.Sprintf("tier %d", t.Priority))
+			fmt.Fprintf(&b, "    %q -> %q [style=%s, label=%q];\n", "svc:"+id, tierId, style, fmt.Sprintf("%d%%", t.Load))
+			for _, be := range t.Backends {
+				backendId := fmt.Sprintf("backend:%s/%s/%s", id, be.Namespace, be.Name)
+				color := "black"
+				if !be.Healthy {
+					color = "red"
+				}
+				fmt.Fprintf(&b, "    %q [shape=box, style=rounded, color=%s, label=%q];\n", backendId, color,
+					fmt.Sprintf("%s/%s\n%s\n%s", be.Namespace, be.Name, be.Address, be.Locality))
+				fmt.Fprintf(&b, "    %q -> %q;\n", tierId, backendId)
+			}
+		}
+		for _, f := range svc.Failovers {
+			fmt.Fprintf(&b, "    %q -> %q [style=dashed, color=orange, label=\"failover\"];\n",
+				fmt.Sprintf("tier:%s/%d", id, f.From), fmt.Sprintf("tier:%s/%d", id, f.To))
+		}
+		b.WriteString("  }\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
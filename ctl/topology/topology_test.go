@@ -0,0 +1,103 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package topology
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestNewServiceTopology(t *testing.T) {
+	simulation := &adminapi.LocalitySimulation{
+		Mode:           "FAILOVER",
+		ClientLocality: "r1/z1/s1",
+		Tiers: []*adminapi.LocalityTier{
+			{Priority: 0, Load: 100, Endpoints: []*adminapi.LocalityEndpoint{
+				{Namespace: "default", Name: "foo-a", Address: "10.244.0.5", Node: "worker-1", Locality: "r1/z1/s1", Healthy: true},
+			}},
+			{Priority: 2, Endpoints: []*adminapi.LocalityEndpoint{
+				{Namespace: "default", Name: "foo-b", Address: "10.244.1.5", Node: "worker-2", Locality: "r1/z2/s1", Healthy: true},
+			}},
+			{Priority: 3, Endpoints: []*adminapi.LocalityEndpoint{
+				{Namespace: "default", Name: "foo-c", Address: "10.244.2.5", Node: "worker-3", Locality: "r2/z1/s1"},
+			}},
+		},
+	}
+	st := newServiceTopology("default", "foo", "foo.default.svc.cluster.local", simulation)
+	assert.Equal(t, "failover", st.Mode)
+	assert.Equal(t, "r1/z1/s1", st.Locality)
+	require.Len(t, st.Tiers, 3)
+	// the empty priorities are skipped
+	assert.Equal(t, []failover{{From: 0, To: 2}, {From: 2, To: 3}}, st.Failovers)
+
+	// the other modes never fail over
+	simulation.Mode = "STRICT"
+	assert.Empty(t, newServiceTopology("default", "foo", "foo.default.svc.cluster.local", simulation).Failovers)
+	assert.Equal(t, "random", newServiceTopology("default", "bar", "bar.default.svc.cluster.local",
+		&adminapi.LocalitySimulation{Mode: "UNSPECIFIED_MODE"}).Mode)
+}
+
+func TestPrintDot(t *testing.T) {
+	topo := &topology{
+		Pod:  "kmesh-abcde",
+		Node: "worker-1",
+		Services: []serviceTopology{{
+			Namespace: "default",
+			Name:      "foo",
+			Hostname:  "foo.default.svc.cluster.local",
+			Mode:      "failover",
+			Locality:  "r1/z1/s1",
+			Tiers: []tier{
+				{Priority: 0, Load: 100, Backends: []backend{
+					{Namespace: "default", Name: "foo-a", Address: "10.244.0.5", Locality: "r1/z1/s1", Healthy: true},
+				}},
+				{Priority: 1, Backends: []backend{
+					{Namespace: "default", Name: "foo-b", Address: "10.244.1.5", Locality: "r1/z2/s1"},
+				}},
+			},
+			Failovers: []failover{{From: 0, To: 1}},
+		}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, printDot(&buf, topo))
+	expected := `digraph topology {
+  rankdir=LR;
+  label="kmesh daemon kmesh-abcde on node worker-1";
+  node [fontname="Helvetica"];
+  subgraph "cluster_default/foo" {
+    label="default/foo (failover)\nclient locality r1/z1/s1";
+    "svc:default/foo" [shape=box, label="foo.default.svc.cluster.local"];
+    "tier:default/foo/0" [shape=ellipse, style=solid, label="tier 0"];
+    "svc:default/foo" -> "tier:default/foo/0" [style=solid, label="100%"];
+    "backend:default/foo/default/foo-a" [shape=box, style=rounded, color=black, label="default/foo-a\n10.244.0.5\nr1/z1/s1"];
+    "tier:default/foo/0" -> "backend:default/foo/default/foo-a";
+    "tier:default/foo/1" [shape=ellipse, style=dashed, label="tier 1"];
+    "svc:default/foo" -> "tier:default/foo/1" [style=dashed, label="0%"];
+    "backend:default/foo/default/foo-b" [shape=box, style=rounded, color=red, label="default/foo-b\n10.244.1.5\nr1/z2/s1"];
+    "tier:default/foo/1" -> "backend:default/foo/default/foo-b";
+    "tier:default/foo/0" -> "tier:default/foo/1" [style=dashed, color=orange, label="failover"];
+  }
+}
+`
+	assert.Equal(t, expected, buf.String())
+}
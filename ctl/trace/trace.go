@@ -0,0 +1,153 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/controller/trace"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const patternTrace = "/debug/trace"
+
+var log = logger.NewLoggerScope("kmeshctl/trace")
+
+var (
+	src     string
+	dst     string
+	timeout time.Duration
+	output  string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trace <kmesh-daemon-pod>",
+		Short: "Follow connections through the data plane and print the decisions they hit",
+		Long: `Follow the connections matching --src and --dst through the data plane of a kmesh daemon
+and print the decisions they hit: policy verdict, chosen backend and locality tier.
+Connection reports are enabled on the daemon while tracing, and the connections to the
+workloads of its node matching --dst are authorized in userspace, the other ones keep
+their xdp authorization. The trace is disabled automatically after --timeout. Only
+dual-engine mode is supported.`,
+		Example: `# Trace connections from 10.0.0.5 to the helloworld service port 5000
+kmeshctl trace <kmesh-daemon-pod> --src 10.0.0.5 --dst helloworld:5000
+
+# Trace all connections to a service ip for 5 minutes, printing json events
+kmeshctl trace <kmesh-daemon-pod> --dst 10.96.0.10 --timeout 5m -o json`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runTrace(cmd.OutOrStdout(), args[0]); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&src, "src", "", "source ip of the connections to trace, empty matches all")
+	cmd.Flags().StringVar(&dst, "dst", "", "destination of the connections to trace, in form of <service name|ip>[:port], empty matches all")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "duration after which the trace is disabled, at most 10m")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runTrace(w io.Writer, podName string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+	// validate locally to fail before connecting to the daemon
+	if _, err := trace.ParseFilter(src, dst); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	fw, err := utils.CreateKmeshPortForwarder(cli, podName)
+	if err != nil {
+		return fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := utils.StartKmeshPortForwarder(fw, podName); err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	query := url.Values{}
+	query.Set("src", src)
+	query.Set("dst", dst)
+	query.Set("timeout", timeout.String())
+	resp, err := http.Get(fmt.Sprintf("http://%s%s?%s", fw.Address(), patternTrace, query.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to start trace: %s", strings.TrimSpace(string(body)))
+	}
+
+	fmt.Fprintf(os.Stderr, "tracing connections on %s for %v, press Ctrl+C to stop\n", podName, timeout)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if output == utils.OutputJson {
+			fmt.Fprintln(w, scanner.Text())
+			continue
+		}
+		var ev trace.Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			return fmt.Errorf("failed to unmarshal trace event: %w", err)
+		}
+		fmt.Fprintln(w, formatEvent(&ev))
+	}
+	return scanner.Err()
+}
+
+// formatEvent prints an event in a single human readable line
+func formatEvent(ev *trace.Event) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %-10s %s -> %s", ev.Time.Format(time.RFC3339), ev.Type, ev.Source, ev.Destination)
+	if ev.Verdict != "" {
+		fmt.Fprintf(&sb, " verdict=%s", ev.Verdict)
+	}
+	if ev.Service != "" {
+		fmt.Fprintf(&sb, " service=%s", ev.Service)
+	}
+	if ev.Backend != "" {
+		fmt.Fprintf(&sb, " backend=%s", ev.Backend)
+	}
+	if ev.LocalityTier != nil {
+		fmt.Fprintf(&sb, " locality_tier=%d", *ev.LocalityTier)
+	}
+	if ev.State != "" {
+		fmt.Fprintf(&sb, " state=%s", ev.State)
+	}
+	if ev.Reason != "" {
+		fmt.Fprintf(&sb, " reason=%q", ev.Reason)
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"kmesh.net/kmesh/pkg/controller/trace"
+)
+
+func Test_formatEvent(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tier := uint32(1)
+	tests := []struct {
+		name string
+		ev   trace.Event
+		want string
+	}{
+		{
+			name: "policy verdict",
+			ev: trace.Event{
+				Time:        now,
+				Type:        trace.EventTypePolicy,
+				Source:      "10.0.0.5",
+				Destination: "10.244.1.3:5000",
+				Backend:     "sample/helloworld-v1",
+				Verdict:     "DENY",
+			},
+			want: "2025-01-02T03:04:05Z policy     10.0.0.5 -> 10.244.1.3:5000 verdict=DENY backend=sample/helloworld-v1",
+		},
+		{
+			name: "routed to remote locality",
+			ev: trace.Event{
+				Time:         now,
+				Type:         trace.EventTypeConnection,
+				Source:       "10.0.0.5:43122",
+				Destination:  "10.244.1.3:5000",
+				Service:      "sample/helloworld.sample.svc.cluster.local",
+				Backend:      "sample/helloworld-v1",
+				LocalityTier: &tier,
+				State:        "BPF_TCP_ESTABLISHED",
+			},
+			want: "2025-01-02T03:04:05Z connection 10.0.0.5:43122 -> 10.244.1.3:5000 service=sample/helloworld.sample.svc.cluster.local backend=sample/helloworld-v1 locality_tier=1 state=BPF_TCP_ESTABLISHED",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatEvent(&tt.ev); got != tt.want {
+				t.Errorf("formatEvent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
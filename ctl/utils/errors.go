@@ -0,0 +1,143 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// The exit codes of kmeshctl, stable for the scripts calling it
+const (
+	// ExitGeneric is any failure without a more specific code, including the invalid arguments
+	ExitGeneric = 1
+	// ExitPodNotFound is the kmesh daemon pod or another kubernetes resource not being found
+	ExitPodNotFound = 2
+	// ExitDaemonUnreachable is the kmesh daemon not answering, through the port forwarder or the admin api
+	ExitDaemonUnreachable = 3
+	// ExitPermissionDenied is the kubernetes api or the daemon refusing the request of the user
+	ExitPermissionDenied = 4
+	// ExitDiverged is kmeshctl compare finding that the two daemons diverge
+	ExitDiverged = 5
+	// ExitCheckFailed is a check of kmeshctl check failing
+	ExitCheckFailed = 6
+)
+
+// exitReasons name the exit codes in the error messages
+var exitReasons = map[int]string{
+	ExitGeneric:           "error",
+	ExitPodNotFound:       "pod-not-found",
+	ExitDaemonUnreachable: "daemon-unreachable",
+	ExitPermissionDenied:  "permission-denied",
+	ExitDiverged:          "diverged",
+	ExitCheckFailed:       "check-failed",
+}
+
+// osExit is replaced in the tests
+var osExit = os.Exit
+
+// Error is a failure of kmeshctl with the code it exits with
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// NewError returns the error of format and args, which may wrap another error with %w, exiting with code
+func NewError(code int, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// ExitCode returns the code kmeshctl exits with on err. The code of an Error wins, else it is derived
+// from the errors of the kubernetes api, of the admin api and of the network err wraps.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	switch {
+	case apierrors.IsNotFound(err):
+		return ExitPodNotFound
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		return ExitPermissionDenied
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return ExitDaemonUnreachable
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return ExitPermissionDenied
+	}
+	var (
+		urlErr *url.Error
+		netErr *net.OpError
+	)
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) {
+		return ExitDaemonUnreachable
+	}
+	return ExitGeneric
+}
+
+// ExitReason returns the name of the exit code in the error messages
+func ExitReason(code int) string {
+	if reason, ok := exitReasons[code]; ok {
+		return reason
+	}
+	return exitReasons[ExitGeneric]
+}
+
+// Exit logs err with its reason and exit code, and exits with that code
+func Exit(log *logrus.Entry, err error) {
+	code := ExitCode(err)
+	log.WithFields(logrus.Fields{
+		"reason":    ExitReason(code),
+		"exit_code": code,
+	}).Error(err)
+	osExit(code)
+}
+
+// StartKmeshPortForwarder starts fw to the given Kmesh daemon pod. The error exits with ExitPodNotFound
+// if the pod does not exist, and with ExitDaemonUnreachable if the port cannot be forwarded to it.
+func StartKmeshPortForwarder(fw kube.PortForwarder, podName string) error {
+	if err := fw.Start(); err != nil {
+		code := ExitCode(err)
+		if code == ExitGeneric {
+			code = ExitDaemonUnreachable
+		}
+		return NewError(code, "failed to start port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	return nil
+}
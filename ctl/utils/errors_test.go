@@ -0,0 +1,126 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakePortForwarder fails to start with err
+type fakePortForwarder struct {
+	err error
+}
+
+func (f *fakePortForwarder) Start() error    { return f.err }
+func (f *fakePortForwarder) Address() string { return "127.0.0.1:0" }
+func (f *fakePortForwarder) Close()          {}
+
+func TestExitCode(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "no error",
+			err:  nil,
+			want: 0,
+		},
+		{
+			name: "generic",
+			err:  errors.New("failed to unmarshal the removed entries"),
+			want: ExitGeneric,
+		},
+		{
+			name: "pod not found",
+			err:  StartKmeshPortForwarder(&fakePortForwarder{err: fmt.Errorf("complete failed: %w", apierrors.NewNotFound(pods, "kmesh-abcde"))}, "kmesh-abcde"),
+			want: ExitPodNotFound,
+		},
+		{
+			name: "pod not running",
+			err:  StartKmeshPortForwarder(&fakePortForwarder{err: errors.New("unable to forward port because pod is not running")}, "kmesh-abcde"),
+			want: ExitDaemonUnreachable,
+		},
+		{
+			name: "port forward forbidden",
+			err:  StartKmeshPortForwarder(&fakePortForwarder{err: fmt.Errorf("complete failed: %w", apierrors.NewForbidden(pods, "kmesh-abcde", nil))}, "kmesh-abcde"),
+			want: ExitPermissionDenied,
+		},
+		{
+			name: "kube client unauthorized",
+			err:  fmt.Errorf("failed to get kmesh podList: %w", apierrors.NewUnauthorized("invalid token")),
+			want: ExitPermissionDenied,
+		},
+		{
+			name: "admin api unavailable",
+			err:  fmt.Errorf("failed to get logger names: %w", status.Error(codes.Unavailable, "connection refused")),
+			want: ExitDaemonUnreachable,
+		},
+		{
+			name: "admin api unavailable on the first rpc of every pod",
+			err:  errors.Join(fmt.Errorf("failed to set authz for pod kmesh-abcde: %w", status.Error(codes.Unavailable, "connection refused"))),
+			want: ExitDaemonUnreachable,
+		},
+		{
+			name: "daemons diverged",
+			err:  NewError(ExitDiverged, "kmesh daemons %s and %s diverge", "kmesh-abcde", "kmesh-fghij"),
+			want: ExitDiverged,
+		},
+		{
+			name: "explicit code wins",
+			err:  NewError(ExitPodNotFound, "no kmesh daemon pod on node %s", "node-1"),
+			want: ExitPodNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestExit(t *testing.T) {
+	var code int
+	osExit = func(c int) { code = c }
+	defer func() { osExit = os.Exit }()
+
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&out)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	err := StartKmeshPortForwarder(&fakePortForwarder{
+		err: fmt.Errorf("complete failed: %w", apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "kmesh-abcde")),
+	}, "kmesh-abcde")
+	Exit(logger.WithField("subsys", "kmeshctl/gc"), err)
+
+	assert.Equal(t, ExitPodNotFound, code)
+	assert.Equal(t, `level=error msg="failed to start port forwarder for Kmesh daemon pod kmesh-abcde: complete failed: pods \"kmesh-abcde\" not found" exit_code=2 reason=pod-not-found subsys=kmeshctl/gc`+"\n", out.String())
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// OutputJson is the json output format of the commands, they print a table by default
+const OutputJson = "json"
+
+// AddOutputFlag adds the -o flag choosing the output format of the command, a table or json
+func AddOutputFlag(cmd *cobra.Command, output *string) {
+	cmd.Flags().StringVarP(output, "output", "o", "", "output format, one of: json")
+}
+
+// ValidateOutput returns an error if output is neither the default format, json nor one of formats
+func ValidateOutput(output string, formats ...string) error {
+	if output != "" && output != OutputJson && !slices.Contains(formats, output) {
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+	return nil
+}
+
+// PrintOutput writes v to w indented in json if output is json, and with printTable otherwise. The protobuf
+// messages are written with their json mapping, unset fields included.
+func PrintOutput(w io.Writer, output string, v any, printTable func() error) error {
+	if output != OutputJson {
+		return printTable()
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if m, ok := v.(proto.Message); ok {
+		data, err = protojson.MarshalOptions{Multiline: true, EmitUnpopulated: true}.Marshal(m)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal the output: %w", err)
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
@@ -19,6 +19,7 @@ package utils
 import (
 	"fmt"
 
+	"kmesh.net/kmesh/pkg/adminclient"
 	"kmesh.net/kmesh/pkg/kube"
 )
 
@@ -26,12 +27,16 @@ const (
 	KmeshNamespace = "kmesh-system"
 	KmeshLabel     = "app=kmesh"
 	KmeshAdminPort = 15200
+	// KmeshAdminGrpcPort is the port of the admin grpc api of the kmesh daemon
+	KmeshAdminGrpcPort = 15201
+	// KmeshPprofPort is the port of the go runtime profiles of the kmesh daemon, served with --enable-pprof
+	KmeshPprofPort = 15202
 )
 
 func CreateKubeClient() (kube.CLIClient, error) {
 	cli, err := kube.NewCLIClient()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kube client: %v", err)
+		return nil, fmt.Errorf("failed to create kube client: %w", err)
 	}
 
 	return cli, nil
@@ -41,8 +46,38 @@ func CreateKubeClient() (kube.CLIClient, error) {
 func CreateKmeshPortForwarder(cliClient kube.CLIClient, podName string) (kube.PortForwarder, error) {
 	fw, err := cliClient.NewPortForwarder(podName, KmeshNamespace, "", 0, KmeshAdminPort)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create port forwarder: %v", err)
+		return nil, fmt.Errorf("failed to create port forwarder: %w", err)
 	}
 
 	return fw, nil
 }
+
+// KmeshAdminClient is an admin api client connected to a Kmesh daemon pod through a port forwarder.
+type KmeshAdminClient struct {
+	*adminclient.Client
+	fw kube.PortForwarder
+}
+
+// Close closes the client connection and the port forwarder.
+func (c *KmeshAdminClient) Close() {
+	_ = c.Client.Close()
+	c.fw.Close()
+}
+
+// CreateKmeshAdminClient port-forwards to the admin grpc api of the given Kmesh daemon pod and connects to it.
+func CreateKmeshAdminClient(cliClient kube.CLIClient, podName string) (*KmeshAdminClient, error) {
+	fw, err := cliClient.NewPortForwarder(podName, KmeshNamespace, "", 0, KmeshAdminGrpcPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create port forwarder for Kmesh daemon pod %s: %w", podName, err)
+	}
+	if err := StartKmeshPortForwarder(fw, podName); err != nil {
+		return nil, err
+	}
+
+	client, err := adminclient.New(fw.Address())
+	if err != nil {
+		fw.Close()
+		return nil, err
+	}
+	return &KmeshAdminClient{Client: client, fw: fw}, nil
+}
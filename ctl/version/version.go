@@ -22,8 +22,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -56,8 +56,7 @@ kmeshctl version <kmesh-daemon-pod>`,
 func runVersion(cmd *cobra.Command, args []string) {
 	cli, err := utils.CreateKubeClient()
 	if err != nil {
-		log.Errorf("failed to create kube client: %v", err)
-		os.Exit(1)
+		utils.Exit(log, fmt.Errorf("failed to create kube client: %w", err))
 	}
 
 	if len(args) == 0 {
@@ -70,11 +69,12 @@ func runVersion(cmd *cobra.Command, args []string) {
 
 		podList, err := cli.PodsForSelector(context.TODO(), utils.KmeshNamespace, utils.KmeshLabel)
 		if err != nil {
-			log.Errorf("failed to get kmesh daemon pods: %v", err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("failed to get kmesh daemon pods: %w", err))
 		}
 
 		daemonVersions := map[string]int{}
+		eventMechanisms := map[string]int{}
+		xdpModes := map[string]int{}
 		for _, pod := range podList.Items {
 			v := getVersion(cli, pod.Name)
 			if v.GitVersion != "" {
@@ -84,13 +84,22 @@ func runVersion(cmd *cobra.Command, args []string) {
 					daemonVersions[v.GitVersion+"-"+v.GitCommit] = daemonVersions[v.GitVersion+"-"+v.GitCommit] + 1
 				}
 			}
+			// the daemons older than the event mechanism do not report it
+			if v.EventMechanism != "" {
+				eventMechanisms[v.EventMechanism]++
+			}
+			// nor do the ones which have not attached the xdp program yet
+			if v.XdpMode != "" {
+				xdpModes[v.XdpMode]++
+			}
 		}
-		counts := []string{}
-		cmd.Printf("kmesh-daemon version: ")
-		for k, v := range daemonVersions {
-			counts = append(counts, fmt.Sprintf("%s (%d daemons)", k, v))
+		cmd.Printf("kmesh-daemon version: %s\n", formatDaemonCounts(daemonVersions))
+		if len(eventMechanisms) > 0 {
+			cmd.Printf("kmesh-daemon event mechanism: %s\n", formatDaemonCounts(eventMechanisms))
+		}
+		if len(xdpModes) > 0 {
+			cmd.Printf("kmesh-daemon xdp mode: %s\n", formatDaemonCounts(xdpModes))
 		}
-		cmd.Printf("%s\n", strings.Join(counts, ", "))
 		return
 	}
 
@@ -99,8 +108,7 @@ func runVersion(cmd *cobra.Command, args []string) {
 	if v.GitVersion != "" {
 		data, err := json.MarshalIndent(&v, "", "  ")
 		if err != nil {
-			log.Errorf("Failed to marshal version info: %v", err)
-			os.Exit(1)
+			utils.Exit(log, fmt.Errorf("Failed to marshal version info: %w", err))
 		}
 		cmd.Printf("%s\n", string(data))
 	}
@@ -147,3 +155,18 @@ func stringMatch(str string) bool {
 
 	return regex.MatchString(str)
 }
+
+// formatDaemonCounts formats the number of daemons by value like "v1.1.0 (2 daemons), v1.0.0 (1 daemons)"
+func formatDaemonCounts(daemons map[string]int) string {
+	values := make([]string, 0, len(daemons))
+	for value := range daemons {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	counts := make([]string, 0, len(values))
+	for _, value := range values {
+		counts = append(counts, fmt.Sprintf("%s (%d daemons)", value, daemons[value]))
+	}
+	return strings.Join(counts, ", ")
+}
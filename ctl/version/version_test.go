@@ -16,7 +16,11 @@
 
 package version
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func Test_stringMatch(t *testing.T) {
 	type args struct {
@@ -71,3 +75,9 @@ func Test_stringMatch(t *testing.T) {
 		})
 	}
 }
+
+func Test_formatDaemonCounts(t *testing.T) {
+	assert.Equal(t, "", formatDaemonCounts(map[string]int{}))
+	assert.Equal(t, "perf buffer (1 daemons), ringbuf (2 daemons)",
+		formatDaemonCounts(map[string]int{"ringbuf": 2, "perf buffer": 1}))
+}
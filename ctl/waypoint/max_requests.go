@@ -0,0 +1,155 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	networkingv1 "istio.io/client-go/pkg/apis/networking/v1"
+	networking "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/istio/pkg/config/schema/gvk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// maxRequests is the number of requests the waypoint sends over an upstream connection to a port
+// of the host of a DestinationRule before closing it, 0 for all the ports or unlimited
+type maxRequests struct {
+	Port                     uint32
+	MaxRequestsPerConnection int32
+}
+
+// The waypoint routes the http requests to the inbound-vip clusters of the services, whose http subset
+// is matched here. The limit of the traffic policy applies to all the ports of the host and is patched
+// first so that the port level settings override it. Envoy translates a limit of 0 to unlimited.
+// The priority makes it applied after the EnvoyFilters installed with Kmesh.
+var maxRequestsEnvoyFilterTemplate = template.Must(template.New("max-requests").Parse(`apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: {{.Name}}-max-requests
+  namespace: {{.Namespace}}
+spec:
+  workloadSelector:
+    labels:
+      gateway.networking.k8s.io/gateway-name: {{.Waypoint}}
+  priority: 10
+  configPatches:
+{{- range .MaxRequests}}
+  - applyTo: CLUSTER
+    match:
+      cluster:
+        service: {{printf "%q" $.Host}}
+        subset: http
+{{- if .Port}}
+        portNumber: {{.Port}}
+{{- end}}
+    patch:
+      operation: MERGE
+      value:
+        typed_extension_protocol_options:
+          envoy.extensions.upstreams.http.v3.HttpProtocolOptions:
+            "@type": type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions
+            common_http_protocol_options:
+              max_requests_per_connection: {{.MaxRequestsPerConnection}}
+{{- end}}
+`))
+
+// MaxRequestsEnvoyFilter returns the EnvoyFilter making the waypoint close the upstream connections to the host
+// of the DestinationRule after the maxRequestsPerConnection of its http connection pool, nil if it sets none.
+// The EnvoyFilter is owned by the DestinationRule once it was created.
+func MaxRequestsEnvoyFilter(dr *networkingv1.DestinationRule, waypoint string) (*networking.EnvoyFilter, error) {
+	host := dr.Spec.GetHost()
+	if !strings.Contains(host, ".") {
+		// short names are resolved in the namespace of the DestinationRule
+		host = fmt.Sprintf("%s.%s.svc.cluster.local", host, dr.Namespace)
+	}
+
+	var limits []maxRequests
+	n := dr.Spec.GetTrafficPolicy().GetConnectionPool().GetHttp().GetMaxRequestsPerConnection()
+	if n < 0 {
+		return nil, fmt.Errorf("invalid maxRequestsPerConnection %d of DestinationRule %s/%s", n, dr.Namespace, dr.Name)
+	}
+	if n > 0 {
+		limits = append(limits, maxRequests{MaxRequestsPerConnection: n})
+	}
+	for _, pls := range dr.Spec.GetTrafficPolicy().GetPortLevelSettings() {
+		port := pls.GetPort().GetNumber()
+		if port == 0 || pls.GetConnectionPool() == nil {
+			continue
+		}
+		// the connection pool of a port replaces the one of the traffic policy, a port
+		// setting none inherits the limit of the traffic policy rather than resetting it
+		pn := pls.GetConnectionPool().GetHttp().GetMaxRequestsPerConnection()
+		if pn < 0 {
+			return nil, fmt.Errorf("invalid maxRequestsPerConnection %d for port %d of DestinationRule %s/%s", pn, port, dr.Namespace, dr.Name)
+		}
+		if pn > 0 || n > 0 {
+			limits = append(limits, maxRequests{Port: port, MaxRequestsPerConnection: pn})
+		}
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	err := maxRequestsEnvoyFilterTemplate.Execute(&buf, struct {
+		Name        string
+		Namespace   string
+		Waypoint    string
+		Host        string
+		MaxRequests []maxRequests
+	}{dr.Name, dr.Namespace, waypoint, host, limits})
+	if err != nil {
+		return nil, err
+	}
+	ef := &networking.EnvoyFilter{}
+	if err := yaml.Unmarshal(buf.Bytes(), ef); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal EnvoyFilter: %w", err)
+	}
+	if dr.UID != "" {
+		ef.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: gvk.DestinationRule.GroupVersion(),
+			Kind:       gvk.DestinationRule.Kind,
+			Name:       dr.Name,
+			UID:        dr.UID,
+		}}
+	}
+	return ef, nil
+}
+
+// applyMaxRequests creates or updates the EnvoyFilter limiting the requests per connection of the waypoint
+// as configured by the DestinationRule
+func applyMaxRequests(ctx context.Context, kubeClient kube.CLIClient, ns, name, waypoint string) (*networking.EnvoyFilter, error) {
+	dr, err := kubeClient.Istio().NetworkingV1().DestinationRules(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DestinationRule %s/%s: %w", ns, name, err)
+	}
+	ef, err := MaxRequestsEnvoyFilter(dr, waypoint)
+	if err != nil {
+		return nil, err
+	}
+	if ef == nil {
+		return nil, fmt.Errorf("DestinationRule %s/%s sets no maxRequestsPerConnection, the requests per connection are unlimited", ns, name)
+	}
+	return applyEnvoyFilter(ctx, kubeClient, ef)
+}
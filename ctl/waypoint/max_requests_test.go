@@ -0,0 +1,99 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	networkingv1 "istio.io/client-go/pkg/apis/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMaxRequestsEnvoyFilter(t *testing.T) {
+	dr := &networkingv1.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "reviews",
+			Namespace: "default",
+			UID:       "1234",
+		},
+	}
+	dr.Spec.Host = "reviews"
+	// the default is unlimited
+	ef, err := MaxRequestsEnvoyFilter(dr, "waypoint")
+	require.NoError(t, err)
+	assert.Nil(t, ef)
+
+	// the traffic policy applies to all the ports, port 8080 overrides it and port 9080 resets it
+	dr.Spec.TrafficPolicy = &networkingv1alpha3.TrafficPolicy{
+		ConnectionPool: &networkingv1alpha3.ConnectionPoolSettings{
+			Http: &networkingv1alpha3.ConnectionPoolSettings_HTTPSettings{MaxRequestsPerConnection: 10},
+		},
+		PortLevelSettings: []*networkingv1alpha3.TrafficPolicy_PortTrafficPolicy{{
+			Port: &networkingv1alpha3.PortSelector{Number: 8080},
+			ConnectionPool: &networkingv1alpha3.ConnectionPoolSettings{
+				Http: &networkingv1alpha3.ConnectionPoolSettings_HTTPSettings{MaxRequestsPerConnection: 1},
+			},
+		}, {
+			Port:           &networkingv1alpha3.PortSelector{Number: 9080},
+			ConnectionPool: &networkingv1alpha3.ConnectionPoolSettings{},
+		}, {
+			// inherits the traffic policy
+			Port: &networkingv1alpha3.PortSelector{Number: 9090},
+		}},
+	}
+	ef, err = MaxRequestsEnvoyFilter(dr, "waypoint")
+	require.NoError(t, err)
+	require.NotNil(t, ef)
+	assert.Equal(t, "reviews-max-requests", ef.Name)
+	assert.Equal(t, "default", ef.Namespace)
+	assert.Equal(t, map[string]string{"gateway.networking.k8s.io/gateway-name": "waypoint"}, ef.Spec.WorkloadSelector.Labels)
+	assert.Equal(t, int32(10), ef.Spec.Priority)
+	require.Len(t, ef.Spec.ConfigPatches, 3)
+
+	for i, want := range []struct {
+		port uint32
+		max  float64
+	}{{0, 10}, {8080, 1}, {9080, 0}} {
+		cp := ef.Spec.ConfigPatches[i]
+		assert.Equal(t, "reviews.default.svc.cluster.local", cp.Match.GetCluster().GetService())
+		assert.Equal(t, "http", cp.Match.GetCluster().GetSubset())
+		assert.Equal(t, want.port, cp.Match.GetCluster().GetPortNumber())
+		options := cp.Patch.Value.Fields["typed_extension_protocol_options"].GetStructValue().
+			Fields["envoy.extensions.upstreams.http.v3.HttpProtocolOptions"].GetStructValue().Fields
+		assert.Equal(t, "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions", options["@type"].GetStringValue())
+		assert.Equal(t, want.max, options["common_http_protocol_options"].GetStructValue().
+			Fields["max_requests_per_connection"].GetNumberValue())
+	}
+
+	require.Len(t, ef.OwnerReferences, 1)
+	assert.Equal(t, "DestinationRule", ef.OwnerReferences[0].Kind)
+	assert.Equal(t, dr.UID, ef.OwnerReferences[0].UID)
+
+	// a port resetting the limit of no traffic policy needs no patch
+	dr.Spec.TrafficPolicy.ConnectionPool = nil
+	ef, err = MaxRequestsEnvoyFilter(dr, "waypoint")
+	require.NoError(t, err)
+	require.Len(t, ef.Spec.ConfigPatches, 1)
+	assert.Equal(t, uint32(8080), ef.Spec.ConfigPatches[0].Match.GetCluster().GetPortNumber())
+
+	dr.Spec.TrafficPolicy.PortLevelSettings[0].ConnectionPool.Http.MaxRequestsPerConnection = -1
+	_, err = MaxRequestsEnvoyFilter(dr, "waypoint")
+	assert.ErrorContains(t, err, "invalid maxRequestsPerConnection -1 for port 8080")
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	networking "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/istio/pkg/config/schema/gvk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gateway "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// KmeshProxyProtocolAnnotation enables the PROXY protocol towards the backends of a waypoint,
+	// the only supported version is v2. It is only honored by kmeshctl waypoint apply and generate,
+	// which output the EnvoyFilter along with the Gateway: the daemon does not reconcile it, and
+	// annotating an existing Gateway or removing the annotation leaves its EnvoyFilter as it is.
+	KmeshProxyProtocolAnnotation = "kmesh.net/proxy-protocol"
+	ProxyProtocolV2              = "v2"
+)
+
+// The waypoint forwards the tcp connections with the kmesh_original_dst_cluster, this replaces it with an
+// original dst cluster prepending a PROXY protocol v2 header carrying the address of the client,
+// so that the backend observes the client instead of the waypoint. Only the tcp proxies of the service
+// filter chains of the main_internal listener connect to the backends, the ones of the other listeners,
+// such as connect_terminate which terminates HBONE, forward to main_internal and are left alone.
+// The priority makes it applied after the EnvoyFilters installed with Kmesh.
+var proxyProtocolEnvoyFilterTemplate = template.Must(template.New("proxy-protocol").Parse(`apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: {{.Name}}-proxy-protocol
+  namespace: {{.Namespace}}
+spec:
+  workloadSelector:
+    labels:
+      gateway.networking.k8s.io/gateway-name: {{.Name}}
+  priority: 10
+  configPatches:
+  - applyTo: CLUSTER
+    patch:
+      operation: ADD
+      value:
+        name: kmesh_proxy_protocol_original_dst_cluster
+        type: ORIGINAL_DST
+        connect_timeout: 2s
+        lb_policy: CLUSTER_PROVIDED
+        transport_socket:
+          name: envoy.transport_sockets.upstream_proxy_protocol
+          typed_config:
+            "@type": type.googleapis.com/envoy.extensions.transport_sockets.proxy_protocol.v3.ProxyProtocolUpstreamTransport
+            config:
+              version: V2
+            transport_socket:
+              name: envoy.transport_sockets.raw_buffer
+              typed_config:
+                "@type": type.googleapis.com/envoy.extensions.transport_sockets.raw_buffer.v3.RawBuffer
+  - applyTo: NETWORK_FILTER
+    match:
+      listener:
+        name: main_internal
+        filterChain:
+          filter:
+            name: envoy.filters.network.tcp_proxy
+    patch:
+      operation: REPLACE
+      value:
+        name: envoy.filters.network.tcp_proxy
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          stat_prefix: kmesh_original_dst_cluster
+          cluster: kmesh_proxy_protocol_original_dst_cluster
+`))
+
+// ProxyProtocolEnvoyFilter returns the EnvoyFilter making the waypoint send the PROXY protocol
+// to the backends as requested by its annotation, nil if the waypoint is not annotated.
+// The EnvoyFilter is owned by the waypoint once it was created.
+func ProxyProtocolEnvoyFilter(gw *gateway.Gateway) (*networking.EnvoyFilter, error) {
+	version, ok := gw.Annotations[KmeshProxyProtocolAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	if version != ProxyProtocolV2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %q in annotation %s, only %s is supported",
+			version, KmeshProxyProtocolAnnotation, ProxyProtocolV2)
+	}
+
+	var buf bytes.Buffer
+	if err := proxyProtocolEnvoyFilterTemplate.Execute(&buf, gw); err != nil {
+		return nil, err
+	}
+	ef := &networking.EnvoyFilter{}
+	if err := yaml.Unmarshal(buf.Bytes(), ef); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal EnvoyFilter: %w", err)
+	}
+	if gw.UID != "" {
+		ef.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: gvk.KubernetesGateway_v1.GroupVersion(),
+			Kind:       gvk.KubernetesGateway_v1.Kind,
+			Name:       gw.Name,
+			UID:        gw.UID,
+		}}
+	}
+	return ef, nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gateway "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+func TestProxyProtocolEnvoyFilter(t *testing.T) {
+	gw := &gateway.Gateway{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "waypoint",
+			Namespace: "default",
+		},
+	}
+	ef, err := ProxyProtocolEnvoyFilter(gw)
+	require.NoError(t, err)
+	assert.Nil(t, ef)
+
+	gw.Annotations = map[string]string{KmeshProxyProtocolAnnotation: "v1"}
+	_, err = ProxyProtocolEnvoyFilter(gw)
+	assert.Error(t, err)
+
+	gw.Annotations[KmeshProxyProtocolAnnotation] = ProxyProtocolV2
+	gw.UID = "1234"
+	ef, err = ProxyProtocolEnvoyFilter(gw)
+	require.NoError(t, err)
+	require.NotNil(t, ef)
+	assert.Equal(t, "waypoint-proxy-protocol", ef.Name)
+	assert.Equal(t, "default", ef.Namespace)
+	assert.Equal(t, map[string]string{"gateway.networking.k8s.io/gateway-name": "waypoint"}, ef.Spec.WorkloadSelector.Labels)
+	assert.Equal(t, int32(10), ef.Spec.Priority)
+	require.Len(t, ef.Spec.ConfigPatches, 2)
+	cluster := ef.Spec.ConfigPatches[0].Patch.Value.Fields
+	assert.Equal(t, "kmesh_proxy_protocol_original_dst_cluster", cluster["name"].GetStringValue())
+	transportSocket := cluster["transport_socket"].GetStructValue().Fields
+	assert.Equal(t, "V2", transportSocket["typed_config"].GetStructValue().Fields["config"].GetStructValue().Fields["version"].GetStringValue())
+	// the tcp proxies of the HBONE listeners forward to main_internal and must not be replaced
+	assert.Equal(t, "main_internal", ef.Spec.ConfigPatches[1].Match.GetListener().GetName())
+	tcpProxy := ef.Spec.ConfigPatches[1].Patch.Value.Fields["typed_config"].GetStructValue().Fields
+	assert.Equal(t, "kmesh_proxy_protocol_original_dst_cluster", tcpProxy["cluster"].GetStringValue())
+	require.Len(t, ef.OwnerReferences, 1)
+	assert.Equal(t, "Gateway", ef.OwnerReferences[0].Kind)
+	assert.Equal(t, gw.UID, ef.OwnerReferences[0].UID)
+}
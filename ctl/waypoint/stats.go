@@ -0,0 +1,332 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	gateway "sigs.k8s.io/gateway-api/apis/v1"
+
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// the istio standard metrics of the waypoint proxies and the envoy stat of their upstream connections,
+// read from the prometheus stats of their admin interface
+const (
+	requestsMetric        = "istio_requests_total"
+	requestDurationMetric = "istio_request_duration_milliseconds"
+	upstreamActiveMetric  = "envoy_cluster_upstream_cx_active"
+
+	// the waypoints route the requests to a service to the inbound-vip|<port>|<protocol>|<host> clusters
+	inboundVipCluster = "inbound-vip"
+)
+
+var statsInterval time.Duration
+
+// waypointServiceStats are the L7 stats of the requests a waypoint proxied to a service over an interval,
+// summed over the pods of the waypoint
+type waypointServiceStats struct {
+	Namespace string `json:"namespace"`
+	Waypoint  string `json:"waypoint"`
+	Service   string `json:"service"`
+	// Requests is the number of requests completed during the interval
+	Requests uint64  `json:"requests"`
+	RPS      float64 `json:"rps"`
+	// P50Ms and P99Ms are the latencies of the requests completed during the interval, 0 without requests
+	P50Ms float64 `json:"p50Ms"`
+	P99Ms float64 `json:"p99Ms"`
+	// ActiveConnections is the number of connections open to the backends of the service at the end of the interval
+	ActiveConnections uint64 `json:"activeConnections"`
+}
+
+// proxyStats are the stats of a waypoint proxy by destination service
+type proxyStats struct {
+	requests map[string]uint64
+	latency  map[string]*latencyHistogram
+	active   map[string]uint64
+}
+
+// latencyHistogram holds the cumulative counts of the requests below each bound, the last one is +Inf
+type latencyHistogram struct {
+	bounds []float64
+	counts []uint64
+}
+
+func newProxyStats() *proxyStats {
+	return &proxyStats{
+		requests: make(map[string]uint64),
+		latency:  make(map[string]*latencyHistogram),
+		active:   make(map[string]uint64),
+	}
+}
+
+// parseProxyStats parses the prometheus stats of a waypoint proxy
+func parseProxyStats(r io.Reader) (*proxyStats, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stats: %w", err)
+	}
+
+	stats := newProxyStats()
+	for _, m := range families[requestsMetric].GetMetric() {
+		if svc := labelValue(m, "destination_service"); svc != "" {
+			stats.requests[svc] += uint64(m.GetCounter().GetValue())
+		}
+	}
+	for _, m := range families[requestDurationMetric].GetMetric() {
+		svc := labelValue(m, "destination_service")
+		if svc == "" {
+			continue
+		}
+		h := m.GetHistogram()
+		sample := &latencyHistogram{}
+		for _, b := range h.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				continue
+			}
+			sample.bounds = append(sample.bounds, b.GetUpperBound())
+			sample.counts = append(sample.counts, b.GetCumulativeCount())
+		}
+		sample.bounds = append(sample.bounds, math.Inf(1))
+		sample.counts = append(sample.counts, h.GetSampleCount())
+		stats.latency[svc] = stats.latency[svc].add(sample)
+	}
+	for _, m := range families[upstreamActiveMetric].GetMetric() {
+		fields := strings.Split(labelValue(m, "cluster_name"), "|")
+		if len(fields) == 4 && fields[0] == inboundVipCluster {
+			stats.active[fields[3]] += uint64(m.GetGauge().GetValue())
+		}
+	}
+	return stats, nil
+}
+
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// add returns the sum of the histograms, they have the same bounds unless the buckets of the proxies differ
+func (h *latencyHistogram) add(other *latencyHistogram) *latencyHistogram {
+	if h == nil {
+		return other
+	}
+	if other == nil || !slices.Equal(h.bounds, other.bounds) {
+		return h
+	}
+	sum := &latencyHistogram{bounds: h.bounds, counts: slices.Clone(h.counts)}
+	for i := range sum.counts {
+		sum.counts[i] += other.counts[i]
+	}
+	return sum
+}
+
+// sub returns the requests of h not counted in before yet, all of them if the proxy restarted in between
+func (h *latencyHistogram) sub(before *latencyHistogram) *latencyHistogram {
+	if h == nil || before == nil || !slices.Equal(h.bounds, before.bounds) || h.total() < before.total() {
+		return h
+	}
+	diff := &latencyHistogram{bounds: h.bounds, counts: slices.Clone(h.counts)}
+	for i := range diff.counts {
+		diff.counts[i] -= before.counts[i]
+	}
+	return diff
+}
+
+func (h *latencyHistogram) total() uint64 {
+	if h == nil || len(h.counts) == 0 {
+		return 0
+	}
+	return h.counts[len(h.counts)-1]
+}
+
+// quantile estimates the q quantile by interpolating linearly within the bucket it falls in, as the
+// histogram_quantile of prometheus. The quantiles in the +Inf bucket are the highest finite bound.
+func (h *latencyHistogram) quantile(q float64) float64 {
+	total := h.total()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	for i, count := range h.counts {
+		if float64(count) < rank {
+			continue
+		}
+		if math.IsInf(h.bounds[i], 1) {
+			if i == 0 {
+				return 0
+			}
+			return h.bounds[i-1]
+		}
+		var lower float64
+		var below uint64
+		if i > 0 {
+			lower, below = h.bounds[i-1], h.counts[i-1]
+		}
+		if count == below {
+			return h.bounds[i]
+		}
+		return lower + (h.bounds[i]-lower)*(rank-float64(below))/float64(count-below)
+	}
+	return h.bounds[len(h.bounds)-1]
+}
+
+// diffProxyStats returns the stats of a waypoint from the ones of its proxies at the start and at the end of the interval
+func diffProxyStats(gw gateway.Gateway, before, after []*proxyStats, interval time.Duration) []waypointServiceStats {
+	requests := make(map[string]uint64)
+	active := make(map[string]uint64)
+	latency := make(map[string]*latencyHistogram)
+	for i, end := range after {
+		start := newProxyStats()
+		if before[i] != nil {
+			start = before[i]
+		}
+		for svc, count := range end.requests {
+			if count >= start.requests[svc] {
+				count -= start.requests[svc]
+			}
+			requests[svc] += count
+		}
+		for svc, h := range end.latency {
+			latency[svc] = latency[svc].add(h.sub(start.latency[svc]))
+		}
+		for svc, count := range end.active {
+			active[svc] += count
+		}
+	}
+
+	services := make([]string, 0, len(requests)+len(active))
+	for svc := range requests {
+		services = append(services, svc)
+	}
+	for svc := range active {
+		if _, ok := requests[svc]; !ok {
+			services = append(services, svc)
+		}
+	}
+	slices.Sort(services)
+
+	stats := make([]waypointServiceStats, 0, len(services))
+	for _, svc := range services {
+		stats = append(stats, waypointServiceStats{
+			Namespace:         gw.Namespace,
+			Waypoint:          gw.Name,
+			Service:           svc,
+			Requests:          requests[svc],
+			RPS:               float64(requests[svc]) / interval.Seconds(),
+			P50Ms:             latency[svc].quantile(0.5),
+			P99Ms:             latency[svc].quantile(0.99),
+			ActiveConnections: active[svc],
+		})
+	}
+	return stats
+}
+
+// getWaypointStats samples the stats of the pods of the waypoints at the start and at the end of the interval
+func getWaypointStats(kubeClient kube.CLIClient, gws []gateway.Gateway, interval time.Duration, errWriter io.Writer) ([]waypointServiceStats, error) {
+	type waypointProxies struct {
+		gw      gateway.Gateway
+		getters []func() (*proxyStats, error)
+		before  []*proxyStats
+	}
+	var waypoints []*waypointProxies
+	for _, gw := range gws {
+		pods, err := kubeClient.PodsForSelector(context.Background(), gw.Namespace, gatewayNameLabel+"="+gw.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the pods of waypoint %s/%s: %w", gw.Namespace, gw.Name, err)
+		}
+		wp := &waypointProxies{gw: gw}
+		for _, pod := range pods.Items {
+			fw, err := kubeClient.NewPortForwarder(pod.Name, pod.Namespace, "", 0, envoyAdminPort)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create port forwarder for pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+			if err := fw.Start(); err != nil {
+				return nil, fmt.Errorf("failed to start port forwarder for pod %s/%s: %w", pod.Namespace, pod.Name, err)
+			}
+			defer fw.Close()
+			wp.getters = append(wp.getters, proxyStatsGetter(fw.Address()))
+		}
+		waypoints = append(waypoints, wp)
+	}
+
+	// a proxy failing to be sampled at the start counts its requests since it started
+	for _, wp := range waypoints {
+		for _, get := range wp.getters {
+			stats, err := get()
+			if err != nil {
+				fmt.Fprintf(errWriter, "failed to get the stats of a pod of waypoint %s/%s at the start: %v\n", wp.gw.Namespace, wp.gw.Name, err)
+			}
+			wp.before = append(wp.before, stats)
+		}
+	}
+	time.Sleep(interval)
+
+	stats := make([]waypointServiceStats, 0)
+	for _, wp := range waypoints {
+		var after, before []*proxyStats
+		for i, get := range wp.getters {
+			end, err := get()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the stats of a pod of waypoint %s/%s: %w", wp.gw.Namespace, wp.gw.Name, err)
+			}
+			after = append(after, end)
+			before = append(before, wp.before[i])
+		}
+		stats = append(stats, diffProxyStats(wp.gw, before, after, interval)...)
+	}
+	return stats, nil
+}
+
+func proxyStatsGetter(address string) func() (*proxyStats, error) {
+	client := &http.Client{Timeout: adminRequestTimeout}
+	return func() (*proxyStats, error) {
+		resp, err := client.Get(fmt.Sprintf("http://%s/stats/prometheus", address))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("proxy admin returned %s", resp.Status)
+		}
+		return parseProxyStats(resp.Body)
+	}
+}
+
+// printWaypointStats prints the stats of the services of the waypoints
+func printWaypointStats(w *tabwriter.Writer, stats []waypointServiceStats) error {
+	fmt.Fprintln(w, "NAMESPACE\tWAYPOINT\tSERVICE\tREQUESTS\tRPS\tP50(ms)\tP99(ms)\tACTIVE")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.2f\t%.1f\t%.1f\t%d\n", s.Namespace, s.Waypoint, s.Service,
+			s.Requests, s.RPS, s.P50Ms, s.P99Ms, s.ActiveConnections)
+	}
+	return w.Flush()
+}
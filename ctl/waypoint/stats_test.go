@@ -0,0 +1,176 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gateway "sigs.k8s.io/gateway-api/apis/v1"
+)
+
+var fakeLatencyBuckets = []float64{1, 5, 10, 25, 50, 100, 250}
+
+// fakeProxy serves the prometheus stats of the requests it is told to have proxied
+type fakeProxy struct {
+	mu        sync.Mutex
+	latencies map[string][]float64
+	active    map[string]int
+}
+
+func (p *fakeProxy) request(svc string, latencyMs float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.latencies[svc] = append(p.latencies[svc], latencyMs)
+}
+
+func (p *fakeProxy) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TYPE %s counter\n", requestsMetric)
+	for svc, latencies := range p.latencies {
+		fmt.Fprintf(&b, "%s{destination_service=%q,response_code=\"200\"} %d\n", requestsMetric, svc, len(latencies))
+	}
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", requestDurationMetric)
+	for svc, latencies := range p.latencies {
+		var sum float64
+		for _, bound := range fakeLatencyBuckets {
+			count := 0
+			for _, l := range latencies {
+				if l <= bound {
+					count++
+				}
+			}
+			fmt.Fprintf(&b, "%s_bucket{destination_service=%q,le=\"%g\"} %d\n", requestDurationMetric, svc, bound, count)
+		}
+		for _, l := range latencies {
+			sum += l
+		}
+		fmt.Fprintf(&b, "%s_bucket{destination_service=%q,le=\"+Inf\"} %d\n", requestDurationMetric, svc, len(latencies))
+		fmt.Fprintf(&b, "%s_sum{destination_service=%q} %g\n", requestDurationMetric, svc, sum)
+		fmt.Fprintf(&b, "%s_count{destination_service=%q} %d\n", requestDurationMetric, svc, len(latencies))
+	}
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", upstreamActiveMetric)
+	for svc, active := range p.active {
+		fmt.Fprintf(&b, "%s{cluster_name=\"inbound-vip|80|http|%s\"} %d\n", upstreamActiveMetric, svc, active)
+	}
+	// the connections of the other clusters are not the ones of a service
+	fmt.Fprintf(&b, "%s{cluster_name=\"main_internal\"} 7\n", upstreamActiveMetric)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func TestWaypointStatsReflectTraffic(t *testing.T) {
+	const (
+		productpage = "productpage.default.svc.cluster.local"
+		reviews     = "reviews.default.svc.cluster.local"
+	)
+	proxies := []*fakeProxy{
+		{latencies: map[string][]float64{}, active: map[string]int{}},
+		{latencies: map[string][]float64{}, active: map[string]int{}},
+	}
+	var getters []func() (*proxyStats, error)
+	for _, p := range proxies {
+		srv := httptest.NewServer(p)
+		defer srv.Close()
+		getters = append(getters, proxyStatsGetter(strings.TrimPrefix(srv.URL, "http://")))
+	}
+
+	// the requests proxied before the interval are not counted
+	for i := 0; i < 50; i++ {
+		proxies[0].request(productpage, 200)
+	}
+	var before []*proxyStats
+	for _, get := range getters {
+		stats, err := get()
+		require.NoError(t, err)
+		before = append(before, stats)
+	}
+
+	// 100 requests to productpage split over the two pods, 99 of them in 3ms and one in 80ms
+	for i := 0; i < 99; i++ {
+		proxies[i%2].request(productpage, 3)
+	}
+	proxies[1].request(productpage, 80)
+	// reviews is only proxied by the second pod, which sees 10 requests in 20ms
+	for i := 0; i < 10; i++ {
+		proxies[1].request(reviews, 20)
+	}
+	proxies[0].active[productpage] = 3
+	proxies[1].active[productpage] = 2
+	proxies[1].active["ratings.default.svc.cluster.local"] = 1
+
+	var after []*proxyStats
+	for _, get := range getters {
+		stats, err := get()
+		require.NoError(t, err)
+		after = append(after, stats)
+	}
+
+	gw := gateway.Gateway{ObjectMeta: metav1.ObjectMeta{Name: "waypoint", Namespace: "default"}}
+	stats := diffProxyStats(gw, before, after, 10*time.Second)
+	require.Len(t, stats, 3)
+
+	assert.Equal(t, productpage, stats[0].Service)
+	assert.Equal(t, "default", stats[0].Namespace)
+	assert.Equal(t, "waypoint", stats[0].Waypoint)
+	assert.Equal(t, uint64(100), stats[0].Requests)
+	assert.InDelta(t, 10.0, stats[0].RPS, 1e-9)
+	// the median request falls in the (1, 5] bucket, the 99th in the 3ms ones
+	assert.InDelta(t, 1+4*50.0/99, stats[0].P50Ms, 1e-9)
+	assert.InDelta(t, 5.0, stats[0].P99Ms, 1e-9)
+	assert.Equal(t, uint64(5), stats[0].ActiveConnections)
+
+	// a service only connected to is listed without requests
+	assert.Equal(t, "ratings.default.svc.cluster.local", stats[1].Service)
+	assert.Equal(t, uint64(0), stats[1].Requests)
+	assert.Equal(t, 0.0, stats[1].P99Ms)
+	assert.Equal(t, uint64(1), stats[1].ActiveConnections)
+
+	assert.Equal(t, reviews, stats[2].Service)
+	assert.Equal(t, uint64(10), stats[2].Requests)
+	assert.InDelta(t, 1.0, stats[2].RPS, 1e-9)
+	assert.InDelta(t, 17.5, stats[2].P50Ms, 1e-9)
+	assert.InDelta(t, 24.85, stats[2].P99Ms, 1e-9)
+	assert.Equal(t, uint64(0), stats[2].ActiveConnections)
+}
+
+func TestWaypointStatsProxyRestarted(t *testing.T) {
+	before, err := parseProxyStats(strings.NewReader(`# TYPE istio_requests_total counter
+istio_requests_total{destination_service="a"} 500
+`))
+	require.NoError(t, err)
+	after, err := parseProxyStats(strings.NewReader(`# TYPE istio_requests_total counter
+istio_requests_total{destination_service="a"} 20
+`))
+	require.NoError(t, err)
+
+	// the counters restarted from zero, the requests since the restart are counted
+	stats := diffProxyStats(gateway.Gateway{}, []*proxyStats{before}, []*proxyStats{after}, 2*time.Second)
+	require.Len(t, stats, 1)
+	assert.Equal(t, uint64(20), stats[0].Requests)
+	assert.InDelta(t, 10.0, stats[0].RPS, 1e-9)
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gateway "sigs.k8s.io/gateway-api/apis/v1"
+
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+const (
+	// waypoint pods are labeled with the name of the gateway they implement
+	gatewayNameLabel = "gateway.networking.k8s.io/gateway-name"
+	envoyAdminPort   = 15000
+	hbonePort        = 15008
+	spiffePrefix     = "spiffe://"
+
+	adminRequestTimeout = 5 * time.Second
+)
+
+var output string
+
+// waypointHealth is the status of a waypoint and the HBONE health of its pods
+type waypointHealth struct {
+	Namespace  string              `json:"namespace"`
+	Name       string              `json:"name"`
+	Programmed bool                `json:"programmed"`
+	Reason     string              `json:"reason,omitempty"`
+	Message    string              `json:"message,omitempty"`
+	Pods       []waypointPodHealth `json:"pods"`
+}
+
+type waypointPodHealth struct {
+	Name string `json:"name"`
+	// Ready reports whether the proxy passes its readiness check
+	Ready bool `json:"ready"`
+	// HboneListener reports whether the proxy listens on the HBONE port
+	HboneListener bool `json:"hboneListener"`
+	// ActiveTunnels is the number of connections currently tunneled through the HBONE listener
+	ActiveTunnels uint64      `json:"activeTunnels"`
+	Cert          *certStatus `json:"cert,omitempty"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// certStatus is the status of the workload certificate used for mTLS
+type certStatus struct {
+	Identity   string    `json:"identity"`
+	ValidFrom  time.Time `json:"validFrom"`
+	Expiration time.Time `json:"expiration"`
+	Valid      bool      `json:"valid"`
+}
+
+// envoy admin /listeners?format=json
+type envoyListeners struct {
+	ListenerStatuses []struct {
+		Name         string `json:"name"`
+		LocalAddress struct {
+			SocketAddress struct {
+				Address   string `json:"address"`
+				PortValue uint32 `json:"port_value"`
+			} `json:"socket_address"`
+		} `json:"local_address"`
+	} `json:"listener_statuses"`
+}
+
+// envoy admin /stats?format=json, histograms are left out
+type envoyStats struct {
+	Stats []struct {
+		Name  string  `json:"name"`
+		Value *uint64 `json:"value"`
+	} `json:"stats"`
+}
+
+// envoy admin /certs
+type envoyCerts struct {
+	Certificates []struct {
+		CertChain []struct {
+			SubjectAltNames []struct {
+				URI string `json:"uri"`
+			} `json:"subject_alt_names"`
+			ValidFrom      time.Time `json:"valid_from"`
+			ExpirationTime time.Time `json:"expiration_time"`
+		} `json:"cert_chain"`
+	} `json:"certificates"`
+}
+
+// parseHboneListener reports whether one of the listeners is bound to the HBONE port
+func parseHboneListener(data []byte) (bool, error) {
+	var listeners envoyListeners
+	if err := json.Unmarshal(data, &listeners); err != nil {
+		return false, fmt.Errorf("failed to unmarshal listeners: %w", err)
+	}
+	for _, l := range listeners.ListenerStatuses {
+		if l.LocalAddress.SocketAddress.PortValue == hbonePort {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseActiveTunnels sums the active downstream connections of the HBONE listeners
+func parseActiveTunnels(data []byte) (uint64, error) {
+	var stats envoyStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal stats: %w", err)
+	}
+	var active uint64
+	suffix := fmt.Sprintf("_%d.downstream_cx_active", hbonePort)
+	for _, s := range stats.Stats {
+		if s.Value != nil && strings.HasPrefix(s.Name, "listener.") && strings.HasSuffix(s.Name, suffix) {
+			active += *s.Value
+		}
+	}
+	return active, nil
+}
+
+// parseCertStatus returns the status of the first certificate carrying a spiffe identity,
+// nil if the proxy has none
+func parseCertStatus(data []byte, now time.Time) (*certStatus, error) {
+	var certs envoyCerts
+	if err := json.Unmarshal(data, &certs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal certs: %w", err)
+	}
+	for _, c := range certs.Certificates {
+		for _, cert := range c.CertChain {
+			for _, san := range cert.SubjectAltNames {
+				if !strings.HasPrefix(san.URI, spiffePrefix) {
+					continue
+				}
+				return &certStatus{
+					Identity:   san.URI,
+					ValidFrom:  cert.ValidFrom,
+					Expiration: cert.ExpirationTime,
+					Valid:      !now.Before(cert.ValidFrom) && now.Before(cert.ExpirationTime),
+				}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// getWaypointHealth collects the status of the waypoints and the HBONE health of their pods
+func getWaypointHealth(kubeClient kube.CLIClient, gws []gateway.Gateway) []waypointHealth {
+	health := make([]waypointHealth, 0, len(gws))
+	for _, gw := range gws {
+		h := waypointHealth{
+			Namespace: gw.Namespace,
+			Name:      gw.Name,
+			Pods:      []waypointPodHealth{},
+		}
+		for _, cond := range gw.Status.Conditions {
+			if cond.Type == string(gateway.GatewayConditionProgrammed) {
+				h.Programmed = cond.Status == metav1.ConditionTrue
+				h.Reason = cond.Reason
+				h.Message = cond.Message
+				break
+			}
+		}
+
+		pods, err := kubeClient.PodsForSelector(context.Background(), gw.Namespace, gatewayNameLabel+"="+gw.Name)
+		if err != nil {
+			h.Message = fmt.Sprintf("failed to list waypoint pods: %v", err)
+			health = append(health, h)
+			continue
+		}
+		for _, pod := range pods.Items {
+			h.Pods = append(h.Pods, getWaypointPodHealth(kubeClient, pod.Namespace, pod.Name))
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// getWaypointPodHealth reads the HBONE health of a waypoint pod from its proxy admin interface
+func getWaypointPodHealth(kubeClient kube.CLIClient, ns, podName string) waypointPodHealth {
+	health := waypointPodHealth{Name: podName}
+	fw, err := kubeClient.NewPortForwarder(podName, ns, "", 0, envoyAdminPort)
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to create port forwarder: %v", err)
+		return health
+	}
+	if err := fw.Start(); err != nil {
+		health.Error = fmt.Sprintf("failed to start port forwarder: %v", err)
+		return health
+	}
+	defer fw.Close()
+
+	client := &http.Client{Timeout: adminRequestTimeout}
+	get := func(path string) ([]byte, int, error) {
+		resp, err := client.Get(fmt.Sprintf("http://%s%s", fw.Address(), path))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return body, resp.StatusCode, err
+	}
+
+	_, code, err := get("/ready")
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to query proxy readiness: %v", err)
+		return health
+	}
+	health.Ready = code == http.StatusOK
+
+	query := url.Values{}
+	query.Set("format", "json")
+	data, _, err := get("/listeners?" + query.Encode())
+	if err == nil {
+		health.HboneListener, err = parseHboneListener(data)
+	}
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to get listeners: %v", err)
+		return health
+	}
+
+	query.Set("filter", fmt.Sprintf(`^listener\..*_%d\.downstream_cx_active$`, hbonePort))
+	data, _, err = get("/stats?" + query.Encode())
+	if err == nil {
+		health.ActiveTunnels, err = parseActiveTunnels(data)
+	}
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to get stats: %v", err)
+		return health
+	}
+
+	data, _, err = get("/certs")
+	if err == nil {
+		health.Cert, err = parseCertStatus(data, time.Now())
+	}
+	if err != nil {
+		health.Error = fmt.Sprintf("failed to get certs: %v", err)
+	}
+	return health
+}
+
+// printWaypointHealth prints the HBONE health of the waypoint pods
+func printWaypointHealth(w *tabwriter.Writer, health []waypointHealth) error {
+	if namespace == "" {
+		fmt.Fprintln(w, "NAMESPACE\tWAYPOINT\tPOD\tHBONE\tTUNNELS\tCERT\tEXPIRES\tIDENTITY")
+	} else {
+		fmt.Fprintln(w, "WAYPOINT\tPOD\tHBONE\tTUNNELS\tCERT\tEXPIRES\tIDENTITY")
+	}
+	for _, h := range health {
+		if len(h.Pods) == 0 {
+			if namespace == "" {
+				fmt.Fprintf(w, "%s\t", h.Namespace)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", h.Name, "-", "NoPods", "-", "-", "-", "-")
+			continue
+		}
+		for _, pod := range h.Pods {
+			if namespace == "" {
+				fmt.Fprintf(w, "%s\t", h.Namespace)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", h.Name, pod.Name, formatPodHealth(&pod))
+		}
+	}
+	return w.Flush()
+}
+
+// formatPodHealth formats the HBONE, TUNNELS, CERT, EXPIRES and IDENTITY columns
+func formatPodHealth(pod *waypointPodHealth) string {
+	if pod.Error != "" {
+		return fmt.Sprintf("Unknown\t-\t-\t-\t%s", pod.Error)
+	}
+
+	hbone := "Healthy"
+	switch {
+	case !pod.Ready:
+		hbone = "NotReady"
+	case !pod.HboneListener:
+		hbone = "NoListener"
+	}
+	if pod.Cert == nil {
+		return fmt.Sprintf("%s\t%d\tMissing\t-\t-", hbone, pod.ActiveTunnels)
+	}
+	cert := "Valid"
+	if !pod.Cert.Valid {
+		cert = "Invalid"
+	}
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", hbone, pod.ActiveTunnels, cert,
+		pod.Cert.Expiration.Format(time.RFC3339), pod.Cert.Identity)
+}
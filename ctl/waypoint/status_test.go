@@ -0,0 +1,123 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHboneListener(t *testing.T) {
+	data := []byte(`{"listener_statuses": [
+		{"name": "main_internal", "local_address": {"envoy_internal_address": {"server_listener_name": "main_internal"}}},
+		{"name": "connect_terminate", "local_address": {"socket_address": {"address": "0.0.0.0", "port_value": 15008}}}
+	]}`)
+	ok, err := parseHboneListener(data)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = parseHboneListener([]byte(`{"listener_statuses": [
+		{"name": "main_internal", "local_address": {"envoy_internal_address": {"server_listener_name": "main_internal"}}}
+	]}`))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = parseHboneListener([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestParseActiveTunnels(t *testing.T) {
+	data := []byte(`{"stats": [
+		{"name": "listener.0.0.0.0_15008.downstream_cx_active", "value": 3},
+		{"name": "listener.[__]_15008.downstream_cx_active", "value": 2},
+		{"name": "listener.0.0.0.0_15021.downstream_cx_active", "value": 7},
+		{"histograms": {}}
+	]}`)
+	active, err := parseActiveTunnels(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), active)
+}
+
+func TestParseCertStatus(t *testing.T) {
+	data := []byte(`{"certificates": [
+		{"ca_cert": [{"subject_alt_names": [], "valid_from": "2024-01-01T00:00:00Z", "expiration_time": "2034-01-01T00:00:00Z"}]},
+		{"cert_chain": [{
+			"subject_alt_names": [{"uri": "spiffe://cluster.local/ns/default/sa/waypoint"}],
+			"valid_from": "2024-01-01T00:00:00Z",
+			"expiration_time": "2024-01-02T00:00:00Z"
+		}]}
+	]}`)
+	cert, err := parseCertStatus(data, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/waypoint", cert.Identity)
+	assert.True(t, cert.Valid)
+
+	cert, err = parseCertStatus(data, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.False(t, cert.Valid)
+
+	cert, err = parseCertStatus([]byte(`{"certificates": []}`), time.Now())
+	require.NoError(t, err)
+	assert.Nil(t, cert)
+}
+
+func TestFormatPodHealth(t *testing.T) {
+	expiration := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		pod  waypointPodHealth
+		want string
+	}{
+		{
+			name: "healthy",
+			pod: waypointPodHealth{
+				Ready:         true,
+				HboneListener: true,
+				ActiveTunnels: 4,
+				Cert:          &certStatus{Identity: "spiffe://cluster.local/ns/default/sa/waypoint", Expiration: expiration, Valid: true},
+			},
+			want: "Healthy\t4\tValid\t2024-01-02T00:00:00Z\tspiffe://cluster.local/ns/default/sa/waypoint",
+		},
+		{
+			name: "no listener and no cert",
+			pod:  waypointPodHealth{Ready: true},
+			want: "NoListener\t0\tMissing\t-\t-",
+		},
+		{
+			name: "not ready with expired cert",
+			pod: waypointPodHealth{
+				HboneListener: true,
+				Cert:          &certStatus{Identity: "spiffe://cluster.local/ns/default/sa/waypoint", Expiration: expiration},
+			},
+			want: "NotReady\t0\tInvalid\t2024-01-02T00:00:00Z\tspiffe://cluster.local/ns/default/sa/waypoint",
+		},
+		{
+			name: "unreachable",
+			pod:  waypointPodHealth{Error: "failed to start port forwarder: timeout"},
+			want: "Unknown\t-\t-\t-\tfailed to start port forwarder: timeout",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatPodHealth(&tt.pod))
+		})
+	}
+}
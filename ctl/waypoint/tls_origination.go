@@ -0,0 +1,275 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	networkingv1 "istio.io/client-go/pkg/apis/networking/v1"
+	networking "istio.io/client-go/pkg/apis/networking/v1alpha3"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// systemCaCertificates is the trust bundle of the waypoint image, used to verify the upstreams
+// when the DestinationRule sets no caCertificates
+const systemCaCertificates = "/etc/ssl/certs/ca-certificates.crt"
+
+// tlsOrigination is the TLS the waypoint originates to a port of the host of a DestinationRule
+type tlsOrigination struct {
+	Port              uint32
+	Sni               string
+	CaCertificates    string
+	ClientCertificate string
+	PrivateKey        string
+	SubjectAltNames   []string
+}
+
+func (o tlsOrigination) ClusterName(host string) string {
+	return fmt.Sprintf("kmesh_tls_origination|%d|%s", o.Port, host)
+}
+
+// The waypoint forwards the tcp connections with the kmesh_original_dst_cluster, which skips the TLS
+// settings of the DestinationRules. For every port of the host originating TLS this adds an original dst
+// cluster wrapping the connections in TLS and replaces the cluster of the tcp proxy of the filter chain
+// of the waypoint serving the port of the host with it. The priority makes it applied after the
+// EnvoyFilters installed with Kmesh.
+var tlsOriginationEnvoyFilterTemplate = template.Must(template.New("tls-origination").Parse(`apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: {{.Name}}-tls-origination
+  namespace: {{.Namespace}}
+spec:
+  workloadSelector:
+    labels:
+      gateway.networking.k8s.io/gateway-name: {{.Waypoint}}
+  priority: 10
+  configPatches:
+{{- range .Origination}}
+  - applyTo: CLUSTER
+    patch:
+      operation: ADD
+      value:
+        name: {{printf "%q" (.ClusterName $.Host)}}
+        type: ORIGINAL_DST
+        connect_timeout: 2s
+        lb_policy: CLUSTER_PROVIDED
+        transport_socket:
+          name: envoy.transport_sockets.tls
+          typed_config:
+            "@type": type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext
+            sni: {{printf "%q" .Sni}}
+            common_tls_context:
+{{- if .ClientCertificate}}
+              tls_certificates:
+              - certificate_chain:
+                  filename: {{printf "%q" .ClientCertificate}}
+                private_key:
+                  filename: {{printf "%q" .PrivateKey}}
+{{- end}}
+{{- if .CaCertificates}}
+              validation_context:
+                trusted_ca:
+                  filename: {{printf "%q" .CaCertificates}}
+{{- if .SubjectAltNames}}
+                match_typed_subject_alt_names:
+{{- range .SubjectAltNames}}
+                - san_type: DNS
+                  matcher:
+                    exact: {{printf "%q" .}}
+{{- end}}
+{{- end}}
+{{- else}}
+              {}
+{{- end}}
+  - applyTo: NETWORK_FILTER
+    match:
+      listener:
+        filterChain:
+          name: {{printf "inbound-vip|%d|tcp|%s" .Port $.Host | printf "%q"}}
+          filter:
+            name: envoy.filters.network.tcp_proxy
+    patch:
+      operation: REPLACE
+      value:
+        name: envoy.filters.network.tcp_proxy
+        typed_config:
+          "@type": type.googleapis.com/envoy.extensions.filters.network.tcp_proxy.v3.TcpProxy
+          stat_prefix: kmesh_original_dst_cluster
+          cluster: {{printf "%q" (.ClusterName $.Host)}}
+{{- end}}
+`))
+
+// TLSOriginationEnvoyFilter returns the EnvoyFilter making the waypoint originate TLS to the ports of the host
+// of the DestinationRule whose tls mode is SIMPLE or MUTUAL, nil if there is none. ports are the ports of the host,
+// which the tls settings of the traffic policy apply to unless overridden by the port level settings.
+// The EnvoyFilter is owned by the DestinationRule once it was created.
+func TLSOriginationEnvoyFilter(dr *networkingv1.DestinationRule, waypoint string, ports []uint32) (*networking.EnvoyFilter, error) {
+	host := dr.Spec.GetHost()
+	if !strings.Contains(host, ".") {
+		// short names are resolved in the namespace of the DestinationRule
+		host = fmt.Sprintf("%s.%s.svc.cluster.local", host, dr.Namespace)
+	}
+
+	settings := make(map[uint32]*networkingv1alpha3.ClientTLSSettings, len(ports))
+	for _, port := range ports {
+		settings[port] = dr.Spec.GetTrafficPolicy().GetTls()
+	}
+	for _, pls := range dr.Spec.GetTrafficPolicy().GetPortLevelSettings() {
+		if port := pls.GetPort().GetNumber(); port != 0 {
+			settings[port] = pls.GetTls()
+		}
+	}
+
+	var origination []tlsOrigination
+	for port, tls := range settings {
+		o, err := newTLSOrigination(host, port, tls)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls settings for port %d of DestinationRule %s/%s: %w", port, dr.Namespace, dr.Name, err)
+		}
+		if o != nil {
+			origination = append(origination, *o)
+		}
+	}
+	if len(origination) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(origination, func(a, b tlsOrigination) int {
+		return int(a.Port) - int(b.Port)
+	})
+
+	var buf bytes.Buffer
+	err := tlsOriginationEnvoyFilterTemplate.Execute(&buf, struct {
+		Name        string
+		Namespace   string
+		Waypoint    string
+		Host        string
+		Origination []tlsOrigination
+	}{dr.Name, dr.Namespace, waypoint, host, origination})
+	if err != nil {
+		return nil, err
+	}
+	ef := &networking.EnvoyFilter{}
+	if err := yaml.Unmarshal(buf.Bytes(), ef); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal EnvoyFilter: %w", err)
+	}
+	if dr.UID != "" {
+		ef.OwnerReferences = []metav1.OwnerReference{{
+			APIVersion: gvk.DestinationRule.GroupVersion(),
+			Kind:       gvk.DestinationRule.Kind,
+			Name:       dr.Name,
+			UID:        dr.UID,
+		}}
+	}
+	return ef, nil
+}
+
+// newTLSOrigination returns the TLS originated to the port of the host, nil if the settings originate none
+func newTLSOrigination(host string, port uint32, tls *networkingv1alpha3.ClientTLSSettings) (*tlsOrigination, error) {
+	switch tls.GetMode() {
+	case networkingv1alpha3.ClientTLSSettings_SIMPLE, networkingv1alpha3.ClientTLSSettings_MUTUAL:
+	default:
+		// ISTIO_MUTUAL is handled by the mesh
+		return nil, nil
+	}
+	if tls.GetCredentialName() != "" {
+		return nil, fmt.Errorf("credentialName is not supported, mount the certificates in the waypoint and set their files")
+	}
+
+	o := &tlsOrigination{
+		Port:            port,
+		Sni:             tls.GetSni(),
+		CaCertificates:  tls.GetCaCertificates(),
+		SubjectAltNames: tls.GetSubjectAltNames(),
+	}
+	if o.Sni == "" {
+		if strings.HasPrefix(host, "*") {
+			return nil, fmt.Errorf("sni must be set for wildcard host %s", host)
+		}
+		o.Sni = host
+	}
+	if tls.GetInsecureSkipVerify().GetValue() {
+		o.CaCertificates = ""
+		o.SubjectAltNames = nil
+	} else if o.CaCertificates == "" {
+		o.CaCertificates = systemCaCertificates
+	}
+	if tls.GetMode() == networkingv1alpha3.ClientTLSSettings_MUTUAL {
+		if tls.GetClientCertificate() == "" || tls.GetPrivateKey() == "" {
+			return nil, fmt.Errorf("clientCertificate and privateKey are required in MUTUAL mode")
+		}
+		o.ClientCertificate = tls.GetClientCertificate()
+		o.PrivateKey = tls.GetPrivateKey()
+	}
+	return o, nil
+}
+
+// applyTLSOrigination creates or updates the EnvoyFilter making the waypoint originate TLS as configured by the DestinationRule
+func applyTLSOrigination(ctx context.Context, kubeClient kube.CLIClient, ns, name, waypoint string) (*networking.EnvoyFilter, error) {
+	dr, err := kubeClient.Istio().NetworkingV1().DestinationRules(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DestinationRule %s/%s: %w", ns, name, err)
+	}
+	ses, err := kubeClient.Istio().NetworkingV1().ServiceEntries(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ServiceEntries in namespace %s: %w", ns, err)
+	}
+	var ports []uint32
+	for _, se := range ses.Items {
+		if !slices.Contains(se.Spec.GetHosts(), dr.Spec.GetHost()) {
+			continue
+		}
+		for _, port := range se.Spec.GetPorts() {
+			if !slices.Contains(ports, port.GetNumber()) {
+				ports = append(ports, port.GetNumber())
+			}
+		}
+	}
+
+	ef, err := TLSOriginationEnvoyFilter(dr, waypoint, ports)
+	if err != nil {
+		return nil, err
+	}
+	if ef == nil {
+		return nil, fmt.Errorf("DestinationRule %s/%s originates no TLS, its tls mode must be SIMPLE or MUTUAL", ns, name)
+	}
+
+	return applyEnvoyFilter(ctx, kubeClient, ef)
+}
+
+// applyEnvoyFilter creates the EnvoyFilter, or updates it if it exists
+func applyEnvoyFilter(ctx context.Context, kubeClient kube.CLIClient, ef *networking.EnvoyFilter) (*networking.EnvoyFilter, error) {
+	efc := kubeClient.Istio().NetworkingV1alpha3().EnvoyFilters(ef.Namespace)
+	existing, err := efc.Get(ctx, ef.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return efc.Create(ctx, ef, metav1.CreateOptions{FieldManager: "kmeshctl"})
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get EnvoyFilter %s/%s: %w", ef.Namespace, ef.Name, err)
+	}
+	ef.ResourceVersion = existing.ResourceVersion
+	return efc.Update(ctx, ef, metav1.UpdateOptions{FieldManager: "kmeshctl"})
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package waypoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	networkingv1alpha3 "istio.io/api/networking/v1alpha3"
+	networkingv1 "istio.io/client-go/pkg/apis/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTLSOriginationEnvoyFilter(t *testing.T) {
+	dr := &networkingv1.DestinationRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "external-api",
+			Namespace: "default",
+			UID:       "1234",
+		},
+	}
+	dr.Spec.Host = "api.example.com"
+	ef, err := TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{80})
+	require.NoError(t, err)
+	assert.Nil(t, ef)
+
+	// the traffic policy applies to port 80, port 8080 overrides it
+	dr.Spec.TrafficPolicy = &networkingv1alpha3.TrafficPolicy{
+		Tls: &networkingv1alpha3.ClientTLSSettings{Mode: networkingv1alpha3.ClientTLSSettings_SIMPLE},
+		PortLevelSettings: []*networkingv1alpha3.TrafficPolicy_PortTrafficPolicy{{
+			Port: &networkingv1alpha3.PortSelector{Number: 8080},
+			Tls: &networkingv1alpha3.ClientTLSSettings{
+				Mode:              networkingv1alpha3.ClientTLSSettings_MUTUAL,
+				ClientCertificate: "/etc/certs/cert.pem",
+				PrivateKey:        "/etc/certs/key.pem",
+				CaCertificates:    "/etc/certs/ca.pem",
+				SubjectAltNames:   []string{"api.example.com"},
+				Sni:               "mtls.example.com",
+			},
+		}},
+	}
+	ef, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{80, 8080})
+	require.NoError(t, err)
+	require.NotNil(t, ef)
+	assert.Equal(t, "external-api-tls-origination", ef.Name)
+	assert.Equal(t, "default", ef.Namespace)
+	assert.Equal(t, map[string]string{"gateway.networking.k8s.io/gateway-name": "waypoint"}, ef.Spec.WorkloadSelector.Labels)
+	assert.Equal(t, int32(10), ef.Spec.Priority)
+	require.Len(t, ef.Spec.ConfigPatches, 4)
+
+	cluster := ef.Spec.ConfigPatches[0].Patch.Value.Fields
+	assert.Equal(t, "kmesh_tls_origination|80|api.example.com", cluster["name"].GetStringValue())
+	tlsContext := cluster["transport_socket"].GetStructValue().Fields["typed_config"].GetStructValue().Fields
+	assert.Equal(t, "api.example.com", tlsContext["sni"].GetStringValue())
+	commonTlsContext := tlsContext["common_tls_context"].GetStructValue().Fields
+	assert.NotContains(t, commonTlsContext, "tls_certificates")
+	validation := commonTlsContext["validation_context"].GetStructValue().Fields
+	assert.Equal(t, systemCaCertificates, validation["trusted_ca"].GetStructValue().Fields["filename"].GetStringValue())
+	tcpProxy := ef.Spec.ConfigPatches[1]
+	assert.Equal(t, "inbound-vip|80|tcp|api.example.com", tcpProxy.Match.GetListener().GetFilterChain().GetName())
+	assert.Equal(t, "kmesh_tls_origination|80|api.example.com",
+		tcpProxy.Patch.Value.Fields["typed_config"].GetStructValue().Fields["cluster"].GetStringValue())
+
+	cluster = ef.Spec.ConfigPatches[2].Patch.Value.Fields
+	assert.Equal(t, "kmesh_tls_origination|8080|api.example.com", cluster["name"].GetStringValue())
+	tlsContext = cluster["transport_socket"].GetStructValue().Fields["typed_config"].GetStructValue().Fields
+	assert.Equal(t, "mtls.example.com", tlsContext["sni"].GetStringValue())
+	commonTlsContext = tlsContext["common_tls_context"].GetStructValue().Fields
+	certificate := commonTlsContext["tls_certificates"].GetListValue().Values[0].GetStructValue().Fields
+	assert.Equal(t, "/etc/certs/cert.pem", certificate["certificate_chain"].GetStructValue().Fields["filename"].GetStringValue())
+	assert.Equal(t, "/etc/certs/key.pem", certificate["private_key"].GetStructValue().Fields["filename"].GetStringValue())
+	validation = commonTlsContext["validation_context"].GetStructValue().Fields
+	assert.Equal(t, "/etc/certs/ca.pem", validation["trusted_ca"].GetStructValue().Fields["filename"].GetStringValue())
+	san := validation["match_typed_subject_alt_names"].GetListValue().Values[0].GetStructValue().Fields
+	assert.Equal(t, "api.example.com", san["matcher"].GetStructValue().Fields["exact"].GetStringValue())
+	assert.Equal(t, "inbound-vip|8080|tcp|api.example.com", ef.Spec.ConfigPatches[3].Match.GetListener().GetFilterChain().GetName())
+
+	require.Len(t, ef.OwnerReferences, 1)
+	assert.Equal(t, "DestinationRule", ef.OwnerReferences[0].Kind)
+	assert.Equal(t, dr.UID, ef.OwnerReferences[0].UID)
+}
+
+func TestTLSOriginationSettings(t *testing.T) {
+	dr := &networkingv1.DestinationRule{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "bar"}}
+	dr.Spec.Host = "foo"
+	dr.Spec.TrafficPolicy = &networkingv1alpha3.TrafficPolicy{
+		Tls: &networkingv1alpha3.ClientTLSSettings{
+			Mode:               networkingv1alpha3.ClientTLSSettings_SIMPLE,
+			InsecureSkipVerify: wrapperspb.Bool(true),
+		},
+	}
+	// the sni of a short name is the fqdn in the namespace of the DestinationRule
+	ef, err := TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	require.NoError(t, err)
+	require.Len(t, ef.Spec.ConfigPatches, 2)
+	tlsContext := ef.Spec.ConfigPatches[0].Patch.Value.Fields["transport_socket"].GetStructValue().Fields["typed_config"].GetStructValue().Fields
+	assert.Equal(t, "foo.bar.svc.cluster.local", tlsContext["sni"].GetStringValue())
+	assert.Empty(t, tlsContext["common_tls_context"].GetStructValue().Fields)
+
+	dr.Spec.Host = "*.example.com"
+	_, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	assert.ErrorContains(t, err, "sni must be set for wildcard host")
+	dr.Spec.TrafficPolicy.Tls.Sni = "api.example.com"
+	_, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	assert.NoError(t, err)
+
+	dr.Spec.TrafficPolicy.Tls.CredentialName = "client-credential"
+	_, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	assert.ErrorContains(t, err, "credentialName is not supported")
+
+	dr.Spec.TrafficPolicy.Tls = &networkingv1alpha3.ClientTLSSettings{Mode: networkingv1alpha3.ClientTLSSettings_MUTUAL, Sni: "api.example.com"}
+	_, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	assert.ErrorContains(t, err, "clientCertificate and privateKey are required")
+
+	dr.Spec.TrafficPolicy.Tls = &networkingv1alpha3.ClientTLSSettings{Mode: networkingv1alpha3.ClientTLSSettings_ISTIO_MUTUAL}
+	ef, err = TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{443})
+	require.NoError(t, err)
+	assert.Nil(t, ef)
+}
@@ -71,6 +71,7 @@ var (
 	waypointName    = constants.DefaultNamespaceWaypoint
 	enrollNamespace bool
 	overwrite       bool
+	proxyProtocol   bool
 )
 
 const waitTimeout = 90 * time.Second
@@ -137,6 +138,9 @@ func NewCmd() *cobra.Command {
 		}
 
 		gw.Annotations[WaypointImageAnnotation] = getKmeshWaypointImage()
+		if proxyProtocol {
+			gw.Annotations[KmeshProxyProtocolAnnotation] = ProxyProtocolV2
+		}
 
 		// only label if the user has provided their own value, otherwise we let istiod choose a default at runtime (service)
 		// this will allow for gateway class to provide a default for that class rather than always forcing service or requiring users to configure correctly
@@ -166,11 +170,14 @@ func NewCmd() *cobra.Command {
   kmeshctl waypoint generate --namespace default
 
   # Generate a waypoint that can process traffic for service in default namespace
-  kmeshctl waypoint generate --for service -n default`,
+  kmeshctl waypoint generate --for service -n default
+
+  # Generate a waypoint preserving the client address towards the backends with the PROXY protocol
+  kmeshctl waypoint generate --proxy-protocol -n default`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			gw, err := makeGateway(false)
 			if err != nil {
-				return fmt.Errorf("failed to create gateway: %v", err)
+				return fmt.Errorf("failed to create gateway: %w", err)
 			}
 			b, err := yaml.Marshal(gw)
 			if err != nil {
@@ -182,6 +189,20 @@ func NewCmd() *cobra.Command {
 			res = strings.ReplaceAll(res, `status: {}
 `, "")
 			fmt.Fprint(cmd.OutOrStdout(), res)
+
+			ef, err := ProxyProtocolEnvoyFilter(gw)
+			if err != nil || ef == nil {
+				return err
+			}
+			b, err = yaml.Marshal(ef)
+			if err != nil {
+				return err
+			}
+			res = strings.ReplaceAll(string(b), `  creationTimestamp: null
+`, "")
+			res = strings.ReplaceAll(res, `status: {}
+`, "")
+			fmt.Fprint(cmd.OutOrStdout(), "---\n"+res)
 			return nil
 		},
 	}
@@ -190,6 +211,9 @@ func NewCmd() *cobra.Command {
 		"",
 		fmt.Sprintf("Specify the traffic type %s for the waypoint", sets.SortedList(validTrafficTypes)),
 	)
+	waypointGenerateCmd.Flags().BoolVar(&proxyProtocol, "proxy-protocol", false,
+		"If set, the waypoint sends a PROXY protocol v2 header to the backends so that they observe the original client address. "+
+			"The kmesh.net/proxy-protocol annotation of the Gateway is only honored by this flag, the daemon does not reconcile it")
 	waypointApplyCmd := &cobra.Command{
 		Use:   "apply",
 		Short: "Apply a waypoint configuration",
@@ -201,11 +225,14 @@ func NewCmd() *cobra.Command {
   kmeshctl waypoint apply --namespace default --wait
  
   # Apply a waypoint to a specific pod
-  kmesh waypoint apply -n default --name reviews-v2-pod-waypoint --for workload`,
+  kmesh waypoint apply -n default --name reviews-v2-pod-waypoint --for workload
+
+  # Apply a waypoint preserving the client address towards the backends with the PROXY protocol
+  kmeshctl waypoint apply -n default --proxy-protocol`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			kubeClient, err := utils.CreateKubeClient()
 			if err != nil {
-				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
 			ns := namespaceOrDefault(namespace)
 			// If a user decides to enroll their namespace with a waypoint, verify that they have labeled their namespace as Kmesh.
@@ -229,7 +256,7 @@ func NewCmd() *cobra.Command {
 				}
 				namespaceIsLabeledKmesh, err := namespaceHasLabelWithValue(kubeClient, ns, label.IoIstioDataplaneMode.Name, DataplaneModeKmesh)
 				if err != nil {
-					return fmt.Errorf("failed to check if namespace is labeled Kmesh: %v", err)
+					return fmt.Errorf("failed to check if namespace is labeled Kmesh: %w", err)
 				}
 				if !namespaceIsLabeledKmesh {
 					fmt.Fprintf(cmd.OutOrStdout(), "Warning: namespace is not enrolled in Kmesh. Consider running\t"+
@@ -238,10 +265,10 @@ func NewCmd() *cobra.Command {
 			}
 			gw, err := makeGateway(true)
 			if err != nil {
-				return fmt.Errorf("failed to create gateway: %v", err)
+				return fmt.Errorf("failed to create gateway: %w", err)
 			}
 
-			_, err = kubeClient.GatewayAPI().GatewayV1().Gateways(ns).Create(context.Background(), gw, metav1.CreateOptions{
+			created, err := kubeClient.GatewayAPI().GatewayV1().Gateways(ns).Create(context.Background(), gw, metav1.CreateOptions{
 				FieldManager: "kmeshctl",
 			})
 			if err != nil {
@@ -251,6 +278,20 @@ func NewCmd() *cobra.Command {
 				return err
 			}
 
+			// the EnvoyFilter is owned by the waypoint so that it is deleted along with it
+			ef, err := ProxyProtocolEnvoyFilter(created)
+			if err != nil {
+				return err
+			}
+			if ef != nil {
+				_, err = kubeClient.Istio().NetworkingV1alpha3().EnvoyFilters(ns).Create(context.Background(), ef, metav1.CreateOptions{
+					FieldManager: "kmeshctl",
+				})
+				if err != nil {
+					return fmt.Errorf("failed to create PROXY protocol EnvoyFilter for waypoint %v/%v: %w", ns, gw.Name, err)
+				}
+			}
+
 			if waitReady {
 				startTime := time.Now()
 				ticker := time.NewTicker(1 * time.Second)
@@ -282,7 +323,7 @@ func NewCmd() *cobra.Command {
 			if enrollNamespace {
 				err = labelNamespaceWithWaypoint(kubeClient, ns)
 				if err != nil {
-					return fmt.Errorf("failed to label namespace with waypoint: %v", err)
+					return fmt.Errorf("failed to label namespace with waypoint: %w", err)
 				}
 				fmt.Fprintf(cmd.OutOrStdout(), "namespace %v labeled with \"%v: %v\"\n", ns,
 					KmeshUseWaypointLabel, gw.Name)
@@ -303,25 +344,40 @@ func NewCmd() *cobra.Command {
 	waypointApplyCmd.Flags().BoolVarP(&overwrite, "overwrite", "", false,
 		"Overwrite the existing Waypoint used by the namespace")
 
+	waypointApplyCmd.Flags().BoolVar(&proxyProtocol, "proxy-protocol", false,
+		"If set, the waypoint sends a PROXY protocol v2 header to the backends so that they observe the original client address. "+
+			"The kmesh.net/proxy-protocol annotation of the Gateway is only honored by this flag, the daemon does not reconcile it")
+
 	waypointStatusCmd := &cobra.Command{
-		Use:   "status",
+		Use:   "status [<namespace>]",
 		Short: "Show the status of waypoints in a namespace",
-		Long:  "Show the status of waypoints for the namespace provided or default namespace if none is provided",
+		Long: `Show the status of waypoints for the namespace provided or default namespace if none is provided,
+along with the HBONE health of their pods read from the proxy admin interface: whether the HBONE
+listener is ready, the number of active tunneled connections and the status of the mTLS certificate`,
 		Example: `  # Show the status of the waypoint in the default namespace
   kmeshctl waypoint status
 
   # Show the status of the waypoint in a specific namespace
-  kmeshctl waypoint status --namespace foo`,
+  kmeshctl waypoint status foo
+
+  # Show the status of the waypoint in a specific namespace in json
+  kmeshctl waypoint status --namespace foo -o json`,
 		Args: func(cmd *cobra.Command, args []string) error {
-			if len(args) != 0 {
-				return fmt.Errorf("unknown subcommand %q", args[0])
+			if len(args) > 1 {
+				return fmt.Errorf("unknown subcommand %q", args[1])
+			}
+			if err := utils.ValidateOutput(output); err != nil {
+				return err
 			}
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				namespace = args[0]
+			}
 			kubeClient, err := utils.CreateKubeClient()
 			if err != nil {
-				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
 			ns := namespaceOrDefault(namespace)
 			gws, err := kubeClient.GatewayAPI().GatewayV1().Gateways(ns).
@@ -331,10 +387,6 @@ func NewCmd() *cobra.Command {
 			}
 			writer := cmd.OutOrStdout()
 			w := new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0)
-			if len(gws.Items) == 0 {
-				fmt.Fprintln(writer, "No waypoints found.")
-				return nil
-			}
 			slices.SortFunc(gws.Items, func(i, j gateway.Gateway) int {
 				if r := cmp.Compare(i.Namespace, j.Namespace); r != 0 {
 					return r
@@ -348,13 +400,94 @@ func NewCmd() *cobra.Command {
 				}
 				filteredGws = append(filteredGws, gw)
 			}
-			err = printWaypointStatus(w, kubeClient, filteredGws)
+			if len(filteredGws) == 0 && output != utils.OutputJson {
+				fmt.Fprintln(writer, "No waypoints found.")
+				return nil
+			}
+			health := getWaypointHealth(kubeClient, filteredGws)
+			return utils.PrintOutput(writer, output, health, func() error {
+				if err := printWaypointStatus(w, kubeClient, filteredGws); err != nil {
+					return fmt.Errorf("failed to print waypoint status: %w", err)
+				}
+				fmt.Fprintln(writer)
+				return printWaypointHealth(w, health)
+			})
+		},
+	}
+	utils.AddOutputFlag(waypointStatusCmd, &output)
+
+	waypointStatsCmd := &cobra.Command{
+		Use:   "stats [<namespace>]",
+		Short: "Show the L7 stats of waypoints by service",
+		Long: `Show the requests, requests per second, p50/p99 latency and active connections of the services
+behind the waypoints of the namespace provided or default namespace if none is provided. The stats are
+read from the proxy admin interface of the waypoint pods at the start and at the end of the interval,
+and summed over the pods of each waypoint`,
+		Example: `  # Show the stats of the waypoints in the default namespace over 10 seconds
+  kmeshctl waypoint stats
+
+  # Show the stats of a waypoint in a specific namespace over a minute
+  kmeshctl waypoint stats foo --name waypoint --interval 1m
+
+  # Show the stats of the waypoints in a specific namespace in json
+  kmeshctl waypoint stats --namespace foo -o json`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 1 {
+				return fmt.Errorf("unknown subcommand %q", args[1])
+			}
+			if err := utils.ValidateOutput(output); err != nil {
+				return err
+			}
+			if statsInterval <= 0 {
+				return fmt.Errorf("invalid interval %v, it must be positive", statsInterval)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				namespace = args[0]
+			}
+			kubeClient, err := utils.CreateKubeClient()
 			if err != nil {
-				return fmt.Errorf("failed to print waypoint status: %v", err)
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
-			return w.Flush()
+			ns := namespaceOrDefault(namespace)
+			gws, err := kubeClient.GatewayAPI().GatewayV1().Gateways(ns).
+				List(context.Background(), metav1.ListOptions{})
+			if err != nil {
+				return err
+			}
+			filteredGws := make([]gateway.Gateway, 0)
+			for _, gw := range gws.Items {
+				if gw.Spec.GatewayClassName != constants.WaypointGatewayClassName {
+					continue
+				}
+				// all the waypoints are shown unless one is named
+				if cmd.Flags().Changed("name") && gw.Name != waypointName {
+					continue
+				}
+				filteredGws = append(filteredGws, gw)
+			}
+			slices.SortFunc(filteredGws, func(i, j gateway.Gateway) int {
+				return cmp.Compare(i.Name, j.Name)
+			})
+			writer := cmd.OutOrStdout()
+			if len(filteredGws) == 0 && output != utils.OutputJson {
+				fmt.Fprintln(writer, "No waypoints found.")
+				return nil
+			}
+			stats, err := getWaypointStats(kubeClient, filteredGws, statsInterval, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			return utils.PrintOutput(writer, output, stats, func() error {
+				return printWaypointStats(new(tabwriter.Writer).Init(writer, 0, 8, 5, ' ', 0), stats)
+			})
 		},
 	}
+	utils.AddOutputFlag(waypointStatsCmd, &output)
+	waypointStatsCmd.Flags().DurationVar(&statsInterval, "interval", 10*time.Second,
+		"Interval over which the requests are counted")
 
 	waypointDeleteCmd := &cobra.Command{
 		Use:   "delete",
@@ -383,7 +516,7 @@ func NewCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			kubeClient, err := utils.CreateKubeClient()
 			if err != nil {
-				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
 			ns := namespaceOrDefault(namespace)
 
@@ -411,7 +544,7 @@ func NewCmd() *cobra.Command {
 			writer := cmd.OutOrStdout()
 			kubeClient, err := utils.CreateKubeClient()
 			if err != nil {
-				return fmt.Errorf("failed to create Kubernetes client: %v", err)
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
 			}
 			var ns string
 			if allNamespaces {
@@ -469,14 +602,77 @@ func NewCmd() *cobra.Command {
 	}
 	waypointListCmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List all waypoints in all namespaces")
 
+	waypointTLSOriginationCmd := &cobra.Command{
+		Use:   "tls-origination <destination-rule>",
+		Short: "Make a waypoint originate TLS as configured by a DestinationRule",
+		Long: `Make a waypoint originate TLS to the ports of the host of a DestinationRule whose tls mode is SIMPLE
+or MUTUAL, so that the plaintext traffic of the mesh reaches the external services over TLS. The SNI is
+the sni of the tls settings, or the host of the DestinationRule. The upstreams are verified with the
+caCertificates, or the trust bundle of the waypoint, unless insecureSkipVerify is set. The certificate
+files must be mounted in the waypoint, credentialName is not supported. The ports of the traffic policy
+are the ones of the ServiceEntries of the host in the namespace of the DestinationRule.
+The EnvoyFilter applied is owned by the DestinationRule, apply it again once the DestinationRule changed.`,
+		Example: `  # Make the waypoint of the namespace originate TLS as configured by the DestinationRule
+  kmeshctl waypoint tls-origination external-api --namespace default
+
+  # Make a named waypoint originate TLS
+  kmeshctl waypoint tls-origination external-api --namespace default --name egress-waypoint`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kubeClient, err := utils.CreateKubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
+			}
+			ns := namespaceOrDefault(namespace)
+			ef, err := applyTLSOrigination(context.Background(), kubeClient, ns, args[0], waypointName)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "EnvoyFilter %v/%v applied to waypoint %v\n", ns, ef.Name, waypointName)
+			return nil
+		},
+	}
+
+	waypointMaxRequestsCmd := &cobra.Command{
+		Use:   "max-requests-per-connection <destination-rule>",
+		Short: "Make a waypoint recycle its connections as configured by a DestinationRule",
+		Long: `Make a waypoint close its upstream connections to the host of a DestinationRule once they carried the
+maxRequestsPerConnection of the http connection pool of the DestinationRule, so that long lived clients
+spread their requests over the backends rescaled since. The limit of the traffic policy applies to all
+the ports of the host unless overridden by the port level settings, 0 means unlimited.
+The EnvoyFilter applied is owned by the DestinationRule, apply it again once the DestinationRule changed.`,
+		Example: `  # Make the waypoint of the namespace recycle its connections as configured by the DestinationRule
+  kmeshctl waypoint max-requests-per-connection reviews --namespace default
+
+  # Make a named waypoint recycle its connections
+  kmeshctl waypoint max-requests-per-connection reviews --namespace default --name reviews-waypoint`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kubeClient, err := utils.CreateKubeClient()
+			if err != nil {
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
+			}
+			ns := namespaceOrDefault(namespace)
+			ef, err := applyMaxRequests(context.Background(), kubeClient, ns, args[0], waypointName)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "EnvoyFilter %v/%v applied to waypoint %v\n", ns, ef.Name, waypointName)
+			return nil
+		},
+	}
+
 	waypointApplyCmd.Flags().StringVarP(&revision, "revision", "r", "", "The revision to label the waypoint with")
 	waypointApplyCmd.Flags().BoolVarP(&waitReady, "wait", "w", false, "Wait for the waypoint to be ready")
 	waypointGenerateCmd.Flags().StringVarP(&revision, "revision", "r", "", "The revision to label the waypoint with")
 	waypointCmd.AddCommand(waypointListCmd)
 	waypointCmd.AddCommand(waypointDeleteCmd)
 	waypointCmd.AddCommand(waypointStatusCmd)
+	waypointCmd.AddCommand(waypointStatsCmd)
 	waypointCmd.AddCommand(waypointGenerateCmd)
 	waypointCmd.AddCommand(waypointApplyCmd)
+	waypointCmd.AddCommand(waypointTLSOriginationCmd)
+	waypointCmd.AddCommand(waypointMaxRequestsCmd)
 
 	return waypointCmd
 }
@@ -579,7 +775,7 @@ func labelNamespaceWithWaypoint(kubeClient kube.CLIClient, ns string) error {
 	}
 	nsObj.Labels[KmeshUseWaypointLabel] = waypointName
 	if _, err := kubeClient.Kube().CoreV1().Namespaces().Update(context.Background(), nsObj, metav1.UpdateOptions{}); err != nil {
-		return fmt.Errorf("failed to update namespace %s: %v", ns, err)
+		return fmt.Errorf("failed to update namespace %s: %w", ns, err)
 	}
 	return nil
 }
@@ -589,7 +785,7 @@ func getNamespace(kubeClient kube.CLIClient, ns string) (*corev1.Namespace, erro
 	if errors.IsNotFound(err) {
 		return nil, fmt.Errorf("namespace: %s not found", ns)
 	} else if err != nil {
-		return nil, fmt.Errorf("failed to get namespace %s: %v", ns, err)
+		return nil, fmt.Errorf("failed to get namespace %s: %w", ns, err)
 	}
 	return nsObj, nil
 }
@@ -0,0 +1,121 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workloads
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const requestTimeout = 10 * time.Second
+
+var log = logger.NewLoggerScope("kmeshctl/workloads")
+
+var (
+	namespace string
+	output    string
+)
+
+func NewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workloads <kmesh-daemon-pod> [<pod>]",
+		Short: "Show the pods of the node managed by Kmesh and their enrollment status",
+		Long: `Show the pods on the node of a kmesh daemon which should be managed by Kmesh, the mode their traffic is
+redirected in, kernel-native or dual-engine, when they got managed and why the last attempt to manage
+them failed, if it did. A pod which never got managed has no enrollment time.`,
+		Example: `# Show the pods managed by the kmesh daemon
+kmeshctl workloads <kmesh-daemon-pod>
+
+# Show the pods of the default namespace
+kmeshctl workloads <kmesh-daemon-pod> -n default
+
+# Print the enrollment of the foo pod in json
+kmeshctl workloads <kmesh-daemon-pod> foo -n default -o json`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			var pod string
+			if len(args) > 1 {
+				pod = args[1]
+			}
+			if err := runWorkloads(cmd.OutOrStdout(), args[0], pod); err != nil {
+				utils.Exit(log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "namespace of the pods, all the namespaces if empty")
+	utils.AddOutputFlag(cmd, &output)
+	return cmd
+}
+
+func runWorkloads(w io.Writer, podName, pod string) error {
+	if err := utils.ValidateOutput(output); err != nil {
+		return err
+	}
+
+	cli, err := utils.CreateKubeClient()
+	if err != nil {
+		return fmt.Errorf("failed to create cli client: %w", err)
+	}
+	client, err := utils.CreateKmeshAdminClient(cli, podName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	resp, err := client.ListEnrolledWorkloads(ctx, &adminapi.ListEnrolledWorkloadsRequest{Namespace: namespace, Name: pod})
+	if err != nil {
+		return fmt.Errorf("failed to list the workloads of pod %s: %w", podName, err)
+	}
+
+	return utils.PrintOutput(w, output, resp, func() error {
+		return printWorkloads(tabwriter.NewWriter(w, 0, 0, 3, ' ', 0), resp.GetWorkloads())
+	})
+}
+
+func printWorkloads(w *tabwriter.Writer, workloads []*adminapi.EnrolledWorkload) error {
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tMODE\tENROLLED\tERROR")
+	for _, workload := range workloads {
+		mode := "-"
+		switch workload.GetMode() {
+		case adminapi.Mode_KERNEL_NATIVE:
+			mode = "kernel-native"
+		case adminapi.Mode_DUAL_ENGINE:
+			mode = "dual-engine"
+		}
+		enrolled := "-"
+		if workload.GetEnrolledAt() != 0 {
+			enrolled = time.Unix(workload.GetEnrolledAt(), 0).UTC().Format(time.RFC3339)
+		}
+		errMsg := workload.GetError()
+		if errMsg == "" {
+			errMsg = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", workload.GetNamespace(), workload.GetName(), mode, enrolled, errMsg)
+	}
+	return w.Flush()
+}
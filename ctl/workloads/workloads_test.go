@@ -0,0 +1,43 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workloads
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+func TestPrintWorkloads(t *testing.T) {
+	var buf bytes.Buffer
+	err := printWorkloads(tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0), []*adminapi.EnrolledWorkload{
+		{Namespace: "default", Name: "httpbin", Mode: adminapi.Mode_DUAL_ENGINE, EnrolledAt: 1760601600, Error: "failed to link xdp"},
+		{Namespace: "default", Name: "sleep", Mode: adminapi.Mode_KERNEL_NATIVE, EnrolledAt: 1760601600},
+		{Namespace: "foo", Name: "sleep", Mode: adminapi.Mode_DUAL_ENGINE, Error: "failed to enable Kmesh manage"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `NAMESPACE   NAME      MODE            ENROLLED               ERROR
+default     httpbin   dual-engine     2025-10-16T08:00:00Z   failed to link xdp
+default     sleep     kernel-native   2025-10-16T08:00:00Z   -
+foo         sleep     dual-engine     -                      failed to enable Kmesh manage
+`, buf.String())
+}
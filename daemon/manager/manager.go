@@ -32,6 +32,8 @@ import (
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/bpf"
 	"kmesh.net/kmesh/pkg/bpf/restart"
+	"kmesh.net/kmesh/pkg/bpf/selftest"
+	"kmesh.net/kmesh/pkg/bpf/verifier"
 	"kmesh.net/kmesh/pkg/cni"
 	"kmesh.net/kmesh/pkg/controller"
 	"kmesh.net/kmesh/pkg/logger"
@@ -74,7 +76,13 @@ func NewCommand() *cobra.Command {
 	return cmd
 }
 
-// Execute start daemon manager process
+// Execute start daemon manager process.
+// On exit the components are stopped in the reverse order of their start:
+//  1. the CNI config is removed, no new pod gets enrolled
+//  2. the status server is stopped
+//  3. the controller releases the pods unless kmesh restarts, their redirection is disabled and the
+//     programs linked to them are detached, then it stops
+//  4. the bpf programs are unloaded and their links removed unless kmesh restarts
 func Execute(configs *options.BootstrapConfigs) error {
 	err := rlimit.RemoveMemlock()
 	if err != nil {
@@ -86,10 +94,23 @@ func Execute(configs *options.BootstrapConfigs) error {
 	// https://github.com/kmesh-net/kmesh/issues/951
 	defer bpfLoader.Stop()
 	if err := bpfLoader.Start(); err != nil {
+		if failure := verifier.Record(err); failure != nil {
+			failure.Log()
+			return serveStartFailure(configs, bpfLoader, err)
+		}
 		return err
 	}
 	log.Info("bpf loader start successfully")
 
+	if configs.BpfConfig.EnableSelfTest {
+		result := selftest.Run(configs.BpfConfig.Mode, newSelfTestProber(configs.BpfConfig, bpfLoader))
+		result.Log()
+		if err := result.Err(); err != nil {
+			return serveStartFailure(configs, bpfLoader, err)
+		}
+		log.Info("self-test passed")
+	}
+
 	stopCh := make(chan struct{})
 	defer close(stopCh)
 
@@ -100,7 +121,7 @@ func Execute(configs *options.BootstrapConfigs) error {
 	log.Info("controller start successfully")
 	defer c.Stop()
 
-	statusServer := status.NewServer(c.GetXdsClient(), configs, bpfLoader)
+	statusServer := status.NewServer(c.GetXdsClient(), c.GetEnrollments(), configs, bpfLoader)
 	statusServer.StartServer()
 	defer func() {
 		_ = statusServer.StopServer()
@@ -120,6 +141,29 @@ func Execute(configs *options.BootstrapConfigs) error {
 	return nil
 }
 
+// newSelfTestProber returns the prober of the self-test, with the xdp authz program and its verdicts in the
+// dual-engine mode
+func newSelfTestProber(config *options.BpfConfig, bpfLoader *bpf.BpfLoader) selftest.Prober {
+	if workloadObj := bpfLoader.GetBpfWorkload(); workloadObj != nil {
+		xdpAuth := workloadObj.XdpAuth
+		return selftest.NewKernelProber(config.Cgroup2Path, xdpAuth.XdpAuthz, xdpAuth.KmAuthRes)
+	}
+	return selftest.NewKernelProber(config.Cgroup2Path, nil, nil)
+}
+
+// serveStartFailure keeps the status server running after a bpf program was rejected by the verifier or
+// the self-test failed, so that the readiness probe and kmeshctl check report it until the daemon is stopped
+func serveStartFailure(configs *options.BootstrapConfigs, bpfLoader *bpf.BpfLoader, err error) error {
+	statusServer := status.NewServer(nil, nil, configs, bpfLoader)
+	statusServer.StartServer()
+	defer func() {
+		_ = statusServer.StopServer()
+	}()
+
+	setupSignalHandler()
+	return err
+}
+
 func setupSignalHandler() {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, syscall.SIGABRT, syscall.SIGTSTP)
@@ -0,0 +1,46 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type authzConfig struct {
+	// DefaultDenyCrossNamespace denies the connections from other namespaces to the workloads no ALLOW policy applies to
+	DefaultDenyCrossNamespace bool
+	// EnableNetworkPolicy enforces the kubernetes NetworkPolicies like the authorization policies
+	EnableNetworkPolicy bool
+	// EnableAuditPolicy logs the connections the AUDIT AuthorizationPolicies match
+	EnableAuditPolicy bool
+	// RootNamespace is the root namespace of istio, its AUDIT policies apply to the whole mesh
+	RootNamespace string
+}
+
+func (c *authzConfig) AttachFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&c.DefaultDenyCrossNamespace, "default-deny-cross-namespace", false,
+		"deny the connections from other namespaces to the workloads no ALLOW authorization policy applies to, "+
+			"an ALLOW policy permits them explicitly. Only supported in dual-engine mode, default to false")
+	cmd.PersistentFlags().BoolVar(&c.EnableNetworkPolicy, "enable-network-policy", false,
+		"enforce the ingress and egress rules of the kubernetes NetworkPolicies, translated into authorization policies of "+
+			"the pods they apply to. The egress is only enforced at the pods kmesh manages. Only supported in dual-engine mode, default to false")
+	cmd.PersistentFlags().BoolVar(&c.EnableAuditPolicy, "enable-audit-policy", false,
+		"log the connections the AUDIT AuthorizationPolicies match, which istiod does not push to kmesh, by watching them. "+
+			"They are evaluated in the daemon and never change the verdict. Only supported in dual-engine mode, default to false")
+	cmd.PersistentFlags().StringVar(&c.RootNamespace, "root-namespace", "istio-system",
+		"root namespace of istio, its AUDIT AuthorizationPolicies apply to the whole mesh")
+}
@@ -17,41 +17,61 @@
 package options
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
 
 	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/utils"
 )
 
 type BpfConfig struct {
 	Mode             string
 	BpfFsPath        string
-	Cgroup2Path      string
+	Cgroup2Path      string // cgroup2 mount the programs attach to, detected if empty
 	EnableMda        bool
 	EnableMonitoring bool
 	EnableProfiling  bool
 	EnableIPsec      bool
+	EnableSelfTest   bool
+	// MaxConntrackEntries sizes the conntrack of the dual-engine mode, its idle flows are evicted when it is full
+	MaxConntrackEntries uint32
+	// XdpMode is the mode the xdp program is attached to the interfaces of the pods in
+	XdpMode string
+	// RedirectPorts are the destination ports whose connections are managed by kmesh, as given by the flag
+	RedirectPorts []uint
+	// RedirectedPorts are RedirectPorts validated by ParseConfig, empty redirects all the ports
+	RedirectedPorts []uint16
 }
 
 func (c *BpfConfig) AttachFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(&c.BpfFsPath, "bpf-fs-path", "/sys/fs/bpf", "bpf fs path")
-	cmd.PersistentFlags().StringVar(&c.Cgroup2Path, "cgroup2-path", "/mnt/kmesh_cgroup2", "cgroup2 path")
+	cmd.PersistentFlags().StringVar(&c.Cgroup2Path, "cgroup-path", "", "path of the cgroup2 mount the programs attach to. "+
+		"Empty uses /mnt/kmesh_cgroup2 if it is a cgroup2 mount, or else detects the cgroup2 mount of the node")
+	cmd.PersistentFlags().StringVar(&c.Cgroup2Path, "cgroup2-path", "", "path of the cgroup2 mount the programs attach to")
+	_ = cmd.PersistentFlags().MarkDeprecated("cgroup2-path", "use --cgroup-path instead")
 	cmd.PersistentFlags().StringVar(&c.Mode, "mode", "dual-engine", "controller plane mode, valid values are [kernel-native, dual-engine]")
 	cmd.PersistentFlags().BoolVar(&c.EnableMda, "enable-mda", false, "enable mda")
 	cmd.PersistentFlags().BoolVar(&c.EnableMonitoring, "monitoring", true, "enable kmesh traffic monitoring in daemon process")
 	cmd.PersistentFlags().BoolVar(&c.EnableProfiling, "profiling", false, "whether to enable profiling or not, default to false")
 	cmd.PersistentFlags().BoolVar(&c.EnableIPsec, "enable-ipsec", false, "enable ipsec encryption and authentication between nodes")
+	cmd.PersistentFlags().BoolVar(&c.EnableSelfTest, "self-test", false, "verify bpf program attachment with a loopback connection and the xdp authz verdict of a denied connection on startup, a failure is reported by the readiness probe")
+	cmd.PersistentFlags().Uint32Var(&c.MaxConntrackEntries, "max-conntrack-entries", constants.DefaultMaxConntrackEntries,
+		"maximum number of flows in the conntrack of the dual-engine mode, the least recently used flows are evicted when it is full")
+	cmd.PersistentFlags().StringVar(&c.XdpMode, "xdp-mode", constants.XdpModeAuto, "mode the xdp program is attached to the pod interfaces in, "+
+		"one of auto, native, driver, generic or skb. auto attaches it in driver mode and falls back to generic if the nic driver has no native xdp support")
+	cmd.PersistentFlags().UintSliceVar(&c.RedirectPorts, "redirect-ports", nil,
+		"comma separated destination ports whose connections are managed by kmesh, e.g. 80,443,8080, the connections to the "+
+			"other ports go direct. Empty redirects all the ports. Only supported in dual-engine mode")
 }
 
 func (c *BpfConfig) ParseConfig() error {
 	var err error
 
-	if c.Cgroup2Path, err = filepath.Abs(c.Cgroup2Path); err != nil {
-		return err
-	}
-	if _, err = os.Stat(c.Cgroup2Path); err != nil {
+	if c.Cgroup2Path, err = utils.ResolveCgroup2Path(c.Cgroup2Path); err != nil {
 		return err
 	}
 
@@ -62,6 +82,24 @@ func (c *BpfConfig) ParseConfig() error {
 		return err
 	}
 
+	if c.MaxConntrackEntries == 0 {
+		return fmt.Errorf("invalid --max-conntrack-entries 0, must be positive")
+	}
+
+	switch c.XdpMode {
+	case constants.XdpModeAuto, constants.XdpModeNative, constants.XdpModeDriver, constants.XdpModeGeneric, constants.XdpModeSkb:
+	default:
+		return fmt.Errorf("invalid --xdp-mode %q, must be one of auto, native, driver, generic or skb", c.XdpMode)
+	}
+
+	c.RedirectedPorts = nil
+	for _, port := range c.RedirectPorts {
+		if port == 0 || port > math.MaxUint16 {
+			return fmt.Errorf("invalid --redirect-ports %d, must be between 1 and %d", port, math.MaxUint16)
+		}
+		c.RedirectedPorts = append(c.RedirectedPorts, uint16(port))
+	}
+
 	return nil
 }
 
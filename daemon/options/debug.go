@@ -0,0 +1,34 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package options
+
+import (
+	"github.com/spf13/cobra"
+)
+
+type debugConfig struct {
+	// EnablePprof serves net/http/pprof on localhost
+	EnablePprof bool
+	// AdminRestTokenFile holds the token of the read-only REST admin api, the api is served when set
+	AdminRestTokenFile string
+}
+
+func (c *debugConfig) AttachFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().BoolVar(&c.EnablePprof, "enable-pprof", false, "serve the go runtime profiles of the daemon on localhost:15202, default to false")
+	cmd.PersistentFlags().StringVar(&c.AdminRestTokenFile, "admin-rest-token-file", "",
+		"file holding the bearer token of the read-only REST admin api served on localhost:15203, the api is disabled when empty")
+}
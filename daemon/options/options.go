@@ -22,6 +22,8 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
+
+	"kmesh.net/kmesh/pkg/constants"
 )
 
 type BootstrapConfigs struct {
@@ -29,6 +31,10 @@ type BootstrapConfigs struct {
 	CniConfig           *cniConfig
 	ByPassConfig        *byPassConfig
 	SecretManagerConfig *secretConfig
+	XdsConfig           *xdsConfig
+	DebugConfig         *debugConfig
+	TelemetryConfig     *telemetryConfig
+	AuthzConfig         *authzConfig
 }
 
 func NewBootstrapConfigs() *BootstrapConfigs {
@@ -37,6 +43,10 @@ func NewBootstrapConfigs() *BootstrapConfigs {
 		CniConfig:           &cniConfig{},
 		ByPassConfig:        &byPassConfig{},
 		SecretManagerConfig: &secretConfig{},
+		XdsConfig:           &xdsConfig{},
+		DebugConfig:         &debugConfig{},
+		TelemetryConfig:     &telemetryConfig{},
+		AuthzConfig:         &authzConfig{},
 	}
 }
 
@@ -54,6 +64,10 @@ func (c *BootstrapConfigs) AttachFlags(cmd *cobra.Command) {
 	c.CniConfig.AttachFlags(cmd)
 	c.ByPassConfig.AttachFlags(cmd)
 	c.SecretManagerConfig.AttachFlags(cmd)
+	c.XdsConfig.AttachFlags(cmd)
+	c.DebugConfig.AttachFlags(cmd)
+	c.TelemetryConfig.AttachFlags(cmd)
+	c.AuthzConfig.AttachFlags(cmd)
 }
 
 func (c *BootstrapConfigs) ParseConfigs() error {
@@ -63,5 +77,26 @@ func (c *BootstrapConfigs) ParseConfigs() error {
 	if err := c.CniConfig.ParseConfig(); err != nil {
 		return fmt.Errorf("parse CniConfig failed, %v", err)
 	}
+	if err := c.XdsConfig.ParseConfig(); err != nil {
+		return fmt.Errorf("parse XdsConfig failed, %v", err)
+	}
+	if err := c.TelemetryConfig.ParseConfig(); err != nil {
+		return fmt.Errorf("parse TelemetryConfig failed, %v", err)
+	}
+	if len(c.XdsConfig.WatchedNamespaces) != 0 && !c.BpfConfig.DualEngineEnabled() {
+		return fmt.Errorf("--watched-namespaces is only supported in %s mode", constants.DualEngineMode)
+	}
+	if c.XdsConfig.OnXdsLoss != XdsLossFailStatic && !c.BpfConfig.DualEngineEnabled() {
+		return fmt.Errorf("--on-xds-loss=%s is only supported in %s mode", c.XdsConfig.OnXdsLoss, constants.DualEngineMode)
+	}
+	if c.TelemetryConfig.OtlpEndpoint != "" && !c.BpfConfig.DualEngineEnabled() {
+		return fmt.Errorf("--otlp-endpoint is only supported in %s mode", constants.DualEngineMode)
+	}
+	if c.AuthzConfig.DefaultDenyCrossNamespace && !c.BpfConfig.DualEngineEnabled() {
+		return fmt.Errorf("--default-deny-cross-namespace is only supported in %s mode", constants.DualEngineMode)
+	}
+	if c.AuthzConfig.EnableNetworkPolicy && !c.BpfConfig.DualEngineEnabled() {
+		return fmt.Errorf("--enable-network-policy is only supported in %s mode", constants.DualEngineMode)
+	}
 	return nil
 }
@@ -0,0 +1,74 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package options
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type telemetryConfig struct {
+	// OtlpEndpoint is the OTLP grpc collector the connection spans are exported to, the export is disabled if empty
+	OtlpEndpoint string
+	OtlpInsecure bool
+	// AccesslogSamplingRatio is the ratio of the connections written to the accesslog and exported as spans
+	AccesslogSamplingRatio float64
+	// AccesslogSocket is the unix socket the accesslog entries are also written to as NDJSON, disabled if empty
+	AccesslogSocket string
+	// GeoIPDatabases are the MaxMind DB files the external destinations of the accesslog are located with,
+	// disabled if empty
+	GeoIPDatabases []string
+	// MetricsNamespaces are the namespaces whose workloads and services are labeled in the metrics, all if empty
+	MetricsNamespaces []string
+}
+
+func (c *telemetryConfig) AttachFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&c.OtlpEndpoint, "otlp-endpoint", "",
+		"host:port of the OTLP grpc collector the L4 connections are exported to as spans, disabled if empty. "+
+			"Only supported in dual-engine mode with monitoring enabled")
+	cmd.PersistentFlags().BoolVar(&c.OtlpInsecure, "otlp-insecure", false, "connect to the OTLP collector without TLS")
+	cmd.PersistentFlags().Float64Var(&c.AccesslogSamplingRatio, "accesslog-sampling-ratio", 1,
+		"ratio, between 0 and 1, of the connections written to the accesslog and exported to the OTLP collector")
+	cmd.PersistentFlags().StringVar(&c.AccesslogSocket, "accesslog-socket", "",
+		"path of the unix socket of a node local log agent the accesslog entries are also written to, a JSON object "+
+			"per line, disabled if empty. The entries are buffered while the agent is absent. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringSliceVar(&c.GeoIPDatabases, "geoip-database", nil,
+		"comma separated MaxMind DB files, e.g. the GeoLite2 Country and ASN ones, the country and ASN of the external "+
+			"destinations are added to the accesslog with, disabled if empty. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringSliceVar(&c.MetricsNamespaces, "metrics-namespaces", nil,
+		"comma separated namespaces whose workloads and services are labeled in the metrics, the ones of the other "+
+			"namespaces are aggregated in the \"other\" workload, service and namespace. Empty labels all namespaces")
+}
+
+func (c *telemetryConfig) ParseConfig() error {
+	if c.AccesslogSamplingRatio < 0 || c.AccesslogSamplingRatio > 1 {
+		return fmt.Errorf("invalid --accesslog-sampling-ratio %v, must be between 0 and 1", c.AccesslogSamplingRatio)
+	}
+	if c.AccesslogSocket != "" && !filepath.IsAbs(c.AccesslogSocket) {
+		return fmt.Errorf("invalid --accesslog-socket %q, must be an absolute path", c.AccesslogSocket)
+	}
+	for _, ns := range c.MetricsNamespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) != 0 {
+			return fmt.Errorf("invalid metrics namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package options
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// XdsLossFailStatic keeps enforcing the last configuration received when the xds connection is lost
+	XdsLossFailStatic = "fail-static"
+	// XdsLossFailOpen stops enforcing the authorization policies after the grace period
+	XdsLossFailOpen = "fail-open"
+	// XdsLossFailClosed denies the new connections after the grace period
+	XdsLossFailClosed = "fail-closed"
+
+	// LocalityPreferClose sends the traffic to the closest healthy endpoints, failing over to the farther ones
+	LocalityPreferClose = "PreferClose"
+	// LocalityDistribute spreads the traffic over all the endpoints regardless of their locality
+	LocalityDistribute = "Distribute"
+	// LocalityStrict only sends the traffic to the endpoints in the same locality
+	LocalityStrict = "Strict"
+
+	// TrafficDistributionPrecedenceSpec makes the spec.trafficDistribution of a service win over its annotation
+	TrafficDistributionPrecedenceSpec = "spec"
+	// TrafficDistributionPrecedenceAnnotation makes the networking.istio.io/traffic-distribution annotation of a
+	// service win over its spec.trafficDistribution
+	TrafficDistributionPrecedenceAnnotation = "annotation"
+)
+
+type xdsConfig struct {
+	// WatchedNamespaces are the namespaces whose services and workloads are kept once received from xds, all if empty
+	WatchedNamespaces []string
+	// OnXdsLoss is the behavior once the xds connection has been lost for XdsLossGracePeriod
+	OnXdsLoss          string
+	XdsLossGracePeriod time.Duration
+	// ReconcileStaleThreshold is how long a controller can be reconciling before the daemon is no longer ready, 0 disables it
+	ReconcileStaleThreshold time.Duration
+	// CacheMaxEntries bounds the workload and service caches, 0 leaves them unbounded
+	CacheMaxEntries int
+	// XdsCoalesceWindow is how long the address updates received in a row are coalesced, 0 disables it
+	XdsCoalesceWindow time.Duration
+	// LocalityDefault is the locality load balancing of the services with no traffic distribution of their own
+	LocalityDefault string
+	// TrafficDistributionPrecedence is which of the spec and the annotation of a service wins when both set
+	// its traffic distribution
+	TrafficDistributionPrecedence string
+	// CheckpointFile is where the state received from xds is checkpointed for the restarts, empty if disabled
+	CheckpointFile string
+	// ExcludeCIDRs are the destinations left out of the redirection and authorization, as given by the flag
+	ExcludeCIDRs []string
+	// ExcludedPrefixes are ExcludeCIDRs parsed by ParseConfig
+	ExcludedPrefixes []netip.Prefix
+}
+
+func (c *xdsConfig) AttachFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSliceVar(&c.WatchedNamespaces, "watched-namespaces", nil,
+		"comma separated namespaces whose services and workloads received from xds are kept, in addition to the workloads "+
+			"on the node. The subscription is not scoped: the daemon still receives the resources of all the namespaces, the "+
+			"others are dropped on receipt and kept neither in memory nor in the bpf maps. Empty keeps all namespaces. The "+
+			"namespaces of the waypoints in use must be included. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringVar(&c.OnXdsLoss, "on-xds-loss", XdsLossFailStatic,
+		"behavior once the xds connection has been lost for the grace period, one of: fail-static keeps the last configuration, "+
+			"fail-open stops enforcing the authorization policies, fail-closed denies the new connections. "+
+			"fail-open and fail-closed are only supported in dual-engine mode")
+	cmd.PersistentFlags().DurationVar(&c.XdsLossGracePeriod, "xds-loss-grace-period", 5*time.Minute,
+		"how long the xds connection can be lost before applying --on-xds-loss")
+	cmd.PersistentFlags().DurationVar(&c.ReconcileStaleThreshold, "reconcile-stale-threshold", 5*time.Minute,
+		"how long the service, workload or authz controller can take to reconcile the resources received before the daemon "+
+			"is reported not ready, as when it hangs. 0 disables it")
+	cmd.PersistentFlags().IntVar(&c.CacheMaxEntries, "cache-max-entries", 0,
+		"max number of workloads and of services kept in memory each, the least recently used ones no longer in xds "+
+			"are evicted beyond it, the ones still in xds never are. 0 means unbounded. Only supported in dual-engine mode")
+	cmd.PersistentFlags().DurationVar(&c.XdsCoalesceWindow, "xds-coalesce-window", 0,
+		"how long the address updates received from xds in a row are coalesced, the last update of each resource within it "+
+			"is written to the bpf maps only. Bounds the map writes during mass churn such as a node drain, at the cost of "+
+			"delaying the updates by up to the window. 0 disables it. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringVar(&c.LocalityDefault, "locality-default", LocalityDistribute,
+		"locality load balancing of the services which specify no traffic distribution, one of: PreferClose fails over "+
+			"from the closest endpoints to the farther ones, Distribute spreads the traffic over all the endpoints, "+
+			"Strict only uses the endpoints in the same locality. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringVar(&c.TrafficDistributionPrecedence, "traffic-distribution-precedence", TrafficDistributionPrecedenceSpec,
+		"which of the spec.trafficDistribution and the networking.istio.io/traffic-distribution annotation of a service "+
+			"wins when both are set, one of: spec, annotation. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringVar(&c.CheckpointFile, "checkpoint-file", "",
+		"file the services, workloads and authorization policies are checkpointed to, restored on a restart before the xds "+
+			"resync. Disabled if empty. Only supported in dual-engine mode")
+	cmd.PersistentFlags().StringSliceVar(&c.ExcludeCIDRs, "exclude-cidrs", nil,
+		"comma separated destination CIDRs the connections to go direct, neither redirected nor authorized by kmesh, "+
+			"e.g. 169.254.169.254/32 for the metadata service. Only supported in dual-engine mode")
+}
+
+func (c *xdsConfig) ParseConfig() error {
+	for _, ns := range c.WatchedNamespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) != 0 {
+			return fmt.Errorf("invalid namespace %q in --watched-namespaces: %s", ns, strings.Join(errs, ", "))
+		}
+	}
+	switch c.OnXdsLoss {
+	case XdsLossFailStatic, XdsLossFailOpen, XdsLossFailClosed:
+	default:
+		return fmt.Errorf("invalid --on-xds-loss %q, must be one of %s, %s, %s", c.OnXdsLoss, XdsLossFailStatic, XdsLossFailOpen, XdsLossFailClosed)
+	}
+	switch c.LocalityDefault {
+	case LocalityPreferClose, LocalityDistribute, LocalityStrict:
+	default:
+		return fmt.Errorf("invalid --locality-default %q, must be one of %s, %s, %s", c.LocalityDefault, LocalityPreferClose, LocalityDistribute, LocalityStrict)
+	}
+	switch c.TrafficDistributionPrecedence {
+	case TrafficDistributionPrecedenceSpec, TrafficDistributionPrecedenceAnnotation:
+	default:
+		return fmt.Errorf("invalid --traffic-distribution-precedence %q, must be one of %s, %s", c.TrafficDistributionPrecedence,
+			TrafficDistributionPrecedenceSpec, TrafficDistributionPrecedenceAnnotation)
+	}
+	if c.CacheMaxEntries < 0 {
+		return fmt.Errorf("invalid --cache-max-entries %d, must not be negative", c.CacheMaxEntries)
+	}
+	c.ExcludedPrefixes = nil
+	for _, cidr := range c.ExcludeCIDRs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return fmt.Errorf("invalid --exclude-cidrs %q: %v", cidr, err)
+		}
+		c.ExcludedPrefixes = append(c.ExcludedPrefixes, prefix.Masked())
+	}
+	if c.XdsLossGracePeriod < 0 {
+		return fmt.Errorf("invalid --xds-loss-grace-period %v, must not be negative", c.XdsLossGracePeriod)
+	}
+	if c.XdsCoalesceWindow < 0 {
+		return fmt.Errorf("invalid --xds-coalesce-window %v, must not be negative", c.XdsCoalesceWindow)
+	}
+	if c.ReconcileStaleThreshold < 0 {
+		return fmt.Errorf("invalid --reconcile-stale-threshold %v, must not be negative", c.ReconcileStaleThreshold)
+	}
+	return nil
+}
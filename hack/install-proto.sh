@@ -92,6 +92,17 @@ function install_protoc() {
 	else
 		go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.34.2
 	fi
+
+	if command -v protoc-gen-go-grpc >/dev/null; then
+		installed_version=$(protoc-gen-go-grpc --version | awk '{print $2}')
+		if [[ $installed_version == "1.5.1" ]]; then
+			echo "Installed protoc-gen-go-grpc version matches the desired version."
+		else
+			go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+		fi
+	else
+		go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+	fi
 }
 
 install_protoc
@@ -0,0 +1,76 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package adminclient is the client of the admin grpc api served by the kmesh daemon.
+package adminclient
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+// Client is a KmeshAdminClient bound to its connection.
+type Client struct {
+	adminapi.KmeshAdminClient
+	conn *grpc.ClientConn
+}
+
+// New creates a client of the admin api served at addr. The api is only served
+// on the daemon's loopback, so the connection is not encrypted.
+func New(addr string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin client for %s: %v", addr, err)
+	}
+	return &Client{
+		KmeshAdminClient: adminapi.NewKmeshAdminClient(conn),
+		conn:             conn,
+	}, nil
+}
+
+// Close closes the connection to the daemon.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ParseMode converts a mode name as used on the command line to the api mode.
+func ParseMode(mode string) (adminapi.Mode, error) {
+	switch mode {
+	case constants.KernelNativeMode:
+		return adminapi.Mode_KERNEL_NATIVE, nil
+	case constants.DualEngineMode:
+		return adminapi.Mode_DUAL_ENGINE, nil
+	}
+	return adminapi.Mode_MODE_UNSPECIFIED, fmt.Errorf("invalid mode %q, must be '%s' or '%s'",
+		mode, constants.KernelNativeMode, constants.DualEngineMode)
+}
+
+// FormatMode converts an api mode to its name as used on the command line, empty if unspecified.
+func FormatMode(mode adminapi.Mode) string {
+	switch mode {
+	case adminapi.Mode_KERNEL_NATIVE:
+		return constants.KernelNativeMode
+	case adminapi.Mode_DUAL_ENGINE:
+		return constants.DualEngineMode
+	}
+	return ""
+}
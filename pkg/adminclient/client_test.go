@@ -0,0 +1,119 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adminclient
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+type fakeAdminServer struct {
+	adminapi.UnimplementedKmeshAdminServer
+	authz bool
+}
+
+func (f *fakeAdminServer) GetAuthz(ctx context.Context, req *adminapi.GetAuthzRequest) (*adminapi.AuthzStatus, error) {
+	return &adminapi.AuthzStatus{Enabled: f.authz}, nil
+}
+
+func (f *fakeAdminServer) SetAuthz(ctx context.Context, req *adminapi.SetAuthzRequest) (*adminapi.AuthzStatus, error) {
+	f.authz = req.GetEnabled()
+	return &adminapi.AuthzStatus{Enabled: f.authz}, nil
+}
+
+func (f *fakeAdminServer) ConfigDump(ctx context.Context, req *adminapi.ConfigDumpRequest) (*adminapi.ConfigDumpResponse, error) {
+	if req.GetMode() == adminapi.Mode_KERNEL_NATIVE {
+		return nil, status.Error(codes.FailedPrecondition, "daemon runs in DUAL_ENGINE mode")
+	}
+	return &adminapi.ConfigDumpResponse{Mode: adminapi.Mode_DUAL_ENGINE, Json: "{}"}, nil
+}
+
+func newTestClient(t *testing.T) *Client {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	adminapi.RegisterKmeshAdminServer(srv, &fakeAdminServer{})
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	c, err := New("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	authz, err := c.GetAuthz(ctx, &adminapi.GetAuthzRequest{})
+	require.NoError(t, err)
+	assert.False(t, authz.GetEnabled())
+
+	authz, err = c.SetAuthz(ctx, &adminapi.SetAuthzRequest{Enabled: true})
+	require.NoError(t, err)
+	assert.True(t, authz.GetEnabled())
+
+	authz, err = c.GetAuthz(ctx, &adminapi.GetAuthzRequest{})
+	require.NoError(t, err)
+	assert.True(t, authz.GetEnabled())
+
+	dump, err := c.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_DUAL_ENGINE})
+	require.NoError(t, err)
+	assert.Equal(t, "{}", dump.GetJson())
+
+	_, err = c.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_KERNEL_NATIVE})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = c.ListLoggers(ctx, &adminapi.ListLoggersRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("kernel-native")
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.Mode_KERNEL_NATIVE, mode)
+
+	mode, err = ParseMode("dual-engine")
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.Mode_DUAL_ENGINE, mode)
+
+	_, err = ParseMode("ads")
+	assert.Error(t, err)
+}
+
+func TestFormatMode(t *testing.T) {
+	for _, name := range []string{"kernel-native", "dual-engine"} {
+		mode, err := ParseMode(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, FormatMode(mode))
+	}
+	assert.Empty(t, FormatMode(adminapi.Mode_MODE_UNSPECIFIED))
+}
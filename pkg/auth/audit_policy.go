@@ -0,0 +1,75 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"slices"
+	"strings"
+
+	"istio.io/api/security/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+// AuditPolicies converts the AUDIT AuthorizationPolicies applying to the pod, which istiod does not push to
+// kmesh, into the policies evaluated on the connections to its workload. They are converted as the DENY
+// policies they would be, sorted by namespace/name. The policies with targetRefs apply to waypoints and
+// gateways and are left out, as are the rules with HTTP fields, which can not be evaluated on a connection.
+func AuditPolicies(pod *corev1.Pod, policies []*securityclient.AuthorizationPolicy, rootNamespace string) []*security.Authorization {
+	var out []*security.Authorization
+	for _, ap := range policies {
+		spec := &ap.Spec
+		if spec.GetAction() != v1beta1.AuthorizationPolicy_AUDIT ||
+			spec.GetTargetRef() != nil || len(spec.GetTargetRefs()) > 0 {
+			continue
+		}
+		if ap.Namespace != pod.Namespace && ap.Namespace != rootNamespace {
+			continue
+		}
+		scope := security.Scope_WORKLOAD_SELECTOR
+		if spec.GetSelector() == nil {
+			scope = security.Scope_NAMESPACE
+			if ap.Namespace == rootNamespace {
+				scope = security.Scope_GLOBAL
+			}
+		} else if !labels.SelectorFromSet(spec.GetSelector().GetMatchLabels()).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		policy := &security.Authorization{
+			Name:      ap.Name,
+			Namespace: ap.Namespace,
+			Scope:     scope,
+			Action:    security.Action_DENY,
+		}
+		for _, rule := range spec.GetRules() {
+			clauses, httpFields := ConvertRule(rule)
+			if len(httpFields) > 0 {
+				continue
+			}
+			policy.Rules = append(policy.Rules, &security.Rule{Clauses: clauses})
+		}
+		out = append(out, policy)
+	}
+	slices.SortFunc(out, func(a, b *security.Authorization) int {
+		return strings.Compare(a.ResourceName(), b.ResourceName())
+	})
+	return out
+}
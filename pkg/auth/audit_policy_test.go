@@ -0,0 +1,74 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/security/v1beta1"
+	istiotype "istio.io/api/type/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+func TestAuditPolicies(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "httpbin", Labels: map[string]string{"app": "httpbin"}}}
+	policy := func(namespace, name string, action v1beta1.AuthorizationPolicy_Action, selector map[string]string) *securityclient.AuthorizationPolicy {
+		ap := &securityclient.AuthorizationPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+		ap.Spec.Action = action
+		if selector != nil {
+			ap.Spec.Selector = &istiotype.WorkloadSelector{MatchLabels: selector}
+		}
+		ap.Spec.Rules = []*v1beta1.Rule{
+			{To: []*v1beta1.Rule_To{{Operation: &v1beta1.Operation{Ports: []string{"8080"}}}}},
+			// an HTTP field can not be evaluated on a connection
+			{To: []*v1beta1.Rule_To{{Operation: &v1beta1.Operation{Paths: []string{"/admin"}}}}},
+		}
+		return ap
+	}
+	targetRef := policy("default", "audit-waypoint", v1beta1.AuthorizationPolicy_AUDIT, nil)
+	targetRef.Spec.TargetRefs = []*istiotype.PolicyTargetReference{{Kind: "Service", Name: "httpbin"}}
+
+	policies := AuditPolicies(pod, []*securityclient.AuthorizationPolicy{
+		policy("default", "audit-selector", v1beta1.AuthorizationPolicy_AUDIT, map[string]string{"app": "httpbin"}),
+		policy("default", "audit-namespace", v1beta1.AuthorizationPolicy_AUDIT, nil),
+		policy("istio-system", "audit-mesh", v1beta1.AuthorizationPolicy_AUDIT, nil),
+		// not applying to the pod
+		policy("default", "audit-other", v1beta1.AuthorizationPolicy_AUDIT, map[string]string{"app": "sleep"}),
+		policy("other", "audit-namespace", v1beta1.AuthorizationPolicy_AUDIT, nil),
+		targetRef,
+		// pushed by istiod
+		policy("default", "deny", v1beta1.AuthorizationPolicy_DENY, nil),
+	}, "istio-system")
+
+	var keys []string
+	for _, p := range policies {
+		keys = append(keys, p.ResourceName())
+		assert.Equal(t, security.Action_DENY, p.GetAction())
+		assert.Equal(t, []*security.Rule{{Clauses: []*security.Clause{{
+			Matches: []*security.Match{{DestinationPorts: []uint32{8080}}},
+		}}}}, p.GetRules())
+	}
+	assert.Equal(t, []string{"default/audit-namespace", "default/audit-selector", "istio-system/audit-mesh"}, keys)
+	assert.Equal(t, security.Scope_NAMESPACE, policies[0].GetScope())
+	assert.Equal(t, security.Scope_WORKLOAD_SELECTOR, policies[1].GetScope())
+	assert.Equal(t, security.Scope_GLOBAL, policies[2].GetScope())
+}
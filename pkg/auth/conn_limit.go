@@ -0,0 +1,309 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+// defaultQueueTimeout is how long a connection stays queued before it is reset, as the default connectTimeout
+// of a DestinationRule
+const defaultQueueTimeout = 10 * time.Second
+
+// ConnectionLimit limits the concurrent connections to the workloads of a service on the node, like the
+// connectionPool.tcp.maxConnections of a DestinationRule. Unlike it, the limit is counted on each node
+// separately, and it applies to the connections the workload has already accepted: the daemon learns of
+// a connection once its handshake is complete, so a queued connection is established and only its packets
+// are held, the workload is not protected from the connections themselves. A connection queued for longer
+// than the queue timeout is reset.
+//
+// Holding a burst back from the backend is out of reach in this userspace path: it would have to be done
+// before the connect is redirected, where a connection can only be refused, not held. MaxPending keeps
+// the connections beyond the limit from being denied at once, it does not shield the backend from them.
+type ConnectionLimit struct {
+	MaxConnections uint32
+	// MaxPending is how many connections beyond MaxConnections are queued until others close,
+	// the ones beyond the queue are denied
+	MaxPending uint32
+}
+
+type admission int
+
+const (
+	admitted admission = iota
+	queued
+	rejected
+)
+
+// limitedConn is a connection counted in the limit of its service
+type limitedConn struct {
+	id      uint64
+	service string
+	// msgType and tuple are the key of the connection in authRes, where it is held while queued
+	msgType uint32
+	tuple   []byte
+	authRes *ebpf.Map
+	queued  bool
+	// conn is the connection as authorized, to report its verdict if it times out in the queue
+	conn *rbacConnection
+	// timer resets the connection when it stays queued for longer than the queue timeout
+	timer *time.Timer
+}
+
+type serviceConns struct {
+	limit  ConnectionLimit
+	active uint32
+	// queue holds the queued connections in their order of arrival
+	queue []*limitedConn
+}
+
+// connLimiter counts the connections to the services with a ConnectionLimit, by the id the data plane
+// assigned to them, the data plane tells it when they close
+type connLimiter struct {
+	mutex        sync.Mutex
+	services     map[string]*serviceConns
+	conns        map[uint64]*limitedConn
+	queueTimeout time.Duration
+}
+
+func newConnLimiter() *connLimiter {
+	return &connLimiter{
+		services:     make(map[string]*serviceConns),
+		conns:        make(map[uint64]*limitedConn),
+		queueTimeout: defaultQueueTimeout,
+	}
+}
+
+func (l *connLimiter) hasLimit(service string) bool {
+	_, ok := l.services[service]
+	return ok
+}
+
+// setLimit sets the limit of the service, nil removes it. The queued connections the new limit leaves room
+// for are dequeued, all of them if it is removed, and returned.
+func (l *connLimiter) setLimit(service string, limit *ConnectionLimit) []*limitedConn {
+	sc, ok := l.services[service]
+	if limit == nil {
+		if !ok {
+			return nil
+		}
+		delete(l.services, service)
+		for id, conn := range l.conns {
+			if conn.service == service {
+				delete(l.conns, id)
+			}
+		}
+		return sc.queue
+	}
+	if !ok {
+		l.services[service] = &serviceConns{limit: *limit}
+		return nil
+	}
+	sc.limit = *limit
+	return sc.dequeue()
+}
+
+// admit counts the connection in the limit of its service. It is admitted while less than MaxConnections
+// are active, queued while less than MaxPending are queued, and rejected beyond.
+func (l *connLimiter) admit(conn *limitedConn) admission {
+	sc, ok := l.services[conn.service]
+	if !ok {
+		return admitted
+	}
+	switch {
+	case sc.active < sc.limit.MaxConnections:
+		sc.active++
+	case uint32(len(sc.queue)) < sc.limit.MaxPending:
+		conn.queued = true
+		sc.queue = append(sc.queue, conn)
+	default:
+		return rejected
+	}
+	l.conns[conn.id] = conn
+	if conn.queued {
+		return queued
+	}
+	return admitted
+}
+
+// closed stops counting the connection, the connections dequeued in its place are returned
+func (l *connLimiter) closed(id uint64) []*limitedConn {
+	conn, ok := l.conns[id]
+	if !ok {
+		return nil
+	}
+	delete(l.conns, id)
+	sc, ok := l.services[conn.service]
+	if !ok {
+		return nil
+	}
+	if conn.queued {
+		conn.timer.Stop()
+		sc.queue = slices.DeleteFunc(sc.queue, func(c *limitedConn) bool { return c == conn })
+		return nil
+	}
+	sc.active--
+	return sc.dequeue()
+}
+
+// timedOut removes the connection from the queue of its service, it returns false if it is no longer queued
+func (l *connLimiter) timedOut(conn *limitedConn) bool {
+	if !conn.queued || l.conns[conn.id] != conn {
+		return false
+	}
+	delete(l.conns, conn.id)
+	if sc, ok := l.services[conn.service]; ok {
+		sc.queue = slices.DeleteFunc(sc.queue, func(c *limitedConn) bool { return c == conn })
+	}
+	return true
+}
+
+func (sc *serviceConns) dequeue() []*limitedConn {
+	var dequeued []*limitedConn
+	for len(sc.queue) > 0 && sc.active < sc.limit.MaxConnections {
+		conn := sc.queue[0]
+		sc.queue = sc.queue[1:]
+		conn.queued = false
+		sc.active++
+		dequeued = append(dequeued, conn)
+	}
+	return dequeued
+}
+
+// SetConnectionLimit sets the limit of the concurrent connections to the workloads of the service on the node,
+// nil removes it. The connections established before the limit is set are not counted in it.
+func (r *Rbac) SetConnectionLimit(serviceKey string, limit *ConnectionLimit) {
+	if r == nil || r.limiter == nil {
+		return
+	}
+	r.limiter.mutex.Lock()
+	defer r.limiter.mutex.Unlock()
+	r.dequeue(r.limiter.setLimit(serviceKey, limit))
+}
+
+// admit counts an allowed connection in the limit of the service it is to. The connection beyond the limit
+// is held in authRes until dequeued or until the queue timeout resets it, and denied if the queue of the
+// service is full.
+func (r *Rbac) admit(conn *rbacConnection, msgType uint32, tuple []byte, authRes *ebpf.Map, verdict Explanation) Explanation {
+	// the connections without id can not be told apart when they close
+	if r.limiter == nil || conn.connId == 0 {
+		return verdict
+	}
+	r.limiter.mutex.Lock()
+	defer r.limiter.mutex.Unlock()
+
+	service := r.limitedService(conn)
+	if service == "" {
+		return verdict
+	}
+	limited := &limitedConn{
+		id:      conn.connId,
+		service: service,
+		msgType: msgType,
+		tuple:   bytes.Clone(tuple),
+		authRes: authRes,
+		conn:    conn,
+	}
+	switch r.limiter.admit(limited) {
+	case queued:
+		log.Debugf("connection %016x to service %s is queued", conn.connId, service)
+		if err := r.queueFunc(authRes, msgType, bytes.Clone(tuple), true); err != nil {
+			log.Errorf("failed to queue connection %016x: %v", conn.connId, err)
+		}
+		limited.timer = time.AfterFunc(r.limiter.queueTimeout, func() { r.queueTimedOut(limited) })
+	case rejected:
+		verdict.Allowed = false
+		verdict.Policy = nil
+		verdict.Rule = -1
+		verdict.Reason = fmt.Sprintf("connection queue of service %s is full", service)
+	}
+	return verdict
+}
+
+// connectionClosed stops counting the connection in the limit of its service
+func (r *Rbac) connectionClosed(connId uint64) {
+	if r.limiter == nil {
+		return
+	}
+	r.limiter.mutex.Lock()
+	defer r.limiter.mutex.Unlock()
+	r.dequeue(r.limiter.closed(connId))
+}
+
+// queueTimedOut resets the connection if it is still queued
+func (r *Rbac) queueTimedOut(conn *limitedConn) {
+	r.limiter.mutex.Lock()
+	defer r.limiter.mutex.Unlock()
+	if !r.limiter.timedOut(conn) {
+		return
+	}
+	log.Debugf("connection %016x to service %s timed out in the queue", conn.id, conn.service)
+	if err := r.notifyFunc(conn.authRes, conn.msgType, conn.tuple); err != nil {
+		log.Errorf("failed to reset connection %016x: %v", conn.id, err)
+	}
+	r.reportVerdict(conn.conn, Explanation{
+		Rule:   -1,
+		Reason: fmt.Sprintf("connection timed out in the queue of service %s", conn.service),
+	})
+	r.reportDenied(conn.conn)
+}
+
+// dequeue releases the packets of the connections held while they were queued
+func (r *Rbac) dequeue(conns []*limitedConn) {
+	for _, conn := range conns {
+		conn.timer.Stop()
+		log.Debugf("connection %016x to service %s is dequeued", conn.id, conn.service)
+		if err := r.queueFunc(conn.authRes, conn.msgType, conn.tuple, false); err != nil {
+			log.Errorf("failed to dequeue connection %016x: %v", conn.id, err)
+		}
+	}
+}
+
+// limitedService returns the service with a connection limit the connection is to, empty if none
+func (r *Rbac) limitedService(conn *rbacConnection) string {
+	if len(r.limiter.services) == 0 {
+		return ""
+	}
+	dstIp, _ := netip.AddrFromSlice(conn.dstIp)
+	dstWorkload := r.workloadCache.GetWorkloadByAddr(cache.NetworkAddress{Network: conn.dstNetwork, Address: dstIp.Unmap()})
+	if dstWorkload == nil {
+		return ""
+	}
+	var service string
+	for svcName, ports := range dstWorkload.GetServices() {
+		if !r.limiter.hasLimit(svcName) || (service != "" && service < svcName) {
+			continue
+		}
+		for _, port := range ports.GetPorts() {
+			if port.GetTargetPort() == conn.dstPort {
+				// the first in order if the port is the one of several services
+				service = svcName
+				break
+			}
+		}
+	}
+	return service
+}
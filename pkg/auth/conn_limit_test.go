@@ -0,0 +1,191 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+// genAuthReqV4 builds the auth request of the connection from 10.0.0.9:srcPort to 10.244.0.1:8080
+func genAuthReqV4(msgType uint32, srcPort uint16, connId uint64) []byte {
+	sample := make([]byte, MSG_LEN)
+	binary.LittleEndian.PutUint32(sample, msgType)
+	tuple := sample[4:]
+	copy(tuple, []byte{10, 0, 0, 9, 10, 244, 0, 1})
+	binary.BigEndian.PutUint16(tuple[8:], srcPort)
+	binary.BigEndian.PutUint16(tuple[10:], 8080)
+	binary.LittleEndian.PutUint64(sample[MSG_LEN-CONN_ID_LEN:], connId)
+	return sample
+}
+
+func TestConnectionLimit(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Name:      "server",
+		Namespace: "default",
+		Uid:       "server-uid",
+		Addresses: [][]byte{netip.MustParseAddr("10.244.0.1").AsSlice()},
+		Services: map[string]*workloadapi.PortList{
+			"default/svc1.default.svc.cluster.local": {Ports: []*workloadapi.Port{{ServicePort: 80, TargetPort: 8080}}},
+		},
+	})
+	r := NewRbac(workloadCache)
+
+	// the source port of the connections whose packets are held, and of the ones denied
+	held := map[uint16]bool{}
+	var denied []uint16
+	r.queueFunc = func(_ *ebpf.Map, msgType uint32, key []byte, queued bool) error {
+		assert.Equal(t, constants.MSG_TYPE_IPV4, msgType)
+		held[binary.BigEndian.Uint16(key[8:])] = queued
+		return nil
+	}
+	r.notifyFunc = func(_ *ebpf.Map, _ uint32, key []byte) error {
+		denied = append(denied, binary.BigEndian.Uint16(key[8:]))
+		return nil
+	}
+	reasons := map[uint64]string{}
+	r.VerdictFunc = func(connId uint64, _, _ netip.AddrPort, allowed bool, reason string) {
+		if !allowed {
+			reasons[connId] = reason
+		}
+	}
+	connect := func(id uint64) {
+		r.handleAuthReq(genAuthReqV4(constants.MSG_TYPE_IPV4, uint16(40000+id), id), nil)
+	}
+	closeConn := func(id uint64) {
+		r.handleAuthReq(genAuthReqV4(constants.MSG_TYPE_CONN_CLOSED, 0, id), nil)
+	}
+
+	// without a limit the burst is admitted
+	for id := uint64(1); id <= 5; id++ {
+		connect(id)
+	}
+	for id := uint64(1); id <= 5; id++ {
+		closeConn(id)
+	}
+	assert.Empty(t, held)
+	assert.Empty(t, denied)
+
+	r.SetConnectionLimit("default/svc1.default.svc.cluster.local", &ConnectionLimit{MaxConnections: 2, MaxPending: 2})
+	for id := uint64(11); id <= 15; id++ {
+		connect(id)
+	}
+	// 2 connections admitted, the next 2 queued and the last one beyond the queue denied
+	assert.Equal(t, map[uint16]bool{40013: true, 40014: true}, held)
+	assert.Equal(t, []uint16{40015}, denied)
+	assert.Equal(t, map[uint64]string{15: "connection queue of service default/svc1.default.svc.cluster.local is full"}, reasons)
+
+	// the first queued connection takes the place of the one closing
+	closeConn(11)
+	assert.Equal(t, map[uint16]bool{40013: false, 40014: true}, held)
+	// a queued connection closing leaves the queue
+	closeConn(14)
+	closeConn(12)
+	assert.Equal(t, map[uint16]bool{40013: false, 40014: true}, held)
+	// the denied connection was never counted
+	closeConn(15)
+
+	// 13 is active, there is room for another one before the queue
+	connect(16)
+	connect(17)
+	connect(18)
+	assert.Equal(t, map[uint16]bool{40013: false, 40014: true, 40017: true, 40018: true}, held)
+	assert.Equal(t, []uint16{40015}, denied)
+
+	// raising the limit dequeues the connections it leaves room for
+	r.SetConnectionLimit("default/svc1.default.svc.cluster.local", &ConnectionLimit{MaxConnections: 3, MaxPending: 2})
+	assert.Equal(t, map[uint16]bool{40013: false, 40014: true, 40017: false, 40018: true}, held)
+	// removing it dequeues all of them, and the next connections are admitted
+	r.SetConnectionLimit("default/svc1.default.svc.cluster.local", nil)
+	assert.Equal(t, map[uint16]bool{40013: false, 40014: true, 40017: false, 40018: false}, held)
+	connect(19)
+	connect(20)
+	assert.Equal(t, []uint16{40015}, denied)
+	assert.Empty(t, r.limiter.conns)
+}
+
+func TestConnectionLimitQueueTimeout(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Name:      "server",
+		Namespace: "default",
+		Uid:       "server-uid",
+		Addresses: [][]byte{netip.MustParseAddr("10.244.0.1").AsSlice()},
+		Services: map[string]*workloadapi.PortList{
+			"default/svc1.default.svc.cluster.local": {Ports: []*workloadapi.Port{{ServicePort: 80, TargetPort: 8080}}},
+		},
+	})
+	r := NewRbac(workloadCache)
+	r.limiter.queueTimeout = 10 * time.Millisecond
+
+	// the source port of the connections whose packets are held, and of the ones reset
+	held := map[uint16]bool{}
+	reset := make(chan uint16, 4)
+	r.queueFunc = func(_ *ebpf.Map, _ uint32, key []byte, queued bool) error {
+		held[binary.BigEndian.Uint16(key[8:])] = queued
+		return nil
+	}
+	r.notifyFunc = func(_ *ebpf.Map, _ uint32, key []byte) error {
+		reset <- binary.BigEndian.Uint16(key[8:])
+		return nil
+	}
+	reasons := make(chan string, 4)
+	r.VerdictFunc = func(_ uint64, _, _ netip.AddrPort, allowed bool, reason string) {
+		if !allowed {
+			reasons <- reason
+		}
+	}
+	connect := func(id uint64) {
+		r.handleAuthReq(genAuthReqV4(constants.MSG_TYPE_IPV4, uint16(40000+id), id), nil)
+	}
+	closeConn := func(id uint64) {
+		r.handleAuthReq(genAuthReqV4(constants.MSG_TYPE_CONN_CLOSED, 0, id), nil)
+	}
+
+	r.SetConnectionLimit("default/svc1.default.svc.cluster.local", &ConnectionLimit{MaxConnections: 1, MaxPending: 1})
+	connect(1)
+	connect(2)
+	// the queued connection is reset once the timeout expires
+	select {
+	case port := <-reset:
+		assert.Equal(t, uint16(40002), port)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the queued connection was not reset")
+	}
+	assert.Equal(t, "connection timed out in the queue of service default/svc1.default.svc.cluster.local", <-reasons)
+
+	r.limiter.mutex.Lock()
+	assert.Empty(t, r.limiter.services["default/svc1.default.svc.cluster.local"].queue)
+	r.limiter.mutex.Unlock()
+	// the reset connection leaves room in the queue, and is not dequeued when the active one closes
+	connect(3)
+	closeConn(1)
+	assert.Equal(t, map[uint16]bool{40002: true, 40003: false}, held)
+	// the dequeued connection is not reset
+	time.Sleep(5 * r.limiter.queueTimeout)
+	assert.Empty(t, reset)
+}
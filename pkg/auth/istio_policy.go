@@ -0,0 +1,179 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"istio.io/api/security/v1beta1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+// l4Conditions are the keys of the conditions evaluated on the connections
+var l4Conditions = []string{"source.ip", "source.namespace", "source.principal", "destination.ip", "destination.port"}
+
+// ConvertRule converts the to, from and when of a rule of an istio AuthorizationPolicy to clauses, all of them
+// must match, the same way istiod does for ztunnel. It also returns the HTTP fields of the rule, which can not
+// be evaluated on the connections.
+func ConvertRule(rule *v1beta1.Rule) ([]*security.Clause, []string) {
+	var clauses []*security.Clause
+	var httpFields []string
+
+	var toMatches []*security.Match
+	for _, to := range rule.GetTo() {
+		op := to.GetOperation()
+		httpFields = append(httpFields, httpOperationFields(op)...)
+		toMatches = append(toMatches, &security.Match{
+			DestinationPorts:    toPorts(op.GetPorts()),
+			NotDestinationPorts: toPorts(op.GetNotPorts()),
+		})
+	}
+	if len(toMatches) > 0 {
+		clauses = append(clauses, &security.Clause{Matches: toMatches})
+	}
+
+	var fromMatches []*security.Match
+	for _, from := range rule.GetFrom() {
+		source := from.GetSource()
+		httpFields = append(httpFields, httpSourceFields(source)...)
+		fromMatches = append(fromMatches, &security.Match{
+			Namespaces:    toStringMatches(source.GetNamespaces()),
+			NotNamespaces: toStringMatches(source.GetNotNamespaces()),
+			Principals:    toStringMatches(source.GetPrincipals()),
+			NotPrincipals: toStringMatches(source.GetNotPrincipals()),
+			SourceIps:     toAddresses(source.GetIpBlocks()),
+			NotSourceIps:  toAddresses(source.GetNotIpBlocks()),
+		})
+	}
+	if len(fromMatches) > 0 {
+		clauses = append(clauses, &security.Clause{Matches: fromMatches})
+	}
+
+	for _, when := range rule.GetWhen() {
+		if !slices.Contains(l4Conditions, when.GetKey()) {
+			httpFields = append(httpFields, when.GetKey())
+			continue
+		}
+		match := &security.Match{}
+		values, notValues := when.GetValues(), when.GetNotValues()
+		switch when.GetKey() {
+		case "source.ip":
+			match.SourceIps, match.NotSourceIps = toAddresses(values), toAddresses(notValues)
+		case "source.namespace":
+			match.Namespaces, match.NotNamespaces = toStringMatches(values), toStringMatches(notValues)
+		case "source.principal":
+			match.Principals, match.NotPrincipals = toStringMatches(values), toStringMatches(notValues)
+		case "destination.ip":
+			match.DestinationIps, match.NotDestinationIps = toAddresses(values), toAddresses(notValues)
+		case "destination.port":
+			match.DestinationPorts, match.NotDestinationPorts = toPorts(values), toPorts(notValues)
+		}
+		clauses = append(clauses, &security.Clause{Matches: []*security.Match{match}})
+	}
+	return clauses, httpFields
+}
+
+func httpOperationFields(op *v1beta1.Operation) []string {
+	var fields []string
+	for field, values := range map[string][]string{
+		"hosts": op.GetHosts(), "notHosts": op.GetNotHosts(),
+		"methods": op.GetMethods(), "notMethods": op.GetNotMethods(),
+		"paths": op.GetPaths(), "notPaths": op.GetNotPaths(),
+	} {
+		if len(values) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+func httpSourceFields(source *v1beta1.Source) []string {
+	var fields []string
+	for field, values := range map[string][]string{
+		"remoteIpBlocks": source.GetRemoteIpBlocks(), "notRemoteIpBlocks": source.GetNotRemoteIpBlocks(),
+		"requestPrincipals": source.GetRequestPrincipals(), "notRequestPrincipals": source.GetNotRequestPrincipals(),
+	} {
+		if len(values) > 0 {
+			fields = append(fields, field)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// toStringMatches converts the istio string values, a leading or trailing * makes a suffix or a prefix match
+func toStringMatches(values []string) []*security.StringMatch {
+	var matches []*security.StringMatch
+	for _, v := range values {
+		switch {
+		case v == "*":
+			// istiod sends a presence match the kmesh api lacks, kmesh receives it as an empty match
+			matches = append(matches, &security.StringMatch{})
+		case strings.HasPrefix(v, "*"):
+			matches = append(matches, &security.StringMatch{MatchType: &security.StringMatch_Suffix{Suffix: v[1:]}})
+		case strings.HasSuffix(v, "*"):
+			matches = append(matches, &security.StringMatch{MatchType: &security.StringMatch_Prefix{Prefix: v[:len(v)-1]}})
+		default:
+			matches = append(matches, &security.StringMatch{MatchType: &security.StringMatch_Exact{Exact: v}})
+		}
+	}
+	return matches
+}
+
+// toPorts converts the ports, the invalid ones are skipped like istiod does
+func toPorts(values []string) []uint32 {
+	var ports []uint32
+	for _, v := range values {
+		p, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			continue
+		}
+		ports = append(ports, uint32(p))
+	}
+	return ports
+}
+
+// toAddresses converts ips and CIDRs, the invalid ones are skipped like istiod does
+func toAddresses(values []string) []*security.Address {
+	var addresses []*security.Address
+	for _, v := range values {
+		var prefix netip.Prefix
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				continue
+			}
+			prefix = p
+		} else {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		addresses = append(addresses, &security.Address{
+			Address: prefix.Addr().AsSlice(),
+			Length:  uint32(prefix.Bits()),
+		})
+	}
+	return addresses
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"fmt"
+	"strings"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+// mtlsDenyNonMeshPolicyName prefixes the names of the policies programmed for the services in DENY_NON_MESH mode
+const mtlsDenyNonMeshPolicyName = "kmesh-mtls-deny-non-mesh."
+
+// MtlsMode is the mode of the kmesh.net/mtls annotation of a service. Kmesh does not see whether a connection
+// was carried over HBONE mTLS, so unlike a PeerAuthentication it can not require it, and there is no STRICT mode.
+type MtlsMode string
+
+const (
+	// MtlsDenyNonMesh denies the connections to the workloads of the service from the sources which are not
+	// workloads of the mesh. A source is a workload of the mesh when its address is the one of a workload
+	// discovered from istiod, which is not authenticated, and it is accepted whether it uses mTLS or not.
+	MtlsDenyNonMesh MtlsMode = "DENY_NON_MESH"
+	// MtlsPermissive accepts the connections from any source, it is the default
+	MtlsPermissive MtlsMode = "PERMISSIVE"
+	// MtlsDisable accepts the connections from any source, kmesh enforces it like PERMISSIVE
+	MtlsDisable MtlsMode = "DISABLE"
+	// MtlsStrict is the STRICT mode of a PeerAuthentication, which kmesh can not enforce. ParseMtlsMode
+	// rejects it, and it is never downgraded to PERMISSIVE
+	MtlsStrict MtlsMode = "STRICT"
+)
+
+// ParseMtlsMode parses the value of the kmesh.net/mtls annotation, case insensitive. STRICT returns
+// MtlsStrict with an error, the caller has to hold the service to a mode at least as strict as DENY_NON_MESH.
+func ParseMtlsMode(value string) (MtlsMode, error) {
+	switch mode := MtlsMode(strings.ToUpper(strings.TrimSpace(value))); mode {
+	case MtlsDenyNonMesh, MtlsPermissive, MtlsDisable:
+		return mode, nil
+	case MtlsStrict:
+		return mode, fmt.Errorf("%s can not be enforced, kmesh does not see whether a connection used mTLS, use %s to deny the sources outside the mesh",
+			MtlsStrict, MtlsDenyNonMesh)
+	}
+	return "", fmt.Errorf("should be %s, %s or %s", MtlsDenyNonMesh, MtlsPermissive, MtlsDisable)
+}
+
+// MtlsDenyNonMeshPolicy returns the policy denying the connections to the workloads of the service from the
+// sources which are not workloads of the mesh, the only ones without a namespace. The xdp authz can not match
+// namespaces, so the new connections to the workloads of the service are authorized in userspace.
+func MtlsDenyNonMeshPolicy(namespace, service string) *security.Authorization {
+	return &security.Authorization{
+		Name:      mtlsDenyNonMeshPolicyName + service,
+		Namespace: namespace,
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{
+			Clauses: []*security.Clause{{
+				Matches: []*security.Match{{
+					Namespaces: []*security.StringMatch{{MatchType: &security.StringMatch_Exact{Exact: ""}}},
+				}},
+			}},
+		}},
+	}
+}
+
+// IsMtlsDenyNonMeshPolicy reports whether the policy key is the one of a MtlsDenyNonMeshPolicy
+func IsMtlsDenyNonMeshPolicy(policyKey string) bool {
+	_, name, _ := strings.Cut(policyKey, "/")
+	return strings.HasPrefix(name, mtlsDenyNonMeshPolicyName)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+func TestParseMtlsMode(t *testing.T) {
+	for value, want := range map[string]MtlsMode{
+		"DENY_NON_MESH": MtlsDenyNonMesh,
+		" permissive ":  MtlsPermissive,
+		"Disable":       MtlsDisable,
+	} {
+		mode, err := ParseMtlsMode(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, mode, value)
+	}
+	for _, value := range []string{"", "UNSET"} {
+		mode, err := ParseMtlsMode(value)
+		assert.Error(t, err, value)
+		assert.Empty(t, mode, value)
+	}
+	// STRICT is rejected, but it is told apart from the invalid values
+	mode, err := ParseMtlsMode("strict")
+	assert.ErrorContains(t, err, "can not be enforced")
+	assert.Equal(t, MtlsStrict, mode)
+}
+
+func TestRbac_mtlsDenyNonMesh(t *testing.T) {
+	serviceKey := "default/httpbin.default.svc.cluster.local"
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+		Services:  map[string]*workloadapi.PortList{serviceKey: {}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:            "cluster0//Pod/other/sleep",
+		Namespace:      "other",
+		ServiceAccount: "sleep",
+		Addresses:      [][]byte{{192, 168, 122, 3}},
+	})
+	mesh := netip.MustParseAddr("192.168.122.3")
+	plaintext := netip.MustParseAddr("10.0.0.1")
+	dst := netip.MustParseAddr("192.168.122.2")
+	rbac := NewRbac(workloadCache)
+
+	// PERMISSIVE
+	assert.True(t, rbac.Explain(plaintext, dst, 80).Allowed)
+	assert.True(t, rbac.Explain(mesh, dst, 80).Allowed)
+
+	policy := MtlsDenyNonMeshPolicy("default", "httpbin")
+	assert.True(t, IsMtlsDenyNonMeshPolicy(policy.ResourceName()))
+	rbac.UpdateServicePolicy(serviceKey, policy)
+	verdict := rbac.Explain(plaintext, dst, 80)
+	assert.False(t, verdict.Allowed)
+	assert.Equal(t, policy, verdict.Policy)
+	assert.True(t, rbac.Explain(mesh, dst, 80).Allowed)
+
+	rbac.UpdateServicePolicy(serviceKey, nil)
+	assert.True(t, rbac.Explain(plaintext, dst, 80).Allowed)
+}
@@ -0,0 +1,377 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/netip"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+)
+
+const (
+	// networkPolicyName prefixes the names of the policies translated from NetworkPolicies
+	networkPolicyName = "kmesh-networkpolicy-"
+	// xdpMaxMembers is the number of addresses or ports of a match, and of matches of a clause,
+	// the xdp authz evaluates. It is MAX_MEMBER_NUM_PER_POLICY of the bpf programs.
+	xdpMaxMembers = 4
+)
+
+// NetworkPolicyIndex lists the objects the selectors of NetworkPolicies are resolved against
+type NetworkPolicyIndex interface {
+	// NetworkPolicies returns the NetworkPolicies of the namespace, of all namespaces if it is empty
+	NetworkPolicies(namespace string) []*networkingv1.NetworkPolicy
+	// Pods returns the pods of the namespace, of all namespaces if it is empty
+	Pods(namespace string) []*corev1.Pod
+	// NamespaceLabels returns the labels of the namespace, nil if it does not exist
+	NamespaceLabels(namespace string) map[string]string
+}
+
+// NetworkPolicies translates the NetworkPolicies restricting the connections to the pod into at most two
+// policies enforced at the pod: a DENY policy for the egress rules of the NetworkPolicies selecting the
+// sources of the connections, then an ALLOW policy for the ingress rules of the ones selecting the pod.
+// The peers are resolved to the addresses of their pods, so that the policies are enforced in xdp.
+// The egress of a pod is only enforced at the destinations kmesh manages.
+func NetworkPolicies(pod *corev1.Pod, index NetworkPolicyIndex) []*security.Authorization {
+	var policies []*security.Authorization
+	if rules := networkPolicyEgressRules(pod, index); len(rules) > 0 {
+		policies = append(policies, &security.Authorization{
+			Name:      networkPolicyName + "egress." + pod.Name,
+			Namespace: pod.Namespace,
+			Scope:     security.Scope_WORKLOAD_SELECTOR,
+			Action:    security.Action_DENY,
+			Rules:     rules,
+		})
+	}
+	if rules, restricted := networkPolicyIngressRules(pod, index); restricted {
+		// without any rule, the ALLOW policy denies all the connections
+		policies = append(policies, &security.Authorization{
+			Name:      networkPolicyName + "ingress." + pod.Name,
+			Namespace: pod.Namespace,
+			Scope:     security.Scope_WORKLOAD_SELECTOR,
+			Action:    security.Action_ALLOW,
+			Rules:     rules,
+		})
+	}
+	return policies
+}
+
+// IsNetworkPolicy reports whether the policy key is the one of a policy translated from NetworkPolicies
+func IsNetworkPolicy(policyKey string) bool {
+	_, name, _ := strings.Cut(policyKey, "/")
+	return strings.HasPrefix(name, networkPolicyName)
+}
+
+// networkPolicyIngressRules returns a rule for each ingress rule of the NetworkPolicies selecting the pod,
+// and whether any of them restricts its ingress at all
+func networkPolicyIngressRules(pod *corev1.Pod, index NetworkPolicyIndex) ([]*security.Rule, bool) {
+	var rules []*security.Rule
+	restricted := false
+	for _, np := range sortedNetworkPolicies(index.NetworkPolicies(pod.Namespace)) {
+		if !hasPolicyType(np, networkingv1.PolicyTypeIngress) || !selectsPod(np.Namespace, &np.Spec.PodSelector, pod) {
+			continue
+		}
+		restricted = true
+		for _, ingress := range np.Spec.Ingress {
+			rule := &security.Rule{}
+			if len(ingress.From) > 0 {
+				var matches []*security.Match
+				for _, peer := range ingress.From {
+					matches = append(matches, peerSourceMatches(np.Namespace, peer, index)...)
+				}
+				if len(matches) == 0 {
+					// no source is allowed
+					continue
+				}
+				rule.Clauses = append(rule.Clauses, &security.Clause{Matches: matches})
+			}
+			if len(ingress.Ports) > 0 {
+				ports, all := networkPolicyPorts(ingress.Ports, pod)
+				if !all {
+					if len(ports) == 0 {
+						continue
+					}
+					rule.Clauses = append(rule.Clauses, &security.Clause{Matches: portMatches(ports)})
+				}
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, restricted
+}
+
+// networkPolicyEgressRules returns a rule for each NetworkPolicy restricting the egress of other pods to
+// the pod, it matches the connections from the pods it selects to the ports none of its egress rules allows
+func networkPolicyEgressRules(pod *corev1.Pod, index NetworkPolicyIndex) []*security.Rule {
+	var rules []*security.Rule
+	for _, np := range sortedNetworkPolicies(index.NetworkPolicies("")) {
+		if !hasPolicyType(np, networkingv1.PolicyTypeEgress) {
+			continue
+		}
+		var sources []*security.Address
+		for _, src := range sortedPods(index.Pods(np.Namespace)) {
+			if (src.Namespace != pod.Namespace || src.Name != pod.Name) && selectsPod(np.Namespace, &np.Spec.PodSelector, src) {
+				sources = append(sources, podAddresses(src)...)
+			}
+		}
+		if len(sources) == 0 {
+			continue
+		}
+
+		allowed, all := []uint32{}, false
+		for _, egress := range np.Spec.Egress {
+			if len(egress.To) > 0 && !slices.ContainsFunc(egress.To, func(peer networkingv1.NetworkPolicyPeer) bool {
+				return peerContainsPod(np.Namespace, peer, pod, index)
+			}) {
+				continue
+			}
+			ports, allPorts := networkPolicyPorts(egress.Ports, pod)
+			if len(egress.Ports) == 0 || allPorts {
+				all = true
+				break
+			}
+			allowed = append(allowed, ports...)
+		}
+		if all {
+			continue
+		}
+
+		rule := &security.Rule{Clauses: []*security.Clause{{Matches: sourceMatches(sources)}}}
+		slices.Sort(allowed)
+		// the clauses are AND-ed, the allowed ports are split across them
+		for chunk := range slices.Chunk(slices.Compact(allowed), xdpMaxMembers) {
+			rule.Clauses = append(rule.Clauses, &security.Clause{Matches: []*security.Match{{NotDestinationPorts: chunk}}})
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func hasPolicyType(np *networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		// a NetworkPolicy always restricts the ingress, and the egress if it has egress rules
+		return policyType == networkingv1.PolicyTypeIngress || len(np.Spec.Egress) > 0
+	}
+	return slices.Contains(np.Spec.PolicyTypes, policyType)
+}
+
+// selectsPod reports whether the selector of the pods of namespace selects the pod
+func selectsPod(namespace string, selector *metav1.LabelSelector, pod *corev1.Pod) bool {
+	return pod.Namespace == namespace && matchesLabels(selector, pod.Labels)
+}
+
+// matchesLabels reports whether the selector selects the labels, an invalid selector selects nothing
+func matchesLabels(selector *metav1.LabelSelector, set map[string]string) bool {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		log.Warnf("invalid label selector %v of NetworkPolicy: %v", selector, err)
+		return false
+	}
+	return s.Matches(labels.Set(set))
+}
+
+// peerPods returns the pods the selectors of the peer of a NetworkPolicy of namespace select
+func peerPods(namespace string, peer networkingv1.NetworkPolicyPeer, index NetworkPolicyIndex) []*corev1.Pod {
+	var pods []*corev1.Pod
+	if peer.NamespaceSelector == nil {
+		pods = index.Pods(namespace)
+	} else {
+		pods = index.Pods("")
+	}
+	var out []*corev1.Pod
+	for _, pod := range pods {
+		if peerSelectsPod(namespace, peer, pod, index) {
+			out = append(out, pod)
+		}
+	}
+	return sortedPods(out)
+}
+
+func peerSelectsPod(namespace string, peer networkingv1.NetworkPolicyPeer, pod *corev1.Pod, index NetworkPolicyIndex) bool {
+	if peer.NamespaceSelector == nil {
+		if pod.Namespace != namespace {
+			return false
+		}
+	} else if !matchesLabels(peer.NamespaceSelector, index.NamespaceLabels(pod.Namespace)) {
+		return false
+	}
+	return peer.PodSelector == nil || matchesLabels(peer.PodSelector, pod.Labels)
+}
+
+// peerSourceMatches returns the matches of the connections from the peer of a NetworkPolicy of namespace
+func peerSourceMatches(namespace string, peer networkingv1.NetworkPolicyPeer, index NetworkPolicyIndex) []*security.Match {
+	if peer.IPBlock != nil {
+		cidr, ok := parseCIDR(peer.IPBlock.CIDR)
+		if !ok {
+			return nil
+		}
+		match := &security.Match{SourceIps: []*security.Address{cidr}}
+		for _, except := range peer.IPBlock.Except {
+			if address, ok := parseCIDR(except); ok {
+				match.NotSourceIps = append(match.NotSourceIps, address)
+			}
+		}
+		return []*security.Match{match}
+	}
+
+	var sources []*security.Address
+	for _, pod := range peerPods(namespace, peer, index) {
+		sources = append(sources, podAddresses(pod)...)
+	}
+	return sourceMatches(sources)
+}
+
+// peerContainsPod reports whether the pod is a peer of a NetworkPolicy of namespace
+func peerContainsPod(namespace string, peer networkingv1.NetworkPolicyPeer, pod *corev1.Pod, index NetworkPolicyIndex) bool {
+	if peer.IPBlock == nil {
+		return peerSelectsPod(namespace, peer, pod, index)
+	}
+	cidr, err := netip.ParsePrefix(peer.IPBlock.CIDR)
+	if err != nil {
+		return false
+	}
+	for _, address := range podIPs(pod) {
+		if cidr.Contains(address) && !slices.ContainsFunc(peer.IPBlock.Except, func(except string) bool {
+			prefix, err := netip.ParsePrefix(except)
+			return err == nil && prefix.Contains(address)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkPolicyPorts returns the TCP ports of the pod the ports of a NetworkPolicy rule select,
+// or true if they select all of them
+func networkPolicyPorts(npPorts []networkingv1.NetworkPolicyPort, pod *corev1.Pod) ([]uint32, bool) {
+	var ports []uint32
+	for _, npPort := range npPorts {
+		// kmesh only authorizes TCP connections
+		if npPort.Protocol != nil && *npPort.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if npPort.Port == nil {
+			return nil, true
+		}
+		if npPort.Port.StrVal != "" {
+			if port, ok := namedPort(pod, npPort.Port.StrVal); ok {
+				ports = append(ports, port)
+			}
+			continue
+		}
+		port := uint32(npPort.Port.IntVal)
+		end := port
+		if npPort.EndPort != nil && uint32(*npPort.EndPort) > port {
+			end = uint32(*npPort.EndPort)
+		}
+		for ; port <= end; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, false
+}
+
+func namedPort(pod *corev1.Pod, name string) (uint32, bool) {
+	for _, container := range pod.Spec.Containers {
+		for _, port := range container.Ports {
+			if port.Name == name && (port.Protocol == "" || port.Protocol == corev1.ProtocolTCP) {
+				return uint32(port.ContainerPort), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// podIPs returns the addresses of the pod, none if it is not running or shares the network of its node
+func podIPs(pod *corev1.Pod) []netip.Addr {
+	if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil
+	}
+	ips := pod.Status.PodIPs
+	if len(ips) == 0 && pod.Status.PodIP != "" {
+		ips = []corev1.PodIP{{IP: pod.Status.PodIP}}
+	}
+	var out []netip.Addr
+	for _, ip := range ips {
+		if address, err := netip.ParseAddr(ip.IP); err == nil {
+			out = append(out, address.Unmap())
+		}
+	}
+	return out
+}
+
+func podAddresses(pod *corev1.Pod) []*security.Address {
+	var out []*security.Address
+	for _, address := range podIPs(pod) {
+		out = append(out, &security.Address{Address: address.AsSlice(), Length: uint32(address.BitLen())})
+	}
+	return out
+}
+
+func parseCIDR(cidr string) (*security.Address, bool) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		log.Warnf("invalid cidr %q of NetworkPolicy: %v", cidr, err)
+		return nil, false
+	}
+	prefix = prefix.Masked()
+	return &security.Address{Address: prefix.Addr().Unmap().AsSlice(), Length: uint32(prefix.Bits())}, true
+}
+
+// sourceMatches splits the source addresses across matches, the xdp authz evaluates xdpMaxMembers addresses of each
+func sourceMatches(addresses []*security.Address) []*security.Match {
+	var matches []*security.Match
+	for chunk := range slices.Chunk(addresses, xdpMaxMembers) {
+		matches = append(matches, &security.Match{SourceIps: chunk})
+	}
+	if len(matches) > xdpMaxMembers {
+		log.Warnf("%d addresses are matched by a NetworkPolicy, the xdp authz only matches the first %d",
+			len(addresses), xdpMaxMembers*xdpMaxMembers)
+	}
+	return matches
+}
+
+func portMatches(ports []uint32) []*security.Match {
+	slices.Sort(ports)
+	var matches []*security.Match
+	for chunk := range slices.Chunk(slices.Compact(ports), xdpMaxMembers) {
+		matches = append(matches, &security.Match{DestinationPorts: chunk})
+	}
+	return matches
+}
+
+func sortedNetworkPolicies(nps []*networkingv1.NetworkPolicy) []*networkingv1.NetworkPolicy {
+	nps = slices.Clone(nps)
+	slices.SortFunc(nps, func(a, b *networkingv1.NetworkPolicy) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return nps
+}
+
+func sortedPods(pods []*corev1.Pod) []*corev1.Pod {
+	pods = slices.Clone(pods)
+	slices.SortFunc(pods, func(a, b *corev1.Pod) int {
+		return strings.Compare(a.Namespace+"/"+a.Name, b.Namespace+"/"+b.Name)
+	})
+	return pods
+}
@@ -0,0 +1,221 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auth
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+type fakeNetworkPolicyIndex struct {
+	networkPolicies []*networkingv1.NetworkPolicy
+	pods            []*corev1.Pod
+	namespaces      map[string]map[string]string
+}
+
+func (f *fakeNetworkPolicyIndex) NetworkPolicies(namespace string) []*networkingv1.NetworkPolicy {
+	var out []*networkingv1.NetworkPolicy
+	for _, np := range f.networkPolicies {
+		if namespace == "" || np.Namespace == namespace {
+			out = append(out, np)
+		}
+	}
+	return out
+}
+
+func (f *fakeNetworkPolicyIndex) Pods(namespace string) []*corev1.Pod {
+	var out []*corev1.Pod
+	for _, pod := range f.pods {
+		if namespace == "" || pod.Namespace == namespace {
+			out = append(out, pod)
+		}
+	}
+	return out
+}
+
+func (f *fakeNetworkPolicyIndex) NamespaceLabels(namespace string) map[string]string {
+	return f.namespaces[namespace]
+}
+
+func testPod(namespace, name, ip string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIPs: []corev1.PodIP{{IP: ip}}},
+	}
+}
+
+// newNetworkPolicyRbac returns a Rbac enforcing the policies translated for the pods of the index
+func newNetworkPolicyRbac(t *testing.T, index *fakeNetworkPolicyIndex) *Rbac {
+	workloadCache := cache.NewWorkloadCache()
+	rbac := &Rbac{
+		policyStore:   newPolicyStore(),
+		workloadCache: workloadCache,
+	}
+	for _, pod := range index.pods {
+		workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+			Uid:       "cluster0//Pod/" + pod.Namespace + "/" + pod.Name,
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Addresses: [][]byte{netip.MustParseAddr(pod.Status.PodIPs[0].IP).AsSlice()},
+		})
+		rbac.UpdatePodPolicies(pod.Namespace, pod.Name, NetworkPolicies(pod, index))
+	}
+	return rbac
+}
+
+func TestNetworkPolicies_ingress(t *testing.T) {
+	server := testPod("ns-a", "server", "10.244.0.1", map[string]string{"app": "server"})
+	client := testPod("ns-a", "client", "10.244.0.2", map[string]string{"app": "client"})
+	other := testPod("ns-a", "other", "10.244.0.3", map[string]string{"app": "other"})
+	remote := testPod("ns-b", "remote", "10.244.1.1", map[string]string{"app": "client"})
+	tcp := corev1.ProtocolTCP
+	httpPort := intstr.FromString("http")
+	index := &fakeNetworkPolicyIndex{
+		pods: []*corev1.Pod{server, client, other, remote},
+		namespaces: map[string]map[string]string{
+			"ns-a": {"kubernetes.io/metadata.name": "ns-a"},
+			"ns-b": {"kubernetes.io/metadata.name": "ns-b", "team": "b"},
+		},
+		networkPolicies: []*networkingv1.NetworkPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "allow-client", Namespace: "ns-a"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{
+						{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}}},
+						{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "b"}}},
+						{IPBlock: &networkingv1.IPBlock{CIDR: "192.168.0.0/16", Except: []string{"192.168.1.0/24"}}},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &httpPort}},
+				}},
+			},
+		}},
+	}
+
+	policies := NetworkPolicies(server, index)
+	require.Len(t, policies, 1)
+	assert.Equal(t, security.Action_ALLOW, policies[0].Action)
+	assert.Equal(t, "ns-a/kmesh-networkpolicy-ingress.server", policies[0].ResourceName())
+	assert.True(t, IsNetworkPolicy(policies[0].ResourceName()))
+	assert.Equal(t, []*security.Rule{{Clauses: []*security.Clause{
+		{Matches: []*security.Match{
+			{SourceIps: []*security.Address{{Address: []byte{10, 244, 0, 2}, Length: 32}}},
+			{SourceIps: []*security.Address{{Address: []byte{10, 244, 1, 1}, Length: 32}}},
+			{
+				SourceIps:    []*security.Address{{Address: []byte{192, 168, 0, 0}, Length: 16}},
+				NotSourceIps: []*security.Address{{Address: []byte{192, 168, 1, 0}, Length: 24}},
+			},
+		}},
+		{Matches: []*security.Match{{DestinationPorts: []uint32{8080}}}},
+	}}}, policies[0].Rules)
+	// the other pods are not selected
+	assert.Empty(t, NetworkPolicies(client, index))
+
+	rbac := newNetworkPolicyRbac(t, index)
+	dst := netip.MustParseAddr("10.244.0.1")
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.0.2"), dst, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.1.1"), dst, 8080).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.244.0.2"), dst, 9090).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.244.0.3"), dst, 8080).Allowed)
+	// the ip blocks allow sources kmesh does not know
+	assert.True(t, rbac.Explain(netip.MustParseAddr("192.168.0.1"), dst, 8080).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("192.168.1.1"), dst, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.0.3"), netip.MustParseAddr("10.244.0.2"), 8080).Allowed)
+}
+
+func TestNetworkPolicies_denyAll(t *testing.T) {
+	server := testPod("ns-a", "server", "10.244.0.1", nil)
+	client := testPod("ns-a", "client", "10.244.0.2", nil)
+	index := &fakeNetworkPolicyIndex{
+		pods: []*corev1.Pod{server, client},
+		networkPolicies: []*networkingv1.NetworkPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "deny-all", Namespace: "ns-a"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		}},
+	}
+
+	policies := NetworkPolicies(server, index)
+	require.Len(t, policies, 1)
+	assert.Equal(t, security.Action_ALLOW, policies[0].Action)
+	assert.Empty(t, policies[0].Rules)
+
+	rbac := newNetworkPolicyRbac(t, index)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.244.0.2"), netip.MustParseAddr("10.244.0.1"), 8080).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.244.0.1"), netip.MustParseAddr("10.244.0.2"), 8080).Allowed)
+}
+
+func TestNetworkPolicies_egress(t *testing.T) {
+	server := testPod("ns-a", "server", "10.244.0.1", map[string]string{"app": "server"})
+	database := testPod("ns-a", "database", "10.244.0.4", map[string]string{"app": "database"})
+	client := testPod("ns-b", "client", "10.244.1.1", map[string]string{"app": "client"})
+	port := intstr.FromInt32(8080)
+	index := &fakeNetworkPolicyIndex{
+		pods: []*corev1.Pod{server, database, client},
+		namespaces: map[string]map[string]string{
+			"ns-a": {"kubernetes.io/metadata.name": "ns-a"},
+			"ns-b": {"kubernetes.io/metadata.name": "ns-b"},
+		},
+		networkPolicies: []*networkingv1.NetworkPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "client-egress", Namespace: "ns-b"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{{
+					To: []networkingv1.NetworkPolicyPeer{{
+						NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ns-a"}},
+						PodSelector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+					}},
+					Ports: []networkingv1.NetworkPolicyPort{{Port: &port}},
+				}},
+			},
+		}},
+	}
+
+	policies := NetworkPolicies(server, index)
+	require.Len(t, policies, 1)
+	assert.Equal(t, security.Action_DENY, policies[0].Action)
+	assert.Equal(t, "ns-a/kmesh-networkpolicy-egress.server", policies[0].ResourceName())
+	assert.Equal(t, []*security.Rule{{Clauses: []*security.Clause{
+		{Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{10, 244, 1, 1}, Length: 32}}}}},
+		{Matches: []*security.Match{{NotDestinationPorts: []uint32{8080}}}},
+	}}}, policies[0].Rules)
+	// the ingress of the client is not restricted
+	assert.Empty(t, NetworkPolicies(client, index))
+
+	rbac := newNetworkPolicyRbac(t, index)
+	src := netip.MustParseAddr("10.244.1.1")
+	assert.True(t, rbac.Explain(src, netip.MustParseAddr("10.244.0.1"), 8080).Allowed)
+	assert.False(t, rbac.Explain(src, netip.MustParseAddr("10.244.0.1"), 9090).Allowed)
+	assert.False(t, rbac.Explain(src, netip.MustParseAddr("10.244.0.4"), 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.0.1"), netip.MustParseAddr("10.244.0.4"), 8080).Allowed)
+}
@@ -18,10 +18,12 @@ package auth
 
 import (
 	"fmt"
+	"slices"
 	"sync"
 
 	"istio.io/istio/pkg/util/sets"
 
+	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 )
 
@@ -32,6 +34,18 @@ type policyStore struct {
 	// byNamespace maintains a mapping of namespace (or "" for global) to policy names
 	byNamespace map[string]sets.Set[string]
 
+	// byPod maintains a mapping of ns/name of a pod to the policies translated from the
+	// NetworkPolicies selecting it, they are not received from xds
+	byPod map[string][]*security.Authorization
+
+	// byService maintains a mapping of ns/hostname of a service to the policy programmed for its
+	// kmesh.net/mtls annotation, it applies to the workloads of the service
+	byService map[string]*security.Authorization
+
+	// auditByPod maintains a mapping of ns/name of a pod to the AUDIT policies applying to it, istiod does
+	// not push them to kmesh
+	auditByPod map[string][]*security.Authorization
+
 	rwLock sync.RWMutex
 }
 
@@ -39,42 +53,101 @@ func newPolicyStore() *policyStore {
 	return &policyStore{
 		byKey:       make(map[string]*security.Authorization),
 		byNamespace: make(map[string]sets.Set[string]),
+		byPod:       make(map[string][]*security.Authorization),
+		byService:   make(map[string]*security.Authorization),
+		auditByPod:  make(map[string][]*security.Authorization),
 	}
 }
 
+// updatePolicy replaces the policy with the same key as authPolicy under a single lock,
+// the connections authorized meanwhile see either the old policy or the new one
 func (ps *policyStore) updatePolicy(authPolicy *security.Authorization) error {
 	if authPolicy == nil {
 		return nil
 	}
+	if _, _, err := policyNamespace(authPolicy); err != nil {
+		return err
+	}
+
+	ps.rwLock.Lock()
+	defer ps.rwLock.Unlock()
+	ps.storePolicy(authPolicy)
+	return nil
+}
+
+// storePolicy replaces the policy with the same key as the valid authPolicy, the lock is held
+func (ps *policyStore) storePolicy(authPolicy *security.Authorization) {
 	key := authPolicy.ResourceName()
+	ns, namespaced, _ := policyNamespace(authPolicy)
+	// an edit may move the policy to another scope
+	if old, ok := ps.byKey[key]; ok {
+		if oldNs, oldNamespaced, _ := policyNamespace(old); oldNamespaced && (!namespaced || oldNs != ns) {
+			ps.deleteFromNamespace(oldNs, key)
+		}
+	}
+	if namespaced {
+		if s, ok := ps.byNamespace[ns]; !ok {
+			ps.byNamespace[ns] = sets.New(key)
+		} else {
+			s.Insert(key)
+		}
+	}
+	ps.byKey[key] = authPolicy
+}
+
+// updatePolicies replaces the updated policies and removes the removed ones under a single lock, the
+// connections authorized meanwhile see either all the old policies or all the new ones. Nothing is
+// changed if any of the updated policies is invalid.
+func (ps *policyStore) updatePolicies(updated []*security.Authorization, removed []string) error {
+	for _, authPolicy := range updated {
+		if _, _, err := policyNamespace(authPolicy); err != nil {
+			return err
+		}
+	}
+
 	ps.rwLock.Lock()
 	defer ps.rwLock.Unlock()
-	var ns string
+	for _, authPolicy := range updated {
+		ps.storePolicy(authPolicy)
+	}
+	for _, policyKey := range removed {
+		ps.deletePolicy(policyKey)
+	}
+	return nil
+}
+
+// policyNamespace returns the namespace the policy applies to, "" for a global one,
+// and false if it applies to the workloads it selects instead
+func policyNamespace(authPolicy *security.Authorization) (string, bool, error) {
 	switch authPolicy.GetScope() {
 	case security.Scope_WORKLOAD_SELECTOR:
-		ps.byKey[key] = authPolicy
-		return nil
+		return "", false, nil
 	case security.Scope_GLOBAL:
-		ns = ""
+		return "", true, nil
 	case security.Scope_NAMESPACE:
-		ns = authPolicy.GetNamespace()
+		return authPolicy.GetNamespace(), true, nil
 	default:
-		return fmt.Errorf("invalid scope %v of authorization policy", authPolicy.GetScope())
+		return "", false, fmt.Errorf("invalid scope %v of authorization policy", authPolicy.GetScope())
 	}
+}
 
-	if s, ok := ps.byNamespace[ns]; !ok {
-		ps.byNamespace[ns] = sets.New(key)
-	} else {
-		s.Insert(key)
+func (ps *policyStore) deleteFromNamespace(ns, policyKey string) {
+	if s, ok := ps.byNamespace[ns]; ok {
+		s.Delete(policyKey)
+		if s.IsEmpty() {
+			delete(ps.byNamespace, ns)
+		}
 	}
-	ps.byKey[key] = authPolicy
-	return nil
 }
 
 func (ps *policyStore) removePolicy(policyKey string) {
 	ps.rwLock.Lock()
 	defer ps.rwLock.Unlock()
+	ps.deletePolicy(policyKey)
+}
 
+// deletePolicy removes the policy with the key, the lock is held
+func (ps *policyStore) deletePolicy(policyKey string) {
 	authPolicy, ok := ps.byKey[policyKey]
 	if !ok {
 		log.Warnf("Auth policy key %s does not exist in byKey", policyKey)
@@ -83,22 +156,9 @@ func (ps *policyStore) removePolicy(policyKey string) {
 	// remove authPolicy from byKey
 	delete(ps.byKey, policyKey)
 
-	var ns string
-	switch authPolicy.Scope {
-	case security.Scope_GLOBAL:
-		ns = ""
-	case security.Scope_NAMESPACE:
-		ns = authPolicy.GetNamespace()
-	default:
-		return
-	}
-
 	// remove authPolicy key from byNamespace
-	if s, ok := ps.byNamespace[ns]; ok {
-		s.Delete(policyKey)
-		if s.IsEmpty() {
-			delete(ps.byNamespace, ns)
-		}
+	if ns, namespaced, _ := policyNamespace(authPolicy); namespaced {
+		ps.deleteFromNamespace(ns, policyKey)
 	}
 }
 
@@ -125,6 +185,75 @@ func (ps *policyStore) getByNamespace(namespace string) []string {
 	return nil
 }
 
+// updatePodPolicies replaces the policies translated from the NetworkPolicies selecting the pod
+func (ps *policyStore) updatePodPolicies(namespace, name string, policies []*security.Authorization) {
+	ps.rwLock.Lock()
+	defer ps.rwLock.Unlock()
+
+	if len(policies) == 0 {
+		delete(ps.byPod, namespace+"/"+name)
+		return
+	}
+	ps.byPod[namespace+"/"+name] = policies
+}
+
+// updatePodAuditPolicies replaces the AUDIT policies applying to the pod
+func (ps *policyStore) updatePodAuditPolicies(namespace, name string, policies []*security.Authorization) {
+	ps.rwLock.Lock()
+	defer ps.rwLock.Unlock()
+
+	if len(policies) == 0 {
+		delete(ps.auditByPod, namespace+"/"+name)
+		return
+	}
+	ps.auditByPod[namespace+"/"+name] = policies
+}
+
+// getAuditForWorkload returns the AUDIT policies applying to the pod of the workload
+func (ps *policyStore) getAuditForWorkload(workload *workloadapi.Workload) []*security.Authorization {
+	ps.rwLock.RLock()
+	defer ps.rwLock.RUnlock()
+
+	return ps.auditByPod[workload.GetNamespace()+"/"+workload.GetName()]
+}
+
+// updateServicePolicy replaces the policy of the kmesh.net/mtls annotation of the service, nil removes it
+func (ps *policyStore) updateServicePolicy(serviceKey string, policy *security.Authorization) {
+	ps.rwLock.Lock()
+	defer ps.rwLock.Unlock()
+
+	if policy == nil {
+		delete(ps.byService, serviceKey)
+		return
+	}
+	ps.byService[serviceKey] = policy
+}
+
+// getForWorkload returns the policies the workload lists followed by the ones of its namespace, the
+// global ones, the ones of its pod and the ones of its services. They are read under a single lock, so that a policy being
+// replaced is seen either old or new.
+func (ps *policyStore) getForWorkload(workload *workloadapi.Workload) []*security.Authorization {
+	ps.rwLock.RLock()
+	defer ps.rwLock.RUnlock()
+
+	policyNames := slices.Clone(workload.GetAuthorizationPolicies())
+	policyNames = append(policyNames, ps.byNamespace[workload.GetNamespace()].UnsortedList()...)
+	policyNames = append(policyNames, ps.byNamespace[""].UnsortedList()...)
+	out := make([]*security.Authorization, 0, len(policyNames))
+	for _, policyName := range policyNames {
+		if policy, ok := ps.byKey[policyName]; ok {
+			out = append(out, policy)
+		}
+	}
+	out = append(out, ps.byPod[workload.GetNamespace()+"/"+workload.GetName()]...)
+	for serviceKey := range workload.GetServices() {
+		if policy, ok := ps.byService[serviceKey]; ok {
+			out = append(out, policy)
+		}
+	}
+	return out
+}
+
 // List returns a copied list of all policies
 func (p *policyStore) list() []*security.Authorization {
 	p.rwLock.RLock()
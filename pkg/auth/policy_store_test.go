@@ -19,6 +19,9 @@ package auth
 import (
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/constants"
@@ -133,3 +136,33 @@ func Test_policyStore_removePolicy(t *testing.T) {
 		})
 	}
 }
+
+func Test_policyStore_updatePolicyScope(t *testing.T) {
+	ps := newPolicyStore()
+	policy := &security.Authorization{
+		Name:      "auth-name",
+		Namespace: "ns-name",
+		Scope:     security.Scope_NAMESPACE,
+	}
+	assert.NoError(t, ps.updatePolicy(policy))
+	assert.Equal(t, []*security.Authorization{policy}, ps.getForWorkload(&workloadapi.Workload{Namespace: "ns-name"}))
+
+	// the policy no longer applies to the whole namespace once it selects workloads
+	selector := &security.Authorization{
+		Name:      "auth-name",
+		Namespace: "ns-name",
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+	}
+	assert.NoError(t, ps.updatePolicy(selector))
+	assert.Empty(t, ps.getForWorkload(&workloadapi.Workload{Namespace: "ns-name"}))
+	assert.NotContains(t, ps.byNamespace, "ns-name")
+	assert.Equal(t, []*security.Authorization{selector}, ps.getForWorkload(&workloadapi.Workload{Namespace: "ns-name", AuthorizationPolicies: []string{"ns-name/auth-name"}}))
+
+	global := &security.Authorization{
+		Name:      "auth-name",
+		Namespace: "ns-name",
+		Scope:     security.Scope_GLOBAL,
+	}
+	assert.NoError(t, ps.updatePolicy(global))
+	assert.Equal(t, []*security.Authorization{global}, ps.getForWorkload(&workloadapi.Workload{Namespace: "other-ns"}))
+}
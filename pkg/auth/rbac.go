@@ -21,19 +21,21 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
-	"net"
 	"net/netip"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/ringbuf"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/trace"
 	"kmesh.net/kmesh/pkg/controller/workload/cache"
 	"kmesh.net/kmesh/pkg/logger"
+	"kmesh.net/kmesh/pkg/utils"
 )
 
 const (
@@ -42,18 +44,49 @@ const (
 	IPV4_TUPLE_LENGTH = int(unsafe.Sizeof(bpfSockTupleV4{}))
 	// TUPLE_LEN is the fixed length of 4-tuple(source/dest IP/port) in a record from map of tuple
 	TUPLE_LEN = int(unsafe.Sizeof(bpfSockTupleV6{}))
+	// CONN_ID_LEN is the length of the id of the connection following the tuple in a record
+	CONN_ID_LEN = int(unsafe.Sizeof(uint64(0)))
 	// MSG_LEN is the fixed length of one record we retrieve from map of tuple
-	MSG_LEN = TUPLE_LEN + int(unsafe.Sizeof(constants.MSG_TYPE_IPV4))
+	MSG_LEN = TUPLE_LEN + int(unsafe.Sizeof(constants.MSG_TYPE_IPV4)) + CONN_ID_LEN
+	// namespaceIsolationPolicyName is the name of the policies programmed for the namespace isolation
+	namespaceIsolationPolicyName = "kmesh-namespace-isolation"
 )
 
 var (
 	log = logger.NewLoggerScope("auth")
 )
 
+// Enforcement is how the connections are authorized
+type Enforcement uint32
+
+const (
+	// EnforcePolicies authorizes the connections with the authorization policies
+	EnforcePolicies Enforcement = iota
+	// AllowAll allows all the connections without enforcing the policies
+	AllowAll
+	// DenyAll denies all the new connections
+	DenyAll
+)
+
 type Rbac struct {
 	policyStore   *policyStore
 	workloadCache cache.WorkloadCache
 	notifyFunc    notifyFunc
+	// Tracer receives the verdicts of traced connections, can be nil
+	Tracer *trace.Tracer
+	// DeniedFunc receives the connections denied, to attribute their bytes to the verdict, can be nil
+	DeniedFunc func(src, dst netip.AddrPort)
+	// VerdictFunc receives the verdicts of the connections along with their id and the reason, to log them, can be nil
+	VerdictFunc func(connId uint64, src, dst netip.AddrPort, allowed bool, reason string)
+	// enforcement is an Enforcement, EnforcePolicies unless the policies can not be trusted
+	enforcement atomic.Uint32
+	// namespaceIsolation denies the connections from other namespaces to the workloads no ALLOW policy applies to
+	namespaceIsolation atomic.Bool
+	// excludedCIDRs are the destinations whose connections are not authorized, set before Run
+	excludedCIDRs []netip.Prefix
+	// limiter counts the connections to the services with a ConnectionLimit
+	limiter   *connLimiter
+	queueFunc queueFunc
 }
 
 type Identity struct {
@@ -69,8 +102,12 @@ type rbacConnection struct {
 	srcIp []byte
 	// dstIp ip is big endian
 	dstIp []byte
+	// srcPort is little endian
+	srcPort uint32
 	// dstPort is little endian
 	dstPort uint32
+	// connId is the id the data plane assigned to the connection at its start, 0 if unknown
+	connId uint64
 }
 
 type bpfSockTupleV4 struct {
@@ -94,6 +131,8 @@ func NewRbac(workloadCache cache.WorkloadCache) *Rbac {
 		policyStore:   newPolicyStore(),
 		workloadCache: workloadCache,
 		notifyFunc:    xdpNotifyConnRst,
+		limiter:       newConnLimiter(),
+		queueFunc:     xdpNotifyConnQueue,
 	}
 }
 
@@ -105,66 +144,251 @@ func (r *Rbac) Run(ctx context.Context, authReq, authRes *ebpf.Map) {
 		log.Error("either km_auth_req or km_auth_res map is nil")
 		return
 	}
-	reader, err := ringbuf.NewReader(authReq)
+	utils.NewRingbufConsumer("km_auth_req", authReq, MSG_LEN, func(sample []byte) {
+		r.handleAuthReq(sample, authRes)
+	}).Run(ctx)
+}
+
+// handleAuthReq checks the connection of an auth request against the policies,
+// the tuple of a denied connection is written into authRes for xdp to reset it
+func (r *Rbac) handleAuthReq(sample []byte, authRes *ebpf.Map) {
+	var (
+		conn rbacConnection
+		err  error
+	)
+
+	if len(sample) != MSG_LEN {
+		log.Errorf("wrong length %v of a msg, should be %v", len(sample), MSG_LEN)
+		return
+	}
+	// RawSample is network order
+	msgType := binary.LittleEndian.Uint32(sample)
+	connId := binary.LittleEndian.Uint64(sample[MSG_LEN-CONN_ID_LEN:])
+	if msgType == constants.MSG_TYPE_CONN_CLOSED {
+		r.connectionClosed(connId)
+		return
+	}
+	tupleData := sample[unsafe.Sizeof(msgType) : int(unsafe.Sizeof(msgType))+TUPLE_LEN]
+	buf := bytes.NewBuffer(tupleData)
+	switch msgType {
+	case constants.MSG_TYPE_IPV4:
+		conn, err = r.buildConnV4(buf)
+	case constants.MSG_TYPE_IPV6:
+		conn, err = r.buildConnV6(buf)
+	default:
+		log.Error("invalid msg type: ", msgType)
+		return
+	}
 	if err != nil {
-		log.Errorf("open km_auth_req ringbuf err: %v", err)
 		return
 	}
-	defer func() {
-		_ = reader.Close()
-	}()
-
-	rec := ringbuf.Record{}
-	var conn rbacConnection
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err = reader.ReadInto(&rec); err != nil {
-				log.Errorf("km_auth_req read failed: %v", err)
-				continue
-			}
-			if len(rec.RawSample) != MSG_LEN {
-				log.Errorf("wrong length %v of a msg, should be %v", len(rec.RawSample), MSG_LEN)
-				continue
-			}
-			// RawSample is network order
-			msgType := binary.LittleEndian.Uint32(rec.RawSample)
-			tupleData := rec.RawSample[unsafe.Sizeof(msgType):]
-			buf := bytes.NewBuffer(tupleData)
-			switch msgType {
-			case constants.MSG_TYPE_IPV4:
-				conn, err = r.buildConnV4(buf)
-			case constants.MSG_TYPE_IPV6:
-				conn, err = r.buildConnV6(buf)
-			default:
-				log.Error("invalid msg type: ", msgType)
-				continue
-			}
-			if err != nil {
-				continue
-			}
+	conn.connId = connId
+
+	verdict := r.authorize(&conn)
+	if verdict.Allowed {
+		verdict = r.admit(&conn, msgType, tupleData, authRes, verdict)
+	}
+	allowed := verdict.Allowed
+	r.traceVerdict(&conn, allowed)
+	r.reportVerdict(&conn, verdict)
+	if !allowed {
+		log.Debugf("Auth denied for connection: %+v", conn)
+		// If conn is denied, write tuples into XDP map, which includes source/destination IP/Port
+		if err = r.notifyFunc(authRes, msgType, tupleData); err != nil {
+			log.Error("km_auth_res update FAILED, err: ", err)
+		}
+		r.reportDenied(&conn)
+	}
+}
 
-			if !r.doRbac(&conn) {
-				log.Debugf("Auth denied for connection: %+v", conn)
-				// If conn is denied, write tuples into XDP map, which includes source/destination IP/Port
-				if err = r.notifyFunc(authRes, msgType, tupleData); err != nil {
-					log.Error("km_auth_res update FAILED, err: ", err)
+// reportDenied reports a denied connection to DeniedFunc if it is set
+func (r *Rbac) reportDenied(conn *rbacConnection) {
+	if r.DeniedFunc == nil {
+		return
+	}
+	srcIp, _ := netip.AddrFromSlice(conn.srcIp)
+	dstIp, _ := netip.AddrFromSlice(conn.dstIp)
+	r.DeniedFunc(netip.AddrPortFrom(srcIp, uint16(conn.srcPort)), netip.AddrPortFrom(dstIp, uint16(conn.dstPort)))
+}
+
+// reportVerdict reports the verdict of a connection to VerdictFunc if it is set
+func (r *Rbac) reportVerdict(conn *rbacConnection, verdict Explanation) {
+	if r.VerdictFunc == nil {
+		return
+	}
+	reason := verdict.Reason
+	if verdict.Policy != nil {
+		reason = fmt.Sprintf("authorization policy %s/%s", verdict.Policy.GetNamespace(), verdict.Policy.GetName())
+	}
+	srcIp, _ := netip.AddrFromSlice(conn.srcIp)
+	dstIp, _ := netip.AddrFromSlice(conn.dstIp)
+	r.VerdictFunc(conn.connId, netip.AddrPortFrom(srcIp, uint16(conn.srcPort)), netip.AddrPortFrom(dstIp, uint16(conn.dstPort)),
+		verdict.Allowed, reason)
+}
+
+// traceVerdict reports the verdict of a connection to the tracer if it is traced
+func (r *Rbac) traceVerdict(conn *rbacConnection, allowed bool) {
+	if !r.Tracer.Enabled() {
+		return
+	}
+
+	srcIp, _ := netip.AddrFromSlice(conn.srcIp)
+	dstIp, _ := netip.AddrFromSlice(conn.dstIp)
+	srcIp, dstIp = srcIp.Unmap(), dstIp.Unmap()
+	traced := &trace.Connection{
+		Src:      srcIp,
+		DstAddrs: []netip.Addr{dstIp},
+		DstPorts: []uint32{conn.dstPort},
+	}
+	ev := trace.Event{
+		Type:        trace.EventTypePolicy,
+		Source:      srcIp.String(),
+		Destination: netip.AddrPortFrom(dstIp, uint16(conn.dstPort)).String(),
+		Verdict:     "ALLOW",
+	}
+	if !allowed {
+		ev.Verdict = "DENY"
+	}
+
+	// the connection is already routed to a backend, match it with the services it belongs to
+	dstWorkload := r.workloadCache.GetWorkloadByAddr(cache.NetworkAddress{Network: conn.dstNetwork, Address: dstIp})
+	if dstWorkload == nil {
+		ev.Reason = "destination workload not found"
+	} else {
+		ev.Backend = dstWorkload.GetNamespace() + "/" + dstWorkload.GetName()
+		for svcName, ports := range dstWorkload.GetServices() {
+			if _, hostname, ok := strings.Cut(svcName, "/"); ok {
+				traced.DstNames = append(traced.DstNames, hostname)
+			}
+			for _, port := range ports.GetPorts() {
+				if port.GetTargetPort() == conn.dstPort {
+					traced.DstPorts = append(traced.DstPorts, port.GetServicePort())
 				}
 			}
 		}
 	}
+
+	r.Tracer.Emit(traced, ev)
 }
 
 func (r *Rbac) UpdatePolicy(auth *security.Authorization) error {
+	if hasL7Conditions(auth) {
+		log.Warnf("authorization policy %s/%s has conditions on L7 attributes, they are only enforced by a waypoint",
+			auth.GetNamespace(), auth.GetName())
+	}
 	return r.policyStore.updatePolicy(auth)
 }
 
+// UpdatePolicies applies the updated and removed policies as one generation, the connections authorized
+// meanwhile are authorized by either all the policies before or all the policies after
+func (r *Rbac) UpdatePolicies(updated []*security.Authorization, removed []string) error {
+	for _, auth := range updated {
+		if hasL7Conditions(auth) {
+			log.Warnf("authorization policy %s/%s has conditions on L7 attributes, they are only enforced by a waypoint",
+				auth.GetNamespace(), auth.GetName())
+		}
+	}
+	return r.policyStore.updatePolicies(updated, removed)
+}
+
 func (r *Rbac) RemovePolicy(policyKey string) {
 	r.policyStore.removePolicy(policyKey)
 }
 
+// UpdatePodPolicies replaces the policies translated from the NetworkPolicies selecting the pod,
+// they apply to its workload along with the ones from xds
+func (r *Rbac) UpdatePodPolicies(namespace, name string, policies []*security.Authorization) {
+	if r == nil {
+		return
+	}
+	r.policyStore.updatePodPolicies(namespace, name, policies)
+}
+
+// UpdatePodAuditPolicies replaces the AUDIT policies applying to the pod, they are evaluated on the
+// connections to its workload whatever their verdict, without changing it
+func (r *Rbac) UpdatePodAuditPolicies(namespace, name string, policies []*security.Authorization) {
+	if r == nil {
+		return
+	}
+	r.policyStore.updatePodAuditPolicies(namespace, name, policies)
+}
+
+// UpdateServicePolicy replaces the policy programmed for the kmesh.net/mtls annotation of the service,
+// it applies to the workloads of the service along with their other policies. nil removes it.
+func (r *Rbac) UpdateServicePolicy(serviceKey string, policy *security.Authorization) {
+	if r == nil {
+		return
+	}
+	r.policyStore.updateServicePolicy(serviceKey, policy)
+}
+
+// SetEnforcement changes how the new connections are authorized, the verdicts of the
+// connections already established are kept
+func (r *Rbac) SetEnforcement(enforcement Enforcement) {
+	if r == nil {
+		return
+	}
+	r.enforcement.Store(uint32(enforcement))
+}
+
+// SetNamespaceIsolation makes the connections from other namespaces to the workloads no ALLOW policy
+// applies to denied, instead of allowed
+func (r *Rbac) SetNamespaceIsolation(enabled bool) {
+	if r == nil {
+		return
+	}
+	r.namespaceIsolation.Store(enabled)
+}
+
+// SetExcludedCIDRs allows all the connections to the destinations in cidrs, they are left alone by kmesh
+func (r *Rbac) SetExcludedCIDRs(cidrs []netip.Prefix) {
+	if r == nil {
+		return
+	}
+	r.excludedCIDRs = cidrs
+}
+
+// isExcluded reports whether the destination of the connection is in an excluded CIDR
+func (r *Rbac) isExcluded(dstIp []byte) bool {
+	addr, ok := netip.AddrFromSlice(dstIp)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range r.excludedCIDRs {
+		if cidr.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// NamespaceIsolationPolicy returns the policy allowing the connections from the namespace to its workloads.
+// The xdp authz can not match namespaces, it is programmed first for every workload of the namespace so
+// that the connections no other policy matches in xdp are authorized in userspace. Userspace does not
+// evaluate it, the namespace isolation is only applied to the workloads no ALLOW policy applies to.
+func NamespaceIsolationPolicy(namespace string) *security.Authorization {
+	return &security.Authorization{
+		Name:      namespaceIsolationPolicyName,
+		Namespace: namespace,
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_ALLOW,
+		Rules: []*security.Rule{{
+			Clauses: []*security.Clause{{
+				Matches: []*security.Match{{
+					Namespaces: []*security.StringMatch{{MatchType: &security.StringMatch_Exact{Exact: namespace}}},
+				}},
+			}},
+		}},
+	}
+}
+
+// IsNamespaceIsolationPolicy reports whether the policy key is the one of a NamespaceIsolationPolicy
+func IsNamespaceIsolationPolicy(policyKey string) bool {
+	_, name, _ := strings.Cut(policyKey, "/")
+	return name == namespaceIsolationPolicyName
+}
+
 // GetAllPolicies returns all policy names in the policy store
 func (r *Rbac) GetAllPolicies() map[string]string {
 	if r == nil {
@@ -174,71 +398,192 @@ func (r *Rbac) GetAllPolicies() map[string]string {
 }
 
 func (r *Rbac) doRbac(conn *rbacConnection) bool {
+	return r.authorize(conn).Allowed
+}
+
+// authorize evaluates the policies on a connection reported by the data plane and logs why it is denied
+func (r *Rbac) authorize(conn *rbacConnection) Explanation {
+	verdict := r.evaluate(conn, nil, false)
+	for _, policy := range verdict.Audits {
+		log.Infof("audit: connection %+v would be denied by authorization policy %s/%s, allowed as it is an AUDIT policy",
+			conn, policy.GetNamespace(), policy.GetName())
+	}
+	if !verdict.Allowed {
+		if verdict.Policy != nil {
+			log.Infof("Auth denied for connection: %+v because authorization policy", conn)
+		} else {
+			log.Debugf("denied for connection: %v because %s", conn, verdict.Reason)
+		}
+	}
+	return verdict
+}
+
+// Explanation is the verdict of the authorization policies on a connection and why
+type Explanation struct {
+	Allowed bool
+	// Policy is the policy deciding the verdict, nil if no policy matched
+	Policy *security.Authorization
+	// Rule is the index of the matched rule in Policy, -1 if no policy matched
+	Rule   int
+	Reason string
+	// SrcIdentity is the identity of the source workload, empty if it is unknown
+	SrcIdentity string
+	// DstWorkload is the uid of the destination workload, empty if it is not found
+	DstWorkload string
+	// Audits are the AUDIT policies matching the connection, they log it would be denied without denying it
+	Audits []*security.Authorization
+}
+
+// Explain evaluates the loaded authorization policies on a connection from src to port dstPort
+// of the dst workload, it is the same evaluation as for the connections reported by the data plane.
+func (r *Rbac) Explain(src, dst netip.Addr, dstPort uint32) Explanation {
+	return r.ExplainWith(src, dst, dstPort, nil, false)
+}
+
+// ExplainWith is Explain with the candidate policy evaluated as if it were loaded, in place of the
+// loaded policy with the same key. The workloads do not carry their labels, so whether a candidate of
+// WORKLOAD_SELECTOR scope selects the dst workload is told by selectsDst.
+func (r *Rbac) ExplainWith(src, dst netip.Addr, dstPort uint32, candidate *security.Authorization, selectsDst bool) Explanation {
+	// the data plane reports ipv4 addresses in 4 bytes
+	conn := &rbacConnection{
+		srcIp:   src.Unmap().AsSlice(),
+		dstIp:   dst.Unmap().AsSlice(),
+		dstPort: dstPort,
+	}
+	conn.srcIdentity = r.getIdentityByIp(conn.srcIp)
+	return r.evaluate(conn, candidate, selectsDst)
+}
+
+func (r *Rbac) evaluate(conn *rbacConnection, candidate *security.Authorization, selectsDst bool) Explanation {
+	verdict := Explanation{Rule: -1}
+	if conn.srcIdentity.serviceAccount != "" {
+		verdict.SrcIdentity = conn.srcIdentity.String()
+	}
+	if r.isExcluded(conn.dstIp) {
+		verdict.Allowed = true
+		verdict.Reason = "the destination is in an excluded CIDR"
+		return verdict
+	}
+
+	switch Enforcement(r.enforcement.Load()) {
+	case AllowAll:
+		verdict.Allowed = true
+		verdict.Reason = "the authorization policies are not enforced, all the connections are allowed"
+		return verdict
+	case DenyAll:
+		verdict.Reason = "all the new connections are denied"
+		return verdict
+	}
+
 	var networkAddress cache.NetworkAddress
 	networkAddress.Network = conn.dstNetwork
 	networkAddress.Address, _ = netip.AddrFromSlice(conn.dstIp)
 	dstWorkload := r.workloadCache.GetWorkloadByAddr(networkAddress)
 	// If no workload found, deny
 	if dstWorkload == nil {
-		log.Debugf("denied for connection: %v because destination workload not found", conn)
-		return false
+		verdict.Reason = "destination workload not found"
+		return verdict
 	}
+	verdict.DstWorkload = dstWorkload.GetUid()
 
 	// TODO: maybe cache them for performance issue
 	allowPolicies, denyPolicies := r.aggregate(dstWorkload)
+	if candidate != nil {
+		allowPolicies, denyPolicies = withCandidate(allowPolicies, denyPolicies, candidate, selectsDst, dstWorkload)
+	}
+
+	// 0. The AUDIT policies are evaluated whatever the verdict, without changing it
+	for _, auditPolicy := range r.policyStore.getAuditForWorkload(dstWorkload) {
+		if matches(conn, auditPolicy) {
+			verdict.Audits = append(verdict.Audits, auditPolicy)
+		}
+	}
 
 	// 1. If there is ANY deny policy, deny the request
 	for _, denyPolicy := range denyPolicies {
-		if matches(conn, denyPolicy) {
-			log.Infof("Auth denied for connection: %+v because authorization policy", conn)
-			return false
+		if rule := matchRule(conn, denyPolicy); rule >= 0 {
+			verdict.Policy, verdict.Rule = denyPolicy, rule
+			verdict.Reason = "a rule of the DENY policy matched"
+			return verdict
 		}
 	}
 
-	// 2. If there is NO allow policy for the workload, allow the request
+	// 2. If there is NO allow policy for the workload, allow the request unless it crosses
+	// namespaces with the namespace isolation
 	if len(allowPolicies) == 0 {
-		return true
+		if r.namespaceIsolation.Load() && conn.srcIdentity.namespace != dstWorkload.GetNamespace() {
+			verdict.Reason = "no ALLOW policy applies to the destination workload and the source is not in its namespace"
+			return verdict
+		}
+		verdict.Allowed = true
+		verdict.Reason = "no ALLOW policy applies to the destination workload"
+		return verdict
 	}
 
 	// 3. If there is ANY allow policy matched, allow the request
 	for _, allowPolicy := range allowPolicies {
-		if matches(conn, allowPolicy) {
-			return true
+		if rule := matchRule(conn, allowPolicy); rule >= 0 {
+			verdict.Allowed = true
+			verdict.Policy, verdict.Rule = allowPolicy, rule
+			verdict.Reason = "a rule of the ALLOW policy matched"
+			return verdict
 		}
 	}
 
 	// 4. If 1,2 and 3 unsatisfied, deny the request
-	return false
+	verdict.Reason = fmt.Sprintf("none of the %d ALLOW policies applying to the destination workload matched", len(allowPolicies))
+	return verdict
 }
 
 func (r *Rbac) aggregate(workload *workloadapi.Workload) (allowPolicies, denyPolicies []*security.Authorization) {
 	allowPolicies = make([]*security.Authorization, 0)
 	denyPolicies = make([]*security.Authorization, 0)
 
-	// Collect policy names from workload,  namespace and global(root namespace)
-	policyNames := workload.GetAuthorizationPolicies()
-	policyNames = append(policyNames, r.policyStore.getByNamespace(workload.Namespace)...)
-	policyNames = append(policyNames, r.policyStore.getByNamespace("")...)
-
-	for _, policyName := range policyNames {
-		if policy, ok := r.policyStore.byKey[policyName]; ok {
-			if policy.Action == security.Action_ALLOW {
-				allowPolicies = append(allowPolicies, policy)
-			} else if policy.Action == security.Action_DENY {
-				denyPolicies = append(denyPolicies, policy)
-			}
+	// Collect policies from workload, namespace and global(root namespace)
+	for _, policy := range r.policyStore.getForWorkload(workload) {
+		if policy.Action == security.Action_ALLOW {
+			allowPolicies = append(allowPolicies, policy)
+		} else if policy.Action == security.Action_DENY {
+			denyPolicies = append(denyPolicies, policy)
 		}
 	}
 	return
 }
 
-func matches(conn *rbacConnection, policy *security.Authorization) bool {
-	if policy.GetRules() == nil {
-		return false
+// withCandidate replaces the policy with the key of candidate by candidate, dropped if it does not apply to workload
+func withCandidate(allowPolicies, denyPolicies []*security.Authorization, candidate *security.Authorization,
+	selectsDst bool, workload *workloadapi.Workload) ([]*security.Authorization, []*security.Authorization) {
+	key := candidate.ResourceName()
+	isCandidate := func(policy *security.Authorization) bool {
+		return policy.ResourceName() == key
+	}
+	allowPolicies = slices.DeleteFunc(allowPolicies, isCandidate)
+	denyPolicies = slices.DeleteFunc(denyPolicies, isCandidate)
+
+	switch candidate.GetScope() {
+	case security.Scope_NAMESPACE:
+		if candidate.GetNamespace() != workload.GetNamespace() {
+			return allowPolicies, denyPolicies
+		}
+	case security.Scope_WORKLOAD_SELECTOR:
+		if !selectsDst || candidate.GetNamespace() != workload.GetNamespace() {
+			return allowPolicies, denyPolicies
+		}
 	}
+	if candidate.GetAction() == security.Action_DENY {
+		return allowPolicies, append(denyPolicies, candidate)
+	}
+	return append(allowPolicies, candidate), denyPolicies
+}
+
+func matches(conn *rbacConnection, policy *security.Authorization) bool {
+	return matchRule(conn, policy) >= 0
+}
 
+// matchRule returns the index of the first rule of policy matching conn, -1 if none does
+func matchRule(conn *rbacConnection, policy *security.Authorization) int {
 	// If ANY rule matches, it's a match
-	for _, rule := range policy.GetRules() {
+	for i, rule := range policy.GetRules() {
 		ruleMatch := true
 		// If ALL clause matches, it's a match
 		for _, clause := range rule.GetClauses() {
@@ -269,10 +614,10 @@ func matches(conn *rbacConnection, policy *security.Authorization) bool {
 			}
 		}
 		if ruleMatch {
-			return true
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
 func matchDstIp(dstIp []byte, match *security.Match) bool {
@@ -376,31 +721,47 @@ func matchNamespace(srcNs string, match *security.Match) bool {
 }
 
 func internalMatchDstIp(dstIp []byte, addresses []*security.Address) bool {
-	for _, addr := range addresses {
-		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", net.IP(addr.GetAddress()).String(), addr.GetLength()))
-		if err != nil {
-			continue
-		}
-		if ipNet.Contains(dstIp) {
-			return true
-		}
-	}
-	return false
+	return internalMatchIp(dstIp, addresses)
 }
 
 func internalMatchSrcIp(srcIp []byte, addresses []*security.Address) bool {
+	return internalMatchIp(srcIp, addresses)
+}
+
+// internalMatchIp reports whether the ip is in one of the address blocks. A block only matches
+// the addresses of its family: the ipv4 blocks, including the ipv4-mapped ones, match the ipv4
+// connections and the ipv6 blocks the ipv6 ones.
+func internalMatchIp(ip []byte, addresses []*security.Address) bool {
+	target, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	target = target.Unmap()
 	for _, addr := range addresses {
-		_, ipNet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", net.IP(addr.GetAddress()).String(), addr.GetLength()))
-		if err != nil {
-			continue
-		}
-		if ipNet.Contains(srcIp) {
+		if prefix, ok := addressPrefix(addr); ok && prefix.Contains(target) {
 			return true
 		}
 	}
 	return false
 }
 
+// addressPrefix returns the block of the address, an ipv4-mapped block is returned as the ipv4 one
+func addressPrefix(addr *security.Address) (netip.Prefix, bool) {
+	ip, ok := netip.AddrFromSlice(addr.GetAddress())
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	bits := int(addr.GetLength())
+	if ip.Is4In6() {
+		ip, bits = ip.Unmap(), bits-96
+	}
+	prefix, err := ip.Prefix(bits)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
 func internalMatchDstPort(checkDstPort uint32, dstPorts []uint32) bool {
 	for _, port := range dstPorts {
 		if checkDstPort == port {
@@ -461,6 +822,7 @@ func (r *Rbac) buildConnV4(buf *bytes.Buffer) (rbacConnection, error) {
 	// srcIp and dstIp are big endian, and dstPort is little endian, which is consistent with authorization policy flushed to Kmesh
 	conn.srcIp = binary.BigEndian.AppendUint32(conn.srcIp, tupleV4.SrcAddr)
 	conn.dstIp = binary.BigEndian.AppendUint32(conn.dstIp, tupleV4.DstAddr)
+	conn.srcPort = uint32(tupleV4.SrcPort)
 	conn.dstPort = uint32(tupleV4.DstPort)
 	conn.srcIdentity = r.getIdentityByIp(conn.srcIp)
 	return conn, nil
@@ -481,6 +843,7 @@ func (r *Rbac) buildConnV6(buf *bytes.Buffer) (rbacConnection, error) {
 		conn.srcIp = binary.BigEndian.AppendUint32(conn.srcIp, tupleV6.SrcAddr[i])
 		conn.dstIp = binary.BigEndian.AppendUint32(conn.dstIp, tupleV6.DstAddr[i])
 	}
+	conn.srcPort = uint32(tupleV6.SrcPort)
 	conn.dstPort = uint32(tupleV6.DstPort)
 	// conn.dstIp = restoreIPv4(conn.dstIp)
 	// conn.srcIp = restoreIPv4(conn.srcIp)
@@ -501,6 +864,26 @@ func isEmptyMatch(m *security.Match) bool {
 		m.GetNamespaces() == nil && m.GetNotNamespaces() == nil
 }
 
+// hasL7Conditions reports whether the policy has `when` conditions on L7 attributes,
+// istiod converts each of them into a clause whose matches are all empty
+func hasL7Conditions(auth *security.Authorization) bool {
+	for _, rule := range auth.GetRules() {
+		for _, clause := range rule.GetClauses() {
+			if len(clause.GetMatches()) == 0 {
+				continue
+			}
+			empty := true
+			for _, match := range clause.GetMatches() {
+				empty = empty && isEmptyMatch(match)
+			}
+			if empty {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // todo : get identity from tls connection
 func (r *Rbac) getIdentityByIp(ip []byte) Identity {
 	var networkAddress cache.NetworkAddress
@@ -19,7 +19,12 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"unsafe"
@@ -27,6 +32,7 @@ import (
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"istio.io/istio/pkg/util/sets"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
@@ -1981,6 +1987,659 @@ func TestRbac_doRbac(t *testing.T) {
 	}
 }
 
+func TestRbac_whenConditions(t *testing.T) {
+	// istiod converts each `when` condition into a clause of the rule, an L7 condition into an empty match
+	from := &security.Clause{
+		Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{192, 168, 122, 0}, Length: 24}}}},
+	}
+	conn := &rbacConnection{
+		srcIp:   []byte{192, 168, 122, 3},
+		dstIp:   []byte{192, 168, 122, 2},
+		dstPort: 8080,
+	}
+	tests := []struct {
+		name      string
+		condition *security.Match
+		want      bool
+	}{
+		{
+			name:      "source.ip matched",
+			condition: &security.Match{SourceIps: []*security.Address{{Address: []byte{192, 168, 122, 3}, Length: 32}}},
+			want:      true,
+		},
+		{
+			name:      "source.ip unmatched",
+			condition: &security.Match{SourceIps: []*security.Address{{Address: []byte{192, 168, 122, 4}, Length: 32}}},
+			want:      false,
+		},
+		{
+			name:      "source.ip notValues",
+			condition: &security.Match{NotSourceIps: []*security.Address{{Address: []byte{192, 168, 122, 3}, Length: 32}}},
+			want:      false,
+		},
+		{
+			name:      "destination.ip matched",
+			condition: &security.Match{DestinationIps: []*security.Address{{Address: []byte{192, 168, 122, 0}, Length: 24}}},
+			want:      true,
+		},
+		{
+			name:      "destination.ip notValues",
+			condition: &security.Match{NotDestinationIps: []*security.Address{{Address: []byte{192, 168, 122, 2}, Length: 32}}},
+			want:      false,
+		},
+		{
+			name:      "destination.port matched",
+			condition: &security.Match{DestinationPorts: []uint32{80, 8080}},
+			want:      true,
+		},
+		{
+			name:      "destination.port unmatched",
+			condition: &security.Match{DestinationPorts: []uint32{80}},
+			want:      false,
+		},
+		{
+			name:      "destination.port notValues",
+			condition: &security.Match{NotDestinationPorts: []uint32{8080}},
+			want:      false,
+		},
+		{
+			name:      "L7 condition left to the waypoint",
+			condition: &security.Match{},
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &security.Authorization{
+				Name:      "when",
+				Namespace: "default",
+				Scope:     security.Scope_WORKLOAD_SELECTOR,
+				Action:    security.Action_DENY,
+				Rules: []*security.Rule{
+					{Clauses: []*security.Clause{from, {Matches: []*security.Match{tt.condition}}}},
+				},
+			}
+			if got := matches(conn, policy); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+			if got := hasL7Conditions(policy); got != isEmptyMatch(tt.condition) {
+				t.Errorf("hasL7Conditions() = %v, want %v", got, isEmptyMatch(tt.condition))
+			}
+		})
+	}
+}
+
+func TestRbac_multipleRules(t *testing.T) {
+	// istiod converts each rule of an AuthorizationPolicy into a rule, its `from` and `to` into clauses
+	fromSleep := &security.Clause{
+		Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{192, 168, 122, 3}, Length: 32}}}},
+	}
+	toAdmin := &security.Clause{
+		Matches: []*security.Match{{DestinationPorts: []uint32{9090}}},
+	}
+	twoRules := &security.Authorization{
+		Name:      DENY_AUTH,
+		Namespace: GLOBAL_NAMESPACE,
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{
+			{Clauses: []*security.Clause{fromSleep}},
+			{Clauses: []*security.Clause{toAdmin}},
+		},
+	}
+	fromAndTo := &security.Authorization{
+		Name:      DENY_AUTH,
+		Namespace: GLOBAL_NAMESPACE,
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{
+			{Clauses: []*security.Clause{fromSleep, toAdmin}},
+		},
+	}
+	tests := []struct {
+		name    string
+		policy  *security.Authorization
+		srcIp   []byte
+		dstPort uint32
+		want    bool
+	}{
+		{"two rules, first matches, deny", twoRules, []byte{192, 168, 122, 3}, 8080, false},
+		{"two rules, second matches, deny", twoRules, []byte{192, 168, 122, 5}, 9090, false},
+		{"two rules, both match, deny", twoRules, []byte{192, 168, 122, 3}, 9090, false},
+		{"two rules, none matches, allow", twoRules, []byte{192, 168, 122, 5}, 8080, true},
+		{"from and to, both match, deny", fromAndTo, []byte{192, 168, 122, 3}, 9090, false},
+		{"from and to, only from matches, allow", fromAndTo, []byte{192, 168, 122, 3}, 8080, true},
+		{"from and to, only to matches, allow", fromAndTo, []byte{192, 168, 122, 5}, 9090, true},
+		{"from and to, none matches, allow", fromAndTo, []byte{192, 168, 122, 5}, 8080, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workloadCache := cache.NewWorkloadCache()
+			workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+				Uid:       "kmesh",
+				Addresses: [][]byte{{192, 168, 122, 2}},
+			})
+			rbac := &Rbac{
+				policyStore: &policyStore{
+					byKey:       map[string]*security.Authorization{DENY_POLICY: tt.policy},
+					byNamespace: byNamespaceDeny,
+				},
+				workloadCache: workloadCache,
+			}
+			conn := &rbacConnection{
+				srcIp:   tt.srcIp,
+				dstIp:   []byte{192, 168, 122, 2},
+				dstPort: tt.dstPort,
+			}
+			if got := rbac.doRbac(conn); got != tt.want {
+				t.Errorf("Rbac.DoRbac() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRbac_excludedCIDRs(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "kmesh",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	denyAll := &security.Authorization{
+		Name:      DENY_AUTH,
+		Namespace: GLOBAL_NAMESPACE,
+		Scope:     security.Scope_WORKLOAD_SELECTOR,
+		Action:    security.Action_DENY,
+		Rules:     []*security.Rule{{}},
+	}
+	rbac := &Rbac{
+		policyStore: &policyStore{
+			byKey:       map[string]*security.Authorization{DENY_POLICY: denyAll},
+			byNamespace: byNamespaceDeny,
+		},
+		workloadCache: workloadCache,
+	}
+	rbac.SetExcludedCIDRs([]netip.Prefix{netip.MustParsePrefix("169.254.0.0/16")})
+
+	tests := []struct {
+		name  string
+		dstIp []byte
+		want  bool
+	}{
+		{"excluded destination, allow", []byte{169, 254, 169, 254}, true},
+		{"v4-mapped excluded destination, allow", netip.MustParseAddr("::ffff:169.254.169.254").AsSlice(), true},
+		{"managed destination, deny", []byte{192, 168, 122, 2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &rbacConnection{
+				srcIp:   []byte{192, 168, 122, 3},
+				dstIp:   tt.dstIp,
+				dstPort: 80,
+			}
+			assert.Equal(t, tt.want, rbac.doRbac(conn))
+		})
+	}
+}
+
+func TestRbac_Explain(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:            "cluster0//Pod/default/sleep",
+		Namespace:      "default",
+		ServiceAccount: "sleep",
+		TrustDomain:    "cluster.local",
+		Addresses:      [][]byte{{192, 168, 122, 3}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+
+	tests := []struct {
+		name        string
+		policyStore *policyStore
+		dst         netip.Addr
+		want        Explanation
+	}{
+		{
+			name:        "destination workload not found",
+			policyStore: newPolicyStore(),
+			dst:         netip.MustParseAddr("10.0.0.1"),
+			want: Explanation{
+				Rule:        -1,
+				Reason:      "destination workload not found",
+				SrcIdentity: "spiffe://cluster.local/ns/default/sa/sleep",
+			},
+		},
+		{
+			name:        "no allow policy",
+			policyStore: newPolicyStore(),
+			dst:         dst,
+			want: Explanation{
+				Allowed:     true,
+				Rule:        -1,
+				Reason:      "no ALLOW policy applies to the destination workload",
+				SrcIdentity: "spiffe://cluster.local/ns/default/sa/sleep",
+				DstWorkload: "cluster0//Pod/default/httpbin",
+			},
+		},
+		{
+			name: "allow policy matched",
+			policyStore: &policyStore{
+				byKey:       map[string]*security.Authorization{ALLOW_POLICY: policy2_1},
+				byNamespace: byNamespaceAllow,
+			},
+			dst: dst,
+			want: Explanation{
+				Allowed:     true,
+				Policy:      policy2_1,
+				Rule:        0,
+				Reason:      "a rule of the ALLOW policy matched",
+				SrcIdentity: "spiffe://cluster.local/ns/default/sa/sleep",
+				DstWorkload: "cluster0//Pod/default/httpbin",
+			},
+		},
+		{
+			name: "allow policy mismatched",
+			policyStore: &policyStore{
+				byKey:       map[string]*security.Authorization{ALLOW_POLICY: policy2_2},
+				byNamespace: byNamespaceAllow,
+			},
+			dst: dst,
+			want: Explanation{
+				Rule:        -1,
+				Reason:      "none of the 1 ALLOW policies applying to the destination workload matched",
+				SrcIdentity: "spiffe://cluster.local/ns/default/sa/sleep",
+				DstWorkload: "cluster0//Pod/default/httpbin",
+			},
+		},
+		{
+			name: "deny policy matched",
+			policyStore: &policyStore{
+				byKey: map[string]*security.Authorization{
+					DENY_POLICY:  policy2_3_deny,
+					ALLOW_POLICY: policy2_3_allow,
+				},
+				byNamespace: byNamespaceAllowDeny,
+			},
+			dst: dst,
+			want: Explanation{
+				Policy:      policy2_3_deny,
+				Rule:        0,
+				Reason:      "a rule of the DENY policy matched",
+				SrcIdentity: "spiffe://cluster.local/ns/default/sa/sleep",
+				DstWorkload: "cluster0//Pod/default/httpbin",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbac := &Rbac{
+				policyStore:   tt.policyStore,
+				workloadCache: workloadCache,
+			}
+			assert.Equal(t, tt.want, rbac.Explain(src, tt.dst, 8888))
+		})
+	}
+}
+
+func TestRbac_ExplainWith(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+	denyPort := func(namespace string, port uint32) *security.Authorization {
+		return &security.Authorization{
+			Name:      "deny-port",
+			Namespace: namespace,
+			Scope:     security.Scope_NAMESPACE,
+			Action:    security.Action_DENY,
+			Rules: []*security.Rule{{
+				Clauses: []*security.Clause{{
+					Matches: []*security.Match{{DestinationPorts: []uint32{port}}},
+				}},
+			}},
+		}
+	}
+	rbac := NewRbac(workloadCache)
+	require.NoError(t, rbac.UpdatePolicy(denyPort("default", 8080)))
+
+	assert.False(t, rbac.Explain(src, dst, 8080).Allowed)
+	// the candidate replaces the loaded policy with the same key
+	verdict := rbac.ExplainWith(src, dst, 8080, denyPort("default", 9090), false)
+	assert.True(t, verdict.Allowed)
+	verdict = rbac.ExplainWith(src, dst, 9090, denyPort("default", 9090), false)
+	assert.False(t, verdict.Allowed)
+	assert.Equal(t, "default/deny-port", verdict.Policy.ResourceName())
+	// the candidate of another namespace does not apply to the workload
+	assert.True(t, rbac.ExplainWith(src, dst, 9090, denyPort("other", 9090), false).Allowed)
+	// a candidate selecting workloads applies to the workload if it selects it
+	selector := denyPort("default", 9090)
+	selector.Scope = security.Scope_WORKLOAD_SELECTOR
+	assert.False(t, rbac.ExplainWith(src, dst, 9090, selector, true).Allowed)
+	assert.True(t, rbac.ExplainWith(src, dst, 9090, selector, false).Allowed)
+	// the candidate is not loaded
+	assert.False(t, rbac.Explain(src, dst, 8080).Allowed)
+	assert.True(t, rbac.Explain(src, dst, 9090).Allowed)
+}
+
+func TestRbac_auditPolicy(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Name:      "httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+	portPolicy := func(name string, port uint32) *security.Authorization {
+		return &security.Authorization{
+			Name:      name,
+			Namespace: "default",
+			Scope:     security.Scope_NAMESPACE,
+			Action:    security.Action_DENY,
+			Rules: []*security.Rule{{
+				Clauses: []*security.Clause{{
+					Matches: []*security.Match{{DestinationPorts: []uint32{port}}},
+				}},
+			}},
+		}
+	}
+	rbac := NewRbac(workloadCache)
+	rbac.UpdatePodAuditPolicies("default", "httpbin", []*security.Authorization{portPolicy("audit-port", 8080)})
+
+	// the matching AUDIT policy is reported, the connection is allowed
+	verdict := rbac.Explain(src, dst, 8080)
+	assert.True(t, verdict.Allowed)
+	require.Len(t, verdict.Audits, 1)
+	assert.Equal(t, "default/audit-port", verdict.Audits[0].ResourceName())
+	assert.True(t, rbac.doRbac(&rbacConnection{srcIp: src.AsSlice(), dstIp: dst.AsSlice(), dstPort: 8080}))
+	// it is not reported for the connections it does not match
+	verdict = rbac.Explain(src, dst, 9090)
+	assert.True(t, verdict.Allowed)
+	assert.Empty(t, verdict.Audits)
+
+	// an AUDIT policy does not override a DENY one
+	require.NoError(t, rbac.UpdatePolicy(portPolicy("deny-port", 8080)))
+	verdict = rbac.Explain(src, dst, 8080)
+	assert.False(t, verdict.Allowed)
+	assert.Equal(t, "default/deny-port", verdict.Policy.ResourceName())
+	assert.Len(t, verdict.Audits, 1)
+
+	rbac.UpdatePodAuditPolicies("default", "httpbin", nil)
+	assert.Empty(t, rbac.Explain(src, dst, 8080).Audits)
+}
+
+func TestRbac_DualStackIpBlocks(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{
+			netip.MustParseAddr("192.168.122.2").AsSlice(),
+			netip.MustParseAddr("fd00:10::2").AsSlice(),
+		},
+	})
+	dstV4 := netip.MustParseAddr("192.168.122.2")
+	dstV6 := netip.MustParseAddr("fd00:10::2")
+	address := func(cidr string) *security.Address {
+		prefix := netip.MustParsePrefix(cidr)
+		return &security.Address{Address: prefix.Addr().AsSlice(), Length: uint32(prefix.Bits())}
+	}
+	denySources := func(cidrs ...string) *security.Authorization {
+		var ips []*security.Address
+		for _, cidr := range cidrs {
+			ips = append(ips, address(cidr))
+		}
+		return &security.Authorization{
+			Name:      "deny-ipblocks",
+			Namespace: "default",
+			Scope:     security.Scope_NAMESPACE,
+			Action:    security.Action_DENY,
+			Rules: []*security.Rule{{
+				Clauses: []*security.Clause{{
+					Matches: []*security.Match{{SourceIps: ips}},
+				}},
+			}},
+		}
+	}
+	rbac := NewRbac(workloadCache)
+
+	// the v6 block denies the v6 connections only, even the one matching any address
+	require.NoError(t, rbac.UpdatePolicy(denySources("fd00:20::/64")))
+	assert.False(t, rbac.Explain(netip.MustParseAddr("fd00:20::3"), dstV6, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("fd00:30::3"), dstV6, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("192.168.122.3"), dstV4, 8080).Allowed)
+	require.NoError(t, rbac.UpdatePolicy(denySources("::/0")))
+	assert.False(t, rbac.Explain(netip.MustParseAddr("fd00:30::3"), dstV6, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("192.168.122.3"), dstV4, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("::ffff:192.168.122.3"), dstV4, 8080).Allowed)
+
+	// the v4 and v6 blocks of a policy both apply, to the connections of their family
+	require.NoError(t, rbac.UpdatePolicy(denySources("fd00:20::/64", "10.0.0.0/8")))
+	assert.False(t, rbac.Explain(netip.MustParseAddr("fd00:20::3"), dstV6, 8080).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.1.2.3"), dstV4, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("192.168.122.3"), dstV4, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("fd00:30::3"), dstV6, 8080).Allowed)
+
+	// an ipv4-mapped block is the v4 one
+	require.NoError(t, rbac.UpdatePolicy(denySources("::ffff:10.0.0.0/104")))
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.1.2.3"), dstV4, 8080).Allowed)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("fd00:20::3"), dstV6, 8080).Allowed)
+}
+
+func TestRbac_SetEnforcement(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+
+	// the allow policy does not match the connection
+	rbac := &Rbac{
+		policyStore: &policyStore{
+			byKey:       map[string]*security.Authorization{ALLOW_POLICY: policy2_2},
+			byNamespace: byNamespaceAllow,
+		},
+		workloadCache: workloadCache,
+	}
+	assert.False(t, rbac.Explain(src, dst, 8888).Allowed)
+
+	rbac.SetEnforcement(AllowAll)
+	verdict := rbac.Explain(src, dst, 8888)
+	assert.True(t, verdict.Allowed)
+	assert.Nil(t, verdict.Policy)
+	assert.Equal(t, "the authorization policies are not enforced, all the connections are allowed", verdict.Reason)
+
+	// denied even without any policy
+	rbac.SetEnforcement(DenyAll)
+	assert.False(t, rbac.Explain(src, dst, 8888).Allowed)
+	rbac.policyStore = newPolicyStore()
+	verdict = rbac.Explain(src, dst, 8888)
+	assert.False(t, verdict.Allowed)
+	assert.Equal(t, "all the new connections are denied", verdict.Reason)
+
+	rbac.SetEnforcement(EnforcePolicies)
+	assert.True(t, rbac.Explain(src, dst, 8888).Allowed)
+}
+
+func TestRbac_namespaceIsolation(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:            "cluster0//Pod/ns-a/sleep",
+		Namespace:      "ns-a",
+		ServiceAccount: "sleep",
+		TrustDomain:    "cluster.local",
+		Addresses:      [][]byte{{192, 168, 122, 3}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:            "cluster0//Pod/ns-b/sleep",
+		Namespace:      "ns-b",
+		ServiceAccount: "sleep",
+		TrustDomain:    "cluster.local",
+		Addresses:      [][]byte{{192, 168, 122, 4}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/ns-b/httpbin",
+		Namespace: "ns-b",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	crossNamespace := netip.MustParseAddr("192.168.122.3")
+	sameNamespace := netip.MustParseAddr("192.168.122.4")
+	dst := netip.MustParseAddr("192.168.122.2")
+
+	rbac := &Rbac{
+		policyStore:   newPolicyStore(),
+		workloadCache: workloadCache,
+	}
+	assert.True(t, rbac.Explain(crossNamespace, dst, 8080).Allowed)
+
+	rbac.SetNamespaceIsolation(true)
+	verdict := rbac.Explain(crossNamespace, dst, 8080)
+	assert.False(t, verdict.Allowed)
+	assert.Nil(t, verdict.Policy)
+	assert.Equal(t, "no ALLOW policy applies to the destination workload and the source is not in its namespace", verdict.Reason)
+	assert.True(t, rbac.Explain(sameNamespace, dst, 8080).Allowed)
+	// unknown sources are not in any namespace
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.0.0.1"), dst, 8080).Allowed)
+
+	// a DENY policy does not change the default
+	deny := &security.Authorization{
+		Name:      "deny-9090",
+		Namespace: "ns-b",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{Clauses: []*security.Clause{{
+			Matches: []*security.Match{{DestinationPorts: []uint32{9090}}},
+		}}}},
+	}
+	require.NoError(t, rbac.UpdatePolicy(deny))
+	assert.False(t, rbac.Explain(crossNamespace, dst, 8080).Allowed)
+	assert.True(t, rbac.Explain(sameNamespace, dst, 8080).Allowed)
+
+	// an ALLOW policy permits the connections from ns-a explicitly
+	allow := &security.Authorization{
+		Name:      "allow-ns-a",
+		Namespace: "ns-b",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_ALLOW,
+		Rules: []*security.Rule{{Clauses: []*security.Clause{{
+			Matches: []*security.Match{{Namespaces: []*security.StringMatch{{MatchType: &security.StringMatch_Exact{Exact: "ns-a"}}}}},
+		}}}},
+	}
+	require.NoError(t, rbac.UpdatePolicy(allow))
+	verdict = rbac.Explain(crossNamespace, dst, 8080)
+	assert.True(t, verdict.Allowed)
+	assert.Equal(t, allow, verdict.Policy)
+	assert.False(t, rbac.Explain(crossNamespace, dst, 9090).Allowed)
+	// the ALLOW policies applying to the workload decide for the same namespace as well
+	assert.False(t, rbac.Explain(sameNamespace, dst, 8080).Allowed)
+
+	rbac.RemovePolicy(allow.ResourceName())
+	assert.False(t, rbac.Explain(crossNamespace, dst, 8080).Allowed)
+}
+
+func TestRbac_updateDenyPolicyWithoutGap(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:            "cluster0//Pod/ns-a/sleep",
+		Namespace:      "ns-a",
+		ServiceAccount: "sleep",
+		TrustDomain:    "cluster.local",
+		Addresses:      [][]byte{{192, 168, 122, 3}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/ns-b/httpbin",
+		Namespace: "ns-b",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+
+	rbac := &Rbac{
+		policyStore:   newPolicyStore(),
+		workloadCache: workloadCache,
+	}
+	// both versions of the policy deny the source, by namespace or by address
+	byNamespace := &security.Authorization{
+		Name:      "deny-sleep",
+		Namespace: "ns-b",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{Clauses: []*security.Clause{{
+			Matches: []*security.Match{{Namespaces: []*security.StringMatch{{MatchType: &security.StringMatch_Exact{Exact: "ns-a"}}}}},
+		}}}},
+	}
+	byAddress := &security.Authorization{
+		Name:      "deny-sleep",
+		Namespace: "ns-b",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{Clauses: []*security.Clause{{
+			Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{192, 168, 122, 3}, Length: 32}}}},
+		}}}},
+	}
+	require.NoError(t, rbac.UpdatePolicy(byNamespace))
+	require.False(t, rbac.Explain(src, dst, 8080).Allowed)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			policy := byNamespace
+			if i%2 == 0 {
+				policy = byAddress
+			}
+			if err := rbac.UpdatePolicy(policy); err != nil {
+				t.Errorf("update policy failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	// the connections authorized while the policy is edited never slip through
+	for {
+		select {
+		case <-done:
+			assert.False(t, rbac.Explain(src, dst, 8080).Allowed)
+			return
+		default:
+		}
+		if rbac.Explain(src, dst, 8080).Allowed {
+			t.Fatal("connection allowed while the DENY policy was updated")
+		}
+	}
+}
+
+func TestNamespaceIsolationPolicy(t *testing.T) {
+	policy := NamespaceIsolationPolicy("ns-b")
+	assert.True(t, IsNamespaceIsolationPolicy(policy.ResourceName()))
+	assert.False(t, IsNamespaceIsolationPolicy("ns-b/allow-ns-a"))
+	assert.False(t, hasL7Conditions(policy))
+
+	// it matches the connections from the namespace only
+	conn := &rbacConnection{
+		srcIdentity: Identity{namespace: "ns-b"},
+		srcIp:       []byte{192, 168, 122, 4},
+		dstIp:       []byte{192, 168, 122, 2},
+		dstPort:     8080,
+	}
+	assert.True(t, matches(conn, policy))
+	conn.srcIdentity.namespace = "ns-a"
+	assert.False(t, matches(conn, policy))
+}
+
 func Test_handleAuthorizationTypeResponse(t *testing.T) {
 	config := options.BpfConfig{
 		Mode:        constants.DualEngineMode,
@@ -2042,6 +2701,7 @@ func genRingbuf(t *testing.T, msgType uint32, msgSize int, flags int32) (*ebpf.P
 			0,
 			0,
 			0,
+			0xEFCDAB8967452301, // connId = 0x0123456789abcdef
 		}
 	case constants.MSG_TYPE_IPV6:
 		msgData = []uint64{
@@ -2050,6 +2710,7 @@ func genRingbuf(t *testing.T, msgType uint32, msgSize int, flags int32) (*ebpf.P
 			0xFD80000000000002,
 			0,
 			0xFD800000C26C1F90, // dstIP = fd80::2, srcPort = 27842, dstPort = 8080
+			0xEFCDAB8967452301, // connId = 0x0123456789abcdef
 		}
 	default:
 		t.Fatal("Invalid msgType")
@@ -2192,16 +2853,25 @@ func TestRbac_Run(t *testing.T) {
 	for _, tt := range tests {
 		ctx, cancelFunc := context.WithCancel(context.Background())
 		mapOfTuple, mapOfAuth := prepareMaps(t, tt.args.msgType)
+		var deniedSrc, deniedDst netip.AddrPort
+		var connId uint64
 		r := &Rbac{
 			policyStore:   policyStore,
 			workloadCache: workloadCache,
 			notifyFunc: func(mapOfAuth *ebpf.Map, msgType uint32, key []byte) error {
-				defer cancelFunc()
 				if err := xdpNotifyConnRst(mapOfAuth, msgType, key); err != nil {
 					return err
 				}
 				return nil
 			},
+			VerdictFunc: func(id uint64, src, dst netip.AddrPort, allowed bool, reason string) {
+				connId = id
+			},
+			// reported after the tuple was written into the map
+			DeniedFunc: func(src, dst netip.AddrPort) {
+				defer cancelFunc()
+				deniedSrc, deniedDst = src, dst
+			},
 		}
 
 		// Perform auth runner and wait for return
@@ -2219,9 +2889,95 @@ func TestRbac_Run(t *testing.T) {
 		if found != tt.wantFound {
 			t.Errorf("want %v, but got %v", tt.wantFound, found)
 		}
+		// the denied connection is reported with its ports
+		assert.Equal(t, uint16(0xC26C), deniedSrc.Port())
+		assert.Equal(t, uint16(8080), deniedDst.Port())
+		// the verdict is reported with the id of the connection
+		assert.Equal(t, uint64(0x0123456789abcdef), connId)
 
 		// Close maps
 		mapOfTuple.Close()
 		mapOfAuth.Close()
 	}
 }
+
+func TestRbac_UpdatePolicies(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{192, 168, 122, 2}},
+	})
+	src := netip.MustParseAddr("192.168.122.3")
+	dst := netip.MustParseAddr("192.168.122.2")
+	portPolicy := func(name string, action security.Action, port uint32) *security.Authorization {
+		return &security.Authorization{
+			Name:      name,
+			Namespace: "default",
+			Scope:     security.Scope_NAMESPACE,
+			Action:    action,
+			Rules: []*security.Rule{{
+				Clauses: []*security.Clause{{
+					Matches: []*security.Match{{DestinationPorts: []uint32{port}}},
+				}},
+			}},
+		}
+	}
+	rbac := NewRbac(workloadCache)
+	// the old generation denies port 7000 and allows the others
+	require.NoError(t, rbac.UpdatePolicy(portPolicy("deny-7000", security.Action_DENY, 7000)))
+
+	// the new generation allows the ports 8000 to 8049 only, so port 7000 is still denied and those ports
+	// still allowed. Applied one policy after another, the ports not yet allowed would be denied, or port
+	// 7000 allowed, in between.
+	var updated []*security.Authorization
+	for i := uint32(0); i < 50; i++ {
+		updated = append(updated, portPolicy(fmt.Sprintf("allow-%d", 8000+i), security.Action_ALLOW, 8000+i))
+	}
+	removed := []string{"default/deny-7000"}
+
+	var (
+		wg         sync.WaitGroup
+		stop       atomic.Bool
+		unexpected atomic.Int32
+		authorized atomic.Int32
+	)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint32(0); !stop.Load(); i = (i + 1) % 50 {
+				if !rbac.Explain(src, dst, 8000+i).Allowed {
+					unexpected.Add(1)
+				}
+				if rbac.Explain(src, dst, 7000).Allowed {
+					unexpected.Add(1)
+				}
+				authorized.Add(2)
+			}
+		}()
+	}
+	// let the traffic run before and after the swap
+	for authorized.Load() < 1000 {
+		runtime.Gosched()
+	}
+	require.NoError(t, rbac.UpdatePolicies(updated, removed))
+	for start := authorized.Load(); authorized.Load() < start+1000; {
+		runtime.Gosched()
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	assert.Zero(t, unexpected.Load(), "connections allowed or denied by neither generation")
+	assert.Len(t, rbac.GetAllPolicies(), 50)
+	assert.False(t, rbac.Explain(src, dst, 9000).Allowed)
+
+	// an invalid policy in the bulk leaves the policies as they are
+	invalid := portPolicy("allow-9000", security.Action_ALLOW, 9000)
+	invalid.Scope = security.Scope(100)
+	assert.Error(t, rbac.UpdatePolicies([]*security.Authorization{portPolicy("allow-9001", security.Action_ALLOW, 9001), invalid},
+		[]string{"default/allow-8000"}))
+	assert.Len(t, rbac.GetAllPolicies(), 50)
+	assert.True(t, rbac.Explain(src, dst, 8000).Allowed)
+	assert.False(t, rbac.Explain(src, dst, 9001).Allowed)
+}
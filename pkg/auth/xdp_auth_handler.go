@@ -17,6 +17,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/cilium/ebpf"
@@ -24,20 +25,48 @@ import (
 	"kmesh.net/kmesh/pkg/constants"
 )
 
+// auth results of map_of_auth_result, as AUTH_* of the xdp program
+const (
+	authResultDeny   = uint32(1)
+	authResultQueued = uint32(2)
+)
+
 type notifyFunc func(mapOfAuth *ebpf.Map, msgType uint32, key []byte) error
 
+// queueFunc holds the packets of the connection with the tuple key until it is dequeued
+type queueFunc func(mapOfAuth *ebpf.Map, msgType uint32, key []byte, queued bool) error
+
 func xdpNotifyConnRst(mapOfAuth *ebpf.Map, msgType uint32, key []byte) error {
 	if mapOfAuth == nil {
 		return fmt.Errorf("map_of_auth_result is nil")
 	}
-	// The last TUPLE_LEN-IPV4_TUPLE_LENGTH bytes should be filled with zeros if msgType is
-	// MSG_TYPE_IPV4, so the key can be looked up successfully by XDP eBPF program
+	authMapKey(msgType, key)
+	// Insert the socket tuple into the auth map, so xdp_auth_handler can know that socket with
+	// this tuple is denied by policy, note that IP and port are big endian in auth map
+	return mapOfAuth.Update(key, authResultDeny, ebpf.UpdateAny)
+}
+
+func xdpNotifyConnQueue(mapOfAuth *ebpf.Map, msgType uint32, key []byte, queued bool) error {
+	if mapOfAuth == nil {
+		return fmt.Errorf("map_of_auth_result is nil")
+	}
+	authMapKey(msgType, key)
+	if queued {
+		return mapOfAuth.Update(key, authResultQueued, ebpf.UpdateAny)
+	}
+	// the connection may have closed and its tuple been removed meanwhile
+	if err := mapOfAuth.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return err
+	}
+	return nil
+}
+
+// authMapKey fills the last TUPLE_LEN-IPV4_TUPLE_LENGTH bytes of the key with zeros if msgType is
+// MSG_TYPE_IPV4, so the key can be looked up successfully by XDP eBPF program
+func authMapKey(msgType uint32, key []byte) {
 	if msgType == constants.MSG_TYPE_IPV4 {
 		for i := IPV4_TUPLE_LENGTH; i < len(key); i++ {
 			key[i] = 0
 		}
 	}
-	// Insert the socket tuple into the auth map, so xdp_auth_handler can know that socket with
-	// this tuple is denied by policy, note that IP and port are big endian in auth map
-	return mapOfAuth.Update(key, uint32(1), ebpf.UpdateAny)
 }
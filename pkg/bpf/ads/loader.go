@@ -23,7 +23,6 @@ package ads
 // #include "deserialization_to_bpf_map.h"
 import "C"
 import (
-	"errors"
 	"fmt"
 
 	"github.com/cilium/ebpf"
@@ -103,13 +102,9 @@ func NewBpfAds(cfg *options.BpfConfig) (*BpfAds, error) {
 }
 
 func (sc *BpfAds) Start() error {
-	var ve *ebpf.VerifierError
-
+	// the verifier errors are wrapped, the daemon reports them with the end of the verifier log
 	if err := sc.Load(); err != nil {
-		if errors.As(err, &ve) {
-			return fmt.Errorf("bpf load failed: %+v", ve)
-		}
-		return fmt.Errorf("bpf load failed: %v", err)
+		return fmt.Errorf("bpf load failed: %w", err)
 	}
 
 	if err := sc.Attach(); err != nil {
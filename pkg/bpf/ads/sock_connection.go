@@ -77,6 +77,12 @@ func (sc *BpfSockConn) loadKmeshSockConnObjects() (*ebpf.CollectionSpec, error)
 	}
 
 	utils.SetMapPinType(spec, ebpf.PinByName)
+	if err = utils.SetEventMechanism(spec, utils.EventMechanism()); err != nil {
+		return nil, err
+	}
+	if err = utils.UnpinIncompatibleMaps(spec, opts.Maps.PinPath); err != nil {
+		return nil, err
+	}
 	if err = spec.LoadAndAssign(&sc.KmeshCgroupSockObjects, &opts); err != nil {
 		return nil, err
 	}
@@ -140,7 +146,7 @@ func (sc *BpfSockConn) Attach() error {
 	}
 
 	progPinPath := filepath.Join(sc.Info.BpfFsPath, constants.Prog_link)
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		if sc.Link, err = utils.BpfProgUpdate(progPinPath, cgopt); err != nil {
 			return err
 		}
@@ -65,6 +65,12 @@ func (sc *BpfSockOps) loadKmeshSockopsObjects() (*ebpf.CollectionSpec, error) {
 	}
 
 	utils.SetMapPinType(spec, ebpf.PinByName)
+	if err = utils.SetEventMechanism(spec, utils.EventMechanism()); err != nil {
+		return nil, err
+	}
+	if err = utils.UnpinIncompatibleMaps(spec, opts.Maps.PinPath); err != nil {
+		return nil, err
+	}
 	if err = spec.LoadAndAssign(&sc.KmeshSockopsObjects, &opts); err != nil {
 		return nil, err
 	}
@@ -95,7 +101,7 @@ func (sc *BpfSockOps) Attach() error {
 
 	// pin bpf_link
 	progPinPath := filepath.Join(sc.Info.BpfFsPath, constants.Prog_link)
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		if sc.Link, err = utils.BpfProgUpdate(progPinPath, cgopt); err != nil {
 			return err
 		}
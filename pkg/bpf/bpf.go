@@ -58,13 +58,19 @@ type BpfLoader struct {
 	obj         *ads.BpfAds
 	workloadObj *workload.BpfWorkload
 	versionMap  *ebpf.Map
+
+	authzOffload     *heldSetting
+	enableMonitoring *heldSetting
 }
 
 func NewBpfLoader(config *options.BpfConfig) *BpfLoader {
-	return &BpfLoader{
+	l := &BpfLoader{
 		config:     config,
 		versionMap: NewVersionMap(config),
 	}
+	l.authzOffload = newHeldSetting("authz offload", constants.DISABLED, l.setAuthzOffload, l.getAuthzOffload)
+	l.enableMonitoring = newHeldSetting("monitoring", constants.ENABLED, l.setEnableMonitoring, l.getEnableMonitoring)
+	return l
 }
 
 func StartMda() error {
@@ -95,6 +101,8 @@ func (l *BpfLoader) Start() error {
 		if err = l.workloadObj.Start(); err != nil {
 			return err
 		}
+		l.authzOffload.load()
+		l.enableMonitoring.load()
 		// TODO: set bpf prog option in kernel native node
 		l.setBpfProgOptions()
 	}
@@ -106,7 +114,7 @@ func (l *BpfLoader) Start() error {
 		}
 	}
 
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		log.Infof("bpf load from last pinPath")
 	}
 	return nil
@@ -194,8 +202,10 @@ func NewVersionMap(config *options.BpfConfig) *ebpf.Map {
 	case restart.Restart:
 		return versionMap
 	case restart.Update:
-		// TODO : update mode has not been fully developed and is currently consistent with normal mode
-		log.Warnf("Update mode support is under development, Will be started in Normal mode.")
+		// keep the maps and links pinned by the previous version, the new progs are loaded with
+		// the maps and swapped into the links. Only the maps whose layout changed are created anew.
+		storeVersionInfo(versionMap)
+		return versionMap
 	default:
 	}
 
@@ -289,8 +299,8 @@ func (l *BpfLoader) setBpfProgOptions() {
 	nodeIP := getNodeIPAddress(node)
 	gateway := getNodePodSubGateway(node)
 
-	// Kmesh reboot updates only the nodeIP and pod sub gateway
-	if restart.GetStartType() == restart.Normal {
+	// Kmesh reboot updates only the nodeIP and pod sub gateway, the progs of an update start with them unset
+	if restart.GetStartType() != restart.Restart {
 		if err := l.UpdateNodeIP(nodeIP); err != nil {
 			log.Error("set NodeIP failed ", err)
 			return
@@ -463,7 +473,24 @@ func (l *BpfLoader) GetPodGateway() [16]byte {
 	return podGateway
 }
 
+// UpdateAuthzOffload sets the authz offload of the node, it takes effect once no suspension is held
 func (l *BpfLoader) UpdateAuthzOffload(authzOffload uint32) error {
+	return l.authzOffload.update(authzOffload)
+}
+
+// GetAuthzOffload returns the authz offload set for the node, the xdp authz is disabled meanwhile if a
+// suspension is held
+func (l *BpfLoader) GetAuthzOffload() uint32 {
+	return l.authzOffload.requestedValue()
+}
+
+// SuspendAuthzOffload authorizes all the connections in userspace until resume is called. The suspensions
+// are counted, the authz offload set for the node is restored once all of them are resumed.
+func (l *BpfLoader) SuspendAuthzOffload() (resume func() error, err error) {
+	return l.authzOffload.hold()
+}
+
+func (l *BpfLoader) setAuthzOffload(authzOffload uint32) error {
 	if l.workloadObj != nil {
 		if err := l.workloadObj.XdpAuth.AuthzOffload.Set(authzOffload); err != nil {
 			return fmt.Errorf("set AuthzOffload failed %w", err)
@@ -473,7 +500,7 @@ func (l *BpfLoader) UpdateAuthzOffload(authzOffload uint32) error {
 	return nil
 }
 
-func (l *BpfLoader) GetAuthzOffload() uint32 {
+func (l *BpfLoader) getAuthzOffload() uint32 {
 	var authzOffload uint32
 	if l.workloadObj != nil {
 		if err := l.workloadObj.XdpAuth.AuthzOffload.Get(&authzOffload); err != nil {
@@ -483,7 +510,24 @@ func (l *BpfLoader) GetAuthzOffload() uint32 {
 	return authzOffload
 }
 
+// UpdateEnableMonitoring sets the monitoring of the node, it takes effect once no hold is taken
 func (l *BpfLoader) UpdateEnableMonitoring(enableMonitoring uint32) error {
+	return l.enableMonitoring.update(enableMonitoring)
+}
+
+// GetEnableMonitoring returns the monitoring set for the node, the monitoring is enabled meanwhile if a
+// hold is taken
+func (l *BpfLoader) GetEnableMonitoring() uint32 {
+	return l.enableMonitoring.requestedValue()
+}
+
+// HoldMonitoring reports the connections to userspace until release is called. The holds are counted,
+// the monitoring set for the node is restored once all of them are released.
+func (l *BpfLoader) HoldMonitoring() (release func() error, err error) {
+	return l.enableMonitoring.hold()
+}
+
+func (l *BpfLoader) setEnableMonitoring(enableMonitoring uint32) error {
 	if l.workloadObj != nil {
 		if err := l.workloadObj.CgroupSkb.EnableMonitoring.Set(enableMonitoring); err != nil {
 			return fmt.Errorf("set CgroupSkb EnableMonitoring failed %w", err)
@@ -496,7 +540,7 @@ func (l *BpfLoader) UpdateEnableMonitoring(enableMonitoring uint32) error {
 	return nil
 }
 
-func (l *BpfLoader) GetEnableMonitoring() uint32 {
+func (l *BpfLoader) getEnableMonitoring() uint32 {
 	var enableMonitoring uint32
 	if l.workloadObj != nil {
 		if err := l.workloadObj.CgroupSkb.EnableMonitoring.Get(&enableMonitoring); err != nil {
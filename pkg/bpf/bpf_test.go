@@ -23,8 +23,10 @@ import (
 	"syscall"
 	"testing"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/rlimit"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 
 	"kmesh.net/kmesh/daemon/options"
@@ -67,6 +69,9 @@ func TestRestart(t *testing.T) {
 	t.Run("restart KernelNative", func(t *testing.T) {
 		runTestRestartKernelNative(t)
 	})
+	t.Run("update DualEngine", func(t *testing.T) {
+		runTestUpdateDualEngine(t)
+	})
 }
 
 func setDir() (err error) {
@@ -181,6 +186,55 @@ func runTestRestartKernelNative(t *testing.T) {
 	KmeshRestart(t, config)
 }
 
+// Test Kmesh Update DualEngine, the maps keep their entries across the upgrade of the progs
+func runTestUpdateDualEngine(t *testing.T) {
+	config := setDirDualEngine(t)
+	mapPath := filepath.Join(config.BpfFsPath, constants.KmDualEngineBpfPath, "map")
+
+	restart.SetStartType(restart.Normal)
+	bpfLoader := NewBpfLoader(&config)
+	if err := bpfLoader.Start(); err != nil {
+		assert.ErrorIsf(t, err, nil, "bpfLoader start failed %v", err)
+	}
+	frontend := bpfLoader.GetBpfWorkload().SockConn.KmFrontend
+	key := make([]byte, frontend.KeySize())
+	key[0] = 1
+	value := make([]byte, frontend.ValueSize())
+	value[0] = 2
+	require.NoError(t, frontend.Put(key, value))
+	serviceValueSize := bpfLoader.GetBpfWorkload().SockConn.KmService.ValueSize()
+	restart.SetExitType(restart.Restart)
+	bpfLoader.Stop()
+
+	// the daemon of another version upgrades the progs
+	versionMap, err := ebpf.LoadPinnedMap(filepath.Join(config.BpfFsPath, constants.WorkloadVersionPath, "kmesh_version"), nil)
+	require.NoError(t, err)
+	require.NoError(t, versionMap.Put(uint32(0), uint32(1)))
+	versionMap.Close()
+
+	// and changed the layout of km_service
+	service, err := ebpf.LoadPinnedMap(filepath.Join(mapPath, "km_service"), nil)
+	require.NoError(t, err)
+	require.NoError(t, service.Unpin())
+	service.Close()
+	service, err = ebpf.NewMap(&ebpf.MapSpec{Name: "km_service", Type: ebpf.Hash, KeySize: 4, ValueSize: 4, MaxEntries: 1})
+	require.NoError(t, err)
+	require.NoError(t, service.Pin(filepath.Join(mapPath, "km_service")))
+	service.Close()
+
+	bpfLoader = NewBpfLoader(&config)
+	if err := bpfLoader.Start(); err != nil {
+		assert.ErrorIsf(t, err, nil, "bpfLoader start failed %v", err)
+	}
+	assert.Equal(t, restart.Update, restart.GetStartType(), "set kmesh start status:Update failed")
+	got := make([]byte, len(value))
+	assert.NoError(t, bpfLoader.GetBpfWorkload().SockConn.KmFrontend.Lookup(key, &got))
+	assert.Equal(t, value, got)
+	assert.Equal(t, serviceValueSize, bpfLoader.GetBpfWorkload().SockConn.KmService.ValueSize())
+	restart.SetExitType(restart.Normal)
+	bpfLoader.Stop()
+}
+
 func TestGetNodePodSubGateway(t *testing.T) {
 	type args struct {
 		node *corev1.Node
@@ -22,6 +22,10 @@ type BpfInfo struct {
 	MapPath     string
 	BpfFsPath   string
 	Cgroup2Path string
+	// MaxConntrackEntries sizes the conntrack map of the dual-engine programs, 0 keeps the size they declare
+	MaxConntrackEntries uint32
+	// RedirectPorts are the destination ports the connect programs redirect, empty redirects all of them
+	RedirectPorts []uint16
 
 	Type       ebpf.ProgramType
 	AttachType ebpf.AttachType
@@ -105,6 +105,18 @@ func (tc *BpfTCGeneral) loadKmeshTCObjects() (*ebpf.CollectionSpec, *ebpf.Collec
 
 	utils.SetMapPinType(specTcMarkEncrypt, ebpf.PinByName)
 	utils.SetMapPinType(specTcMarkDecrypt, ebpf.PinByName)
+	if err := utils.SetEventMechanism(specTcMarkEncrypt, utils.EventMechanism()); err != nil {
+		return nil, nil, err
+	}
+	if err := utils.SetEventMechanism(specTcMarkDecrypt, utils.EventMechanism()); err != nil {
+		return nil, nil, err
+	}
+	if err := utils.UnpinIncompatibleMaps(specTcMarkEncrypt, optsTcMarkEncrypt.Maps.PinPath); err != nil {
+		return nil, nil, err
+	}
+	if err := utils.UnpinIncompatibleMaps(specTcMarkDecrypt, optsTcMarkDecrypt.Maps.PinPath); err != nil {
+		return nil, nil, err
+	}
 	if err := specTcMarkEncrypt.LoadAndAssign(&tc.KmeshTcMarkEncryptObjects, &optsTcMarkEncrypt); err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,101 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpf
+
+import (
+	"fmt"
+	"sync"
+)
+
+// heldSetting owns a bpf prog setting which the daemon needs to force to a given value for a while, e.g. the
+// xdp authz offload is disabled while the connections are authorized in userspace and the monitoring is enabled
+// while the connections are traced. The setting requested by the config or the admin api is kept apart from the
+// holds: while any hold is taken the held value is written, and the setting requested is written back once the
+// last one is released.
+type heldSetting struct {
+	name  string
+	held  uint32
+	mutex sync.Mutex
+	set   func(uint32) error
+	get   func() uint32
+
+	requested uint32
+	holds     int
+}
+
+func newHeldSetting(name string, held uint32, set func(uint32) error, get func() uint32) *heldSetting {
+	return &heldSetting{name: name, held: held, set: set, get: get}
+}
+
+// load reads the setting from the bpf prog once it is loaded, it is kept by a restart
+func (h *heldSetting) load() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.requested = h.get()
+}
+
+// update requests the setting, it is written at once unless a hold is taken
+func (h *heldSetting) update(value uint32) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.holds == 0 {
+		if err := h.set(value); err != nil {
+			return err
+		}
+	}
+	h.requested = value
+	return nil
+}
+
+// requestedValue returns the setting requested, whether or not a hold is taken
+func (h *heldSetting) requestedValue() uint32 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.requested
+}
+
+// hold writes the held value until release is called, release can be called more than once
+func (h *heldSetting) hold() (func() error, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.holds == 0 && h.requested != h.held {
+		if err := h.set(h.held); err != nil {
+			return nil, fmt.Errorf("failed to hold %s: %w", h.name, err)
+		}
+	}
+	h.holds++
+
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() { err = h.release() })
+		return err
+	}, nil
+}
+
+func (h *heldSetting) release() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.holds--
+	if h.holds > 0 || h.requested == h.held {
+		return nil
+	}
+	if err := h.set(h.requested); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", h.name, err)
+	}
+	return nil
+}
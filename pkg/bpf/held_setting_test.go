@@ -0,0 +1,64 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bpf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+func TestHeldSetting(t *testing.T) {
+	value := constants.ENABLED
+	var writes []uint32
+	h := newHeldSetting("authz offload", constants.DISABLED, func(v uint32) error {
+		value = v
+		writes = append(writes, v)
+		return nil
+	}, func() uint32 { return value })
+	h.load()
+
+	// the holds are counted, the xdp authz is disabled by the first one only
+	release1, err := h.hold()
+	require.NoError(t, err)
+	release2, err := h.hold()
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{constants.DISABLED}, writes)
+	assert.Equal(t, constants.ENABLED, h.requestedValue())
+
+	// the setting requested meanwhile is written once all of them are released
+	require.NoError(t, h.update(constants.DISABLED))
+	require.NoError(t, h.update(constants.ENABLED))
+	require.NoError(t, release1())
+	require.NoError(t, release1())
+	assert.Equal(t, constants.DISABLED, value)
+	require.NoError(t, release2())
+	assert.Equal(t, constants.ENABLED, value)
+	assert.Equal(t, []uint32{constants.DISABLED, constants.ENABLED}, writes)
+
+	// nothing is written when the xdp authz is disabled already
+	require.NoError(t, h.update(constants.DISABLED))
+	writes = nil
+	release, err := h.hold()
+	require.NoError(t, err)
+	require.NoError(t, release())
+	assert.Empty(t, writes)
+	assert.Equal(t, constants.DISABLED, h.requestedValue())
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package preflight probes whether the kernel of a node provides the features
+// kmesh relies on, before or without running the daemon.
+package preflight
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+
+	"kmesh.net/kmesh/pkg/utils"
+)
+
+const (
+	minKernelMajor = 5
+	minKernelMinor = 10
+
+	privilegesHint = "run the check as root, probing bpf features requires CAP_BPF and CAP_SYS_ADMIN"
+)
+
+// Prober abstracts the kernel, so that the checks can be exercised without one.
+type Prober interface {
+	// KernelVersion returns the release of the kernel like 5.15.153.1-xxxx
+	KernelVersion() string
+	// HaveProgramType returns nil if the kernel supports the program type,
+	// an error wrapping ebpf.ErrNotSupported if it does not.
+	HaveProgramType(pt ebpf.ProgramType) error
+	// HaveMapType returns nil if the kernel supports the map type,
+	// an error wrapping ebpf.ErrNotSupported if it does not.
+	HaveMapType(mt ebpf.MapType) error
+	// Filesystems returns the filesystems supported by the kernel.
+	Filesystems() ([]string, error)
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+	// Remediation tells how to fix a failed check
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type Report struct {
+	Passed bool          `json:"passed"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Failed returns the number of failed checks.
+func (r *Report) Failed() int {
+	failed := 0
+	for _, c := range r.Checks {
+		if !c.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+var programTypes = []struct {
+	name        string
+	programType ebpf.ProgramType
+	remediation string
+}{
+	{"cgroup/sock_addr", ebpf.CGroupSockAddr, "enable CONFIG_CGROUP_BPF in the kernel, it is needed to redirect the connections"},
+	{"sockops", ebpf.SockOps, "enable CONFIG_CGROUP_BPF in the kernel, it is needed to observe the connections"},
+	{"cgroup_skb", ebpf.CGroupSKB, "enable CONFIG_CGROUP_BPF in the kernel, it is needed by dual-engine mode"},
+	{"xdp", ebpf.XDP, "enable CONFIG_BPF_SYSCALL in the kernel, xdp is needed by the authorization of dual-engine mode"},
+}
+
+var mapTypes = []struct {
+	name        string
+	mapType     ebpf.MapType
+	remediation string
+	// fallback tells how kmesh does without the map type, the check passes when it is not supported
+	fallback string
+}{
+	{"ringbuf", ebpf.RingBuf, "upgrade the kernel to 5.8 or later", "the events are streamed through perf buffers instead"},
+	{"lpm_trie", ebpf.LPMTrie, "upgrade the kernel to 4.11 or later", ""},
+}
+
+// Run probes the kernel version, the bpf program and map types kmesh loads and cgroup v2.
+func Run(prober Prober) *Report {
+	report := &Report{Passed: true}
+	record := func(check CheckResult) {
+		if !check.Passed {
+			report.Passed = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	record(checkKernelVersion(prober.KernelVersion()))
+	for _, pt := range programTypes {
+		record(checkFeature("bpf program "+pt.name, prober.HaveProgramType(pt.programType), pt.remediation))
+	}
+	for _, mt := range mapTypes {
+		check := checkFeature("bpf map "+mt.name, prober.HaveMapType(mt.mapType), mt.remediation)
+		if mt.fallback != "" && check.Remediation == mt.remediation {
+			check = CheckResult{Name: check.Name, Passed: true, Message: check.Message + ", " + mt.fallback}
+		}
+		record(check)
+	}
+	record(checkCgroup2(prober.Filesystems()))
+	return report
+}
+
+func checkKernelVersion(release string) CheckResult {
+	check := CheckResult{Name: "kernel version", Message: release}
+	if release == "" {
+		check.Message = "failed to read the kernel release"
+		return check
+	}
+	major, minor, ok := parseKernelRelease(release)
+	if !ok {
+		check.Message = fmt.Sprintf("unrecognized kernel release %s", release)
+		return check
+	}
+	if major < minKernelMajor || (major == minKernelMajor && minor < minKernelMinor) {
+		check.Message = fmt.Sprintf("%s is older than %d.%d", release, minKernelMajor, minKernelMinor)
+		check.Remediation = fmt.Sprintf("upgrade the kernel to %d.%d or later", minKernelMajor, minKernelMinor)
+		return check
+	}
+	check.Passed = true
+	return check
+}
+
+// parseKernelRelease returns the major and minor versions of a release like 5.10.0-153.12.0.92.oe2203sp2
+// or 6.9-rc1, the minor is followed by the patch level or a suffix
+func parseKernelRelease(release string) (int, int, bool) {
+	majorStr, rest, ok := strings.Cut(release, ".")
+	if !ok {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(majorStr)
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(rest[:len(rest)-len(strings.TrimLeft(rest, "0123456789"))])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+func checkFeature(name string, err error, remediation string) CheckResult {
+	check := CheckResult{Name: name, Passed: err == nil}
+	switch {
+	case err == nil:
+		check.Message = "supported"
+	case errors.Is(err, ebpf.ErrNotSupported):
+		check.Message = "not supported by the kernel"
+		check.Remediation = remediation
+	default:
+		check.Message = fmt.Sprintf("probe failed: %v", err)
+		check.Remediation = privilegesHint
+	}
+	return check
+}
+
+func checkCgroup2(filesystems []string, err error) CheckResult {
+	check := CheckResult{Name: "cgroup v2"}
+	if err != nil {
+		check.Message = fmt.Sprintf("failed to read the filesystems: %v", err)
+		return check
+	}
+	for _, fs := range filesystems {
+		if fs == "cgroup2" {
+			check.Passed = true
+			check.Message = "supported"
+			return check
+		}
+	}
+	check.Message = "the cgroup2 filesystem is not supported by the kernel"
+	check.Remediation = "enable CONFIG_CGROUPS in the kernel, kmesh attaches its programs to the cgroup v2 mount at --cgroup-path"
+	return check
+}
+
+type hostProber struct{}
+
+// NewHostProber returns a Prober of the kernel the process runs on.
+func NewHostProber() Prober {
+	return hostProber{}
+}
+
+func (hostProber) KernelVersion() string {
+	return utils.GetKernelVersion()
+}
+
+func (hostProber) HaveProgramType(pt ebpf.ProgramType) error {
+	return features.HaveProgramType(pt)
+}
+
+func (hostProber) HaveMapType(mt ebpf.MapType) error {
+	return features.HaveMapType(mt)
+}
+
+func (hostProber) Filesystems() ([]string, error) {
+	f, err := os.Open("/proc/filesystems")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// lines are like "nodev	cgroup2"
+	var filesystems []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			filesystems = append(filesystems, fields[len(fields)-1])
+		}
+	}
+	return filesystems, scanner.Err()
+}
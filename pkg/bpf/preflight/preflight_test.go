@@ -0,0 +1,140 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package preflight
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProber struct {
+	release      string
+	programTypes map[ebpf.ProgramType]error
+	mapTypes     map[ebpf.MapType]error
+	filesystems  []string
+}
+
+func (p *fakeProber) KernelVersion() string {
+	return p.release
+}
+
+func (p *fakeProber) HaveProgramType(pt ebpf.ProgramType) error {
+	return p.programTypes[pt]
+}
+
+func (p *fakeProber) HaveMapType(mt ebpf.MapType) error {
+	return p.mapTypes[mt]
+}
+
+func (p *fakeProber) Filesystems() ([]string, error) {
+	return p.filesystems, nil
+}
+
+func TestRun(t *testing.T) {
+	notSupported := fmt.Errorf("%w", ebpf.ErrNotSupported)
+	tests := []struct {
+		name       string
+		prober     *fakeProber
+		wantPassed bool
+		// wantFailed maps the failed checks to their remediation
+		wantFailed map[string]string
+	}{
+		{
+			name:       "all checks pass",
+			prober:     &fakeProber{release: "5.10.0-153.12.0.92.oe2203sp2.x86_64", filesystems: []string{"ext4", "cgroup2"}},
+			wantPassed: true,
+		},
+		{
+			name:   "old kernel without ringbuf",
+			prober: &fakeProber{release: "4.19.90-2102", mapTypes: map[ebpf.MapType]error{ebpf.RingBuf: notSupported}, filesystems: []string{"cgroup2"}},
+			// the events are streamed through perf buffers
+			wantFailed: map[string]string{
+				"kernel version": "upgrade the kernel to 5.10 or later",
+			},
+		},
+		{
+			name: "probes not permitted",
+			prober: &fakeProber{release: "6.9-rc1", programTypes: map[ebpf.ProgramType]error{ebpf.XDP: syscall.EPERM},
+				filesystems: []string{"cgroup2"}},
+			wantFailed: map[string]string{"bpf program xdp": privilegesHint},
+		},
+		{
+			name:   "no cgroup v2",
+			prober: &fakeProber{release: "5.15.0", filesystems: []string{"cgroup"}},
+			wantFailed: map[string]string{
+				"cgroup v2": "enable CONFIG_CGROUPS in the kernel, kmesh attaches its programs to the cgroup v2 mount at --cgroup-path",
+			},
+		},
+		{
+			name:       "unrecognized release",
+			prober:     &fakeProber{release: "custom", filesystems: []string{"cgroup2"}},
+			wantFailed: map[string]string{"kernel version": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Run(tt.prober)
+			assert.Equal(t, tt.wantPassed, report.Passed)
+			assert.Len(t, report.Checks, 1+len(programTypes)+len(mapTypes)+1)
+			failed := map[string]string{}
+			for _, c := range report.Checks {
+				if !c.Passed {
+					failed[c.Name] = c.Remediation
+				}
+			}
+			if len(tt.wantFailed) == 0 {
+				assert.Empty(t, failed)
+			} else {
+				assert.Equal(t, tt.wantFailed, failed)
+			}
+			assert.Equal(t, len(failed), report.Failed())
+		})
+	}
+}
+
+func TestParseKernelRelease(t *testing.T) {
+	for release, want := range map[string][2]int{
+		"5.10.0-153.12.0.92.oe2203sp2.x86_64": {5, 10},
+		"6.9-rc1":                             {6, 9},
+		"6.18.44-fc-v130":                     {6, 18},
+	} {
+		major, minor, ok := parseKernelRelease(release)
+		assert.True(t, ok, release)
+		assert.Equal(t, want, [2]int{major, minor}, release)
+	}
+	_, _, ok := parseKernelRelease("custom")
+	assert.False(t, ok)
+}
+
+func TestRunRingbufFallback(t *testing.T) {
+	notSupported := fmt.Errorf("%w", ebpf.ErrNotSupported)
+	report := Run(&fakeProber{release: "5.10.0", mapTypes: map[ebpf.MapType]error{ebpf.RingBuf: notSupported}, filesystems: []string{"cgroup2"}})
+	assert.True(t, report.Passed)
+	assert.Contains(t, report.Checks, CheckResult{
+		Name:    "bpf map ringbuf",
+		Passed:  true,
+		Message: "not supported by the kernel, the events are streamed through perf buffers instead",
+	})
+
+	// a failed probe is not mistaken for a missing map type
+	report = Run(&fakeProber{release: "5.10.0", mapTypes: map[ebpf.MapType]error{ebpf.RingBuf: syscall.EPERM}, filesystems: []string{"cgroup2"}})
+	assert.False(t, report.Passed)
+}
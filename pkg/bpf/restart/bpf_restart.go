@@ -38,7 +38,8 @@ var log = logger.NewLoggerScope("restart")
  * Start Kmesh:
  *		Normal: a normal new start
  *		Restart: reusing the previous kmesh configuration
- *		Update: upgrading kmesh and reusing part of previous kmesh configuration
+ *		Update: upgrading kmesh, the new bpf progs reuse the maps of the previous version and
+ *			replace its progs in the links they are attached by, so only the prog code changes
  * Exit Kmesh:
  *		Normal: normal close, cleanup all the bpf prog and maps
  *		Restart: not clean kmesh configuration and bpf map, for next launch
@@ -67,6 +68,12 @@ func SetStartType(Status StartType) {
 	kmeshStartType = Status
 }
 
+// ReusePinned reports whether the bpf maps and links pinned by the previous kmesh are reused,
+// which is the case on a Restart and on an Update
+func ReusePinned() bool {
+	return kmeshStartType == Restart || kmeshStartType == Update
+}
+
 func SetExitType(status StartType) {
 	kmeshExitType = status
 }
@@ -0,0 +1,344 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package selftest verifies at startup that the kmesh bpf programs are
+// attached, that they pass the connections of the daemon intact, and in the
+// dual-engine mode that the xdp authz program drops or resets the packets of
+// a denied connection. The result is reported by the readiness probe.
+package selftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/logger"
+)
+
+const (
+	// BPF_F_QUERY_EFFECTIVE, also report programs inherited from ancestor cgroups
+	queryEffective = 1
+
+	probeTimeout = 3 * time.Second
+	probePayload = "kmesh-self-test"
+
+	// the xdp actions, from the uapi
+	xdpDrop = 1
+	xdpPass = 2
+)
+
+var log = logger.NewLoggerScope("selftest")
+
+var (
+	resultMutex sync.RWMutex
+	lastResult  *Result
+)
+
+// AuthzVerdict is what the xdp authz program did to a packet
+type AuthzVerdict struct {
+	Dropped bool
+	// Reset is the packet passed with its RST flag set, the verdict when the authz runs in userspace
+	Reset bool
+}
+
+// Prober abstracts the program attach layer and the loopback connection,
+// so that the self-test can be exercised without a kernel.
+type Prober interface {
+	// AttachedPrograms returns the number of programs of the given attach type
+	// that take effect on the kmesh cgroup.
+	AttachedPrograms(attach ebpf.AttachType) (int, error)
+	// Echo sends payload over a loopback TCP connection and returns what the
+	// peer received. The connection goes through the cgroup programs, which
+	// pass it as it is not to a managed address.
+	Echo(payload []byte) ([]byte, error)
+	// AuthzDeny runs the xdp authz program on a packet of a synthetic connection which the
+	// authz verdicts deny, and returns what it did to the packet.
+	AuthzDeny() (AuthzVerdict, error)
+}
+
+type CheckResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+type Result struct {
+	Passed bool          `json:"passed"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Err returns an error describing the first failed check, nil if all passed.
+func (r *Result) Err() error {
+	if r == nil || r.Passed {
+		return nil
+	}
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return fmt.Errorf("self-test check %s failed: %s", c.Name, c.Message)
+		}
+	}
+	return fmt.Errorf("self-test failed")
+}
+
+// expectedAttachTypes lists the cgroup attach points every mode relies on.
+func expectedAttachTypes(mode string) map[string]ebpf.AttachType {
+	switch mode {
+	case constants.KernelNativeMode:
+		return map[string]ebpf.AttachType{
+			"cgroup/connect4": ebpf.AttachCGroupInet4Connect,
+			"sockops":         ebpf.AttachCGroupSockOps,
+		}
+	case constants.DualEngineMode:
+		return map[string]ebpf.AttachType{
+			"cgroup/connect4":    ebpf.AttachCGroupInet4Connect,
+			"cgroup/connect6":    ebpf.AttachCGroupInet6Connect,
+			"sockops":            ebpf.AttachCGroupSockOps,
+			"cgroup_skb/ingress": ebpf.AttachCGroupInetIngress,
+			"cgroup_skb/egress":  ebpf.AttachCGroupInetEgress,
+		}
+	}
+	return nil
+}
+
+// Run checks that the programs of the given mode are attached, then sends a
+// loopback connection through them and confirms it is passed through intact.
+// In the dual-engine mode, it also checks the verdict of the xdp authz program
+// on a denied connection. The result is recorded and can be read with LastResult.
+func Run(mode string, prober Prober) *Result {
+	result := &Result{Passed: true}
+	record := func(name string, err error) {
+		check := CheckResult{Name: name, Passed: err == nil}
+		if err != nil {
+			check.Message = err.Error()
+			result.Passed = false
+		}
+		result.Checks = append(result.Checks, check)
+	}
+
+	attachTypes := expectedAttachTypes(mode)
+	if attachTypes == nil {
+		record("mode", fmt.Errorf("unsupported mode %q", mode))
+	}
+	// iterate in a stable order so the result is reproducible
+	for _, name := range []string{"cgroup/connect4", "cgroup/connect6", "sockops", "cgroup_skb/ingress", "cgroup_skb/egress"} {
+		attach, ok := attachTypes[name]
+		if !ok {
+			continue
+		}
+		count, err := prober.AttachedPrograms(attach)
+		if err == nil && count == 0 {
+			err = fmt.Errorf("no program attached")
+		}
+		record("attach "+name, err)
+	}
+
+	received, err := prober.Echo([]byte(probePayload))
+	if err == nil && !bytes.Equal(received, []byte(probePayload)) {
+		err = fmt.Errorf("unexpected payload %q, want %q", received, probePayload)
+	}
+	record("connection", err)
+
+	if mode == constants.DualEngineMode {
+		verdict, err := prober.AuthzDeny()
+		if err == nil && !verdict.Dropped && !verdict.Reset {
+			err = fmt.Errorf("the packet of a denied connection was passed")
+		}
+		record("authz verdict", err)
+	}
+
+	setResult(result)
+	return result
+}
+
+func setResult(r *Result) {
+	resultMutex.Lock()
+	defer resultMutex.Unlock()
+	lastResult = r
+}
+
+// LastResult returns the result of the last self-test, nil if it was never run.
+func LastResult() *Result {
+	resultMutex.RLock()
+	defer resultMutex.RUnlock()
+	return lastResult
+}
+
+type kernelProber struct {
+	cgroup2Path string
+	xdpAuthz    *ebpf.Program
+	authRes     *ebpf.Map
+}
+
+// NewKernelProber returns a Prober that queries the programs attached to the
+// given cgroup2 path, dials a loopback listener owned by the daemon, and runs
+// xdpAuthz on a packet of a connection it denies in authRes. xdpAuthz and
+// authRes are nil in the kernel-native mode, which has no xdp authz.
+func NewKernelProber(cgroup2Path string, xdpAuthz *ebpf.Program, authRes *ebpf.Map) Prober {
+	return &kernelProber{cgroup2Path: cgroup2Path, xdpAuthz: xdpAuthz, authRes: authRes}
+}
+
+func (p *kernelProber) AttachedPrograms(attach ebpf.AttachType) (int, error) {
+	f, err := os.Open(p.cgroup2Path)
+	if err != nil {
+		return 0, fmt.Errorf("open cgroup %s failed: %v", p.cgroup2Path, err)
+	}
+	defer f.Close()
+
+	res, err := link.QueryPrograms(link.QueryOptions{
+		Target:     int(f.Fd()),
+		Attach:     attach,
+		QueryFlags: queryEffective,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(res.Programs), nil
+}
+
+func (p *kernelProber) Echo(payload []byte) ([]byte, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(probeTimeout))
+		buf, _ := io.ReadAll(io.LimitReader(conn, int64(len(payload))))
+		received <- buf
+	}()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), probeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(probeTimeout))
+	if _, err := conn.Write(payload); err != nil {
+		return nil, fmt.Errorf("write failed: %v", err)
+	}
+
+	select {
+	case buf := <-received:
+		return buf, nil
+	case <-time.After(probeTimeout):
+		return nil, fmt.Errorf("timed out waiting for the payload")
+	}
+}
+
+// The synthetic connection denied by AuthzDeny is between documentation addresses, no workload uses them
+var (
+	denySrc = netip.MustParseAddr("192.0.2.1")
+	denyDst = netip.MustParseAddr("198.51.100.1")
+)
+
+const (
+	denySport = 40000
+	denyDport = 9
+	// the key of km_auth_res is a struct bpf_sock_tuple, the ipv4 tuple is padded to the size of the ipv6 one
+	authResKeyLen = 36
+	// the offset of the flags of the tcp header in the packet, after the ethernet and ipv4 headers
+	tcpFlagsOffset = 14 + 20 + 13
+	tcpFlagRst     = 0x04
+	tcpFlagAck     = 0x10
+)
+
+func (p *kernelProber) AuthzDeny() (AuthzVerdict, error) {
+	if p.xdpAuthz == nil || p.authRes == nil {
+		return AuthzVerdict{}, fmt.Errorf("xdp authz program not loaded")
+	}
+
+	// the verdict is stored as the daemon does for the connections it denies, then removed
+	key := make([]byte, authResKeyLen)
+	src, dst := denySrc.As4(), denyDst.As4()
+	copy(key[0:4], src[:])
+	copy(key[4:8], dst[:])
+	binary.BigEndian.PutUint16(key[8:10], denySport)
+	binary.BigEndian.PutUint16(key[10:12], denyDport)
+	if err := p.authRes.Update(key, uint32(1), ebpf.UpdateAny); err != nil {
+		return AuthzVerdict{}, fmt.Errorf("store the verdict failed: %v", err)
+	}
+	defer func() {
+		// the xdp program deletes it itself when it resets the connection
+		if err := p.authRes.Delete(key); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			log.Errorf("remove the verdict of the synthetic connection failed: %v", err)
+		}
+	}()
+
+	packet := denyPacket()
+	out := make([]byte, len(packet))
+	ret, err := p.xdpAuthz.Run(&ebpf.RunOptions{Data: packet, DataOut: out})
+	if err != nil {
+		return AuthzVerdict{}, fmt.Errorf("run the xdp authz program failed: %v", err)
+	}
+	return AuthzVerdict{
+		Dropped: ret == xdpDrop,
+		Reset:   ret == xdpPass && out[tcpFlagsOffset]&tcpFlagRst != 0,
+	}, nil
+}
+
+// denyPacket returns an ethernet frame of a tcp ack of the connection denied by AuthzDeny
+func denyPacket() []byte {
+	packet := make([]byte, 14+20+20)
+	// ethernet, the addresses are left zero
+	binary.BigEndian.PutUint16(packet[12:14], 0x0800)
+	// ipv4
+	ip := packet[14:34]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], 40)
+	ip[8] = 64
+	ip[9] = 6 // tcp
+	src, dst := denySrc.As4(), denyDst.As4()
+	copy(ip[12:16], src[:])
+	copy(ip[16:20], dst[:])
+	// tcp
+	tcp := packet[34:54]
+	binary.BigEndian.PutUint16(tcp[0:2], denySport)
+	binary.BigEndian.PutUint16(tcp[2:4], denyDport)
+	tcp[12] = 5 << 4
+	tcp[13] = tcpFlagAck
+	binary.BigEndian.PutUint16(tcp[14:16], 0xffff)
+	return packet
+}
+
+// Log prints every check of the result.
+func (r *Result) Log() {
+	for _, c := range r.Checks {
+		if c.Passed {
+			log.Infof("self-test %s: passed", c.Name)
+		} else {
+			log.Errorf("self-test %s: failed, %s", c.Name, c.Message)
+		}
+	}
+}
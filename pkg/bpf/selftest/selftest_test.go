@@ -0,0 +1,184 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package selftest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+type fakeProber struct {
+	attached  map[ebpf.AttachType]int
+	attachErr error
+	echo      func(payload []byte) ([]byte, error)
+	authz     func() (AuthzVerdict, error)
+}
+
+func (p *fakeProber) AttachedPrograms(attach ebpf.AttachType) (int, error) {
+	if p.attachErr != nil {
+		return 0, p.attachErr
+	}
+	return p.attached[attach], nil
+}
+
+func (p *fakeProber) Echo(payload []byte) ([]byte, error) {
+	return p.echo(payload)
+}
+
+func (p *fakeProber) AuthzDeny() (AuthzVerdict, error) {
+	if p.authz == nil {
+		return AuthzVerdict{}, fmt.Errorf("xdp authz program not loaded")
+	}
+	return p.authz()
+}
+
+func allAttached() map[ebpf.AttachType]int {
+	return map[ebpf.AttachType]int{
+		ebpf.AttachCGroupInet4Connect: 1,
+		ebpf.AttachCGroupInet6Connect: 1,
+		ebpf.AttachCGroupSockOps:      1,
+		ebpf.AttachCGroupInetIngress:  1,
+		ebpf.AttachCGroupInetEgress:   1,
+	}
+}
+
+func echoOK(payload []byte) ([]byte, error) {
+	return payload, nil
+}
+
+func authzDropped() (AuthzVerdict, error) {
+	return AuthzVerdict{Dropped: true}, nil
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		prober     *fakeProber
+		wantPassed bool
+		wantFailed string
+	}{
+		{
+			name:       "dual-engine all checks pass",
+			mode:       constants.DualEngineMode,
+			prober:     &fakeProber{attached: allAttached(), echo: echoOK, authz: authzDropped},
+			wantPassed: true,
+		},
+		{
+			name: "denied connection reset by the authz in userspace",
+			mode: constants.DualEngineMode,
+			prober: &fakeProber{attached: allAttached(), echo: echoOK, authz: func() (AuthzVerdict, error) {
+				return AuthzVerdict{Reset: true}, nil
+			}},
+			wantPassed: true,
+		},
+		{
+			name: "denied connection passed",
+			mode: constants.DualEngineMode,
+			prober: &fakeProber{attached: allAttached(), echo: echoOK, authz: func() (AuthzVerdict, error) {
+				return AuthzVerdict{}, nil
+			}},
+			wantPassed: false,
+			wantFailed: "authz verdict",
+		},
+		{
+			name:       "xdp authz program not loaded",
+			mode:       constants.DualEngineMode,
+			prober:     &fakeProber{attached: allAttached(), echo: echoOK},
+			wantPassed: false,
+			wantFailed: "authz verdict",
+		},
+		{
+			name: "kernel-native only needs connect4 and sockops",
+			mode: constants.KernelNativeMode,
+			prober: &fakeProber{attached: map[ebpf.AttachType]int{
+				ebpf.AttachCGroupInet4Connect: 1,
+				ebpf.AttachCGroupSockOps:      1,
+			}, echo: echoOK},
+			wantPassed: true,
+		},
+		{
+			name: "sockops not attached",
+			mode: constants.DualEngineMode,
+			prober: func() *fakeProber {
+				attached := allAttached()
+				delete(attached, ebpf.AttachCGroupSockOps)
+				return &fakeProber{attached: attached, echo: echoOK, authz: authzDropped}
+			}(),
+			wantPassed: false,
+			wantFailed: "attach sockops",
+		},
+		{
+			name:       "query programs not supported",
+			mode:       constants.DualEngineMode,
+			prober:     &fakeProber{attachErr: fmt.Errorf("not supported"), echo: echoOK, authz: authzDropped},
+			wantPassed: false,
+			wantFailed: "attach cgroup/connect4",
+		},
+		{
+			name: "synthetic connection refused",
+			mode: constants.DualEngineMode,
+			prober: &fakeProber{attached: allAttached(), authz: authzDropped, echo: func([]byte) ([]byte, error) {
+				return nil, fmt.Errorf("connection refused")
+			}},
+			wantPassed: false,
+			wantFailed: "connection",
+		},
+		{
+			name: "synthetic connection payload mangled",
+			mode: constants.DualEngineMode,
+			prober: &fakeProber{attached: allAttached(), authz: authzDropped, echo: func([]byte) ([]byte, error) {
+				return []byte("garbage"), nil
+			}},
+			wantPassed: false,
+			wantFailed: "connection",
+		},
+		{
+			name:       "unsupported mode",
+			mode:       "invalid",
+			prober:     &fakeProber{echo: echoOK},
+			wantPassed: false,
+			wantFailed: "mode",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Run(tt.mode, tt.prober)
+			assert.Equal(t, tt.wantPassed, result.Passed)
+			assert.Equal(t, result, LastResult())
+			if tt.wantPassed {
+				assert.NoError(t, result.Err())
+				return
+			}
+			assert.ErrorContains(t, result.Err(), tt.wantFailed)
+		})
+	}
+}
+
+func TestDenyPacket(t *testing.T) {
+	packet := denyPacket()
+	// the tuple parsed by the xdp program is the key AuthzDeny stores
+	assert.Equal(t, []byte{192, 0, 2, 1}, packet[26:30])
+	assert.Equal(t, []byte{198, 51, 100, 1}, packet[30:34])
+	assert.Equal(t, []byte{0x9c, 0x40, 0x00, 0x09}, packet[34:38])
+	assert.Equal(t, byte(tcpFlagAck), packet[tcpFlagsOffset])
+}
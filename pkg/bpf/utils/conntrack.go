@@ -0,0 +1,36 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"github.com/cilium/ebpf"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+// SetConntrackMaxEntries sizes the conntrack map of spec to maxEntries, 0 keeps the size the programs declare.
+// The pinned map of another size is incompatible, so it is created anew when the daemon restarts with another size.
+func SetConntrackMaxEntries(spec *ebpf.CollectionSpec, maxEntries uint32) {
+	if maxEntries == 0 {
+		return
+	}
+	for _, ms := range spec.Maps {
+		if ms.Name == constants.ConntrackMapName {
+			ms.MaxEntries = maxEntries
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+)
+
+const (
+	// EventRingbuf streams the events of the bpf programs to the daemon through ring buffers
+	EventRingbuf = "ringbuf"
+	// EventPerfBuffer streams them through perf buffers, on the kernels without ring buffers
+	EventPerfBuffer = "perf buffer"
+
+	// perfEventFallback is the global variable telling the bpf programs to output to perf event arrays
+	perfEventFallback = "perf_event_fallback"
+)
+
+// EventMechanism returns how the bpf programs stream their events on this kernel, probed once
+var EventMechanism = sync.OnceValue(func() string {
+	err := features.HaveMapType(ebpf.RingBuf)
+	if err == nil {
+		return EventRingbuf
+	}
+	if !errors.Is(err, ebpf.ErrNotSupported) {
+		log.Warnf("probe bpf ring buffers failed, assuming the kernel supports them: %v", err)
+		return EventRingbuf
+	}
+	log.Infof("the kernel does not support bpf ring buffers, the events are streamed through perf buffers")
+	return EventPerfBuffer
+})
+
+// SetEventMechanism prepares spec to stream its events by mechanism. With perf buffers, the maps declared as
+// ring buffers are created as perf event arrays, and the programs output their events with bpf_perf_event_output.
+func SetEventMechanism(spec *ebpf.CollectionSpec, mechanism string) error {
+	switch mechanism {
+	case EventRingbuf:
+		return nil
+	case EventPerfBuffer:
+	default:
+		return fmt.Errorf("unknown event mechanism %q", mechanism)
+	}
+
+	for _, ms := range spec.Maps {
+		if ms.Type != ebpf.RingBuf {
+			continue
+		}
+		// one entry per possible cpu, filled in when the map is created
+		ms.Type = ebpf.PerfEventArray
+		ms.KeySize = 4
+		ms.ValueSize = 4
+		ms.MaxEntries = 0
+	}
+	// the programs without events do not declare the variable
+	if v, ok := spec.Variables[perfEventFallback]; ok {
+		if err := v.Set(uint32(1)); err != nil {
+			return fmt.Errorf("set %s failed, %s", perfEventFallback, err)
+		}
+	}
+	return nil
+}
@@ -17,13 +17,20 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 
 	"github.com/cilium/ebpf"
+
+	"kmesh.net/kmesh/pkg/logger"
 )
 
+var log = logger.NewLoggerScope("bpf_utils")
+
 func PinPrograms(value *reflect.Value, path string) error {
 	for i := 0; i < value.NumField(); i++ {
 		tp, ok := value.Field(i).Interface().(*ebpf.Program)
@@ -80,3 +87,38 @@ func SetMapPinType(spec *ebpf.CollectionSpec, pinType ebpf.PinType) {
 		v.Pinning = pinType
 	}
 }
+
+// UnpinIncompatibleMaps removes the maps pinned under pinPath whose type, key, value or size differ
+// from their spec, so that loading the spec creates them anew. The other pinned maps are reused by the
+// programs loaded from the spec and keep their entries, which lets the programs be upgraded in place.
+func UnpinIncompatibleMaps(spec *ebpf.CollectionSpec, pinPath string) error {
+	for _, ms := range spec.Maps {
+		if ms.Pinning != ebpf.PinByName {
+			continue
+		}
+		m, err := ebpf.LoadPinnedMap(filepath.Join(pinPath, ms.Name), nil)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("load pinned map %s failed, %s", ms.Name, err)
+		}
+		err = ms.Compatible(m)
+		if err == nil {
+			m.Close()
+			continue
+		}
+		if !errors.Is(err, ebpf.ErrMapIncompatible) {
+			m.Close()
+			return fmt.Errorf("check pinned map %s failed, %s", ms.Name, err)
+		}
+		log.Warnf("pinned map %s is incompatible, it is created anew and loses its entries: %v", ms.Name, err)
+		err = m.Unpin()
+		m.Close()
+		if err != nil {
+			return fmt.Errorf("unpin map failed, %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// redirectPortFilter is the global variable telling the connect programs to only redirect the ports of the allowlist
+const redirectPortFilter = "redirect_port_filter"
+
+// SetRedirectPortFilter makes the connect programs of spec only redirect the destination ports of their allowlist,
+// which is then filled in with UpdateRedirectPorts. Nothing is changed if ports is empty, all the ports are redirected.
+func SetRedirectPortFilter(spec *ebpf.CollectionSpec, ports []uint16) error {
+	if len(ports) == 0 {
+		return nil
+	}
+	v, ok := spec.Variables[redirectPortFilter]
+	if !ok {
+		return fmt.Errorf("the bpf programs do not support redirecting a subset of the ports, %s not found", redirectPortFilter)
+	}
+	if err := v.Set(uint32(1)); err != nil {
+		return fmt.Errorf("set %s failed, %s", redirectPortFilter, err)
+	}
+	return nil
+}
+
+// UpdateRedirectPorts replaces the ports of the allowlist m with ports, the pinned map may hold the ones of
+// a previous run of the daemon
+func UpdateRedirectPorts(m *ebpf.Map, ports []uint16) error {
+	want := make(map[uint32]struct{}, len(ports))
+	for _, port := range ports {
+		want[uint32(port)] = struct{}{}
+	}
+
+	var (
+		key   uint32
+		value uint32
+		stale []uint32
+	)
+	iter := m.Iterate()
+	for iter.Next(&key, &value) {
+		if _, ok := want[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("iterate the redirect ports failed, %s", err)
+	}
+	for _, port := range stale {
+		if err := m.Delete(&port); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("delete the redirect port %d failed, %s", port, err)
+		}
+	}
+
+	for port := range want {
+		if err := m.Update(&port, uint32(1), ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("add the redirect port %d failed, %s", port, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package verifier keeps the diagnostics of the bpf programs the kernel
+// verifier rejected, so that they are reported by the daemon logs, the
+// readiness probe and kmeshctl check instead of a generic load failure.
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+
+	"kmesh.net/kmesh/pkg/logger"
+	"kmesh.net/kmesh/pkg/utils"
+)
+
+const (
+	// maxLogLines is the number of lines kept from the end of the verifier log, where it tells why
+	// the program is rejected. A full log may have millions of lines.
+	maxLogLines = 20
+	// maxLineLength truncates the lines, the verifier prints the whole state of the registers
+	maxLineLength = 256
+	// maxFailures is the number of recent failures kept
+	maxFailures = 8
+)
+
+var log = logger.NewLoggerScope("verifier")
+
+// programPattern matches the program name in the errors of ebpf.CollectionSpec.LoadAndAssign like
+// "field CgroupConnect4Prog: program cgroup_connect4_prog: load program: ..."
+var programPattern = regexp.MustCompile(`program (\w+): `)
+
+var (
+	failuresMutex sync.RWMutex
+	failures      []*Failure
+)
+
+// Failure is a bpf program rejected by the verifier
+type Failure struct {
+	Time time.Time `json:"time"`
+	// Program is the name of the program, empty if unknown
+	Program string `json:"program,omitempty"`
+	Kernel  string `json:"kernel,omitempty"`
+	// Reason is the error of the load followed by the line of the log telling why the program is rejected
+	Reason string `json:"reason"`
+	// Lines are the end of the verifier log
+	Lines []string `json:"lines,omitempty"`
+	// Omitted is the number of lines dropped from the beginning of the log
+	Omitted int `json:"omitted,omitempty"`
+}
+
+// Parse returns the diagnostics of err, nil if err does not wrap an ebpf.VerifierError
+func Parse(err error) *Failure {
+	var ve *ebpf.VerifierError
+	if !errors.As(err, &ve) {
+		return nil
+	}
+
+	failure := &Failure{Program: programName(err.Error(), ve.Error())}
+	failure.Reason = ve.Cause.Error()
+	if reason := rejectReason(ve.Log); reason != "" {
+		failure.Reason += ": " + reason
+	}
+
+	lines := ve.Log
+	if len(lines) > maxLogLines {
+		failure.Omitted = len(lines) - maxLogLines
+		lines = lines[failure.Omitted:]
+	}
+	for _, line := range lines {
+		failure.Lines = append(failure.Lines, truncate(line))
+	}
+	return failure
+}
+
+// programName returns the name of the program from the message of the errors wrapping the verifier error
+func programName(msg, verifierMsg string) string {
+	matches := programPattern.FindAllStringSubmatch(strings.TrimSuffix(msg, verifierMsg), -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return matches[len(matches)-1][1]
+}
+
+// rejectReason returns the last line of the log that is not a statistic of the verifier
+func rejectReason(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "processed ") || strings.HasPrefix(line, "verification time") ||
+			strings.HasPrefix(line, "stack depth") {
+			continue
+		}
+		return truncate(line)
+	}
+	return ""
+}
+
+func truncate(line string) string {
+	if len(line) <= maxLineLength {
+		return line
+	}
+	return line[:maxLineLength] + "..."
+}
+
+// Record keeps the diagnostics of err if a bpf program was rejected by the verifier, and returns them.
+// It returns nil if err is not a verifier failure.
+func Record(err error) *Failure {
+	failure := Parse(err)
+	if failure == nil {
+		return nil
+	}
+	failure.Time = time.Now()
+	failure.Kernel = utils.GetKernelVersion()
+
+	failuresMutex.Lock()
+	defer failuresMutex.Unlock()
+	failures = append(failures, failure)
+	if len(failures) > maxFailures {
+		failures = failures[len(failures)-maxFailures:]
+	}
+	return failure
+}
+
+// Failures returns the recent verifier failures, the oldest first
+func Failures() []*Failure {
+	failuresMutex.RLock()
+	defer failuresMutex.RUnlock()
+	return append([]*Failure(nil), failures...)
+}
+
+// LastFailure returns the most recent verifier failure, nil if none
+func LastFailure() *Failure {
+	failuresMutex.RLock()
+	defer failuresMutex.RUnlock()
+	if len(failures) == 0 {
+		return nil
+	}
+	return failures[len(failures)-1]
+}
+
+// Reset forgets the recorded failures
+func Reset() {
+	failuresMutex.Lock()
+	defer failuresMutex.Unlock()
+	failures = nil
+}
+
+// Summary is a line telling which program was rejected and why
+func (f *Failure) Summary() string {
+	program := f.Program
+	if program == "" {
+		program = "a bpf program"
+	} else {
+		program = "bpf program " + program
+	}
+	if f.Kernel != "" {
+		return fmt.Sprintf("%s rejected by the verifier of kernel %s: %s", program, f.Kernel, f.Reason)
+	}
+	return fmt.Sprintf("%s rejected by the verifier: %s", program, f.Reason)
+}
+
+// Format returns the summary followed by the end of the verifier log
+func (f *Failure) Format() string {
+	var sb strings.Builder
+	sb.WriteString(f.Summary())
+	if f.Omitted > 0 {
+		fmt.Fprintf(&sb, "\n  ... %d lines omitted", f.Omitted)
+	}
+	for _, line := range f.Lines {
+		sb.WriteString("\n  ")
+		sb.WriteString(line)
+	}
+	return sb.String()
+}
+
+// Log prints the summary and the end of the verifier log.
+func (f *Failure) Log() {
+	log.Error(f.Summary())
+	if f.Omitted > 0 {
+		log.Errorf("verifier log, %d lines omitted:", f.Omitted)
+	} else {
+		log.Error("verifier log:")
+	}
+	for _, line := range f.Lines {
+		log.Error(line)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package verifier
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadError wraps a verifier error like ebpf.CollectionSpec.LoadAndAssign and the kmesh loaders do
+func loadError(log []string) error {
+	ve := &ebpf.VerifierError{Cause: syscall.EACCES, Log: log}
+	return fmt.Errorf("bpf Load failed: %w", fmt.Errorf("field CgroupConnect4Prog: program cgroup_connect4_prog: %w", ve))
+}
+
+func TestParse(t *testing.T) {
+	assert.Nil(t, Parse(nil))
+	assert.Nil(t, Parse(errors.New("bpf Load failed: map km_frontend: file exists")))
+
+	failure := Parse(loadError([]string{
+		"0: R1=ctx() R10=fp0",
+		"0: (61) r2 = *(u32 *)(r1 +24)",
+		"1: (07) r2 += 8",
+		"2: (61) r3 = *(u32 *)(r2 +0)",
+		"R2 invalid mem access 'scalar'",
+		"processed 3 insns (limit 1000000) max_states_per_insn 0 total_states 0 peak_states 0 mark_read 0",
+	}))
+	require.NotNil(t, failure)
+	assert.Equal(t, "cgroup_connect4_prog", failure.Program)
+	assert.Equal(t, "permission denied: R2 invalid mem access 'scalar'", failure.Reason)
+	assert.Len(t, failure.Lines, 6)
+	assert.Zero(t, failure.Omitted)
+
+	// no log
+	failure = Parse(&ebpf.VerifierError{Cause: syscall.EINVAL})
+	require.NotNil(t, failure)
+	assert.Empty(t, failure.Program)
+	assert.Equal(t, "invalid argument", failure.Reason)
+	assert.Empty(t, failure.Lines)
+}
+
+func TestParseTruncates(t *testing.T) {
+	log := make([]string, 0, 1000)
+	for i := 0; i < 999; i++ {
+		log = append(log, fmt.Sprintf("%d: (b7) r0 = 0", i))
+	}
+	long := "R0 " + strings.Repeat("x", 1000)
+	log = append(log, long)
+
+	failure := Parse(loadError(log))
+	require.NotNil(t, failure)
+	assert.Equal(t, 980, failure.Omitted)
+	require.Len(t, failure.Lines, maxLogLines)
+	assert.Equal(t, "980: (b7) r0 = 0", failure.Lines[0])
+	assert.Equal(t, long[:maxLineLength]+"...", failure.Lines[maxLogLines-1])
+	assert.Equal(t, "permission denied: "+long[:maxLineLength]+"...", failure.Reason)
+}
+
+func TestFormat(t *testing.T) {
+	failure := &Failure{
+		Program: "cgroup_connect4_prog",
+		Kernel:  "5.10.0-153.12.0.92.oe2203sp2.x86_64",
+		Reason:  "permission denied: R2 invalid mem access 'scalar'",
+		Lines:   []string{"2: (61) r3 = *(u32 *)(r2 +0)", "R2 invalid mem access 'scalar'"},
+		Omitted: 3,
+	}
+	assert.Equal(t, `bpf program cgroup_connect4_prog rejected by the verifier of kernel 5.10.0-153.12.0.92.oe2203sp2.x86_64: permission denied: R2 invalid mem access 'scalar'
+  ... 3 lines omitted
+  2: (61) r3 = *(u32 *)(r2 +0)
+  R2 invalid mem access 'scalar'`, failure.Format())
+
+	failure = &Failure{Reason: "invalid argument"}
+	assert.Equal(t, "a bpf program rejected by the verifier: invalid argument", failure.Format())
+}
+
+func TestRecord(t *testing.T) {
+	t.Cleanup(Reset)
+
+	assert.Nil(t, Record(errors.New("attach failed")))
+	assert.Nil(t, LastFailure())
+
+	for i := 0; i < maxFailures+2; i++ {
+		require.NotNil(t, Record(loadError([]string{fmt.Sprintf("R%d !read_ok", i)})))
+	}
+	recorded := Failures()
+	require.Len(t, recorded, maxFailures)
+	assert.Equal(t, "permission denied: R2 !read_ok", recorded[0].Reason)
+	assert.Equal(t, "permission denied: R9 !read_ok", LastFailure().Reason)
+	assert.False(t, LastFailure().Time.IsZero())
+}
@@ -20,11 +20,8 @@ package workload
 // #include "deserialization_to_bpf_map.h"
 import "C"
 import (
-	"errors"
 	"fmt"
 
-	"github.com/cilium/ebpf"
-
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/bpf/factory"
 	"kmesh.net/kmesh/pkg/bpf/general"
@@ -77,13 +74,9 @@ func NewBpfWorkload(cfg *options.BpfConfig) (*BpfWorkload, error) {
 }
 
 func (w *BpfWorkload) Start() error {
-	var ve *ebpf.VerifierError
-
+	// the verifier errors are wrapped, the daemon reports them with the end of the verifier log
 	if err := w.Load(); err != nil {
-		if errors.As(err, &ve) {
-			return fmt.Errorf("bpf Load failed: %+v", ve)
-		}
-		return fmt.Errorf("bpf Load failed: %v", err)
+		return fmt.Errorf("bpf Load failed: %w", err)
 	}
 
 	if err := w.Attach(); err != nil {
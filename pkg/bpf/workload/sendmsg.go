@@ -45,6 +45,7 @@ func (sm *BpfSendMsgWorkload) NewBpf(cfg *options.BpfConfig, sockOpsWorkloadObj
 	sm.Info.MapPath = cfg.BpfFsPath + "/bpf_kmesh_workload/map/"
 	sm.Info.BpfFsPath = cfg.BpfFsPath + "/bpf_kmesh_workload/sendmsg/"
 	sm.Info.Cgroup2Path = cfg.Cgroup2Path
+	sm.Info.MaxConntrackEntries = cfg.MaxConntrackEntries
 	sm.sockOpsWorkloadObj = sockOpsWorkloadObj
 
 	if err := os.MkdirAll(sm.Info.MapPath,
@@ -80,6 +81,13 @@ func (sm *BpfSendMsgWorkload) loadKmeshSendmsgObjects() (*ebpf.CollectionSpec, e
 	}
 
 	utils.SetMapPinType(spec, ebpf.PinByName)
+	if err = utils.SetEventMechanism(spec, utils.EventMechanism()); err != nil {
+		return nil, err
+	}
+	utils.SetConntrackMaxEntries(spec, sm.Info.MaxConntrackEntries)
+	if err = utils.UnpinIncompatibleMaps(spec, opts.Maps.PinPath); err != nil {
+		return nil, err
+	}
 	if err = spec.LoadAndAssign(&sm.KmeshSendmsgObjects, &opts); err != nil {
 		return nil, err
 	}
@@ -95,7 +103,7 @@ func (sm *BpfSendMsgWorkload) loadKmeshSendmsgObjects() (*ebpf.CollectionSpec, e
 	// 2) unpin old sk_msg prog: If sockmap is deleted, sk_msg will also be cleaned up
 	// 3) pin new sk_msg prog
 	// 4) attach new sk_msg prog(in SendMsg.Attach): Replace the old sk_msg prog
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		pinPath := filepath.Join(sm.Info.BpfFsPath, "sendmsg_prog")
 		oldSkMsg, err := ebpf.LoadPinnedProgram(pinPath, nil)
 		if err != nil {
@@ -46,6 +46,7 @@ func (cs *BpfCroupSkbWorkload) NewBpf(cfg *options.BpfConfig) error {
 	cs.Info.MapPath = cfg.BpfFsPath + "/bpf_kmesh_workload/map/"
 	cs.Info.BpfFsPath = cfg.BpfFsPath + "/bpf_kmesh_workload/cgroup_skb/"
 	cs.Info.Cgroup2Path = cfg.Cgroup2Path
+	cs.Info.MaxConntrackEntries = cfg.MaxConntrackEntries
 	cs.InfoEg = cs.Info
 	if err := os.MkdirAll(cs.Info.MapPath,
 		syscall.S_IRUSR|syscall.S_IWUSR|syscall.S_IXUSR|
@@ -84,6 +85,13 @@ func (cs *BpfCroupSkbWorkload) loadKmeshCgroupSkbObjects() (*ebpf.CollectionSpec
 	}
 
 	utils.SetMapPinType(spec, ebpf.PinByName)
+	if err = utils.SetEventMechanism(spec, utils.EventMechanism()); err != nil {
+		return nil, err
+	}
+	utils.SetConntrackMaxEntries(spec, cs.Info.MaxConntrackEntries)
+	if err = utils.UnpinIncompatibleMaps(spec, opts.Maps.PinPath); err != nil {
+		return nil, err
+	}
 	if err = spec.LoadAndAssign(&cs.KmeshCgroupSkbObjects, &opts); err != nil {
 		return nil, err
 	}
@@ -122,7 +130,7 @@ func (cs *BpfCroupSkbWorkload) Attach() error {
 	}
 	pinPathIn := filepath.Join(cs.Info.BpfFsPath, "cgroup_skb_ingress_prog")
 	pinPathEg := filepath.Join(cs.Info.BpfFsPath, "cgroup_skb_egress_prog")
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		if cs.Link, err = utils.BpfProgUpdate(pinPathIn, cgopt); err != nil {
 			return err
 		}
@@ -46,6 +46,8 @@ func (sc *SockConnWorkload) NewBpf(cfg *options.BpfConfig) error {
 	sc.Info.MapPath = cfg.BpfFsPath + "/bpf_kmesh_workload/map/"
 	sc.Info.BpfFsPath = cfg.BpfFsPath + "/bpf_kmesh_workload/sockconn/"
 	sc.Info.Cgroup2Path = cfg.Cgroup2Path
+	sc.Info.MaxConntrackEntries = cfg.MaxConntrackEntries
+	sc.Info.RedirectPorts = cfg.RedirectedPorts
 	sc.Info6 = sc.Info
 
 	if err := os.MkdirAll(sc.Info.MapPath,
@@ -80,9 +82,24 @@ func (sc *SockConnWorkload) loadKmeshSockConnObjects() (*ebpf.CollectionSpec, er
 	}
 
 	utils.SetMapPinType(spec, ebpf.PinByName)
+	if err = utils.SetEventMechanism(spec, utils.EventMechanism()); err != nil {
+		return nil, err
+	}
+	utils.SetConntrackMaxEntries(spec, sc.Info.MaxConntrackEntries)
+	if err = utils.SetRedirectPortFilter(spec, sc.Info.RedirectPorts); err != nil {
+		return nil, err
+	}
+	if err = utils.UnpinIncompatibleMaps(spec, opts.Maps.PinPath); err != nil {
+		return nil, err
+	}
 	if err = spec.LoadAndAssign(&sc.KmeshCgroupSockWorkloadObjects, &opts); err != nil {
 		return nil, err
 	}
+	if len(sc.Info.RedirectPorts) > 0 {
+		if err = utils.UpdateRedirectPorts(sc.KmRedirectPort, sc.Info.RedirectPorts); err != nil {
+			return nil, err
+		}
+	}
 
 	return spec, nil
 }
@@ -141,7 +158,7 @@ func (sc *SockConnWorkload) Attach() error {
 	pinPath4 := filepath.Join(sc.Info.BpfFsPath, "sockconn_prog")
 	pinPath6 := filepath.Join(sc.Info.BpfFsPath, "sockconn6_prog")
 
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		if sc.Link, err = utils.BpfProgUpdate(pinPath4, cgopt4); err != nil {
 			return err
 		}
@@ -58,7 +58,7 @@ func NewClusterCache(bpfAds *bpfads.BpfAds, hashName *utils.HashName) ClusterCac
 		clusterStatsMap = bpfAds.GetClusterStatsMap()
 	}
 	apiClusterCache := newApiClusterCache()
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		Clusters, err := maps_v2.ClusterLookupAll()
 		if err != nil {
 			log.Errorf("ClusterLookupAll failed: %v, restart with last xDS config failed, "+
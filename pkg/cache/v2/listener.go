@@ -43,7 +43,7 @@ type ListenerCache struct {
 
 func NewListenerCache() ListenerCache {
 	apiListenerCache := NewApiListenerCache()
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		listeners, err := maps_v2.ListenerLookupAll()
 		if err != nil {
 			log.Errorf("ListenerLookupAll failed: %v, restart with last xDS config failed, "+
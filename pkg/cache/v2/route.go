@@ -35,7 +35,7 @@ type RouteConfigCache struct {
 
 func NewRouteConfigCache() RouteConfigCache {
 	apiRouteConfigCache := newApiRouteConfigurationCache()
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		routes, err := maps_v2.RouteConfigLookupAll()
 		if err != nil {
 			log.Errorf("RouteConfigLookupAll failed: %v, restart with last xDS config failed, "+
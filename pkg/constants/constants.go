@@ -20,12 +20,83 @@ const (
 	KernelNativeMode = "kernel-native"
 	DualEngineMode   = "dual-engine"
 
+	// the modes the xdp program is attached to the interfaces of the pods in, native is an alias of
+	// driver and skb one of generic, auto falls back to generic if the driver has no native xdp support
+	XdpModeAuto    = "auto"
+	XdpModeNative  = "native"
+	XdpModeDriver  = "driver"
+	XdpModeGeneric = "generic"
+	XdpModeSkb     = "skb"
+
 	// DataPlaneModeLabel is the label used to indicate the data plane mode
 	DataPlaneModeLabel = "istio.io/dataplane-mode"
 	// DataPlaneModeKmesh is the value of the label to indicate the data plane mode is kmesh
 	DataPlaneModeKmesh = "kmesh"
 	// This annotation is used to indicate traffic redirection settings specific to Kmesh
 	KmeshRedirectionAnnotation = "kmesh.net/redirection"
+	// This annotation on a service sets the minimum percent of healthy endpoints a locality
+	// priority needs before part of its traffic spills over to the next priority
+	LocalityMinHealthyAnnotation = "kmesh.net/locality-min-healthy"
+	// This annotation on a locality failover service splits its traffic over the locality tiers by weight,
+	// e.g. local=70,zone=20,region=10, instead of failing over. The tiers with no healthy endpoint get none.
+	LocalityWeightsAnnotation = "kmesh.net/locality-weights"
+	// This annotation on a service sets the minimum number of healthy endpoints it needs to be routed to,
+	// with fewer the new connections to it are refused instead of overloading the remaining ones
+	MinHealthyEndpointsAnnotation = "kmesh.net/min-healthy-endpoints"
+	// This annotation on a service sets how many other backends a new connection may be
+	// steered to when the backend picked first has recently failed connection establishment.
+	// The connection which failed is not retried: its client gets the error, the backend is
+	// only avoided by the connections opened in the next 5s.
+	FailedBackendRepicksAnnotation = "kmesh.net/failed-backend-repicks"
+	// This annotation on a service bounds how long a single connection attempt waits for
+	// the backend to answer, e.g. 500ms
+	ConnectTimeoutAnnotation = "kmesh.net/connect-timeout"
+	// This annotation on a service makes the daemon close the connections to it
+	// which carried no data for the given duration, e.g. 300s
+	IdleTimeoutAnnotation = "kmesh.net/idle-timeout"
+	// This annotation on a service weighs its endpoints by version within a locality priority,
+	// e.g. v1=1,v2=3, the endpoints of the versions not listed weigh 1
+	EndpointWeightsAnnotation = "kmesh.net/endpoint-weights"
+	// This annotation on a service ejects its backends which failed connection establishment too many
+	// times in a row, like the outlier detection of a DestinationRule, e.g. consecutiveErrors=5,baseEjectionTime=30s
+	OutlierDetectionAnnotation = "kmesh.net/outlier-detection"
+	// This annotation on a service ramps the weight of its new endpoints from a tenth to full
+	// over the given duration after they become ready, e.g. 60s
+	SlowStartWindowAnnotation = "kmesh.net/slow-start-window"
+	// This annotation on a service with a slow start window opens the given number of connections to
+	// each port of its new endpoints before their weight ramps up, to warm them up, e.g. 10
+	WarmUpConnectionsAnnotation = "kmesh.net/warm-up-connections"
+	// This annotation on a service restricts the accesslog entries of the connections to it
+	// to the listed fields, in the listed order, e.g. src.addr,dst.addr,duration
+	AccesslogFieldsAnnotation = "kmesh.net/accesslog-fields"
+	// This annotation on a service marks the packets of the connections to it with
+	// the given DSCP, between 0 and 63, e.g. 46 for expedited forwarding
+	DscpAnnotation = "kmesh.net/dscp"
+	// This annotation on a service picks its endpoints with the given algorithm, like the simple
+	// load balancer of a DestinationRule: RANDOM, ROUND_ROBIN, LEAST_CONN or RING_HASH
+	LoadBalancerAnnotation = "kmesh.net/load-balancer"
+	// This annotation on a service limits the bandwidth the clients on a node share to send to it and receive
+	// from it, e.g. 10Mbps for both directions, or egress=10Mbps,ingress=100Mbps to limit them separately
+	BandwidthAnnotation = "kmesh.net/bandwidth"
+	// This annotation on a service set to DENY_NON_MESH denies the connections to its workloads from the sources
+	// which are not workloads of the mesh, PERMISSIVE and DISABLE accept them. Unlike the STRICT mode of a
+	// PeerAuthentication it does not require HBONE mTLS, a workload of the mesh is recognized by its address.
+	// STRICT, which kmesh can not enforce, is rejected with an error and the service is held to DENY_NON_MESH.
+	MtlsAnnotation = "kmesh.net/mtls"
+	// This annotation on a service limits the concurrent connections to its workloads on each node, like the
+	// connectionPool.tcp.maxConnections of a DestinationRule, the connections beyond it are rejected, e.g. 100
+	MaxConnectionsAnnotation = "kmesh.net/max-connections"
+	// This annotation on a service with kmesh.net/max-connections queues up to the given number of connections
+	// beyond the limit until others close, instead of rejecting them, the ones beyond the queue are rejected.
+	// The queued connections are already established with the workload, only their packets are held, and
+	// they are reset after 10s in the queue. It does not protect the workload from a burst of connections.
+	MaxPendingConnectionsAnnotation = "kmesh.net/max-pending-connections"
+	// This label on a pod enforces the authorization policies of its workload in xdp when enabled,
+	// or in the daemon when disabled, whatever the authz offload of the node
+	AuthzLabel = "kmesh.net/authz"
+	// This annotation on a pod, set to true, closes its established inbound connections a DENY policy
+	// pushed later denies, instead of only denying the new connections
+	AuthzEnforceEstablishedAnnotation = "kmesh.net/authz-enforce-established"
 
 	XDP_PROG_NAME = "xdp_authz"
 	ENABLED       = uint32(1)
@@ -48,6 +119,8 @@ const (
 	// IP family
 	MSG_TYPE_IPV4 = uint32(0)
 	MSG_TYPE_IPV6 = uint32(1)
+	// MSG_TYPE_CONN_CLOSED tells that a connection sent for authorization closed
+	MSG_TYPE_CONN_CLOSED = uint32(2)
 
 	// Ip(0.0.0.2 | ::2) used for control command, e.g. KmeshControl | ByPass
 	ControlCommandIp4 = "0.0.0.2"
@@ -80,5 +153,10 @@ const (
 	XDPTailCallMap = "km_xdp_tailcall"
 	Prog_link      = "prog_link"
 
+	// ConntrackMapName is the conntrack of the authz verdicts of the dual-engine mode, an LRU hash
+	ConntrackMapName = "km_auth_res"
+	// DefaultMaxConntrackEntries is the size the programs declare for the conntrack
+	DefaultMaxConntrackEntries = 8192
+
 	ALL_CIDR = "0.0.0.0/0"
 )
@@ -19,12 +19,14 @@ package ads
 import (
 	"context"
 	"fmt"
+	"time"
 
 	service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	resource_v3 "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
 	"istio.io/istio/pkg/channels"
 
 	bpfads "kmesh.net/kmesh/pkg/bpf/ads"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
 	"kmesh.net/kmesh/pkg/logger"
 )
 
@@ -98,7 +100,9 @@ func (c *Controller) HandleAdsStream() error {
 	// Because Kernel-Native mode is full update.
 	// So the original clusterCache is deleted when a new resp is received.
 	c.dnsResolverController.newClusterCache()
+	start := time.Now()
 	c.Processor.processAdsResponse(rsp)
+	telemetry.ObserveXdsPush(rsp.GetTypeUrl(), start)
 	c.con.requestsChan.Put(c.Processor.ack)
 	if c.Processor.req != nil {
 		c.con.requestsChan.Put(c.Processor.req)
@@ -35,6 +35,7 @@ import (
 	bpfads "kmesh.net/kmesh/pkg/bpf/ads"
 	"kmesh.net/kmesh/pkg/constants"
 	"kmesh.net/kmesh/pkg/controller/config"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
 	"kmesh.net/kmesh/pkg/utils/hash"
 )
 
@@ -121,7 +122,10 @@ func (p *processor) processAdsResponse(resp *service_discovery_v3.DiscoveryRespo
 
 	if err != nil {
 		log.Error(err)
+		return
 	}
+	// kernel-native mode is state of the world, a response carries all the resources of its type
+	telemetry.SetXdsResources(telemetry.XdsType(resp.GetTypeUrl()), len(resp.GetResources()))
 }
 
 func (p *processor) handleCdsResponse(resp *service_discovery_v3.DiscoveryResponse) error {
@@ -48,6 +48,8 @@ type XdsClient struct {
 	AdsController      *ads.Controller
 	WorkloadController *workload.Controller
 	xdsConfig          *config.XdsConfig
+	// xdsLoss applies the --on-xds-loss mode, nil in kernel-native mode
+	xdsLoss *xdsLossHandler
 }
 
 func NewXdsClient(mode string, bpfAds *bpfads.BpfAds, bpfWorkload *bpfwl.BpfWorkload, enableMonitoring, enableProfiling bool) *XdsClient {
@@ -100,6 +102,7 @@ func (c *XdsClient) recoverConnection() {
 	for {
 		if err = c.createGrpcStreamClient(); err == nil {
 			log.Infof("grpc reconnect succeed")
+			c.xdsLoss.connected()
 			return
 		}
 
@@ -135,6 +138,7 @@ func (c *XdsClient) handleUpstream(ctx context.Context) {
 					log.Errorf("Failed to establish grpc link to control plane: %v", err)
 				}
 				_ = c.grpcConn.Close()
+				c.xdsLoss.disconnected()
 				reconnect = true
 			}
 		}
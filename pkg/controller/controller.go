@@ -19,18 +19,23 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/netip"
+	"time"
 
 	"github.com/cilium/ebpf"
 
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/bpf"
 	bpfads "kmesh.net/kmesh/pkg/bpf/ads"
+	"kmesh.net/kmesh/pkg/bpf/restart"
 	bpfwl "kmesh.net/kmesh/pkg/bpf/workload"
 	"kmesh.net/kmesh/pkg/constants"
 	"kmesh.net/kmesh/pkg/controller/bypass"
 	"kmesh.net/kmesh/pkg/controller/encryption/ipsec"
 	manage "kmesh.net/kmesh/pkg/controller/manage"
 	"kmesh.net/kmesh/pkg/controller/security"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/workload"
 	"kmesh.net/kmesh/pkg/kolog"
 	"kmesh.net/kmesh/pkg/kube"
 	"kmesh.net/kmesh/pkg/logger"
@@ -43,26 +48,66 @@ var (
 )
 
 type Controller struct {
-	mode                string
-	bpfAdsObj           *bpfads.BpfAds
-	bpfWorkloadObj      *bpfwl.BpfWorkload
-	client              *XdsClient
-	ipsecController     *ipsec.IPSecController
-	enableByPass        bool
-	enableSecretManager bool
-	bpfConfig           *options.BpfConfig
-	loader              *bpf.BpfLoader
+	mode                          string
+	bpfAdsObj                     *bpfads.BpfAds
+	bpfWorkloadObj                *bpfwl.BpfWorkload
+	client                        *XdsClient
+	ipsecController               *ipsec.IPSecController
+	enableByPass                  bool
+	enableSecretManager           bool
+	bpfConfig                     *options.BpfConfig
+	loadedNamespaces              []string
+	excludedCIDRs                 []netip.Prefix
+	onXdsLoss                     string
+	xdsLossGracePeriod            time.Duration
+	cacheMaxEntries               int
+	xdsCoalesceWindow             time.Duration
+	localityDefault               string
+	trafficDistributionPrecedence string
+	checkpointFile                string
+	otlpEndpoint                  string
+	otlpInsecure                  bool
+	samplingRatio                 float64
+	accesslogSocket               string
+	geoIPDatabases                []string
+	metricsNamespaces             []string
+	namespaceIsolation            bool
+	networkPolicy                 bool
+	auditPolicy                   bool
+	rootNamespace                 string
+	loader                        *bpf.BpfLoader
+	enrollments                   *manage.EnrollmentStore
+	manageController              *manage.KmeshManageController
 }
 
 func NewController(opts *options.BootstrapConfigs, bpfLoader *bpf.BpfLoader) *Controller {
 	return &Controller{
-		mode:                opts.BpfConfig.Mode,
-		enableByPass:        opts.ByPassConfig.EnableByPass,
-		bpfAdsObj:           bpfLoader.GetBpfKmesh(),
-		bpfWorkloadObj:      bpfLoader.GetBpfWorkload(),
-		enableSecretManager: opts.SecretManagerConfig.Enable,
-		bpfConfig:           opts.BpfConfig,
-		loader:              bpfLoader,
+		mode:                          opts.BpfConfig.Mode,
+		enableByPass:                  opts.ByPassConfig.EnableByPass,
+		bpfAdsObj:                     bpfLoader.GetBpfKmesh(),
+		bpfWorkloadObj:                bpfLoader.GetBpfWorkload(),
+		enableSecretManager:           opts.SecretManagerConfig.Enable,
+		bpfConfig:                     opts.BpfConfig,
+		loadedNamespaces:              opts.XdsConfig.WatchedNamespaces,
+		excludedCIDRs:                 opts.XdsConfig.ExcludedPrefixes,
+		onXdsLoss:                     opts.XdsConfig.OnXdsLoss,
+		xdsLossGracePeriod:            opts.XdsConfig.XdsLossGracePeriod,
+		cacheMaxEntries:               opts.XdsConfig.CacheMaxEntries,
+		xdsCoalesceWindow:             opts.XdsConfig.XdsCoalesceWindow,
+		localityDefault:               opts.XdsConfig.LocalityDefault,
+		trafficDistributionPrecedence: opts.XdsConfig.TrafficDistributionPrecedence,
+		checkpointFile:                opts.XdsConfig.CheckpointFile,
+		otlpEndpoint:                  opts.TelemetryConfig.OtlpEndpoint,
+		otlpInsecure:                  opts.TelemetryConfig.OtlpInsecure,
+		samplingRatio:                 opts.TelemetryConfig.AccesslogSamplingRatio,
+		accesslogSocket:               opts.TelemetryConfig.AccesslogSocket,
+		geoIPDatabases:                opts.TelemetryConfig.GeoIPDatabases,
+		metricsNamespaces:             opts.TelemetryConfig.MetricsNamespaces,
+		namespaceIsolation:            opts.AuthzConfig.DefaultDenyCrossNamespace,
+		networkPolicy:                 opts.AuthzConfig.EnableNetworkPolicy,
+		auditPolicy:                   opts.AuthzConfig.EnableAuditPolicy,
+		rootNamespace:                 opts.AuthzConfig.RootNamespace,
+		loader:                        bpfLoader,
 	}
 }
 
@@ -107,6 +152,7 @@ func (c *Controller) Start(stopCh <-chan struct{}) error {
 			}
 			go secertManager.Run(stopCh)
 		}
+		manage.SetXdpMode(c.bpfConfig.XdpMode)
 		kmeshManageController, err = manage.NewKmeshManageController(clientset, secertManager, c.bpfWorkloadObj.XdpAuth.XdpAuthz.FD(), tcFd, c.mode)
 	} else {
 		kolog.KmeshModuleLog(stopCh)
@@ -115,6 +161,8 @@ func (c *Controller) Start(stopCh <-chan struct{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to start kmesh manage controller: %v", err)
 	}
+	c.manageController = kmeshManageController
+	c.enrollments = kmeshManageController.Enrollments()
 	go kmeshManageController.Run(stopCh)
 	log.Info("start kmesh manage controller successfully")
 
@@ -148,9 +196,58 @@ func (c *Controller) Start(stopCh <-chan struct{}) error {
 	c.client = NewXdsClient(c.mode, c.bpfAdsObj, c.bpfWorkloadObj, c.bpfConfig.EnableMonitoring, c.bpfConfig.EnableProfiling)
 
 	if c.client.WorkloadController != nil {
+		c.client.WorkloadController.EnableSocketOperations(clientset)
+		c.client.WorkloadController.SetLoadedNamespaces(c.loadedNamespaces)
+		c.client.WorkloadController.SetExcludedCIDRs(c.excludedCIDRs)
+		c.client.WorkloadController.SetCacheMaxEntries(c.cacheMaxEntries)
+		c.client.WorkloadController.SetXdsCoalesceWindow(c.xdsCoalesceWindow)
+		c.client.WorkloadController.SetLocalityDefault(c.localityDefault)
+		c.client.WorkloadController.SetTrafficDistributionPrecedence(c.trafficDistributionPrecedence)
+		c.client.WorkloadController.SetAuthzHandoff(authzHandoff(c.loader))
+		if c.checkpointFile != "" {
+			c.client.WorkloadController.EnableCheckpoint(c.checkpointFile)
+		}
+		c.client.WorkloadController.MetricController.SetSamplingRatio(c.samplingRatio)
+		c.client.WorkloadController.MetricController.SetMetricsNamespaces(c.metricsNamespaces)
+		if len(c.geoIPDatabases) > 0 {
+			db, err := telemetry.LoadGeoIPDatabase(c.geoIPDatabases...)
+			if err != nil {
+				return err
+			}
+			c.client.WorkloadController.MetricController.GeoIP = db
+			log.Infof("locate the external destinations of the accesslog with the %s databases", db)
+		}
+		if c.otlpEndpoint != "" {
+			if err := c.client.WorkloadController.EnableConnectionExport(ctx, c.otlpEndpoint, c.otlpInsecure); err != nil {
+				return fmt.Errorf("failed to export the connections to %s: %v", c.otlpEndpoint, err)
+			}
+		}
+		if c.accesslogSocket != "" {
+			c.client.WorkloadController.EnableAccesslogSocket(ctx, c.accesslogSocket)
+		}
+		c.client.xdsLoss = newXdsLossHandler(c.onXdsLoss, c.xdsLossGracePeriod,
+			authzEnforcer(c.loader, c.client.WorkloadController.Rbac))
 		c.client.WorkloadController.Run(ctx)
+		go workload.NewServiceAnnotationController(clientset, c.client.WorkloadController.Processor).Run(stopCh)
+		go workload.NewPodAuthzController(clientset, c.client.WorkloadController.Processor).Run(stopCh)
+		if c.networkPolicy {
+			go workload.NewNetworkPolicyController(clientset, c.client.WorkloadController.Processor,
+				c.client.WorkloadController.Rbac).Run(stopCh)
+			log.Info("enforce the kubernetes NetworkPolicies")
+		}
+		if c.auditPolicy {
+			istioClient, err := kube.CreateIstioClient("")
+			if err != nil {
+				return fmt.Errorf("failed to create istio client: %v", err)
+			}
+			go workload.NewAuditPolicyController(clientset, istioClient, c.client.WorkloadController.Rbac,
+				c.rootNamespace).Run(stopCh)
+			log.Info("log the connections the AUDIT AuthorizationPolicies match")
+		}
+		telemetry.SetBuildInfo(constants.DualEngineMode)
 	} else {
 		c.client.AdsController.StartDnsController(stopCh)
+		telemetry.SetBuildInfo(constants.KernelNativeMode)
 	}
 
 	return c.client.Run(stopCh)
@@ -160,6 +257,11 @@ func (c *Controller) Stop() {
 	if c == nil {
 		return
 	}
+	// the pods keep their programs for the next start on a restart, otherwise they are released
+	// while the programs are still loaded
+	if restart.GetExitType() == restart.Normal && c.manageController != nil {
+		c.manageController.Release()
+	}
 	cancel()
 	if c.bpfConfig.EnableIPsec {
 		c.ipsecController.Stop()
@@ -172,3 +274,8 @@ func (c *Controller) Stop() {
 func (c *Controller) GetXdsClient() *XdsClient {
 	return c.client
 }
+
+// GetEnrollments returns the enrollment of the pods of the node, nil before the controller started
+func (c *Controller) GetEnrollments() *manage.EnrollmentStore {
+	return c.enrollments
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kmeshmanage
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Enrollment is the state of a pod of the node that should be managed by Kmesh
+type Enrollment struct {
+	Namespace string
+	Name      string
+	// Mode is the mode the traffic of the pod is redirected in, kernel-native or dual-engine
+	Mode string
+	// EnrolledAt is when the pod got managed by Kmesh, zero if it never did
+	EnrolledAt time.Time
+	// Error is why the last attempt to manage the pod failed, empty if it succeeded
+	Error string
+}
+
+// EnrollmentStore records the enrollment of the pods of the node, it is safe for concurrent use
+type EnrollmentStore struct {
+	mutex       sync.RWMutex
+	enrollments map[string]*Enrollment
+}
+
+func NewEnrollmentStore() *EnrollmentStore {
+	return &EnrollmentStore{enrollments: make(map[string]*Enrollment)}
+}
+
+// Record records the outcome of managing the pod, err is the reason it failed if any.
+// The time a pod got managed is kept when it is managed again.
+func (s *EnrollmentStore) Record(namespace, name, mode string, managed bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	key := namespace + "/" + name
+	e, ok := s.enrollments[key]
+	if !ok {
+		e = &Enrollment{Namespace: namespace, Name: name}
+		s.enrollments[key] = e
+	}
+	e.Mode = mode
+	if managed && e.EnrolledAt.IsZero() {
+		e.EnrolledAt = time.Now()
+	}
+	e.Error = ""
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+// Remove forgets the pod once it is no longer managed by Kmesh
+func (s *EnrollmentStore) Remove(namespace, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.enrollments, namespace+"/"+name)
+}
+
+// List returns the enrollments sorted by namespace and name, namespace and name filter them if not empty
+func (s *EnrollmentStore) List(namespace, name string) []Enrollment {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var enrollments []Enrollment
+	for _, e := range s.enrollments {
+		if (namespace == "" || e.Namespace == namespace) && (name == "" || e.Name == name) {
+			enrollments = append(enrollments, *e)
+		}
+	}
+	sort.Slice(enrollments, func(i, j int) bool {
+		if enrollments[i].Namespace != enrollments[j].Namespace {
+			return enrollments[i].Namespace < enrollments[j].Namespace
+		}
+		return enrollments[i].Name < enrollments[j].Name
+	})
+	return enrollments
+}
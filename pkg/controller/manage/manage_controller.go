@@ -17,6 +17,7 @@
 package kmeshmanage
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
@@ -69,6 +70,7 @@ type KmeshManageController struct {
 	xdpProgFd         int
 	tcProgFd          int
 	mode              string
+	enrollments       *EnrollmentStore
 }
 
 func isPodReady(pod *corev1.Pod) bool {
@@ -102,6 +104,7 @@ func NewKmeshManageController(client kubernetes.Interface, sm *kmeshsecurity.Sec
 		xdpProgFd:         xdpProgFd,
 		tcProgFd:          tcProgFd,
 		mode:              mode,
+		enrollments:       NewEnrollmentStore(),
 	}
 
 	if _, err := podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -201,6 +204,7 @@ func (c *KmeshManageController) handlePodDelete(obj interface{}) {
 		}
 	}
 
+	c.enrollments.Remove(pod.GetNamespace(), pod.GetName())
 	if utils.AnnotationEnabled(pod.Annotations[constants.KmeshRedirectionAnnotation]) {
 		log.Infof("%s/%s: Pod managed by Kmesh is deleted", pod.GetNamespace(), pod.GetName())
 		sendCertRequest(c.sm, pod, kmeshsecurity.DELETE)
@@ -256,11 +260,13 @@ func (c *KmeshManageController) enableKmeshManage(pod *corev1.Pod) {
 	nspath, _ := ns.GetPodNSpath(pod)
 	if err := utils.HandleKmeshManage(nspath, true); err != nil {
 		log.Errorf("failed to enable Kmesh manage")
+		c.enrollments.Record(pod.GetNamespace(), pod.GetName(), c.mode, false, fmt.Errorf("failed to enable Kmesh manage: %v", err))
 		return
 	}
 	c.queue.AddRateLimited(QueueItem{podName: pod.Name, podNs: pod.Namespace, action: ActionAddAnnotation})
-	_ = linkXdp(nspath, c.xdpProgFd, c.mode)
-	_ = linkTc(nspath, c.tcProgFd)
+	// the traffic is redirected even if the programs fail to link, which is reported with the enrollment
+	err := errors.Join(linkXdp(nspath, c.xdpProgFd, c.mode), linkTc(nspath, c.tcProgFd))
+	c.enrollments.Record(pod.GetNamespace(), pod.GetName(), c.mode, true, err)
 }
 
 func (c *KmeshManageController) disableKmeshManage(pod *corev1.Pod) {
@@ -269,8 +275,10 @@ func (c *KmeshManageController) disableKmeshManage(pod *corev1.Pod) {
 	nspath, _ := ns.GetPodNSpath(pod)
 	if err := utils.HandleKmeshManage(nspath, false); err != nil {
 		log.Error("failed to disable Kmesh manage")
+		c.enrollments.Record(pod.GetNamespace(), pod.GetName(), c.mode, false, fmt.Errorf("failed to disable Kmesh manage: %v", err))
 		return
 	}
+	c.enrollments.Remove(pod.GetNamespace(), pod.GetName())
 	c.queue.AddRateLimited(QueueItem{podName: pod.Name, podNs: pod.Namespace, action: ActionDeleteAnnotation})
 	_ = unlinkXdp(nspath, c.mode)
 	_ = unlinkTc(nspath, c.tcProgFd)
@@ -304,6 +312,36 @@ func (c *KmeshManageController) disableKmeshForPodsInNamespace(namespace *corev1
 	}
 }
 
+// Release unlinks the programs from the pods of the node and stops redirecting their traffic, for
+// the daemon to exit without leaving the pods attached to programs about to be unloaded. It must
+// be called once the CNI plugin is removed, for no new pod to be enrolled, and before the bpf
+// programs are unloaded.
+func (c *KmeshManageController) Release() {
+	for _, e := range c.enrollments.List("", "") {
+		pod, err := c.podLister.Pods(e.Namespace).Get(e.Name)
+		if err != nil {
+			log.Warnf("%s/%s: failed to get pod to release: %v", e.Namespace, e.Name, err)
+			continue
+		}
+		log.Infof("%s/%s: release Kmesh manage", pod.GetNamespace(), pod.GetName())
+		nspath, _ := ns.GetPodNSpath(pod)
+		err = errors.Join(utils.HandleKmeshManage(nspath, false), unlinkXdp(nspath, c.mode), unlinkTc(nspath, c.tcProgFd))
+		if err != nil {
+			log.Errorf("%s/%s: failed to release Kmesh manage: %v", pod.GetNamespace(), pod.GetName(), err)
+		}
+		// the queue is no longer processed, the annotation is removed right away
+		if err := utils.DelKmeshRedirectAnnotation(c.client, pod); err != nil {
+			log.Errorf("%s/%s: failed to delete annotation: %v", pod.GetNamespace(), pod.GetName(), err)
+		}
+		c.enrollments.Remove(pod.GetNamespace(), pod.GetName())
+	}
+}
+
+// Enrollments returns the enrollment of the pods of the node
+func (c *KmeshManageController) Enrollments() *EnrollmentStore {
+	return c.enrollments
+}
+
 func (c *KmeshManageController) Run(stopChan <-chan struct{}) {
 	defer c.queue.ShutDown()
 	go c.podInformer.Run(stopChan)
@@ -408,7 +446,7 @@ func linkXdp(netNsPath string, xdpProgFd int, mode string) error {
 				return err
 			}
 			// Always let new XDP program replace the old one, to ensure that there is always only one XDP program at the same time
-			if err := netlink.LinkSetXdpFd(ifLink, xdpProgFd); err != nil {
+			if err := attachXdp(ifLink, xdpProgFd); err != nil {
 				return err
 			}
 		}
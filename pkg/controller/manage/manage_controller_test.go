@@ -41,6 +41,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 
 	"kmesh.net/kmesh/pkg/constants"
+	kmesh_netns "kmesh.net/kmesh/pkg/controller/netns"
 	"kmesh.net/kmesh/pkg/utils"
 )
 
@@ -933,3 +934,94 @@ func Test_TC(t *testing.T) {
 		})
 	}
 }
+
+func TestRelease(t *testing.T) {
+	testNs, err := ns.TempNetNS()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testNs.Close()
+	})
+	require.NoError(t, testNs.Do(func(_ ns.NetNS) error {
+		veth := &netlink.Veth{
+			LinkAttrs: netlink.LinkAttrs{Name: "veth0"},
+			PeerName:  "veth1",
+		}
+		if err := netlink.LinkAdd(veth); err != nil {
+			return err
+		}
+		for _, name := range []string{"veth0", "veth1"} {
+			l, err := netlink.LinkByName(name)
+			if err != nil {
+				return err
+			}
+			if err := netlink.LinkSetUp(l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	xdpAttached := func() bool {
+		attached := false
+		_ = testNs.Do(func(_ ns.NetNS) error {
+			for _, name := range []string{"veth0", "veth1"} {
+				l, err := netlink.LinkByName(name)
+				require.NoError(t, err)
+				if xdp := l.Attrs().Xdp; xdp != nil && xdp.Attached {
+					attached = true
+				}
+			}
+			return nil
+		})
+		return attached
+	}
+
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	// the path of the netns of the thread it was created on may no longer be it
+	patches.ApplyFunc(kmesh_netns.GetPodNSpath, func(_ *corev1.Pod) (string, error) {
+		return fmt.Sprintf("/proc/self/fd/%d", testNs.Fd()), nil
+	})
+	disabled := atomic.Bool{}
+	patches.ApplyFunc(utils.HandleKmeshManage, func(ns string, op bool) error {
+		if !op {
+			disabled.Store(true)
+		}
+		return nil
+	})
+
+	t.Setenv("NODE_NAME", "test-node")
+	client := fake.NewSimpleClientset()
+	controller, err := NewKmeshManageController(client, nil, newTextXdpProg(t, "xdp_authz").FD(), -1, constants.DualEngineMode)
+	require.NoError(t, err)
+	stopChan := make(chan struct{})
+	defer close(stopChan)
+	go controller.Run(stopChan)
+	cache.WaitForCacheSync(stopChan, controller.podInformer.HasSynced, controller.namespaceInformer.HasSynced)
+
+	_, err = client.CoreV1().Namespaces().Create(context.TODO(), nsWithoutLabel, metav1.CreateOptions{})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = client.CoreV1().Pods("default").Create(context.TODO(), podWithLabel.DeepCopy(), metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	// the pod is enrolled, its interfaces linked with the xdp program
+	podAnnotated := func() bool {
+		pod, err := client.CoreV1().Pods("default").Get(context.TODO(), podWithLabel.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return utils.AnnotationEnabled(pod.Annotations[constants.KmeshRedirectionAnnotation])
+	}
+	retry.UntilSuccessOrFail(t, func() error {
+		if len(controller.Enrollments().List("", "")) != 1 || !podAnnotated() {
+			return fmt.Errorf("pod not enrolled yet")
+		}
+		return nil
+	})
+	assert.True(t, xdpAttached())
+
+	// and released when the daemon exits, no program is left attached to it
+	controller.Release()
+	assert.True(t, disabled.Load())
+	assert.False(t, xdpAttached())
+	assert.False(t, podAnnotated())
+	assert.Empty(t, controller.Enrollments().List("", ""))
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kmeshmanage
+
+import (
+	"sync/atomic"
+
+	"github.com/cilium/ebpf/link"
+	"github.com/vishvananda/netlink"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+var (
+	// xdpMode is the mode set by --xdp-mode, with the aliases resolved
+	xdpMode atomic.Value
+	// activeXdpMode is the mode the xdp program was last attached in
+	activeXdpMode atomic.Value
+)
+
+func init() {
+	xdpMode.Store(constants.XdpModeAuto)
+	activeXdpMode.Store("")
+}
+
+// SetXdpMode sets the mode the xdp program is attached to the interfaces of the pods in. It must be
+// set before the manage controller runs.
+func SetXdpMode(mode string) {
+	switch mode {
+	case constants.XdpModeNative, constants.XdpModeDriver:
+		mode = constants.XdpModeDriver
+	case constants.XdpModeSkb, constants.XdpModeGeneric:
+		mode = constants.XdpModeGeneric
+	default:
+		mode = constants.XdpModeAuto
+	}
+	xdpMode.Store(mode)
+}
+
+// ActiveXdpMode returns the mode the xdp program was last attached in, driver or generic, empty if
+// it was not attached to any interface yet
+func ActiveXdpMode() string {
+	return activeXdpMode.Load().(string)
+}
+
+// attachXdp attaches the xdp program to the interface in the configured mode, replacing the one
+// attached in that mode if any. In auto mode it is attached in driver mode unless the driver of
+// the interface has no native xdp support, then in generic mode.
+func attachXdp(ifLink netlink.Link, xdpProgFd int) error {
+	mode := xdpMode.Load().(string)
+	var err error
+	switch mode {
+	case constants.XdpModeDriver:
+		err = netlink.LinkSetXdpFdWithFlags(ifLink, xdpProgFd, int(link.XDPDriverMode))
+	case constants.XdpModeGeneric:
+		err = netlink.LinkSetXdpFdWithFlags(ifLink, xdpProgFd, int(link.XDPGenericMode))
+	default:
+		mode = constants.XdpModeDriver
+		if err = netlink.LinkSetXdpFdWithFlags(ifLink, xdpProgFd, int(link.XDPDriverMode)); err != nil {
+			log.Warnf("failed to attach xdp program to %s in driver mode, fall back to generic mode: %v", ifLink.Attrs().Name, err)
+			mode = constants.XdpModeGeneric
+			err = netlink.LinkSetXdpFdWithFlags(ifLink, xdpProgFd, int(link.XDPGenericMode))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	activeXdpMode.Store(mode)
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kmeshmanage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cilium/ebpf/link"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+func TestXdpModeFallback(t *testing.T) {
+	testNs, err := ns.TempNetNS()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testNs.Close()
+	})
+	// the bridge driver has no native xdp support
+	require.NoError(t, testNs.Do(func(_ ns.NetNS) error {
+		bridge := &netlink.Bridge{LinkAttrs: netlink.LinkAttrs{Name: "br0"}}
+		if err := netlink.LinkAdd(bridge); err != nil {
+			return err
+		}
+		return netlink.LinkSetUp(bridge)
+	}))
+	nsPath := fmt.Sprintf("/proc/self/fd/%d", testNs.Fd())
+	attachedMode := func() uint32 {
+		var mode uint32
+		_ = testNs.Do(func(_ ns.NetNS) error {
+			l, err := netlink.LinkByName("br0")
+			require.NoError(t, err)
+			if xdp := l.Attrs().Xdp; xdp != nil && xdp.Attached {
+				mode = xdp.AttachMode
+			}
+			return nil
+		})
+		return mode
+	}
+	t.Cleanup(func() {
+		SetXdpMode(constants.XdpModeAuto)
+	})
+	prog := newTextXdpProg(t, "xdp_mode")
+
+	// driver mode fails without falling back
+	SetXdpMode(constants.XdpModeNative)
+	assert.Error(t, linkXdp(nsPath, prog.FD(), constants.DualEngineMode))
+	assert.Zero(t, attachedMode())
+
+	// auto mode falls back to generic mode
+	SetXdpMode(constants.XdpModeAuto)
+	require.NoError(t, linkXdp(nsPath, prog.FD(), constants.DualEngineMode))
+	assert.Equal(t, uint32(link.XDPGenericMode), attachedMode())
+	assert.Equal(t, constants.XdpModeGeneric, ActiveXdpMode())
+	require.NoError(t, unlinkXdp(nsPath, constants.DualEngineMode))
+	assert.Zero(t, attachedMode())
+
+	// as well as skb mode attaches it
+	SetXdpMode(constants.XdpModeSkb)
+	require.NoError(t, linkXdp(nsPath, prog.FD(), constants.DualEngineMode))
+	assert.Equal(t, uint32(link.XDPGenericMode), attachedMode())
+}
@@ -17,16 +17,90 @@
 package telemetry
 
 import (
+	"cmp"
 	"fmt"
+	"net/netip"
+	"strings"
 	"syscall"
 	"time"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
 )
 
+// accesslogFields are the fields of an accesslog entry, in the order they are logged when
+// the service of the connection does not choose them
+var accesslogFields = []string{
+	"src.addr", "src.workload", "src.namespace",
+	"dst.addr", "dst.service", "dst.workload", "dst.namespace",
+	"start_time", "direction", "state", "sent_bytes", "received_bytes",
+	"packet_loss", "retransmissions", "srtt", "min_rtt", "duration", "protocol",
+}
+
+// geoIPAccesslogFields are the fields of the location of the external destinations, logged after the
+// others when the service of the connection does not choose them and the destination was located
+var geoIPAccesslogFields = []string{"dst.country", "dst.asn"}
+
+// localityAccesslogFields are the fields of the locality tier the backend of the connection was picked
+// from, logged after the others when the service of the connection does not choose them and it is
+// balanced by locality
+var localityAccesslogFields = []string{"locality_tier"}
+
+// connIdAccesslogFields are the fields of the id of the connection, logged after the others when the
+// service of the connection does not choose them and the data plane assigned the connection an id
+var connIdAccesslogFields = []string{"conn_id"}
+
+// optionalAccesslogFields are the fields only logged by default when they are set
+var optionalAccesslogFields = append(append(localityAccesslogFields, geoIPAccesslogFields...), connIdAccesslogFields...)
+
+// AccesslogFieldsFunc returns the fields the accesslog entries of the connections to a service
+// are projected to, nil for all of them.
+type AccesslogFieldsFunc func(service *workloadapi.Service) []string
+
+// ParseAccesslogFields parses a comma separated list of accesslog fields, e.g. src.addr,dst.addr,duration.
+// The fields are logged in the given order, an unknown field is an error.
+func ParseAccesslogFields(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		known := false
+		for _, f := range append(accesslogFields, optionalAccesslogFields...) {
+			if f == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown accesslog field %q, supported fields are %s", field,
+				strings.Join(append(accesslogFields, optionalAccesslogFields...), ","))
+		}
+		duplicate := false
+		for _, f := range fields {
+			if f == field {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no accesslog field given")
+	}
+	return fields, nil
+}
+
 type logInfo struct {
+	// fields the entry is projected to, all if empty
+	fields []string
+
 	direction       string
 	state           string
+	protocol        string
 	sourceAddress   string
 	sourceWorkload  string
 	sourceNamespace string
@@ -35,11 +109,17 @@ type logInfo struct {
 	destinationService   string
 	destinationWorkload  string
 	destinationNamespace string
+	// location of an external destination, empty unless it was found in the geoip database
+	destinationCountry string
+	destinationAsn     string
+	// locality tier the backend was picked from, e.g. local or zone, empty unless the service is balanced by locality
+	localityTier string
 }
 
 func NewLogInfo() *logInfo {
 	return &logInfo{
 		direction:            DEFAULT_UNKNOWN,
+		protocol:             "tcp",
 		sourceAddress:        DEFAULT_UNKNOWN,
 		sourceWorkload:       DEFAULT_UNKNOWN,
 		sourceNamespace:      DEFAULT_UNKNOWN,
@@ -77,26 +157,140 @@ func (l *logInfo) withDestinationService(service *workloadapi.Service) *logInfo
 	return l
 }
 
-func outputAccesslog(data requestMetric, connMetrics connMetric, accesslog logInfo) {
+// withDestinationLocation sets the location of the destination address if it is in the database
+func (l *logInfo) withDestinationLocation(db *GeoIPDatabase, address []byte) *logInfo {
+	addr, _ := netip.AddrFromSlice(address)
+	record, ok := db.lookup(addr)
+	if !ok {
+		return l
+	}
+	l.destinationCountry = record.country
+	if record.asn != 0 {
+		l.destinationAsn = fmt.Sprintf("AS%d", record.asn)
+	}
+	return l
+}
+
+// localityTierName names the locality tier, the priority + 1, the backend of a connection to the service
+// was picked from after the most specific scope of the routing preference of the service the backend
+// shares with the client: local if all of them, remote if none. It is empty for the tier 0 of the
+// connections not balanced by locality.
+func localityTierName(service *workloadapi.Service, tier uint32) string {
+	if tier == 0 {
+		return ""
+	}
+	prio := tier - 1
+	rp := service.GetLoadBalancing().GetRoutingPreference()
+	switch {
+	case prio == bpfcache.UnknownLocalityPrio:
+		return "unknown"
+	case prio > uint32(len(rp)) && prio == bpfcache.RemoteClusterPrio(rp):
+		return "remote-cluster"
+	case prio > uint32(len(rp)):
+		return fmt.Sprintf("priority-%d", prio)
+	}
+	matched := len(rp) - int(prio)
+	switch matched {
+	case len(rp):
+		return "local"
+	case 0:
+		return "remote"
+	}
+	return strings.ToLower(rp[matched-1].String())
+}
+
+func outputAccesslog(data requestMetric, connMetrics connMetric, accesslog logInfo, socket *AccesslogSocketWriter) {
 	// Skip output access log on connection establishment
 	if data.state == TCP_ESTABLISHED && connMetrics.totalReports == 1 {
 		return
 	}
 	logStr := buildAccesslog(data, connMetrics, accesslog)
 	fmt.Println("accesslog:", logStr)
+	socket.write(data, connMetrics, accesslog)
 }
 
 func buildAccesslog(reqMetric requestMetric, connMetrics connMetric, accesslog logInfo) string {
+	uptime, fields, values := accesslogEntry(reqMetric, connMetrics, accesslog)
+	entries := make([]string, 0, len(fields))
+	for _, field := range fields {
+		entries = append(entries, field+"="+values[field])
+	}
+
+	logResult := fmt.Sprintf("%v %s", uptime, strings.Join(entries, ", "))
+	return logResult
+}
+
+// accesslogEntry returns the time of an accesslog entry, its fields in the order they are logged and their values
+func accesslogEntry(reqMetric requestMetric, connMetrics connMetric, accesslog logInfo) (time.Time, []string, map[string]string) {
 	uptime := calculateUptime(osStartTime, reqMetric.lastReportTime)
 	startTime := calculateUptime(osStartTime, reqMetric.startTime)
-	startTimeInfo := fmt.Sprintf("%v", startTime)
-	timeInfo := fmt.Sprintf("%v", uptime)
-	sourceInfo := fmt.Sprintf("src.addr=%s, src.workload=%s, src.namespace=%s", accesslog.sourceAddress, accesslog.sourceWorkload, accesslog.sourceNamespace)
-	destinationInfo := fmt.Sprintf("dst.addr=%s, dst.service=%s, dst.workload=%s, dst.namespace=%s", accesslog.destinationAddress, accesslog.destinationService, accesslog.destinationWorkload, accesslog.destinationNamespace)
-	connectionInfo := fmt.Sprintf("start_time=%s, direction=%s, state=%s, sent_bytes=%d, received_bytes=%d, packet_loss=%d, retransmissions=%d, srtt=%dus, min_rtt=%dus, duration=%vms", startTimeInfo, accesslog.direction, accesslog.state, connMetrics.sentBytes, connMetrics.receivedBytes, connMetrics.packetLost, connMetrics.totalRetrans, reqMetric.srtt, reqMetric.minRtt, (float64(reqMetric.duration) / 1000000.0))
+	values := map[string]string{
+		"src.addr":        accesslog.sourceAddress,
+		"src.workload":    accesslog.sourceWorkload,
+		"src.namespace":   accesslog.sourceNamespace,
+		"dst.addr":        accesslog.destinationAddress,
+		"dst.service":     accesslog.destinationService,
+		"dst.workload":    accesslog.destinationWorkload,
+		"dst.namespace":   accesslog.destinationNamespace,
+		"start_time":      fmt.Sprintf("%v", startTime),
+		"direction":       accesslog.direction,
+		"state":           accesslog.state,
+		"sent_bytes":      fmt.Sprintf("%d", connMetrics.sentBytes),
+		"received_bytes":  fmt.Sprintf("%d", connMetrics.receivedBytes),
+		"packet_loss":     fmt.Sprintf("%d", connMetrics.packetLost),
+		"retransmissions": fmt.Sprintf("%d", connMetrics.totalRetrans),
+		"srtt":            fmt.Sprintf("%dus", reqMetric.srtt),
+		"min_rtt":         fmt.Sprintf("%dus", reqMetric.minRtt),
+		"duration":        fmt.Sprintf("%vms", (float64(reqMetric.duration) / 1000000.0)),
+		"protocol":        accesslog.protocol,
+		"dst.country":     cmp.Or(accesslog.destinationCountry, DEFAULT_UNKNOWN),
+		"dst.asn":         cmp.Or(accesslog.destinationAsn, DEFAULT_UNKNOWN),
+		"locality_tier":   cmp.Or(accesslog.localityTier, DEFAULT_UNKNOWN),
+		"conn_id":         formatConnId(reqMetric.connId),
+	}
 
-	logResult := fmt.Sprintf("%s %s, %s, %s", timeInfo, sourceInfo, destinationInfo, connectionInfo)
-	return logResult
+	fields := accesslog.fields
+	if len(fields) == 0 {
+		fields = accesslogFields
+		if accesslog.localityTier != "" {
+			fields = append(fields[:len(fields):len(fields)], localityAccesslogFields...)
+		}
+		if accesslog.destinationCountry != "" || accesslog.destinationAsn != "" {
+			fields = append(fields[:len(fields):len(fields)], geoIPAccesslogFields...)
+		}
+		if reqMetric.connId != 0 {
+			fields = append(fields[:len(fields):len(fields)], connIdAccesslogFields...)
+		}
+	}
+	return uptime, fields, values
+}
+
+// formatConnId formats the id of a connection the way both its accesslog entries and its authz verdict log it
+func formatConnId(connId uint64) string {
+	if connId == 0 {
+		return DEFAULT_UNKNOWN
+	}
+	return fmt.Sprintf("%016x", connId)
+}
+
+// LogVerdict logs the authz verdict of a connection while the accesslog is enabled. It carries the id of
+// the connection like its accesslog entries, to join the authz decisions with the connection outcomes.
+func (m *MetricController) LogVerdict(connId uint64, src, dst netip.AddrPort, allowed bool, reason string) {
+	if !m.EnableAccesslog.Load() {
+		return
+	}
+	// rounded to strip the monotonic clock reading from the logged time
+	fmt.Println("authz:", buildVerdictLog(time.Now().Round(0), connId, src, dst, allowed, reason))
+}
+
+func buildVerdictLog(now time.Time, connId uint64, src, dst netip.AddrPort, allowed bool, reason string) string {
+	verdict := "ALLOW"
+	if !allowed {
+		verdict = "DENY"
+	}
+	// the reason is last, it may contain commas
+	return fmt.Sprintf("%v conn_id=%s, src.addr=%s, dst.addr=%s, verdict=%s, reason=%s", now, formatConnId(connId),
+		src, dst, verdict, cmp.Or(reason, DEFAULT_UNKNOWN))
 }
 
 func getOSBootTime() (time.Time, error) {
@@ -0,0 +1,141 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"time"
+)
+
+const (
+	// accesslogSocketBuffer is the number of records kept while the agent reading the socket is absent,
+	// the newer records are dropped once it is full
+	accesslogSocketBuffer = 4096
+
+	accesslogSocketDialTimeout  = time.Second
+	accesslogSocketWriteTimeout = 5 * time.Second
+	accesslogSocketMinBackoff   = 100 * time.Millisecond
+	accesslogSocketMaxBackoff   = 10 * time.Second
+)
+
+// AccesslogSocketWriter writes the accesslog entries to a unix socket a node local log agent listens on,
+// a JSON object per line. The records are buffered while the agent is absent and the socket is dialed
+// again until it comes back.
+type AccesslogSocketWriter struct {
+	path    string
+	records chan []byte
+	// dialBackoff is the first delay before dialing the socket again, doubled up to accesslogSocketMaxBackoff
+	dialBackoff time.Duration
+}
+
+// NewAccesslogSocketWriter writes the accesslog entries to the unix socket at path until ctx is done
+func NewAccesslogSocketWriter(ctx context.Context, path string) *AccesslogSocketWriter {
+	w := newAccesslogSocketWriter(path, accesslogSocketBuffer, accesslogSocketMinBackoff)
+	go w.run(ctx)
+	return w
+}
+
+func newAccesslogSocketWriter(path string, buffer int, dialBackoff time.Duration) *AccesslogSocketWriter {
+	return &AccesslogSocketWriter{
+		path:        path,
+		records:     make(chan []byte, buffer),
+		dialBackoff: dialBackoff,
+	}
+}
+
+// write queues the record of an accesslog entry, it never blocks the processing of the connections
+func (w *AccesslogSocketWriter) write(reqMetric requestMetric, conn connMetric, info logInfo) {
+	if w == nil {
+		return
+	}
+	record, err := buildAccesslogRecord(reqMetric, conn, info)
+	if err != nil {
+		log.Errorf("failed to marshal the accesslog record: %v", err)
+		return
+	}
+	select {
+	case w.records <- record:
+	default:
+		accesslogSocketDropped.Inc()
+	}
+}
+
+// buildAccesslogRecord returns the line of an accesslog entry, with the fields of the text accesslog and its time
+func buildAccesslogRecord(reqMetric requestMetric, conn connMetric, info logInfo) ([]byte, error) {
+	uptime, fields, values := accesslogEntry(reqMetric, conn, info)
+	record := make(map[string]string, len(fields)+1)
+	record["time"] = uptime.Format(time.RFC3339Nano)
+	for _, field := range fields {
+		record[field] = values[field]
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (w *AccesslogSocketWriter) run(ctx context.Context) {
+	var (
+		conn net.Conn
+		// pending is the record that failed to be written, it is written again once the socket is dialed
+		pending []byte
+	)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	backoff := w.dialBackoff
+	for {
+		if conn == nil {
+			var err error
+			conn, err = net.DialTimeout("unix", w.path, accesslogSocketDialTimeout)
+			if err != nil {
+				log.Debugf("failed to dial the accesslog socket %s, retry in %v: %v", w.path, backoff, err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(2*backoff, accesslogSocketMaxBackoff)
+				continue
+			}
+			log.Infof("connected to the accesslog socket %s", w.path)
+			backoff = w.dialBackoff
+		}
+
+		if pending == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case pending = <-w.records:
+			}
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(accesslogSocketWriteTimeout))
+		if _, err := conn.Write(pending); err != nil {
+			log.Warnf("failed to write the accesslog to the socket %s, dial it again: %v", w.path, err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+		pending = nil
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socketReader is a log agent reading the records of the accesslog socket
+type socketReader struct {
+	listener net.Listener
+	records  chan map[string]string
+	conns    chan net.Conn
+}
+
+func newSocketReader(t *testing.T, path string) *socketReader {
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	r := &socketReader{
+		listener: listener,
+		records:  make(chan map[string]string, 16),
+		conns:    make(chan net.Conn, 16),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r.conns <- conn
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					var record map[string]string
+					if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+						t.Errorf("invalid record %q: %v", scanner.Text(), err)
+						return
+					}
+					r.records <- record
+				}
+			}()
+		}
+	}()
+	return r
+}
+
+// close stops the agent, closing the connections of the writer
+func (r *socketReader) close() {
+	r.listener.Close()
+	for {
+		select {
+		case conn := <-r.conns:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (r *socketReader) next(t *testing.T) map[string]string {
+	select {
+	case record := <-r.records:
+		return record
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an accesslog record")
+		return nil
+	}
+}
+
+func socketAccesslog(destination string) logInfo {
+	info := *NewLogInfo()
+	info.fields = []string{"src.addr", "dst.addr", "sent_bytes"}
+	info.sourceAddress = "10.244.0.10:47667"
+	info.destinationAddress = destination
+	return info
+}
+
+func TestAccesslogSocketWriter(t *testing.T) {
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "accesslog.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the records written while the agent is absent are buffered
+	w := newAccesslogSocketWriter(path, 16, 10*time.Millisecond)
+	go w.run(ctx)
+	w.write(requestMetric{}, connMetric{sentBytes: 60}, socketAccesslog("10.244.0.7:8080"))
+	time.Sleep(50 * time.Millisecond)
+
+	reader := newSocketReader(t, path)
+	assert.Equal(t, map[string]string{
+		"time":       "2024-07-04T20:14:00Z",
+		"src.addr":   "10.244.0.10:47667",
+		"dst.addr":   "10.244.0.7:8080",
+		"sent_bytes": "60",
+	}, reader.next(t))
+
+	w.write(requestMetric{}, connMetric{sentBytes: 1}, socketAccesslog("10.244.0.8:8080"))
+	assert.Equal(t, "10.244.0.8:8080", reader.next(t)["dst.addr"])
+
+	// the socket is dialed again once the agent restarts
+	reader.close()
+	w.write(requestMetric{}, connMetric{sentBytes: 2}, socketAccesslog("10.244.0.9:8080"))
+	w.write(requestMetric{}, connMetric{sentBytes: 3}, socketAccesslog("10.244.0.10:8080"))
+	reader = newSocketReader(t, path)
+	defer reader.close()
+	assert.Equal(t, "10.244.0.9:8080", reader.next(t)["dst.addr"])
+	assert.Equal(t, "10.244.0.10:8080", reader.next(t)["dst.addr"])
+}
+
+func TestAccesslogSocketWriterFull(t *testing.T) {
+	w := newAccesslogSocketWriter(filepath.Join(t.TempDir(), "accesslog.sock"), 1, time.Millisecond)
+	w.write(requestMetric{}, connMetric{}, socketAccesslog("10.244.0.7:8080"))
+	// the writer does not run, the buffer is full
+	w.write(requestMetric{}, connMetric{}, socketAccesslog("10.244.0.8:8080"))
+	assert.Len(t, w.records, 1)
+
+	var nilWriter *AccesslogSocketWriter
+	nilWriter.write(requestMetric{}, connMetric{}, socketAccesslog("10.244.0.7:8080"))
+}
@@ -17,10 +17,20 @@
 package telemetry
 
 import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/nets"
 )
 
 func Test_buildAccesslog(t *testing.T) {
@@ -56,9 +66,10 @@ func Test_buildAccesslog(t *testing.T) {
 					destinationWorkload:  "httpbin-86b8ffc5ff-bhvxx",
 					destinationNamespace: "kmesh-system",
 					state:                "BPF_TCP_SYN_RECV",
+					protocol:             "http",
 				},
 			},
-			want: "2024-08-14 10:11:27.005837715 +0000 UTC src.addr=10.244.0.10:47667, src.workload=sleep-7656cf8794-9v2gv, src.namespace=kmesh-system, dst.addr=10.244.0.7:8080, dst.service=httpbin.ambient-demo.svc.cluster.local, dst.workload=httpbin-86b8ffc5ff-bhvxx, dst.namespace=kmesh-system, start_time=2024-08-14 10:11:27.005837715 +0000 UTC, direction=INBOUND, state=BPF_TCP_SYN_RECV, sent_bytes=60, received_bytes=172, packet_loss=0, retransmissions=0, srtt=0us, min_rtt=0us, duration=2.236ms",
+			want: "2024-08-14 10:11:27.005837715 +0000 UTC src.addr=10.244.0.10:47667, src.workload=sleep-7656cf8794-9v2gv, src.namespace=kmesh-system, dst.addr=10.244.0.7:8080, dst.service=httpbin.ambient-demo.svc.cluster.local, dst.workload=httpbin-86b8ffc5ff-bhvxx, dst.namespace=kmesh-system, start_time=2024-08-14 10:11:27.005837715 +0000 UTC, direction=INBOUND, state=BPF_TCP_SYN_RECV, sent_bytes=60, received_bytes=172, packet_loss=0, retransmissions=0, srtt=0us, min_rtt=0us, duration=2.236ms, protocol=http",
 		},
 	}
 	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
@@ -70,6 +81,169 @@ func Test_buildAccesslog(t *testing.T) {
 	}
 }
 
+func Test_buildAccesslogProjection(t *testing.T) {
+	connMetrics := connMetric{sentBytes: 60, receivedBytes: 172}
+	reqMetric := requestMetric{
+		duration:       uint64(2236000),
+		startTime:      uint64(3506247005837715),
+		lastReportTime: uint64(3506247005837715),
+	}
+	accesslog := logInfo{
+		direction:            "OUTBOUND",
+		sourceAddress:        "10.244.0.10:47667",
+		sourceWorkload:       "sleep-7656cf8794-9v2gv",
+		sourceNamespace:      "ambient-demo",
+		destinationAddress:   "10.244.0.7:8080",
+		destinationService:   "httpbin.ambient-demo.svc.cluster.local",
+		destinationWorkload:  "httpbin-86b8ffc5ff-bhvxx",
+		destinationNamespace: "ambient-demo",
+		state:                "BPF_TCP_CLOSE",
+	}
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{
+			name:   "addresses only",
+			fields: "src.addr,dst.addr",
+			want:   "2024-08-14 10:11:27.005837715 +0000 UTC src.addr=10.244.0.10:47667, dst.addr=10.244.0.7:8080",
+		},
+		{
+			name:   "in the given order without duplicates",
+			fields: " duration, dst.service ,sent_bytes,duration",
+			want:   "2024-08-14 10:11:27.005837715 +0000 UTC duration=2.236ms, dst.service=httpbin.ambient-demo.svc.cluster.local, sent_bytes=60",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := ParseAccesslogFields(tt.fields)
+			require.NoError(t, err)
+			accesslog.fields = fields
+			assert.Equal(t, tt.want, buildAccesslog(reqMetric, connMetrics, accesslog))
+		})
+	}
+}
+
+func TestParseAccesslogFields(t *testing.T) {
+	fields, err := ParseAccesslogFields("src.addr,dst.namespace,state")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src.addr", "dst.namespace", "state"}, fields)
+
+	_, err = ParseAccesslogFields("src.addr,sni")
+	assert.ErrorContains(t, err, `unknown accesslog field "sni"`)
+
+	_, err = ParseAccesslogFields(" , ")
+	assert.Error(t, err)
+}
+
+func TestAccesslogLocalityTier(t *testing.T) {
+	serviceCache := cache.NewServiceCache()
+	serviceCache.AddOrUpdateService(&workloadapi.Service{
+		Namespace: "default",
+		Name:      "httpbin",
+		Hostname:  "httpbin.default.svc.cluster.local",
+		Addresses: []*workloadapi.NetworkAddress{{Address: netip.MustParseAddr("10.96.0.2").AsSlice()}},
+		// PreferClose
+		LoadBalancing: &workloadapi.LoadBalancing{
+			Mode: workloadapi.LoadBalancing_FAILOVER,
+			RoutingPreference: []workloadapi.LoadBalancing_Scope{
+				workloadapi.LoadBalancing_NETWORK,
+				workloadapi.LoadBalancing_REGION,
+				workloadapi.LoadBalancing_ZONE,
+				workloadapi.LoadBalancing_SUBZONE,
+			},
+		},
+	})
+	serviceCache.AddOrUpdateService(&workloadapi.Service{
+		Namespace: "default",
+		Name:      "sleep",
+		Hostname:  "sleep.default.svc.cluster.local",
+		Addresses: []*workloadapi.NetworkAddress{{Address: netip.MustParseAddr("10.96.0.3").AsSlice()}},
+	})
+	m := MetricController{
+		workloadCache: cache.NewWorkloadCache(),
+		serviceCache:  serviceCache,
+	}
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+
+	connect := func(service, backend string, tier uint32) string {
+		data := &requestMetric{
+			conSrcDstInfo: connectionSrcDst{
+				src:       [4]uint32{nets.ConvertIpToUint32("10.244.0.1")},
+				dst:       [4]uint32{nets.ConvertIpToUint32(backend)},
+				dstPort:   80,
+				direction: 2,
+			},
+			origDstAddr:  [4]uint32{nets.ConvertIpToUint32(service)},
+			origDstPort:  80,
+			localityTier: tier,
+		}
+		_, accesslog := m.buildServiceMetric(data)
+		return buildAccesslog(*data, connMetric{}, accesslog)
+	}
+
+	// the backends of the local subzone are picked while they are healthy
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.0.2", 1), ", protocol=tcp, locality_tier=local"))
+	// then the connections fail over to the ones of the zone, of the region and of the network
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.1.2", 2), ", protocol=tcp, locality_tier=zone"))
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.2.2", 3), ", protocol=tcp, locality_tier=region"))
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.3.2", 4), ", protocol=tcp, locality_tier=network"))
+	// and eventually to the ones sharing nothing with the client
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.4.2", 5), ", protocol=tcp, locality_tier=remote"))
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.5.2", 6), ", protocol=tcp, locality_tier=remote-cluster"))
+	assert.True(t, strings.HasSuffix(connect("10.96.0.2", "10.244.6.2", 7), ", protocol=tcp, locality_tier=unknown"))
+	// the connections not balanced by locality have no tier
+	assert.True(t, strings.HasSuffix(connect("10.96.0.3", "10.244.0.3", 0), ", protocol=tcp"))
+
+	fields, err := ParseAccesslogFields("dst.addr,locality_tier")
+	require.NoError(t, err)
+	_, accesslog := m.buildServiceMetric(&requestMetric{origDstAddr: [4]uint32{nets.ConvertIpToUint32("10.96.0.3")}})
+	accesslog.fields = fields
+	assert.True(t, strings.HasSuffix(buildAccesslog(requestMetric{}, connMetric{}, accesslog), " locality_tier=-"))
+}
+
+func TestConnIdLinksVerdictAndAccesslog(t *testing.T) {
+	m := MetricController{
+		workloadCache: cache.NewWorkloadCache(),
+		serviceCache:  cache.NewServiceCache(),
+	}
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+
+	// the tcp probe of an inbound connection as the data plane reports it
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, connectionDataV4{
+		SrcAddr: nets.ConvertIpToUint32("10.244.0.1"),
+		DstAddr: nets.ConvertIpToUint32("10.244.0.2"),
+		SrcPort: 40000,
+		DstPort: 8080,
+		statistics: statistics{
+			Direction: constants.INBOUND,
+			State:     TCP_CLOSED,
+		},
+		ConnId: 0x0123456789abcdef,
+	}))
+	assert.Equal(t, tcpProbeInfoLen, buf.Len()+4)
+	data, err := buildV4Metric(&buf, map[connectionSrcDst]connMetric{})
+	require.NoError(t, err)
+	_, info := m.buildServiceMetric(&data)
+	accesslog := buildAccesslog(data, connMetric{}, info)
+
+	verdict := buildVerdictLog(osStartTime, data.connId, netip.MustParseAddrPort("10.244.0.1:40000"),
+		netip.MustParseAddrPort("10.244.0.2:8080"), false, "authorization policy default/deny-sleep")
+
+	// the verdict and the accesslog entry of the connection carry the same id
+	assert.True(t, strings.HasSuffix(accesslog, ", conn_id=0123456789abcdef"))
+	assert.Equal(t, "2024-07-04 20:14:00 +0000 UTC conn_id=0123456789abcdef, src.addr=10.244.0.1:40000, "+
+		"dst.addr=10.244.0.2:8080, verdict=DENY, reason=authorization policy default/deny-sleep", verdict)
+
+	// the connections without an id are logged without it
+	data.connId = 0
+	assert.NotContains(t, buildAccesslog(data, connMetric{}, info), "conn_id")
+}
+
 func Test_getOSBootTime(t *testing.T) {
 	t.Run("function test", func(t *testing.T) {
 		_, err := getOSBootTime()
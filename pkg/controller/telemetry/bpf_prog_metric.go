@@ -24,7 +24,8 @@ import (
 	"time"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/ringbuf"
+
+	"kmesh.net/kmesh/pkg/utils"
 )
 
 const (
@@ -76,16 +77,6 @@ func (m *BpfProgMetric) Run(ctx context.Context, KmeshPerfInfo *ebpf.Map) {
 	if m == nil {
 		return
 	}
-	readerPerformance, err := ringbuf.NewReader(KmeshPerfInfo)
-	if err != nil {
-		log.Errorf("create bpf perf ringbuf reader failed, err: %v", err)
-		return
-	}
-	defer func() {
-		if err := readerPerformance.Close(); err != nil {
-			log.Errorf("ringbuf reader close failed, err: %v", err)
-		}
-	}()
 	go func() {
 		for {
 			select {
@@ -97,32 +88,25 @@ func (m *BpfProgMetric) Run(ctx context.Context, KmeshPerfInfo *ebpf.Map) {
 			}
 		}
 	}()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			operationData := operationTimeMetric{}
-			rec := ringbuf.Record{}
-			if err := readerPerformance.ReadInto(&rec); err != nil {
-				log.Errorf("bpf perf reader failed to read, err: %v", err)
-				continue
-			}
-			if len(rec.RawSample) != OPERATION_USAGE_DATA_LEN {
-				log.Errorf("wrong length %v of a msg, should be %v", len(rec.RawSample), OPERATION_USAGE_DATA_LEN)
-				continue
-			}
-			operationData.startTime = binary.LittleEndian.Uint64(rec.RawSample[0:8])
-			operationData.endTime = binary.LittleEndian.Uint64(rec.RawSample[8:16])
-			operationData.pidTgid = binary.LittleEndian.Uint64(rec.RawSample[16:24])
-			operationData.operationType = binary.LittleEndian.Uint32(rec.RawSample[24:28])
-			operationInfo := operationDuration{
-				durations:     []uint64{operationData.endTime - operationData.startTime},
-				operationType: operationData.operationType,
-			}
-			m.updateOperationMetricCache(operationInfo, buildOperationMetricLabel(&operationData))
-		}
+	utils.NewRingbufConsumer("km_perf_info", KmeshPerfInfo, OPERATION_USAGE_DATA_LEN, m.handleOperationUsage).Run(ctx)
+}
+
+// handleOperationUsage records the duration of an operation of the bpf programs
+func (m *BpfProgMetric) handleOperationUsage(sample []byte) {
+	if len(sample) != OPERATION_USAGE_DATA_LEN {
+		log.Errorf("wrong length %v of a msg, should be %v", len(sample), OPERATION_USAGE_DATA_LEN)
+		return
+	}
+	operationData := operationTimeMetric{}
+	operationData.startTime = binary.LittleEndian.Uint64(sample[0:8])
+	operationData.endTime = binary.LittleEndian.Uint64(sample[8:16])
+	operationData.pidTgid = binary.LittleEndian.Uint64(sample[16:24])
+	operationData.operationType = binary.LittleEndian.Uint32(sample[24:28])
+	operationInfo := operationDuration{
+		durations:     []uint64{operationData.endTime - operationData.startTime},
+		operationType: operationData.operationType,
 	}
+	m.updateOperationMetricCache(operationInfo, buildOperationMetricLabel(&operationData))
 }
 
 // buildOperationMetricLabel builds the operation metrics labels using actual pod info.
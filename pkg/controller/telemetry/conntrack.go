@@ -0,0 +1,195 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+// Connection is a tcp connection tracked by the data plane
+type Connection struct {
+	Source netip.AddrPort
+	// Destination is the address the client connected to, the address of the service for
+	// the connections to a service
+	Destination netip.AddrPort
+	// Backend is the address the connection is routed to
+	Backend   netip.AddrPort
+	Direction string
+	// State is the tcp state at the last report of the data plane
+	State     string
+	StartTime time.Time
+}
+
+const (
+	// deniedConnTTL is how long a denied connection is remembered if it is never reported closed
+	deniedConnTTL = 10 * time.Minute
+	// maxDeniedConns bounds the denied connections remembered
+	maxDeniedConns = 65536
+)
+
+// authzTuple is an inbound connection as seen by the authorization
+type authzTuple struct {
+	src netip.AddrPort
+	dst netip.AddrPort
+}
+
+// ConnTracker keeps the connections the data plane reported and did not report closed yet,
+// with the backend each of them was routed to, to debug where the traffic of the services goes.
+// It also keeps the inbound connections the authorization denied, to attribute their bytes to the verdict.
+type ConnTracker struct {
+	mutex sync.Mutex
+	conns map[connectionSrcDst]*Connection
+	// denied are the inbound connections denied, with the time they were denied at
+	denied map[authzTuple]time.Time
+}
+
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{
+		conns:  make(map[connectionSrcDst]*Connection),
+		denied: make(map[authzTuple]time.Time),
+	}
+}
+
+// Deny records that the authorization denied the connection from src to dst, the bytes
+// the data plane reports for the connection are counted as denied until it is closed
+func (t *ConnTracker) Deny(src, dst netip.AddrPort) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	if len(t.denied) >= maxDeniedConns {
+		for tuple, deniedAt := range t.denied {
+			if now.Sub(deniedAt) > deniedConnTTL {
+				delete(t.denied, tuple)
+			}
+		}
+		if len(t.denied) >= maxDeniedConns {
+			log.Warnf("too many denied connections tracked, the bytes of the connection from %s to %s are counted as allowed", src, dst)
+			return
+		}
+	}
+	t.denied[authzTuple{src: unmapAddrPort(src), dst: unmapAddrPort(dst)}] = now
+}
+
+// isDenied tells whether the authorization denied the inbound connection reported,
+// the connection is forgotten once closed
+func (t *ConnTracker) isDenied(reqMetric *requestMetric) bool {
+	if t == nil || reqMetric.conSrcDstInfo.direction != constants.INBOUND {
+		return false
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(t.denied) == 0 {
+		return false
+	}
+	tuple := authzTuple{
+		src: unmapAddrPort(toAddrPort(reqMetric.conSrcDstInfo.src, reqMetric.conSrcDstInfo.srcPort)),
+		dst: unmapAddrPort(toAddrPort(reqMetric.conSrcDstInfo.dst, reqMetric.conSrcDstInfo.dstPort)),
+	}
+	_, denied := t.denied[tuple]
+	if denied && reqMetric.state == TCP_CLOSED {
+		delete(t.denied, tuple)
+	}
+	return denied
+}
+
+// observe tracks the connection reported until it is closed
+func (t *ConnTracker) observe(reqMetric *requestMetric) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if reqMetric.state == TCP_CLOSED {
+		delete(t.conns, reqMetric.conSrcDstInfo)
+		return
+	}
+	if conn, ok := t.conns[reqMetric.conSrcDstInfo]; ok {
+		conn.State = TCP_STATES[reqMetric.state]
+		return
+	}
+
+	conn := &Connection{
+		Source:      toAddrPort(reqMetric.conSrcDstInfo.src, reqMetric.conSrcDstInfo.srcPort),
+		Destination: toAddrPort(reqMetric.origDstAddr, reqMetric.origDstPort),
+		Backend:     toAddrPort(reqMetric.conSrcDstInfo.dst, reqMetric.conSrcDstInfo.dstPort),
+		Direction:   DEFAULT_UNKNOWN,
+		State:       TCP_STATES[reqMetric.state],
+		StartTime:   calculateUptime(osStartTime, reqMetric.startTime),
+	}
+	switch reqMetric.conSrcDstInfo.direction {
+	case constants.INBOUND:
+		conn.Direction = "INBOUND"
+	case constants.OUTBOUND:
+		conn.Direction = "OUTBOUND"
+	}
+	t.conns[reqMetric.conSrcDstInfo] = conn
+}
+
+// Connections returns the tracked connections from src and to dst, the oldest first. dst matches
+// both the destination and the backend of the connections, an invalid address matches any.
+func (t *ConnTracker) Connections(src, dst netip.Addr) []Connection {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	conns := make([]Connection, 0, len(t.conns))
+	for _, conn := range t.conns {
+		if src.IsValid() && conn.Source.Addr() != src {
+			continue
+		}
+		if dst.IsValid() && conn.Destination.Addr() != dst && conn.Backend.Addr() != dst {
+			continue
+		}
+		conns = append(conns, *conn)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		if !conns[i].StartTime.Equal(conns[j].StartTime) {
+			return conns[i].StartTime.Before(conns[j].StartTime)
+		}
+		return conns[i].Source.String() < conns[j].Source.String()
+	})
+	return conns
+}
+
+// toAddrPort converts an address reported by the data plane in network order
+func toAddrPort(addr [4]uint32, port uint16) netip.AddrPort {
+	var raw []byte
+	for i := range addr {
+		raw = binary.LittleEndian.AppendUint32(raw, addr[i])
+	}
+	ip, _ := netip.AddrFromSlice(restoreIPv4(raw))
+	return netip.AddrPortFrom(ip, port)
+}
+
+// unmapAddrPort converts an IPv4-mapped IPv6 address to IPv4, the way the data plane reports it
+func unmapAddrPort(addr netip.AddrPort) netip.AddrPort {
+	return netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port())
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+)
+
+// keys of the counters of km_ct_stats, as CONNTRACK_STAT_* of the bpf programs
+const (
+	conntrackStatInserted = uint32(0)
+	conntrackStatDeleted  = uint32(1)
+)
+
+// conntrackTable follows km_auth_res, the conntrack of the authz verdicts of the data plane. The kernel
+// evicts the least recently used flows of the LRU hash silently when it is full, so the evictions are
+// told apart from the flows the programs inserted, the ones they deleted and the ones left in it.
+type conntrackTable struct {
+	sampled bool
+	// evicted is how many flows were evicted since the map was created, as of the last sample
+	evicted uint64
+}
+
+type conntrackSample struct {
+	inserted   uint64
+	deleted    uint64
+	entries    uint32
+	maxEntries uint32
+}
+
+// observe returns how many flows were evicted since the last sample, and whether the table was full.
+// The verdicts the daemon writes itself are not counted as inserted, so the evictions are a lower bound.
+func (t *conntrackTable) observe(s conntrackSample) (evicted uint64, full bool) {
+	var total uint64
+	if left := s.deleted + uint64(s.entries); s.inserted > left {
+		total = s.inserted - left
+	}
+
+	switch {
+	case !t.sampled:
+		// the evictions before the daemon started are not reported
+		t.sampled = true
+	case total < t.evicted:
+		// the counters restarted with a map created anew, as when the size changed
+		evicted = total
+	default:
+		evicted = total - t.evicted
+	}
+	t.evicted = total
+
+	// the kernel keeps free entries per cpu, so the table may evict before the count reaches its size
+	full = evicted > 0 || (s.maxEntries > 0 && s.entries >= s.maxEntries)
+	return evicted, full
+}
+
+func readConntrackStats(m *ebpf.Map) (inserted, deleted uint64, err error) {
+	for key, stat := range map[uint32]*uint64{conntrackStatInserted: &inserted, conntrackStatDeleted: &deleted} {
+		var perCPU []uint64
+		if err := m.Lookup(key, &perCPU); err != nil {
+			return 0, 0, fmt.Errorf("lookup conntrack stat %d failed: %v", key, err)
+		}
+		for _, count := range perCPU {
+			*stat += count
+		}
+	}
+	return inserted, deleted, nil
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConntrackTableObserve(t *testing.T) {
+	var table conntrackTable
+
+	// the evictions before the first sample are not reported
+	evicted, full := table.observe(conntrackSample{inserted: 100, deleted: 10, entries: 80, maxEntries: 100})
+	assert.Equal(t, uint64(0), evicted)
+	assert.False(t, full)
+
+	evicted, full = table.observe(conntrackSample{inserted: 150, deleted: 20, entries: 100, maxEntries: 100})
+	assert.Equal(t, uint64(20), evicted)
+	assert.True(t, full)
+
+	// the flows inserted were all deleted, nothing was evicted
+	evicted, full = table.observe(conntrackSample{inserted: 160, deleted: 30, entries: 100, maxEntries: 100})
+	assert.Equal(t, uint64(0), evicted)
+	assert.True(t, full)
+
+	evicted, full = table.observe(conntrackSample{inserted: 170, deleted: 70, entries: 70, maxEntries: 100})
+	assert.Equal(t, uint64(0), evicted)
+	assert.False(t, full)
+
+	// the map was created anew, its counters restarted
+	evicted, full = table.observe(conntrackSample{inserted: 20, deleted: 0, entries: 10, maxEntries: 10})
+	assert.Equal(t, uint64(10), evicted)
+	assert.True(t, full)
+}
+
+func TestConntrackTableEviction(t *testing.T) {
+	const maxEntries = 128
+	m, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "km_auth_res",
+		Type:       ebpf.LRUHash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: maxEntries,
+	})
+	if err != nil {
+		t.Skipf("create bpf map failed: %v", err)
+	}
+	defer m.Close()
+
+	var table conntrackTable
+	_, full := table.observe(conntrackSample{maxEntries: maxEntries})
+	require.False(t, full)
+
+	// new flows are still tracked once the table is full, the idle ones being evicted
+	const flows = 4 * maxEntries
+	for flow := uint32(0); flow < flows; flow++ {
+		require.NoError(t, m.Put(flow, uint32(0)), "track flow %d", flow)
+	}
+
+	entries, err := getMapEntryCountFallback(m)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, entries, uint32(maxEntries))
+	var verdict uint32
+	assert.Error(t, m.Lookup(uint32(0), &verdict), "the oldest idle flow is evicted")
+	assert.NoError(t, m.Lookup(uint32(flows-1), &verdict), "the latest flow is kept")
+
+	evicted, full := table.observe(conntrackSample{inserted: flows, entries: entries, maxEntries: maxEntries})
+	assert.Equal(t, uint64(flows-entries), evicted)
+	assert.True(t, full)
+}
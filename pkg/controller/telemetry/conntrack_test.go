@@ -0,0 +1,131 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+func TestConnTracker(t *testing.T) {
+	// 10.244.0.5, 10.244.1.3, 10.96.0.10 and 10.244.2.7 in network order
+	client := uint32(0x05_00_f4_0a)
+	backend1 := uint32(0x03_01_f4_0a)
+	service := uint32(0x0a_00_60_0a)
+	backend2 := uint32(0x07_02_f4_0a)
+	report := func(tracker *ConnTracker, srcPort uint16, dst uint32, state uint32, startTime uint64) {
+		tracker.observe(&requestMetric{
+			conSrcDstInfo: connectionSrcDst{src: [4]uint32{client}, dst: [4]uint32{dst}, srcPort: srcPort, dstPort: 8080, direction: constants.OUTBOUND},
+			origDstAddr:   [4]uint32{service},
+			origDstPort:   80,
+			state:         state,
+			startTime:     startTime,
+		})
+	}
+
+	tracker := NewConnTracker()
+	report(tracker, 40001, backend1, TCP_ESTABLISHED, 2)
+	report(tracker, 40002, backend2, TCP_ESTABLISHED, 1)
+	report(tracker, 40003, backend2, TCP_ESTABLISHED, 3)
+	// reported again while closing
+	report(tracker, 40001, backend1, 4, 2)
+	report(tracker, 40003, backend2, TCP_CLOSED, 3)
+
+	conns := tracker.Connections(netip.Addr{}, netip.Addr{})
+	assert.Equal(t, []Connection{
+		{
+			Source:      netip.MustParseAddrPort("10.244.0.5:40002"),
+			Destination: netip.MustParseAddrPort("10.96.0.10:80"),
+			Backend:     netip.MustParseAddrPort("10.244.2.7:8080"),
+			Direction:   "OUTBOUND",
+			State:       "BPF_TCP_ESTABLISHED",
+			StartTime:   calculateUptime(osStartTime, 1),
+		},
+		{
+			Source:      netip.MustParseAddrPort("10.244.0.5:40001"),
+			Destination: netip.MustParseAddrPort("10.96.0.10:80"),
+			Backend:     netip.MustParseAddrPort("10.244.1.3:8080"),
+			Direction:   "OUTBOUND",
+			State:       "BPF_TCP_FIN_WAIT1",
+			StartTime:   calculateUptime(osStartTime, 2),
+		},
+	}, conns)
+
+	// dst matches the service and the backends
+	assert.Len(t, tracker.Connections(netip.MustParseAddr("10.244.0.5"), netip.MustParseAddr("10.96.0.10")), 2)
+	conns = tracker.Connections(netip.Addr{}, netip.MustParseAddr("10.244.1.3"))
+	assert.Len(t, conns, 1)
+	assert.Equal(t, uint16(40001), conns[0].Source.Port())
+	assert.Empty(t, tracker.Connections(netip.MustParseAddr("10.244.1.3"), netip.Addr{}))
+}
+
+func TestAuthzBytes(t *testing.T) {
+	// 10.244.0.5 and 10.244.1.3 in network order
+	client := uint32(0x05_00_f4_0a)
+	server := uint32(0x03_01_f4_0a)
+
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/authz-ns/server",
+		Name:      "server",
+		Namespace: "authz-ns",
+		Addresses: [][]byte{netip.MustParseAddr("10.244.1.3").AsSlice()},
+	})
+	m := NewMetric(workloadCache, cache.NewServiceCache(), true)
+	report := func(srcPort uint16, state uint32, sent, received uint32) {
+		reqMetric := &requestMetric{
+			conSrcDstInfo: connectionSrcDst{src: [4]uint32{client}, dst: [4]uint32{server}, srcPort: srcPort, dstPort: 8080, direction: constants.INBOUND},
+			state:         state,
+			sentBytes:     sent,
+			receivedBytes: received,
+		}
+		m.countAuthzBytes(reqMetric, m.ConnTracker.isDenied(reqMetric))
+	}
+
+	allowed := authzAllowedBytes.WithLabelValues("authz-ns", "server")
+	denied := authzDeniedBytes.WithLabelValues("authz-ns", "server")
+	allowedBefore, deniedBefore := testutil.ToFloat64(allowed), testutil.ToFloat64(denied)
+
+	// the denied connection is reported by the authorization as an IPv4-mapped address
+	m.ConnTracker.Deny(netip.MustParseAddrPort("[::ffff:10.244.0.5]:40002"), netip.MustParseAddrPort("10.244.1.3:8080"))
+	report(40001, TCP_ESTABLISHED, 100, 1000)
+	report(40002, TCP_ESTABLISHED, 0, 30)
+	report(40001, TCP_CLOSED, 10, 0)
+	report(40002, TCP_CLOSED, 0, 20)
+	assert.Equal(t, float64(1110), testutil.ToFloat64(allowed)-allowedBefore)
+	assert.Equal(t, float64(50), testutil.ToFloat64(denied)-deniedBefore)
+
+	// the denied connection is forgotten once closed, the port can be reused by an allowed one
+	assert.Empty(t, m.ConnTracker.denied)
+	report(40002, TCP_CLOSED, 0, 5)
+	assert.Equal(t, float64(1115), testutil.ToFloat64(allowed)-allowedBefore)
+
+	// the outbound connections are counted by the server side only
+	m.countAuthzBytes(&requestMetric{
+		conSrcDstInfo: connectionSrcDst{src: [4]uint32{client}, dst: [4]uint32{server}, srcPort: 40003, dstPort: 8080, direction: constants.OUTBOUND},
+		state:         TCP_CLOSED,
+		sentBytes:     100,
+	}, false)
+	assert.Equal(t, float64(1115), testutil.ToFloat64(allowed)-allowedBefore)
+}
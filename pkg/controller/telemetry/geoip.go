@@ -0,0 +1,116 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIPRecord is the location of a network
+type geoIPRecord struct {
+	// country is the ISO 3166-1 code of the country, e.g. US
+	country string
+	// asn is the number of the autonomous system, 0 if unknown
+	asn uint32
+}
+
+// mmdbRecord holds the fields of the MaxMind databases a geoIPRecord is made of, the country ones are set in the
+// GeoLite2/GeoIP2 Country and City databases, the autonomous system one in the GeoLite2/GeoIP2 ASN databases
+type mmdbRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	// RegisteredCountry is the country the network is registered in, used when the country is unknown
+	RegisteredCountry struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+	AutonomousSystemNumber uint32 `maxminddb:"autonomous_system_number"`
+}
+
+// GeoIPDatabase locates the external addresses the connections go to. It is loaded from MaxMind DB files, as
+// the GeoLite2 Country and ASN databases, each address is looked up in all of them and the first one knowing
+// its country, or its autonomous system, wins.
+type GeoIPDatabase struct {
+	readers []*maxminddb.Reader
+}
+
+// LoadGeoIPDatabase opens the MaxMind DB files at paths
+func LoadGeoIPDatabase(paths ...string) (*GeoIPDatabase, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no geoip database")
+	}
+	db := &GeoIPDatabase{}
+	for _, path := range paths {
+		reader, err := maxminddb.Open(path)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to load geoip database %s: %v", path, err)
+		}
+		db.readers = append(db.readers, reader)
+	}
+	return db, nil
+}
+
+// lookup returns the location of addr
+func (db *GeoIPDatabase) lookup(addr netip.Addr) (geoIPRecord, bool) {
+	if db == nil || !addr.IsValid() {
+		return geoIPRecord{}, false
+	}
+	ip := net.IP(addr.Unmap().AsSlice())
+	var record geoIPRecord
+	found := false
+	for _, reader := range db.readers {
+		var r mmdbRecord
+		if _, ok, err := reader.LookupNetwork(ip, &r); err != nil || !ok {
+			continue
+		}
+		if record.country == "" {
+			record.country = r.Country.IsoCode
+			if record.country == "" {
+				record.country = r.RegisteredCountry.IsoCode
+			}
+		}
+		if record.asn == 0 {
+			record.asn = r.AutonomousSystemNumber
+		}
+		found = true
+	}
+	record.country = strings.ToUpper(record.country)
+	return record, found && (record.country != "" || record.asn != 0)
+}
+
+// String lists the types of the databases, e.g. GeoLite2-Country, GeoLite2-ASN
+func (db *GeoIPDatabase) String() string {
+	types := make([]string, 0, len(db.readers))
+	for _, reader := range db.readers {
+		types = append(types, reader.Metadata.DatabaseType)
+	}
+	return strings.Join(types, ", ")
+}
+
+// Close releases the database files
+func (db *GeoIPDatabase) Close() {
+	for _, reader := range db.readers {
+		_ = reader.Close()
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/nets"
+)
+
+// writeMockMMDB writes a MaxMind DB of the given type with the records of the networks
+func writeMockMMDB(t *testing.T, databaseType string, networks map[string]mmdbtype.Map) string {
+	writer, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: databaseType, RecordSize: 24})
+	require.NoError(t, err)
+	for cidr, record := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		require.NoError(t, writer.Insert(network, record))
+	}
+	path := filepath.Join(t.TempDir(), databaseType+".mmdb")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = writer.WriteTo(f)
+	require.NoError(t, err)
+	return path
+}
+
+func country(isoCode string) mmdbtype.Map {
+	return mmdbtype.Map{"country": mmdbtype.Map{"iso_code": mmdbtype.String(isoCode)}}
+}
+
+func asn(number uint32) mmdbtype.Map {
+	return mmdbtype.Map{"autonomous_system_number": mmdbtype.Uint32(number)}
+}
+
+// loadMockGeoIPDatabase loads a mock of the GeoLite2 Country and ASN databases
+func loadMockGeoIPDatabase(t *testing.T) *GeoIPDatabase {
+	countries := writeMockMMDB(t, "GeoLite2-Country", map[string]mmdbtype.Map{
+		"8.8.0.0/16":     country("US"),
+		"1.1.1.0/24":     country("AU"),
+		"2001:4860::/32": country("US"),
+		// only the country the network is registered in is known
+		"9.9.9.0/24": {"registered_country": mmdbtype.Map{"iso_code": mmdbtype.String("CH")}},
+	})
+	asns := writeMockMMDB(t, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"8.8.8.0/24":     asn(15169),
+		"2001:4860::/32": asn(15169),
+		"9.9.9.0/24":     asn(19281),
+		"4.4.0.0/16":     asn(3356),
+	})
+	db, err := LoadGeoIPDatabase(countries, asns)
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestGeoIPDatabase(t *testing.T) {
+	db := loadMockGeoIPDatabase(t)
+	assert.Equal(t, "GeoLite2-Country, GeoLite2-ASN", db.String())
+
+	tests := []struct {
+		addr  string
+		found bool
+		want  geoIPRecord
+	}{
+		{addr: "8.8.8.8", found: true, want: geoIPRecord{country: "US", asn: 15169}},
+		{addr: "8.8.4.4", found: true, want: geoIPRecord{country: "US"}},
+		{addr: "1.1.1.1", found: true, want: geoIPRecord{country: "AU"}},
+		{addr: "4.4.4.4", found: true, want: geoIPRecord{asn: 3356}},
+		{addr: "2001:4860:4860::8888", found: true, want: geoIPRecord{country: "US", asn: 15169}},
+		{addr: "9.9.9.9", found: true, want: geoIPRecord{country: "CH", asn: 19281}},
+		{addr: "::ffff:8.8.8.8", found: true, want: geoIPRecord{country: "US", asn: 15169}},
+		{addr: "10.244.0.1", found: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			record, found := db.lookup(netip.MustParseAddr(tt.addr))
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.want, record)
+		})
+	}
+
+	_, err := LoadGeoIPDatabase(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.Error(t, err)
+	notMMDB := filepath.Join(t.TempDir(), "geoip.csv")
+	require.NoError(t, os.WriteFile(notMMDB, []byte("8.8.8.0/24,US,15169\n"), 0o644))
+	_, err = LoadGeoIPDatabase(notMMDB)
+	assert.Error(t, err)
+}
+
+func TestAccesslogGeoIPEnrichment(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Namespace: "default",
+		Name:      "sleep",
+		Addresses: [][]byte{{10, 19, 25, 33}},
+	})
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Namespace: "default",
+		Name:      "httpbin",
+		Addresses: [][]byte{{8, 8, 8, 9}},
+	})
+	m := MetricController{
+		workloadCache: workloadCache,
+		serviceCache:  cache.NewServiceCache(),
+		GeoIP:         loadMockGeoIPDatabase(t),
+	}
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+
+	outbound := func(dst string) string {
+		data := &requestMetric{
+			conSrcDstInfo: connectionSrcDst{
+				src:       [4]uint32{nets.ConvertIpToUint32("10.19.25.33"), 0, 0, 0},
+				dst:       [4]uint32{nets.ConvertIpToUint32(dst), 0, 0, 0},
+				dstPort:   443,
+				direction: uint32(2),
+			},
+			origDstAddr: [4]uint32{nets.ConvertIpToUint32(dst), 0, 0, 0},
+			origDstPort: 443,
+		}
+		_, accesslog := m.buildServiceMetric(data)
+		return buildAccesslog(*data, connMetric{}, accesslog)
+	}
+
+	// the external destination is located
+	assert.True(t, strings.HasSuffix(outbound("8.8.8.8"), ", protocol=tcp, dst.country=US, dst.asn=AS15169"))
+	// a destination in the mesh is not, even with an address in the database
+	assert.True(t, strings.HasSuffix(outbound("8.8.8.9"), ", protocol=tcp"))
+	// nor one missing from the database
+	assert.True(t, strings.HasSuffix(outbound("10.96.0.10"), ", protocol=tcp"))
+
+	// the fields can be chosen like the others
+	_, accesslog := m.buildServiceMetric(&requestMetric{
+		conSrcDstInfo: connectionSrcDst{
+			src: [4]uint32{nets.ConvertIpToUint32("10.19.25.33"), 0, 0, 0},
+			dst: [4]uint32{nets.ConvertIpToUint32("1.1.1.1"), 0, 0, 0},
+		},
+	})
+	fields, err := ParseAccesslogFields("dst.addr,dst.country,dst.asn")
+	require.NoError(t, err)
+	accesslog.fields = fields
+	assert.True(t, strings.HasSuffix(buildAccesslog(requestMetric{}, connMetric{}, accesslog), " dst.addr=1.1.1.1:0, dst.country=AU, dst.asn=-"))
+}
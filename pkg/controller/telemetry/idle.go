@@ -0,0 +1,172 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"net/netip"
+	"sync"
+	"time"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+const (
+	idleReapInterval = 5 * time.Second
+	// connections which carried no data for that long are counted as idle
+	idleThreshold = 5 * time.Second
+)
+
+// SocketID identifies a tcp socket from the point of view of its owner
+type SocketID struct {
+	Local  netip.AddrPort
+	Remote netip.AddrPort
+}
+
+// SocketOperator inspects and closes the sockets of the workloads on the node
+type SocketOperator interface {
+	// IdleTimes returns how long each of the sockets bound to the local address carried no data,
+	// the sockets which no longer exist are left out
+	IdleTimes(local netip.Addr, sockets []SocketID) (map[SocketID]time.Duration, error)
+	// Destroy closes the socket, the peer is reset
+	Destroy(id SocketID) error
+}
+
+// IdleReaper closes the connections of the services with an idle timeout once
+// they carried no data for that long. The data plane reports such connections
+// on establishment and close, the activity is read from the kernel tcp info.
+type IdleReaper struct {
+	mutex sync.Mutex
+	// tracked connections and their idle timeout
+	conns map[SocketID]time.Duration
+	ops   SocketOperator
+}
+
+func NewIdleReaper(ops SocketOperator) *IdleReaper {
+	return &IdleReaper{
+		conns: make(map[SocketID]time.Duration),
+		ops:   ops,
+	}
+}
+
+// observe tracks the outbound connections reported with an idle timeout until they are closed
+func (r *IdleReaper) observe(reqMetric *requestMetric) {
+	if r == nil || reqMetric.idleTimeout == 0 || reqMetric.conSrcDstInfo.direction != constants.OUTBOUND {
+		return
+	}
+
+	var srcAddr, dstAddr []byte
+	for i := range reqMetric.conSrcDstInfo.dst {
+		srcAddr = binary.LittleEndian.AppendUint32(srcAddr, reqMetric.conSrcDstInfo.src[i])
+		dstAddr = binary.LittleEndian.AppendUint32(dstAddr, reqMetric.conSrcDstInfo.dst[i])
+	}
+	srcIp, _ := netip.AddrFromSlice(restoreIPv4(srcAddr))
+	dstIp, _ := netip.AddrFromSlice(restoreIPv4(dstAddr))
+	id := SocketID{
+		Local:  netip.AddrPortFrom(srcIp, reqMetric.conSrcDstInfo.srcPort),
+		Remote: netip.AddrPortFrom(dstIp, reqMetric.conSrcDstInfo.dstPort),
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch reqMetric.state {
+	case TCP_ESTABLISHED:
+		r.conns[id] = time.Duration(reqMetric.idleTimeout) * time.Millisecond
+	case TCP_CLOSED:
+		delete(r.conns, id)
+	}
+}
+
+func (r *IdleReaper) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+
+	ticker := time.NewTicker(idleReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			active, idle, closed := r.reap()
+			idleTimeoutConnections.WithLabelValues("active").Set(float64(active))
+			idleTimeoutConnections.WithLabelValues("idle").Set(float64(idle))
+			idleTimeoutConnectionsClosed.Add(float64(closed))
+		}
+	}
+}
+
+// reap closes the connections idle for longer than their timeout, it returns
+// the number of the remaining active and idle connections and of the closed ones
+func (r *IdleReaper) reap() (active, idle, closed int) {
+	byLocal := make(map[netip.Addr][]SocketID)
+	r.mutex.Lock()
+	for id := range r.conns {
+		byLocal[id.Local.Addr()] = append(byLocal[id.Local.Addr()], id)
+	}
+	r.mutex.Unlock()
+
+	for local, ids := range byLocal {
+		idleTimes, err := r.ops.IdleTimes(local, ids)
+		if err != nil {
+			log.Warnf("failed to get the idle time of the connections of %s: %v", local, err)
+			continue
+		}
+
+		var expired []SocketID
+		r.mutex.Lock()
+		for _, id := range ids {
+			timeout, ok := r.conns[id]
+			if !ok {
+				// closed meanwhile
+				continue
+			}
+			idleTime, ok := idleTimes[id]
+			if !ok {
+				// the close report was lost, e.g. the ringbuf was full
+				delete(r.conns, id)
+				continue
+			}
+
+			switch {
+			case idleTime >= timeout:
+				expired = append(expired, id)
+			case idleTime >= idleThreshold:
+				idle++
+			default:
+				active++
+			}
+		}
+		r.mutex.Unlock()
+
+		for _, id := range expired {
+			if err := r.ops.Destroy(id); err != nil {
+				log.Warnf("failed to close idle connection %s -> %s: %v", id.Local, id.Remote, err)
+				idle++
+				continue
+			}
+			log.Debugf("closed idle connection %s -> %s", id.Local, id.Remote)
+			r.mutex.Lock()
+			delete(r.conns, id)
+			r.mutex.Unlock()
+			closed++
+		}
+	}
+	return active, idle, closed
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+
+	netns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+)
+
+// NetnsSocketOperator operates on the sockets from within the network namespace of the workload owning them
+type NetnsSocketOperator struct {
+	// NetnsPath returns the network namespace path of the local workload with the address
+	NetnsPath func(addr netip.Addr) (string, error)
+
+	mutex sync.Mutex
+	paths map[netip.Addr]string
+}
+
+func NewNetnsSocketOperator(netnsPath func(addr netip.Addr) (string, error)) *NetnsSocketOperator {
+	return &NetnsSocketOperator{
+		NetnsPath: netnsPath,
+		paths:     make(map[netip.Addr]string),
+	}
+}
+
+// withNetns runs fn in the network namespace of the local address,
+// the namespace is resolved again next time if it failed
+func (o *NetnsSocketOperator) withNetns(local netip.Addr, fn func() error) error {
+	o.mutex.Lock()
+	path, ok := o.paths[local]
+	o.mutex.Unlock()
+	if !ok {
+		var err error
+		if path, err = o.NetnsPath(local); err != nil {
+			return err
+		}
+		o.mutex.Lock()
+		o.paths[local] = path
+		o.mutex.Unlock()
+	}
+
+	err := netns.WithNetNSPath(path, func(_ netns.NetNS) error {
+		return fn()
+	})
+	if err != nil {
+		o.mutex.Lock()
+		delete(o.paths, local)
+		o.mutex.Unlock()
+	}
+	return err
+}
+
+func (o *NetnsSocketOperator) IdleTimes(local netip.Addr, sockets []SocketID) (map[SocketID]time.Duration, error) {
+	wanted := make(map[SocketID]struct{}, len(sockets))
+	for _, id := range sockets {
+		wanted[id] = struct{}{}
+	}
+
+	idleTimes := make(map[SocketID]time.Duration, len(sockets))
+	err := o.withNetns(local, func() error {
+		// ipv4 connections can also be made from ipv6 sockets
+		for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+			infos, err := netlink.SocketDiagTCPInfo(family)
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if info.InetDiagMsg == nil || info.TCPInfo == nil {
+					continue
+				}
+				src, _ := netip.AddrFromSlice(info.InetDiagMsg.ID.Source)
+				dst, _ := netip.AddrFromSlice(info.InetDiagMsg.ID.Destination)
+				id := SocketID{
+					Local:  netip.AddrPortFrom(src.Unmap(), info.InetDiagMsg.ID.SourcePort),
+					Remote: netip.AddrPortFrom(dst.Unmap(), info.InetDiagMsg.ID.DestinationPort),
+				}
+				if _, ok := wanted[id]; !ok {
+					continue
+				}
+				// the kernel tracks in ms how long ago data was last sent and received
+				idle := min(info.TCPInfo.Last_data_sent, info.TCPInfo.Last_data_recv)
+				idleTimes[id] = time.Duration(idle) * time.Millisecond
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idleTimes, nil
+}
+
+// InboundSockets returns the established sockets bound to the local address that were accepted
+// on a listening port, which are the inbound connections of the workload
+func (o *NetnsSocketOperator) InboundSockets(local netip.Addr) ([]SocketID, error) {
+	var sockets []SocketID
+	err := o.withNetns(local, func() error {
+		listening := make(map[uint16]struct{})
+		var established []SocketID
+		// ipv4 connections can also be accepted by ipv6 sockets
+		for _, family := range []uint8{unix.AF_INET, unix.AF_INET6} {
+			infos, err := netlink.SocketDiagTCPInfo(family)
+			if err != nil {
+				return err
+			}
+			for _, info := range infos {
+				if info.InetDiagMsg == nil {
+					continue
+				}
+				msg := info.InetDiagMsg
+				switch msg.State {
+				case netlink.TCP_LISTEN:
+					listening[msg.ID.SourcePort] = struct{}{}
+				case netlink.TCP_ESTABLISHED:
+					src, _ := netip.AddrFromSlice(msg.ID.Source)
+					dst, _ := netip.AddrFromSlice(msg.ID.Destination)
+					if src.Unmap() != local.Unmap() {
+						continue
+					}
+					established = append(established, SocketID{
+						Local:  netip.AddrPortFrom(src.Unmap(), msg.ID.SourcePort),
+						Remote: netip.AddrPortFrom(dst.Unmap(), msg.ID.DestinationPort),
+					})
+				}
+			}
+		}
+		for _, id := range established {
+			if _, ok := listening[id.Local.Port()]; ok {
+				sockets = append(sockets, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sockets, nil
+}
+
+func (o *NetnsSocketOperator) Destroy(id SocketID) error {
+	return o.withNetns(id.Local.Addr(), func() error {
+		if !id.Local.Addr().Is4() {
+			return destroySocket(unix.AF_INET6, id)
+		}
+		err := destroySocket(unix.AF_INET, id)
+		if !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+		// the ipv4 connections of an ipv6 socket have ipv4-mapped ipv6 addresses
+		return destroySocket(unix.AF_INET6, SocketID{
+			Local:  netip.AddrPortFrom(netip.AddrFrom16(id.Local.Addr().As16()), id.Local.Port()),
+			Remote: netip.AddrPortFrom(netip.AddrFrom16(id.Remote.Addr().As16()), id.Remote.Port()),
+		})
+	})
+}
+
+// destroySocket closes the tcp socket of the family with SOCK_DESTROY,
+// netlink.SocketDestroy only supports the ipv4 ones
+func destroySocket(family uint8, id SocketID) error {
+	req := nl.NewNetlinkRequest(nl.SOCK_DESTROY, unix.NLM_F_ACK)
+	req.AddData(&socketDestroyRequest{family: family, id: id})
+	_, err := req.Execute(unix.NETLINK_INET_DIAG, 0)
+	return err
+}
+
+// socketDestroyRequest is the inet_diag_req_v2 identifying the tcp socket to destroy
+type socketDestroyRequest struct {
+	family uint8
+	id     SocketID
+}
+
+const sizeofSocketDestroyRequest = 56
+
+func (r *socketDestroyRequest) Len() int { return sizeofSocketDestroyRequest }
+
+func (r *socketDestroyRequest) Serialize() []byte {
+	b := make([]byte, sizeofSocketDestroyRequest)
+	b[0] = r.family
+	b[1] = unix.IPPROTO_TCP
+	// the extensions, padding and states are not used to find the socket
+	binary.BigEndian.PutUint16(b[8:10], r.id.Local.Port())
+	binary.BigEndian.PutUint16(b[10:12], r.id.Remote.Port())
+	// the ipv4 addresses take the first 4 bytes of the 16 bytes of an address
+	copy(b[12:28], r.id.Local.Addr().AsSlice())
+	copy(b[28:44], r.id.Remote.Addr().AsSlice())
+	// any interface, no cookie
+	binary.NativeEndian.PutUint32(b[48:52], nl.TCPDIAG_NOCOOKIE)
+	binary.NativeEndian.PutUint32(b[52:56], nl.TCPDIAG_NOCOOKIE)
+	return b
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+type fakeSocketOperator struct {
+	idleTimes map[SocketID]time.Duration
+	destroyed []SocketID
+}
+
+func (f *fakeSocketOperator) IdleTimes(local netip.Addr, sockets []SocketID) (map[SocketID]time.Duration, error) {
+	return f.idleTimes, nil
+}
+
+func (f *fakeSocketOperator) Destroy(id SocketID) error {
+	f.destroyed = append(f.destroyed, id)
+	delete(f.idleTimes, id)
+	return nil
+}
+
+// connReport builds the report of an outbound ipv4 connection
+// addrWords returns the address in the words of the bpf reports, an ipv4 address takes the first one
+func addrWords(addr netip.Addr) [4]uint32 {
+	var words [4]uint32
+	b := addr.AsSlice()
+	for i := 0; i < len(b); i += 4 {
+		words[i/4] = binary.LittleEndian.Uint32(b[i:])
+	}
+	return words
+}
+
+func connReport(id SocketID, state uint32, idleTimeout time.Duration) *requestMetric {
+	return &requestMetric{
+		conSrcDstInfo: connectionSrcDst{
+			src:       addrWords(id.Local.Addr()),
+			dst:       addrWords(id.Remote.Addr()),
+			srcPort:   id.Local.Port(),
+			dstPort:   id.Remote.Port(),
+			direction: constants.OUTBOUND,
+		},
+		state:       state,
+		idleTimeout: uint32(idleTimeout.Milliseconds()),
+	}
+}
+
+func TestIdleReaper(t *testing.T) {
+	active := SocketID{Local: netip.MustParseAddrPort("10.244.0.5:40001"), Remote: netip.MustParseAddrPort("10.244.1.3:8080")}
+	idle := SocketID{Local: netip.MustParseAddrPort("10.244.0.5:40002"), Remote: netip.MustParseAddrPort("10.244.1.3:8080")}
+	expired := SocketID{Local: netip.MustParseAddrPort("10.244.0.5:40003"), Remote: netip.MustParseAddrPort("10.244.1.3:8080")}
+	untracked := SocketID{Local: netip.MustParseAddrPort("10.244.0.5:40004"), Remote: netip.MustParseAddrPort("10.244.1.3:8080")}
+	gone := SocketID{Local: netip.MustParseAddrPort("10.244.0.5:40005"), Remote: netip.MustParseAddrPort("10.244.1.3:8080")}
+
+	ops := &fakeSocketOperator{
+		idleTimes: map[SocketID]time.Duration{
+			active:    time.Second,
+			idle:      time.Minute,
+			expired:   6 * time.Minute,
+			untracked: time.Hour,
+		},
+	}
+	r := NewIdleReaper(ops)
+	for _, id := range []SocketID{active, idle, expired, gone} {
+		r.observe(connReport(id, TCP_ESTABLISHED, 5*time.Minute))
+	}
+	// no idle timeout
+	r.observe(connReport(untracked, TCP_ESTABLISHED, 0))
+
+	activeCount, idleCount, closedCount := r.reap()
+	assert.Equal(t, 1, activeCount)
+	assert.Equal(t, 1, idleCount)
+	assert.Equal(t, 1, closedCount)
+	assert.Equal(t, []SocketID{expired}, ops.destroyed)
+	assert.Len(t, r.conns, 2)
+
+	r.observe(connReport(idle, TCP_CLOSED, 5*time.Minute))
+	activeCount, idleCount, closedCount = r.reap()
+	assert.Equal(t, 1, activeCount)
+	assert.Equal(t, 0, idleCount)
+	assert.Equal(t, 0, closedCount)
+}
+
+// TestIdleReaperCloseConnection opens a real ipv4 and ipv6 connection on the loopback
+// and checks it is reset once idle for longer than the timeout
+func TestIdleReaperCloseConnection(t *testing.T) {
+	for _, tc := range []struct {
+		network string
+		address string
+	}{
+		{network: "tcp4", address: "127.0.0.1:0"},
+		{network: "tcp6", address: "[::1]:0"},
+	} {
+		t.Run(tc.network, func(t *testing.T) {
+			lis, err := net.Listen(tc.network, tc.address)
+			if err != nil {
+				t.Skipf("%s not available: %v", tc.network, err)
+			}
+			defer lis.Close()
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				conn, err := lis.Accept()
+				if err == nil {
+					accepted <- conn
+				}
+			}()
+
+			conn, err := net.Dial(tc.network, lis.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+			serverConn := <-accepted
+			defer serverConn.Close()
+
+			id := SocketID{
+				Local:  conn.LocalAddr().(*net.TCPAddr).AddrPort(),
+				Remote: conn.RemoteAddr().(*net.TCPAddr).AddrPort(),
+			}
+			ops := NewNetnsSocketOperator(func(netip.Addr) (string, error) {
+				return "/proc/self/ns/net", nil
+			})
+			r := NewIdleReaper(ops)
+			r.observe(connReport(id, TCP_ESTABLISHED, time.Second))
+
+			// data keeps the connection open
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			_, _, closedCount := r.reap()
+			assert.Equal(t, 0, closedCount)
+
+			time.Sleep(1100 * time.Millisecond)
+			if _, err := ops.IdleTimes(id.Local.Addr(), []SocketID{id}); err != nil {
+				t.Skipf("sock diag not available: %v", err)
+			}
+			if err := ops.Destroy(SocketID{Local: netip.MustParseAddrPort("127.0.0.1:1"), Remote: netip.MustParseAddrPort("127.0.0.1:2")}); errors.Is(err, unix.EPERM) || errors.Is(err, unix.EOPNOTSUPP) {
+				t.Skipf("closing sockets is not permitted: %v", err)
+			}
+			_, _, closedCount = r.reap()
+			assert.Equal(t, 1, closedCount)
+
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			assert.ErrorIs(t, err, unix.ECONNABORTED)
+		})
+	}
+}
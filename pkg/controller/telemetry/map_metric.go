@@ -31,6 +31,7 @@ const (
 )
 
 type MapMetricController struct {
+	conntrack conntrackTable
 }
 
 type MapInfo struct {
@@ -47,7 +48,9 @@ func NewMapMetric() *MapMetricController {
 	return &MapMetricController{}
 }
 
-func (m *MapMetricController) Run(ctx context.Context) {
+// Run samples the maps of the node, along with conntrack, the conntrack of the authz verdicts, and
+// conntrackStats, its counters
+func (m *MapMetricController) Run(ctx context.Context, conntrack, conntrackStats *ebpf.Map) {
 	if m == nil {
 		return
 	}
@@ -60,6 +63,7 @@ func (m *MapMetricController) Run(ctx context.Context) {
 			default:
 				time.Sleep(mapMetricFlushInterval)
 				m.updatePrometheusMetric()
+				m.updateConntrackMetric(conntrack, conntrackStats)
 			}
 		}
 	}()
@@ -114,6 +118,27 @@ func (m *MapMetricController) updatePrometheusMetric() {
 	mapCountInNode.With(mapCountLabels).Set(float64(count))
 }
 
+func (m *MapMetricController) updateConntrackMetric(conntrack, conntrackStats *ebpf.Map) {
+	if conntrack == nil || conntrackStats == nil {
+		return
+	}
+	sample := conntrackSample{maxEntries: conntrack.MaxEntries()}
+	var err error
+	if sample.entries, err = getMapEntryCountFallback(conntrack); err != nil {
+		log.Warnf("count the conntrack entries failed: %v", err)
+		return
+	}
+	if sample.inserted, sample.deleted, err = readConntrackStats(conntrackStats); err != nil {
+		log.Warnf("read the conntrack stats failed: %v", err)
+		return
+	}
+	evicted, full := m.conntrack.observe(sample)
+	conntrackEvictions.Add(float64(evicted))
+	if full {
+		conntrackFull.Inc()
+	}
+}
+
 func getNextMapInfo(startID ebpf.MapID) (ebpf.MapID, *ebpf.Map, *ebpf.MapInfo, error) {
 	mapID, err := ebpf.MapGetNextID(startID)
 	if err != nil {
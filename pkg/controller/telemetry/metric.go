@@ -29,11 +29,12 @@ import (
 	"unsafe"
 
 	"github.com/cilium/ebpf"
-	"github.com/cilium/ebpf/ringbuf"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/trace"
 	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/utils"
 )
 
 const (
@@ -43,6 +44,8 @@ const (
 	connection_success = uint32(1)
 
 	MSG_LEN = 96
+	// tcpProbeInfoLen is the size of struct tcp_probe_info, the events of km_tcp_probe
+	tcpProbeInfoLen = int(unsafe.Sizeof(connectionDataV4{})) - 8
 
 	metricFlushInterval = 5 * time.Second
 
@@ -80,6 +83,29 @@ type MetricController struct {
 	serviceMetricCache     map[serviceMetricLabels]*serviceMetricInfo
 	connectionMetricCache  map[connectionMetricLabels]*connectionMetricInfo
 	mutex                  sync.RWMutex
+	// Tracer receives the routing decisions of traced connections, can be nil
+	Tracer           *trace.Tracer
+	LocalityTierFunc LocalityTierFunc
+	// AccesslogFieldsFunc chooses the accesslog fields of the connections to a service, can be nil
+	AccesslogFieldsFunc AccesslogFieldsFunc
+	// ProtocolFunc tells the application protocol of the ports of a service, can be nil
+	ProtocolFunc ProtocolFunc
+	// IdleReaper closes the connections idle for longer than the timeout of their service, can be nil
+	IdleReaper *IdleReaper
+	// ServiceLoad counts the active connections of the services
+	ServiceLoad *ServiceLoadTracker
+	// ConnTracker keeps the connections reported by the data plane until they are closed
+	ConnTracker *ConnTracker
+	// ConnectionExporter exports the sampled connections as OTLP spans, can be nil
+	ConnectionExporter *ConnectionExporter
+	// AccesslogSocket also writes the accesslog entries to a unix socket as NDJSON, can be nil
+	AccesslogSocket *AccesslogSocketWriter
+	// metricsNamespaces are the namespaces whose workloads and services are labeled in the metrics, all if empty
+	metricsNamespaces map[string]struct{}
+	// GeoIP locates the external destinations in the accesslog, can be nil
+	GeoIP *GeoIPDatabase
+	// samplingRatio is the float64 bits of the ratio of the connections sampled
+	samplingRatio atomic.Uint64
 }
 
 type workloadMetricInfo struct {
@@ -134,7 +160,10 @@ type connectionDataV4 struct {
 	OriginalPort uint16
 	_            [7]uint16
 	statistics
-	_ uint32
+	IdleTimeout  uint32 // idle timeout of the connection in milliseconds, 0 if not set
+	LocalityTier uint32 // locality tier the backend was picked from, its priority + 1, 0 if none
+	_            uint32
+	ConnId       uint64 // id the data plane assigned to the connection at its start
 }
 
 // connectionDataV6 read from ebpf km_tcp_probe ringbuf and padding with `_`
@@ -147,7 +176,10 @@ type connectionDataV6 struct {
 	OriginalPort uint16
 	_            uint16
 	statistics
-	_ uint32
+	IdleTimeout  uint32 // idle timeout of the connection in milliseconds, 0 if not set
+	LocalityTier uint32 // locality tier the backend was picked from, its priority + 1, 0 if none
+	_            uint32
+	ConnId       uint64 // id the data plane assigned to the connection at its start
 }
 
 type connMetric struct {
@@ -181,6 +213,9 @@ type requestMetric struct {
 	minRtt         uint32
 	totalRetrans   uint32 // total retransmits after previous report
 	packetLost     uint32 // total packets lost after previous report
+	idleTimeout    uint32 // idle timeout of the connection in milliseconds, 0 if not set
+	localityTier   uint32 // locality tier the backend was picked from, its priority + 1, 0 if none
+	connId         uint64 // id the data plane assigned to the connection at its start, also in its authz verdict
 }
 
 type workloadMetricLabels struct {
@@ -412,11 +447,14 @@ func NewMetric(workloadCache cache.WorkloadCache, serviceCache cache.ServiceCach
 		workloadMetricCache:   map[workloadMetricLabels]*workloadMetricInfo{},
 		serviceMetricCache:    map[serviceMetricLabels]*serviceMetricInfo{},
 		connectionMetricCache: map[connectionMetricLabels]*connectionMetricInfo{},
+		ServiceLoad:           NewServiceLoadTracker(),
+		ConnTracker:           NewConnTracker(),
 	}
 	m.EnableMonitoring.Store(enableMonitoring)
 	m.EnableAccesslog.Store(false)
 	m.EnableWorkloadMetric.Store(false)
 	m.EnableConnectionMetric.Store(false)
+	m.SetSamplingRatio(1)
 	return m
 }
 
@@ -431,22 +469,12 @@ func (m *MetricController) Run(ctx context.Context, mapOfTcpInfo *ebpf.Map) {
 		log.Errorf("get latest os boot time for accesslog failed: %v", err)
 	}
 
-	reader, err := ringbuf.NewReader(mapOfTcpInfo)
-	if err != nil {
-		log.Errorf("open km_tcp_probe ringbuf map FAILED, err: %v", err)
-		return
-	}
-
-	defer func() {
-		if err := reader.Close(); err != nil {
-			log.Errorf("ringbuf reader Close FAILED, err: %v", err)
-		}
-	}()
-
 	tcpConns := make(map[connectionSrcDst]connMetric)
 
 	// Register metrics to Prometheus and start Prometheus server
 	go RunPrometheusClient(ctx)
+	go m.IdleReaper.Run(ctx)
+	go m.ServiceLoad.Run(ctx)
 	go func() {
 		for {
 			select {
@@ -460,76 +488,119 @@ func (m *MetricController) Run(ctx context.Context, mapOfTcpInfo *ebpf.Map) {
 		}
 	}()
 
-	for {
-		select {
-		case <-ctx.Done():
+	utils.NewRingbufConsumer("km_tcp_probe", mapOfTcpInfo, tcpProbeInfoLen, func(sample []byte) {
+		m.handleTcpProbe(sample, tcpConns)
+	}).Run(ctx)
+}
+
+// handleTcpProbe updates the metrics and reports the accesslog of a tcp probe event
+func (m *MetricController) handleTcpProbe(sample []byte, tcpConns map[connectionSrcDst]connMetric) {
+	var err error
+
+	// len(sample) = 144
+	if len(sample) != tcpProbeInfoLen {
+		log.Errorf("wrong length %v of a msg, should be %v", len(sample), tcpProbeInfoLen)
+		return
+	}
+
+	// delta metrics
+	var reqMetric requestMetric
+	connectType := binary.LittleEndian.Uint32(sample)
+	originInfo := sample[unsafe.Sizeof(connectType):]
+	buf := bytes.NewBuffer(originInfo)
+	switch connectType {
+	case constants.MSG_TYPE_IPV4:
+		reqMetric, err = buildV4Metric(buf, tcpConns)
+		if err != nil {
+			log.Errorf("get connectionV4 info failed: %v", err)
 			return
-		default:
-			rec := ringbuf.Record{}
-			if err := reader.ReadInto(&rec); err != nil {
-				log.Errorf("ringbuf reader FAILED to read, err: %v", err)
-				continue
-			}
+		}
+	case constants.MSG_TYPE_IPV6:
+		reqMetric, err = buildV6Metric(buf, tcpConns)
+		if err != nil {
+			log.Errorf("get connectionV6 info failed: %v", err)
+			return
+		}
+	default:
+		log.Errorf("get connection info failed: %v", err)
+		return
+	}
 
-			// len(rec.RawSample) = 128
-			if len(rec.RawSample) != int(unsafe.Sizeof(connectionDataV4{}))-int(8) {
-				log.Errorf("wrong length %v of a msg, should be %v", len(rec.RawSample), int(unsafe.Sizeof(connectionDataV4{}))-int(8))
-				continue
-			}
+	m.IdleReaper.observe(&reqMetric)
+	denied := m.ConnTracker.isDenied(&reqMetric)
+	if !m.EnableMonitoring.Load() {
+		// only reported for the idle reaper
+		if reqMetric.state == TCP_CLOSED {
+			delete(tcpConns, reqMetric.conSrcDstInfo)
+		}
+		return
+	}
 
-			// delta metrics
-			var reqMetric requestMetric
-			connectType := binary.LittleEndian.Uint32(rec.RawSample)
-			originInfo := rec.RawSample[unsafe.Sizeof(connectType):]
-			buf := bytes.NewBuffer(originInfo)
-			switch connectType {
-			case constants.MSG_TYPE_IPV4:
-				reqMetric, err = buildV4Metric(buf, tcpConns)
-				if err != nil {
-					log.Errorf("get connectionV4 info failed: %v", err)
-					continue
-				}
-			case constants.MSG_TYPE_IPV6:
-				reqMetric, err = buildV6Metric(buf, tcpConns)
-				if err != nil {
-					log.Errorf("get connectionV6 info failed: %v", err)
-					continue
-				}
-			default:
-				log.Errorf("get connection info failed: %v", err)
-				continue
-			}
+	m.traceConnection(&reqMetric)
+	m.ConnTracker.observe(&reqMetric)
+	m.countAuthzBytes(&reqMetric, denied)
+
+	workloadLabels := workloadMetricLabels{}
+	serviceLabels, accesslog := m.buildServiceMetric(&reqMetric)
+	m.ServiceLoad.observe(&reqMetric, &serviceLabels)
+	serviceLabels.aggregateNamespaces(m.namespaceLabeled)
+	if m.EnableWorkloadMetric.Load() {
+		workloadLabels = m.buildWorkloadMetric(&reqMetric)
+		workloadLabels.aggregateNamespaces(m.namespaceLabeled)
+	}
 
-			workloadLabels := workloadMetricLabels{}
-			serviceLabels, accesslog := m.buildServiceMetric(&reqMetric)
-			if m.EnableWorkloadMetric.Load() {
-				workloadLabels = m.buildWorkloadMetric(&reqMetric)
-			}
+	connectionLabels := connectionMetricLabels{}
+	if m.EnableConnectionMetric.Load() && reqMetric.duration > LONG_CONN_METRIC_THRESHOLD {
+		connectionLabels = m.buildConnectionMetric(&reqMetric)
+		connectionLabels.aggregateNamespaces(m.namespaceLabeled)
+	}
+	sampled := m.sampled(&reqMetric.conSrcDstInfo)
+	if m.EnableAccesslog.Load() && sampled {
+		// accesslogs at interval of 5 sec during connection lifecycle if connectionMetrics is enabled and at close of connection
+		outputAccesslog(reqMetric, tcpConns[reqMetric.conSrcDstInfo], accesslog, m.AccesslogSocket)
+	}
+	if sampled {
+		m.ConnectionExporter.export(&reqMetric, tcpConns[reqMetric.conSrcDstInfo], accesslog)
+	}
 
-			connectionLabels := connectionMetricLabels{}
-			if m.EnableConnectionMetric.Load() && reqMetric.duration > LONG_CONN_METRIC_THRESHOLD {
-				connectionLabels = m.buildConnectionMetric(&reqMetric)
-			}
-			if m.EnableAccesslog.Load() {
-				// accesslogs at interval of 5 sec during connection lifecycle if connectionMetrics is enabled and at close of connection
-				outputAccesslog(reqMetric, tcpConns[reqMetric.conSrcDstInfo], accesslog)
-			}
+	m.mutex.Lock()
+	if m.EnableWorkloadMetric.Load() {
+		m.updateWorkloadMetricCache(reqMetric, workloadLabels, tcpConns[reqMetric.conSrcDstInfo])
+	}
+	m.updateServiceMetricCache(reqMetric, serviceLabels, tcpConns[reqMetric.conSrcDstInfo])
+	if m.EnableConnectionMetric.Load() && reqMetric.duration > LONG_CONN_METRIC_THRESHOLD {
+		m.updateConnectionMetricCache(reqMetric, connectionLabels)
+	}
+	m.mutex.Unlock()
 
-			m.mutex.Lock()
-			if m.EnableWorkloadMetric.Load() {
-				m.updateWorkloadMetricCache(reqMetric, workloadLabels, tcpConns[reqMetric.conSrcDstInfo])
-			}
-			m.updateServiceMetricCache(reqMetric, serviceLabels, tcpConns[reqMetric.conSrcDstInfo])
-			if m.EnableConnectionMetric.Load() && reqMetric.duration > LONG_CONN_METRIC_THRESHOLD {
-				m.updateConnectionMetricCache(reqMetric, connectionLabels)
-			}
-			m.mutex.Unlock()
+	if reqMetric.state == TCP_CLOSED {
+		delete(tcpConns, reqMetric.conSrcDstInfo)
+	}
+}
 
-			if reqMetric.state == TCP_CLOSED {
-				delete(tcpConns, reqMetric.conSrcDstInfo)
-			}
+// countAuthzBytes attributes the bytes of an inbound connection to the verdict of the authorization
+func (m *MetricController) countAuthzBytes(reqMetric *requestMetric, denied bool) {
+	if reqMetric.conSrcDstInfo.direction != constants.INBOUND {
+		return
+	}
+	bytes := uint64(reqMetric.sentBytes) + uint64(reqMetric.receivedBytes)
+	if bytes == 0 {
+		return
+	}
+
+	namespace, name := DEFAULT_UNKNOWN, DEFAULT_UNKNOWN
+	dst := toAddrPort(reqMetric.conSrcDstInfo.dst, 0).Addr()
+	if workload, _ := m.getWorkloadByAddress(dst.AsSlice()); workload != nil {
+		namespace, name = workload.GetNamespace(), workload.GetName()
+		if !m.namespaceLabeled(namespace) {
+			namespace, name = aggregatedLabel, aggregatedLabel
 		}
 	}
+	if denied {
+		authzDeniedBytes.WithLabelValues(namespace, name).Add(float64(bytes))
+	} else {
+		authzAllowedBytes.WithLabelValues(namespace, name).Add(float64(bytes))
+	}
 }
 
 func buildV4Metric(buf *bytes.Buffer, tcpConns map[connectionSrcDst]connMetric) (requestMetric, error) {
@@ -568,6 +639,9 @@ func buildV4Metric(buf *bytes.Buffer, tcpConns map[connectionSrcDst]connMetric)
 	reqMetric.minRtt = rawStats.statistics.RttMin
 	reqMetric.totalRetrans = rawStats.statistics.Retransmits - tcpConns[reqMetric.conSrcDstInfo].totalRetrans
 	reqMetric.packetLost = rawStats.statistics.LostPackets - tcpConns[reqMetric.conSrcDstInfo].packetLost
+	reqMetric.idleTimeout = rawStats.IdleTimeout
+	reqMetric.localityTier = rawStats.LocalityTier
+	reqMetric.connId = rawStats.ConnId
 
 	cm, ok := tcpConns[reqMetric.conSrcDstInfo]
 	if ok {
@@ -624,6 +698,9 @@ func buildV6Metric(buf *bytes.Buffer, tcpConns map[connectionSrcDst]connMetric)
 	reqMetric.minRtt = rawStats.statistics.RttMin
 	reqMetric.totalRetrans = rawStats.statistics.Retransmits - tcpConns[reqMetric.conSrcDstInfo].totalRetrans
 	reqMetric.packetLost = rawStats.statistics.LostPackets - tcpConns[reqMetric.conSrcDstInfo].packetLost
+	reqMetric.idleTimeout = rawStats.IdleTimeout
+	reqMetric.localityTier = rawStats.LocalityTier
+	reqMetric.connId = rawStats.ConnId
 
 	cm, ok := tcpConns[reqMetric.conSrcDstInfo]
 	if ok {
@@ -757,13 +834,19 @@ func (m *MetricController) buildServiceMetric(reqMetric *requestMetric) (service
 
 	trafficLabels := NewServiceMetricLabel()
 	trafficLabels.withSource(srcWorkload).withDestination(dstWorkload).withDestinationService(dstService)
-	trafficLabels.requestProtocol = "tcp"
+	trafficLabels.requestProtocol = m.requestProtocol(dstService, uint32(reqMetric.origDstPort))
 	trafficLabels.connectionSecurityPolicy = "mutual_tls"
 
 	accesslog := NewLogInfo()
 	accesslog.withSource(srcWorkload).withDestination(dstWorkload).withDestinationService(dstService)
+	accesslog.protocol = trafficLabels.requestProtocol
 	accesslog.destinationAddress = dstIp + ":" + fmt.Sprintf("%d", reqMetric.conSrcDstInfo.dstPort)
 	accesslog.sourceAddress = srcIp + ":" + fmt.Sprintf("%d", reqMetric.conSrcDstInfo.srcPort)
+	accesslog.localityTier = localityTierName(dstService, reqMetric.localityTier)
+	// the destinations out of the mesh are the external ones
+	if dstWorkload == nil && m.GeoIP != nil {
+		accesslog.withDestinationLocation(m.GeoIP, restoreIPv4(dstAddr))
+	}
 
 	switch reqMetric.conSrcDstInfo.direction {
 	case constants.INBOUND:
@@ -775,9 +858,27 @@ func (m *MetricController) buildServiceMetric(reqMetric *requestMetric) (service
 	}
 
 	accesslog.state = TCP_STATES[reqMetric.state]
+	if m.AccesslogFieldsFunc != nil && m.EnableAccesslog.Load() {
+		accesslog.fields = m.AccesslogFieldsFunc(dstService)
+	}
 	return *trafficLabels, *accesslog
 }
 
+// ProtocolFunc returns the application protocol of a port of a service, such as http or grpc,
+// empty if the port does not declare one.
+type ProtocolFunc func(service *workloadapi.Service, port uint32) string
+
+// requestProtocol returns the protocol the connections to the port of the service are tagged with,
+// tcp unless the service declares another one for the port
+func (m *MetricController) requestProtocol(service *workloadapi.Service, port uint32) string {
+	if m.ProtocolFunc != nil {
+		if protocol := m.ProtocolFunc(service, port); protocol != "" {
+			return protocol
+		}
+	}
+	return "tcp"
+}
+
 func (m *MetricController) buildConnectionMetric(reqMetric *requestMetric) connectionMetricLabels {
 	var dstAddr, srcAddr, origAddr []byte
 	for i := range reqMetric.conSrcDstInfo.dst {
@@ -807,7 +908,7 @@ func (m *MetricController) buildConnectionMetric(reqMetric *requestMetric) conne
 	trafficLabels.destinationAddress = dstIP + ":" + fmt.Sprintf("%d", reqMetric.conSrcDstInfo.dstPort)
 	trafficLabels.sourceAddress = srcIP + ":" + fmt.Sprintf("%d", reqMetric.conSrcDstInfo.srcPort)
 	trafficLabels.destinationPodAddress = dstIP
-	trafficLabels.requestProtocol = "tcp"
+	trafficLabels.requestProtocol = m.requestProtocol(dstService, uint32(reqMetric.origDstPort))
 	trafficLabels.connectionSecurityPolicy = "mutual_tls"
 
 	switch reqMetric.conSrcDstInfo.direction {
@@ -972,6 +972,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:8000",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1028,6 +1029,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:8000",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1084,6 +1086,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:8000",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1140,6 +1143,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:49875",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1196,6 +1200,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:49875",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1252,6 +1257,7 @@ func TestBuildServiceMetric(t *testing.T) {
 			},
 			wantLogInfo: logInfo{
 				direction:            "OUTBOUND",
+				protocol:             "tcp",
 				sourceAddress:        "10.19.25.33:49875",
 				sourceWorkload:       "sleep",
 				sourceNamespace:      "default",
@@ -1416,6 +1422,74 @@ func TestBuildConnectionMetric(t *testing.T) {
 	}
 }
 
+func TestBuildMetricRequestProtocol(t *testing.T) {
+	serviceCache := cache.NewServiceCache()
+	serviceCache.AddOrUpdateService(&workloadapi.Service{
+		Hostname:  "httpbin.default.svc.cluster.local",
+		Namespace: "default",
+		Name:      "httpbin",
+		Addresses: []*workloadapi.NetworkAddress{
+			{
+				Address: net.ParseIP("192.168.1.23").To4(),
+			},
+		},
+	})
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Namespace: "default",
+		Name:      "sleep",
+		Addresses: [][]byte{
+			{10, 19, 25, 33},
+		},
+	})
+
+	m := MetricController{
+		workloadCache: workloadCache,
+		serviceCache:  serviceCache,
+		// httpbin names its port 80 http-web and its port 3306 tcp-db
+		ProtocolFunc: func(service *workloadapi.Service, port uint32) string {
+			if service.GetName() == "httpbin" && port == 80 {
+				return "http"
+			}
+			return ""
+		},
+	}
+	tests := []struct {
+		name string
+		port uint16
+		want string
+	}{
+		{
+			name: "http named port",
+			port: 80,
+			want: "http",
+		},
+		{
+			name: "raw tcp port",
+			port: 3306,
+			want: "tcp",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &requestMetric{
+				conSrcDstInfo: connectionSrcDst{
+					src:       [4]uint32{nets.ConvertIpToUint32("10.19.25.33"), 0, 0, 0},
+					dst:       [4]uint32{nets.ConvertIpToUint32("10.19.25.34"), 0, 0, 0},
+					dstPort:   tt.port,
+					direction: uint32(2),
+				},
+				origDstAddr: [4]uint32{nets.ConvertIpToUint32("192.168.1.23"), 0, 0, 0},
+				origDstPort: tt.port,
+			}
+			serviceLabels, accesslog := m.buildServiceMetric(data)
+			assert.Equal(t, tt.want, serviceLabels.requestProtocol)
+			assert.Equal(t, tt.want, accesslog.protocol)
+			assert.Equal(t, tt.want, m.buildConnectionMetric(data).requestProtocol)
+		})
+	}
+}
+
 func TestMetricController_updatePrometheusMetric(t *testing.T) {
 	testworkloadLabel1 := workloadMetricLabels{
 		sourceWorkload:               "kmesh-daemon",
@@ -1704,7 +1778,7 @@ func TestBuildV4Metric(t *testing.T) {
 		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 96, 46, 224, 144, 31, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 		0, 3, 0, 0, 0, 147, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 167, 122, 203, 84, 2, 0, 0, 0, 153, 163,
 		210, 202, 232, 184, 0, 0, 64, 30, 158, 31, 235, 184, 0, 0, 0, 0, 0, 0, 150, 158, 0, 0, 19, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 239, 205, 171, 137, 103, 69, 35, 1})
 	data := requestMetric{
 		conSrcDstInfo: connectionSrcDst{
 			src:       [4]uint32{218231818, 0, 0, 0},
@@ -1726,6 +1800,8 @@ func TestBuildV4Metric(t *testing.T) {
 		minRtt:         19,
 		totalRetrans:   0,
 		packetLost:     0,
+		localityTier:   2,
+		connId:         0x0123456789abcdef,
 	}
 
 	tests := []struct {
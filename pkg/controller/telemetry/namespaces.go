@@ -0,0 +1,93 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+// aggregatedLabel is the label value the workloads and services of the namespaces out of the
+// metrics allowlist are aggregated in
+const aggregatedLabel = "other"
+
+// SetMetricsNamespaces limits the workloads and services labeled in the metrics to the ones of namespaces,
+// the series of the others are aggregated in the "other" ones. Empty labels all the namespaces.
+// It must be set before the metrics are collected.
+func (m *MetricController) SetMetricsNamespaces(namespaces []string) {
+	m.metricsNamespaces = nil
+	if len(namespaces) == 0 {
+		return
+	}
+	m.metricsNamespaces = make(map[string]struct{}, len(namespaces))
+	for _, ns := range namespaces {
+		m.metricsNamespaces[ns] = struct{}{}
+	}
+}
+
+// namespaceLabeled reports whether the workloads and services of the namespace are labeled in the metrics,
+// the addresses out of the mesh have no namespace and are always labeled
+func (m *MetricController) namespaceLabeled(namespace string) bool {
+	if len(m.metricsNamespaces) == 0 || namespace == "" {
+		return true
+	}
+	_, ok := m.metricsNamespaces[namespace]
+	return ok
+}
+
+// aggregate sets the labels to the "other" value
+func aggregate(labels ...*string) {
+	for _, label := range labels {
+		*label = aggregatedLabel
+	}
+}
+
+func (w *workloadMetricLabels) aggregateNamespaces(labeled func(namespace string) bool) {
+	if !labeled(w.sourceWorkloadNamespace) {
+		aggregate(&w.sourceWorkload, &w.sourceCanonicalService, &w.sourceCanonicalRevision, &w.sourceWorkloadNamespace,
+			&w.sourcePrincipal, &w.sourceApp, &w.sourceVersion)
+	}
+	if !labeled(w.destinationWorkloadNamespace) {
+		aggregate(&w.destinationPodAddress, &w.destinationPodNamespace, &w.destinationPodName, &w.destinationWorkload,
+			&w.destinationCanonicalService, &w.destinationCanonicalRevision, &w.destinationWorkloadNamespace,
+			&w.destinationPrincipal, &w.destinationApp, &w.destinationVersion)
+	}
+}
+
+func (s *serviceMetricLabels) aggregateNamespaces(labeled func(namespace string) bool) {
+	if !labeled(s.sourceWorkloadNamespace) {
+		aggregate(&s.sourceWorkload, &s.sourceCanonicalService, &s.sourceCanonicalRevision, &s.sourceWorkloadNamespace,
+			&s.sourcePrincipal, &s.sourceApp, &s.sourceVersion)
+	}
+	if !labeled(s.destinationServiceNamespace) {
+		aggregate(&s.destinationService, &s.destinationServiceNamespace, &s.destinationServiceName)
+	}
+	if !labeled(s.destinationWorkloadNamespace) {
+		aggregate(&s.destinationWorkload, &s.destinationCanonicalService, &s.destinationCanonicalRevision,
+			&s.destinationWorkloadNamespace, &s.destinationPrincipal, &s.destinationApp, &s.destinationVersion)
+	}
+}
+
+func (c *connectionMetricLabels) aggregateNamespaces(labeled func(namespace string) bool) {
+	if !labeled(c.sourceWorkloadNamespace) {
+		aggregate(&c.sourceWorkload, &c.sourceCanonicalService, &c.sourceCanonicalRevision, &c.sourceWorkloadNamespace,
+			&c.sourcePrincipal, &c.sourceApp, &c.sourceVersion, &c.sourceAddress)
+	}
+	if !labeled(c.destinationServiceNamespace) {
+		aggregate(&c.destinationService, &c.destinationServiceNamespace, &c.destinationServiceName)
+	}
+	if !labeled(c.destinationWorkloadNamespace) {
+		aggregate(&c.destinationAddress, &c.destinationPodAddress, &c.destinationPodNamespace, &c.destinationPodName,
+			&c.destinationWorkload, &c.destinationCanonicalService, &c.destinationCanonicalRevision,
+			&c.destinationWorkloadNamespace, &c.destinationPrincipal, &c.destinationApp, &c.destinationVersion)
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/nets"
+)
+
+func TestMetricsNamespaces(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	serviceCache := cache.NewServiceCache()
+	addWorkload := func(namespace, name, ip string) {
+		workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+			Uid:          "cluster0//Pod/" + namespace + "/" + name,
+			Namespace:    namespace,
+			Name:         name,
+			WorkloadName: name,
+			Addresses:    [][]byte{netip.MustParseAddr(ip).AsSlice()},
+		})
+	}
+	addService := func(namespace, name, ip string) {
+		serviceCache.AddOrUpdateService(&workloadapi.Service{
+			Namespace: namespace,
+			Name:      name,
+			Hostname:  name + "." + namespace + ".svc.cluster.local",
+			Addresses: []*workloadapi.NetworkAddress{{Address: netip.MustParseAddr(ip).AsSlice()}},
+		})
+	}
+	addWorkload("default", "sleep", "10.244.0.1")
+	addWorkload("default", "httpbin", "10.244.0.2")
+	addService("default", "httpbin", "10.96.0.2")
+	addWorkload("tenant-1", "client", "10.244.1.1")
+	addWorkload("tenant-1", "server", "10.244.1.2")
+	addService("tenant-1", "server", "10.96.1.2")
+	addWorkload("tenant-2", "client", "10.244.2.1")
+
+	m := NewMetric(workloadCache, serviceCache, true)
+	m.SetMetricsNamespaces([]string{"default"})
+	m.EnableWorkloadMetric.Store(true)
+
+	connect := func(src, dst, origDst string) {
+		reqMetric := requestMetric{
+			conSrcDstInfo: connectionSrcDst{
+				src:       [4]uint32{nets.ConvertIpToUint32(src)},
+				dst:       [4]uint32{nets.ConvertIpToUint32(dst)},
+				srcPort:   40000,
+				dstPort:   80,
+				direction: 2,
+			},
+			origDstAddr: [4]uint32{nets.ConvertIpToUint32(origDst)},
+			origDstPort: 80,
+			state:       TCP_CLOSED,
+			success:     connection_success,
+		}
+		serviceLabels, _ := m.buildServiceMetric(&reqMetric)
+		serviceLabels.aggregateNamespaces(m.namespaceLabeled)
+		workloadLabels := m.buildWorkloadMetric(&reqMetric)
+		workloadLabels.aggregateNamespaces(m.namespaceLabeled)
+		m.updateServiceMetricCache(reqMetric, serviceLabels, connMetric{})
+		m.updateWorkloadMetricCache(reqMetric, workloadLabels, connMetric{})
+	}
+	connect("10.244.0.1", "10.244.0.2", "10.96.0.2")
+	connect("10.244.1.1", "10.244.0.2", "10.96.0.2")
+	connect("10.244.2.1", "10.244.0.2", "10.96.0.2")
+	connect("10.244.1.1", "10.244.1.2", "10.96.1.2")
+	connect("10.244.2.1", "10.244.1.2", "10.96.1.2")
+
+	tcpConnectionClosedInService.Reset()
+	tcpConnectionClosedInWorkload.Reset()
+	m.updatePrometheusMetric()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(tcpConnectionClosedInService, tcpConnectionClosedInWorkload)
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	// closed connections of the services keyed by source_workload/source_workload_namespace -> destination_service
+	services := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				assert.NotContains(t, []string{"tenant-1", "tenant-2", "client", "server", "10.244.1.2"}, label.GetValue(),
+					"series of %s labeled with %s=%s", family.GetName(), label.GetName(), label.GetValue())
+				labels[label.GetName()] = label.GetValue()
+			}
+			if family.GetName() == "kmesh_tcp_connections_closed_total" {
+				key := labels["source_workload"] + "/" + labels["source_workload_namespace"] + " -> " + labels["destination_service"]
+				services[key] += metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		// the allowlisted namespaces keep their own series
+		"sleep/default -> httpbin.default.svc.cluster.local": 1,
+		// the other ones are aggregated
+		"other/other -> httpbin.default.svc.cluster.local": 2,
+		"other/other -> other":                             2,
+	}, services)
+	assert.Equal(t, 3, testutil.CollectAndCount(tcpConnectionClosedInWorkload))
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+const (
+	connectionSpanName = "kmesh.connection"
+
+	exporterShutdownTimeout = 5 * time.Second
+)
+
+// ConnectionExporter exports the L4 connections as spans to an OTLP collector,
+// a span covers a connection from its establishment to its close
+type ConnectionExporter struct {
+	tracer oteltrace.Tracer
+}
+
+// NewConnectionExporter exports the connection spans to the OTLP grpc collector at endpoint,
+// the pending spans are flushed once ctx is done
+func NewConnectionExporter(ctx context.Context, endpoint string, insecure bool) (*ConnectionExporter, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "kmesh"))),
+	)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), exporterShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("shutdown otlp connection exporter failed: %v", err)
+		}
+	}()
+	return newConnectionExporter(provider), nil
+}
+
+func newConnectionExporter(provider oteltrace.TracerProvider) *ConnectionExporter {
+	return &ConnectionExporter{tracer: provider.Tracer("kmesh.net/kmesh")}
+}
+
+// export records the span of a closed connection, conn holds the totals of the connection
+func (e *ConnectionExporter) export(reqMetric *requestMetric, conn connMetric, info logInfo) {
+	if e == nil || reqMetric.state != TCP_CLOSED {
+		return
+	}
+
+	kind := oteltrace.SpanKindClient
+	if reqMetric.conSrcDstInfo.direction == constants.INBOUND {
+		kind = oteltrace.SpanKindServer
+	}
+	verdict := "connected"
+	if reqMetric.success != connection_success {
+		verdict = "failed"
+	}
+	_, span := e.tracer.Start(context.Background(), connectionSpanName,
+		oteltrace.WithSpanKind(kind),
+		oteltrace.WithTimestamp(calculateUptime(osStartTime, reqMetric.startTime)),
+		oteltrace.WithAttributes(
+			attribute.String("network.transport", "tcp"),
+			attribute.String("kmesh.direction", info.direction),
+			attribute.String("source.address", info.sourceAddress),
+			attribute.String("source.workload", info.sourceWorkload),
+			attribute.String("source.namespace", info.sourceNamespace),
+			attribute.String("destination.address", info.destinationAddress),
+			attribute.String("destination.service", info.destinationService),
+			attribute.String("destination.workload", info.destinationWorkload),
+			attribute.String("destination.namespace", info.destinationNamespace),
+			attribute.Int64("kmesh.sent_bytes", int64(conn.sentBytes)),
+			attribute.Int64("kmesh.received_bytes", int64(conn.receivedBytes)),
+			attribute.String("kmesh.verdict", verdict),
+		))
+	if verdict == "failed" {
+		span.SetStatus(codes.Error, "connection failed")
+	}
+	span.End(oteltrace.WithTimestamp(calculateUptime(osStartTime, reqMetric.lastReportTime)))
+}
+
+// SetSamplingRatio sets the ratio, between 0 and 1, of the connections written to the
+// accesslog and exported as spans. A connection is sampled for its whole lifecycle.
+func (m *MetricController) SetSamplingRatio(ratio float64) {
+	m.samplingRatio.Store(math.Float64bits(ratio))
+}
+
+func (m *MetricController) sampled(conn *connectionSrcDst) bool {
+	ratio := math.Float64frombits(m.samplingRatio.Load())
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+
+	h := fnv.New64a()
+	var buf []byte
+	for i := range conn.src {
+		buf = binary.LittleEndian.AppendUint32(buf, conn.src[i])
+		buf = binary.LittleEndian.AppendUint32(buf, conn.dst[i])
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, conn.srcPort)
+	buf = binary.LittleEndian.AppendUint16(buf, conn.dstPort)
+	_, _ = h.Write(buf)
+	return float64(h.Sum64()%10000) < ratio*10000
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+func TestConnectionExporter(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	exporter := newConnectionExporter(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	osStartTime = time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+
+	info := logInfo{
+		direction:            "OUTBOUND",
+		sourceAddress:        "10.244.0.10:47667",
+		sourceWorkload:       "sleep-7656cf8794-9v2gv",
+		sourceNamespace:      "ambient-demo",
+		destinationAddress:   "10.244.0.7:8080",
+		destinationService:   "httpbin.ambient-demo.svc.cluster.local",
+		destinationWorkload:  "httpbin-86b8ffc5ff-bhvxx",
+		destinationNamespace: "ambient-demo",
+	}
+	conn := connMetric{sentBytes: 60, receivedBytes: 172}
+	reqMetric := requestMetric{
+		conSrcDstInfo:  connectionSrcDst{direction: constants.OUTBOUND},
+		state:          TCP_ESTABLISHED,
+		success:        connection_success,
+		startTime:      uint64(time.Hour),
+		lastReportTime: uint64(time.Hour + 2*time.Second),
+	}
+
+	// no span until the connection is closed
+	exporter.export(&reqMetric, conn, info)
+	assert.Empty(t, recorder.Ended())
+
+	reqMetric.state = TCP_CLOSED
+	exporter.export(&reqMetric, conn, info)
+	require.Len(t, recorder.Ended(), 1)
+	span := recorder.Ended()[0]
+	assert.Equal(t, connectionSpanName, span.Name())
+	assert.Equal(t, oteltrace.SpanKindClient, span.SpanKind())
+	assert.Equal(t, osStartTime.Add(time.Hour), span.StartTime())
+	assert.Equal(t, osStartTime.Add(time.Hour+2*time.Second), span.EndTime())
+	assert.Equal(t, codes.Unset, span.Status().Code)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("network.transport", "tcp"),
+		attribute.String("kmesh.direction", "OUTBOUND"),
+		attribute.String("source.address", "10.244.0.10:47667"),
+		attribute.String("source.workload", "sleep-7656cf8794-9v2gv"),
+		attribute.String("source.namespace", "ambient-demo"),
+		attribute.String("destination.address", "10.244.0.7:8080"),
+		attribute.String("destination.service", "httpbin.ambient-demo.svc.cluster.local"),
+		attribute.String("destination.workload", "httpbin-86b8ffc5ff-bhvxx"),
+		attribute.String("destination.namespace", "ambient-demo"),
+		attribute.Int64("kmesh.sent_bytes", 60),
+		attribute.Int64("kmesh.received_bytes", 172),
+		attribute.String("kmesh.verdict", "connected"),
+	}, span.Attributes())
+
+	// a failed inbound connection
+	reqMetric.conSrcDstInfo.direction = constants.INBOUND
+	reqMetric.success = 0
+	info.direction = "INBOUND"
+	exporter.export(&reqMetric, connMetric{}, info)
+	require.Len(t, recorder.Ended(), 2)
+	span = recorder.Ended()[1]
+	assert.Equal(t, oteltrace.SpanKindServer, span.SpanKind())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.String("kmesh.verdict", "failed"))
+
+	// nil when the export is not enabled
+	var disabled *ConnectionExporter
+	disabled.export(&reqMetric, conn, info)
+}
+
+func TestSampled(t *testing.T) {
+	m := NewMetric(nil, nil, true)
+	conns := make([]connectionSrcDst, 1000)
+	for i := range conns {
+		conns[i] = connectionSrcDst{src: [4]uint32{uint32(i)}, dst: [4]uint32{1}, srcPort: uint16(i), dstPort: 80}
+	}
+	countSampled := func() int {
+		count := 0
+		for i := range conns {
+			if m.sampled(&conns[i]) {
+				count++
+			}
+		}
+		return count
+	}
+
+	assert.Equal(t, len(conns), countSampled())
+
+	m.SetSamplingRatio(0)
+	assert.Equal(t, 0, countSampled())
+
+	m.SetSamplingRatio(0.5)
+	sampled := countSampled()
+	assert.InDelta(t, 500, sampled, 100)
+	// a connection is sampled for its whole lifecycle
+	assert.Equal(t, sampled, countSampled())
+}
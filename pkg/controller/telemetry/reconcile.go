@@ -0,0 +1,73 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The controllers reconciling the resources received from xds into the bpf maps
+const (
+	ControllerService  = "service"
+	ControllerWorkload = "workload"
+	ControllerAuthz    = "authz"
+)
+
+var (
+	reconcileMutex sync.Mutex
+	// reconcilesInFlight are the times the controllers started the reconciles they did not finish yet
+	reconcilesInFlight = map[string]time.Time{}
+)
+
+// StartReconcile records that the controller started reconciling the resources it received,
+// the returned func records the end of the reconcile with its error
+func StartReconcile(controller string) func(error) {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+	if _, ok := reconcilesInFlight[controller]; !ok {
+		reconcilesInFlight[controller] = time.Now()
+	}
+
+	return func(err error) {
+		reconcileMutex.Lock()
+		delete(reconcilesInFlight, controller)
+		reconcileMutex.Unlock()
+
+		controllerLastReconcile.WithLabelValues(controller).SetToCurrentTime()
+		if err != nil {
+			controllerReconcileErrors.WithLabelValues(controller).Inc()
+		}
+	}
+}
+
+// StaleControllers returns the controllers which started a reconcile more than threshold ago without finishing it.
+// The controllers only reconcile when resources change, one idle for long is not stale, one hanging is.
+func StaleControllers(threshold time.Duration) []string {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+
+	var stale []string
+	for controller, start := range reconcilesInFlight {
+		if time.Since(start) > threshold {
+			stale = append(stale, controller)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcileMetrics(t *testing.T) {
+	errorsBefore := testutil.ToFloat64(controllerReconcileErrors.WithLabelValues(ControllerAuthz))
+
+	start := time.Now()
+	reconciled := StartReconcile(ControllerAuthz)
+	reconciled(errors.New("AuthorizationUpdate failed"))
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(controllerReconcileErrors.WithLabelValues(ControllerAuthz)))
+	last := testutil.ToFloat64(controllerLastReconcile.WithLabelValues(ControllerAuthz))
+	assert.GreaterOrEqual(t, last, float64(start.Unix()))
+
+	// a successful reconcile updates the timestamp only
+	reconciled = StartReconcile(ControllerAuthz)
+	reconciled(nil)
+	assert.Equal(t, errorsBefore+1, testutil.ToFloat64(controllerReconcileErrors.WithLabelValues(ControllerAuthz)))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(controllerLastReconcile.WithLabelValues(ControllerAuthz)), last)
+}
+
+func TestStaleControllers(t *testing.T) {
+	const threshold = 20 * time.Millisecond
+
+	// idle controllers are never stale
+	time.Sleep(2 * threshold)
+	assert.Empty(t, StaleControllers(threshold))
+
+	workloadReconciled := StartReconcile(ControllerWorkload)
+	serviceReconciled := StartReconcile(ControllerService)
+	assert.Empty(t, StaleControllers(threshold))
+	time.Sleep(2 * threshold)
+	assert.Equal(t, []string{ControllerService, ControllerWorkload}, StaleControllers(threshold))
+
+	serviceReconciled(nil)
+	assert.Equal(t, []string{ControllerWorkload}, StaleControllers(threshold))
+	workloadReconciled(nil)
+	assert.Empty(t, StaleControllers(threshold))
+}
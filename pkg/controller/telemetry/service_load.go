@@ -0,0 +1,203 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ServiceLoad is the connection load of a service seen by one side of its connections
+type ServiceLoad struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Reporter is source for the connections of the clients on the node, destination for
+	// the connections to the backends on the node
+	Reporter          string `json:"reporter"`
+	ActiveConnections uint64 `json:"activeConnections"`
+	OpenedConnections uint64 `json:"openedConnections"`
+	// ConnectionRate is the number of connections opened per second during the last interval
+	ConnectionRate float64 `json:"connectionRate"`
+}
+
+type serviceLoadKey struct {
+	reporter  string
+	namespace string
+	name      string
+}
+
+type serviceLoadInfo struct {
+	active uint64
+	opened uint64
+	// active and opened connections at the last update
+	lastActive uint64
+	lastOpened uint64
+	rate       float64
+}
+
+// ServiceLoadTracker counts the active connections of each service and the rate they are
+// opened at, from the connections reported by the data plane. This is the l4 load of the
+// services, which they can be autoscaled on.
+type ServiceLoadTracker struct {
+	mutex sync.Mutex
+	// connections established and not closed yet
+	conns      map[connectionSrcDst]serviceLoadKey
+	loads      map[serviceLoadKey]*serviceLoadInfo
+	lastUpdate time.Time
+}
+
+func NewServiceLoadTracker() *ServiceLoadTracker {
+	return &ServiceLoadTracker{
+		conns:      make(map[connectionSrcDst]serviceLoadKey),
+		loads:      make(map[serviceLoadKey]*serviceLoadInfo),
+		lastUpdate: time.Now(),
+	}
+}
+
+// observe counts the connection reported to the service of labels
+func (t *ServiceLoadTracker) observe(reqMetric *requestMetric, labels *serviceMetricLabels) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key, tracked := t.conns[reqMetric.conSrcDstInfo]
+	switch {
+	case reqMetric.state == TCP_CLOSED && tracked:
+		delete(t.conns, reqMetric.conSrcDstInfo)
+		if load, ok := t.loads[key]; ok && load.active > 0 {
+			load.active--
+		}
+	case reqMetric.state == TCP_CLOSED:
+		// short connections are only reported once closed
+		if reqMetric.success == connection_success && labels.destinationServiceName != "" {
+			t.load(labels).opened++
+		}
+	case reqMetric.state == TCP_ESTABLISHED && !tracked && labels.destinationServiceName != "":
+		load := t.load(labels)
+		load.active++
+		load.opened++
+		t.conns[reqMetric.conSrcDstInfo] = serviceLoadKey{
+			reporter:  labels.reporter,
+			namespace: labels.destinationServiceNamespace,
+			name:      labels.destinationServiceName,
+		}
+	}
+}
+
+func (t *ServiceLoadTracker) load(labels *serviceMetricLabels) *serviceLoadInfo {
+	key := serviceLoadKey{
+		reporter:  labels.reporter,
+		namespace: labels.destinationServiceNamespace,
+		name:      labels.destinationServiceName,
+	}
+	load, ok := t.loads[key]
+	if !ok {
+		load = &serviceLoadInfo{}
+		t.loads[key] = load
+	}
+	return load
+}
+
+func (t *ServiceLoadTracker) Run(ctx context.Context) {
+	if t == nil {
+		return
+	}
+
+	ticker := time.NewTicker(metricFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.update(now)
+		}
+	}
+}
+
+// update computes the connection rates since the last update and exports the loads to prometheus,
+// the services are forgotten once their load was exported as zero
+func (t *ServiceLoadTracker) update(now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	elapsed := now.Sub(t.lastUpdate).Seconds()
+	t.lastUpdate = now
+	for key, load := range t.loads {
+		labels := prometheus.Labels{
+			"reporter":                      key.reporter,
+			"destination_service_namespace": key.namespace,
+			"destination_service_name":      key.name,
+		}
+		opened := load.opened - load.lastOpened
+		if load.active == 0 && opened == 0 && load.lastActive == 0 && load.rate == 0 {
+			delete(t.loads, key)
+			tcpServiceActiveConnections.Delete(labels)
+			tcpServiceConnectionsOpened.Delete(labels)
+			continue
+		}
+		load.lastActive = load.active
+		load.lastOpened = load.opened
+		load.rate = 0
+		if elapsed > 0 {
+			load.rate = float64(opened) / elapsed
+		}
+		tcpServiceActiveConnections.With(labels).Set(float64(load.active))
+		tcpServiceConnectionsOpened.With(labels).Add(float64(opened))
+	}
+}
+
+// Loads returns the loads of the services in namespace, or of all the services if it is empty,
+// name further selects a single service
+func (t *ServiceLoadTracker) Loads(namespace, name string) []ServiceLoad {
+	if t == nil {
+		return nil
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	loads := make([]ServiceLoad, 0, len(t.loads))
+	for key, load := range t.loads {
+		if (namespace != "" && key.namespace != namespace) || (name != "" && key.name != name) {
+			continue
+		}
+		loads = append(loads, ServiceLoad{
+			Namespace:         key.namespace,
+			Name:              key.name,
+			Reporter:          key.reporter,
+			ActiveConnections: load.active,
+			OpenedConnections: load.opened,
+			ConnectionRate:    load.rate,
+		})
+	}
+	sort.Slice(loads, func(i, j int) bool {
+		if loads[i].Namespace != loads[j].Namespace {
+			return loads[i].Namespace < loads[j].Namespace
+		}
+		if loads[i].Name != loads[j].Name {
+			return loads[i].Name < loads[j].Name
+		}
+		return loads[i].Reporter < loads[j].Reporter
+	})
+	return loads
+}
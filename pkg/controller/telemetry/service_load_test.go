@@ -0,0 +1,86 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceLoadTracker(t *testing.T) {
+	frontend := &serviceMetricLabels{reporter: "destination", destinationServiceNamespace: "default", destinationServiceName: "frontend"}
+	backend := &serviceMetricLabels{reporter: "destination", destinationServiceNamespace: "default", destinationServiceName: "backend"}
+	unknown := &serviceMetricLabels{reporter: "destination", destinationService: "10.244.1.3"}
+	report := func(tracker *ServiceLoadTracker, srcPort uint16, state uint32, labels *serviceMetricLabels) {
+		tracker.observe(&requestMetric{
+			conSrcDstInfo: connectionSrcDst{src: [4]uint32{1}, dst: [4]uint32{2}, srcPort: srcPort, dstPort: 8080},
+			state:         state,
+			success:       connection_success,
+		}, labels)
+	}
+
+	start := time.Now()
+	tracker := NewServiceLoadTracker()
+	tracker.lastUpdate = start
+	// 100 connections to frontend, of which 40 are closed, and 25 short connections only reported on close
+	for port := uint16(1); port <= 100; port++ {
+		report(tracker, port, TCP_ESTABLISHED, frontend)
+		// reported again while active
+		report(tracker, port, TCP_ESTABLISHED, frontend)
+	}
+	for port := uint16(1); port <= 40; port++ {
+		report(tracker, port, TCP_CLOSED, frontend)
+	}
+	for port := uint16(1001); port <= 1025; port++ {
+		report(tracker, port, TCP_CLOSED, frontend)
+	}
+	// 10 connections to backend
+	for port := uint16(2001); port <= 2010; port++ {
+		report(tracker, port, TCP_ESTABLISHED, backend)
+	}
+	// connections to no service are not counted
+	report(tracker, 3001, TCP_ESTABLISHED, unknown)
+
+	tracker.update(start.Add(5 * time.Second))
+	assert.Equal(t, []ServiceLoad{
+		{Namespace: "default", Name: "backend", Reporter: "destination", ActiveConnections: 10, OpenedConnections: 10, ConnectionRate: 2},
+		{Namespace: "default", Name: "frontend", Reporter: "destination", ActiveConnections: 60, OpenedConnections: 125, ConnectionRate: 25},
+	}, tracker.Loads("", ""))
+	frontendLabels := prometheus.Labels{"reporter": "destination", "destination_service_namespace": "default", "destination_service_name": "frontend"}
+	assert.Equal(t, float64(60), testutil.ToFloat64(tcpServiceActiveConnections.With(frontendLabels)))
+	assert.Equal(t, float64(125), testutil.ToFloat64(tcpServiceConnectionsOpened.With(frontendLabels)))
+
+	// all the connections of backend closed, nothing new to frontend
+	for port := uint16(2001); port <= 2010; port++ {
+		report(tracker, port, TCP_CLOSED, backend)
+	}
+	tracker.update(start.Add(10 * time.Second))
+	assert.Equal(t, []ServiceLoad{
+		{Namespace: "default", Name: "backend", Reporter: "destination", ActiveConnections: 0, OpenedConnections: 10, ConnectionRate: 0},
+	}, tracker.Loads("default", "backend"))
+	assert.Equal(t, uint64(60), tracker.Loads("default", "frontend")[0].ActiveConnections)
+	assert.Equal(t, float64(0), tracker.Loads("default", "frontend")[0].ConnectionRate)
+
+	// idle services are forgotten
+	tracker.update(start.Add(15 * time.Second))
+	assert.Empty(t, tracker.Loads("default", "backend"))
+	assert.Len(t, tracker.Loads("default", ""), 1)
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package telemetry
+
+import (
+	"encoding/binary"
+	"net/netip"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/trace"
+)
+
+// LocalityTierFunc returns the locality priority of a backend for a service,
+// false if the service is not locality load balanced.
+type LocalityTierFunc func(backend *workloadapi.Workload, service *workloadapi.Service) (uint32, bool)
+
+// traceConnection reports the backend a traced connection is routed to
+func (m *MetricController) traceConnection(reqMetric *requestMetric) {
+	if !m.Tracer.Enabled() {
+		return
+	}
+
+	var dstAddr, srcAddr, origAddr []byte
+	for i := range reqMetric.conSrcDstInfo.dst {
+		dstAddr = binary.LittleEndian.AppendUint32(dstAddr, reqMetric.conSrcDstInfo.dst[i])
+		srcAddr = binary.LittleEndian.AppendUint32(srcAddr, reqMetric.conSrcDstInfo.src[i])
+		origAddr = binary.LittleEndian.AppendUint32(origAddr, reqMetric.origDstAddr[i])
+	}
+	srcIp, _ := netip.AddrFromSlice(restoreIPv4(srcAddr))
+	dstIp, _ := netip.AddrFromSlice(restoreIPv4(dstAddr))
+
+	conn := &trace.Connection{
+		Src:      srcIp,
+		DstAddrs: []netip.Addr{dstIp},
+		DstPorts: []uint32{uint32(reqMetric.conSrcDstInfo.dstPort)},
+	}
+	ev := trace.Event{
+		Type:        trace.EventTypeConnection,
+		Source:      netip.AddrPortFrom(srcIp, reqMetric.conSrcDstInfo.srcPort).String(),
+		Destination: netip.AddrPortFrom(dstIp, reqMetric.conSrcDstInfo.dstPort).String(),
+		State:       TCP_STATES[reqMetric.state],
+	}
+	if reqMetric.success != connection_success {
+		ev.Reason = "connection failed"
+	}
+
+	if isOrigDstSet(reqMetric.origDstAddr) {
+		origIp, _ := netip.AddrFromSlice(restoreIPv4(origAddr))
+		conn.DstAddrs = append(conn.DstAddrs, origIp)
+		conn.DstPorts = append(conn.DstPorts, uint32(reqMetric.origDstPort))
+	}
+
+	dstWorkload, _ := m.getWorkloadByAddress(restoreIPv4(dstAddr))
+	if dstWorkload != nil {
+		ev.Backend = dstWorkload.GetNamespace() + "/" + dstWorkload.GetName()
+	}
+	dstService := m.fetchOriginalService(restoreIPv4(origAddr), uint32(reqMetric.origDstPort))
+	if dstService != nil && dstService.GetName() != "" {
+		ev.Service = dstService.ResourceName()
+		conn.DstNames = append(conn.DstNames, dstService.GetName(), dstService.GetHostname())
+		// the locality tier only makes sense for the client side
+		if dstWorkload != nil && m.LocalityTierFunc != nil && reqMetric.conSrcDstInfo.direction == constants.OUTBOUND {
+			if tier, ok := m.LocalityTierFunc(dstWorkload, dstService); ok {
+				ev.LocalityTier = &tier
+			}
+		}
+	}
+
+	m.Tracer.Emit(conn, ev)
+}
@@ -21,12 +21,16 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
 	"kmesh.net/kmesh/pkg/logger"
+	"kmesh.net/kmesh/pkg/utils"
+	"kmesh.net/kmesh/pkg/version"
 )
 
 var (
@@ -172,6 +176,27 @@ var (
 	totalMapLabels = []string{
 		"node_name",
 	}
+	serviceLoadLabels = []string{
+		"reporter",
+		"destination_service_namespace",
+		"destination_service_name",
+	}
+
+	authzBytesLabels = []string{
+		"destination_workload_namespace",
+		"destination_workload",
+	}
+
+	serviceBandwidthLabels = []string{
+		"destination_service_namespace",
+		"destination_service_name",
+		"direction",
+	}
+
+	serviceHealthLabels = []string{
+		"destination_service_namespace",
+		"destination_service_name",
+	}
 )
 
 var (
@@ -270,6 +295,161 @@ var (
 			Help: "The total number of retransmits over established TCP connection.",
 		}, connectionLabels)
 
+	idleTimeoutConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_tcp_idle_timeout_connections",
+			Help: "The number of open TCP connections to services with an idle timeout, by state active or idle.",
+		}, []string{"state"})
+
+	idleTimeoutConnectionsClosed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_tcp_idle_timeout_connections_closed_total",
+			Help: "The total number of TCP connections closed after exceeding the idle timeout of their service.",
+		})
+
+	frontendConflicts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_frontend_conflicts_total",
+			Help: "The total number of times a service claimed an address another service still had, as when a service is recreated with the same ClusterIP.",
+		})
+
+	tcpServiceActiveConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_tcp_service_active_connections",
+			Help: "The number of active connections to a service, for autoscaling on connections",
+		}, serviceLoadLabels)
+	tcpServiceConnectionsOpened = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_tcp_service_connections_opened_total",
+			Help: "The total number of connections opened to a service, for autoscaling on the connection rate",
+		}, serviceLoadLabels)
+	serviceBandwidthThrottling = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_service_bandwidth_throttling",
+			Help: "Whether the kmesh.net/bandwidth of a service currently throttles the connections of the clients on the node, 1 if it does, by direction egress or ingress.",
+		}, serviceBandwidthLabels)
+	serviceBandwidthThrottled = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_service_bandwidth_throttled_packets_total",
+			Help: "The total number of packets of the connections to a service throttled or dropped by its kmesh.net/bandwidth, by direction egress or ingress.",
+		}, serviceBandwidthLabels)
+	serviceHealthyEndpoints = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_service_healthy_endpoints",
+			Help: "The number of healthy endpoints of a service with a kmesh.net/min-healthy-endpoints.",
+		}, serviceHealthLabels)
+	serviceEndpoints = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_service_endpoints",
+			Help: "The number of endpoints of a service with a kmesh.net/min-healthy-endpoints, healthy or not.",
+		}, serviceHealthLabels)
+	serviceUnavailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_service_unavailable",
+			Help: "Whether the new connections to a service are refused as it has fewer healthy endpoints than its kmesh.net/min-healthy-endpoints, 1 if they are.",
+		}, serviceHealthLabels)
+	authzAllowedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_authz_allowed_bytes_total",
+			Help: "The total number of bytes sent and received by the inbound connections of a workload the authorization allowed.",
+		}, authzBytesLabels)
+	authzDeniedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_authz_denied_bytes_total",
+			Help: "The total number of bytes sent and received by the inbound connections of a workload the authorization denied, before they were reset.",
+		}, authzBytesLabels)
+	xdsLoadedNamespaces = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kmesh_xds_loaded_namespaces",
+			Help: "The number of namespaces the received xds resources are pruned to, 0 if all of them are loaded.",
+		})
+
+	xdsLoadedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_xds_loaded_resources",
+			Help: "The number of xds resources loaded, by type service or workload.",
+		}, []string{"type"})
+
+	xdsResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_xds_resources",
+			Help: "The number of xds resources loaded, by type.",
+		}, []string{"type"})
+
+	xdsPushDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kmesh_xds_push_duration_seconds",
+			Help:    "The time from receiving an xds response to applying its resources to the bpf maps, by type.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		}, []string{"type"})
+
+	applyBatchDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "kmesh_apply_batch_duration_seconds",
+			Help:    "The time to apply a batch of the workloads of an xds response to the bpf maps.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 15),
+		})
+
+	xdsCoalescedUpdates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_xds_coalesced_updates_total",
+			Help: "The total number of xds resource updates superseded by a later one within the --xds-coalesce-window, never written to the bpf maps, by type.",
+		}, []string{"type"})
+
+	xdsManualResyncs = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_xds_manual_resyncs_total",
+			Help: "The total number of xds resyncs requested with kmeshctl resync.",
+		})
+
+	authzPolicySwaps = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_authz_policy_generation_swaps_total",
+			Help: "The total number of times the authorization policies changed by a xds response were applied as a single generation.",
+		})
+
+	endpointHealthTransitions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_endpoint_health_transitions_total",
+			Help: "The total number of times the endpoints of a service changed health, by the state they went to, healthy or unhealthy.",
+		}, []string{"destination_service_namespace", "destination_service_name", "state"})
+
+	mapGCRemoved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_map_gc_removed_total",
+			Help: "The total number of stale entries with no backing xds resource the garbage collection removed from the bpf maps, by map.",
+		}, []string{"map"})
+
+	accesslogSocketDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_accesslog_socket_dropped_total",
+			Help: "The total number of accesslog records dropped because the buffer of the --accesslog-socket was full while its reader was absent.",
+		})
+
+	xdsLossState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_xds_loss_state",
+			Help: "The state of the xds connection under the --on-xds-loss mode, 1 for the current state among connected, disconnected and applied.",
+		}, []string{"mode", "state"})
+
+	controllerLastReconcile = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_controller_last_reconcile_timestamp",
+			Help: "The unix time in seconds a controller last finished reconciling the resources it received, by controller service, workload or authz.",
+		}, []string{"controller"})
+
+	controllerReconcileErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_controller_reconcile_errors_total",
+			Help: "The total number of reconciles of a controller which failed to apply some of the resources received, by controller service, workload or authz.",
+		}, []string{"controller"})
+
+	buildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kmesh_build_info",
+			Help: "Always 1, labeled with the mode the daemon runs in, its version and the kernel of its node.",
+		}, []string{"mode", "version", "kernel"})
+
 	// New operation metrics
 	bpfProgOpDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -298,6 +478,16 @@ var (
 			Help: "Count of map created by kmesh-daemon.",
 		}, totalMapLabels,
 	)
+	conntrackEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_conntrack_evictions_total",
+			Help: "The total number of idle flows evicted from the full conntrack of the authz verdicts to make room for new ones.",
+		})
+	conntrackFull = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kmesh_conntrack_full_total",
+			Help: "The total number of times the conntrack of the authz verdicts was found full, sampled every 15s.",
+		})
 )
 
 func RunPrometheusClient(ctx context.Context) {
@@ -321,6 +511,22 @@ func runPrometheusClient(registry *prometheus.Registry) {
 	registry.MustRegister(tcpConnectionTotalSendBytes, tcpConnectionTotalReceivedBytes, tcpConnectionTotalPacketLost, tcpConnectionTotalRetrans)
 	registry.MustRegister(bpfProgOpDuration, bpfProgOpCount)
 	registry.MustRegister(mapEntryCount, mapCountInNode)
+	registry.MustRegister(conntrackEvictions, conntrackFull)
+	registry.MustRegister(idleTimeoutConnections, idleTimeoutConnectionsClosed)
+	registry.MustRegister(tcpServiceActiveConnections, tcpServiceConnectionsOpened)
+	registry.MustRegister(serviceBandwidthThrottling, serviceBandwidthThrottled)
+	registry.MustRegister(serviceHealthyEndpoints, serviceEndpoints, serviceUnavailable)
+	registry.MustRegister(authzAllowedBytes, authzDeniedBytes)
+	registry.MustRegister(xdsLoadedNamespaces, xdsLoadedResources, xdsLossState)
+	registry.MustRegister(xdsResources, xdsPushDuration, applyBatchDuration, xdsManualResyncs, mapGCRemoved)
+	registry.MustRegister(authzPolicySwaps)
+	registry.MustRegister(xdsCoalescedUpdates)
+	registry.MustRegister(endpointHealthTransitions)
+	registry.MustRegister(controllerLastReconcile, controllerReconcileErrors)
+	registry.MustRegister(buildInfo, frontendConflicts)
+	registry.MustRegister(accesslogSocketDropped)
+	registry.MustRegister(cache.Metrics()...)
+	registry.MustRegister(utils.RingbufMetrics()...)
 
 	http.Handle("/status/metric", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		Registry: registry,
@@ -330,6 +536,135 @@ func runPrometheusClient(registry *prometheus.Registry) {
 	}
 }
 
+// SetLoadedNamespaces records the number of namespaces whose xds resources are loaded
+func SetLoadedNamespaces(count int) {
+	xdsLoadedNamespaces.Set(float64(count))
+}
+
+// SetLoadedResources records the number of loaded xds services and workloads
+func SetLoadedResources(services, workloads int) {
+	xdsLoadedResources.WithLabelValues("service").Set(float64(services))
+	xdsLoadedResources.WithLabelValues("workload").Set(float64(workloads))
+}
+
+// XdsType returns the short name of the type of an xds resource,
+// e.g. cluster for type.googleapis.com/envoy.config.cluster.v3.Cluster
+func XdsType(typeUrl string) string {
+	return strings.ToLower(typeUrl[strings.LastIndex(typeUrl, ".")+1:])
+}
+
+// SetXdsResources records the number of loaded xds resources of a type
+func SetXdsResources(resourceType string, count int) {
+	xdsResources.WithLabelValues(resourceType).Set(float64(count))
+}
+
+// ObserveXdsPush records how long the xds response of the type received at start took to be applied
+func ObserveXdsPush(typeUrl string, start time.Time) {
+	xdsPushDuration.WithLabelValues(XdsType(typeUrl)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveApplyBatch records how long the batch of workloads whose apply began at start took
+func ObserveApplyBatch(start time.Time) {
+	applyBatchDuration.Observe(time.Since(start).Seconds())
+}
+
+// AddXdsCoalescedUpdates records the updates of the xds resources of the type superseded within the coalesce window
+func AddXdsCoalescedUpdates(typeUrl string, count int) {
+	xdsCoalescedUpdates.WithLabelValues(XdsType(typeUrl)).Add(float64(count))
+}
+
+// IncManualResync records a resync of the xds state requested by an operator
+func IncManualResync() {
+	xdsManualResyncs.Inc()
+}
+
+// IncAuthzPolicySwap records the authorization policies changed by a xds response applied as a single generation
+func IncAuthzPolicySwap() {
+	authzPolicySwaps.Inc()
+}
+
+// IncEndpointHealthTransition records an endpoint of the service, named namespace/hostname, going to
+// the healthy or unhealthy state
+func IncEndpointHealthTransition(serviceName string, healthy bool) {
+	namespace, hostname, _ := strings.Cut(serviceName, "/")
+	state := "unhealthy"
+	if healthy {
+		state = "healthy"
+	}
+	endpointHealthTransitions.WithLabelValues(namespace, hostname, state).Inc()
+}
+
+// AddMapGCRemoved records the stale entries the garbage collection removed from a bpf map
+func AddMapGCRemoved(mapName string, count int) {
+	mapGCRemoved.WithLabelValues(mapName).Add(float64(count))
+}
+
+// The states of the xds connection, applied once the --on-xds-loss mode is applied after the grace period
+const (
+	XdsLossStateConnected    = "connected"
+	XdsLossStateDisconnected = "disconnected"
+	XdsLossStateApplied      = "applied"
+)
+
+// SetBuildInfo records the mode the daemon runs in, together with its version and the kernel of its node
+func SetBuildInfo(mode string) {
+	buildInfo.Reset()
+	buildInfo.WithLabelValues(mode, version.Get().GitVersion, utils.GetKernelVersion()).Set(1)
+}
+
+// IncFrontendConflicts records that a service claimed an address another service still had
+func IncFrontendConflicts() {
+	frontendConflicts.Inc()
+}
+
+// SetServiceBandwidth records whether the bandwidth of the direction of the service currently throttles
+// its connections, and the packets it throttled since the last time
+func SetServiceBandwidth(namespace, name, direction string, throttling bool, throttled uint32) {
+	value := 0.0
+	if throttling {
+		value = 1
+	}
+	serviceBandwidthThrottling.WithLabelValues(namespace, name, direction).Set(value)
+	serviceBandwidthThrottled.WithLabelValues(namespace, name, direction).Add(float64(throttled))
+}
+
+// DeleteServiceBandwidth forgets the bandwidth metrics of a service which no longer has a bandwidth
+func DeleteServiceBandwidth(namespace, name string) {
+	labels := prometheus.Labels{"destination_service_namespace": namespace, "destination_service_name": name}
+	_ = serviceBandwidthThrottling.DeletePartialMatch(labels)
+	_ = serviceBandwidthThrottled.DeletePartialMatch(labels)
+}
+
+// SetServiceHealth records the healthy endpoints of a service with a min healthy endpoints out of all of them,
+// and whether the new connections to it are refused
+func SetServiceHealth(namespace, name string, healthy, total uint32, unavailable bool) {
+	value := 0.0
+	if unavailable {
+		value = 1
+	}
+	serviceHealthyEndpoints.WithLabelValues(namespace, name).Set(float64(healthy))
+	serviceEndpoints.WithLabelValues(namespace, name).Set(float64(total))
+	serviceUnavailable.WithLabelValues(namespace, name).Set(value)
+}
+
+// DeleteServiceHealth forgets the health metrics of a service which no longer has a min healthy endpoints
+func DeleteServiceHealth(namespace, name string) {
+	serviceHealthyEndpoints.DeleteLabelValues(namespace, name)
+	serviceEndpoints.DeleteLabelValues(namespace, name)
+	serviceUnavailable.DeleteLabelValues(namespace, name)
+}
+
+// SetXdsLossState records the current state of the xds connection under the --on-xds-loss mode
+func SetXdsLossState(mode, state string) {
+	for _, s := range []string{XdsLossStateConnected, XdsLossStateDisconnected, XdsLossStateApplied} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		xdsLossState.WithLabelValues(mode, s).Set(value)
+	}
+}
+
 func DeleteWorkloadMetric(workload *workloadapi.Workload) {
 	if workload == nil {
 		return
@@ -383,6 +718,8 @@ func deleteServiceMetricInPrometheus(serviceName string) {
 	_ = tcpConnectionOpenedInService.DeletePartialMatch(prometheus.Labels{"destination_service_name": svcHost, "destination_service_namespace": svcNamespace})
 	_ = tcpReceivedBytesInService.DeletePartialMatch(prometheus.Labels{"destination_service_name": svcHost, "destination_service_namespace": svcNamespace})
 	_ = tcpSentBytesInService.DeletePartialMatch(prometheus.Labels{"destination_service_name": svcHost, "destination_service_namespace": svcNamespace})
+	_ = endpointHealthTransitions.DeletePartialMatch(prometheus.Labels{"destination_service_name": svcHost, "destination_service_namespace": svcNamespace})
+	DeleteServiceHealth(svcNamespace, svcHost)
 }
 
 func deleteConnectionMetricInPrometheus(connLabels *connectionMetricLabels) {
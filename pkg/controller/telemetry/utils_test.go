@@ -19,10 +19,18 @@ package telemetry
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/utils"
+	"kmesh.net/kmesh/pkg/version"
 )
 
 func TestRegisterMetrics(t *testing.T) {
@@ -417,3 +425,80 @@ func TestDeleteConnectionMetric(t *testing.T) {
 	}
 	cancel()
 }
+
+func TestObserveXdsPush(t *testing.T) {
+	assert.Equal(t, "cluster", XdsType("type.googleapis.com/envoy.config.cluster.v3.Cluster"))
+	assert.Equal(t, "address", XdsType("type.googleapis.com/istio.workload.Address"))
+
+	ObserveXdsPush("type.googleapis.com/istio.workload.Address", time.Now().Add(-50*time.Millisecond))
+	ObserveXdsPush("type.googleapis.com/istio.workload.Address", time.Now().Add(-3*time.Second))
+
+	metric := &dto.Metric{}
+	require.NoError(t, xdsPushDuration.WithLabelValues("address").(prometheus.Histogram).Write(metric))
+	histogram := metric.GetHistogram()
+	assert.Equal(t, uint64(2), histogram.GetSampleCount())
+	assert.InDelta(t, 3.05, histogram.GetSampleSum(), 0.5)
+	for _, bucket := range histogram.GetBucket() {
+		switch bucket.GetUpperBound() {
+		case 0.032:
+			assert.Equal(t, uint64(0), bucket.GetCumulativeCount())
+		case 0.064:
+			assert.Equal(t, uint64(1), bucket.GetCumulativeCount())
+		case 4.096:
+			assert.Equal(t, uint64(2), bucket.GetCumulativeCount())
+		}
+	}
+
+	SetXdsResources("service", 3)
+	assert.Equal(t, float64(3), testutil.ToFloat64(xdsResources.WithLabelValues("service")))
+}
+
+func TestSetBuildInfo(t *testing.T) {
+	SetBuildInfo(constants.KernelNativeMode)
+	SetBuildInfo(constants.DualEngineMode)
+
+	// only the mode last set is reported
+	assert.Equal(t, 1, testutil.CollectAndCount(buildInfo))
+	labels := []string{constants.DualEngineMode, version.Get().GitVersion, utils.GetKernelVersion()}
+	assert.Equal(t, 1.0, testutil.ToFloat64(buildInfo.WithLabelValues(labels...)))
+}
+
+func TestIncFrontendConflicts(t *testing.T) {
+	before := testutil.ToFloat64(frontendConflicts)
+	IncFrontendConflicts()
+	assert.Equal(t, before+1, testutil.ToFloat64(frontendConflicts))
+}
+
+func TestSetServiceBandwidth(t *testing.T) {
+	SetServiceBandwidth("default", "foo.default.svc.cluster.local", "egress", true, 3)
+	SetServiceBandwidth("default", "foo.default.svc.cluster.local", "egress", false, 2)
+	SetServiceBandwidth("default", "foo.default.svc.cluster.local", "ingress", true, 1)
+	assert.Equal(t, 0.0, testutil.ToFloat64(serviceBandwidthThrottling.WithLabelValues("default", "foo.default.svc.cluster.local", "egress")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(serviceBandwidthThrottled.WithLabelValues("default", "foo.default.svc.cluster.local", "egress")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(serviceBandwidthThrottling.WithLabelValues("default", "foo.default.svc.cluster.local", "ingress")))
+
+	DeleteServiceBandwidth("default", "foo.default.svc.cluster.local")
+	assert.Equal(t, 0, testutil.CollectAndCount(serviceBandwidthThrottling))
+	assert.Equal(t, 0, testutil.CollectAndCount(serviceBandwidthThrottled))
+}
+
+func TestAddXdsCoalescedUpdates(t *testing.T) {
+	before := testutil.ToFloat64(xdsCoalescedUpdates.WithLabelValues("address"))
+	AddXdsCoalescedUpdates("type.googleapis.com/istio.workload.Address", 3)
+	AddXdsCoalescedUpdates("type.googleapis.com/istio.workload.Address", 0)
+	assert.Equal(t, before+3, testutil.ToFloat64(xdsCoalescedUpdates.WithLabelValues("address")))
+}
+
+func TestSetServiceHealth(t *testing.T) {
+	SetServiceHealth("default", "foo.default.svc.cluster.local", 1, 3, true)
+	assert.Equal(t, 1.0, testutil.ToFloat64(serviceHealthyEndpoints.WithLabelValues("default", "foo.default.svc.cluster.local")))
+	assert.Equal(t, 3.0, testutil.ToFloat64(serviceEndpoints.WithLabelValues("default", "foo.default.svc.cluster.local")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(serviceUnavailable.WithLabelValues("default", "foo.default.svc.cluster.local")))
+
+	SetServiceHealth("default", "foo.default.svc.cluster.local", 2, 3, false)
+	assert.Equal(t, 0.0, testutil.ToFloat64(serviceUnavailable.WithLabelValues("default", "foo.default.svc.cluster.local")))
+
+	DeleteServiceHealth("default", "foo.default.svc.cluster.local")
+	assert.Equal(t, 0, testutil.CollectAndCount(serviceUnavailable))
+	assert.Equal(t, 0, testutil.CollectAndCount(serviceEndpoints))
+}
@@ -0,0 +1,254 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trace follows the connections matching a filter through the data plane
+// and reports the decisions they hit, for debugging purpose.
+package trace
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventTypePolicy     = "policy"
+	EventTypeConnection = "connection"
+
+	eventBufferSize = 256
+)
+
+// Filter selects the connections to trace, empty fields match everything.
+type Filter struct {
+	// Src is the source ip
+	Src netip.Addr
+	// DstAddr is the destination ip, either a service ip or a workload ip
+	DstAddr netip.Addr
+	// DstName is the destination service name or hostname, e.g. helloworld or helloworld.default.svc.cluster.local
+	DstName string
+	// DstPort is the destination service port or target port
+	DstPort uint32
+}
+
+// ParseFilter parses a filter from a source ip and a destination of form host[:port],
+// where host is an ip or a service name.
+func ParseFilter(src, dst string) (Filter, error) {
+	var (
+		filter Filter
+		err    error
+	)
+
+	if src != "" {
+		if filter.Src, err = netip.ParseAddr(src); err != nil {
+			return filter, fmt.Errorf("invalid source %q: %v", src, err)
+		}
+	}
+
+	if dst != "" {
+		host := dst
+		if h, p, err := net.SplitHostPort(dst); err == nil {
+			port, err := strconv.ParseUint(p, 10, 16)
+			if err != nil {
+				return filter, fmt.Errorf("invalid destination port %q: %v", p, err)
+			}
+			host = h
+			filter.DstPort = uint32(port)
+		}
+		if addr, err := netip.ParseAddr(host); err == nil {
+			filter.DstAddr = addr
+		} else {
+			filter.DstName = host
+		}
+	}
+
+	return filter, nil
+}
+
+func (f *Filter) String() string {
+	dst := "*"
+	if f.DstAddr.IsValid() {
+		dst = f.DstAddr.String()
+	} else if f.DstName != "" {
+		dst = f.DstName
+	}
+	src := "*"
+	if f.Src.IsValid() {
+		src = f.Src.String()
+	}
+	if f.DstPort != 0 {
+		dst = fmt.Sprintf("%s:%d", dst, f.DstPort)
+	}
+	return src + " -> " + dst
+}
+
+// Connection is what is known about a connection when a decision is made.
+type Connection struct {
+	Src netip.Addr
+	// DstAddrs are the destination ips of the connection, e.g. the service ip and the chosen backend ip
+	DstAddrs []netip.Addr
+	// DstPorts are the destination ports of the connection, e.g. the service port and the target port
+	DstPorts []uint32
+	// DstNames are the names of the destination service, e.g. its name and hostname
+	DstNames []string
+}
+
+func (f *Filter) match(conn *Connection) bool {
+	if f.Src.IsValid() && f.Src.Unmap() != conn.Src.Unmap() {
+		return false
+	}
+	return f.MatchDestination(conn)
+}
+
+// MatchDestination tells whether the destination of conn matches the filter, whatever its source
+func (f *Filter) MatchDestination(conn *Connection) bool {
+	if f.DstAddr.IsValid() && !containsAddr(conn.DstAddrs, f.DstAddr) {
+		return false
+	}
+	if f.DstName != "" && !containsName(conn.DstNames, f.DstName) {
+		return false
+	}
+	if f.DstPort != 0 {
+		for _, port := range conn.DstPorts {
+			if port == f.DstPort {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsAddr(addrs []netip.Addr, addr netip.Addr) bool {
+	for _, a := range addrs {
+		if a.Unmap() == addr.Unmap() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == "" {
+			continue
+		}
+		// a short name matches the hostname of the service
+		if n == name || strings.HasPrefix(n, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a decision a traced connection hits in the data plane.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	// Service is the destination service the connection is load balanced for
+	Service string `json:"service,omitempty"`
+	// Backend is the workload the connection is routed to
+	Backend string `json:"backend,omitempty"`
+	// LocalityTier is the locality priority of the backend, 0 is the closest one
+	LocalityTier *uint32 `json:"localityTier,omitempty"`
+	State        string  `json:"state,omitempty"`
+	// Verdict is ALLOW or DENY for policy events
+	Verdict string `json:"verdict,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Tracer delivers the events of the connections matching its filter to a single consumer.
+// A nil Tracer is valid and never enabled.
+type Tracer struct {
+	enabled atomic.Bool
+
+	mutex  sync.Mutex
+	filter Filter
+	events chan Event
+	timer  *time.Timer
+	// called once the trace stops
+	onStop func()
+}
+
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// Start enables tracing of the connections matching filter. The trace stops automatically
+// after timeout, at which point the returned channel is closed and onStop is called.
+func (t *Tracer) Start(filter Filter, timeout time.Duration, onStop func()) (<-chan Event, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.events != nil {
+		return nil, fmt.Errorf("a trace of %s is already running", t.filter.String())
+	}
+	t.filter = filter
+	t.events = make(chan Event, eventBufferSize)
+	t.onStop = onStop
+	t.timer = time.AfterFunc(timeout, t.Stop)
+	t.enabled.Store(true)
+	return t.events, nil
+}
+
+// Stop disables tracing, it is a no-op if no trace is running.
+func (t *Tracer) Stop() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.events == nil {
+		return
+	}
+	t.enabled.Store(false)
+	t.timer.Stop()
+	close(t.events)
+	t.events = nil
+	if t.onStop != nil {
+		t.onStop()
+		t.onStop = nil
+	}
+}
+
+// Enabled is a cheap check callers can do before building a Connection.
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.enabled.Load()
+}
+
+// Emit delivers ev if conn matches the filter. Events are dropped if the consumer falls behind.
+func (t *Tracer) Emit(conn *Connection, ev Event) {
+	if !t.Enabled() {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.events == nil || !t.filter.match(conn) {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case t.events <- ev:
+	default:
+	}
+}
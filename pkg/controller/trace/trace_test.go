@@ -0,0 +1,134 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		dst     string
+		want    Filter
+		wantErr bool
+	}{
+		{
+			name: "service name with port",
+			src:  "10.0.0.5",
+			dst:  "helloworld:5000",
+			want: Filter{Src: netip.MustParseAddr("10.0.0.5"), DstName: "helloworld", DstPort: 5000},
+		},
+		{
+			name: "ip without port",
+			dst:  "10.96.0.10",
+			want: Filter{DstAddr: netip.MustParseAddr("10.96.0.10")},
+		},
+		{
+			name: "ipv6 with port",
+			dst:  "[fd00::10]:80",
+			want: Filter{DstAddr: netip.MustParseAddr("fd00::10"), DstPort: 80},
+		},
+		{
+			name:    "invalid source",
+			src:     "helloworld",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			dst:     "helloworld:http",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilter(tt.src, tt.dst)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTracer(t *testing.T) {
+	var nilTracer *Tracer
+	assert.False(t, nilTracer.Enabled())
+	nilTracer.Emit(&Connection{}, Event{})
+
+	tracer := NewTracer()
+	filter, _ := ParseFilter("10.0.0.5", "helloworld:5000")
+	stopped := make(chan struct{})
+	events, err := tracer.Start(filter, time.Second, func() { close(stopped) })
+	assert.NoError(t, err)
+	assert.True(t, tracer.Enabled())
+
+	_, err = tracer.Start(filter, time.Second, nil)
+	assert.Error(t, err)
+
+	matched := &Connection{
+		Src:      netip.MustParseAddr("10.0.0.5"),
+		DstAddrs: []netip.Addr{netip.MustParseAddr("10.96.0.10"), netip.MustParseAddr("10.244.1.3")},
+		DstPorts: []uint32{5000, 8080},
+		DstNames: []string{"helloworld.sample.svc.cluster.local"},
+	}
+	otherSource := *matched
+	otherSource.Src = netip.MustParseAddr("10.0.0.6")
+	otherPort := *matched
+	otherPort.DstPorts = []uint32{80}
+	otherService := *matched
+	otherService.DstNames = []string{"helloworld2.sample.svc.cluster.local"}
+
+	// the source is left out when matching the destination only
+	assert.True(t, filter.MatchDestination(&otherSource))
+	assert.False(t, filter.MatchDestination(&otherPort))
+	assert.False(t, filter.MatchDestination(&otherService))
+
+	tracer.Emit(&otherSource, Event{Type: EventTypeConnection, Source: "other source"})
+	tracer.Emit(&otherPort, Event{Type: EventTypeConnection, Source: "other port"})
+	tracer.Emit(&otherService, Event{Type: EventTypeConnection, Source: "other service"})
+	tracer.Emit(matched, Event{Type: EventTypePolicy, Verdict: "ALLOW"})
+
+	ev := <-events
+	assert.Equal(t, EventTypePolicy, ev.Type)
+	assert.Equal(t, "ALLOW", ev.Verdict)
+	assert.False(t, ev.Time.IsZero())
+
+	// the trace auto disables after timeout
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("trace is not stopped after timeout")
+	}
+	_, ok := <-events
+	assert.False(t, ok)
+	assert.False(t, tracer.Enabled())
+	tracer.Emit(matched, Event{})
+	tracer.Stop()
+
+	// can be started again
+	_, err = tracer.Start(filter, time.Second, nil)
+	assert.NoError(t, err)
+	tracer.Stop()
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"sync"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+)
+
+// accesslogFieldsCache keeps the fields parsed from each kmesh.net/accesslog-fields value, so that
+// the annotation is not parsed, nor an invalid one warned about, on every connection report
+type accesslogFieldsCache struct {
+	mutex   sync.Mutex
+	byValue map[string][]string
+}
+
+// AccesslogFields returns the kmesh.net/accesslog-fields of the service,
+// nil if unset or invalid for the accesslog entries to have all the fields
+func (p *Processor) AccesslogFields(service *workloadapi.Service) []string {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.AccesslogFieldsAnnotation)
+	if !ok {
+		return nil
+	}
+
+	p.accesslogFields.mutex.Lock()
+	defer p.accesslogFields.mutex.Unlock()
+	if fields, ok := p.accesslogFields.byValue[value]; ok {
+		return fields
+	}
+	fields, err := telemetry.ParseAccesslogFields(value)
+	if err != nil {
+		log.Warnf("invalid %s annotation %q on service %s, all the fields are logged: %v",
+			constants.AccesslogFieldsAnnotation, value, service.ResourceName(), err)
+	}
+	p.accesslogFields.byValue[value] = fields
+	return fields
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"strings"
+
+	istioclient "istio.io/client-go/pkg/clientset/versioned"
+	istioinformers "istio.io/client-go/pkg/informers/externalversions"
+	securitylisters "istio.io/client-go/pkg/listers/security/v1"
+	"istio.io/istio/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// AuditPolicyController watches the AuthorizationPolicies of the cluster and the pods of the node, and hands
+// the AUDIT policies applying to each pod to the userspace authz. istiod does not push the AUDIT policies to
+// kmesh, they are only logged by the userspace authz and never enforced in xdp.
+type AuditPolicyController struct {
+	podInformerFactory    informers.SharedInformerFactory
+	policyInformerFactory istioinformers.SharedInformerFactory
+	informers             []cache.SharedIndexInformer
+	policies              securitylisters.AuthorizationPolicyLister
+	pods                  corelisters.PodLister
+	rbac                  *auth.Rbac
+	rootNamespace         string
+
+	// pods of the node handed over by the last sync, keyed by namespace/name
+	synced sets.Set[string]
+	// notifies a change, the AUDIT policies of all the pods of the node are converted again
+	changed chan struct{}
+}
+
+func NewAuditPolicyController(client kubernetes.Interface, istioClient istioclient.Interface, rbac *auth.Rbac,
+	rootNamespace string) *AuditPolicyController {
+	podInformerFactory := kube.NewInformerFactory(client)
+	podInformer := podInformerFactory.Core().V1().Pods()
+	policyInformerFactory := istioinformers.NewSharedInformerFactory(istioClient, 0)
+	policyInformer := policyInformerFactory.Security().V1().AuthorizationPolicies()
+
+	c := &AuditPolicyController{
+		podInformerFactory:    podInformerFactory,
+		policyInformerFactory: policyInformerFactory,
+		informers:             []cache.SharedIndexInformer{policyInformer.Informer(), podInformer.Informer()},
+		policies:              policyInformer.Lister(),
+		pods:                  podInformer.Lister(),
+		rbac:                  rbac,
+		rootNamespace:         rootNamespace,
+		synced:                sets.New[string](),
+		changed:               make(chan struct{}, 1),
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+	for _, informer := range c.informers {
+		_, _ = informer.AddEventHandler(handler)
+	}
+
+	return c
+}
+
+func (c *AuditPolicyController) Run(stop <-chan struct{}) {
+	c.podInformerFactory.Start(stop)
+	c.policyInformerFactory.Start(stop)
+	for _, informer := range c.informers {
+		if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+			log.Error("failed to wait AuthorizationPolicy cache sync")
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.changed:
+			c.sync()
+		}
+	}
+}
+
+// notify coalesces the changes notified before the next sync
+func (c *AuditPolicyController) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *AuditPolicyController) sync() {
+	policies, err := c.policies.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AuthorizationPolicies: %v", err)
+		return
+	}
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list pods: %v", err)
+		return
+	}
+
+	synced := sets.New[string]()
+	for _, pod := range pods {
+		if pod.Spec.HostNetwork {
+			continue
+		}
+		audits := auth.AuditPolicies(pod, policies, c.rootNamespace)
+		if len(audits) == 0 {
+			continue
+		}
+		synced.Insert(pod.Namespace + "/" + pod.Name)
+		c.rbac.UpdatePodAuditPolicies(pod.Namespace, pod.Name, audits)
+	}
+	for key := range c.synced.Difference(synced) {
+		namespace, name, _ := strings.Cut(key, "/")
+		c.rbac.UpdatePodAuditPolicies(namespace, name, nil)
+	}
+	c.synced = synced
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"istio.io/api/security/v1beta1"
+	securityclient "istio.io/client-go/pkg/apis/security/v1"
+	istiofake "istio.io/client-go/pkg/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+func TestAuditPolicyController(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/server",
+		Name:      "server",
+		Namespace: "default",
+		Addresses: [][]byte{{10, 244, 0, 1}},
+	})
+	rbac := auth.NewRbac(workloadCache)
+
+	ap := &securityclient.AuthorizationPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "audit-port", Namespace: "default"},
+		Spec: v1beta1.AuthorizationPolicy{
+			Action: v1beta1.AuthorizationPolicy_AUDIT,
+			Rules: []*v1beta1.Rule{{
+				To: []*v1beta1.Rule_To{{Operation: &v1beta1.Operation{Ports: []string{"8080"}}}},
+			}},
+		},
+	}
+	clientset := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "server", Namespace: "default"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.244.0.1"},
+	})
+	istioClientset := istiofake.NewSimpleClientset(ap)
+	stop := make(chan struct{})
+	defer close(stop)
+	go NewAuditPolicyController(clientset, istioClientset, rbac, "istio-system").Run(stop)
+
+	src := netip.MustParseAddr("10.244.0.2")
+	dst := netip.MustParseAddr("10.244.0.1")
+	assert.Eventually(t, func() bool {
+		return len(rbac.Explain(src, dst, 8080).Audits) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	verdict := rbac.Explain(src, dst, 8080)
+	assert.True(t, verdict.Allowed)
+	assert.Equal(t, "default/audit-port", verdict.Audits[0].ResourceName())
+	assert.Empty(t, rbac.Explain(src, dst, 9090).Audits)
+
+	// the policy is removed with the AuthorizationPolicy
+	require.NoError(t, istioClientset.SecurityV1().AuthorizationPolicies("default").Delete(context.TODO(), ap.Name, metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return len(rbac.Explain(src, dst, 8080).Audits) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
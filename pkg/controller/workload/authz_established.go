@@ -0,0 +1,149 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+)
+
+// InboundSocketOperator lists and closes the inbound connections of the workloads on the node
+type InboundSocketOperator interface {
+	// InboundSockets returns the established inbound connections of the workload with the local address
+	InboundSockets(local netip.Addr) ([]telemetry.SocketID, error)
+	// Destroy closes the socket, the peer is reset
+	Destroy(id telemetry.SocketID) error
+}
+
+// establishedEnforcer closes the established inbound connections of the pods annotated with
+// kmesh.net/authz-enforce-established that a DENY policy denies. The data plane only authorizes
+// the connections when they are established, so a DENY policy pushed later would not apply to them.
+type establishedEnforcer struct {
+	processor *Processor
+	rbac      *auth.Rbac
+	ops       InboundSocketOperator
+	// signaled when a DENY policy is pushed, the policies pushed during a sweep are swept once after it
+	sweepCh chan struct{}
+}
+
+func newEstablishedEnforcer(processor *Processor, rbac *auth.Rbac, ops InboundSocketOperator) *establishedEnforcer {
+	return &establishedEnforcer{
+		processor: processor,
+		rbac:      rbac,
+		ops:       ops,
+		sweepCh:   make(chan struct{}, 1),
+	}
+}
+
+// trigger sweeps the established connections again, it does not block
+func (e *establishedEnforcer) trigger() {
+	if e == nil {
+		return
+	}
+	select {
+	case e.sweepCh <- struct{}{}:
+	default:
+	}
+}
+
+func (e *establishedEnforcer) Run(stopCh <-chan struct{}) {
+	if e == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-e.sweepCh:
+			if closed := e.sweep(); closed > 0 {
+				log.Infof("closed %d established connections denied by the authorization policies", closed)
+			}
+		}
+	}
+}
+
+// sweep closes the established inbound connections of the annotated pods that a DENY policy
+// denies, and returns how many were closed
+func (e *establishedEnforcer) sweep() int {
+	closed := 0
+	for _, workload := range e.processor.enforceEstablishedWorkloads() {
+		for _, raw := range workload.GetAddresses() {
+			addr, ok := netip.AddrFromSlice(raw)
+			if !ok {
+				continue
+			}
+			sockets, err := e.ops.InboundSockets(addr)
+			if err != nil {
+				log.Errorf("failed to list the established connections of %s: %v", workload.ResourceName(), err)
+				continue
+			}
+			for _, id := range sockets {
+				verdict := e.rbac.Explain(id.Remote.Addr(), id.Local.Addr(), uint32(id.Local.Port()))
+				// only the connections a DENY policy matches are closed, the ones no ALLOW policy
+				// matches anymore are kept as they were without the annotation
+				if verdict.Allowed || verdict.Policy.GetAction() != security.Action_DENY {
+					continue
+				}
+				if err := e.ops.Destroy(id); err != nil {
+					log.Errorf("failed to close the connection from %s to %s denied by %s/%s: %v",
+						id.Remote, id.Local, verdict.Policy.GetNamespace(), verdict.Policy.GetName(), err)
+					continue
+				}
+				log.Debugf("closed the connection from %s to %s denied by %s/%s",
+					id.Remote, id.Local, verdict.Policy.GetNamespace(), verdict.Policy.GetName())
+				closed++
+			}
+		}
+	}
+	return closed
+}
+
+// HandlePodEnforceEstablished records whether the kmesh.net/authz-enforce-established annotation
+// of a pod of the node is set to true
+func (p *Processor) HandlePodEnforceEstablished(namespace, name string, enabled bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := namespace + "/" + name
+	if enabled {
+		p.enforceEstablishedPods.Insert(key)
+	} else {
+		p.enforceEstablishedPods.Delete(key)
+	}
+}
+
+// enforceEstablishedWorkloads returns the workloads on the node of the annotated pods
+func (p *Processor) enforceEstablishedWorkloads() []*workloadapi.Workload {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.enforceEstablishedPods.Len() == 0 {
+		return nil
+	}
+	var workloads []*workloadapi.Workload
+	for _, workload := range p.WorkloadCache.List() {
+		if workload.GetNode() == p.nodeName && p.enforceEstablishedPods.Contains(workload.GetNamespace()+"/"+workload.GetName()) {
+			workloads = append(workloads, workload)
+		}
+	}
+	return workloads
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+type fakeInboundSocketOperator struct {
+	sockets   map[netip.Addr][]telemetry.SocketID
+	destroyed []telemetry.SocketID
+}
+
+func (o *fakeInboundSocketOperator) InboundSockets(local netip.Addr) ([]telemetry.SocketID, error) {
+	return o.sockets[local], nil
+}
+
+func (o *fakeInboundSocketOperator) Destroy(id telemetry.SocketID) error {
+	o.destroyed = append(o.destroyed, id)
+	return nil
+}
+
+func TestEstablishedEnforcerSweep(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	p.nodeName = "node1"
+	for _, workload := range []*workloadapi.Workload{
+		{Uid: "cluster0//Pod/default/server", Name: "server", Namespace: "default", Node: "node1",
+			Addresses: [][]byte{netip.MustParseAddr("10.244.0.5").AsSlice()}},
+		// the pods of other nodes are not swept
+		{Uid: "cluster0//Pod/default/remote", Name: "remote", Namespace: "default", Node: "node2",
+			Addresses: [][]byte{netip.MustParseAddr("10.244.1.5").AsSlice()}},
+	} {
+		p.WorkloadCache.AddOrUpdateWorkload(workload)
+	}
+
+	rbac := auth.NewRbac(p.WorkloadCache)
+	require.NoError(t, rbac.UpdatePolicy(&security.Authorization{
+		Name:      "deny-8080",
+		Namespace: "default",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{
+			Clauses: []*security.Clause{{
+				Matches: []*security.Match{{DestinationPorts: []uint32{8080}}},
+			}},
+		}},
+	}))
+
+	denied := telemetry.SocketID{
+		Local:  netip.MustParseAddrPort("10.244.0.5:8080"),
+		Remote: netip.MustParseAddrPort("10.244.2.3:40001"),
+	}
+	allowed := telemetry.SocketID{
+		Local:  netip.MustParseAddrPort("10.244.0.5:9090"),
+		Remote: netip.MustParseAddrPort("10.244.2.3:40002"),
+	}
+	remote := telemetry.SocketID{
+		Local:  netip.MustParseAddrPort("10.244.1.5:8080"),
+		Remote: netip.MustParseAddrPort("10.244.2.3:40003"),
+	}
+	ops := &fakeInboundSocketOperator{
+		sockets: map[netip.Addr][]telemetry.SocketID{
+			denied.Local.Addr(): {denied, allowed},
+			remote.Local.Addr(): {remote},
+		},
+	}
+	e := newEstablishedEnforcer(p, rbac, ops)
+
+	// the connections of the pods without the annotation are kept
+	assert.Equal(t, 0, e.sweep())
+	assert.Empty(t, ops.destroyed)
+
+	p.HandlePodEnforceEstablished("default", "server", true)
+	p.HandlePodEnforceEstablished("default", "remote", true)
+	assert.Equal(t, 1, e.sweep())
+	assert.Equal(t, []telemetry.SocketID{denied}, ops.destroyed)
+
+	p.HandlePodEnforceEstablished("default", "server", false)
+	ops.destroyed = nil
+	assert.Equal(t, 0, e.sweep())
+	assert.Empty(t, ops.destroyed)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+// bandwidthMetricInterval is how often the throttling of the services with a bandwidth is exported
+const bandwidthMetricInterval = 5 * time.Second
+
+// bandwidthDirections names the directions of the bandwidth, in the annotation and the metrics
+var bandwidthDirections = [bpf.BandwidthDirections]string{
+	bpf.BandwidthEgress:  "egress",
+	bpf.BandwidthIngress: "ingress",
+}
+
+// bandwidthUnits are the units of the rates of the kmesh.net/bandwidth annotation, in bits per second
+var bandwidthUnits = []struct {
+	suffix string
+	bits   float64
+}{
+	{"gbps", 1e9},
+	{"mbps", 1e6},
+	{"kbps", 1e3},
+	{"bps", 1},
+}
+
+// parseBandwidth converts a rate like 10Mbps to bytes per second
+func parseBandwidth(value string) (uint32, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, unit := range bandwidthUnits {
+		number, found := strings.CutSuffix(value, unit.suffix)
+		if !found {
+			continue
+		}
+		n, err := strconv.ParseFloat(number, 64)
+		bytes := n * unit.bits / 8
+		if err != nil || !(bytes >= 1 && bytes <= bpf.MaxBandwidth) {
+			return 0, false
+		}
+		return uint32(bytes), true
+	}
+	return 0, false
+}
+
+// getBandwidth returns the kmesh.net/bandwidth of the service in bytes per second by direction, 0 if unset
+func (p *Processor) getBandwidth(service *workloadapi.Service) [bpf.BandwidthDirections]uint32 {
+	var bandwidth [bpf.BandwidthDirections]uint32
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.BandwidthAnnotation)
+	if !ok {
+		return bandwidth
+	}
+
+	invalid := func() [bpf.BandwidthDirections]uint32 {
+		log.Warnf("invalid %s annotation %q on service %s, should be like 10Mbps or egress=10Mbps,ingress=100Mbps "+
+			"with rates between 8bps and 34Gbps", constants.BandwidthAnnotation, value, service.ResourceName())
+		return [bpf.BandwidthDirections]uint32{}
+	}
+
+	// a single rate limits both directions
+	if !strings.Contains(value, "=") {
+		rate, ok := parseBandwidth(value)
+		if !ok {
+			return invalid()
+		}
+		return [bpf.BandwidthDirections]uint32{rate, rate}
+	}
+	for _, item := range strings.Split(value, ",") {
+		direction, val, _ := strings.Cut(strings.TrimSpace(item), "=")
+		rate, ok := parseBandwidth(val)
+		if !ok {
+			return invalid()
+		}
+		switch direction {
+		case bandwidthDirections[bpf.BandwidthEgress]:
+			bandwidth[bpf.BandwidthEgress] = rate
+		case bandwidthDirections[bpf.BandwidthIngress]:
+			bandwidth[bpf.BandwidthIngress] = rate
+		default:
+			return invalid()
+		}
+	}
+	return bandwidth
+}
+
+// updateServiceBandwidth applies the bandwidth of the service to the service map, only the connections
+// established while the service has a bandwidth are limited
+func (p *Processor) updateServiceBandwidth(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	bandwidth := p.getBandwidth(service)
+	if sv.Bandwidth == bandwidth {
+		return nil
+	}
+	sv.Bandwidth = bandwidth
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// refreshBandwidthMetrics exports whether the bandwidth of the services currently throttles their
+// connections, and the packets it throttled since the last refresh
+func (p *Processor) refreshBandwidthMetrics() {
+	now, err := bpf.MonotonicNow()
+	if err != nil {
+		log.Warnf("failed to read the monotonic clock: %v", err)
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	throttled := make(map[string][bpf.BandwidthDirections]uint32)
+	for _, service := range p.ServiceCache.List() {
+		name := service.ResourceName()
+		sk := bpf.ServiceKey{ServiceId: p.hashName.Hash(name)}
+		sv := bpf.ServiceValue{}
+		if err := p.bpf.ServiceLookup(&sk, &sv); err != nil || sv.Bandwidth == [bpf.BandwidthDirections]uint32{} {
+			continue
+		}
+		last := p.bandwidthThrottled[name]
+		for direction, count := range sv.BandwidthThrottled {
+			// the counters of the data plane wrap around
+			telemetry.SetServiceBandwidth(service.GetNamespace(), service.GetHostname(), bandwidthDirections[direction],
+				sv.BandwidthThrottling(direction, now), count-last[direction])
+		}
+		throttled[name] = sv.BandwidthThrottled
+	}
+
+	for name := range p.bandwidthThrottled {
+		if _, ok := throttled[name]; !ok {
+			namespace, hostname, _ := strings.Cut(name, "/")
+			telemetry.DeleteServiceBandwidth(namespace, hostname)
+		}
+	}
+	p.bandwidthThrottled = throttled
+}
+
+// runBandwidthMetrics exports the throttling of the services with a bandwidth until stopCh is closed
+func (p *Processor) runBandwidthMetrics(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(bandwidthMetricInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			p.refreshBandwidthMetrics()
+		}
+	}
+}
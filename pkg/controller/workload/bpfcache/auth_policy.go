@@ -26,8 +26,16 @@ type WorkloadPolicyKey struct {
 	WorklodId uint32 // workloadIp to uint32
 }
 
+// AuthzOffload of a workload, whether its policies are enforced in xdp or in the daemon
+const (
+	AuthzOffloadNode     = uint32(0) // as set for the node
+	AuthzOffloadEnabled  = uint32(1)
+	AuthzOffloadDisabled = uint32(2)
+)
+
 type WorkloadPolicyValue struct {
-	PolicyIds [4]uint32 // name length is [MAX_MEMBER_NUM_PER_POLICY]
+	PolicyIds    [4]uint32 // name length is [MAX_MEMBER_NUM_PER_POLICY]
+	AuthzOffload uint32
 }
 
 func (c *Cache) WorkloadPolicyUpdate(key *WorkloadPolicyKey, value *WorkloadPolicyValue) error {
@@ -53,3 +61,9 @@ func (c *Cache) WorkloadPolicyLookupAll() []WorkloadPolicyValue {
 	log.Debugf("WorkloadPolicyLookupAll")
 	return LookupAll[WorkloadPolicyKey, WorkloadPolicyValue](c.bpfMap.KmWlpolicy)
 }
+
+// WorkloadPolicyEntries returns all the entries of the workload policy map by key
+func (c *Cache) WorkloadPolicyEntries() map[WorkloadPolicyKey]WorkloadPolicyValue {
+	log.Debugf("WorkloadPolicyEntries")
+	return LookupAllEntries[WorkloadPolicyKey, WorkloadPolicyValue](c.bpfMap.KmWlpolicy)
+}
@@ -18,8 +18,10 @@ package bpfcache
 
 import (
 	"errors"
+	"time"
 
 	"github.com/cilium/ebpf"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -38,6 +40,33 @@ type BackendValue struct {
 	Services     ServiceList
 	WaypointAddr [16]byte
 	WaypointPort uint32
+	// ConnectFailNs is when a connection to the backend last failed to establish,
+	// it is written by the data plane and kept across workload updates
+	ConnectFailNs uint64
+	// ConnectFailCount is the number of connections to the backend which failed to establish in a row,
+	// it is written by the data plane and kept across workload updates
+	ConnectFailCount uint32
+	// ActiveConnections is the number of connections to the backend established and not closed yet,
+	// it is written by the data plane and kept across workload updates
+	ActiveConnections uint32
+}
+
+// KeepDataPlaneState copies the fields written by the data plane from the current value of the backend,
+// so that updating the backend neither forgets its connect failures nor its active connections
+func (v *BackendValue) KeepDataPlaneState(current *BackendValue) {
+	v.ConnectFailNs = current.ConnectFailNs
+	v.ConnectFailCount = current.ConnectFailCount
+	v.ActiveConnections = current.ActiveConnections
+}
+
+// EjectedBy reports whether the outlier detection of the service currently ejects the backend,
+// now is the time since boot as the data plane sees it
+func (v *BackendValue) EjectedBy(service *ServiceValue, now time.Duration) bool {
+	if service.OutlierConsecutiveErrors == 0 || v.ConnectFailCount < service.OutlierConsecutiveErrors {
+		return false
+	}
+	ejectionTime := time.Duration(service.OutlierEjectionTime) * time.Millisecond
+	return now-time.Duration(v.ConnectFailNs) < ejectionTime
 }
 
 func (c *Cache) BackendUpdate(key *BackendKey, value *BackendValue) error {
@@ -69,3 +98,39 @@ func (c *Cache) BackendLookupAll() []BackendValue {
 	log.Debugf("BackendLookupAll")
 	return LookupAll[BackendKey, BackendValue](c.bpfMap.KmBackend)
 }
+
+// BackendEntries returns all the entries of the backend map by key
+func (c *Cache) BackendEntries() map[BackendKey]BackendValue {
+	log.Debugf("BackendEntries")
+	return LookupAllEntries[BackendKey, BackendValue](c.bpfMap.KmBackend)
+}
+
+// BackendEjectedBy returns the ids of the services whose outlier detection currently ejects the backend
+func (c *Cache) BackendEjectedBy(value *BackendValue) []uint32 {
+	now, err := MonotonicNow()
+	if err != nil {
+		log.Warnf("failed to read the monotonic clock: %v", err)
+		return nil
+	}
+
+	var ejectedBy []uint32
+	for _, serviceId := range value.Services[:min(value.ServiceCount, MaxServiceNum)] {
+		sv := ServiceValue{}
+		if err := c.ServiceLookup(&ServiceKey{ServiceId: serviceId}, &sv); err != nil {
+			continue
+		}
+		if value.EjectedBy(&sv, now) {
+			ejectedBy = append(ejectedBy, serviceId)
+		}
+	}
+	return ejectedBy
+}
+
+// MonotonicNow returns the time since boot as the data plane sees it, bpf_ktime_get_ns reads the monotonic clock
+func MonotonicNow() (time.Duration, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return 0, err
+	}
+	return time.Duration(ts.Nano()), nil
+}
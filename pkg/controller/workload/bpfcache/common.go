@@ -33,3 +33,18 @@ func LookupAll[K any, V any](bpfMap *ebpf.Map) []V {
 	}
 	return ret
 }
+
+// LookupAllEntries returns all the entries of the map by key
+func LookupAllEntries[K comparable, V any](bpfMap *ebpf.Map) map[K]V {
+	var (
+		key   K
+		value V
+		ret   = make(map[K]V)
+	)
+
+	iter := bpfMap.Iterate()
+	for iter.Next(&key, &value) {
+		ret[key] = value
+	}
+	return ret
+}
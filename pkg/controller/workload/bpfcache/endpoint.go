@@ -36,6 +36,7 @@ type EndpointKey struct {
 
 type EndpointValue struct {
 	BackendUid uint32 // workloadUid to uint32
+	Weight     uint32 // relative weight of the endpoint among the ones of its priority, 0 means 1
 }
 
 func (c *Cache) EndpointUpdate(key *EndpointKey, value *EndpointValue) error {
@@ -177,3 +178,9 @@ func (c *Cache) EndpointLookupAll() []EndpointValue {
 	log.Debugf("EndpointLookupAll")
 	return LookupAll[EndpointKey, EndpointValue](c.bpfMap.KmEndpoint)
 }
+
+// EndpointEntries returns all the entries of the endpoint map by key
+func (c *Cache) EndpointEntries() map[EndpointKey]EndpointValue {
+	log.Debugf("EndpointEntries")
+	return LookupAllEntries[EndpointKey, EndpointValue](c.bpfMap.KmEndpoint)
+}
@@ -26,7 +26,7 @@ import (
 	bpf2go "kmesh.net/kmesh/bpf/kmesh/bpf2go/dualengine"
 )
 
-func NewFakeWorkloadMap(t *testing.T) bpf2go.KmeshCgroupSockWorkloadMaps {
+func NewFakeWorkloadMap(t testing.TB) bpf2go.KmeshCgroupSockWorkloadMaps {
 	_ = rlimit.RemoveMemlock()
 	backEndMap, err := ebpf.NewMap(&ebpf.MapSpec{
 		Name:       "kmesh_backend",
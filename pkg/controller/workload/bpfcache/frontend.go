@@ -79,3 +79,9 @@ func (c *Cache) FrontendLookupAll() []FrontendValue {
 	log.Debugf("FrontendLookupAll")
 	return LookupAll[FrontendKey, FrontendValue](c.bpfMap.KmFrontend)
 }
+
+// FrontendEntries returns all the entries of the frontend map by key
+func (c *Cache) FrontendEntries() map[FrontendKey]FrontendValue {
+	log.Debugf("FrontendEntries")
+	return LookupAllEntries[FrontendKey, FrontendValue](c.bpfMap.KmFrontend)
+}
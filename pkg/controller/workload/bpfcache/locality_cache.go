@@ -17,8 +17,11 @@
 package bpfcache
 
 import (
+	"slices"
 	"sync"
 
+	corev1 "k8s.io/api/core/v1"
+
 	"kmesh.net/kmesh/api/v2/workloadapi"
 )
 
@@ -32,6 +35,15 @@ type localityInfo struct {
 	network   string // workload.GetNetwork()
 }
 
+// UnknownLocalityPrio is the priority of the workloads whose locality is unknown, the lowest one
+const UnknownLocalityPrio = PrioCount - 1
+
+// subzoneLabel is the node label istiod learns the subzone of the workloads from
+const subzoneLabel = "topology.istio.io/subzone"
+
+// unlabeledNodes are the nodes already warned about for a missing topology label
+var unlabeledNodes sync.Map
+
 type LocalityCache struct {
 	mutex        sync.RWMutex
 	LocalityInfo *localityInfo
@@ -59,7 +71,25 @@ func (l *LocalityCache) SetLocality(nodeName, clusterId, network string, localit
 	l.LocalityInfo.network = network
 }
 
+// CalcLocalityLBPrio returns the priority of the workload, 0 is the closest one.
+// The workloads of remote clusters are a distinct tier ranked below all the local cluster ones, unless
+// the routing preference orders by cluster. Kmesh does not discover them itself, it has no secondary xds
+// or remote secret of its own: they must be sent by istiod, which learns them from the remote secrets.
+// The workloads whose locality is unknown, their node lacking a topology label the local node has,
+// are only used as the last resort.
 func (l *LocalityCache) CalcLocalityLBPrio(wl *workloadapi.Workload, rp []workloadapi.LoadBalancing_Scope) uint32 {
+	if l.isRemoteCluster(wl) && !slices.Contains(rp, workloadapi.LoadBalancing_CLUSTER) {
+		return RemoteClusterPrio(rp)
+	}
+	if label := l.missingTopologyLabel(wl, rp); label != "" {
+		if node := wl.GetNode(); node != "" {
+			if _, warned := unlabeledNodes.LoadOrStore(node, struct{}{}); !warned {
+				log.Warnf("node %s has no %s label, the locality of its workloads is unknown and they are only used as the last resort", node, label)
+			}
+		}
+		return UnknownLocalityPrio
+	}
+
 	var rank uint32 = 0
 	for _, scope := range rp {
 		match := false
@@ -98,3 +128,119 @@ func (l *LocalityCache) CalcLocalityLBPrio(wl *workloadapi.Workload, rp []worklo
 	}
 	return uint32(len(rp)) - rank
 }
+
+// RemoteClusterPrio returns the priority of the remote cluster tier, right below the farthest local one
+func RemoteClusterPrio(rp []workloadapi.LoadBalancing_Scope) uint32 {
+	return min(uint32(len(rp))+1, PrioCount-1)
+}
+
+// missingTopologyLabel returns the topology label of a scope of rp the local node has and the node of
+// the workload lacks, empty if none. When the local node has no label either, the workloads are ranked
+// as if they were in the same locality.
+func (l *LocalityCache) missingTopologyLabel(wl *workloadapi.Workload, rp []workloadapi.LoadBalancing_Scope) string {
+	for _, scope := range rp {
+		switch scope {
+		case workloadapi.LoadBalancing_REGION:
+			if l.LocalityInfo.region != "" && wl.GetLocality().GetRegion() == "" {
+				return corev1.LabelTopologyRegion
+			}
+		case workloadapi.LoadBalancing_ZONE:
+			if l.LocalityInfo.zone != "" && wl.GetLocality().GetZone() == "" {
+				return corev1.LabelTopologyZone
+			}
+		case workloadapi.LoadBalancing_SUBZONE:
+			if l.LocalityInfo.subZone != "" && wl.GetLocality().GetSubzone() == "" {
+				return subzoneLabel
+			}
+		}
+	}
+	return ""
+}
+
+func (l *LocalityCache) isRemoteCluster(wl *workloadapi.Workload) bool {
+	return l.LocalityInfo.clusterId != "" && wl.GetClusterId() != "" && l.LocalityInfo.clusterId != wl.GetClusterId()
+}
+
+// CalcLocalityLBPrioLoad returns the percentage of traffic each priority should receive
+// when a minimum healthy percentage is configured. A priority keeps all the traffic that
+// reaches it as long as at least minHealthy percent of its endpoints are healthy, below
+// that it only keeps a share proportional to its health and the rest spills over to the
+// next priority. A result of all zeros means plain failover to the first non-empty priority.
+func CalcLocalityLBPrioLoad(healthy, total [PrioCount]uint32, minHealthy uint32) [PrioCount]uint32 {
+	var (
+		load     [PrioCount]uint32
+		health   [PrioCount]uint32
+		sum      uint32
+		capacity uint32
+	)
+	if minHealthy == 0 || minHealthy > 100 {
+		return load
+	}
+
+	for i := 0; i < PrioCount; i++ {
+		if total[i] == 0 {
+			continue
+		}
+		health[i] = min(100, healthy[i]*100*100/(total[i]*minHealthy))
+		capacity += health[i]
+	}
+	if capacity == 0 {
+		return load
+	}
+
+	remaining := uint32(100)
+	for i := 0; i < PrioCount && remaining > 0; i++ {
+		load[i] = min(remaining, health[i])
+		remaining -= load[i]
+	}
+
+	// Not enough healthy endpoints in all priorities, scale up what we have
+	if capacity < 100 {
+		for i := 0; i < PrioCount; i++ {
+			load[i] = load[i] * 100 / capacity
+			sum += load[i]
+		}
+		for i := 0; i < PrioCount; i++ {
+			if load[i] > 0 {
+				load[i] += 100 - sum
+				break
+			}
+		}
+	}
+	return load
+}
+
+// CalcLocalityWeightedPrioLoad returns the percentage of traffic each priority should receive when
+// the traffic is split over the priorities by weight instead of failing over. The weights of the
+// priorities without healthy endpoints are shared by the others in proportion. A result of all
+// zeros means plain failover, none of the weighted priorities has healthy endpoints.
+func CalcLocalityWeightedPrioLoad(healthy, weights [PrioCount]uint32) [PrioCount]uint32 {
+	var (
+		load     [PrioCount]uint32
+		sum      uint32
+		assigned uint32
+	)
+	for i := 0; i < PrioCount; i++ {
+		if healthy[i] > 0 {
+			sum += weights[i]
+		}
+	}
+	if sum == 0 {
+		return load
+	}
+
+	first := -1
+	for i := 0; i < PrioCount; i++ {
+		if healthy[i] == 0 || weights[i] == 0 {
+			continue
+		}
+		load[i] = weights[i] * 100 / sum
+		assigned += load[i]
+		if first < 0 {
+			first = i
+		}
+	}
+	// the rounding remainder goes to the closest weighted priority
+	load[first] += 100 - assigned
+	return load
+}
@@ -170,6 +170,44 @@ func TestCalcLocalityLBPrio(t *testing.T) {
 			},
 			priority: 2,
 		},
+		{
+			name: "remote cluster ranked below the local cluster tiers",
+			wl: &workloadapi.Workload{
+				Locality: &workloadapi.Locality{
+					Region:  "region1",
+					Zone:    "zone1",
+					Subzone: "subzone1",
+				},
+				Node:      "node2",
+				Network:   "network1",
+				ClusterId: "cluster2",
+			},
+			scopes: []workloadapi.LoadBalancing_Scope{
+				workloadapi.LoadBalancing_REGION,
+				workloadapi.LoadBalancing_ZONE,
+				workloadapi.LoadBalancing_SUBZONE,
+			},
+			priority: 4,
+		},
+		{
+			name: "local cluster matching no scope",
+			wl: &workloadapi.Workload{
+				Locality: &workloadapi.Locality{
+					Region:  "region2",
+					Zone:    "zone2",
+					Subzone: "subzone2",
+				},
+				Node:      "node2",
+				Network:   "network1",
+				ClusterId: "cluster1",
+			},
+			scopes: []workloadapi.LoadBalancing_Scope{
+				workloadapi.LoadBalancing_REGION,
+				workloadapi.LoadBalancing_ZONE,
+				workloadapi.LoadBalancing_SUBZONE,
+			},
+			priority: 3,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -178,3 +216,192 @@ func TestCalcLocalityLBPrio(t *testing.T) {
 		})
 	}
 }
+
+func TestCalcLocalityLBPrioMissingLabels(t *testing.T) {
+	scopes := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	labeled := &LocalityCache{
+		LocalityInfo: &localityInfo{region: "region1", zone: "zone1", subZone: "subzone1", nodeName: "node1"},
+	}
+	unlabeled := &LocalityCache{
+		LocalityInfo: &localityInfo{nodeName: "node1"},
+	}
+	testCases := []struct {
+		name     string
+		cache    *LocalityCache
+		wl       *workloadapi.Workload
+		priority uint32
+	}{
+		{
+			name:     "node without labels is the last resort",
+			cache:    labeled,
+			wl:       &workloadapi.Workload{Node: "unlabeled-node"},
+			priority: UnknownLocalityPrio,
+		},
+		{
+			name:     "node without zone label is the last resort",
+			cache:    labeled,
+			wl:       &workloadapi.Workload{Node: "zoneless-node", Locality: &workloadapi.Locality{Region: "region1"}},
+			priority: UnknownLocalityPrio,
+		},
+		{
+			name:     "other region ranked above the unknown locality",
+			cache:    labeled,
+			wl:       &workloadapi.Workload{Node: "node2", Locality: &workloadapi.Locality{Region: "region2", Zone: "zone2", Subzone: "subzone2"}},
+			priority: 3,
+		},
+		{
+			name:     "both nodes without labels",
+			cache:    unlabeled,
+			wl:       &workloadapi.Workload{Node: "unlabeled-node"},
+			priority: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.priority, tc.cache.CalcLocalityLBPrio(tc.wl, scopes))
+		})
+	}
+
+	// the missing labels are warned about once per node
+	_, warned := unlabeledNodes.Load("unlabeled-node")
+	assert.True(t, warned)
+	_, warned = unlabeledNodes.Load("node2")
+	assert.False(t, warned)
+}
+
+func TestCalcLocalityLBPrioLoad(t *testing.T) {
+	testCases := []struct {
+		name       string
+		healthy    [PrioCount]uint32
+		total      [PrioCount]uint32
+		minHealthy uint32
+		load       [PrioCount]uint32
+	}{
+		{
+			name:       "not configured",
+			healthy:    [PrioCount]uint32{1, 2},
+			total:      [PrioCount]uint32{4, 2},
+			minHealthy: 0,
+			load:       [PrioCount]uint32{},
+		},
+		{
+			name:       "local priority healthy enough",
+			healthy:    [PrioCount]uint32{3, 2},
+			total:      [PrioCount]uint32{4, 2},
+			minHealthy: 50,
+			load:       [PrioCount]uint32{100},
+		},
+		{
+			name:       "half of local endpoints unhealthy",
+			healthy:    [PrioCount]uint32{2, 2},
+			total:      [PrioCount]uint32{4, 2},
+			minHealthy: 80,
+			load:       [PrioCount]uint32{62, 38},
+		},
+		{
+			name:       "spill over several priorities",
+			healthy:    [PrioCount]uint32{1, 1, 2},
+			total:      [PrioCount]uint32{4, 4, 2},
+			minHealthy: 50,
+			load:       [PrioCount]uint32{50, 50},
+		},
+		{
+			name:       "local priority all unhealthy",
+			healthy:    [PrioCount]uint32{0, 2},
+			total:      [PrioCount]uint32{4, 2},
+			minHealthy: 50,
+			load:       [PrioCount]uint32{0, 100},
+		},
+		{
+			name:       "not enough healthy endpoints anywhere",
+			healthy:    [PrioCount]uint32{1, 1},
+			total:      [PrioCount]uint32{4, 4},
+			minHealthy: 100,
+			load:       [PrioCount]uint32{50, 50},
+		},
+		{
+			name:       "no healthy endpoints",
+			healthy:    [PrioCount]uint32{0, 0},
+			total:      [PrioCount]uint32{4, 4},
+			minHealthy: 50,
+			load:       [PrioCount]uint32{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			load := CalcLocalityLBPrioLoad(tc.healthy, tc.total, tc.minHealthy)
+			assert.Equal(t, tc.load, load)
+			var sum uint32
+			for _, l := range load {
+				sum += l
+			}
+			if load != [PrioCount]uint32{} {
+				assert.Equal(t, uint32(100), sum)
+			}
+		})
+	}
+}
+
+func TestCalcLocalityWeightedPrioLoad(t *testing.T) {
+	testCases := []struct {
+		name    string
+		healthy [PrioCount]uint32
+		weights [PrioCount]uint32
+		load    [PrioCount]uint32
+	}{
+		{
+			name:    "not configured",
+			healthy: [PrioCount]uint32{2, 2, 2},
+			load:    [PrioCount]uint32{},
+		},
+		{
+			name:    "all tiers healthy",
+			healthy: [PrioCount]uint32{2, 2, 2},
+			weights: [PrioCount]uint32{70, 20, 10},
+			load:    [PrioCount]uint32{70, 20, 10},
+		},
+		{
+			name:    "weights not summing to 100",
+			healthy: [PrioCount]uint32{2, 2, 2},
+			weights: [PrioCount]uint32{2, 1, 0},
+			load:    [PrioCount]uint32{67, 33},
+		},
+		{
+			name:    "a weighted tier has no healthy endpoint",
+			healthy: [PrioCount]uint32{2, 0, 2},
+			weights: [PrioCount]uint32{60, 30, 10},
+			load:    [PrioCount]uint32{86, 0, 14},
+		},
+		{
+			name:    "the closest tier has no healthy endpoint",
+			healthy: [PrioCount]uint32{0, 1, 1},
+			weights: [PrioCount]uint32{50, 25, 25},
+			load:    [PrioCount]uint32{0, 50, 50},
+		},
+		{
+			name:    "no weighted tier has healthy endpoints",
+			healthy: [PrioCount]uint32{0, 0, 2},
+			weights: [PrioCount]uint32{50, 50},
+			load:    [PrioCount]uint32{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			load := CalcLocalityWeightedPrioLoad(tc.healthy, tc.weights)
+			assert.Equal(t, tc.load, load)
+			var sum uint32
+			for _, l := range load {
+				sum += l
+			}
+			if load != [PrioCount]uint32{} {
+				assert.Equal(t, uint32(100), sum)
+			}
+		})
+	}
+}
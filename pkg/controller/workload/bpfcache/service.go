@@ -18,12 +18,44 @@ package bpfcache
 
 import (
 	"errors"
+	"math"
+	"time"
 
 	"github.com/cilium/ebpf"
 )
 
 const (
 	MaxPortNum = 10
+	// MaxBackendRepicks is the maximum number of backends a connection is steered
+	// away from after they failed connection establishment
+	MaxBackendRepicks = 3
+	// MaxEndpointWeight is the maximum weight of an endpoint
+	MaxEndpointWeight = 100
+	// MaxOutlierConsecutiveErrors is the maximum number of connect failures in a row
+	// the outlier detection of a service waits for before ejecting a backend
+	MaxOutlierConsecutiveErrors = 1000
+	// MaxDscp is the largest DSCP, which is 6 bits long
+	MaxDscp = 63
+	// MaxBandwidth is the largest bandwidth of a service in bytes per second
+	MaxBandwidth = math.MaxUint32
+	// BandwidthBurst is the traffic beyond the bandwidth of a service let through in a burst,
+	// as the time to send it at the bandwidth
+	BandwidthBurst = 10 * time.Millisecond
+)
+
+// directions of the bandwidth of a service, as seen by its clients
+const (
+	BandwidthEgress = iota
+	BandwidthIngress
+	BandwidthDirections
+)
+
+// algorithms picking the endpoints of a service within a priority
+const (
+	LbAlgorithmRandom uint32 = iota
+	LbAlgorithmRoundRobin
+	LbAlgorithmLeastConn
+	LbAlgorithmRingHash
 )
 
 type ServiceKey struct {
@@ -34,12 +66,45 @@ type ServicePorts [MaxPortNum]uint32
 type TargetPorts [MaxPortNum]uint32
 
 type ServiceValue struct {
-	EndpointCount [PrioCount]uint32 // endpoint count of current service
-	LbPolicy      uint32            // load balancing algorithm, currently only supports random algorithm
-	ServicePort   ServicePorts      // ServicePort[i] and TargetPort[i] are a pair, i starts from 0 and max value is MaxPortNum-1
-	TargetPort    TargetPorts
-	WaypointAddr  [16]byte
-	WaypointPort  uint32
+	EndpointCount        [PrioCount]uint32 // endpoint count of current service
+	LbPolicy             uint32            // load balancing algorithm, currently only supports random algorithm
+	ServicePort          ServicePorts      // ServicePort[i] and TargetPort[i] are a pair, i starts from 0 and max value is MaxPortNum-1
+	TargetPort           TargetPorts
+	WaypointAddr         [16]byte
+	WaypointPort         uint32
+	PrioLoad             [PrioCount]uint32 // percent of traffic for each priority in failover mode, all zero means plain failover
+	FailedBackendRepicks uint32            // number of other backends to pick when the selected one recently failed to connect
+	ConnectTimeout       uint32            // timeout of a single connection attempt in milliseconds, 0 means the kernel default
+	IdleTimeout          uint32            // connections idle for longer, in milliseconds, are closed by the daemon, 0 means never
+	// largest weight of the endpoints, they are picked evenly if it is 0 or 1
+	MaxEndpointWeight uint32
+	// connect failures in a row which eject a backend, 0 disables outlier detection
+	OutlierConsecutiveErrors uint32
+	// time in milliseconds an ejected backend stays out of the load balancing since its last failure
+	OutlierEjectionTime uint32
+	// DSCP the packets of the connections to the service are marked with, 0 leaves them unmarked
+	Dscp uint32
+	// algorithm picking the endpoints, the LbAlgorithm constants
+	LbAlgorithm uint32
+	// next endpoint picked by the round robin, it is written by the data plane
+	RoundRobinIndex uint32
+	// bytes per second the clients on the node may send to the service and receive from it,
+	// by direction, 0 is unlimited
+	Bandwidth [BandwidthDirections]uint32
+	// packets throttled or dropped by the bandwidth, it is written by the data plane
+	BandwidthThrottled [BandwidthDirections]uint32
+	// set while the service has fewer healthy endpoints than its kmesh.net/min-healthy-endpoints,
+	// the new connections to it are refused
+	Unavailable uint32
+	// time since boot the bytes sent or received so far are drained at the bandwidth,
+	// it is written by the data plane
+	BandwidthTatNs [BandwidthDirections]uint64
+}
+
+// BandwidthThrottling reports whether the bandwidth of the direction currently throttles the
+// connections to the service, now is the time since boot as the data plane sees it
+func (v *ServiceValue) BandwidthThrottling(direction int, now time.Duration) bool {
+	return v.Bandwidth[direction] != 0 && time.Duration(v.BandwidthTatNs[direction])-now > BandwidthBurst
 }
 
 func (c *Cache) ServiceUpdate(key *ServiceKey, value *ServiceValue) error {
@@ -71,3 +136,9 @@ func (c *Cache) ServiceLookupAll() []ServiceValue {
 	log.Debugf("ServiceLookupAll")
 	return LookupAll[ServiceKey, ServiceValue](c.bpfMap.KmService)
 }
+
+// ServiceEntries returns all the entries of the service map by key
+func (c *Cache) ServiceEntries() map[ServiceKey]ServiceValue {
+	log.Debugf("ServiceEntries")
+	return LookupAllEntries[ServiceKey, ServiceValue](c.bpfMap.KmService)
+}
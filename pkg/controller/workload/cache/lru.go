@@ -0,0 +1,133 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheHits = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_cache_hits_total",
+			Help: "The total number of lookups of the workload and service caches which found the entry, by cache.",
+		}, []string{"cache"})
+	cacheMisses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_cache_misses_total",
+			Help: "The total number of lookups of the workload and service caches which did not find the entry, by cache.",
+		}, []string{"cache"})
+	cacheEvictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_cache_evictions_total",
+			Help: "The total number of entries evicted from the workload and service caches to stay within their max entries, by cache.",
+		}, []string{"cache"})
+)
+
+// Metrics returns the metrics of the workload and service caches
+func Metrics() []prometheus.Collector {
+	return []prometheus.Collector{cacheHits, cacheMisses, cacheEvictions}
+}
+
+// lru keeps the keys of a cache ordered by their last use, so that the least recently used entries
+// are evicted first once the cache has more than maxEntries. The entries still in the xds state
+// are never evicted, the cache may exceed maxEntries when all of them are.
+type lru struct {
+	name string
+
+	mutex      sync.Mutex
+	maxEntries int
+	referenced func(key string) bool
+	// the most recently used key is at the front
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+func newLRU(name string) *lru {
+	return &lru{
+		name:     name,
+		order:    list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// setMaxEntries bounds the cache to maxEntries, 0 leaves it unbounded
+func (l *lru) setMaxEntries(maxEntries int, referenced func(key string) bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.maxEntries = maxEntries
+	l.referenced = referenced
+}
+
+// access records a lookup of the key, found tells whether the cache had it
+func (l *lru) access(key string, found bool) {
+	if !found {
+		cacheMisses.WithLabelValues(l.name).Inc()
+		return
+	}
+	cacheHits.WithLabelValues(l.name).Inc()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if e, ok := l.elements[key]; ok {
+		l.order.MoveToFront(e)
+	}
+}
+
+// add records the key as the most recently used and returns the keys to evict, the least recently used first
+func (l *lru) add(key string) []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if e, ok := l.elements[key]; ok {
+		l.order.MoveToFront(e)
+	} else {
+		l.elements[key] = l.order.PushFront(key)
+	}
+	if l.maxEntries <= 0 || l.order.Len() <= l.maxEntries {
+		return nil
+	}
+
+	var evicted []string
+	for e := l.order.Back(); e != nil && l.order.Len() > l.maxEntries; {
+		prev := e.Prev()
+		k := e.Value.(string)
+		if k != key && (l.referenced == nil || !l.referenced(k)) {
+			l.order.Remove(e)
+			delete(l.elements, k)
+			evicted = append(evicted, k)
+		}
+		e = prev
+	}
+	if len(evicted) > 0 {
+		cacheEvictions.WithLabelValues(l.name).Add(float64(len(evicted)))
+		log.Debugf("evicted %v from the %s cache", evicted, l.name)
+	}
+	return evicted
+}
+
+func (l *lru) remove(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if e, ok := l.elements[key]; ok {
+		l.order.Remove(e)
+		delete(l.elements, key)
+	}
+}
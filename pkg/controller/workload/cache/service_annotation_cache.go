@@ -0,0 +1,87 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"maps"
+	"strings"
+	"sync"
+)
+
+// ServiceAnnotationCache keeps the kmesh.net/ annotations of kubernetes services,
+// which are not carried by the workload api, keyed by namespace/name.
+type ServiceAnnotationCache interface {
+	GetAnnotation(namespace, name, key string) (string, bool)
+	// AddOrUpdate stores the kmesh annotations of a service and reports whether they changed
+	AddOrUpdate(namespace, name string, annotations map[string]string) bool
+	// Delete removes a service and reports whether it had any kmesh annotation
+	Delete(namespace, name string) bool
+}
+
+var _ ServiceAnnotationCache = &serviceAnnotationCache{}
+
+const kmeshAnnotationPrefix = "kmesh.net/"
+
+type serviceAnnotationCache struct {
+	mutex       sync.RWMutex
+	annotations map[string]map[string]string
+}
+
+func NewServiceAnnotationCache() *serviceAnnotationCache {
+	return &serviceAnnotationCache{
+		annotations: make(map[string]map[string]string),
+	}
+}
+
+func (s *serviceAnnotationCache) GetAnnotation(namespace, name, key string) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.annotations[namespace+"/"+name][key]
+	return v, ok
+}
+
+func (s *serviceAnnotationCache) AddOrUpdate(namespace, name string, annotations map[string]string) bool {
+	filtered := make(map[string]string)
+	for k, v := range annotations {
+		if strings.HasPrefix(k, kmeshAnnotationPrefix) {
+			filtered[k] = v
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := namespace + "/" + name
+	if len(filtered) == 0 {
+		_, existed := s.annotations[key]
+		delete(s.annotations, key)
+		return existed
+	}
+	if old, ok := s.annotations[key]; ok && maps.Equal(old, filtered) {
+		return false
+	}
+	s.annotations[key] = filtered
+	return true
+}
+
+func (s *serviceAnnotationCache) Delete(namespace, name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := namespace + "/" + name
+	_, existed := s.annotations[key]
+	delete(s.annotations, key)
+	return existed
+}
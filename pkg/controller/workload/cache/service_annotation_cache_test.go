@@ -0,0 +1,50 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAnnotationCache(t *testing.T) {
+	cache := NewServiceAnnotationCache()
+
+	// annotations of other owners are ignored
+	assert.False(t, cache.AddOrUpdate("default", "svc1", map[string]string{"foo": "bar"}))
+	_, ok := cache.GetAnnotation("default", "svc1", "foo")
+	assert.False(t, ok)
+
+	assert.True(t, cache.AddOrUpdate("default", "svc1", map[string]string{"kmesh.net/locality-min-healthy": "50", "foo": "bar"}))
+	v, ok := cache.GetAnnotation("default", "svc1", "kmesh.net/locality-min-healthy")
+	assert.True(t, ok)
+	assert.Equal(t, "50", v)
+
+	// same kmesh annotations, nothing changed
+	assert.False(t, cache.AddOrUpdate("default", "svc1", map[string]string{"kmesh.net/locality-min-healthy": "50"}))
+	assert.True(t, cache.AddOrUpdate("default", "svc1", map[string]string{"kmesh.net/locality-min-healthy": "80"}))
+
+	// annotation removed
+	assert.True(t, cache.AddOrUpdate("default", "svc1", nil))
+	_, ok = cache.GetAnnotation("default", "svc1", "kmesh.net/locality-min-healthy")
+	assert.False(t, ok)
+
+	assert.True(t, cache.AddOrUpdate("default", "svc1", map[string]string{"kmesh.net/locality-min-healthy": "50"}))
+	assert.True(t, cache.Delete("default", "svc1"))
+	assert.False(t, cache.Delete("default", "svc1"))
+}
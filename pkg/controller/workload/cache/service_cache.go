@@ -32,6 +32,10 @@ type ServiceCache interface {
 	DeleteService(resourceName string)
 	GetService(resourceName string) *workloadapi.Service
 	GetServiceByAddr(address NetworkAddress) *workloadapi.Service
+	// SetMaxEntries bounds the cache to maxEntries services, 0 leaves it unbounded. The least recently used
+	// services are evicted first, referenced tells whether a service is still in the xds state,
+	// such services are never evicted.
+	SetMaxEntries(maxEntries int, referenced func(resourceName string) bool)
 }
 
 var _ ServiceCache = &serviceCache{}
@@ -41,19 +45,31 @@ type serviceCache struct {
 	// keyed by namespace/hostname->service
 	servicesByResourceName map[string]*workloadapi.Service
 	servicesByAddr         map[NetworkAddress]*workloadapi.Service
+	lru                    *lru
 }
 
 func NewServiceCache() *serviceCache {
 	return &serviceCache{
 		servicesByResourceName: make(map[string]*workloadapi.Service),
 		servicesByAddr:         make(map[NetworkAddress]*workloadapi.Service),
+		lru:                    newLRU("service"),
 	}
 }
 
+func (s *serviceCache) SetMaxEntries(maxEntries int, referenced func(resourceName string) bool) {
+	s.lru.setMaxEntries(maxEntries, referenced)
+}
+
 func (s *serviceCache) GetServiceByAddr(address NetworkAddress) *workloadapi.Service {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return s.servicesByAddr[address]
+	svc := s.servicesByAddr[address]
+	if svc == nil {
+		s.lru.access("", false)
+		return nil
+	}
+	s.lru.access(svc.ResourceName(), true)
+	return svc
 }
 
 func (s *serviceCache) AddOrUpdateService(svc *workloadapi.Service) {
@@ -61,18 +77,43 @@ func (s *serviceCache) AddOrUpdateService(svc *workloadapi.Service) {
 	defer s.mutex.Unlock()
 	resourceName := svc.ResourceName()
 
+	oldSvc := s.servicesByResourceName[resourceName]
 	s.servicesByResourceName[resourceName] = svc
 	for _, addr := range svc.GetAddresses() {
 		addrStr, _ := netip.AddrFromSlice(addr.GetAddress())
 		networkAddress := composeNetworkAddress(addr.GetNetwork(), addrStr)
+		// When two services share an address, as when a service is recreated with the same ClusterIP,
+		// the newest one claiming it keeps it, an update of the older one does not take it back
+		if owner, ok := s.servicesByAddr[networkAddress]; ok && owner.ResourceName() != resourceName && hasAddress(oldSvc, networkAddress) {
+			continue
+		}
 		s.servicesByAddr[networkAddress] = svc
 	}
+
+	for _, name := range s.lru.add(resourceName) {
+		s.deleteService(name)
+	}
+}
+
+func hasAddress(svc *workloadapi.Service, address NetworkAddress) bool {
+	for _, addr := range svc.GetAddresses() {
+		addrStr, _ := netip.AddrFromSlice(addr.GetAddress())
+		if composeNetworkAddress(addr.GetNetwork(), addrStr) == address {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *serviceCache) DeleteService(resourceName string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	s.deleteService(resourceName)
+	s.lru.remove(resourceName)
+}
+
+func (s *serviceCache) deleteService(resourceName string) {
 	svc, ok := s.servicesByResourceName[resourceName]
 	if !ok {
 		return
@@ -101,7 +142,9 @@ func (s *serviceCache) List() []*workloadapi.Service {
 func (s *serviceCache) GetService(resourceName string) *workloadapi.Service {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
-	return s.servicesByResourceName[resourceName]
+	svc := s.servicesByResourceName[resourceName]
+	s.lru.access(resourceName, svc != nil)
+	return svc
 }
 
 func (s *serviceCache) deleteAddr(addr NetworkAddress, svc *workloadapi.Service) {
@@ -71,9 +71,42 @@ func TestDeleteService(t *testing.T) {
 		assert.Equal(t, svc1, cache.GetService(name1))
 		assert.Equal(t, svc2, cache.GetService(name2))
 
+		// An update of svc1 does not take the address back from the newer svc2
+		svc1 = common.CreateFakeService("svc1", "10.240.10.1", "", &workloadapi.LoadBalancing{})
+		cache.AddOrUpdateService(svc1)
+		assert.Equal(t, svc2, cache.GetServiceByAddr(NetworkAddress{Address: netip.MustParseAddr("10.240.10.1")}))
+
 		// Delete svc1
 		cache.DeleteService(name1)
 		// Address "10.240.10.1" has been overwritten by svc2, so it will not be deleted
 		assert.Equal(t, svc2, cache.GetServiceByAddr(NetworkAddress{Address: netip.MustParseAddr("10.240.10.1")}))
 	})
 }
+
+func TestServiceCacheEviction(t *testing.T) {
+	cache := NewServiceCache()
+	referenced := map[string]bool{}
+	cache.SetMaxEntries(2, func(name string) bool { return referenced[name] })
+
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", nil)
+	svc3 := common.CreateFakeService("svc3", "10.240.10.3", "", nil)
+	cache.AddOrUpdateService(svc1)
+	cache.AddOrUpdateService(svc2)
+	// svc1 is used, so svc2 is evicted
+	assert.Equal(t, svc1, cache.GetServiceByAddr(NetworkAddress{Address: netip.MustParseAddr("10.240.10.1")}))
+	cache.AddOrUpdateService(svc3)
+
+	assert.Len(t, cache.List(), 2)
+	assert.Nil(t, cache.GetService(svc2.ResourceName()))
+	assert.Nil(t, cache.GetServiceByAddr(NetworkAddress{Address: netip.MustParseAddr("10.240.10.2")}))
+	assert.Len(t, cache.servicesByAddr, 2)
+
+	// an update of a service makes it the most recently used
+	referenced[svc3.ResourceName()] = true
+	cache.AddOrUpdateService(svc1)
+	cache.AddOrUpdateService(svc2)
+	assert.Equal(t, svc3, cache.GetService(svc3.ResourceName()))
+	assert.Equal(t, svc2, cache.GetService(svc2.ResourceName()))
+	assert.Nil(t, cache.GetService(svc1.ResourceName()))
+}
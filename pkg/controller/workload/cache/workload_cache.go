@@ -20,6 +20,8 @@ import (
 	"net/netip"
 	"sync"
 
+	"istio.io/istio/pkg/util/sets"
+
 	"kmesh.net/kmesh/api/v2/workloadapi"
 )
 
@@ -29,6 +31,12 @@ type WorkloadCache interface {
 	AddOrUpdateWorkload(workload *workloadapi.Workload)
 	DeleteWorkload(uid string)
 	List() []*workloadapi.Workload
+	// ListByService returns the workloads of the service, named namespace/hostname
+	ListByService(serviceName string) []*workloadapi.Workload
+	// SetMaxEntries bounds the cache to maxEntries workloads, 0 leaves it unbounded. The least recently used
+	// workloads are evicted first, referenced tells whether a workload is still in the xds state,
+	// such workloads are never evicted.
+	SetMaxEntries(maxEntries int, referenced func(uid string) bool)
 }
 
 type NetworkAddress struct {
@@ -39,26 +47,39 @@ type NetworkAddress struct {
 type cache struct {
 	byUid  map[string]*workloadapi.Workload
 	byAddr map[NetworkAddress]*workloadapi.Workload
-	mutex  sync.RWMutex
+	// uids of the workloads of each service
+	byService map[string]sets.Set[string]
+	mutex     sync.RWMutex
+	lru       *lru
 }
 
 func NewWorkloadCache() *cache {
 	return &cache{
-		byUid:  make(map[string]*workloadapi.Workload),
-		byAddr: make(map[NetworkAddress]*workloadapi.Workload),
+		byUid:     make(map[string]*workloadapi.Workload),
+		byAddr:    make(map[NetworkAddress]*workloadapi.Workload),
+		byService: make(map[string]sets.Set[string]),
+		lru:       newLRU("workload"),
 	}
 }
 
+func (w *cache) SetMaxEntries(maxEntries int, referenced func(uid string) bool) {
+	w.lru.setMaxEntries(maxEntries, referenced)
+}
+
 func (w *cache) GetWorkloadByUid(uid string) *workloadapi.Workload {
 	w.mutex.RLock()
 	defer w.mutex.RUnlock()
-	return w.byUid[uid]
+	workload := w.byUid[uid]
+	w.lru.access(uid, workload != nil)
+	return workload
 }
 
 func (w *cache) GetWorkloadByAddr(networkAddress NetworkAddress) *workloadapi.Workload {
 	w.mutex.RLock()
 	defer w.mutex.RUnlock()
-	return w.byAddr[networkAddress]
+	workload := w.byAddr[networkAddress]
+	w.lru.access(workload.GetUid(), workload != nil)
+	return workload
 }
 
 func composeNetworkAddress(network string, addr netip.Addr) NetworkAddress {
@@ -76,7 +97,17 @@ func (w *cache) AddOrUpdateWorkload(workload *workloadapi.Workload) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	if old, ok := w.byUid[workload.Uid]; ok {
+		w.deleteFromServices(old)
+	}
 	w.byUid[workload.Uid] = workload
+	for svcName := range workload.GetServices() {
+		if uids, ok := w.byService[svcName]; ok {
+			uids.Insert(workload.Uid)
+		} else {
+			w.byService[svcName] = sets.New(workload.Uid)
+		}
+	}
 
 	// We should exclude the workloads that use host network mode
 	// Since they are using the host ip, we can not use address to identify them
@@ -87,12 +118,21 @@ func (w *cache) AddOrUpdateWorkload(workload *workloadapi.Workload) {
 			w.byAddr[networkAddress] = workload
 		}
 	}
+
+	for _, uid := range w.lru.add(workload.Uid) {
+		w.deleteWorkload(uid)
+	}
 }
 
 func (w *cache) DeleteWorkload(uid string) {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
+	w.deleteWorkload(uid)
+	w.lru.remove(uid)
+}
+
+func (w *cache) deleteWorkload(uid string) {
 	workload, exist := w.byUid[uid]
 	if exist {
 		for _, ip := range workload.Addresses {
@@ -100,6 +140,7 @@ func (w *cache) DeleteWorkload(uid string) {
 			networkAddress := composeNetworkAddress(workload.Network, addr)
 			w.deleteAddr(networkAddress, uid)
 		}
+		w.deleteFromServices(workload)
 
 		delete(w.byUid, uid)
 	}
@@ -116,6 +157,28 @@ func (w *cache) List() []*workloadapi.Workload {
 	return out
 }
 
+func (w *cache) ListByService(serviceName string) []*workloadapi.Workload {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	uids := w.byService[serviceName]
+	out := make([]*workloadapi.Workload, 0, len(uids))
+	for uid := range uids {
+		out = append(out, w.byUid[uid])
+	}
+	return out
+}
+
+func (w *cache) deleteFromServices(workload *workloadapi.Workload) {
+	for svcName := range workload.GetServices() {
+		if uids, ok := w.byService[svcName]; ok {
+			uids.Delete(workload.Uid)
+			if uids.Len() == 0 {
+				delete(w.byService, svcName)
+			}
+		}
+	}
+}
+
 func (w *cache) deleteAddr(addr NetworkAddress, uid string) {
 	if workload, ok := w.byAddr[addr]; ok {
 		if workload.Uid == uid {
@@ -17,10 +17,13 @@
 package cache
 
 import (
+	"fmt"
 	"net/netip"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/pkg/controller/workload/common"
@@ -163,3 +166,74 @@ func TestDeleteWorkload(t *testing.T) {
 		assert.Equal(t, (*workloadapi.Workload)(nil), w.byAddr[NetworkAddress{Network: "ut-net", Address: addr1}])
 	})
 }
+
+func TestListByService(t *testing.T) {
+	w := NewWorkloadCache()
+	ports := &workloadapi.PortList{Ports: []*workloadapi.Port{{ServicePort: 80, TargetPort: 8080}}}
+	svc1, svc2 := "default/svc1.default.svc.cluster.local", "default/svc2.default.svc.cluster.local"
+	workload1 := common.CreateFakeWorkload("1.2.3.4", "", common.WithWorkloadBasicInfo("ut-workload-1", "uid1", "ut-net"),
+		common.WithServices(map[string]*workloadapi.PortList{svc1: ports, svc2: ports}))
+	workload2 := common.CreateFakeWorkload("1.2.3.5", "", common.WithWorkloadBasicInfo("ut-workload-2", "uid2", "ut-net"),
+		common.WithServices(map[string]*workloadapi.PortList{svc1: ports}))
+	w.AddOrUpdateWorkload(workload1)
+	w.AddOrUpdateWorkload(workload2)
+	assert.ElementsMatch(t, []*workloadapi.Workload{workload1, workload2}, w.ListByService(svc1))
+	assert.Equal(t, []*workloadapi.Workload{workload1}, w.ListByService(svc2))
+
+	// an update moving the workload out of a service
+	workload1 = common.CreateFakeWorkload("1.2.3.4", "", common.WithWorkloadBasicInfo("ut-workload-1", "uid1", "ut-net"),
+		common.WithServices(map[string]*workloadapi.PortList{svc1: ports}))
+	w.AddOrUpdateWorkload(workload1)
+	assert.ElementsMatch(t, []*workloadapi.Workload{workload1, workload2}, w.ListByService(svc1))
+	assert.Empty(t, w.ListByService(svc2))
+
+	w.DeleteWorkload("uid2")
+	assert.Equal(t, []*workloadapi.Workload{workload1}, w.ListByService(svc1))
+	w.DeleteWorkload("uid1")
+	assert.Empty(t, w.ListByService(svc1))
+	assert.Empty(t, w.byService)
+}
+
+func TestWorkloadCacheEviction(t *testing.T) {
+	w := NewWorkloadCache()
+	// wl-0 is still in the bpf maps, the others are not
+	referenced := map[string]bool{"wl-0": true}
+	w.SetMaxEntries(3, func(uid string) bool { return referenced[uid] })
+
+	evictions := testutil.ToFloat64(cacheEvictions.WithLabelValues("workload"))
+	hits := testutil.ToFloat64(cacheHits.WithLabelValues("workload"))
+	misses := testutil.ToFloat64(cacheMisses.WithLabelValues("workload"))
+
+	for i := 0; i < 3; i++ {
+		w.AddOrUpdateWorkload(common.CreateFakeWorkload(fmt.Sprintf("10.0.0.%d", i), "",
+			common.WithWorkloadBasicInfo(fmt.Sprintf("wl-%d", i), fmt.Sprintf("wl-%d", i), "")))
+	}
+	// wl-1 is used, so wl-2 is the least recently used workload not referenced
+	assert.NotNil(t, w.GetWorkloadByUid("wl-1"))
+	assert.Nil(t, w.GetWorkloadByUid("wl-9"))
+	w.AddOrUpdateWorkload(common.CreateFakeWorkload("10.0.0.3", "", common.WithWorkloadBasicInfo("wl-3", "wl-3", "")))
+
+	assert.Len(t, w.List(), 3)
+	assert.Nil(t, w.GetWorkloadByUid("wl-2"))
+	assert.Nil(t, w.GetWorkloadByAddr(NetworkAddress{Address: netip.MustParseAddr("10.0.0.2")}))
+	for _, uid := range []string{"wl-0", "wl-1", "wl-3"} {
+		workload := w.GetWorkloadByUid(uid)
+		require.NotNil(t, workload)
+		addr, _ := netip.AddrFromSlice(workload.Addresses[0])
+		assert.Equal(t, workload, w.GetWorkloadByAddr(NetworkAddress{Address: addr}))
+	}
+	assert.Len(t, w.byAddr, 3)
+	assert.Len(t, w.lru.elements, 3)
+	assert.Equal(t, float64(1), testutil.ToFloat64(cacheEvictions.WithLabelValues("workload"))-evictions)
+	assert.Equal(t, float64(7), testutil.ToFloat64(cacheHits.WithLabelValues("workload"))-hits)
+	assert.Equal(t, float64(3), testutil.ToFloat64(cacheMisses.WithLabelValues("workload"))-misses)
+
+	// the cache grows beyond its max entries rather than evicting referenced workloads
+	referenced = map[string]bool{"wl-0": true, "wl-1": true, "wl-3": true}
+	w.AddOrUpdateWorkload(common.CreateFakeWorkload("10.0.0.4", "", common.WithWorkloadBasicInfo("wl-4", "wl-4", "")))
+	assert.Len(t, w.List(), 4)
+
+	// deleted workloads are no longer tracked
+	w.DeleteWorkload("wl-4")
+	assert.Len(t, w.lru.elements, 3)
+}
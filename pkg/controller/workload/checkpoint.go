@@ -0,0 +1,237 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"istio.io/istio/pkg/util/sets"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+)
+
+// checkpointInterval is how often the state is checkpointed when it changed
+const checkpointInterval = 10 * time.Second
+
+// checkpoint is the state received from xds the next daemon restores before its xds resync
+type checkpoint struct {
+	services  []*workloadapi.Service
+	workloads []*workloadapi.Workload
+	policies  []*security.Authorization
+}
+
+// writeCheckpoint writes the services, workloads and authorization policies to path, as a
+// stream of size-delimited Any messages. It replaces the file at once not to leave a partial one.
+func writeCheckpoint(path string, c *checkpoint) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	write := func(m proto.Message) error {
+		resource, err := anypb.New(m)
+		if err != nil {
+			return err
+		}
+		_, err = protodelim.MarshalTo(w, resource)
+		return err
+	}
+	for _, service := range c.services {
+		if err = write(&workloadapi.Address{Type: &workloadapi.Address_Service{Service: service}}); err != nil {
+			break
+		}
+	}
+	for _, workload := range c.workloads {
+		if err != nil {
+			break
+		}
+		err = write(&workloadapi.Address{Type: &workloadapi.Address_Workload{Workload: workload}})
+	}
+	for _, policy := range c.policies {
+		if err != nil {
+			break
+		}
+		err = write(policy)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func readCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	c := &checkpoint{}
+	r := bufio.NewReader(f)
+	for {
+		resource := &anypb.Any{}
+		if err := protodelim.UnmarshalFrom(r, resource); errors.Is(err, io.EOF) {
+			return c, nil
+		} else if err != nil {
+			return nil, err
+		}
+		m, err := resource.UnmarshalNew()
+		if err != nil {
+			return nil, err
+		}
+		switch m := m.(type) {
+		case *workloadapi.Address:
+			if service := m.GetService(); service != nil {
+				c.services = append(c.services, service)
+			} else if workload := m.GetWorkload(); workload != nil {
+				c.workloads = append(c.workloads, workload)
+			}
+		case *security.Authorization:
+			c.policies = append(c.policies, m)
+		default:
+			return nil, fmt.Errorf("unexpected resource %s", resource.GetTypeUrl())
+		}
+	}
+}
+
+// checkpoint returns the state received from xds, the workloads resolved by kmesh are left out
+// as istiod does not know them
+func (p *Processor) checkpoint(rbac *auth.Rbac) *checkpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	c := &checkpoint{services: p.ServiceCache.List()}
+	for _, workload := range p.WorkloadCache.List() {
+		if !isResolvedWorkload(workload) {
+			c.workloads = append(c.workloads, workload)
+		}
+	}
+	if rbac != nil {
+		c.policies = rbac.PoliciesList()
+	}
+	return c
+}
+
+// restoreCheckpoint loads the checkpointed state into the caches and the bpf maps before the xds resync.
+// The restored resources are reconciled with the first xds responses.
+func (p *Processor) restoreCheckpoint(c *checkpoint, rbac *auth.Rbac) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.handleServicesAndWorkloads(c.services, c.workloads)
+	p.restoredAddresses = sets.New[string]()
+	for _, service := range c.services {
+		p.restoredAddresses.Insert(service.ResourceName())
+	}
+	for _, workload := range c.workloads {
+		p.restoredAddresses.Insert(workload.ResourceName())
+	}
+
+	if rbac == nil {
+		return
+	}
+	p.restoredPolicies = sets.New[string]()
+	for _, policy := range c.policies {
+		if err := rbac.UpdatePolicy(policy); err != nil {
+			log.Errorf("failed to restore authorization policy %s: %v", policy.ResourceName(), err)
+			continue
+		}
+		if err := maps_v2.AuthorizationUpdate(p.hashName.Hash(policy.ResourceName()), policy); err != nil {
+			log.Errorf("failed to restore authorization policy %s: %v", policy.ResourceName(), err)
+		}
+		p.restoredPolicies.Insert(policy.ResourceName())
+	}
+}
+
+// reconcileRestoredAddresses removes the restored or resynced services and workloads the first
+// xds response does not carry, istiod no longer has them
+func (p *Processor) reconcileRestoredAddresses(received sets.Set[string]) {
+	if p.restoredAddresses == nil {
+		return
+	}
+	drifted := sets.SortedList(p.restoredAddresses.Difference(received))
+	p.restoredAddresses = nil
+	if len(drifted) == 0 {
+		return
+	}
+	log.Infof("remove %d restored services and workloads no longer in xds: %v", len(drifted), drifted)
+	p.handleRemovedAddresses(drifted)
+}
+
+// reconcileRestoredPolicies removes the restored or resynced authorization policies the first
+// xds response does not carry, istiod no longer has them
+func (p *Processor) reconcileRestoredPolicies(received sets.Set[string], rbac *auth.Rbac) {
+	if p.restoredPolicies == nil {
+		return
+	}
+	drifted := sets.SortedList(p.restoredPolicies.Difference(received))
+	p.restoredPolicies = nil
+	if len(drifted) == 0 {
+		return
+	}
+	log.Infof("remove %d restored authorization policies no longer in xds: %v", len(drifted), drifted)
+	for _, name := range drifted {
+		rbac.RemovePolicy(name)
+		if err := maps_v2.AuthorizationDelete(p.hashName.Hash(name)); err != nil {
+			log.Errorf("remove authorization policy %s failed: %v", name, err)
+		}
+	}
+}
+
+// runCheckpoint checkpoints the state to path when it changed, and once more on stop
+func (p *Processor) runCheckpoint(stop <-chan struct{}, path string, rbac *auth.Rbac) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			if p.checkpointDirty.Swap(false) {
+				if err := writeCheckpoint(path, p.checkpoint(rbac)); err != nil {
+					log.Errorf("failed to checkpoint to %s: %v", path, err)
+				}
+			}
+			return
+		case <-ticker.C:
+			if !p.checkpointDirty.Swap(false) {
+				continue
+			}
+			if err := writeCheckpoint(path, p.checkpoint(rbac)); err != nil {
+				log.Errorf("failed to checkpoint to %s: %v", path, err)
+				p.checkpointDirty.Store(true)
+			}
+		}
+	}
+}
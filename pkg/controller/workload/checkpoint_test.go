@@ -0,0 +1,177 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"istio.io/istio/pilot/pkg/util/protoconv"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestCheckpointReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	want := &checkpoint{
+		services:  []*workloadapi.Service{common.CreateFakeService("svc1", "10.240.10.1", "", nil)},
+		workloads: []*workloadapi.Workload{createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")},
+		policies: []*security.Authorization{{
+			Name:      "deny-8080",
+			Namespace: "default",
+			Scope:     security.Scope_NAMESPACE,
+			Action:    security.Action_DENY,
+		}},
+	}
+	require.NoError(t, writeCheckpoint(path, want))
+
+	got, err := readCheckpoint(path)
+	require.NoError(t, err)
+	require.Len(t, got.services, 1)
+	require.Len(t, got.workloads, 1)
+	require.Len(t, got.policies, 1)
+	assert.True(t, proto.Equal(want.services[0], got.services[0]))
+	assert.True(t, proto.Equal(want.workloads[0], got.workloads[0]))
+	assert.True(t, proto.Equal(want.policies[0], got.policies[0]))
+
+	// a new checkpoint replaces the last one
+	require.NoError(t, writeCheckpoint(path, &checkpoint{}))
+	got, err = readCheckpoint(path)
+	require.NoError(t, err)
+	assert.Empty(t, got.services)
+	matches, _ := filepath.Glob(path + ".tmp*")
+	assert.Empty(t, matches)
+}
+
+func TestRestoreCheckpoint(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	patches.ApplyFuncReturn(maps_v2.AuthorizationUpdate, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationDelete, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationLookup, fmt.Errorf("not found"))
+
+	// the last daemon received the state from xds and checkpointed it
+	lastMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(lastMap)
+	last := NewProcessor(lastMap)
+	lastRbac := auth.NewRbac(last.WorkloadCache)
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	wl1 := createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl2 := createWorkload("wl2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	last.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{wl1, wl2})
+	policy := &security.Authorization{Name: "deny-all", Namespace: "default", Scope: security.Scope_NAMESPACE, Action: security.Action_DENY}
+	require.NoError(t, lastRbac.UpdatePolicy(policy))
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	require.NoError(t, writeCheckpoint(path, last.checkpoint(lastRbac)))
+
+	// the restarted daemon populates its maps from the checkpoint before any xds response,
+	// without it they are only populated once the first xds response is received
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	rbac := auth.NewRbac(p.WorkloadCache)
+	start := time.Now()
+	cp, err := readCheckpoint(path)
+	require.NoError(t, err)
+	p.restoreCheckpoint(cp, rbac)
+	t.Logf("maps populated from the checkpoint in %v", time.Since(start))
+
+	assert.Equal(t, last.bpf.FrontendCount(), p.bpf.FrontendCount())
+	checkFrontEndMap(t, svc.Addresses[0].Address, p)
+	checkFrontEndMap(t, wl2.Addresses[0], p)
+	assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(wl2.GetUid()))
+	assert.Len(t, rbac.PoliciesList(), 1)
+
+	// wl2 and the policy were removed while the daemon was down, the first xds responses reconcile them
+	res := &service_discovery_v3.DeltaDiscoveryResponse{}
+	for _, addr := range []*workloadapi.Address{serviceToAddress(svc), workloadToAddress(wl1)} {
+		res.Resources = append(res.Resources, &service_discovery_v3.Resource{Resource: protoconv.MessageToAny(addr)})
+	}
+	serviceErr, workloadErr := p.handleAddressTypeResponse(res)
+	require.NoError(t, serviceErr)
+	require.NoError(t, workloadErr)
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid(wl2.GetUid()))
+	checkNotExistInFrontEndMap(t, wl2.Addresses[0], p)
+	checkFrontEndMap(t, wl1.Addresses[0], p)
+	assert.Nil(t, p.restoredAddresses)
+
+	require.NoError(t, p.handleAuthorizationTypeResponse(&service_discovery_v3.DeltaDiscoveryResponse{}, rbac))
+	assert.Empty(t, rbac.PoliciesList())
+	assert.Nil(t, p.restoredPolicies)
+
+	hashNameClean(p)
+}
+
+// BenchmarkRestartPopulation measures how long a restarted daemon takes to populate its maps from
+// the checkpoint and from the first xds response, which also waits for istiod to connect and push
+func BenchmarkRestartPopulation(b *testing.B) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(b)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	// 100 services of 10 workloads each
+	last := NewProcessor(workloadMap)
+	cp := &checkpoint{}
+	res := &service_discovery_v3.DeltaDiscoveryResponse{}
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("svc%d", i)
+		svc := common.CreateFakeService(name, fmt.Sprintf("10.240.%d.1", i), "", nil)
+		cp.services = append(cp.services, svc)
+		res.Resources = append(res.Resources, &service_discovery_v3.Resource{Resource: protoconv.MessageToAny(serviceToAddress(svc))})
+		for j := 0; j < 10; j++ {
+			wl := createWorkload(fmt.Sprintf("%s-%d", name, j), fmt.Sprintf("10.244.%d.%d", i, j+1),
+				"other", workloadapi.NetworkMode_STANDARD, nil, name)
+			cp.workloads = append(cp.workloads, wl)
+			res.Resources = append(res.Resources, &service_discovery_v3.Resource{Resource: protoconv.MessageToAny(workloadToAddress(wl))})
+		}
+	}
+	path := filepath.Join(b.TempDir(), "checkpoint")
+	if err := writeCheckpoint(path, cp); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("checkpoint", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := NewProcessor(workloadMap)
+			restored, err := readCheckpoint(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			p.restoreCheckpoint(restored, nil)
+		}
+	})
+	b.Run("xds", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			p := NewProcessor(workloadMap)
+			if serviceErr, workloadErr := p.handleAddressTypeResponse(res); serviceErr != nil || workloadErr != nil {
+				b.Fatal(serviceErr, workloadErr)
+			}
+		}
+	})
+	hashNameClean(last)
+}
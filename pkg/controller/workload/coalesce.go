@@ -0,0 +1,184 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"time"
+
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+)
+
+// xdsResponse is a response received on the workload stream, or the error that ended it
+type xdsResponse struct {
+	rsp *discoveryv3.DeltaDiscoveryResponse
+	err error
+}
+
+// SetXdsCoalesceWindow coalesces the address responses received in a row within window before applying
+// them, so that a burst of updates of the same resources writes the bpf maps once. 0 disables it.
+func (c *Controller) SetXdsCoalesceWindow(window time.Duration) {
+	c.coalesceWindow = window
+	if window > 0 {
+		log.Infof("coalesce the address updates received from xds within %v", window)
+	}
+}
+
+// recvCoalesced receives the next response of the stream. The address responses received within the
+// coalesce window after an address response are merged into it, a response of another type ends the
+// window and is returned after the merged one.
+func (c *Controller) recvCoalesced() ([]*discoveryv3.DeltaDiscoveryResponse, error) {
+	responses := c.startReceiving()
+	first := <-responses
+	if first.err != nil {
+		c.stopReceiving()
+		return nil, first.err
+	}
+	if first.rsp.GetTypeUrl() != AddressType {
+		return []*discoveryv3.DeltaDiscoveryResponse{first.rsp}, nil
+	}
+
+	received := []*discoveryv3.DeltaDiscoveryResponse{first.rsp}
+	// the window is not extended by the responses received, the updates are delayed by at most the window
+	timer := time.NewTimer(c.coalesceWindow)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return []*discoveryv3.DeltaDiscoveryResponse{coalesceResponses(received)}, nil
+		case next := <-responses:
+			if next.err != nil {
+				c.stopReceiving()
+				return []*discoveryv3.DeltaDiscoveryResponse{coalesceResponses(received)}, next.err
+			}
+			if next.rsp.GetTypeUrl() != AddressType {
+				return []*discoveryv3.DeltaDiscoveryResponse{coalesceResponses(received), next.rsp}, nil
+			}
+			received = append(received, next.rsp)
+		}
+	}
+}
+
+// startReceiving returns the responses of the current stream, received in the background so that the
+// ones sent while a response is applied are coalesced
+func (c *Controller) startReceiving() <-chan xdsResponse {
+	if c.recvStream == c.Stream && c.responses != nil {
+		return c.responses
+	}
+	c.stopReceiving()
+
+	stream := c.Stream
+	responses := make(chan xdsResponse)
+	done := make(chan struct{})
+	go func() {
+		for {
+			rsp, err := stream.Recv()
+			select {
+			case responses <- xdsResponse{rsp: rsp, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	c.recvStream, c.responses, c.recvDone = stream, responses, done
+	return responses
+}
+
+// stopReceiving releases the receiving of the last stream, it failed or was replaced
+func (c *Controller) stopReceiving() {
+	if c.recvDone != nil {
+		close(c.recvDone)
+	}
+	c.recvStream, c.responses, c.recvDone = nil, nil, nil
+}
+
+// coalesceResponses merges the responses of a type into one, as if a single response had carried their
+// changes: the last update or removal of each resource wins. It is acked with the nonce of the last one.
+func coalesceResponses(rsps []*discoveryv3.DeltaDiscoveryResponse) *discoveryv3.DeltaDiscoveryResponse {
+	last := rsps[len(rsps)-1]
+	if len(rsps) == 1 {
+		return last
+	}
+
+	var (
+		resources []*discoveryv3.Resource
+		removed   []string
+		// the positions of the resources updated and removed, by name
+		updatedAt  = map[string]int{}
+		removedAt  = map[string]int{}
+		superseded int
+	)
+	for _, rsp := range rsps {
+		for _, resource := range rsp.GetResources() {
+			name := resource.GetName()
+			// the resources with no name can't be told apart, they are all applied
+			if name == "" {
+				resources = append(resources, resource)
+				continue
+			}
+			if i, ok := updatedAt[name]; ok {
+				resources[i] = nil
+				superseded++
+			}
+			if i, ok := removedAt[name]; ok {
+				removed[i] = ""
+				delete(removedAt, name)
+				superseded++
+			}
+			updatedAt[name] = len(resources)
+			resources = append(resources, resource)
+		}
+		for _, name := range rsp.GetRemovedResources() {
+			if i, ok := updatedAt[name]; ok {
+				resources[i] = nil
+				delete(updatedAt, name)
+				superseded++
+			}
+			// the removal is kept, the resource may have been applied before the window
+			if _, ok := removedAt[name]; ok {
+				superseded++
+				continue
+			}
+			removedAt[name] = len(removed)
+			removed = append(removed, name)
+		}
+	}
+
+	coalesced := &discoveryv3.DeltaDiscoveryResponse{
+		SystemVersionInfo: last.GetSystemVersionInfo(),
+		TypeUrl:           last.GetTypeUrl(),
+		Nonce:             last.GetNonce(),
+		ControlPlane:      last.GetControlPlane(),
+	}
+	for _, resource := range resources {
+		if resource != nil {
+			coalesced.Resources = append(coalesced.Resources, resource)
+		}
+	}
+	for _, name := range removed {
+		if name != "" {
+			coalesced.RemovedResources = append(coalesced.RemovedResources, name)
+		}
+	}
+	telemetry.AddXdsCoalescedUpdates(last.GetTypeUrl(), superseded)
+	log.Debugf("coalesced %d %s responses, %d resource updates superseded", len(rsps), telemetry.XdsType(last.GetTypeUrl()), superseded)
+	return coalesced
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"istio.io/istio/pilot/pkg/util/protoconv"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+	"kmesh.net/kmesh/pkg/controller/xdstest"
+)
+
+func namedResource(name string) *discoveryv3.Resource {
+	return &discoveryv3.Resource{Name: name}
+}
+
+func resourceNames(rsp *discoveryv3.DeltaDiscoveryResponse) []string {
+	var names []string
+	for _, resource := range rsp.GetResources() {
+		names = append(names, resource.GetName())
+	}
+	return names
+}
+
+func TestCoalesceResponses(t *testing.T) {
+	rsps := []*discoveryv3.DeltaDiscoveryResponse{
+		{TypeUrl: AddressType, Nonce: "1", Resources: []*discoveryv3.Resource{namedResource("a"), namedResource("b")}},
+		// a is updated again, c removed
+		{TypeUrl: AddressType, Nonce: "2", Resources: []*discoveryv3.Resource{namedResource("a")}, RemovedResources: []string{"c"}},
+		// b is removed, c added again
+		{TypeUrl: AddressType, Nonce: "3", Resources: []*discoveryv3.Resource{namedResource("c")}, RemovedResources: []string{"b", "d"}},
+		{TypeUrl: AddressType, Nonce: "4", RemovedResources: []string{"d"}},
+	}
+	coalesced := coalesceResponses(rsps)
+	assert.Equal(t, AddressType, coalesced.GetTypeUrl())
+	assert.Equal(t, "4", coalesced.GetNonce())
+	assert.Equal(t, []string{"a", "c"}, resourceNames(coalesced))
+	assert.Same(t, rsps[1].Resources[0], coalesced.Resources[0])
+	assert.Equal(t, []string{"b", "d"}, coalesced.GetRemovedResources())
+
+	// a single response is applied as is
+	assert.Same(t, rsps[0], coalesceResponses(rsps[:1]))
+}
+
+func TestHandleWorkloadStreamCoalesced(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	mockDiscovery := xdstest.NewXdsServer(t)
+	fakeClient, err := xdstest.NewClient(mockDiscovery)
+	require.NoError(t, err)
+	defer fakeClient.Cleanup()
+
+	c := &Controller{
+		Processor: NewProcessor(workloadMap),
+		Stream:    fakeClient.DeltaClient,
+	}
+	c.SetXdsCoalesceWindow(500 * time.Millisecond)
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	addressResource := func(address *workloadapi.Address, name string) *discoveryv3.Resource {
+		return &discoveryv3.Resource{Name: name, Resource: protoconv.MessageToAny(address)}
+	}
+	// a burst of updates of the workload, as when its pod is rescheduled over and over
+	var rsps []*discoveryv3.DeltaDiscoveryResponse
+	for i := 1; i <= 5; i++ {
+		wl := createWorkload("wl1", fmt.Sprintf("10.244.0.%d", i), "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+		rsp := &discoveryv3.DeltaDiscoveryResponse{
+			TypeUrl:   AddressType,
+			Nonce:     fmt.Sprint(i),
+			Resources: []*discoveryv3.Resource{addressResource(workloadToAddress(wl), wl.ResourceName())},
+		}
+		if i == 1 {
+			rsp.Resources = append(rsp.Resources, addressResource(serviceToAddress(svc), svc.ResourceName()))
+		}
+		rsps = append(rsps, rsp)
+	}
+	go func() {
+		for _, rsp := range rsps {
+			mockDiscovery.DeltaResponses <- rsp
+		}
+	}()
+
+	// the burst is applied at once, with the last update of the workload
+	require.NoError(t, c.HandleWorkloadStream())
+	assert.Equal(t, "5", c.Processor.ack.GetResponseNonce())
+	p := c.Processor
+	wl := p.WorkloadCache.GetWorkloadByUid("cluster0//Pod/default/wl1")
+	require.NotNil(t, wl)
+	assert.Equal(t, []byte{10, 244, 0, 5}, wl.GetAddresses()[0])
+	backendUid := p.hashName.Hash(wl.GetUid())
+	assert.Equal(t, backendUid, checkFrontEndMap(t, wl.GetAddresses()[0], p))
+	for i := 1; i < 5; i++ {
+		checkNotExistInFrontEndMap(t, []byte{10, 244, 0, byte(i)}, p)
+	}
+	checkEndpointMap(t, p, svc, []uint32{backendUid})
+
+	// a response of another type is not delayed by the window
+	go func() {
+		mockDiscovery.DeltaResponses <- &discoveryv3.DeltaDiscoveryResponse{TypeUrl: AuthorizationType, Nonce: "6"}
+	}()
+	start := time.Now()
+	require.NoError(t, c.HandleWorkloadStream())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, "6", c.Processor.ack.GetResponseNonce())
+
+	hashNameClean(p)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"strconv"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+// getConnectionLimit returns the kmesh.net/max-connections of the service along with its
+// kmesh.net/max-pending-connections, nil if it is unset or invalid
+func (p *Processor) getConnectionLimit(service *workloadapi.Service) *auth.ConnectionLimit {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.MaxConnectionsAnnotation)
+	if !ok {
+		return nil
+	}
+	maxConnections, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || maxConnections == 0 {
+		log.Warnf("invalid %s annotation %q on service %s, should be a positive integer",
+			constants.MaxConnectionsAnnotation, value, service.ResourceName())
+		return nil
+	}
+	limit := &auth.ConnectionLimit{MaxConnections: uint32(maxConnections)}
+
+	if value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.MaxPendingConnectionsAnnotation); ok {
+		maxPending, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			log.Warnf("invalid %s annotation %q on service %s, should be a non negative integer",
+				constants.MaxPendingConnectionsAnnotation, value, service.ResourceName())
+		} else {
+			limit.MaxPending = uint32(maxPending)
+		}
+	}
+	return limit
+}
+
+// updateServiceConnectionLimit hands the connection limit of the service to the userspace authz,
+// which admits the new connections to its workloads on the node
+func (p *Processor) updateServiceConnectionLimit(service *workloadapi.Service) {
+	p.rbac.SetConnectionLimit(service.ResourceName(), p.getConnectionLimit(service))
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/dns"
+)
+
+// dnsController resolves the hostnames of the workloads istiod sends for the ServiceEntries with
+// DNS resolution. Each address a hostname resolves to is handled as a workload of its own, whose
+// frontend leads to the ServiceEntry. The hostnames are resolved again once their TTL expires.
+type dnsController struct {
+	processor   *Processor
+	dnsResolver *dns.DNSResolver
+
+	mutex sync.Mutex
+	// workloads with a hostname, by uid
+	workloads map[string]*workloadapi.Workload
+	// addresses the hostname of each workload resolved to when it was last handled, by uid
+	resolved map[string][]string
+}
+
+func newDnsController(processor *Processor, resolver *dns.DNSResolver) *dnsController {
+	return &dnsController{
+		processor:   processor,
+		dnsResolver: resolver,
+		workloads:   make(map[string]*workloadapi.Workload),
+		resolved:    make(map[string][]string),
+	}
+}
+
+func (c *dnsController) Run(stopCh <-chan struct{}) {
+	go c.dnsResolver.StartDnsResolver(stopCh)
+	go func() {
+		for {
+			select {
+			case <-stopCh:
+				return
+			case hostname := <-c.dnsResolver.DnsChan:
+				c.processor.handleResolvedHostname(hostname)
+			}
+		}
+	}()
+}
+
+// watch starts resolving the hostname of the workload, it returns the workloads of the addresses
+// already resolved and the uids of the workloads of the addresses of its previous hostname
+func (c *dnsController) watch(workload *workloadapi.Workload) ([]*workloadapi.Workload, []string) {
+	hostname := workload.GetHostname()
+	if _, ok := c.dnsResolver.GetDomainAddress(hostname); !ok {
+		c.dnsResolver.AddDomainInQueue(&dns.DomainInfo{
+			Domain:      hostname,
+			RefreshRate: dns.DeRefreshInterval,
+		}, 0)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	old := c.workloads[workload.GetUid()]
+	c.workloads[workload.GetUid()] = workload
+	if old != nil && old.GetHostname() != hostname {
+		c.dnsResolver.RemoveUnwatchDomain(c.hostnames())
+	}
+	return c.update(workload, c.dnsResolver.GetDNSAddresses(hostname))
+}
+
+// unwatch stops resolving the hostname of the workload, it returns the uids of the workloads of its addresses
+func (c *dnsController) unwatch(uid string) []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.workloads[uid]; !ok {
+		return nil
+	}
+	removed := make([]string, 0, len(c.resolved[uid]))
+	for _, address := range c.resolved[uid] {
+		removed = append(removed, resolvedUid(uid, address))
+	}
+	delete(c.workloads, uid)
+	delete(c.resolved, uid)
+	c.dnsResolver.RemoveUnwatchDomain(c.hostnames())
+	return removed
+}
+
+// refresh returns the workloads of the addresses the hostname resolved to again and the uids of the
+// workloads of the addresses it no longer resolves to, nothing if the addresses did not change
+func (c *dnsController) refresh(hostname string) ([]*workloadapi.Workload, []string) {
+	addresses := c.dnsResolver.GetDNSAddresses(hostname)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var (
+		workloads []*workloadapi.Workload
+		removed   []string
+	)
+	for uid, workload := range c.workloads {
+		if workload.GetHostname() != hostname || slices.Equal(c.resolved[uid], addresses) {
+			continue
+		}
+		wls, uids := c.update(workload, addresses)
+		workloads = append(workloads, wls...)
+		removed = append(removed, uids...)
+	}
+	return workloads, removed
+}
+
+func (c *dnsController) update(workload *workloadapi.Workload, addresses []string) ([]*workloadapi.Workload, []string) {
+	var (
+		workloads []*workloadapi.Workload
+		removed   []string
+	)
+
+	uid := workload.GetUid()
+	for _, address := range c.resolved[uid] {
+		if !slices.Contains(addresses, address) {
+			removed = append(removed, resolvedUid(uid, address))
+		}
+	}
+	for _, address := range addresses {
+		addr, err := netip.ParseAddr(address)
+		if err != nil {
+			log.Warnf("invalid address %s resolved from hostname %s", address, workload.GetHostname())
+			continue
+		}
+		wl := proto.Clone(workload).(*workloadapi.Workload)
+		wl.Uid = resolvedUid(uid, address)
+		wl.Addresses = [][]byte{addr.AsSlice()}
+		workloads = append(workloads, wl)
+	}
+	c.resolved[uid] = addresses
+	return workloads, removed
+}
+
+func (c *dnsController) hostnames() map[string]interface{} {
+	hostnames := make(map[string]interface{}, len(c.workloads))
+	for _, workload := range c.workloads {
+		hostnames[workload.GetHostname()] = nil
+	}
+	return hostnames
+}
+
+func resolvedUid(uid, address string) string {
+	return uid + "/" + address
+}
+
+// isResolvedWorkload reports whether the workload is the one of an address a hostname resolved to
+func isResolvedWorkload(workload *workloadapi.Workload) bool {
+	return workload.GetHostname() != "" && len(workload.GetAddresses()) != 0
+}
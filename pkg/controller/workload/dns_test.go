@@ -0,0 +1,115 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"istio.io/istio/pkg/test/util/retry"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/dns"
+	"kmesh.net/kmesh/pkg/nets"
+)
+
+func TestServiceEntryHostnameResolution(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	fakeDNSServer := dns.NewFakeDNSServer()
+	defer fakeDNSServer.Shutdown()
+	fakeDNSServer.SetHosts("api.example.com", 1)
+	fakeDNSServer.SetTTL(2)
+	resolver, err := dns.NewFakeDNSResolver(fakeDNSServer)
+	assert.NoError(t, err)
+
+	p := NewProcessor(workloadMap)
+	p.EnableDNSResolution(resolver)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	p.dns.Run(stopCh)
+
+	// a ServiceEntry with DNS resolution, without any address allocated
+	svc := &workloadapi.Service{
+		Name:      "external",
+		Namespace: "default",
+		Hostname:  "api.example.com",
+		Ports:     []*workloadapi.Port{{ServicePort: 443, TargetPort: 443}},
+	}
+	svcId := p.hashName.Hash(svc.ResourceName())
+	wl := &workloadapi.Workload{
+		Uid:       "cluster0/networking.istio.io/ServiceEntry/default/external/api.example.com",
+		Name:      "external",
+		Namespace: "default",
+		Hostname:  "api.example.com",
+		Status:    workloadapi.WorkloadStatus_HEALTHY,
+		Services: map[string]*workloadapi.PortList{
+			svc.ResourceName(): {Ports: []*workloadapi.Port{{ServicePort: 443, TargetPort: 443}}},
+		},
+	}
+	p.mutex.Lock()
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{wl})
+	p.mutex.Unlock()
+
+	// upstream returns the frontend of the address, 0 if there is none
+	upstream := func(ip string) uint32 {
+		var (
+			fk = bpfcache.FrontendKey{}
+			fv = bpfcache.FrontendValue{}
+		)
+		nets.CopyIpByteFromSlice(&fk.Ip, netip.MustParseAddr(ip).AsSlice())
+		if err := p.bpf.FrontendLookup(&fk, &fv); err != nil {
+			return 0
+		}
+		return fv.UpstreamId
+	}
+	endpointCount := func() uint32 {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		return sv.EndpointCount[0]
+	}
+
+	// the connections to the resolved addresses are routed to the ServiceEntry
+	retry.UntilOrFail(t, func() bool {
+		return upstream("10.0.0.1") == svcId && upstream("fd00::1") == svcId
+	}, retry.Timeout(5*time.Second))
+	assert.Equal(t, uint32(2), endpointCount())
+
+	// the hostname resolves to other addresses once the ttl expires
+	fakeDNSServer.SetHosts("api.example.com", 2)
+	retry.UntilOrFail(t, func() bool {
+		return upstream("10.0.0.2") == svcId && upstream("fd00::2") == svcId
+	}, retry.Timeout(5*time.Second))
+	assert.Equal(t, uint32(0), upstream("10.0.0.1"))
+	assert.Equal(t, uint32(0), upstream("fd00::1"))
+	assert.Equal(t, uint32(2), endpointCount())
+
+	// the workloads of the addresses are removed along with the ServiceEntry workload
+	p.mutex.Lock()
+	p.handleRemovedAddresses([]string{wl.ResourceName()})
+	p.mutex.Unlock()
+	assert.Equal(t, uint32(0), upstream("10.0.0.2"))
+	assert.Equal(t, uint32(0), upstream("fd00::2"))
+	assert.Equal(t, uint32(0), endpointCount())
+	assert.Empty(t, resolver.GetAllCachedDomains())
+
+	hashNameClean(p)
+}
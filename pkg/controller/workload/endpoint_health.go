@@ -0,0 +1,141 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+)
+
+// EndpointHealth is the health of an endpoint as last received from xds, for the operators to spot
+// the flapping backends
+type EndpointHealth struct {
+	Uid string
+	// Addresses of the workload of the endpoint
+	Addresses []string
+	Healthy   bool
+	// LastHealthy is when the endpoint was last observed healthy, now if it is, zero if never
+	LastHealthy time.Time
+	// LastTransition is when the health of the endpoint last changed, zero if it never did
+	LastTransition time.Time
+	// Transitions is the number of times the health of the endpoint changed
+	Transitions uint32
+}
+
+type endpointHealthRecord struct {
+	healthy        bool
+	lastHealthy    time.Time
+	lastTransition time.Time
+	transitions    uint32
+}
+
+// endpointHealthCache records the health transitions of the workloads, keyed by uid
+type endpointHealthCache struct {
+	mutex sync.RWMutex
+	byUid map[string]*endpointHealthRecord
+	now   func() time.Time
+}
+
+func newEndpointHealthCache() *endpointHealthCache {
+	return &endpointHealthCache{
+		byUid: make(map[string]*endpointHealthRecord),
+		now:   time.Now,
+	}
+}
+
+// observe records the health of the workload received from xds, and reports whether it changed
+// since it was last received
+func (c *endpointHealthCache) observe(workload *workloadapi.Workload) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	healthy := workload.GetStatus() == workloadapi.WorkloadStatus_HEALTHY
+	record, ok := c.byUid[workload.GetUid()]
+	if !ok {
+		record = &endpointHealthRecord{healthy: healthy}
+		c.byUid[workload.GetUid()] = record
+	}
+	changed := ok && record.healthy != healthy
+	// the endpoint going unhealthy was healthy until now
+	if healthy || changed {
+		record.lastHealthy = now
+	}
+	if changed {
+		record.healthy = healthy
+		record.lastTransition = now
+		record.transitions++
+	}
+	return changed
+}
+
+func (c *endpointHealthCache) delete(uid string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.byUid, uid)
+}
+
+// recordEndpointHealth records the health of the workload, the transitions are counted in the metrics
+// of its services
+func (p *Processor) recordEndpointHealth(workload *workloadapi.Workload) {
+	if !p.endpointHealth.observe(workload) {
+		return
+	}
+	healthy := workload.GetStatus() == workloadapi.WorkloadStatus_HEALTHY
+	log.Debugf("workload %s became %s", workload.ResourceName(), workload.GetStatus())
+	for serviceName := range workload.GetServices() {
+		telemetry.IncEndpointHealthTransition(serviceName, healthy)
+	}
+}
+
+// EndpointHealth returns the health of the workloads received from xds, sorted by uid
+func (p *Processor) EndpointHealth() []EndpointHealth {
+	p.endpointHealth.mutex.RLock()
+	defer p.endpointHealth.mutex.RUnlock()
+
+	now := p.endpointHealth.now()
+	health := make([]EndpointHealth, 0, len(p.endpointHealth.byUid))
+	for uid, record := range p.endpointHealth.byUid {
+		h := EndpointHealth{
+			Uid:            uid,
+			Healthy:        record.healthy,
+			LastHealthy:    record.lastHealthy,
+			LastTransition: record.lastTransition,
+			Transitions:    record.transitions,
+		}
+		if record.healthy {
+			h.LastHealthy = now
+		}
+		if workload := p.WorkloadCache.GetWorkloadByUid(uid); workload != nil {
+			for _, addr := range workload.GetAddresses() {
+				if ip, ok := netip.AddrFromSlice(addr); ok {
+					h.Addresses = append(h.Addresses, ip.String())
+				}
+			}
+		}
+		health = append(health, h)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Uid < health[j].Uid
+	})
+	return health
+}
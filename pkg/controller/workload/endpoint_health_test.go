@@ -0,0 +1,95 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestEndpointHealthFlapping(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	now := time.Date(2024, 7, 4, 20, 14, 0, 0, time.UTC)
+	p.endpointHealth.now = func() time.Time { return now }
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	wl := createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{wl})
+
+	health := func() EndpointHealth {
+		t.Helper()
+		list := p.EndpointHealth()
+		require.Len(t, list, 1)
+		return list[0]
+	}
+	setStatus := func(status workloadapi.WorkloadStatus) {
+		updated := proto.Clone(wl).(*workloadapi.Workload)
+		updated.Status = status
+		p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{updated})
+	}
+
+	// a new endpoint is ready without any transition
+	assert.Equal(t, EndpointHealth{
+		Uid:         wl.GetUid(),
+		Addresses:   []string{"10.244.0.1"},
+		Healthy:     true,
+		LastHealthy: now,
+	}, health())
+
+	// it goes unready, it was last ready until then
+	start := now
+	now = now.Add(time.Minute)
+	setStatus(workloadapi.WorkloadStatus_UNHEALTHY)
+	unready := now
+	now = now.Add(time.Minute)
+	h := health()
+	assert.False(t, h.Healthy)
+	assert.Equal(t, unready, h.LastHealthy)
+	assert.Equal(t, unready, h.LastTransition)
+	assert.Equal(t, uint32(1), h.Transitions)
+
+	// an update keeping it unready changes nothing
+	setStatus(workloadapi.WorkloadStatus_UNHEALTHY)
+	assert.Equal(t, h, health())
+
+	// it is ready again
+	setStatus(workloadapi.WorkloadStatus_HEALTHY)
+	ready := now
+	now = now.Add(time.Minute)
+	h = health()
+	assert.True(t, h.Healthy)
+	assert.Equal(t, now, h.LastHealthy)
+	assert.Equal(t, ready, h.LastTransition)
+	assert.Equal(t, uint32(2), h.Transitions)
+	assert.True(t, h.LastTransition.After(start))
+
+	// the history goes along with the workload
+	require.NoError(t, p.removeWorkloadResources([]string{wl.GetUid()}))
+	assert.Empty(t, p.EndpointHealth())
+
+	hashNameClean(p)
+}
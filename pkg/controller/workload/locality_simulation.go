@@ -0,0 +1,180 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+// LocalitySimulation is how the connections of a client on a node to a service are spread over its endpoints
+type LocalitySimulation struct {
+	Mode           workloadapi.LoadBalancing_Mode
+	ClientLocality string
+	// Tiers are the non-empty priorities, the closest first
+	Tiers []LocalityTier
+}
+
+// LocalityTier is a priority of the endpoints of a service and the percent of the connections routed to it
+type LocalityTier struct {
+	Priority  uint32
+	Load      uint32
+	Endpoints []LocalityEndpoint
+}
+
+// LocalityEndpoint is an endpoint of a locality tier
+type LocalityEndpoint struct {
+	Namespace string
+	Name      string
+	Address   string
+	Node      string
+	Locality  string
+	// Healthy is false for the endpoints no connection is routed to
+	Healthy bool
+}
+
+// SimulateLocality ranks the endpoints of the service for a client on clientNode the way the data plane
+// of that node would, the locality of the node is learned from the workloads running on it
+func (p *Processor) SimulateLocality(namespace, name, clientNode string) (*LocalitySimulation, error) {
+	var service *workloadapi.Service
+	for _, svc := range p.ServiceCache.List() {
+		if svc.GetNamespace() == namespace && svc.GetName() == name {
+			service = svc
+			break
+		}
+	}
+	if service == nil {
+		return nil, fmt.Errorf("service %s/%s not found", namespace, name)
+	}
+
+	simulation := &LocalitySimulation{Mode: service.GetLoadBalancing().GetMode()}
+	locality := bpf.NewLocalityCache()
+	if simulation.Mode != workloadapi.LoadBalancing_UNSPECIFIED_MODE {
+		client := p.nodeWorkload(clientNode)
+		if client == nil {
+			return nil, fmt.Errorf("no workload found on node %s to learn its locality from", clientNode)
+		}
+		locality.SetLocality(clientNode, client.GetClusterId(), client.GetNetwork(), client.GetLocality())
+		simulation.ClientLocality = formatLocality(client.GetLocality())
+	}
+
+	var (
+		healthy, total [bpf.PrioCount]uint32
+		endpoints      [bpf.PrioCount][]*workloadapi.Workload
+	)
+	for _, wl := range p.WorkloadCache.ListByService(service.ResourceName()) {
+		if wl.GetAddresses() == nil {
+			continue
+		}
+		var prio uint32
+		if simulation.Mode != workloadapi.LoadBalancing_UNSPECIFIED_MODE {
+			prio = locality.CalcLocalityLBPrio(wl, service.GetLoadBalancing().GetRoutingPreference())
+		}
+		endpoints[prio] = append(endpoints[prio], wl)
+		total[prio]++
+		if wl.GetStatus() != workloadapi.WorkloadStatus_UNHEALTHY {
+			healthy[prio]++
+		}
+	}
+
+	load := simulatePrioLoad(simulation.Mode, healthy, total, p.getLocalityMinHealthy(service), p.getLocalityWeights(service))
+	for prio := range endpoints {
+		if len(endpoints[prio]) == 0 {
+			continue
+		}
+		sort.Slice(endpoints[prio], func(i, j int) bool {
+			return endpoints[prio][i].ResourceName() < endpoints[prio][j].ResourceName()
+		})
+		tier := LocalityTier{Priority: uint32(prio), Load: load[prio]}
+		for _, wl := range endpoints[prio] {
+			tier.Endpoints = append(tier.Endpoints, LocalityEndpoint{
+				Namespace: wl.GetNamespace(),
+				Name:      wl.GetName(),
+				Address:   workloadAddress(wl),
+				Node:      wl.GetNode(),
+				Locality:  formatLocality(wl.GetLocality()),
+				Healthy:   wl.GetStatus() != workloadapi.WorkloadStatus_UNHEALTHY,
+			})
+		}
+		simulation.Tiers = append(simulation.Tiers, tier)
+	}
+	return simulation, nil
+}
+
+// simulatePrioLoad returns the percent of the connections each priority gets, like the service
+// manager of the data plane: random and strict only use the first priority, failover uses the
+// first one with healthy endpoints unless kmesh.net/locality-weights splits the traffic or
+// kmesh.net/locality-min-healthy spills it over
+func simulatePrioLoad(mode workloadapi.LoadBalancing_Mode, healthy, total [bpf.PrioCount]uint32, minHealthy uint32,
+	weights [bpf.PrioCount]uint32) [bpf.PrioCount]uint32 {
+	var load [bpf.PrioCount]uint32
+	switch mode {
+	case workloadapi.LoadBalancing_UNSPECIFIED_MODE, workloadapi.LoadBalancing_STRICT:
+		if healthy[0] > 0 {
+			load[0] = 100
+		}
+	case workloadapi.LoadBalancing_FAILOVER:
+		if weights != [bpf.PrioCount]uint32{} {
+			load = bpf.CalcLocalityWeightedPrioLoad(healthy, weights)
+		} else {
+			load = bpf.CalcLocalityLBPrioLoad(healthy, total, minHealthy)
+		}
+		if load != [bpf.PrioCount]uint32{} {
+			return load
+		}
+		for prio := range healthy {
+			if healthy[prio] > 0 {
+				load[prio] = 100
+				break
+			}
+		}
+	}
+	return load
+}
+
+// nodeWorkload returns a workload running on the node, nil if none
+func (p *Processor) nodeWorkload(node string) *workloadapi.Workload {
+	var found *workloadapi.Workload
+	for _, wl := range p.WorkloadCache.List() {
+		if wl.GetNode() != node {
+			continue
+		}
+		// prefer the workloads with a locality, some such as the ones of ServiceEntries have none
+		if found == nil || (found.GetLocality() == nil && wl.GetLocality() != nil) {
+			found = wl
+		}
+	}
+	return found
+}
+
+func formatLocality(locality *workloadapi.Locality) string {
+	return fmt.Sprintf("%s/%s/%s", locality.GetRegion(), locality.GetZone(), locality.GetSubzone())
+}
+
+// workloadAddress returns the first address of the workload, empty if it has none
+func workloadAddress(wl *workloadapi.Workload) string {
+	for _, address := range wl.GetAddresses() {
+		if addr, ok := netip.AddrFromSlice(address); ok {
+			return addr.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestSimulateLocality(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	scope := []workloadapi.LoadBalancing_Scope{workloadapi.LoadBalancing_REGION, workloadapi.LoadBalancing_ZONE}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, scope))
+	p.ServiceCache.AddOrUpdateService(svc)
+	near := createWorkload("near", "10.244.0.1", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	zone := createWorkload("zone", "10.244.1.1", "node2", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z2", "s1"), "svc1")
+	far := createWorkload("far", "10.244.2.1", "node3", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z3", "s1"), "svc1")
+	for _, wl := range []*workloadapi.Workload{near, zone, far} {
+		p.WorkloadCache.AddOrUpdateWorkload(wl)
+	}
+
+	endpoint := func(name, address, node, locality string, healthy bool) LocalityEndpoint {
+		return LocalityEndpoint{Namespace: "default", Name: name, Address: address, Node: node, Locality: locality, Healthy: healthy}
+	}
+
+	simulation, err := p.SimulateLocality("default", "svc1", "node1")
+	require.NoError(t, err)
+	assert.Equal(t, &LocalitySimulation{
+		Mode:           workloadapi.LoadBalancing_FAILOVER,
+		ClientLocality: "r1/z1/s1",
+		Tiers: []LocalityTier{
+			{Priority: 0, Load: 100, Endpoints: []LocalityEndpoint{endpoint("near", "10.244.0.1", "node1", "r1/z1/s1", true)}},
+			{Priority: 1, Endpoints: []LocalityEndpoint{endpoint("zone", "10.244.1.1", "node2", "r1/z2/s1", true)}},
+			{Priority: 2, Endpoints: []LocalityEndpoint{endpoint("far", "10.244.2.1", "node3", "r2/z3/s1", true)}},
+		},
+	}, simulation)
+
+	// the tiers are ranked from the locality of the client node
+	simulation, err = p.SimulateLocality("default", "svc1", "node3")
+	require.NoError(t, err)
+	assert.Equal(t, "r2/z3/s1", simulation.ClientLocality)
+	require.Len(t, simulation.Tiers, 2)
+	assert.Equal(t, uint32(100), simulation.Tiers[0].Load)
+	assert.Equal(t, "far", simulation.Tiers[0].Endpoints[0].Name)
+	assert.Len(t, simulation.Tiers[1].Endpoints, 2)
+
+	// failover goes to the next tier when the closest has no healthy endpoint
+	near.Status = workloadapi.WorkloadStatus_UNHEALTHY
+	p.WorkloadCache.AddOrUpdateWorkload(near)
+	simulation, err = p.SimulateLocality("default", "svc1", "node1")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 100, 0}, tierLoads(simulation))
+	assert.False(t, simulation.Tiers[0].Endpoints[0].Healthy)
+
+	// but strict mode routes nowhere
+	svc.LoadBalancing.Mode = workloadapi.LoadBalancing_STRICT
+	p.ServiceCache.AddOrUpdateService(svc)
+	simulation, err = p.SimulateLocality("default", "svc1", "node1")
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{0, 0, 0}, tierLoads(simulation))
+
+	_, err = p.SimulateLocality("default", "svc2", "node1")
+	assert.ErrorContains(t, err, "service default/svc2 not found")
+	_, err = p.SimulateLocality("default", "svc1", "node4")
+	assert.ErrorContains(t, err, "no workload found on node node4")
+}
+
+func tierLoads(simulation *LocalitySimulation) []uint32 {
+	var loads []uint32
+	for _, tier := range simulation.Tiers {
+		loads = append(loads, tier.Load)
+	}
+	return loads
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"time"
+
+	"istio.io/istio/pkg/util/sets"
+
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+// mapGCInterval is how often the entries of the bpf maps with no backing xds resource are removed
+const mapGCInterval = 5 * time.Minute
+
+// The bpf maps the garbage collection removes the stale entries of, as labeled in the metrics
+const (
+	gcMapBackend        = "backend"
+	gcMapService        = "service"
+	gcMapEndpoint       = "endpoint"
+	gcMapFrontend       = "frontend"
+	gcMapWorkloadPolicy = "workload_policy"
+)
+
+// GCMaps removes the entries of the bpf maps with no backing service or workload in the caches, which a
+// delete racing with another update may leave behind. It returns the number of entries removed by map.
+func (p *Processor) GCMaps() map[string]int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	services := sets.New[uint32]()
+	for _, service := range p.ServiceCache.List() {
+		if id := p.hashName.StrToNum(service.ResourceName()); id != 0 {
+			services.Insert(id)
+		}
+	}
+	backends := sets.New[uint32]()
+	for _, workload := range p.WorkloadCache.List() {
+		if id := p.hashName.StrToNum(workload.GetUid()); id != 0 {
+			backends.Insert(id)
+		}
+	}
+
+	removed := map[string]int{
+		gcMapBackend:        0,
+		gcMapService:        0,
+		gcMapEndpoint:       0,
+		gcMapFrontend:       0,
+		gcMapWorkloadPolicy: 0,
+	}
+
+	// the endpoints first, the ones of the live services are swapped out with the service map
+	var staleEndpoints []bpf.EndpointKey
+	for ek, ev := range p.bpf.EndpointEntries() {
+		if !services.Contains(ek.ServiceId) {
+			if err := p.bpf.EndpointDelete(&ek); err != nil {
+				log.Errorf("EndpointDelete [%#v] failed: %v", ek, err)
+				continue
+			}
+			p.EndpointCache.DeleteEndpointWithPriority(ek.ServiceId, ev.BackendUid, ek.Prio)
+			removed[gcMapEndpoint]++
+		} else if !backends.Contains(ev.BackendUid) {
+			staleEndpoints = append(staleEndpoints, ek)
+		}
+	}
+	if len(staleEndpoints) > 0 {
+		before := len(p.bpf.EndpointEntries())
+		if err := p.deleteEndpointRecords(staleEndpoints); err != nil {
+			log.Errorf("failed to remove the stale endpoints: %v", err)
+		}
+		removed[gcMapEndpoint] += before - len(p.bpf.EndpointEntries())
+	}
+
+	for sk := range p.bpf.ServiceEntries() {
+		if services.Contains(sk.ServiceId) {
+			continue
+		}
+		if err := p.bpf.ServiceDelete(&sk); err != nil {
+			log.Errorf("ServiceDelete [%#v] failed: %v", sk, err)
+			continue
+		}
+		removed[gcMapService]++
+	}
+
+	for bk := range p.bpf.BackendEntries() {
+		if backends.Contains(bk.BackendUid) {
+			continue
+		}
+		if err := p.bpf.BackendDelete(&bk); err != nil {
+			log.Errorf("BackendDelete [%#v] failed: %v", bk, err)
+			continue
+		}
+		removed[gcMapBackend]++
+	}
+
+	// the frontends point to a service or a workload
+	for fk, fv := range p.bpf.FrontendEntries() {
+		if services.Contains(fv.UpstreamId) || backends.Contains(fv.UpstreamId) {
+			continue
+		}
+		if err := p.bpf.FrontendDelete(&fk); err != nil {
+			log.Errorf("FrontendDelete [%#v] failed: %v", fk, err)
+			continue
+		}
+		removed[gcMapFrontend]++
+	}
+
+	for wk := range p.bpf.WorkloadPolicyEntries() {
+		if backends.Contains(wk.WorklodId) {
+			continue
+		}
+		if err := p.bpf.WorkloadPolicyDelete(&wk); err != nil {
+			log.Errorf("WorkloadPolicyDelete [%#v] failed: %v", wk, err)
+			continue
+		}
+		removed[gcMapWorkloadPolicy]++
+	}
+
+	for name, count := range removed {
+		if count > 0 {
+			telemetry.AddMapGCRemoved(name, count)
+			log.Infof("removed %d stale entries from the %s map", count, name)
+		}
+	}
+	return removed
+}
+
+// runMapGC removes the stale entries of the bpf maps periodically until stopCh is closed
+func (p *Processor) runMapGC(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(mapGCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			p.GCMaps()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestGCMaps(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", nil)
+	wl1 := createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl2 := createWorkload("wl2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl3 := createWorkload("wl3", "10.244.0.3", "other", workloadapi.NetworkMode_STANDARD, nil, "svc2")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc1, svc2}, []*workloadapi.Workload{wl1, wl2, wl3})
+	wl2Id := p.hashName.Hash(wl2.GetUid())
+	require.NoError(t, p.bpf.WorkloadPolicyUpdate(&bpfcache.WorkloadPolicyKey{WorklodId: wl2Id},
+		&bpfcache.WorkloadPolicyValue{PolicyIds: [4]uint32{1}}))
+
+	// nothing is stale yet
+	assert.Equal(t, map[string]int{"backend": 0, "service": 0, "endpoint": 0, "frontend": 0, "workload_policy": 0}, p.GCMaps())
+
+	// the deletes of wl2 and svc2 raced with other updates, which left their entries in the maps
+	p.WorkloadCache.DeleteWorkload(wl2.GetUid())
+	p.ServiceCache.DeleteService(svc2.ResourceName())
+
+	removed := p.GCMaps()
+	assert.Equal(t, map[string]int{
+		// wl2
+		"backend": 1,
+		// svc2
+		"service": 1,
+		// wl2 in svc1, wl3 in svc2
+		"endpoint": 2,
+		// the addresses of wl2 and svc2
+		"frontend":        2,
+		"workload_policy": 1,
+	}, removed)
+
+	checkNotExistInFrontEndMap(t, wl2.Addresses[0], p)
+	checkNotExistInFrontEndMap(t, svc2.Addresses[0].Address, p)
+	assert.Error(t, p.bpf.BackendLookup(&bpfcache.BackendKey{BackendUid: wl2Id}, &bpfcache.BackendValue{}))
+	assert.Empty(t, p.bpf.WorkloadPolicyEntries())
+
+	// the live entries are left, svc1 keeps wl1 as its only endpoint
+	checkFrontEndMap(t, svc1.Addresses[0].Address, p)
+	checkFrontEndMap(t, wl1.Addresses[0], p)
+	checkFrontEndMap(t, wl3.Addresses[0], p)
+	sk := bpfcache.ServiceKey{ServiceId: p.hashName.Hash(svc1.ResourceName())}
+	sv := bpfcache.ServiceValue{}
+	require.NoError(t, p.bpf.ServiceLookup(&sk, &sv))
+	assert.Equal(t, uint32(1), sv.EndpointCount[0])
+	ev := bpfcache.EndpointValue{}
+	require.NoError(t, p.bpf.EndpointLookup(&bpfcache.EndpointKey{ServiceId: sk.ServiceId, BackendIndex: 1}, &ev))
+	assert.Equal(t, p.hashName.Hash(wl1.GetUid()), ev.BackendUid)
+	assert.Len(t, p.bpf.EndpointEntries(), 1)
+
+	// nothing is left to collect
+	assert.Equal(t, map[string]int{"backend": 0, "service": 0, "endpoint": 0, "frontend": 0, "workload_policy": 0}, p.GCMaps())
+
+	hashNameClean(p)
+}
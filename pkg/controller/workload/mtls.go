@@ -0,0 +1,90 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+// getMtlsMode returns the kmesh.net/mtls mode of the service, PERMISSIVE if unset or invalid.
+// STRICT is rejected with an error, and the service is held to DENY_NON_MESH rather than opened to any source.
+func (p *Processor) getMtlsMode(service *workloadapi.Service) auth.MtlsMode {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.MtlsAnnotation)
+	if !ok {
+		return auth.MtlsPermissive
+	}
+	mode, err := auth.ParseMtlsMode(value)
+	if mode == auth.MtlsStrict {
+		log.Errorf("rejected %s annotation %q on service %s: %v, the connections from outside the mesh are denied meanwhile",
+			constants.MtlsAnnotation, value, service.ResourceName(), err)
+		return auth.MtlsDenyNonMesh
+	}
+	if err != nil {
+		log.Warnf("invalid %s annotation %q on service %s, %v", constants.MtlsAnnotation, value, service.ResourceName(), err)
+		return auth.MtlsPermissive
+	}
+	return mode
+}
+
+// updateServiceMtls programs the policy denying the connections from outside the mesh to the workloads of the
+// service in DENY_NON_MESH mode and removes it in the other ones, the policies of its workloads on the node are stored again
+func (p *Processor) updateServiceMtls(service *workloadapi.Service) {
+	serviceKey := service.ResourceName()
+	denyNonMesh := p.getMtlsMode(service) == auth.MtlsDenyNonMesh
+	old, programmed := p.mtlsPolicies[serviceKey]
+	if programmed == denyNonMesh {
+		return
+	}
+	if programmed {
+		p.removeServiceMtls(serviceKey, old.ResourceName())
+		return
+	}
+
+	// the policy is stored before the workloads refer to it
+	policy := auth.MtlsDenyNonMeshPolicy(service.GetNamespace(), service.GetName())
+	policyKey := policy.ResourceName()
+	if err := maps_v2.AuthorizationUpdate(p.hashName.Hash(policyKey), policy); err != nil {
+		log.Errorf("AuthorizationUpdate %s failed %v", policyKey, err)
+		return
+	}
+	p.mtlsPolicies[serviceKey] = policy
+	p.rbac.UpdateServicePolicy(serviceKey, policy)
+	log.Infof("connections from outside the mesh to the workloads of service %s are denied", serviceKey)
+	p.storeServiceWorkloadPolicies(serviceKey)
+}
+
+// removeServiceMtls removes the policy of the service, once its workloads on the node no longer refer to it
+func (p *Processor) removeServiceMtls(serviceKey, policyKey string) {
+	delete(p.mtlsPolicies, serviceKey)
+	p.rbac.UpdateServicePolicy(serviceKey, nil)
+	p.storeServiceWorkloadPolicies(serviceKey)
+	if err := maps_v2.AuthorizationDelete(p.hashName.Hash(policyKey)); err != nil {
+		log.Errorf("remove authorization policy %s failed :%v", policyKey, err)
+	}
+}
+
+// storeServiceWorkloadPolicies stores again the policies of the workloads of the service on the node
+func (p *Processor) storeServiceWorkloadPolicies(serviceKey string) {
+	for _, workload := range p.WorkloadCache.ListByService(serviceKey) {
+		if workload.GetNode() == p.nodeName {
+			p.storeWorkloadPolicies(workload)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestServiceMtls(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	patches.ApplyFuncReturn(maps_v2.AuthorizationUpdate, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationDelete, nil)
+
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	p.rbac = auth.NewRbac(p.WorkloadCache)
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	server := createWorkload("server", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	client := createWorkload("client", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil)
+	// the connections are explained without network
+	server.Network, client.Network = "", ""
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{server, client})
+
+	policyIds := func() [4]uint32 {
+		var value bpfcache.WorkloadPolicyValue
+		_ = p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(server.GetUid())}, &value)
+		return value.PolicyIds
+	}
+	allowed := func(src string) bool {
+		return p.rbac.Explain(netip.MustParseAddr(src), netip.MustParseAddr("10.244.0.1"), 8080).Allowed
+	}
+	setMode := func(mode string) {
+		p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.MtlsAnnotation: mode})
+		p.HandleServiceAnnotationUpdate("default", "svc1")
+	}
+	policyKey := "default/kmesh-mtls-deny-non-mesh.svc1"
+
+	// PERMISSIVE by default
+	assert.Empty(t, p.mtlsPolicies)
+	assert.True(t, allowed("10.0.0.9"))
+
+	setMode("DENY_NON_MESH")
+	assert.Equal(t, p.hashName.Hash(policyKey), policyIds()[0])
+	// the connection from outside the mesh is denied, the one from a workload of the mesh is not
+	assert.False(t, allowed("10.0.0.9"))
+	assert.True(t, allowed("10.244.0.2"))
+
+	setMode("permissive")
+	assert.Empty(t, p.mtlsPolicies)
+	assert.Equal(t, [4]uint32{}, policyIds())
+	assert.True(t, allowed("10.0.0.9"))
+
+	// STRICT is rejected, and not downgraded to PERMISSIVE
+	setMode("STRICT")
+	assert.Equal(t, p.hashName.Hash(policyKey), policyIds()[0])
+	assert.False(t, allowed("10.0.0.9"))
+
+	// an invalid mode is PERMISSIVE
+	setMode("UNSET")
+	assert.Empty(t, p.mtlsPolicies)
+	assert.True(t, allowed("10.0.0.9"))
+
+	// the policy of a removed service is removed
+	setMode("DENY_NON_MESH")
+	assert.False(t, allowed("10.0.0.9"))
+	assert.NoError(t, p.removeServiceResources([]string{svc.ResourceName()}))
+	assert.Empty(t, p.mtlsPolicies)
+	assert.True(t, allowed("10.0.0.9"))
+
+	hashNameClean(p)
+}
@@ -0,0 +1,225 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"istio.io/istio/pkg/util/sets"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+)
+
+// NetworkPolicyController watches the NetworkPolicies, pods and namespaces of the cluster, and translates
+// the NetworkPolicies restricting the connections to the pods of the node into authorization policies.
+// They are enforced like the ones from xds, so that NetworkPolicies are enforced without istio.
+type NetworkPolicyController struct {
+	informerFactory informers.SharedInformerFactory
+	informers       []cache.SharedIndexInformer
+	networkPolicies networkinglisters.NetworkPolicyLister
+	pods            corelisters.PodLister
+	namespaces      corelisters.NamespaceLister
+	processor       *Processor
+	rbac            *auth.Rbac
+
+	// pods of the node translated by the last sync, keyed by namespace/name
+	synced sets.Set[string]
+	// notifies a change, the NetworkPolicies of all the pods of the node are translated again
+	changed chan struct{}
+}
+
+var _ auth.NetworkPolicyIndex = &NetworkPolicyController{}
+
+func NewNetworkPolicyController(client kubernetes.Interface, processor *Processor, rbac *auth.Rbac) *NetworkPolicyController {
+	// the peers of the NetworkPolicies are on any node
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	networkPolicyInformer := informerFactory.Networking().V1().NetworkPolicies()
+	podInformer := informerFactory.Core().V1().Pods()
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+
+	c := &NetworkPolicyController{
+		informerFactory: informerFactory,
+		informers: []cache.SharedIndexInformer{
+			networkPolicyInformer.Informer(), podInformer.Informer(), namespaceInformer.Informer(),
+		},
+		networkPolicies: networkPolicyInformer.Lister(),
+		pods:            podInformer.Lister(),
+		namespaces:      namespaceInformer.Lister(),
+		processor:       processor,
+		rbac:            rbac,
+		synced:          sets.New[string](),
+		changed:         make(chan struct{}, 1),
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+	for _, informer := range c.informers {
+		_, _ = informer.AddEventHandler(handler)
+	}
+
+	return c
+}
+
+func (c *NetworkPolicyController) Run(stop <-chan struct{}) {
+	c.informerFactory.Start(stop)
+	for _, informer := range c.informers {
+		if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+			log.Error("failed to wait NetworkPolicy cache sync")
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-c.changed:
+			c.sync()
+		}
+	}
+}
+
+// notify coalesces the changes notified before the next sync
+func (c *NetworkPolicyController) notify() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (c *NetworkPolicyController) sync() {
+	pods, err := c.pods.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list pods: %v", err)
+		return
+	}
+
+	synced := sets.New[string]()
+	for _, pod := range pods {
+		if pod.Spec.NodeName != c.processor.nodeName || pod.Spec.HostNetwork {
+			continue
+		}
+		synced.Insert(pod.Namespace + "/" + pod.Name)
+		c.processor.HandleNetworkPolicyUpdate(pod.Namespace, pod.Name, auth.NetworkPolicies(pod, c), c.rbac)
+	}
+	for key := range c.synced.Difference(synced) {
+		namespace, name, _ := strings.Cut(key, "/")
+		c.processor.HandleNetworkPolicyUpdate(namespace, name, nil, c.rbac)
+	}
+	c.synced = synced
+}
+
+func (c *NetworkPolicyController) NetworkPolicies(namespace string) []*networkingv1.NetworkPolicy {
+	var (
+		nps []*networkingv1.NetworkPolicy
+		err error
+	)
+	if namespace == "" {
+		nps, err = c.networkPolicies.List(labels.Everything())
+	} else {
+		nps, err = c.networkPolicies.NetworkPolicies(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		log.Errorf("failed to list NetworkPolicies: %v", err)
+	}
+	return nps
+}
+
+func (c *NetworkPolicyController) Pods(namespace string) []*corev1.Pod {
+	var (
+		pods []*corev1.Pod
+		err  error
+	)
+	if namespace == "" {
+		pods, err = c.pods.List(labels.Everything())
+	} else {
+		pods, err = c.pods.Pods(namespace).List(labels.Everything())
+	}
+	if err != nil {
+		log.Errorf("failed to list pods: %v", err)
+	}
+	return pods
+}
+
+func (c *NetworkPolicyController) NamespaceLabels(namespace string) map[string]string {
+	ns, err := c.namespaces.Get(namespace)
+	if err != nil {
+		return nil
+	}
+	return ns.Labels
+}
+
+// HandleNetworkPolicyUpdate replaces the policies translated from the NetworkPolicies selecting a pod
+// of the node, and updates the policies of its workload
+func (p *Processor) HandleNetworkPolicyUpdate(namespace, name string, policies []*security.Authorization, rbac *auth.Rbac) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := namespace + "/" + name
+	old := p.networkPolicies[key]
+	if slices.EqualFunc(old, policies, func(a, b *security.Authorization) bool { return proto.Equal(a, b) }) {
+		return
+	}
+
+	// the new policies are stored before the workload refers to them
+	for _, policy := range policies {
+		policyKey := policy.ResourceName()
+		if err := maps_v2.AuthorizationUpdate(p.hashName.Hash(policyKey), policy); err != nil {
+			log.Errorf("AuthorizationUpdate %s failed %v", policyKey, err)
+		}
+	}
+	rbac.UpdatePodPolicies(namespace, name, policies)
+	if len(policies) == 0 {
+		delete(p.networkPolicies, key)
+	} else {
+		p.networkPolicies[key] = policies
+	}
+	log.Debugf("%d policies translated from the NetworkPolicies of pod %s", len(policies), key)
+
+	for _, workload := range p.WorkloadCache.List() {
+		if workload.GetNode() == p.nodeName && workload.GetNamespace() == namespace && workload.GetName() == name {
+			p.storeWorkloadPolicies(workload)
+		}
+	}
+
+	stored := sets.New[string]()
+	for _, policy := range policies {
+		stored.Insert(policy.ResourceName())
+	}
+	for _, policy := range old {
+		if policyKey := policy.ResourceName(); !stored.Contains(policyKey) {
+			if err := maps_v2.AuthorizationDelete(p.hashName.Hash(policyKey)); err != nil {
+				log.Errorf("remove authorization policy %s failed :%v", policyKey, err)
+			}
+		}
+	}
+}
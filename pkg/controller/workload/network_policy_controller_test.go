@@ -0,0 +1,105 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+func TestNetworkPolicyController(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	patches.ApplyFuncReturn(maps_v2.AuthorizationUpdate, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationDelete, nil)
+
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	rbac := auth.NewRbac(p.WorkloadCache)
+	server := createWorkload("server", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	client := createWorkload("client", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	other := createWorkload("other", "10.244.0.3", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{server, client, other})
+
+	pod := func(name, ip, node string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		}
+	}
+	np := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-client", Namespace: "default"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{
+					PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}},
+				}},
+			}},
+		},
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+		pod("server", "10.244.0.1", p.nodeName, map[string]string{"app": "server"}),
+		pod("client", "10.244.0.2", "other", map[string]string{"app": "client"}),
+		pod("other", "10.244.0.3", "other", map[string]string{"app": "other"}),
+		np,
+	)
+	stop := make(chan struct{})
+	defer close(stop)
+	go NewNetworkPolicyController(clientset, p, rbac).Run(stop)
+
+	policyIds := func() [4]uint32 {
+		var value bpfcache.WorkloadPolicyValue
+		_ = p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(server.GetUid())}, &value)
+		return value.PolicyIds
+	}
+	ingressKey := "default/kmesh-networkpolicy-ingress.server"
+	assert.Eventually(t, func() bool {
+		return policyIds()[0] == p.hashName.Hash(ingressKey)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	dst := netip.MustParseAddr("10.244.0.1")
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.0.2"), dst, 8080).Allowed)
+	assert.False(t, rbac.Explain(netip.MustParseAddr("10.244.0.3"), dst, 8080).Allowed)
+
+	// the policy is removed with the NetworkPolicy
+	require.NoError(t, clientset.NetworkingV1().NetworkPolicies("default").Delete(context.TODO(), np.Name, metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return policyIds()[0] == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, rbac.Explain(netip.MustParseAddr("10.244.0.3"), dst, 8080).Allowed)
+
+	hashNameClean(p)
+}
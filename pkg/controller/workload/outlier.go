@@ -0,0 +1,114 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/nets"
+)
+
+// OutlierEjection is a backend the outlier detection of a service currently ejects
+type OutlierEjection struct {
+	// Service is the resource name of the service, namespace/hostname
+	Service string `json:"service"`
+	// Backend is the uid of the workload
+	Backend         string `json:"backend"`
+	Ip              string `json:"ip"`
+	ConnectFailures uint32 `json:"connectFailures"`
+	Reason          string `json:"reason"`
+	// RemainingMs is the time in milliseconds until the backend gets new connections of the service again
+	RemainingMs int64 `json:"remainingMs"`
+}
+
+// OutlierEjections returns the backends the outlier detection of the services currently ejects, the ones of
+// service only if not empty. A backend ejected by several services is returned once per service.
+func (p *Processor) OutlierEjections(service string) ([]OutlierEjection, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ejections, _, err := p.outlierEjections(service)
+	return ejections, err
+}
+
+// ClearOutlierEjections re-admits the backends the outlier detection of the services currently ejects, the
+// ones of service only if not empty, by resetting their connect failures. It returns the ejections cleared.
+// Resetting the failures of a backend re-admits it in all the services ejecting it.
+func (p *Processor) ClearOutlierEjections(service string) ([]OutlierEjection, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ejections, backends, err := p.outlierEjections(service)
+	if err != nil {
+		return nil, err
+	}
+	for bk, bv := range backends {
+		// the data plane may update the value in between, it counts the failures again on the next one
+		bv.ConnectFailCount = 0
+		bv.ConnectFailNs = 0
+		if err := p.bpf.BackendUpdate(&bk, &bv); err != nil {
+			return nil, fmt.Errorf("failed to re-admit backend %s: %v", p.hashName.NumToStr(bk.BackendUid), err)
+		}
+	}
+	return ejections, nil
+}
+
+// outlierEjections returns the ejections of the backends and the entries of the backends ejected
+func (p *Processor) outlierEjections(service string) ([]OutlierEjection, map[bpf.BackendKey]bpf.BackendValue, error) {
+	now, err := bpf.MonotonicNow()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the monotonic clock: %v", err)
+	}
+
+	var ejections []OutlierEjection
+	backends := map[bpf.BackendKey]bpf.BackendValue{}
+	for bk, bv := range p.bpf.BackendEntries() {
+		for _, serviceId := range bv.Services[:min(bv.ServiceCount, bpf.MaxServiceNum)] {
+			serviceName := p.hashName.NumToStr(serviceId)
+			if service != "" && serviceName != service {
+				continue
+			}
+			sv := bpf.ServiceValue{}
+			if err := p.bpf.ServiceLookup(&bpf.ServiceKey{ServiceId: serviceId}, &sv); err != nil {
+				continue
+			}
+			if !bv.EjectedBy(&sv, now) {
+				continue
+			}
+			ejectionTime := time.Duration(sv.OutlierEjectionTime) * time.Millisecond
+			remaining := ejectionTime - (now - time.Duration(bv.ConnectFailNs))
+			ejections = append(ejections, OutlierEjection{
+				Service:         serviceName,
+				Backend:         p.hashName.NumToStr(bk.BackendUid),
+				Ip:              nets.IpString(bv.Ip),
+				ConnectFailures: bv.ConnectFailCount,
+				Reason: fmt.Sprintf("%d connect failures in a row, ejected from %d for %v",
+					bv.ConnectFailCount, sv.OutlierConsecutiveErrors, ejectionTime),
+				RemainingMs: remaining.Milliseconds(),
+			})
+			backends[bk] = bv
+		}
+	}
+	slices.SortFunc(ejections, func(a, b OutlierEjection) int {
+		return cmp.Or(cmp.Compare(a.Service, b.Service), cmp.Compare(a.Ip, b.Ip))
+	})
+	return ejections, backends, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func TestOutlierEjections(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", nil)
+	wl1 := createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl2 := createWorkload("wl2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl3 := createWorkload("wl3", "10.244.0.3", "other", workloadapi.NetworkMode_STANDARD, nil, "svc2")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc1, svc2}, []*workloadapi.Workload{wl1, wl2, wl3})
+
+	// svc1 and svc2 eject a backend after 3 connect failures in a row, for 30s
+	for _, svc := range []*workloadapi.Service{svc1, svc2} {
+		sk := bpfcache.ServiceKey{ServiceId: p.hashName.Hash(svc.ResourceName())}
+		sv := bpfcache.ServiceValue{}
+		require.NoError(t, p.bpf.ServiceLookup(&sk, &sv))
+		sv.OutlierConsecutiveErrors = 3
+		sv.OutlierEjectionTime = 30000
+		require.NoError(t, p.bpf.ServiceUpdate(&sk, &sv))
+	}
+	now, err := bpfcache.MonotonicNow()
+	require.NoError(t, err)
+	failBackend := func(wl *workloadapi.Workload, count uint32) {
+		bk := bpfcache.BackendKey{BackendUid: p.hashName.Hash(wl.GetUid())}
+		bv := bpfcache.BackendValue{}
+		require.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+		bv.ConnectFailCount = count
+		bv.ConnectFailNs = uint64(now)
+		require.NoError(t, p.bpf.BackendUpdate(&bk, &bv))
+	}
+	failBackend(wl1, 5)
+	// wl2 is not ejected yet
+	failBackend(wl2, 2)
+	failBackend(wl3, 3)
+
+	ejections, err := p.OutlierEjections("")
+	require.NoError(t, err)
+	require.Len(t, ejections, 2)
+	assert.Equal(t, svc1.ResourceName(), ejections[0].Service)
+	assert.Equal(t, wl1.GetUid(), ejections[0].Backend)
+	assert.Equal(t, "10.244.0.1", ejections[0].Ip)
+	assert.Equal(t, uint32(5), ejections[0].ConnectFailures)
+	assert.Equal(t, "5 connect failures in a row, ejected from 3 for 30s", ejections[0].Reason)
+	assert.InDelta(t, 30000, ejections[0].RemainingMs, 5000)
+	assert.Equal(t, svc2.ResourceName(), ejections[1].Service)
+	assert.Equal(t, wl3.GetUid(), ejections[1].Backend)
+
+	ejections, err = p.OutlierEjections(svc2.ResourceName())
+	require.NoError(t, err)
+	require.Len(t, ejections, 1)
+	assert.Equal(t, wl3.GetUid(), ejections[0].Backend)
+
+	// clearing svc1 re-admits wl1 and leaves wl3 ejected by svc2
+	cleared, err := p.ClearOutlierEjections(svc1.ResourceName())
+	require.NoError(t, err)
+	require.Len(t, cleared, 1)
+	assert.Equal(t, wl1.GetUid(), cleared[0].Backend)
+	bv := bpfcache.BackendValue{}
+	require.NoError(t, p.bpf.BackendLookup(&bpfcache.BackendKey{BackendUid: p.hashName.Hash(wl1.GetUid())}, &bv))
+	assert.Zero(t, bv.ConnectFailCount)
+	assert.Zero(t, bv.ConnectFailNs)
+
+	ejections, err = p.OutlierEjections("")
+	require.NoError(t, err)
+	require.Len(t, ejections, 1)
+	assert.Equal(t, wl3.GetUid(), ejections[0].Backend)
+
+	hashNameClean(p)
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"kmesh.net/kmesh/pkg/constants"
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/kube"
+)
+
+// PodAuthzController watches the pods of the node for the kmesh.net/authz label, which is not carried
+// by the workload api, and lets the processor enforce the policies of their workloads in xdp or in the daemon.
+// It also watches them for the kmesh.net/authz-enforce-established annotation.
+type PodAuthzController struct {
+	informerFactory informers.SharedInformerFactory
+	pod             cache.SharedIndexInformer
+	processor       *Processor
+}
+
+func NewPodAuthzController(client kubernetes.Interface, processor *Processor) *PodAuthzController {
+	informerFactory := kube.NewInformerFactory(client)
+	podInformer := informerFactory.Core().V1().Pods().Informer()
+
+	c := &PodAuthzController{
+		informerFactory: informerFactory,
+		pod:             podInformer,
+		processor:       processor,
+	}
+
+	_, _ = podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod, ok := obj.(*corev1.Pod)
+			if !ok {
+				log.Errorf("expected *corev1.Pod but got %T", obj)
+				return
+			}
+			c.processor.HandlePodAuthzUpdate(pod.Namespace, pod.Name, podAuthzOffload(pod))
+			c.processor.HandlePodEnforceEstablished(pod.Namespace, pod.Name, podEnforceEstablished(pod))
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			pod, ok := newObj.(*corev1.Pod)
+			if !ok {
+				log.Errorf("expected *corev1.Pod but got %T", newObj)
+				return
+			}
+			c.processor.HandlePodAuthzUpdate(pod.Namespace, pod.Name, podAuthzOffload(pod))
+			c.processor.HandlePodEnforceEstablished(pod.Namespace, pod.Name, podEnforceEstablished(pod))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pod, ok := obj.(*corev1.Pod)
+			if !ok {
+				log.Errorf("expected *corev1.Pod but got %T", obj)
+				return
+			}
+			c.processor.HandlePodAuthzUpdate(pod.Namespace, pod.Name, bpf.AuthzOffloadNode)
+			c.processor.HandlePodEnforceEstablished(pod.Namespace, pod.Name, false)
+		},
+	})
+
+	return c
+}
+
+func (c *PodAuthzController) Run(stop <-chan struct{}) {
+	c.informerFactory.Start(stop)
+	if !cache.WaitForCacheSync(stop, c.pod.HasSynced) {
+		log.Error("failed to wait pod cache sync")
+	}
+}
+
+// podAuthzOffload returns the authz offload the kmesh.net/authz label of the pod sets, enabled or disabled
+func podAuthzOffload(pod *corev1.Pod) uint32 {
+	value, ok := pod.Labels[constants.AuthzLabel]
+	if !ok {
+		return bpf.AuthzOffloadNode
+	}
+	switch value {
+	case "enabled":
+		return bpf.AuthzOffloadEnabled
+	case "disabled":
+		return bpf.AuthzOffloadDisabled
+	default:
+		log.Warnf("invalid %s label %q on pod %s/%s, should be enabled or disabled",
+			constants.AuthzLabel, value, pod.Namespace, pod.Name)
+		return bpf.AuthzOffloadNode
+	}
+}
+
+// podEnforceEstablished tells whether the kmesh.net/authz-enforce-established annotation of the pod is true
+func podEnforceEstablished(pod *corev1.Pod) bool {
+	value, ok := pod.Annotations[constants.AuthzEnforceEstablishedAnnotation]
+	if !ok {
+		return false
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warnf("invalid %s annotation %q on pod %s/%s, should be true or false",
+			constants.AuthzEnforceEstablishedAnnotation, value, pod.Namespace, pod.Name)
+		return false
+	}
+	return enabled
+}
+
+// HandlePodAuthzUpdate records the authz offload of a pod of the node and updates the xdp authz of its workload
+func (p *Processor) HandlePodAuthzUpdate(namespace, name string, offload uint32) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := namespace + "/" + name
+	if p.podAuthzOffload[key] == offload {
+		return
+	}
+	if offload == bpf.AuthzOffloadNode {
+		delete(p.podAuthzOffload, key)
+	} else {
+		p.podAuthzOffload[key] = offload
+	}
+	log.Debugf("authz offload of pod %s changed to %d", key, offload)
+
+	for _, workload := range p.WorkloadCache.List() {
+		if workload.GetNode() == p.nodeName && workload.GetNamespace() == namespace && workload.GetName() == name {
+			p.storeWorkloadPolicies(workload)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+func TestPodAuthzController(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	workload := createWorkload("v1", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	workload.AuthorizationPolicies = []string{"default/deny-v1"}
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{workload})
+
+	authzOffload := func() uint32 {
+		var value bpfcache.WorkloadPolicyValue
+		err := p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(workload.GetUid())}, &value)
+		assert.NoError(t, err)
+		return value.AuthzOffload
+	}
+	// the policies of the workload are enforced as set for the node
+	assert.Equal(t, bpfcache.AuthzOffloadNode, authzOffload())
+
+	// labeling the pod enforces them in xdp, without kmeshctl authz enable
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "v1",
+			Namespace: "default",
+			Labels:    map[string]string{constants.AuthzLabel: "enabled"},
+		},
+	}
+	client := fake.NewSimpleClientset(pod)
+	stop := make(chan struct{})
+	defer close(stop)
+	NewPodAuthzController(client, p).Run(stop)
+	assert.Eventually(t, func() bool {
+		return authzOffload() == bpfcache.AuthzOffloadEnabled
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the workload keeps it when istiod pushes it again
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{workload})
+	assert.Equal(t, bpfcache.AuthzOffloadEnabled, authzOffload())
+
+	pod.Labels[constants.AuthzLabel] = "disabled"
+	_, err := client.CoreV1().Pods("default").Update(context.TODO(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return authzOffload() == bpfcache.AuthzOffloadDisabled
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// an invalid value is ignored
+	pod.Labels[constants.AuthzLabel] = "yes"
+	_, err = client.CoreV1().Pods("default").Update(context.TODO(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return authzOffload() == bpfcache.AuthzOffloadNode
+	}, 5*time.Second, 10*time.Millisecond)
+
+	pod.Labels[constants.AuthzLabel] = "enabled"
+	_, err = client.CoreV1().Pods("default").Update(context.TODO(), pod, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return authzOffload() == bpfcache.AuthzOffloadEnabled
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, client.CoreV1().Pods("default").Delete(context.TODO(), "v1", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return authzOffload() == bpfcache.AuthzOffloadNode
+	}, 5*time.Second, 10*time.Millisecond)
+
+	hashNameClean(p)
+}
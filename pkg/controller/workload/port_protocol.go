@@ -0,0 +1,104 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+)
+
+// portProtocolCache keeps the application protocols of the ports of kubernetes services,
+// which are not carried by the workload api, keyed by namespace/name and service port
+type portProtocolCache struct {
+	mutex     sync.RWMutex
+	byService map[string]map[uint32]string
+}
+
+func newPortProtocolCache() *portProtocolCache {
+	return &portProtocolCache{
+		byService: make(map[string]map[uint32]string),
+	}
+}
+
+func (c *portProtocolCache) update(svc *corev1.Service) {
+	protocols := make(map[uint32]string)
+	for _, port := range svc.Spec.Ports {
+		if protocol := portProtocol(port); protocol != "" {
+			protocols[uint32(port.Port)] = protocol
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := svc.Namespace + "/" + svc.Name
+	if len(protocols) == 0 {
+		delete(c.byService, key)
+		return
+	}
+	c.byService[key] = protocols
+}
+
+func (c *portProtocolCache) delete(namespace, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.byService, namespace+"/"+name)
+}
+
+func (c *portProtocolCache) get(namespace, name string, port uint32) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.byService[namespace+"/"+name][port]
+}
+
+// portProtocol returns the application protocol of a service port the way istio selects it, from
+// its appProtocol, else from the prefix of its name such as http-web. Empty for the raw tcp ports.
+func portProtocol(port corev1.ServicePort) string {
+	if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+		return ""
+	}
+	var protocol string
+	if port.AppProtocol != nil {
+		protocol = *port.AppProtocol
+	} else {
+		protocol, _, _ = strings.Cut(port.Name, "-")
+	}
+	switch strings.ToLower(protocol) {
+	case "http", "http2", "h2c", "kubernetes.io/h2c":
+		return "http"
+	case "grpc", "grpc-web":
+		return "grpc"
+	}
+	return ""
+}
+
+// PortProtocol returns the application protocol of the port of the service, empty if unknown.
+// The port is either a service port or, for the connections to a workload, a target port.
+func (p *Processor) PortProtocol(service *workloadapi.Service, port uint32) string {
+	if protocol := p.portProtocols.get(service.GetNamespace(), service.GetName(), port); protocol != "" {
+		return protocol
+	}
+	for _, servicePort := range service.GetPorts() {
+		if servicePort.GetTargetPort() == port {
+			return p.portProtocols.get(service.GetNamespace(), service.GetName(), servicePort.GetServicePort())
+		}
+	}
+	return ""
+}
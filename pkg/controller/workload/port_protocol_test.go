@@ -0,0 +1,82 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+)
+
+func TestPortProtocol(t *testing.T) {
+	h2c := "kubernetes.io/h2c"
+	tcp := "tcp"
+	tests := []struct {
+		name string
+		port corev1.ServicePort
+		want string
+	}{
+		{"http named port", corev1.ServicePort{Name: "http", Protocol: corev1.ProtocolTCP}, "http"},
+		{"http prefixed port", corev1.ServicePort{Name: "http-web"}, "http"},
+		{"grpc named port", corev1.ServicePort{Name: "grpc-api"}, "grpc"},
+		{"raw tcp port", corev1.ServicePort{Name: "mysql", Protocol: corev1.ProtocolTCP}, ""},
+		{"unnamed port", corev1.ServicePort{}, ""},
+		{"appProtocol", corev1.ServicePort{Name: "web", AppProtocol: &h2c}, "http"},
+		{"appProtocol over the name", corev1.ServicePort{Name: "http", AppProtocol: &tcp}, ""},
+		{"udp port", corev1.ServicePort{Name: "http", Protocol: corev1.ProtocolUDP}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, portProtocol(tt.port))
+		})
+	}
+}
+
+func TestProcessor_PortProtocol(t *testing.T) {
+	p := &Processor{portProtocols: newPortProtocolCache()}
+
+	p.portProtocols.update(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "httpbin"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "http-web", Port: 80},
+				{Name: "tcp-db", Port: 3306},
+			},
+		},
+	})
+	service := &workloadapi.Service{
+		Namespace: "default",
+		Name:      "httpbin",
+		Ports: []*workloadapi.Port{
+			{ServicePort: 80, TargetPort: 8080},
+			{ServicePort: 3306, TargetPort: 3306},
+		},
+	}
+
+	assert.Equal(t, "http", p.PortProtocol(service, 80))
+	// the connections to a workload are reported with the target port
+	assert.Equal(t, "http", p.PortProtocol(service, 8080))
+	assert.Equal(t, "", p.PortProtocol(service, 3306))
+	assert.Equal(t, "", p.PortProtocol(service, 9090))
+
+	p.portProtocols.delete("default", "httpbin")
+	assert.Equal(t, "", p.PortProtocol(service, 80))
+}
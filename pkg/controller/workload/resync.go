@@ -0,0 +1,60 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"istio.io/istio/pkg/util/sets"
+
+	"kmesh.net/kmesh/pkg/auth"
+)
+
+// markResync drops the state received from xds: the services, workloads and authorization policies
+// loaded are reconciled with the full state istiod sends on the next subscription, as the restored ones
+// of a checkpoint. The ones it carries are applied to the bpf maps again, the others are removed.
+func (p *Processor) markResync(rbac *auth.Rbac) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.restoredAddresses = sets.New[string]()
+	for _, service := range p.ServiceCache.List() {
+		p.restoredAddresses.Insert(service.ResourceName())
+	}
+	for _, workload := range p.WorkloadCache.List() {
+		// istiod does not know the workloads of the addresses resolved by kmesh
+		if isResolvedWorkload(workload) {
+			continue
+		}
+		p.restoredAddresses.Insert(workload.ResourceName())
+	}
+
+	if rbac == nil {
+		return
+	}
+	p.restoredPolicies = sets.New[string]()
+	for _, policy := range rbac.PoliciesList() {
+		p.restoredPolicies.Insert(policy.ResourceName())
+	}
+}
+
+// awaitingFullState reports whether the addresses and the authorization policies loaded are to be
+// reconciled with the full state of xds, which istiod sends to a subscription without initial resources
+func (p *Processor) awaitingFullState() (addresses, policies bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.restoredAddresses != nil, p.restoredPolicies != nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"istio.io/istio/pilot/pkg/util/protoconv"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+	"kmesh.net/kmesh/pkg/nets"
+)
+
+func TestResyncRebuildsMaps(t *testing.T) {
+	patches := gomonkey.NewPatches()
+	defer patches.Reset()
+	patches.ApplyFuncReturn(maps_v2.AuthorizationUpdate, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationDelete, nil)
+	patches.ApplyFuncReturn(maps_v2.AuthorizationLookup, fmt.Errorf("not found"))
+
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+	p := NewProcessor(workloadMap)
+	rbac := auth.NewRbac(p.WorkloadCache)
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	wl1 := createWorkload("wl1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	wl2 := createWorkload("wl2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{wl1, wl2})
+	policy := &security.Authorization{Name: "deny-all", Namespace: "default", Scope: security.Scope_NAMESPACE, Action: security.Action_DENY}
+	require.NoError(t, rbac.UpdatePolicy(policy))
+
+	// the frontend of wl1 drifted away from the maps, and wl2 and the policy were removed
+	// without the daemon being told
+	var fk bpfcache.FrontendKey
+	nets.CopyIpByteFromSlice(&fk.Ip, netip.MustParseAddr("10.244.0.1").AsSlice())
+	require.NoError(t, p.bpf.FrontendDelete(&fk))
+	checkNotExistInFrontEndMap(t, wl1.Addresses[0], p)
+
+	p.markResync(rbac)
+	addresses, policies := p.awaitingFullState()
+	assert.True(t, addresses)
+	assert.True(t, policies)
+
+	// istiod sends its full state to the new subscription
+	res := &service_discovery_v3.DeltaDiscoveryResponse{}
+	for _, addr := range []*workloadapi.Address{serviceToAddress(svc), workloadToAddress(wl1)} {
+		res.Resources = append(res.Resources, &service_discovery_v3.Resource{Resource: protoconv.MessageToAny(addr)})
+	}
+	serviceErr, workloadErr := p.handleAddressTypeResponse(res)
+	require.NoError(t, serviceErr)
+	require.NoError(t, workloadErr)
+	checkFrontEndMap(t, svc.Addresses[0].Address, p)
+	checkFrontEndMap(t, wl1.Addresses[0], p)
+	checkNotExistInFrontEndMap(t, wl2.Addresses[0], p)
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid(wl2.GetUid()))
+	assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(wl1.GetUid()))
+
+	require.NoError(t, p.handleAuthorizationTypeResponse(&service_discovery_v3.DeltaDiscoveryResponse{}, rbac))
+	assert.Empty(t, rbac.PoliciesList())
+	addresses, policies = p.awaitingFullState()
+	assert.False(t, addresses)
+	assert.False(t, policies)
+
+	hashNameClean(p)
+}
+
+func TestControllerResync(t *testing.T) {
+	c := &Controller{}
+	canceled := false
+	c.streamCancel = func() { canceled = true }
+
+	// the stream is closed, the next one resubscribes for the full state
+	c.Resync()
+	assert.True(t, canceled)
+	assert.True(t, c.resyncPending.Load())
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ServiceAnnotationController watches kubernetes services for kmesh.net/ annotations and
+// the protocols of their ports, which are not carried by the workload api, and lets the processor apply them.
+type ServiceAnnotationController struct {
+	informerFactory informers.SharedInformerFactory
+	service         cache.SharedIndexInformer
+	processor       *Processor
+}
+
+func NewServiceAnnotationController(client kubernetes.Interface, processor *Processor) *ServiceAnnotationController {
+	informerFactory := informers.NewSharedInformerFactory(client, 0)
+	serviceInformer := informerFactory.Core().V1().Services().Informer()
+
+	c := &ServiceAnnotationController{
+		informerFactory: informerFactory,
+		service:         serviceInformer,
+		processor:       processor,
+	}
+
+	_, _ = serviceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			svc, ok := obj.(*corev1.Service)
+			if !ok {
+				log.Errorf("expected *corev1.Service but got %T", obj)
+				return
+			}
+			c.onUpdate(svc)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			svc, ok := newObj.(*corev1.Service)
+			if !ok {
+				log.Errorf("expected *corev1.Service but got %T", newObj)
+				return
+			}
+			c.onUpdate(svc)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			svc, ok := obj.(*corev1.Service)
+			if !ok {
+				log.Errorf("expected *corev1.Service but got %T", obj)
+				return
+			}
+			c.processor.portProtocols.delete(svc.Namespace, svc.Name)
+			c.processor.trafficDistributions.delete(svc.Namespace, svc.Name)
+			if c.processor.ServiceAnnotationCache.Delete(svc.Namespace, svc.Name) {
+				c.processor.HandleServiceAnnotationUpdate(svc.Namespace, svc.Name)
+			}
+		},
+	})
+
+	return c
+}
+
+func (c *ServiceAnnotationController) onUpdate(svc *corev1.Service) {
+	c.processor.portProtocols.update(svc)
+	if c.processor.trafficDistributions.update(svc) {
+		log.Debugf("traffic distribution of service %s/%s changed", svc.Namespace, svc.Name)
+		c.processor.HandleTrafficDistributionUpdate(svc.Namespace, svc.Name)
+	}
+	if c.processor.ServiceAnnotationCache.AddOrUpdate(svc.Namespace, svc.Name, svc.Annotations) {
+		log.Debugf("kmesh annotations of service %s/%s changed", svc.Namespace, svc.Name)
+		c.processor.HandleServiceAnnotationUpdate(svc.Namespace, svc.Name)
+	}
+}
+
+func (c *ServiceAnnotationController) Run(stop <-chan struct{}) {
+	c.informerFactory.Start(stop)
+	if !cache.WaitForCacheSync(stop, c.service.HasSynced) {
+		log.Error("failed to wait service cache sync")
+	}
+}
@@ -0,0 +1,288 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/constants"
+	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+const (
+	// slowStartMinPercent is the percent of its weight an endpoint in slow start begins with
+	slowStartMinPercent = 10
+	// slowStartInterval is how often the weights of the endpoints in slow start are recomputed
+	slowStartInterval = time.Second
+	// maxWarmUpConnections bounds the kmesh.net/warm-up-connections of a service
+	maxWarmUpConnections = 100
+	// warmUpTimeout bounds each warm-up connection
+	warmUpTimeout = time.Second
+)
+
+type slowStartEndpoint struct {
+	serviceId  uint32
+	workloadId uint32
+}
+
+// slowStart records when the endpoints whose weight ramps up became ready
+type slowStart struct {
+	// readyAt is by service id, then by workload id
+	readyAt map[uint32]map[uint32]time.Time
+	// warming are the endpoints being warmed up, they keep slowStartMinPercent of their
+	// weight until warmed up, then ramp up over the window
+	warming map[slowStartEndpoint]struct{}
+	// synced is set once the first address response is handled, the endpoints it adds are
+	// not new and do not go through slow start
+	synced bool
+	now    func() time.Time
+	// dial opens a warm-up connection to the address and closes it
+	dial func(addr netip.AddrPort) error
+}
+
+func newSlowStart() *slowStart {
+	return &slowStart{
+		readyAt: make(map[uint32]map[uint32]time.Time),
+		warming: make(map[slowStartEndpoint]struct{}),
+		now:     time.Now,
+		dial:    dialWarmUp,
+	}
+}
+
+// add begins the slow start of the workload as an endpoint of the service, it is not restarted
+// if the endpoint is already in slow start. It returns whether the slow start began.
+func (s *slowStart) add(serviceId, workloadId uint32) bool {
+	endpoints, ok := s.readyAt[serviceId]
+	if !ok {
+		endpoints = make(map[uint32]time.Time)
+		s.readyAt[serviceId] = endpoints
+	}
+	if _, ok := endpoints[workloadId]; ok {
+		return false
+	}
+	endpoints[workloadId] = s.now()
+	return true
+}
+
+// warmed ends the warm-up of the endpoint, its weight ramps up from now on
+func (s *slowStart) warmed(serviceId, workloadId uint32) {
+	endpoint := slowStartEndpoint{serviceId: serviceId, workloadId: workloadId}
+	if _, ok := s.warming[endpoint]; !ok {
+		return
+	}
+	delete(s.warming, endpoint)
+	if _, ok := s.readyAt[serviceId][workloadId]; ok {
+		s.readyAt[serviceId][workloadId] = s.now()
+	}
+}
+
+// percent returns the percent of its weight the endpoint gets, it ramps linearly from
+// slowStartMinPercent to 100 over the window once the endpoint is warmed up
+func (s *slowStart) percent(serviceId, workloadId uint32, window time.Duration) uint32 {
+	readyAt, ok := s.readyAt[serviceId][workloadId]
+	if !ok {
+		return 100
+	}
+	if _, ok := s.warming[slowStartEndpoint{serviceId: serviceId, workloadId: workloadId}]; ok {
+		return slowStartMinPercent
+	}
+	elapsed := s.now().Sub(readyAt)
+	if elapsed >= window {
+		return 100
+	}
+	return max(slowStartMinPercent, uint32(elapsed*100/window))
+}
+
+// expire ends the slow start of the endpoints of the service ready for longer than the window
+func (s *slowStart) expire(serviceId uint32, window time.Duration) {
+	for workloadId, readyAt := range s.readyAt[serviceId] {
+		if _, ok := s.warming[slowStartEndpoint{serviceId: serviceId, workloadId: workloadId}]; ok {
+			continue
+		}
+		if s.now().Sub(readyAt) >= window {
+			delete(s.readyAt[serviceId], workloadId)
+		}
+	}
+	if len(s.readyAt[serviceId]) == 0 {
+		delete(s.readyAt, serviceId)
+	}
+}
+
+// getSlowStartWindow returns the kmesh.net/slow-start-window of the service, 0 if unset
+func (p *Processor) getSlowStartWindow(service *workloadapi.Service) time.Duration {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.SlowStartWindowAnnotation)
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second || d > time.Hour {
+		log.Warnf("invalid %s annotation %q on service %s, should be a duration between 1s and 1h",
+			constants.SlowStartWindowAnnotation, value, service.ResourceName())
+		return 0
+	}
+	return d
+}
+
+// getWarmUpConnections returns the kmesh.net/warm-up-connections of the service, 0 if unset
+func (p *Processor) getWarmUpConnections(service *workloadapi.Service) int {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.WarmUpConnectionsAnnotation)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > maxWarmUpConnections {
+		log.Warnf("invalid %s annotation %q on service %s, should be a number of connections between 1 and %d",
+			constants.WarmUpConnectionsAnnotation, value, service.ResourceName(), maxWarmUpConnections)
+		return 0
+	}
+	return n
+}
+
+// beginSlowStart ramps up the weight of the workload becoming an endpoint of the service, if the
+// service has a slow start window and other endpoints to take the traffic meanwhile
+func (p *Processor) beginSlowStart(sv *bpf.ServiceValue, serviceId, workloadId uint32) {
+	if !p.slowStart.synced {
+		return
+	}
+	service := p.ServiceCache.GetService(p.hashName.NumToStr(serviceId))
+	if service == nil || p.getSlowStartWindow(service) == 0 {
+		return
+	}
+	for _, count := range sv.EndpointCount {
+		if count > 0 {
+			if p.slowStart.add(serviceId, workloadId) {
+				p.beginWarmUp(service, serviceId, workloadId)
+			}
+			return
+		}
+	}
+}
+
+// beginWarmUp opens the kmesh.net/warm-up-connections of the service to each port of the new endpoint
+// in the background, the weight of the endpoint ramps up once they are all done
+func (p *Processor) beginWarmUp(service *workloadapi.Service, serviceId, workloadId uint32) {
+	n := p.getWarmUpConnections(service)
+	if n == 0 {
+		return
+	}
+	workload := p.WorkloadCache.GetWorkloadByUid(p.hashName.NumToStr(workloadId))
+	targets := warmUpTargets(service, workload)
+	if len(targets) == 0 {
+		return
+	}
+
+	p.slowStart.warming[slowStartEndpoint{serviceId: serviceId, workloadId: workloadId}] = struct{}{}
+	dial := p.slowStart.dial
+	go func() {
+		failed := 0
+		for _, target := range targets {
+			for i := 0; i < n; i++ {
+				if err := dial(target); err != nil {
+					failed++
+				}
+			}
+		}
+		if failed > 0 {
+			log.Debugf("%d of the %d warm-up connections to %s failed", failed, n*len(targets), workload.ResourceName())
+		}
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		p.slowStart.warmed(serviceId, workloadId)
+	}()
+}
+
+// warmUpTargets returns the addresses of the workload the ports of the service are forwarded to
+func warmUpTargets(service *workloadapi.Service, workload *workloadapi.Workload) []netip.AddrPort {
+	if workload == nil {
+		return nil
+	}
+
+	ports := make(map[uint32]uint32)
+	for _, port := range service.GetPorts() {
+		ports[port.GetServicePort()] = port.GetTargetPort()
+	}
+	// the workload may listen on other ports than the target ports of the service
+	for _, port := range workload.GetServices()[service.ResourceName()].GetPorts() {
+		ports[port.GetServicePort()] = port.GetTargetPort()
+	}
+
+	var targets []netip.AddrPort
+	seen := make(map[netip.AddrPort]struct{})
+	for _, raw := range workload.GetAddresses() {
+		addr, ok := netip.AddrFromSlice(raw)
+		if !ok {
+			continue
+		}
+		for servicePort, targetPort := range ports {
+			if targetPort == 0 {
+				targetPort = servicePort
+			}
+			target := netip.AddrPortFrom(addr, uint16(targetPort))
+			if _, ok := seen[target]; !ok {
+				seen[target] = struct{}{}
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// dialWarmUp opens a tcp connection to the address and closes it
+func dialWarmUp(addr netip.AddrPort) error {
+	conn, err := net.DialTimeout("tcp", addr.String(), warmUpTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// refreshSlowStart recomputes the weights of the endpoints of the services with endpoints in slow start
+func (p *Processor) refreshSlowStart() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for serviceId := range p.slowStart.readyAt {
+		service := p.ServiceCache.GetService(p.hashName.NumToStr(serviceId))
+		if service == nil {
+			delete(p.slowStart.readyAt, serviceId)
+			continue
+		}
+		if err := p.updateServiceEndpointWeights(service); err != nil {
+			log.Errorf("update endpoint weights of service %s failed: %v", service.ResourceName(), err)
+		}
+		p.slowStart.expire(serviceId, p.getSlowStartWindow(service))
+	}
+}
+
+// runSlowStart ramps up the weights of the endpoints in slow start until stopCh is closed
+func (p *Processor) runSlowStart(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(slowStartInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			p.refreshSlowStart()
+		}
+	}
+}
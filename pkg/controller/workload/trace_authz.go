@@ -0,0 +1,87 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"net/netip"
+	"sync"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/trace"
+)
+
+// SuspendTracedAuthzOffload authorizes in userspace the connections to the workloads of the node the destination
+// of filter matches, so that their policy verdicts are traced, until resume is called. The other workloads keep
+// their authz offload, and so do the ones added after the trace started. The suspensions are counted per workload.
+func (p *Processor) SuspendTracedAuthzOffload(filter *trace.Filter) (resume func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var uids []string
+	for _, workload := range p.WorkloadCache.List() {
+		if workload.GetNode() != p.nodeName || !filter.MatchDestination(p.traceDestination(workload)) {
+			continue
+		}
+		uids = append(uids, workload.GetUid())
+		p.tracedWorkloads[workload.GetUid()]++
+		p.storeWorkloadPolicies(workload)
+	}
+	log.Debugf("authz offload of %d workloads suspended to trace %s", len(uids), filter.String())
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+
+			for _, uid := range uids {
+				if p.tracedWorkloads[uid]--; p.tracedWorkloads[uid] <= 0 {
+					delete(p.tracedWorkloads, uid)
+				}
+				if workload := p.WorkloadCache.GetWorkloadByUid(uid); workload != nil {
+					p.storeWorkloadPolicies(workload)
+				}
+			}
+		})
+	}
+}
+
+// traceDestination describes a workload as the destination of the connections to it or to its services
+func (p *Processor) traceDestination(workload *workloadapi.Workload) *trace.Connection {
+	conn := &trace.Connection{}
+	for _, address := range workload.GetAddresses() {
+		if addr, ok := netip.AddrFromSlice(address); ok {
+			conn.DstAddrs = append(conn.DstAddrs, addr)
+		}
+	}
+	for serviceKey, ports := range workload.GetServices() {
+		for _, port := range ports.GetPorts() {
+			conn.DstPorts = append(conn.DstPorts, port.GetServicePort(), port.GetTargetPort())
+		}
+		svc := p.ServiceCache.GetService(serviceKey)
+		if svc == nil {
+			continue
+		}
+		conn.DstNames = append(conn.DstNames, svc.GetName(), svc.GetHostname())
+		for _, address := range svc.GetAddresses() {
+			if addr, ok := netip.AddrFromSlice(address.GetAddress()); ok {
+				conn.DstAddrs = append(conn.DstAddrs, addr)
+			}
+		}
+	}
+	return conn
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/pkg/controller/trace"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+)
+
+func TestSuspendTracedAuthzOffload(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	v1 := createWorkload("v1", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	v1.AuthorizationPolicies = []string{"default/deny-v1"}
+	v2 := createWorkload("v2", "10.244.0.2", p.nodeName, workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{v1, v2})
+
+	authzOffload := func(workload *workloadapi.Workload) (uint32, bool) {
+		var value bpfcache.WorkloadPolicyValue
+		err := p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(workload.GetUid())}, &value)
+		return value.AuthzOffload, err == nil
+	}
+
+	// only the workload traced is authorized in userspace, even without policies
+	filter, err := trace.ParseFilter("", "10.244.0.2")
+	require.NoError(t, err)
+	resume1 := p.SuspendTracedAuthzOffload(&filter)
+	offload, ok := authzOffload(v2)
+	assert.True(t, ok)
+	assert.Equal(t, bpfcache.AuthzOffloadDisabled, offload)
+	offload, _ = authzOffload(v1)
+	assert.Equal(t, bpfcache.AuthzOffloadNode, offload)
+
+	// the suspensions are counted and kept when istiod pushes the workload again
+	filter, err = trace.ParseFilter("", "10.244.0.2:8080")
+	require.NoError(t, err)
+	resume2 := p.SuspendTracedAuthzOffload(&filter)
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{v2})
+	resume1()
+	resume1()
+	offload, _ = authzOffload(v2)
+	assert.Equal(t, bpfcache.AuthzOffloadDisabled, offload)
+
+	// the workload without policies is left out of the xdp authz again once all of them are resumed
+	resume2()
+	_, ok = authzOffload(v2)
+	assert.False(t, ok)
+
+	hashNameClean(p)
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"istio.io/api/annotation"
+	corev1 "k8s.io/api/core/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/daemon/options"
+)
+
+// preferCloseScopes are the scopes of the istio PreferClose traffic distribution
+var preferCloseScopes = []workloadapi.LoadBalancing_Scope{
+	workloadapi.LoadBalancing_NETWORK,
+	workloadapi.LoadBalancing_REGION,
+	workloadapi.LoadBalancing_ZONE,
+	workloadapi.LoadBalancing_SUBZONE,
+}
+
+// trafficDistributionCache keeps the traffic distribution of the kubernetes services resolved from their
+// spec.trafficDistribution and their networking.istio.io/traffic-distribution annotation, keyed by namespace/name.
+// Empty if they set none.
+type trafficDistributionCache struct {
+	mutex sync.RWMutex
+	// the annotation wins over the spec when both are set and differ
+	preferAnnotation bool
+	byService        map[string]string
+}
+
+func newTrafficDistributionCache() *trafficDistributionCache {
+	return &trafficDistributionCache{
+		byService: make(map[string]string),
+	}
+}
+
+// update stores the traffic distribution of the service and reports whether it changed
+func (c *trafficDistributionCache) update(svc *corev1.Service) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	distribution := resolveTrafficDistribution(svc, c.preferAnnotation)
+	key := svc.Namespace + "/" + svc.Name
+	if old, ok := c.byService[key]; ok && old == distribution {
+		return false
+	}
+	c.byService[key] = distribution
+	return true
+}
+
+func (c *trafficDistributionCache) delete(namespace, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.byService, namespace+"/"+name)
+}
+
+// get returns the traffic distribution of the service, false if the service is not known
+func (c *trafficDistributionCache) get(namespace, name string) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	distribution, ok := c.byService[namespace+"/"+name]
+	return distribution, ok
+}
+
+// normalizeTrafficDistribution returns PreferClose in its canonical case, istio matches the annotation
+// regardless of the case
+func normalizeTrafficDistribution(distribution string) string {
+	if strings.EqualFold(distribution, corev1.ServiceTrafficDistributionPreferClose) {
+		return corev1.ServiceTrafficDistributionPreferClose
+	}
+	return distribution
+}
+
+// resolveTrafficDistribution returns the traffic distribution of the service. When both its spec and its
+// annotation set one and they differ, the spec wins unless preferAnnotation, and the conflict is logged.
+func resolveTrafficDistribution(svc *corev1.Service, preferAnnotation bool) string {
+	var spec string
+	if svc.Spec.TrafficDistribution != nil {
+		spec = normalizeTrafficDistribution(*svc.Spec.TrafficDistribution)
+	}
+	annotated := normalizeTrafficDistribution(svc.Annotations[annotation.NetworkingTrafficDistribution.Name])
+	if spec == "" || annotated == "" || spec == annotated {
+		if spec != "" {
+			return spec
+		}
+		return annotated
+	}
+
+	winner, precedence := spec, options.TrafficDistributionPrecedenceSpec
+	if preferAnnotation {
+		winner, precedence = annotated, options.TrafficDistributionPrecedenceAnnotation
+	}
+	log.Warnf("service %s/%s sets the traffic distribution %q in its spec and %q in its %s annotation, "+
+		"the %s one %q is used", svc.Namespace, svc.Name, spec, annotated, annotation.NetworkingTrafficDistribution.Name,
+		precedence, winner)
+	return winner
+}
+
+// SetTrafficDistributionPrecedence sets which of the spec and the annotation of a service wins when both set
+// its traffic distribution, one of the options.TrafficDistributionPrecedence* values. It must be set before
+// the services are watched.
+func (p *Processor) SetTrafficDistributionPrecedence(precedence string) {
+	p.trafficDistributions.mutex.Lock()
+	defer p.trafficDistributions.mutex.Unlock()
+	p.trafficDistributions.preferAnnotation = precedence == options.TrafficDistributionPrecedenceAnnotation
+}
+
+// applyTrafficDistribution sets the locality load balancing of the service from the traffic distribution
+// resolved from its kubernetes service, if known, rather than the one istiod resolved: PreferClose fails over
+// from the closest endpoints, the other ones spread the traffic over all the endpoints. The services only
+// using the endpoints of their node for their internalTrafficPolicy are left as they are.
+func (p *Processor) applyTrafficDistribution(service *workloadapi.Service) {
+	distribution, ok := p.trafficDistributions.get(service.GetNamespace(), service.GetName())
+	if !ok {
+		return
+	}
+	lb := service.GetLoadBalancing()
+	if lb.GetMode() == workloadapi.LoadBalancing_STRICT &&
+		slices.Equal(lb.GetRoutingPreference(), []workloadapi.LoadBalancing_Scope{workloadapi.LoadBalancing_NODE}) {
+		return
+	}
+
+	mode, scopes := workloadapi.LoadBalancing_UNSPECIFIED_MODE, []workloadapi.LoadBalancing_Scope(nil)
+	if distribution == corev1.ServiceTrafficDistributionPreferClose {
+		mode, scopes = workloadapi.LoadBalancing_FAILOVER, preferCloseScopes
+	}
+	if lb.GetMode() == mode && slices.Equal(lb.GetRoutingPreference(), scopes) {
+		return
+	}
+	if lb == nil {
+		service.LoadBalancing = &workloadapi.LoadBalancing{}
+	} else {
+		service.LoadBalancing = proto.Clone(lb).(*workloadapi.LoadBalancing)
+	}
+	service.LoadBalancing.Mode = mode
+	service.LoadBalancing.RoutingPreference = slices.Clone(scopes)
+}
+
+// HandleTrafficDistributionUpdate applies the traffic distribution of a kubernetes service again to
+// the services of the workload api it backs
+func (p *Processor) HandleTrafficDistributionUpdate(namespace, name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, svc := range p.ServiceCache.List() {
+		if svc.GetNamespace() != namespace || svc.GetName() != name {
+			continue
+		}
+		if err := p.handleService(proto.Clone(svc).(*workloadapi.Service)); err != nil {
+			log.Errorf("update traffic distribution of service %s failed: %v", svc.ResourceName(), err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package workload
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"istio.io/api/annotation"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/daemon/options"
+	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/controller/workload/common"
+)
+
+func newTrafficDistributionService(name, spec, annotated string) *corev1.Service {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	if spec != "" {
+		svc.Spec.TrafficDistribution = &spec
+	}
+	if annotated != "" {
+		svc.Annotations = map[string]string{annotation.NetworkingTrafficDistribution.Name: annotated}
+	}
+	return svc
+}
+
+func TestResolveTrafficDistribution(t *testing.T) {
+	tests := []struct {
+		name             string
+		spec             string
+		annotated        string
+		preferAnnotation bool
+		want             string
+	}{
+		{name: "none", want: ""},
+		{name: "spec only", spec: "PreferClose", want: "PreferClose"},
+		{name: "annotation only", annotated: "preferclose", want: "PreferClose"},
+		{name: "both agree", spec: "PreferClose", annotated: "PREFERCLOSE", want: "PreferClose"},
+		{name: "spec wins", spec: "PreferSameNode", annotated: "PreferClose", want: "PreferSameNode"},
+		{name: "annotation wins", spec: "PreferSameNode", annotated: "PreferClose", preferAnnotation: true, want: "PreferClose"},
+		{name: "annotation only with annotation precedence", annotated: "PreferClose", preferAnnotation: true, want: "PreferClose"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTrafficDistributionService("svc", tt.spec, tt.annotated)
+			assert.Equal(t, tt.want, resolveTrafficDistribution(svc, tt.preferAnnotation))
+		})
+	}
+}
+
+func TestTrafficDistributionPrecedence(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	// istiod resolved PreferClose for both, from the annotation of svc1 and the spec of svc2
+	preferClose := createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, preferCloseScopes)
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", preferClose)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", preferClose)
+	// both set the traffic distribution in their spec and their annotation with different values
+	assert.True(t, p.trafficDistributions.update(newTrafficDistributionService("svc1", "PreferSameNode", "PreferClose")))
+	assert.True(t, p.trafficDistributions.update(newTrafficDistributionService("svc2", "PreferClose", "Any")))
+	local := createWorkload("local", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1", "svc2")
+	far := createWorkload("far", "10.244.1.1", "far-node", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z3", "s3"), "svc1", "svc2")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc1, svc2}, []*workloadapi.Workload{local, far})
+
+	lbPolicy := func(svc *workloadapi.Service) uint32 {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: p.hashName.Hash(svc.ResourceName())}, &sv))
+		return sv.LbPolicy
+	}
+
+	// the spec wins by default: svc1 spreads its traffic, svc2 fails over from the closest endpoints
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_UNSPECIFIED_MODE), lbPolicy(svc1))
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_FAILOVER), lbPolicy(svc2))
+
+	// the annotation wins once configured so, whatever the order the services are handled in
+	p.SetTrafficDistributionPrecedence(options.TrafficDistributionPrecedenceAnnotation)
+	assert.True(t, p.trafficDistributions.update(newTrafficDistributionService("svc1", "PreferSameNode", "PreferClose")))
+	p.HandleTrafficDistributionUpdate("default", "svc1")
+	assert.True(t, p.trafficDistributions.update(newTrafficDistributionService("svc2", "PreferClose", "Any")))
+	p.HandleTrafficDistributionUpdate("default", "svc2")
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_FAILOVER), lbPolicy(svc1))
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_UNSPECIFIED_MODE), lbPolicy(svc2))
+
+	// an update from xds keeps the resolved one
+	p.handleServicesAndWorkloads([]*workloadapi.Service{common.CreateFakeService("svc2", "10.240.10.2", "", preferClose)}, nil)
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_UNSPECIFIED_MODE), lbPolicy(svc2))
+
+	// the same spec and annotation change nothing
+	assert.False(t, p.trafficDistributions.update(newTrafficDistributionService("svc2", "PreferClose", "Any")))
+
+	hashNameClean(p)
+}
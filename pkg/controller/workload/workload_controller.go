@@ -18,15 +18,28 @@ package workload
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/netip"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/auth"
 	"kmesh.net/kmesh/pkg/bpf/restart"
 	bpfwl "kmesh.net/kmesh/pkg/bpf/workload"
+	"kmesh.net/kmesh/pkg/controller/netns"
 	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/trace"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/dns"
 	"kmesh.net/kmesh/pkg/logger"
 )
 
@@ -44,7 +57,21 @@ type Controller struct {
 	MetricController          *telemetry.MetricController
 	MapMetricController       *telemetry.MapMetricController
 	OperationMetricController *telemetry.BpfProgMetric
+	Tracer                    *trace.Tracer
 	bpfWorkloadObj            *bpfwl.BpfWorkload
+	// file the state received from xds is checkpointed to, empty if disabled
+	checkpointPath string
+	// set by Resync, the next stream resubscribes for the full state of xds
+	resyncPending atomic.Bool
+	// closes the current stream, guarded by streamMutex
+	streamCancel context.CancelFunc
+	streamMutex  sync.Mutex
+	// coalesceWindow is how long the address responses received in a row are coalesced, 0 if disabled
+	coalesceWindow time.Duration
+	// the responses of recvStream received in the background when they are coalesced, until recvDone is closed
+	recvStream discoveryv3.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
+	responses  <-chan xdsResponse
+	recvDone   chan struct{}
 }
 
 func NewController(bpfWorkload *bpfwl.BpfWorkload, enableMonitoring, enablePerfMonitor bool) *Controller {
@@ -54,11 +81,25 @@ func NewController(bpfWorkload *bpfwl.BpfWorkload, enableMonitoring, enablePerfM
 	}
 	// do some initialization when restart
 	// restore endpoint index, otherwise endpoint number can double
-	if restart.GetStartType() == restart.Restart {
+	if restart.ReusePinned() {
 		c.Processor.bpf.RestoreEndpointKeys()
 	}
+	if resolver, err := dns.NewDNSResolver(); err != nil {
+		log.Errorf("failed to create dns resolver, the hostnames of ServiceEntries will not be resolved: %v", err)
+	} else {
+		c.Processor.EnableDNSResolution(resolver)
+	}
 	c.Rbac = auth.NewRbac(c.Processor.WorkloadCache)
+	c.Processor.rbac = c.Rbac
 	c.MetricController = telemetry.NewMetric(c.Processor.WorkloadCache, c.Processor.ServiceCache, enableMonitoring)
+	c.Tracer = trace.NewTracer()
+	c.Rbac.Tracer = c.Tracer
+	c.Rbac.DeniedFunc = c.MetricController.ConnTracker.Deny
+	c.Rbac.VerdictFunc = c.MetricController.LogVerdict
+	c.MetricController.Tracer = c.Tracer
+	c.MetricController.LocalityTierFunc = c.Processor.LocalityTier
+	c.MetricController.AccesslogFieldsFunc = c.Processor.AccesslogFields
+	c.MetricController.ProtocolFunc = c.Processor.PortProtocol
 	if enablePerfMonitor {
 		c.OperationMetricController = telemetry.NewBpfProgMetric()
 		c.MapMetricController = telemetry.NewMapMetric()
@@ -66,6 +107,121 @@ func NewController(bpfWorkload *bpfwl.BpfWorkload, enableMonitoring, enablePerfM
 	return c
 }
 
+// EnableSocketOperations makes the connections to the services with an idle timeout closed once idle,
+// and the established connections of the pods annotated with kmesh.net/authz-enforce-established closed
+// once a DENY policy denies them. They are closed from the network namespace of the local pod owning them.
+func (c *Controller) EnableSocketOperations(client kubernetes.Interface) {
+	ops := telemetry.NewNetnsSocketOperator(func(addr netip.Addr) (string, error) {
+		workload := c.Processor.WorkloadCache.GetWorkloadByAddr(cache.NetworkAddress{Address: addr})
+		if workload == nil || workload.GetWorkloadType() != workloadapi.WorkloadType_POD {
+			return "", fmt.Errorf("no pod found with address %s", addr)
+		}
+		pod, err := client.CoreV1().Pods(workload.GetNamespace()).Get(context.TODO(), workload.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		return netns.GetPodNSpath(pod)
+	})
+	c.MetricController.IdleReaper = telemetry.NewIdleReaper(ops)
+	c.Processor.establishedEnforcer = newEstablishedEnforcer(c.Processor, c.Rbac, ops)
+}
+
+// SetLoadedNamespaces makes only the services and workloads of the namespaces loaded,
+// along with the workloads on the node. All are loaded if no namespace is given.
+func (c *Controller) SetLoadedNamespaces(namespaces []string) {
+	c.Processor.SetLoadedNamespaces(namespaces)
+	telemetry.SetLoadedNamespaces(len(namespaces))
+	if len(namespaces) != 0 {
+		log.Infof("prune the services and workloads received to namespaces %v", namespaces)
+	}
+}
+
+// SetExcludedCIDRs lets the connections to the destinations in cidrs go direct, neither redirected nor authorized
+func (c *Controller) SetExcludedCIDRs(cidrs []netip.Prefix) {
+	c.Processor.SetExcludedCIDRs(cidrs)
+	c.Rbac.SetExcludedCIDRs(cidrs)
+	if len(cidrs) != 0 {
+		log.Infof("exclude the destinations %v from the redirection and authorization", cidrs)
+	}
+}
+
+// SetNamespaceIsolation denies the connections from other namespaces to the workloads no ALLOW policy applies to
+func (c *Controller) SetNamespaceIsolation(enabled bool) {
+	c.Processor.SetNamespaceIsolation(enabled)
+	c.Rbac.SetNamespaceIsolation(enabled)
+	if enabled {
+		log.Info("deny the connections across namespaces unless an ALLOW policy applies to the destination")
+	}
+}
+
+// SetAuthzHandoff sets how the authorization of the new connections is handed over to userspace while the
+// policies of a response are written to the bpf maps
+func (c *Controller) SetAuthzHandoff(handoff func(handoff bool) error) {
+	c.Processor.SetAuthzHandoff(handoff)
+}
+
+// SetCacheMaxEntries bounds the workload and service caches, 0 leaves them unbounded
+func (c *Controller) SetCacheMaxEntries(maxEntries int) {
+	c.Processor.SetCacheMaxEntries(maxEntries)
+	if maxEntries > 0 {
+		log.Infof("bound the workload and service caches to %d entries each", maxEntries)
+	}
+}
+
+// SetLocalityDefault sets the locality load balancing of the services with no traffic distribution of their own
+func (c *Controller) SetLocalityDefault(mode string) {
+	c.Processor.SetLocalityDefault(mode)
+	if mode != "" && mode != options.LocalityDistribute {
+		log.Infof("default the locality load balancing of the services to %s", mode)
+	}
+}
+
+// SetTrafficDistributionPrecedence sets which of the spec and the annotation of a service wins when both set
+// its traffic distribution, one of the options.TrafficDistributionPrecedence* values
+func (c *Controller) SetTrafficDistributionPrecedence(precedence string) {
+	c.Processor.SetTrafficDistributionPrecedence(precedence)
+	if precedence == options.TrafficDistributionPrecedenceAnnotation {
+		log.Infof("the traffic distribution annotation of the services wins over their spec")
+	}
+}
+
+// EnableCheckpoint checkpoints the state received from xds to path. A daemon restarting with the bpf maps
+// of the last one restores its checkpoint, to serve with the full state before its xds resync.
+func (c *Controller) EnableCheckpoint(path string) {
+	c.checkpointPath = path
+	if !restart.ReusePinned() {
+		return
+	}
+	start := time.Now()
+	cp, err := readCheckpoint(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	} else if err != nil {
+		log.Errorf("failed to read the checkpoint %s, wait for the xds resync: %v", path, err)
+		return
+	}
+	c.Processor.restoreCheckpoint(cp, c.Rbac)
+	log.Infof("restored %d services, %d workloads and %d authorization policies from the checkpoint in %v",
+		len(cp.services), len(cp.workloads), len(cp.policies), time.Since(start))
+}
+
+// EnableConnectionExport exports the L4 connections as spans to the OTLP collector at endpoint
+func (c *Controller) EnableConnectionExport(ctx context.Context, endpoint string, insecure bool) error {
+	exporter, err := telemetry.NewConnectionExporter(ctx, endpoint, insecure)
+	if err != nil {
+		return err
+	}
+	c.MetricController.ConnectionExporter = exporter
+	log.Infof("export the connections to the OTLP collector %s", endpoint)
+	return nil
+}
+
+// EnableAccesslogSocket also writes the accesslog entries to the unix socket at path
+func (c *Controller) EnableAccesslogSocket(ctx context.Context, path string) {
+	c.MetricController.AccesslogSocket = telemetry.NewAccesslogSocketWriter(ctx, path)
+	log.Infof("write the accesslog entries to the socket %s", path)
+}
+
 func (c *Controller) Run(ctx context.Context) {
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -82,9 +238,19 @@ func (c *Controller) Run(ctx context.Context) {
 		c.Rbac.Run(ctx, c.bpfWorkloadObj.SockOps.KmAuthReq, c.bpfWorkloadObj.XdpAuth.KmAuthRes)
 	}()
 
+	if c.Processor.dns != nil {
+		c.Processor.dns.Run(ctx.Done())
+	}
+	go c.Processor.runSlowStart(ctx.Done())
+	go c.Processor.runBandwidthMetrics(ctx.Done())
+	go c.Processor.runMapGC(ctx.Done())
+	go c.Processor.establishedEnforcer.Run(ctx.Done())
+	if c.checkpointPath != "" {
+		go c.Processor.runCheckpoint(ctx.Done(), c.checkpointPath, c.Rbac)
+	}
 	go c.MetricController.Run(ctx, c.bpfWorkloadObj.SockConn.KmTcpProbe)
 	if c.MapMetricController != nil {
-		go c.MapMetricController.Run(ctx)
+		go c.MapMetricController.Run(ctx, c.bpfWorkloadObj.XdpAuth.KmAuthRes, c.bpfWorkloadObj.XdpAuth.KmCtStats)
 	}
 	if c.OperationMetricController != nil {
 		go c.OperationMetricController.Run(ctx, c.bpfWorkloadObj.SockConn.KmPerfInfo)
@@ -97,12 +263,28 @@ func (c *Controller) WorkloadStreamCreateAndSend(client discoveryv3.AggregatedDi
 		initialResourceVersions map[string]string
 	)
 
+	ctx, cancel := context.WithCancel(ctx)
+	c.streamMutex.Lock()
+	if c.streamCancel != nil {
+		// release the last stream, it already failed
+		c.streamCancel()
+	}
+	c.streamCancel = cancel
+	c.streamMutex.Unlock()
 	c.Stream, err = client.DeltaAggregatedResources(ctx)
 	if err != nil {
 		return fmt.Errorf("DeltaAggregatedResources failed, %s", err)
 	}
 
+	// the resources waiting for the full state are not sent, for istiod to send all of them again
+	var awaitAddresses, awaitPolicies bool
 	if c.Processor != nil {
+		if c.resyncPending.Swap(false) {
+			c.Processor.markResync(c.Rbac)
+		}
+		awaitAddresses, awaitPolicies = c.Processor.awaitingFullState()
+	}
+	if c.Processor != nil && !awaitAddresses {
 		cachedServices := c.Processor.ServiceCache.List()
 		cachedWorkloads := c.Processor.WorkloadCache.List()
 		initialResourceVersions = make(map[string]string, len(cachedServices)+len(cachedWorkloads))
@@ -113,6 +295,10 @@ func (c *Controller) WorkloadStreamCreateAndSend(client discoveryv3.AggregatedDi
 		}
 
 		for _, workload := range cachedWorkloads {
+			// istiod does not know the workloads of the addresses resolved by kmesh
+			if isResolvedWorkload(workload) {
+				continue
+			}
 			initialResourceVersions[workload.ResourceName()] = ""
 		}
 	}
@@ -122,7 +308,10 @@ func (c *Controller) WorkloadStreamCreateAndSend(client discoveryv3.AggregatedDi
 		return fmt.Errorf("send request failed, %s", err)
 	}
 
-	initialResourceVersions = c.Rbac.GetAllPolicies()
+	initialResourceVersions = nil
+	if !awaitPolicies {
+		initialResourceVersions = c.Rbac.GetAllPolicies()
+	}
 	log.Debugf("send initial request with authorization resources: %v", initialResourceVersions)
 	if err = c.Stream.Send(newDeltaRequest(AuthorizationType, nil, initialResourceVersions)); err != nil {
 		return fmt.Errorf("authorization subscribe failed, %s", err)
@@ -131,25 +320,80 @@ func (c *Controller) WorkloadStreamCreateAndSend(client discoveryv3.AggregatedDi
 	return nil
 }
 
+// Resync drops the state received from xds and resubscribes, to recover from a suspected drift of the
+// bpf maps. The stream is closed, the next one subscribes for the full state of xds and applies it to
+// the bpf maps again, the services, workloads and authorization policies it does not carry are removed.
+func (c *Controller) Resync() {
+	c.resyncPending.Store(true)
+	telemetry.IncManualResync()
+	log.Infof("resync the xds state on request")
+
+	c.streamMutex.Lock()
+	defer c.streamMutex.Unlock()
+	// the stream is recreated once its recv fails, the resync waits for it if it is being recreated
+	if c.streamCancel != nil {
+		c.streamCancel()
+	}
+}
+
+// GCMaps removes the entries of the bpf maps with no backing xds resource on request, and returns the
+// number of entries removed by map
+func (c *Controller) GCMaps() map[string]int {
+	log.Infof("collect the stale entries of the bpf maps on request")
+	return c.Processor.GCMaps()
+}
+
+// OutlierEjections returns the backends the outlier detection of the services currently ejects, the ones of
+// service only if not empty
+func (c *Controller) OutlierEjections(service string) ([]OutlierEjection, error) {
+	return c.Processor.OutlierEjections(service)
+}
+
+// ClearOutlierEjections re-admits the backends the outlier detection of the services currently ejects, the
+// ones of service only if not empty
+func (c *Controller) ClearOutlierEjections(service string) ([]OutlierEjection, error) {
+	ejections, err := c.Processor.ClearOutlierEjections(service)
+	if err == nil {
+		log.Infof("re-admitted %d backends ejected by the outlier detection on request", len(ejections))
+	}
+	return ejections, err
+}
+
 func (c *Controller) HandleWorkloadStream() error {
-	var (
-		err      error
-		rspDelta *discoveryv3.DeltaDiscoveryResponse
-	)
+	if c.coalesceWindow <= 0 {
+		rspDelta, err := c.Stream.Recv()
+		if err != nil {
+			_ = c.Stream.CloseSend()
+			return fmt.Errorf("stream recv failed, %s", err)
+		}
+		return c.handleWorkloadResponse(rspDelta)
+	}
 
-	if rspDelta, err = c.Stream.Recv(); err != nil {
+	// the responses received before the stream failed are applied all the same
+	rsps, recvErr := c.recvCoalesced()
+	for _, rspDelta := range rsps {
+		if err := c.handleWorkloadResponse(rspDelta); err != nil {
+			return err
+		}
+	}
+	if recvErr != nil {
 		_ = c.Stream.CloseSend()
-		return fmt.Errorf("stream recv failed, %s", err)
+		return fmt.Errorf("stream recv failed, %s", recvErr)
 	}
+	return nil
+}
 
+func (c *Controller) handleWorkloadResponse(rspDelta *discoveryv3.DeltaDiscoveryResponse) error {
+	start := time.Now()
 	c.Processor.processWorkloadResponse(rspDelta, c.Rbac)
+	telemetry.ObserveXdsPush(rspDelta.GetTypeUrl(), start)
 
-	if err = c.Stream.Send(c.Processor.ack); err != nil {
+	if err := c.Stream.Send(c.Processor.ack); err != nil {
 		return fmt.Errorf("stream send ack failed, %s", err)
 	}
 
 	if c.Processor.req != nil {
-		if err = c.Stream.Send(c.Processor.req); err != nil {
+		if err := c.Stream.Send(c.Processor.req); err != nil {
 			return fmt.Errorf("stream send req failed, %s", err)
 		}
 	}
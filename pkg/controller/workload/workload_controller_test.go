@@ -19,12 +19,14 @@ package workload
 import (
 	"context"
 	"errors"
+	"net/netip"
 	"reflect"
 	"testing"
 
 	"github.com/agiledragon/gomonkey/v2"
 	config_cluster_v3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
 	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/protobuf/types/known/anypb"
 
@@ -37,6 +39,7 @@ import (
 	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
 	"kmesh.net/kmesh/pkg/controller/workload/common"
 	"kmesh.net/kmesh/pkg/controller/xdstest"
+	"kmesh.net/kmesh/pkg/nets"
 )
 
 func TestWorkloadStreamCreateAndSend(t *testing.T) {
@@ -203,6 +206,7 @@ func TestWorkloadStream_WorkloadstreamProcess(t *testing.T) {
 	workloadStream := Controller{
 		Processor: &Processor{
 			ack:         &discoveryv3.DeltaDiscoveryRequest{},
+			slowStart:   newSlowStart(),
 			addressDone: make(chan struct{}),
 			authzDone:   make(chan struct{}),
 		},
@@ -321,3 +325,89 @@ func TestWorkloadStream_WorkloadstreamProcess(t *testing.T) {
 		})
 	}
 }
+
+func TestWatchedNamespaces(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	mockDiscovery := xdstest.NewXdsServer(t)
+	fakeClient, err := xdstest.NewClient(mockDiscovery)
+	if err != nil {
+		t.Fatalf("create stream failed, %s", err)
+	}
+	defer fakeClient.Cleanup()
+
+	c := &Controller{
+		Processor: NewProcessor(workloadMap),
+		Stream:    fakeClient.DeltaClient,
+	}
+	c.Processor.nodeName = "node1"
+	c.SetLoadedNamespaces([]string{"loaded"})
+
+	newService := func(name, namespace, ip string) *workloadapi.Service {
+		svc := common.CreateFakeService(name, ip, "", nil)
+		svc.Namespace = namespace
+		svc.Hostname = name + "." + namespace + ".svc.cluster.local"
+		return svc
+	}
+	newWorkload := func(name, namespace, ip, node string) *workloadapi.Workload {
+		wl := createWorkload(name, ip, node, workloadapi.NetworkMode_STANDARD, nil)
+		wl.Namespace = namespace
+		wl.Uid = "cluster0//Pod/" + namespace + "/" + name
+		return wl
+	}
+	loadedService := newService("svc1", "loaded", "10.240.10.1")
+	otherService := newService("svc2", "other", "10.240.10.2")
+	loadedWorkload := newWorkload("pod1", "loaded", "10.244.0.1", "node2")
+	localWorkload := newWorkload("pod2", "other", "10.244.0.2", "node1")
+	otherWorkload := newWorkload("pod3", "other", "10.244.0.3", "node2")
+
+	var resources []*discoveryv3.Resource
+	for _, address := range []*workloadapi.Address{
+		{Type: &workloadapi.Address_Service{Service: loadedService}},
+		{Type: &workloadapi.Address_Service{Service: otherService}},
+		{Type: &workloadapi.Address_Workload{Workload: loadedWorkload}},
+		{Type: &workloadapi.Address_Workload{Workload: localWorkload}},
+		{Type: &workloadapi.Address_Workload{Workload: otherWorkload}},
+	} {
+		resource, err := anypb.New(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resources = append(resources, &discoveryv3.Resource{Resource: resource})
+	}
+	go func() {
+		mockDiscovery.DeltaResponses <- &discoveryv3.DeltaDiscoveryResponse{
+			TypeUrl:   AddressType,
+			Nonce:     "1",
+			Resources: resources,
+		}
+	}()
+	if err := c.HandleWorkloadStream(); err != nil {
+		t.Fatalf("handle workload stream failed, %s", err)
+	}
+
+	p := c.Processor
+	assert.NotNil(t, p.ServiceCache.GetService(loadedService.ResourceName()))
+	assert.Nil(t, p.ServiceCache.GetService(otherService.ResourceName()))
+	assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(loadedWorkload.Uid))
+	assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(localWorkload.Uid))
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid(otherWorkload.Uid))
+
+	// only the resources kept are in the bpf maps
+	var fk bpfcache.FrontendKey
+	var fv bpfcache.FrontendValue
+	for ip, loaded := range map[string]bool{
+		"10.240.10.1": true,
+		"10.240.10.2": false,
+		"10.244.0.1":  true,
+		"10.244.0.2":  true,
+		"10.244.0.3":  false,
+	} {
+		nets.CopyIpByteFromSlice(&fk.Ip, netip.MustParseAddr(ip).AsSlice())
+		err := p.bpf.FrontendLookup(&fk, &fv)
+		assert.Equal(t, loaded, err == nil, "frontend of %s", ip)
+	}
+
+	hashNameClean(p)
+}
@@ -17,16 +17,24 @@
 package workload
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
+	"net"
 	"net/netip"
 	"os"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/anypb"
+	"istio.io/istio/pkg/maps"
 	"istio.io/istio/pkg/slices"
 	"istio.io/istio/pkg/util/sets"
 
@@ -34,6 +42,7 @@ import (
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 	security_v2 "kmesh.net/kmesh/api/v2/workloadapi/security"
 	bpf2go "kmesh.net/kmesh/bpf/kmesh/bpf2go/dualengine"
+	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/auth"
 	kmeshbpf "kmesh.net/kmesh/pkg/bpf/restart"
 	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
@@ -43,12 +52,16 @@ import (
 	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
 	bpf "kmesh.net/kmesh/pkg/controller/workload/bpfcache"
 	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/dns"
 	"kmesh.net/kmesh/pkg/nets"
 	"kmesh.net/kmesh/pkg/utils"
 )
 
 const (
 	KmeshWaypointPort = 15019 // use this fixed port instead of the HboneMtlsPort in kmesh
+
+	// defaultApplyBatchSize is how many workloads of a xds response are applied before the lock is released
+	defaultApplyBatchSize = 256
 )
 
 type Processor struct {
@@ -64,9 +77,78 @@ type Processor struct {
 	WaypointCache cache.WaypointCache
 	locality      bpf.LocalityCache
 
+	ServiceAnnotationCache cache.ServiceAnnotationCache
+
+	// resolves the hostnames of the ServiceEntries, nil if disabled
+	dns *dnsController
+
+	// namespaces whose services and workloads are loaded, empty for all
+	loadedNamespaces sets.Set[string]
+
+	// destinations left out of the frontend map for their connections to go direct
+	excludedCIDRs []netip.Prefix
+
+	// locality load balancing of the services with none of their own, nil to spread over all the endpoints
+	localityDefault *workloadapi.LoadBalancing
+	// traffic distributions of the kubernetes services, resolved from their spec and annotation
+	trafficDistributions *trafficDistributionCache
+
+	// endpoints whose weight ramps up since they became ready
+	slowStart *slowStart
+
+	// packets throttled by the bandwidth of the services at the last metrics refresh, keyed by service name
+	bandwidthThrottled map[string][bpf.BandwidthDirections]uint32
+
+	// accesslog fields parsed from the kmesh.net/accesslog-fields annotations
+	accesslogFields *accesslogFieldsCache
+
+	// application protocols of the service ports, the connections are tagged with in the metrics
+	portProtocols *portProtocolCache
+	// health transitions of the workloads received from xds
+	endpointHealth *endpointHealthCache
+
+	// denies the connections across namespaces to the workloads no ALLOW policy applies to
+	namespaceIsolation bool
+	// namespaces whose namespace isolation policy is stored for the xdp authz
+	isolatedNamespaces sets.Set[string]
+	// authz offload of the pods of the node labeled with kmesh.net/authz, keyed by namespace/name
+	podAuthzOffload map[string]uint32
+	// workloads of the node whose connections are authorized in userspace while they are traced,
+	// keyed by uid and counted per trace
+	tracedWorkloads map[string]int
+	// pods of the node annotated with kmesh.net/authz-enforce-established, keyed by namespace/name
+	enforceEstablishedPods sets.Set[string]
+	// closes the established connections of those pods a DENY policy denies, nil if disabled
+	establishedEnforcer *establishedEnforcer
+	// policies translated from the NetworkPolicies selecting the pods of the node, keyed by namespace/name
+	networkPolicies map[string][]*security.Authorization
+	// policies denying the connections from outside the mesh to the services in DENY_NON_MESH kmesh.net/mtls mode,
+	// keyed by service
+	mtlsPolicies map[string]*security.Authorization
+	// receives the policies programmed for the services, to authorize in userspace the connections the
+	// xdp authz can not, nil in tests
+	rbac *auth.Rbac
+	// hands the authorization of the new connections over to userspace while the policies of a response are
+	// written to the bpf maps, and back once done, nil if the xdp authz is never handed over
+	authzHandoff func(handoff bool) error
+
+	// workloads of a response applied to the bpf maps at once
+	applyBatchSize int
+	// set while a xds response is applied, lets the ones waiting for the lock in between its batches
+	yieldApply func()
+
+	// serializes xds responses with service annotation updates
+	mutex     sync.Mutex
 	once      sync.Once
 	authzOnce sync.Once
 
+	// resources restored from the checkpoint or loaded before a resync, reconciled with the first
+	// xds response of their type
+	restoredAddresses sets.Set[string]
+	restoredPolicies  sets.Set[string]
+	// set when a xds response changed the state since the last checkpoint
+	checkpointDirty atomic.Bool
+
 	// used to notify Rbac the address/authz type response is done when Kmesh restart
 	addressDone     chan struct{}
 	authzDone       chan struct{}
@@ -86,8 +168,23 @@ func NewProcessor(workloadMap bpf2go.KmeshCgroupSockWorkloadMaps) *Processor {
 		EndpointCache: cache.NewEndpointCache(),
 		WaypointCache: cache.NewWaypointCache(serviceCache),
 		locality:      bpf.NewLocalityCache(),
-		addressDone:   make(chan struct{}, 1),
-		authzDone:     make(chan struct{}, 1),
+		slowStart:     newSlowStart(),
+		accesslogFields: &accesslogFieldsCache{
+			byValue: make(map[string][]string),
+		},
+		portProtocols:          newPortProtocolCache(),
+		trafficDistributions:   newTrafficDistributionCache(),
+		endpointHealth:         newEndpointHealthCache(),
+		podAuthzOffload:        make(map[string]uint32),
+		tracedWorkloads:        make(map[string]int),
+		networkPolicies:        make(map[string][]*security.Authorization),
+		mtlsPolicies:           make(map[string]*security.Authorization),
+		enforceEstablishedPods: sets.New[string](),
+		applyBatchSize:         defaultApplyBatchSize,
+		addressDone:            make(chan struct{}, 1),
+		authzDone:              make(chan struct{}, 1),
+
+		ServiceAnnotationCache: cache.NewServiceAnnotationCache(),
 	}
 }
 
@@ -112,6 +209,81 @@ func newAckRequest(rsp *service_discovery_v3.DeltaDiscoveryResponse) *service_di
 	}
 }
 
+// SetLoadedNamespaces restricts the services and workloads loaded to the namespaces, the workloads
+// on the node are loaded whatever their namespace. The others are still received from xds and
+// dropped on receipt, the subscription is not scoped.
+func (p *Processor) SetLoadedNamespaces(namespaces []string) {
+	p.loadedNamespaces = sets.New(namespaces...)
+}
+
+// isLoaded reports whether the resources of the namespace are loaded
+func (p *Processor) isLoaded(namespace string) bool {
+	return len(p.loadedNamespaces) == 0 || p.loadedNamespaces.Contains(namespace)
+}
+
+// SetExcludedCIDRs leaves the services and workloads with an address in cidrs out of the frontend map,
+// it must be set before the workloads are handled
+func (p *Processor) SetExcludedCIDRs(cidrs []netip.Prefix) {
+	p.excludedCIDRs = cidrs
+}
+
+// isExcluded reports whether the connections to ip are left alone
+func (p *Processor) isExcluded(ip []byte) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range p.excludedCIDRs {
+		if cidr.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNamespaceIsolation programs the xdp authz of the workloads of the node so that the connections
+// across namespaces are authorized in userspace, it must be set before the workloads are handled
+func (p *Processor) SetNamespaceIsolation(enabled bool) {
+	p.namespaceIsolation = enabled
+	p.isolatedNamespaces = sets.New[string]()
+}
+
+// SetAuthzHandoff sets how the authorization of the new connections is handed over to userspace while the
+// policies of a response are written to the bpf maps
+func (p *Processor) SetAuthzHandoff(handoff func(handoff bool) error) {
+	p.authzHandoff = handoff
+}
+
+// SetCacheMaxEntries bounds the workload and service caches to maxEntries each, 0 leaves them unbounded.
+// Delta xds does not send a resource again, so the ones it still has are never evicted, unhealthy workloads
+// and services without frontends included, and the caches exceed maxEntries when the xds state does. The
+// resources removed from xds, or pruned with the restored ones it no longer has, are deleted from the caches.
+func (p *Processor) SetCacheMaxEntries(maxEntries int) {
+	inXds := func(string) bool { return true }
+	p.WorkloadCache.SetMaxEntries(maxEntries, inXds)
+	p.ServiceCache.SetMaxEntries(maxEntries, inXds)
+}
+
+// SetLocalityDefault sets the locality load balancing of the services with no traffic distribution of their own
+// to one of the options.Locality* modes, it must be set before the services are handled
+func (p *Processor) SetLocalityDefault(mode string) {
+	switch mode {
+	case options.LocalityPreferClose:
+		p.localityDefault = &workloadapi.LoadBalancing{Mode: workloadapi.LoadBalancing_FAILOVER, RoutingPreference: preferCloseScopes}
+	case options.LocalityStrict:
+		p.localityDefault = &workloadapi.LoadBalancing{Mode: workloadapi.LoadBalancing_STRICT, RoutingPreference: preferCloseScopes}
+	default:
+		p.localityDefault = nil
+	}
+}
+
+// EnableDNSResolution makes the workloads of the ServiceEntries with DNS resolution handled
+// once their hostname is resolved by the resolver
+func (p *Processor) EnableDNSResolution(resolver *dns.DNSResolver) {
+	p.dns = newDnsController(p, resolver)
+}
+
 func (p *Processor) GetBpfCache() *bpf.Cache {
 	return p.bpf
 }
@@ -120,18 +292,48 @@ func (p *Processor) GetHashName() *utils.HashName {
 	return p.hashName
 }
 
+// LocalityTier returns the locality priority of the backend for the service,
+// false if the service is not locality load balanced.
+func (p *Processor) LocalityTier(backend *workloadapi.Workload, service *workloadapi.Service) (uint32, bool) {
+	if service.GetLoadBalancing().GetMode() == workloadapi.LoadBalancing_UNSPECIFIED_MODE || p.locality.LocalityInfo == nil {
+		return 0, false
+	}
+	return p.locality.CalcLocalityLBPrio(backend, service.GetLoadBalancing().GetRoutingPreference()), true
+}
+
 func (p *Processor) processWorkloadResponse(rsp *service_discovery_v3.DeltaDiscoveryResponse, rbac *auth.Rbac) {
 	var err error
 
+	// the reconciles are started before waiting for the lock, so that one held forever makes them stale
+	var serviceReconciled, workloadReconciled, authzReconciled func(error)
+	switch rsp.GetTypeUrl() {
+	case AddressType:
+		serviceReconciled = telemetry.StartReconcile(telemetry.ControllerService)
+		workloadReconciled = telemetry.StartReconcile(telemetry.ControllerWorkload)
+	case AuthorizationType:
+		authzReconciled = telemetry.StartReconcile(telemetry.ControllerAuthz)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
 	p.ack = newAckRequest(rsp)
+	p.checkpointDirty.Store(true)
 	switch rsp.GetTypeUrl() {
 	case AddressType:
-		err = p.handleAddressTypeResponse(rsp)
+		// the resources failing to be applied are logged as they are handled
+		p.yieldApply = p.yieldLock
+		serviceErr, workloadErr := p.handleAddressTypeResponse(rsp)
+		p.yieldApply = nil
+		serviceReconciled(serviceErr)
+		workloadReconciled(workloadErr)
 		p.addressRespOnce.Do(func() {
+			p.slowStart.synced = true
 			p.addressDone <- struct{}{}
 		})
 	case AuthorizationType:
 		err = p.handleAuthorizationTypeResponse(rsp, rbac)
+		authzReconciled(err)
 		p.authzRespOnce.Do(func() {
 			p.authzDone <- struct{}{}
 		})
@@ -171,6 +373,11 @@ func (p *Processor) storePodFrontendData(uid uint32, ip []byte) error {
 	)
 
 	nets.CopyIpByteFromSlice(&fk.Ip, ip)
+	if p.isExcluded(ip) {
+		// the entry may be left by a previous run without the exclusion
+		_ = p.bpf.FrontendDelete(&fk)
+		return nil
+	}
 	fv.UpstreamId = uid
 	if err := p.bpf.FrontendUpdate(&fk, &fv); err != nil {
 		return fmt.Errorf("Update frontend map failed, err:%s", err)
@@ -181,6 +388,12 @@ func (p *Processor) storePodFrontendData(uid uint32, ip []byte) error {
 
 func (p *Processor) removeWorkloadResources(removedResources []string) error {
 	for _, uid := range removedResources {
+		// the workloads of the addresses the hostname of the workload resolved to go along with it
+		for _, resolved := range p.dns.unwatch(uid) {
+			if err := p.removeWorkload(resolved); err != nil {
+				log.Warnf("removeWorkload %s failed: %v", resolved, err)
+			}
+		}
 		err := p.removeWorkload(uid)
 		if err != nil {
 			log.Warnf("removeWorkload %s failed: %v", uid, err)
@@ -197,8 +410,20 @@ func (p *Processor) removeWorkload(uid string) error {
 		return nil
 	}
 	p.WorkloadCache.DeleteWorkload(uid)
+	p.endpointHealth.delete(uid)
 	telemetry.DeleteWorkloadMetric(wl)
-	return p.removeWorkloadFromBpfMap(wl)
+	if err := p.removeWorkloadFromBpfMap(wl); err != nil {
+		return err
+	}
+	for svcName := range wl.GetServices() {
+		if err := p.updateServicePrioLoad(svcName); err != nil {
+			log.Errorf("update prio load of service %s failed: %v", svcName, err)
+		}
+		if err := p.updateServiceAvailability(svcName); err != nil {
+			log.Errorf("update availability of service %s failed: %v", svcName, err)
+		}
+	}
+	return nil
 }
 
 // handleUnhealthyWorkload is used to handle unhealthy workload, we only leave it in the frontend and backend map.
@@ -263,8 +488,13 @@ func (p *Processor) deleteServiceFrontendData(service *workloadapi.Service, id u
 
 	// If old service exist, use its address
 	if service != nil {
+		fv := bpf.FrontendValue{}
 		for _, networkAddress := range service.GetAddresses() {
 			nets.CopyIpByteFromSlice(&fk.Ip, networkAddress.Address)
+			// keep the frontend of an address a newer service claimed
+			if p.bpf.FrontendLookup(&fk, &fv) == nil && fv.UpstreamId != id {
+				continue
+			}
 			if err = p.bpf.FrontendDelete(&fk); err != nil {
 				log.Errorf("delete service %s frontend key %v, err: %v", service.ResourceName(), fk, err)
 			}
@@ -294,6 +524,10 @@ func (p *Processor) removeServiceResources(resources []string) error {
 		svc := p.ServiceCache.GetService(name)
 		p.ServiceCache.DeleteService(name)
 		_ = p.removeServiceResourceFromBpfMap(svc, name)
+		if policy, ok := p.mtlsPolicies[name]; ok {
+			p.removeServiceMtls(name, policy.ResourceName())
+		}
+		p.rbac.SetConnectionLimit(name, nil)
 	}
 	return nil
 }
@@ -349,6 +583,7 @@ func (p *Processor) addWorkloadToService(sk *bpf.ServiceKey, sv *bpf.ServiceValu
 	ek.ServiceId = sk.ServiceId
 	ek.Prio = priority
 	ev.BackendUid = workloadUid
+	ev.Weight = p.getEndpointWeight(sk.ServiceId, workloadUid)
 	if err := p.bpf.EndpointUpdate(&ek, &ev); err != nil {
 		log.Errorf("Update endpoint map failed, err:%s", err)
 		return err, ek
@@ -388,6 +623,7 @@ func (p *Processor) handleWorkloadNewBoundServices(workload *workloadapi.Workloa
 		sk.ServiceId = svcUid
 		// the service already stored in map, add endpoint
 		if err := p.bpf.ServiceLookup(&sk, &sv); err == nil {
+			p.beginSlowStart(&sv, svcUid, workloadId)
 			if sv.LbPolicy == uint32(workloadapi.LoadBalancing_UNSPECIFIED_MODE) { // random mode
 				// In random mode, we save all workload to max priority group
 				if err, _ = p.addWorkloadToService(&sk, &sv, workloadId, 0); err != nil {
@@ -411,20 +647,31 @@ func (p *Processor) handleWorkloadNewBoundServices(workload *workloadapi.Workloa
 
 func (p *Processor) updateWorkloadInBackendMap(workload *workloadapi.Workload) error {
 	var (
-		err error
-		bk  = bpf.BackendKey{}
-		bv  = bpf.BackendValue{}
+		err     error
+		bk      = bpf.BackendKey{}
+		bv      = bpf.BackendValue{}
+		current = bpf.BackendValue{}
 	)
 
 	backendUid := p.hashName.Hash(workload.GetUid())
 	log.Debugf("updateWorkloadInBackendMap: workload %s, backendUid: %v", workload.GetUid(), backendUid)
 
+	// the connect failures and the active connections of the backend are written by sockops and survive its
+	// updates. The data plane may still write them between the lookup and the update, such a write is lost,
+	// which is why the backend is not rewritten at all when xds pushes it unchanged.
+	bk.BackendUid = backendUid
+	found := p.bpf.BackendLookup(&bk, &current) == nil
+	if found {
+		bv.KeepDataPlaneState(&current)
+	}
+
 	if waypoint := workload.GetWaypoint(); waypoint != nil && waypoint.GetAddress() != nil {
 		nets.CopyIpByteFromSlice(&bv.WaypointAddr, waypoint.GetAddress().Address)
 		bv.WaypointPort = nets.ConvertPortToBigEndian(waypoint.GetHboneMtlsPort())
 	}
 
-	for serviceName := range workload.GetServices() {
+	// in a stable order, an unchanged workload makes the same backend
+	for _, serviceName := range slices.Sort(maps.Keys(workload.GetServices())) {
 		bv.Services[bv.ServiceCount] = p.hashName.Hash(serviceName)
 		bv.ServiceCount++
 		if bv.ServiceCount >= bpf.MaxServiceNum {
@@ -436,10 +683,14 @@ func (p *Processor) updateWorkloadInBackendMap(workload *workloadapi.Workload) e
 	for _, ip := range workload.GetAddresses() {
 		bk.BackendUid = backendUid
 		nets.CopyIpByteFromSlice(&bv.Ip, ip)
+		if found && bv == current {
+			continue
+		}
 		if err = p.bpf.BackendUpdate(&bk, &bv); err != nil {
 			log.Errorf("Update backend map failed, err:%s", err)
 			return err
 		}
+		found, current = true, bv
 	}
 	return nil
 }
@@ -454,6 +705,20 @@ func (p *Processor) updateWorkloadInFrontendMap(workload *workloadapi.Workload)
 	backendUid := p.hashName.Hash(workload.GetUid())
 	log.Debugf("updateWorkloadInFrontendMap: workload %s, backendUid: %v", workload.GetUid(), backendUid)
 
+	// the connections to the addresses a hostname resolved to are routed as the ones to the ServiceEntry
+	if isResolvedWorkload(workload) {
+		services := slices.Sort(maps.Keys(workload.GetServices()))
+		if len(services) == 0 {
+			return nil
+		}
+		for _, ip := range workload.GetAddresses() {
+			if err := p.storePodFrontendData(p.hashName.Hash(services[0]), ip); err != nil {
+				return fmt.Errorf("storePodFrontendData failed, err:%s", err)
+			}
+		}
+		return nil
+	}
+
 	for _, ip := range workload.GetAddresses() {
 		svc := p.getServiceByAddress(ip)
 		if svc != nil {
@@ -480,6 +745,15 @@ func (p *Processor) getServiceByAddress(address []byte) *workloadapi.Service {
 }
 
 func (p *Processor) handleWorkload(workload *workloadapi.Workload) error {
+	if err := p.updateWorkload(workload); err != nil {
+		return err
+	}
+	return p.unbindWorkloadServices(workload)
+}
+
+// updateWorkload updates the workload in the bpf maps and adds it to its new services,
+// it is only removed from the services it no longer belongs to by unbindWorkloadServices
+func (p *Processor) updateWorkload(workload *workloadapi.Workload) error {
 	log.Debugf("handle workload: %s", workload.ResourceName())
 
 	if resolved := p.WaypointCache.AddOrUpdateWorkload(workload); !resolved {
@@ -493,9 +767,10 @@ func (p *Processor) handleWorkload(workload *workloadapi.Workload) error {
 	oldWorkload := p.WorkloadCache.GetWorkloadByUid(workload.GetUid())
 	// Keep track of the workload no matter it is healthy, unhealthy workload is just for debugging
 	p.WorkloadCache.AddOrUpdateWorkload(workload)
+	p.recordEndpointHealth(workload)
 	// We only do authz for workloads within same node. So no need to store other unused authorization
 	if p.nodeName == workload.Node {
-		p.storeWorkloadPolicies(workload.GetUid(), workload.GetAuthorizationPolicies())
+		p.storeWorkloadPolicies(workload)
 	}
 
 	// update kmesh localityCache
@@ -516,13 +791,9 @@ func (p *Processor) handleWorkload(workload *workloadapi.Workload) error {
 		return fmt.Errorf("updateWorkloadInBackendMap %s failed: %v", workload.Uid, err)
 	}
 
-	// 2~3. update workload in endpoint map and service map
-	unboundedEndpointKeys, newServices := p.compareWorkloadServices(workload)
-	if err := p.handleWorkloadUnboundServices(workload, unboundedEndpointKeys); err != nil {
-		return fmt.Errorf("handleWorkloadUnboundServices %s failed: %v", workload.ResourceName(), err)
-	}
-
-	// Add new services associated with the workload
+	// 2~3. update workload in endpoint map and service map,
+	// add new services associated with the workload
+	_, newServices := p.compareWorkloadServices(workload)
 	if err := p.handleWorkloadNewBoundServices(workload, newServices); err != nil {
 		return fmt.Errorf("handleWorkloadNewBoundServices %s failed: %v", workload.ResourceName(), err)
 	}
@@ -551,6 +822,30 @@ func (p *Processor) handleWorkload(workload *workloadapi.Workload) error {
 	return nil
 }
 
+// hasValidAddress reports whether the workload has an ipv4 or ipv6 address
+func hasValidAddress(workload *workloadapi.Workload) bool {
+	for _, ip := range workload.GetAddresses() {
+		if len(ip) == net.IPv4len || len(ip) == net.IPv6len {
+			return true
+		}
+	}
+	return false
+}
+
+// unbindWorkloadServices removes the endpoints of the workload from the services it no longer belongs to.
+// The workload is compared as last updated, it is left as is if its update was deferred.
+func (p *Processor) unbindWorkloadServices(workload *workloadapi.Workload) error {
+	workload = p.WorkloadCache.GetWorkloadByUid(workload.GetUid())
+	if workload == nil {
+		return nil
+	}
+	unboundedEndpointKeys, _ := p.compareWorkloadServices(workload)
+	if err := p.handleWorkloadUnboundServices(workload, unboundedEndpointKeys); err != nil {
+		return fmt.Errorf("handleWorkloadUnboundServices %s failed: %v", workload.ResourceName(), err)
+	}
+	return nil
+}
+
 // compareWorkloadServices compares workload.Services with existing ones and return the unbounded EndpointKeys and new bound services IDs.
 func (p *Processor) compareWorkloadServices(workload *workloadapi.Workload) ([]bpf.EndpointKey, []uint32) {
 	workloadUid := p.hashName.Hash(workload.Uid)
@@ -580,6 +875,13 @@ func (p *Processor) updateServiceFrontendMap(serviceId uint32, service *workload
 	fv.UpstreamId = serviceId
 	for _, networkAddress := range service.GetAddresses() {
 		nets.CopyIpByteFromSlice(&fk.Ip, networkAddress.Address)
+		if p.isExcluded(networkAddress.Address) {
+			_ = p.bpf.FrontendDelete(&fk)
+			continue
+		}
+		if !p.claimServiceAddress(serviceId, service, networkAddress, &fk) {
+			continue
+		}
 		if err = p.bpf.FrontendUpdate(&fk, &fv); err != nil {
 			log.Errorf("frontend map update err:%s", err)
 			return err
@@ -588,6 +890,29 @@ func (p *Processor) updateServiceFrontendMap(serviceId uint32, service *workload
 	return nil
 }
 
+// claimServiceAddress tells whether the frontend of the address should route to the service. Two services
+// can transiently share an address, as when a service is recreated with the same ClusterIP before the old one
+// is removed: the newest one claiming the address keeps it, whatever order the updates are received in.
+func (p *Processor) claimServiceAddress(serviceId uint32, service *workloadapi.Service, address *workloadapi.NetworkAddress, fk *bpf.FrontendKey) bool {
+	networkAddr := cache.NetworkAddress{Network: address.GetNetwork()}
+	networkAddr.Address, _ = netip.AddrFromSlice(address.GetAddress())
+	if owner := p.ServiceCache.GetServiceByAddr(networkAddr); owner != nil && owner.ResourceName() != service.ResourceName() {
+		log.Debugf("address %s of service %s was claimed by the newer service %s", networkAddr.Address, service.ResourceName(), owner.ResourceName())
+		return false
+	}
+
+	fv := bpf.FrontendValue{}
+	if err := p.bpf.FrontendLookup(fk, &fv); err != nil || fv.UpstreamId == serviceId {
+		return true
+	}
+	if old := p.ServiceCache.GetService(p.hashName.NumToStr(fv.UpstreamId)); old != nil {
+		log.Warnf("address %s of service %s is still used by service %s, route it to %s",
+			networkAddr.Address, service.ResourceName(), old.ResourceName(), service.ResourceName())
+		telemetry.IncFrontendConflicts()
+	}
+	return true
+}
+
 func (p *Processor) updateEndpointOneByOne(serviceId uint32, epsUpdate []cache.Endpoint, toLLb bool) error {
 	if len(epsUpdate) == 0 {
 		return nil
@@ -681,6 +1006,13 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 
 	sk.ServiceId = p.hashName.Hash(serviceName)
 	newServiceInfo.LbPolicy = uint32(lb.GetMode()) // set loadbalance mode
+	newServiceInfo.FailedBackendRepicks, newServiceInfo.ConnectTimeout = p.getConnectPolicy(service)
+	newServiceInfo.IdleTimeout = p.getIdleTimeout(service)
+	newServiceInfo.MaxEndpointWeight = p.getMaxEndpointWeight(service)
+	newServiceInfo.OutlierConsecutiveErrors, newServiceInfo.OutlierEjectionTime = p.getOutlierDetection(service)
+	newServiceInfo.Dscp = p.getDscp(service)
+	newServiceInfo.LbAlgorithm = p.getLbAlgorithm(service)
+	newServiceInfo.Bandwidth = p.getBandwidth(service)
 
 	if waypoint != nil && waypoint.GetAddress() != nil {
 		nets.CopyIpByteFromSlice(&newServiceInfo.WaypointAddr, waypoint.GetAddress().Address)
@@ -694,7 +1026,7 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 		}
 
 		newServiceInfo.ServicePort[i] = nets.ConvertPortToBigEndian(port.ServicePort)
-		if strings.Contains(serviceName, "waypoint") {
+		if isWaypointService(service) {
 			newServiceInfo.TargetPort[i] = nets.ConvertPortToBigEndian(KmeshWaypointPort)
 		} else if port.TargetPort == 0 {
 			// NOTE: Target port could be unset in servicen entry, in which case it should
@@ -710,6 +1042,12 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 		// It is obtained by looking up the table rather than rebuilding the oldService
 		// Already exists, it means this is service update.
 		newServiceInfo.EndpointCount = oldServiceInfo.EndpointCount
+		newServiceInfo.PrioLoad = oldServiceInfo.PrioLoad
+		// the connections keep being charged to the bandwidth of the service
+		newServiceInfo.BandwidthThrottled = oldServiceInfo.BandwidthThrottled
+		newServiceInfo.BandwidthTatNs = oldServiceInfo.BandwidthTatNs
+		// the service stays unavailable until its healthy endpoints are counted again
+		newServiceInfo.Unavailable = oldServiceInfo.Unavailable
 		// if it is a policy update
 		if newServiceInfo.LbPolicy != oldServiceInfo.LbPolicy {
 			// transit from locality loadbalance to random
@@ -721,15 +1059,6 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 				if err = p.updateEndpointPriority(sk.ServiceId, false); err != nil { // this will change bpf map totally
 					return fmt.Errorf("update endpoint priority failed: %v", err)
 				}
-				updateServiceInfo := bpf.ServiceValue{}
-				if err = p.bpf.ServiceLookup(&sk, &updateServiceInfo); err != nil {
-					return fmt.Errorf("service map lookup %v failed: %v", sk.ServiceId, err)
-				}
-				updateServiceInfo.LbPolicy = newServiceInfo.LbPolicy
-				if err = p.bpf.ServiceUpdate(&sk, &updateServiceInfo); err != nil {
-					return fmt.Errorf("service map update failed: %v", err)
-				}
-				return nil
 			} else if oldServiceInfo.LbPolicy == uint32(workloadapi.LoadBalancing_UNSPECIFIED_MODE) {
 				// from random to locality loadbalance
 				// In random mode, the workloads are stored with the highest priority. When switching from random mode to locality
@@ -743,8 +1072,20 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 				if err = p.updateEndpointPriority(sk.ServiceId, true); err != nil {
 					return fmt.Errorf("update endpoint priority failed: %v", err)
 				}
-				return nil
 			}
+			// The endpoint counts have been changed by updating the endpoint priorities, the rest of the
+			// service value, such as the ports, is updated below together with the frontends.
+			updateServiceInfo := bpf.ServiceValue{}
+			if err = p.bpf.ServiceLookup(&sk, &updateServiceInfo); err != nil {
+				return fmt.Errorf("service map lookup %v failed: %v", sk.ServiceId, err)
+			}
+			newServiceInfo.EndpointCount = updateServiceInfo.EndpointCount
+			newServiceInfo.PrioLoad = updateServiceInfo.PrioLoad
+		}
+
+		// The ports are rewritten as a whole, so that connections to the removed ones stop being routed.
+		if stale := stalePorts(&oldServiceInfo, &newServiceInfo); len(stale) != 0 {
+			log.Infof("pruned stale ports %v of service %s", stale, serviceName)
 		}
 
 		// Compare the addresses of the old and new maps to avoid residual.
@@ -755,6 +1096,9 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 		if err := p.deleteFrontendByIp(removeServiceAddress); err != nil {
 			return fmt.Errorf("frontend map delete failed: %v", err)
 		}
+		if len(removeServiceAddress) != 0 {
+			log.Infof("pruned %d stale frontends of service %s", len(removeServiceAddress), serviceName)
+		}
 	}
 
 	// normal update
@@ -769,6 +1113,36 @@ func (p *Processor) updateServiceMap(service, oldService *workloadapi.Service) e
 	return nil
 }
 
+// isWaypointService reports whether the service is a waypoint. Besides the ones named after it, a gateway
+// exposing the HBONE and status ports is one too, such as the egress gateway the ServiceEntries use as
+// their waypoint, its connections go to the kmesh waypoint port as well.
+func isWaypointService(service *workloadapi.Service) bool {
+	if strings.Contains(service.ResourceName(), "waypoint") {
+		return true
+	}
+	var hbone, status bool
+	for _, port := range service.GetPorts() {
+		switch port.GetServicePort() {
+		case 15008:
+			hbone = true
+		case 15021:
+			status = true
+		}
+	}
+	return hbone && status
+}
+
+// stalePorts returns the service ports of old which are not in new
+func stalePorts(old, new *bpf.ServiceValue) []uint32 {
+	var stale []uint32
+	for _, port := range old.ServicePort {
+		if port != 0 && !slices.Contains(new.ServicePort[:], port) {
+			stale = append(stale, nets.ConvertPortToLittleEndian(port))
+		}
+	}
+	return stale
+}
+
 func (p *Processor) handleService(service *workloadapi.Service) error {
 	log.Debugf("handle service resource: %s", service.ResourceName())
 
@@ -793,6 +1167,14 @@ func (p *Processor) handleService(service *workloadapi.Service) error {
 		}
 	}
 
+	// the traffic distribution of the kubernetes service is resolved from both its spec and its annotation
+	p.applyTrafficDistribution(service)
+	// the services with no traffic distribution of their own get the default one
+	if p.localityDefault != nil && service.GetLoadBalancing().GetMode() == workloadapi.LoadBalancing_UNSPECIFIED_MODE &&
+		len(service.GetLoadBalancing().GetRoutingPreference()) == 0 {
+		service.LoadBalancing = proto.Clone(p.localityDefault).(*workloadapi.LoadBalancing)
+	}
+
 	if resolved := p.WaypointCache.AddOrUpdateService(service); !resolved {
 		// If the hostname type waypoint of service has not been resolved, it will not be processed
 		// for the time being. The corresponding waypoint service should be processed immediately, and then
@@ -808,6 +1190,8 @@ func (p *Processor) handleService(service *workloadapi.Service) error {
 		log.Errorf("update service %s maps failed: %v", service.ResourceName(), err)
 		return err
 	}
+	p.updateServiceMtls(service)
+	p.updateServiceConnectionLimit(service)
 
 	return nil
 }
@@ -833,41 +1217,68 @@ func (p *Processor) handleRemovedAddresses(removed []string) {
 	}
 }
 
-func (p *Processor) handleAddressTypeResponse(rsp *service_discovery_v3.DeltaDiscoveryResponse) error {
+// handleAddressTypeResponse returns the errors of the services and of the workloads which failed to be applied
+func (p *Processor) handleAddressTypeResponse(rsp *service_discovery_v3.DeltaDiscoveryResponse) (error, error) {
 	var err error
 	// sort resources, first process services, then workload
 	var services []*workloadapi.Service
 	var workloads []*workloadapi.Workload
+	received := sets.New[string]()
 	for _, resource := range rsp.GetResources() {
 		address := &workloadapi.Address{}
-		if err = anypb.UnmarshalTo(resource.Resource, address, proto.UnmarshalOptions{}); err != nil {
+		if e := anypb.UnmarshalTo(resource.Resource, address, proto.UnmarshalOptions{}); e != nil {
+			err = fmt.Errorf("unmarshal address %s failed: %v", resource.GetName(), e)
+			log.Error(err)
 			continue
 		}
 
 		switch address.GetType().(type) {
 		case *workloadapi.Address_Workload:
-			workloads = append(workloads, address.GetWorkload())
+			workload := address.GetWorkload()
+			received.Insert(workload.ResourceName())
+			// the workloads on the node are needed to handle their inbound traffic
+			if !p.isLoaded(workload.GetNamespace()) && workload.GetNode() != p.nodeName {
+				continue
+			}
+			workloads = append(workloads, workload)
 		case *workloadapi.Address_Service:
-			services = append(services, address.GetService())
+			service := address.GetService()
+			received.Insert(service.ResourceName())
+			if !p.isLoaded(service.GetNamespace()) {
+				continue
+			}
+			services = append(services, service)
 		default:
 			log.Errorf("unknown type, should not reach here")
 		}
 	}
 
-	p.handleServicesAndWorkloads(services, workloads)
+	serviceErr, workloadErr := p.handleServicesAndWorkloads(services, workloads)
 
 	p.handleRemovedAddresses(rsp.RemovedResources)
+	p.reconcileRestoredAddresses(received.InsertAll(rsp.RemovedResources...))
 	p.once.Do(p.handleRemovedAddressesDuringRestart)
-	return err
+	serviceCount, workloadCount := len(p.ServiceCache.List()), len(p.WorkloadCache.List())
+	telemetry.SetLoadedResources(serviceCount, workloadCount)
+	telemetry.SetXdsResources("service", serviceCount)
+	telemetry.SetXdsResources("workload", workloadCount)
+	// an address failing to be unmarshaled may be either a service or a workload
+	return errors.Join(err, serviceErr), errors.Join(err, workloadErr)
 }
 
 // Mainly for the convenience of testing.
-func (p *Processor) handleServicesAndWorkloads(services []*workloadapi.Service, workloads []*workloadapi.Workload) {
+// It returns the first errors of the services and of the workloads which failed to be applied.
+func (p *Processor) handleServicesAndWorkloads(services []*workloadapi.Service, workloads []*workloadapi.Workload) (error, error) {
+	var serviceErr, workloadErr error
 	var servicesToRefresh []*workloadapi.Service
+	// services whose endpoints may have changed, the prio load of them need to be recalculated
+	touchedServices := sets.New[string]()
 	for _, service := range services {
 		if err := p.handleService(service); err != nil {
 			log.Errorf("handle service %v failed, err: %v", service.ResourceName(), err)
+			serviceErr = cmp.Or(serviceErr, err)
 		}
+		touchedServices.Insert(service.ResourceName())
 		svcs, wls := p.WaypointCache.Refresh(service)
 		servicesToRefresh = append(servicesToRefresh, svcs...)
 		// Directly add deferred workload to workloads.
@@ -878,20 +1289,656 @@ func (p *Processor) handleServicesAndWorkloads(services []*workloadapi.Service,
 	for _, service := range servicesToRefresh {
 		if err := p.handleService(service); err != nil {
 			log.Errorf("handle deferred service %v failed, err: %v", service.ResourceName(), err)
+			serviceErr = cmp.Or(serviceErr, err)
+		}
+	}
+
+	// the workloads of the ServiceEntries with DNS resolution are replaced by the ones of the addresses
+	// their hostname resolved to
+	workloads, removedResolved := p.resolveHostnames(workloads)
+	// the services with thousands of endpoints are applied in batches, not to hold the lock for all of them
+	batchSize := cmp.Or(p.applyBatchSize, defaultApplyBatchSize)
+	for first := 0; first < len(workloads); first += batchSize {
+		if first > 0 && p.yieldApply != nil {
+			p.yieldApply()
+		}
+		start := time.Now()
+		for _, workload := range workloads[first:min(first+batchSize, len(workloads))] {
+			if !hasValidAddress(workload) {
+				// the pods scheduled but not yet assigned an ip are added once they are assigned one
+				log.Debugf("workload %s has no valid address yet, skip it", workload.ResourceName())
+				// and the one which lost its ip is removed, not to leave an endpoint without address behind
+				if p.WorkloadCache.GetWorkloadByUid(workload.GetUid()) != nil {
+					if err := p.removeWorkload(workload.GetUid()); err != nil {
+						log.Errorf("remove workload %s without address failed, err: %v", workload.ResourceName(), err)
+						workloadErr = cmp.Or(workloadErr, err)
+					}
+				}
+				continue
+			}
+
+			if old := p.WorkloadCache.GetWorkloadByUid(workload.GetUid()); old != nil {
+				for svcName := range old.GetServices() {
+					touchedServices.Insert(svcName)
+				}
+			}
+			if err := p.updateWorkload(workload); err != nil {
+				log.Errorf("handle workload %s failed, err: %v", workload.ResourceName(), err)
+				workloadErr = cmp.Or(workloadErr, err)
+			}
+			for svcName := range workload.GetServices() {
+				touchedServices.Insert(svcName)
+			}
 		}
+		telemetry.ObserveApplyBatch(start)
 	}
 
+	// The workloads are only removed from the services they no longer belong to once all of them
+	// are added to their new services, the endpoints of a service whose selector changed are
+	// switched from the old workloads to the new ones without ever leaving the service empty.
 	for _, workload := range workloads {
-		// TODO: Kmesh supports ServiceEntry
-		if workload.GetAddresses() == nil {
-			log.Warnf("workload: %s/%s addresses is nil", workload.Namespace, workload.Name)
+		if !hasValidAddress(workload) {
 			continue
 		}
-
-		if err := p.handleWorkload(workload); err != nil {
+		if err := p.unbindWorkloadServices(workload); err != nil {
 			log.Errorf("handle workload %s failed, err: %v", workload.ResourceName(), err)
+			workloadErr = cmp.Or(workloadErr, err)
+		}
+	}
+
+	p.handleRemovedAddresses(removedResolved)
+
+	for svcName := range touchedServices {
+		if err := p.updateServicePrioLoad(svcName); err != nil {
+			log.Errorf("update prio load of service %s failed: %v", svcName, err)
+			serviceErr = cmp.Or(serviceErr, err)
+		}
+		if err := p.updateServiceAvailability(svcName); err != nil {
+			log.Errorf("update availability of service %s failed: %v", svcName, err)
+			serviceErr = cmp.Or(serviceErr, err)
+		}
+	}
+	return serviceErr, workloadErr
+}
+
+// yieldLock releases the lock held while a xds response is applied, for the service annotation updates and
+// the slow start waiting for it to get it before the next batch. They are not interrupted themselves.
+func (p *Processor) yieldLock() {
+	yield := p.yieldApply
+	p.yieldApply = nil
+	p.mutex.Unlock()
+	runtime.Gosched()
+	p.mutex.Lock()
+	p.yieldApply = yield
+}
+
+// resolveHostnames replaces the workloads with a hostname by the ones of the addresses it resolved to,
+// it also returns the uids of the workloads of the addresses their previous hostname resolved to
+func (p *Processor) resolveHostnames(workloads []*workloadapi.Workload) ([]*workloadapi.Workload, []string) {
+	if p.dns == nil {
+		return workloads, nil
+	}
+
+	var removed []string
+	resolved := make([]*workloadapi.Workload, 0, len(workloads))
+	for _, workload := range workloads {
+		if workload.GetAddresses() != nil || workload.GetHostname() == "" {
+			resolved = append(resolved, workload)
+			continue
+		}
+		wls, uids := p.dns.watch(workload)
+		resolved = append(resolved, wls...)
+		removed = append(removed, uids...)
+	}
+	return resolved, removed
+}
+
+// handleResolvedHostname updates the workloads of the addresses the hostname resolved to
+func (p *Processor) handleResolvedHostname(hostname string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	workloads, removed := p.dns.refresh(hostname)
+	if len(workloads) == 0 && len(removed) == 0 {
+		return
+	}
+	log.Debugf("hostname %s resolved again, update %d workloads and remove %d", hostname, len(workloads), len(removed))
+	p.handleServicesAndWorkloads(nil, workloads)
+	p.handleRemovedAddresses(removed)
+}
+
+// HandleServiceAnnotationUpdate applies the changed kmesh.net/ annotations of a kubernetes service
+func (p *Processor) HandleServiceAnnotationUpdate(namespace, name string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, svc := range p.ServiceCache.List() {
+		if svc.GetNamespace() != namespace || svc.GetName() != name {
+			continue
+		}
+		if err := p.updateServicePrioLoad(svc.ResourceName()); err != nil {
+			log.Errorf("update prio load of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceAvailability(svc.ResourceName()); err != nil {
+			log.Errorf("update availability of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceConnectPolicy(svc); err != nil {
+			log.Errorf("update connect policy of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceIdleTimeout(svc); err != nil {
+			log.Errorf("update idle timeout of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceEndpointWeights(svc); err != nil {
+			log.Errorf("update endpoint weights of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceOutlierDetection(svc); err != nil {
+			log.Errorf("update outlier detection of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceDscp(svc); err != nil {
+			log.Errorf("update dscp of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceLbAlgorithm(svc); err != nil {
+			log.Errorf("update load balancer of service %s failed: %v", svc.ResourceName(), err)
+		}
+		if err := p.updateServiceBandwidth(svc); err != nil {
+			log.Errorf("update bandwidth of service %s failed: %v", svc.ResourceName(), err)
+		}
+		p.updateServiceMtls(svc)
+		p.updateServiceConnectionLimit(svc)
+	}
+}
+
+// getConnectPolicy returns the kmesh.net/failed-backend-repicks count and the
+// kmesh.net/connect-timeout in milliseconds of the service, 0 if unset
+func (p *Processor) getConnectPolicy(service *workloadapi.Service) (uint32, uint32) {
+	var repicks, timeout uint32
+
+	if value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.FailedBackendRepicksAnnotation); ok {
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || n > bpf.MaxBackendRepicks {
+			log.Warnf("invalid %s annotation %q on service %s, should be an integer between 0 and %d",
+				constants.FailedBackendRepicksAnnotation, value, service.ResourceName(), bpf.MaxBackendRepicks)
+		} else {
+			repicks = uint32(n)
+		}
+	}
+
+	if value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.ConnectTimeoutAnnotation); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Millisecond || d > time.Hour {
+			log.Warnf("invalid %s annotation %q on service %s, should be a duration between 1ms and 1h",
+				constants.ConnectTimeoutAnnotation, value, service.ResourceName())
+		} else {
+			timeout = uint32(d.Milliseconds())
 		}
 	}
+
+	return repicks, timeout
+}
+
+// updateServiceConnectPolicy applies the failed backend repicks and connect timeout of the service to the service map
+func (p *Processor) updateServiceConnectPolicy(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	repicks, timeout := p.getConnectPolicy(service)
+	if sv.FailedBackendRepicks == repicks && sv.ConnectTimeout == timeout {
+		return nil
+	}
+	sv.FailedBackendRepicks, sv.ConnectTimeout = repicks, timeout
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getIdleTimeout returns the kmesh.net/idle-timeout of the service in milliseconds, 0 if unset
+func (p *Processor) getIdleTimeout(service *workloadapi.Service) uint32 {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.IdleTimeoutAnnotation)
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < time.Second || d > 24*time.Hour {
+		log.Warnf("invalid %s annotation %q on service %s, should be a duration between 1s and 24h",
+			constants.IdleTimeoutAnnotation, value, service.ResourceName())
+		return 0
+	}
+	return uint32(d.Milliseconds())
+}
+
+// updateServiceIdleTimeout applies the idle timeout of the service to the service map,
+// only the connections established afterwards are affected
+func (p *Processor) updateServiceIdleTimeout(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	timeout := p.getIdleTimeout(service)
+	if sv.IdleTimeout == timeout {
+		return nil
+	}
+	sv.IdleTimeout = timeout
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getDscp returns the kmesh.net/dscp of the service, 0 if unset
+func (p *Processor) getDscp(service *workloadapi.Service) uint32 {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.DscpAnnotation)
+	if !ok {
+		return 0
+	}
+	dscp, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || dscp > bpf.MaxDscp {
+		log.Warnf("invalid %s annotation %q on service %s, should be an integer between 0 and %d",
+			constants.DscpAnnotation, value, service.ResourceName(), bpf.MaxDscp)
+		return 0
+	}
+	return uint32(dscp)
+}
+
+// updateServiceDscp applies the DSCP of the service to the service map,
+// only the connections established afterwards are marked
+func (p *Processor) updateServiceDscp(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	dscp := p.getDscp(service)
+	if sv.Dscp == dscp {
+		return nil
+	}
+	sv.Dscp = dscp
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// lbAlgorithms maps the values of the kmesh.net/load-balancer annotation to the algorithms of the data plane,
+// LEAST_REQUEST is accepted for the DestinationRules written for envoy
+var lbAlgorithms = map[string]uint32{
+	"RANDOM":        bpf.LbAlgorithmRandom,
+	"ROUND_ROBIN":   bpf.LbAlgorithmRoundRobin,
+	"LEAST_CONN":    bpf.LbAlgorithmLeastConn,
+	"LEAST_REQUEST": bpf.LbAlgorithmLeastConn,
+	"RING_HASH":     bpf.LbAlgorithmRingHash,
+}
+
+// getLbAlgorithm returns the algorithm of the kmesh.net/load-balancer of the service, random if unset
+func (p *Processor) getLbAlgorithm(service *workloadapi.Service) uint32 {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.LoadBalancerAnnotation)
+	if !ok {
+		return bpf.LbAlgorithmRandom
+	}
+	algorithm, ok := lbAlgorithms[strings.ToUpper(strings.TrimSpace(value))]
+	if !ok {
+		log.Warnf("invalid %s annotation %q on service %s, should be one of RANDOM, ROUND_ROBIN, LEAST_CONN and RING_HASH",
+			constants.LoadBalancerAnnotation, value, service.ResourceName())
+		return bpf.LbAlgorithmRandom
+	}
+	return algorithm
+}
+
+// updateServiceLbAlgorithm applies the load balancing algorithm of the service to the service map,
+// only the connections established afterwards pick their endpoint with it
+func (p *Processor) updateServiceLbAlgorithm(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	algorithm := p.getLbAlgorithm(service)
+	if sv.LbAlgorithm == algorithm {
+		return nil
+	}
+	sv.LbAlgorithm = algorithm
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getEndpointWeights returns the weight of each version set by the kmesh.net/endpoint-weights
+// annotation of the service like v1=1,v2=3 and the largest one, 0 if unset
+func (p *Processor) getEndpointWeights(service *workloadapi.Service) (map[string]uint32, uint32) {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.EndpointWeightsAnnotation)
+	if !ok {
+		return nil, 0
+	}
+
+	// the versions not listed weigh 1
+	weights := make(map[string]uint32)
+	maxWeight := uint32(1)
+	for _, item := range strings.Split(value, ",") {
+		version, weight, found := strings.Cut(strings.TrimSpace(item), "=")
+		n, err := strconv.ParseUint(weight, 10, 32)
+		if !found || version == "" || err != nil || n == 0 || n > bpf.MaxEndpointWeight {
+			log.Warnf("invalid %s annotation %q on service %s, should be like v1=1,v2=3 with weights between 1 and %d",
+				constants.EndpointWeightsAnnotation, value, service.ResourceName(), bpf.MaxEndpointWeight)
+			return nil, 0
+		}
+		weights[version] = uint32(n)
+		maxWeight = max(maxWeight, uint32(n))
+	}
+	return weights, maxWeight
+}
+
+// getMaxEndpointWeight returns the largest weight of the endpoints of the service, the weights
+// are scaled up to MaxEndpointWeight with a slow start window so that they can ramp up
+func (p *Processor) getMaxEndpointWeight(service *workloadapi.Service) uint32 {
+	_, maxWeight := p.getEndpointWeights(service)
+	if p.getSlowStartWindow(service) == 0 {
+		return maxWeight
+	}
+	maxWeight = max(maxWeight, 1)
+	return maxWeight * (bpf.MaxEndpointWeight / maxWeight)
+}
+
+// getEndpointWeight returns the weight of the workload among the endpoints of the service,
+// according to its version and its slow start
+func (p *Processor) getEndpointWeight(serviceId, workloadId uint32) uint32 {
+	service := p.ServiceCache.GetService(p.hashName.NumToStr(serviceId))
+	workload := p.WorkloadCache.GetWorkloadByUid(p.hashName.NumToStr(workloadId))
+	if service == nil || workload == nil {
+		return 1
+	}
+	weights, maxWeight := p.getEndpointWeights(service)
+	weight, ok := weights[workload.GetCanonicalRevision()]
+	if !ok {
+		weight = 1
+	}
+	window := p.getSlowStartWindow(service)
+	if window == 0 {
+		return weight
+	}
+	weight *= bpf.MaxEndpointWeight / max(maxWeight, 1)
+	return max(1, weight*p.slowStart.percent(serviceId, workloadId, window)/100)
+}
+
+// updateServiceEndpointWeights applies the kmesh.net/endpoint-weights and the slow start of the service to its endpoints
+func (p *Processor) updateServiceEndpointWeights(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	for workloadId, ep := range p.EndpointCache.List(sk.ServiceId) {
+		ek := bpf.EndpointKey{ServiceId: ep.ServiceId, Prio: ep.Prio, BackendIndex: ep.BackendIndex}
+		ev := bpf.EndpointValue{}
+		if err := p.bpf.EndpointLookup(&ek, &ev); err != nil {
+			return fmt.Errorf("lookup endpoint %#v failed: %v", ek, err)
+		}
+		weight := p.getEndpointWeight(sk.ServiceId, workloadId)
+		if ev.Weight == weight {
+			continue
+		}
+		ev.Weight = weight
+		if err := p.bpf.EndpointUpdate(&ek, &ev); err != nil {
+			return fmt.Errorf("update endpoint %#v failed: %v", ek, err)
+		}
+	}
+
+	maxWeight := p.getMaxEndpointWeight(service)
+	if sv.MaxEndpointWeight == maxWeight {
+		return nil
+	}
+	sv.MaxEndpointWeight = maxWeight
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getOutlierDetection returns the consecutive connect failures which eject a backend and the ejection
+// time in milliseconds set by the kmesh.net/outlier-detection annotation of the service, 0 if unset
+func (p *Processor) getOutlierDetection(service *workloadapi.Service) (uint32, uint32) {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.OutlierDetectionAnnotation)
+	if !ok {
+		return 0, 0
+	}
+
+	invalid := func() (uint32, uint32) {
+		log.Warnf("invalid %s annotation %q on service %s, should be like consecutiveErrors=5,baseEjectionTime=30s "+
+			"with consecutiveErrors between 1 and %d and baseEjectionTime between 1s and 1h",
+			constants.OutlierDetectionAnnotation, value, service.ResourceName(), bpf.MaxOutlierConsecutiveErrors)
+		return 0, 0
+	}
+
+	// the defaults of the outlier detection of a DestinationRule
+	consecutiveErrors, ejectionTime := uint64(5), 30*time.Second
+	for _, item := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			return invalid()
+		}
+		var err error
+		switch key {
+		case "consecutiveErrors":
+			consecutiveErrors, err = strconv.ParseUint(val, 10, 32)
+			if err != nil || consecutiveErrors == 0 || consecutiveErrors > bpf.MaxOutlierConsecutiveErrors {
+				return invalid()
+			}
+		case "baseEjectionTime":
+			ejectionTime, err = time.ParseDuration(val)
+			if err != nil || ejectionTime < time.Second || ejectionTime > time.Hour {
+				return invalid()
+			}
+		default:
+			return invalid()
+		}
+	}
+	return uint32(consecutiveErrors), uint32(ejectionTime.Milliseconds())
+}
+
+// updateServiceOutlierDetection applies the outlier detection of the service to the service map
+func (p *Processor) updateServiceOutlierDetection(service *workloadapi.Service) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	sk.ServiceId = p.hashName.Hash(service.ResourceName())
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	consecutiveErrors, ejectionTime := p.getOutlierDetection(service)
+	if sv.OutlierConsecutiveErrors == consecutiveErrors && sv.OutlierEjectionTime == ejectionTime {
+		return nil
+	}
+	sv.OutlierConsecutiveErrors, sv.OutlierEjectionTime = consecutiveErrors, ejectionTime
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getLocalityMinHealthy returns the kmesh.net/locality-min-healthy percent of the service, 0 if unset
+func (p *Processor) getLocalityMinHealthy(service *workloadapi.Service) uint32 {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.LocalityMinHealthyAnnotation)
+	if !ok {
+		return 0
+	}
+	minHealthy, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || minHealthy > 100 {
+		log.Warnf("invalid %s annotation %q on service %s, should be a percent between 0 and 100",
+			constants.LocalityMinHealthyAnnotation, value, service.ResourceName())
+		return 0
+	}
+	return uint32(minHealthy)
+}
+
+// getLocalityWeights returns the kmesh.net/locality-weights of the service by priority, all zeros if unset
+func (p *Processor) getLocalityWeights(service *workloadapi.Service) [bpf.PrioCount]uint32 {
+	var weights [bpf.PrioCount]uint32
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.LocalityWeightsAnnotation)
+	if !ok {
+		return weights
+	}
+	rp := service.GetLoadBalancing().GetRoutingPreference()
+	for _, entry := range strings.Split(value, ",") {
+		name, weight, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		prio, known := localityTierPrio(rp, strings.TrimSpace(name))
+		w, err := strconv.ParseUint(strings.TrimSpace(weight), 10, 32)
+		if !known || err != nil || w > 100 {
+			log.Warnf("invalid %s annotation %q on service %s, should be tier=weight pairs with weights between 0 and 100, "+
+				"the tiers being local, remote or a scope of its routing preference", constants.LocalityWeightsAnnotation, value, service.ResourceName())
+			return [bpf.PrioCount]uint32{}
+		}
+		weights[prio] = uint32(w)
+	}
+	return weights
+}
+
+// localityTierPrio returns the priority of the locality tier named like in the accesslog: local for the
+// endpoints sharing all the scopes of the routing preference with the client, then the scope shared
+// last, remote for the ones sharing none
+func localityTierPrio(rp []workloadapi.LoadBalancing_Scope, name string) (uint32, bool) {
+	switch name {
+	case "local":
+		return 0, true
+	case "remote":
+		return uint32(len(rp)), true
+	}
+	for i, scope := range rp {
+		if strings.ToLower(scope.String()) == name {
+			return uint32(len(rp) - 1 - i), true
+		}
+	}
+	return 0, false
+}
+
+// updateServicePrioLoad recalculates how the traffic of a locality failover service is
+// spread over the priorities, based on its healthy endpoints and kmesh.net/locality-weights
+// or kmesh.net/locality-min-healthy.
+func (p *Processor) updateServicePrioLoad(serviceName string) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	service := p.ServiceCache.GetService(serviceName)
+	if service == nil {
+		return nil
+	}
+	sk.ServiceId = p.hashName.Hash(serviceName)
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	var load [bpf.PrioCount]uint32
+	weights := p.getLocalityWeights(service)
+	minHealthy := p.getLocalityMinHealthy(service)
+	failover := sv.LbPolicy == uint32(workloadapi.LoadBalancing_FAILOVER) && p.locality.LocalityInfo != nil
+	switch {
+	case failover && weights != [bpf.PrioCount]uint32{}:
+		// the weights take precedence over the minimum healthy percent
+		load = bpf.CalcLocalityWeightedPrioLoad(sv.EndpointCount, weights)
+	case failover && minHealthy > 0:
+		// healthy endpoints are the ones stored in the endpoint map, unhealthy ones only exist in the cache
+		total := sv.EndpointCount
+		for _, wl := range p.WorkloadCache.ListByService(serviceName) {
+			if wl.GetStatus() != workloadapi.WorkloadStatus_UNHEALTHY || wl.GetAddresses() == nil {
+				continue
+			}
+			total[p.locality.CalcLocalityLBPrio(wl, service.GetLoadBalancing().GetRoutingPreference())]++
+		}
+		load = bpf.CalcLocalityLBPrioLoad(sv.EndpointCount, total, minHealthy)
+	}
+
+	if load == sv.PrioLoad {
+		return nil
+	}
+	log.Debugf("service %s prio load updated to %v", serviceName, load)
+	sv.PrioLoad = load
+	return p.bpf.ServiceUpdate(&sk, &sv)
+}
+
+// getMinHealthyEndpoints returns the kmesh.net/min-healthy-endpoints of the service, 0 if unset
+func (p *Processor) getMinHealthyEndpoints(service *workloadapi.Service) uint32 {
+	value, ok := p.ServiceAnnotationCache.GetAnnotation(service.GetNamespace(), service.GetName(), constants.MinHealthyEndpointsAnnotation)
+	if !ok {
+		return 0
+	}
+	minHealthy, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		log.Warnf("invalid %s annotation %q on service %s, should be a number of endpoints",
+			constants.MinHealthyEndpointsAnnotation, value, service.ResourceName())
+		return 0
+	}
+	return uint32(minHealthy)
+}
+
+// updateServiceAvailability aggregates the health of the endpoints of a service, it is marked
+// unavailable while fewer of them are healthy than its kmesh.net/min-healthy-endpoints.
+func (p *Processor) updateServiceAvailability(serviceName string) error {
+	var (
+		sk = bpf.ServiceKey{}
+		sv = bpf.ServiceValue{}
+	)
+
+	service := p.ServiceCache.GetService(serviceName)
+	if service == nil {
+		return nil
+	}
+	sk.ServiceId = p.hashName.Hash(serviceName)
+	if err := p.bpf.ServiceLookup(&sk, &sv); err != nil {
+		return nil
+	}
+
+	minHealthy := p.getMinHealthyEndpoints(service)
+	if minHealthy == 0 {
+		telemetry.DeleteServiceHealth(service.GetNamespace(), service.GetHostname())
+		if sv.Unavailable == 0 {
+			return nil
+		}
+		log.Infof("service %s has no minimum of healthy endpoints anymore, it is available", serviceName)
+		sv.Unavailable = 0
+		return p.bpf.ServiceUpdate(&sk, &sv)
+	}
+
+	// healthy endpoints are the ones stored in the endpoint map, unhealthy ones only exist in the cache
+	var healthy uint32
+	for _, count := range sv.EndpointCount {
+		healthy += count
+	}
+	total := healthy
+	for _, wl := range p.WorkloadCache.ListByService(serviceName) {
+		if wl.GetStatus() == workloadapi.WorkloadStatus_UNHEALTHY && wl.GetAddresses() != nil {
+			total++
+		}
+	}
+	var unavailable uint32
+	if healthy < minHealthy {
+		unavailable = 1
+	}
+	telemetry.SetServiceHealth(service.GetNamespace(), service.GetHostname(), healthy, total, unavailable == 1)
+
+	if unavailable == sv.Unavailable {
+		return nil
+	}
+	if unavailable == 1 {
+		log.Warnf("service %s has %d of %d endpoints healthy, fewer than %d, it is unavailable", serviceName, healthy, total, minHealthy)
+	} else {
+		log.Infof("service %s has %d of %d endpoints healthy, it is available again", serviceName, healthy, total)
+	}
+	sv.Unavailable = unavailable
+	return p.bpf.ServiceUpdate(&sk, &sv)
 }
 
 // After restart, we can get the removed addresses by comparing the
@@ -905,7 +1952,7 @@ func (p *Processor) handleRemovedAddressesDuringRestart() {
 		sv = bpf.ServiceValue{}
 	)
 
-	if kmeshbpf.GetStartType() != kmeshbpf.Restart {
+	if !kmeshbpf.ReusePinned() {
 		return
 	}
 
@@ -940,36 +1987,67 @@ func (p *Processor) handleAuthorizationTypeResponse(rsp *service_discovery_v3.De
 	if rbac == nil {
 		return fmt.Errorf("Rbac module uninitialized")
 	}
-	// update resource
+	// the policies of the response are the next generation, translated before any of them is applied
+	var updated []*security.Authorization
+	received := sets.New[string]()
 	for _, resource := range rsp.GetResources() {
 		authPolicy := &security.Authorization{}
 		if err := anypb.UnmarshalTo(resource.Resource, authPolicy, proto.UnmarshalOptions{}); err != nil {
 			log.Errorf("unmarshal failed, err: %v", err)
 			continue
 		}
+		received.Insert(authPolicy.ResourceName())
 		log.Debugf("handle authorization policy %s, auth %s", resource.GetName(), authPolicy.String())
-		if err := rbac.UpdatePolicy(authPolicy); err != nil {
-			return err
+		updated = append(updated, authPolicy)
+	}
+	removed := rsp.GetRemovedResources()
+
+	// the policies of a response are swapped in userspace as a whole, the xdp authz would see the bpf maps
+	// written one policy after another so the new connections are authorized in userspace meanwhile
+	changed := len(updated)+len(removed) > 0
+	if changed && p.authzHandoff != nil {
+		if err := p.authzHandoff(true); err != nil {
+			log.Errorf("failed to hand the authorization over to userspace: %v", err)
+		} else {
+			defer func() {
+				if err := p.authzHandoff(false); err != nil {
+					log.Errorf("failed to hand the authorization back to xdp: %v", err)
+				}
+			}()
 		}
+	}
+	if err := rbac.UpdatePolicies(updated, removed); err != nil {
+		return err
+	}
+	if changed {
+		log.Debugf("swapped %d updated and %d removed authorization policies at once", len(updated), len(removed))
+		telemetry.IncAuthzPolicySwap()
+	}
 
+	// update resource
+	for _, authPolicy := range updated {
 		policyKey := authPolicy.ResourceName()
 		if err := maps_v2.AuthorizationUpdate(p.hashName.Hash(policyKey), authPolicy); err != nil {
 			return fmt.Errorf("AuthorizationUpdate %s failed %v ", policyKey, err)
 		}
+		if authPolicy.GetAction() == security.Action_DENY {
+			p.establishedEnforcer.trigger()
+		}
 	}
 
 	// delete resource by name
-	for _, resourceName := range rsp.GetRemovedResources() {
-		rbac.RemovePolicy(resourceName)
+	for _, resourceName := range removed {
 		if err := maps_v2.AuthorizationDelete(p.hashName.Hash(resourceName)); err != nil {
 			log.Errorf("remove authorization policy %s failed :%v", resourceName, err)
 		}
 		log.Debugf("remove authorization policy %s", resourceName)
 	}
 
+	p.reconcileRestoredPolicies(received.InsertAll(removed...), rbac)
 	p.authzOnce.Do(func() {
 		p.handleRemovedAuthzPolicyDuringRestart(rbac)
 	})
+	telemetry.SetXdsResources("authorization", len(rbac.PoliciesList()))
 	return nil
 }
 
@@ -990,6 +2068,17 @@ func (p *Processor) handleRemovedAuthzPolicyDuringRestart(rbac *auth.Rbac) {
 	policyCache := rbac.GetAllPolicies()
 	for str, num := range p.hashName.GetStrToNum() {
 		if _, exists := policyCache[str]; !exists {
+			if p.namespaceIsolation && auth.IsNamespaceIsolationPolicy(str) {
+				continue
+			}
+			// kept up to date by the NetworkPolicy controller
+			if auth.IsNetworkPolicy(str) {
+				continue
+			}
+			// kept up to date with the kmesh.net/mtls annotations of the services
+			if auth.IsMtlsDenyNonMeshPolicy(str) {
+				continue
+			}
 			if err := maps_v2.AuthorizationLookup(num, &policyValue); err == nil {
 				log.Debugf("Find policy: [%v:%v] Remove authz policy", str, num)
 				if err := maps_v2.AuthorizationDelete(num); err != nil {
@@ -1082,15 +2171,44 @@ func (p *Processor) deleteEndpoint(ek bpf.EndpointKey, ev bpf.EndpointValue, sv
 	return nil
 }
 
-func (p *Processor) storeWorkloadPolicies(uid string, polices []string) {
+// storeWorkloadPolicies stores the policies selecting the workload for the xdp authz, the control plane
+// resolves the workload selectors of the policies into the policies of the workloads
+func (p *Processor) storeWorkloadPolicies(workload *workloadapi.Workload) {
 	var (
-		key   = bpf.WorkloadPolicyKey{}
-		value = bpf.WorkloadPolicyValue{}
+		key     = bpf.WorkloadPolicyKey{}
+		value   = bpf.WorkloadPolicyValue{}
+		uid     = workload.GetUid()
+		polices = workload.GetAuthorizationPolicies()
 	)
-	if len(polices) == 0 {
-		return
+	// the DENY policy translated from NetworkPolicies before the ones from xds, and the ALLOW one after
+	for _, policy := range p.networkPolicies[workload.GetNamespace()+"/"+workload.GetName()] {
+		if policy.GetAction() == security.Action_DENY {
+			polices = append([]string{policy.ResourceName()}, polices...)
+		} else {
+			polices = append(slices.Clone(polices), policy.ResourceName())
+		}
+	}
+	// the DENY policies of the services in DENY_NON_MESH mtls mode first, the connections from outside the mesh
+	// are denied whatever the other policies
+	for serviceKey := range workload.GetServices() {
+		if policy, ok := p.mtlsPolicies[serviceKey]; ok {
+			polices = append([]string{policy.ResourceName()}, polices...)
+		}
+	}
+	if p.namespaceIsolation {
+		// first so that it is never left out of PolicyIds
+		polices = append([]string{p.storeNamespaceIsolationPolicy(workload.GetNamespace())}, polices...)
 	}
 	key.WorklodId = p.hashName.Hash(uid)
+	value.AuthzOffload = p.podAuthzOffload[workload.GetNamespace()+"/"+workload.GetName()]
+	if p.tracedWorkloads[uid] > 0 {
+		// kept without policies too, the verdicts are only reported by the userspace authz
+		value.AuthzOffload = bpf.AuthzOffloadDisabled
+	} else if len(polices) == 0 {
+		// the workload is no longer selected by any policy
+		p.deleteWorkloadPolicies(key.WorklodId)
+		return
+	}
 	for i, v := range polices {
 		if i < len(value.PolicyIds) {
 			value.PolicyIds[i] = p.hashName.Hash(v)
@@ -1105,6 +2223,22 @@ func (p *Processor) storeWorkloadPolicies(uid string, polices []string) {
 	}
 }
 
+// storeNamespaceIsolationPolicy stores the namespace isolation policy of the namespace for the xdp authz
+// if it is not yet, and returns its key
+func (p *Processor) storeNamespaceIsolationPolicy(namespace string) string {
+	policy := auth.NamespaceIsolationPolicy(namespace)
+	policyKey := policy.ResourceName()
+	if p.isolatedNamespaces.Contains(namespace) {
+		return policyKey
+	}
+	if err := maps_v2.AuthorizationUpdate(p.hashName.Hash(policyKey), policy); err != nil {
+		log.Errorf("AuthorizationUpdate %s failed %v", policyKey, err)
+		return policyKey
+	}
+	p.isolatedNamespaces.Insert(namespace)
+	return policyKey
+}
+
 func (p *Processor) deleteWorkloadPolicies(uid uint32) {
 	key := bpf.WorkloadPolicyKey{
 		WorklodId: uid,
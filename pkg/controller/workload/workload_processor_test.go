@@ -17,9 +17,12 @@
 package workload
 
 import (
+	"fmt"
 	"net/netip"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	service_discovery_v3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	"github.com/stretchr/testify/assert"
@@ -30,6 +33,7 @@ import (
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/daemon/options"
+	"kmesh.net/kmesh/pkg/auth"
 	"kmesh.net/kmesh/pkg/bpf/restart"
 	"kmesh.net/kmesh/pkg/constants"
 	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
@@ -494,8 +498,9 @@ func TestRestart(t *testing.T) {
 		})
 	}
 
-	err := p.handleAddressTypeResponse(res)
-	assert.NoError(t, err)
+	serviceErr, workloadErr := p.handleAddressTypeResponse(res)
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
 
 	// check front end map
 	for _, wl := range []*workloadapi.Workload{wl1, wl2, wl3} {
@@ -571,8 +576,9 @@ func TestRestart(t *testing.T) {
 		})
 	}
 
-	err = p.handleAddressTypeResponse(res)
-	assert.NoError(t, err)
+	serviceErr, workloadErr = p.handleAddressTypeResponse(res)
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
 
 	// check front end map
 	t.Log("2. check front end map")
@@ -679,8 +685,9 @@ func TestLBPolicyUpdate(t *testing.T) {
 		})
 	}
 
-	err := p.handleAddressTypeResponse(res1)
-	assert.NoError(t, err)
+	serviceErr, workloadErr := p.handleAddressTypeResponse(res1)
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
 
 	// check front end map
 	for _, wl := range []*workloadapi.Workload{wl1, wl2, wl3, wl4} {
@@ -716,8 +723,9 @@ func TestLBPolicyUpdate(t *testing.T) {
 		Resource: protoconv.MessageToAny(addr),
 	})
 
-	err = p.handleAddressTypeResponse(res2)
-	assert.NoError(t, err)
+	serviceErr, workloadErr = p.handleAddressTypeResponse(res2)
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
 
 	assert.Equal(t, 5, p.bpf.FrontendCount())
 	// check service map
@@ -738,8 +746,9 @@ func TestLBPolicyUpdate(t *testing.T) {
 		Resource: protoconv.MessageToAny(addr),
 	})
 
-	err = p.handleAddressTypeResponse(res3)
-	assert.NoError(t, err)
+	serviceErr, workloadErr = p.handleAddressTypeResponse(res3)
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
 
 	assert.Equal(t, 5, p.bpf.FrontendCount())
 	// check service map
@@ -757,6 +766,1270 @@ func TestLBPolicyUpdate(t *testing.T) {
 	hashNameClean(p)
 }
 
+func TestLocalityMinHealthyPartialOverflow(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.LocalityMinHealthyAnnotation: "80"})
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, localityLBScope))
+	svcId := p.hashName.Hash(svc.ResourceName())
+
+	// 4 local endpoints with prio 0, 2 remote endpoints with prio 1
+	var local, remote []*workloadapi.Workload
+	for i := 1; i <= 4; i++ {
+		local = append(local, createWorkload(fmt.Sprintf("local%d", i), fmt.Sprintf("10.244.0.%d", i), os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1"))
+	}
+	for i := 1; i <= 2; i++ {
+		remote = append(remote, createWorkload(fmt.Sprintf("remote%d", i), fmt.Sprintf("10.244.1.%d", i), "other", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s2"), "svc1"))
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, append(local, remote...))
+
+	checkPrioLoad := func(count, load [bpfcache.PrioCount]uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, count, sv.EndpointCount)
+		assert.Equal(t, load, sv.PrioLoad)
+	}
+
+	// all local endpoints are healthy, keep all traffic local
+	checkPrioLoad([bpfcache.PrioCount]uint32{4, 2}, [bpfcache.PrioCount]uint32{100})
+
+	// mark half of the local endpoints unready, part of the traffic spills over to prio 1
+	unhealthy := []*workloadapi.Workload{proto.Clone(local[0]).(*workloadapi.Workload), proto.Clone(local[1]).(*workloadapi.Workload)}
+	for _, wl := range unhealthy {
+		wl.Status = workloadapi.WorkloadStatus_UNHEALTHY
+	}
+	p.handleServicesAndWorkloads(nil, unhealthy)
+	checkPrioLoad([bpfcache.PrioCount]uint32{2, 2}, [bpfcache.PrioCount]uint32{62, 38})
+
+	// the unready endpoints are gone, the remaining local ones are all healthy again
+	p.handleRemovedAddresses([]string{unhealthy[0].ResourceName(), unhealthy[1].ResourceName()})
+	checkPrioLoad([bpfcache.PrioCount]uint32{2, 2}, [bpfcache.PrioCount]uint32{100})
+
+	// one unready endpoint comes back
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{unhealthy[0]})
+	checkPrioLoad([bpfcache.PrioCount]uint32{2, 2}, [bpfcache.PrioCount]uint32{83, 17})
+
+	// annotation removed, back to plain failover
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkPrioLoad([bpfcache.PrioCount]uint32{2, 2}, [bpfcache.PrioCount]uint32{})
+
+	hashNameClean(p)
+}
+
+// pickPrio returns the priority a connection is routed to, like lb_locality_failover_handle of the data plane
+func pickPrio(load, count [bpfcache.PrioCount]uint32, randK uint32) int {
+	start := 0
+	var acc uint32
+	for i := 0; i < bpfcache.PrioCount; i++ {
+		acc += load[i]
+		if randK < acc && count[i] > 0 {
+			start = i
+			break
+		}
+	}
+	for i := start; i < bpfcache.PrioCount; i++ {
+		if count[i] > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestLocalityWeights(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.LocalityWeightsAnnotation: "local=60, zone=30, region=10"})
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, localityLBScope))
+	svcId := p.hashName.Hash(svc.ResourceName())
+
+	// 2 endpoints in each of the local subzone, the zone and the region
+	var workloads []*workloadapi.Workload
+	for i, locality := range []*workloadapi.Locality{createLocality("r1", "z1", "s1"), createLocality("r1", "z1", "s2"), createLocality("r1", "z2", "s3")} {
+		for j := 1; j <= 2; j++ {
+			node := "other"
+			if i == 0 {
+				node = os.Getenv("NODE_NAME")
+			}
+			workloads = append(workloads, createWorkload(fmt.Sprintf("wl%d-%d", i, j), fmt.Sprintf("10.244.%d.%d", i, j), node,
+				workloadapi.NetworkMode_STANDARD, locality, "svc1"))
+		}
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, workloads)
+
+	// observe the share of the connections routed to each tier for every draw of the data plane
+	checkDistribution := func(count, distribution [bpfcache.PrioCount]uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, count, sv.EndpointCount)
+		var observed [bpfcache.PrioCount]uint32
+		for k := uint32(0); k < 10000; k++ {
+			prio := pickPrio(sv.PrioLoad, sv.EndpointCount, k%100)
+			assert.GreaterOrEqual(t, prio, 0)
+			observed[prio]++
+		}
+		for i := range observed {
+			observed[i] /= 100
+		}
+		assert.Equal(t, distribution, observed)
+	}
+
+	// the traffic is split over the three tiers, not only sent to the local one
+	checkDistribution([bpfcache.PrioCount]uint32{2, 2, 2}, [bpfcache.PrioCount]uint32{60, 30, 10})
+
+	// the zone endpoints turn unhealthy, their share goes to the other tiers in proportion
+	unhealthy := []*workloadapi.Workload{proto.Clone(workloads[2]).(*workloadapi.Workload), proto.Clone(workloads[3]).(*workloadapi.Workload)}
+	for _, wl := range unhealthy {
+		wl.Status = workloadapi.WorkloadStatus_UNHEALTHY
+	}
+	p.handleServicesAndWorkloads(nil, unhealthy)
+	checkDistribution([bpfcache.PrioCount]uint32{2, 0, 2}, [bpfcache.PrioCount]uint32{86, 0, 14})
+
+	// they recover
+	p.handleServicesAndWorkloads(nil, workloads[2:4])
+	checkDistribution([bpfcache.PrioCount]uint32{2, 2, 2}, [bpfcache.PrioCount]uint32{60, 30, 10})
+
+	// an invalid annotation is ignored, back to plain failover to the local tier
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.LocalityWeightsAnnotation: "local=60,planet=40"})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkDistribution([bpfcache.PrioCount]uint32{2, 2, 2}, [bpfcache.PrioCount]uint32{100})
+
+	hashNameClean(p)
+}
+
+func TestMinHealthyEndpoints(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.MinHealthyEndpointsAnnotation: "2"})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	var workloads []*workloadapi.Workload
+	for i := 1; i <= 3; i++ {
+		workloads = append(workloads, createWorkload(fmt.Sprintf("wl%d", i), fmt.Sprintf("10.244.0.%d", i), os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, nil, "svc1"))
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, workloads)
+
+	checkUnavailable := func(healthy uint32, unavailable uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, healthy, sv.EndpointCount[0])
+		assert.Equal(t, unavailable, sv.Unavailable)
+	}
+
+	// all 3 endpoints are healthy
+	checkUnavailable(3, 0)
+
+	// one endpoint turns unhealthy, 2 are left which is still enough
+	unhealthy := []*workloadapi.Workload{proto.Clone(workloads[0]).(*workloadapi.Workload), proto.Clone(workloads[1]).(*workloadapi.Workload)}
+	for _, wl := range unhealthy {
+		wl.Status = workloadapi.WorkloadStatus_UNHEALTHY
+	}
+	p.handleServicesAndWorkloads(nil, unhealthy[:1])
+	checkUnavailable(2, 0)
+
+	// a second one turns unhealthy, the service is below its minimum and unavailable
+	p.handleServicesAndWorkloads(nil, unhealthy[1:])
+	checkUnavailable(1, 1)
+
+	// the service update received meanwhile keeps it unavailable
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+	checkUnavailable(1, 1)
+
+	// an endpoint recovers, the service is available again
+	p.handleServicesAndWorkloads(nil, workloads[:1])
+	checkUnavailable(2, 0)
+
+	// the remaining healthy endpoints are removed, then the annotation is removed
+	p.handleRemovedAddresses([]string{workloads[0].ResourceName()})
+	checkUnavailable(1, 1)
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkUnavailable(1, 0)
+
+	hashNameClean(p)
+}
+
+func TestRemoteClusterFailover(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, localityLBScope))
+	svcId := p.hashName.Hash(svc.ResourceName())
+
+	// kmesh has no remote endpoint source of its own, the remote cluster workloads reach it in the
+	// workload xds of istiod, which learns them from a remote secret, so they only differ by their ClusterId
+	remoteWorkload := func(name, ip string, locality *workloadapi.Locality) *workloadapi.Workload {
+		wl := createWorkload(name, ip, "remote-node", workloadapi.NetworkMode_STANDARD, locality, "svc1")
+		wl.ClusterId = "cluster1"
+		return wl
+	}
+	local := []*workloadapi.Workload{
+		createWorkload("local1", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1"),
+		createWorkload("local2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z2", "s2"), "svc1"),
+	}
+	remote := []*workloadapi.Workload{
+		remoteWorkload("remote1", "10.245.0.1", createLocality("r1", "z1", "s1")),
+		remoteWorkload("remote2", "10.245.0.2", createLocality("r2", "z2", "s2")),
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, append(local, remote...))
+
+	checkEndpointCount := func(count [bpfcache.PrioCount]uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, count, sv.EndpointCount)
+	}
+
+	// the remote endpoints are in their own tier, below the farthest local one,
+	// even those in the same locality as the node
+	remotePrio := bpfcache.RemoteClusterPrio(localityLBScope)
+	assert.Equal(t, uint32(4), remotePrio)
+	checkEndpointCount([bpfcache.PrioCount]uint32{1, 0, 0, 1, 2})
+	tier, ok := p.LocalityTier(remote[0], svc)
+	assert.True(t, ok)
+	assert.Equal(t, remotePrio, tier)
+
+	// the traffic fails over to the first non-empty tier, the remote cluster is
+	// only reached once no local endpoint is left
+	p.handleRemovedAddresses([]string{local[0].ResourceName()})
+	checkEndpointCount([bpfcache.PrioCount]uint32{0, 0, 0, 1, 2})
+	p.handleRemovedAddresses([]string{local[1].ResourceName()})
+	checkEndpointCount([bpfcache.PrioCount]uint32{0, 0, 0, 0, 2})
+
+	// the local endpoints come back and take the traffic again
+	p.handleServicesAndWorkloads(nil, local[1:])
+	checkEndpointCount([bpfcache.PrioCount]uint32{0, 0, 0, 1, 2})
+
+	hashNameClean(p)
+}
+
+func TestUnlabeledNodeFailover(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, localityLBScope))
+	svcId := p.hashName.Hash(svc.ResourceName())
+
+	local := createWorkload("local", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	far := createWorkload("far", "10.244.1.1", "far-node", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z2", "s2"), "svc1")
+	// the node of this workload has no topology label at all
+	unlabeled := createWorkload("unlabeled", "10.244.2.1", "unlabeled-node", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{local, far, unlabeled})
+
+	checkEndpointCount := func(count [bpfcache.PrioCount]uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, count, sv.EndpointCount)
+	}
+
+	// the unlabeled endpoint is not mistaken for a local one, it is ranked below even the other regions
+	checkEndpointCount([bpfcache.PrioCount]uint32{1, 0, 0, 1, 0, 0, 1})
+	tier, ok := p.LocalityTier(unlabeled, svc)
+	assert.True(t, ok)
+	assert.Equal(t, uint32(bpfcache.UnknownLocalityPrio), tier)
+
+	// and only takes the traffic once no labeled endpoint is left
+	p.handleRemovedAddresses([]string{local.ResourceName()})
+	checkEndpointCount([bpfcache.PrioCount]uint32{0, 0, 0, 1, 0, 0, 1})
+	p.handleRemovedAddresses([]string{far.ResourceName()})
+	checkEndpointCount([bpfcache.PrioCount]uint32{0, 0, 0, 0, 0, 0, 1})
+
+	hashNameClean(p)
+}
+
+func TestLocalityDefault(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.SetLocalityDefault(options.LocalityPreferClose)
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+	}
+	// svc1 specifies no traffic distribution, svc2 its own
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", createLoadBalancing(workloadapi.LoadBalancing_STRICT, localityLBScope))
+	local := createWorkload("local", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1", "svc2")
+	near := createWorkload("near", "10.244.0.2", "near-node", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z2", "s2"), "svc1", "svc2")
+	far := createWorkload("far", "10.244.1.1", "far-node", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z3", "s3"), "svc1", "svc2")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc1, svc2}, []*workloadapi.Workload{local, near, far})
+
+	lookup := func(svc *workloadapi.Service) bpfcache.ServiceValue {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: p.hashName.Hash(svc.ResourceName())}, &sv))
+		return sv
+	}
+
+	// the default applies to svc1, its endpoints fail over from the closest ones
+	sv := lookup(svc1)
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_FAILOVER), sv.LbPolicy)
+	assert.Equal(t, [bpfcache.PrioCount]uint32{1, 0, 1, 1}, sv.EndpointCount)
+
+	// svc2 keeps its own
+	sv = lookup(svc2)
+	assert.Equal(t, uint32(workloadapi.LoadBalancing_STRICT), sv.LbPolicy)
+	assert.Equal(t, [bpfcache.PrioCount]uint32{2, 1}, sv.EndpointCount)
+
+	hashNameClean(p)
+}
+
+func TestExcludedCIDRs(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.SetExcludedCIDRs([]netip.Prefix{netip.MustParsePrefix("169.254.0.0/16"), netip.MustParsePrefix("10.96.0.1/32")})
+
+	// the kubernetes api server and a ServiceEntry of the metadata service are excluded
+	apiServer := common.CreateFakeService("kubernetes", "10.96.0.1", "", nil)
+	metadata := common.CreateFakeService("metadata", "169.254.169.254", "", nil)
+	managed := common.CreateFakeService("svc1", "10.96.0.10", "", nil)
+	excludedWorkload := createWorkload("metadata", "169.254.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "metadata")
+	managedWorkload := createWorkload("pod1", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{apiServer, metadata, managed},
+		[]*workloadapi.Workload{excludedWorkload, managedWorkload})
+
+	// the connections to the excluded destinations find no frontend and go direct
+	checkNotExistInFrontEndMap(t, netip.MustParseAddr("10.96.0.1").AsSlice(), p)
+	checkNotExistInFrontEndMap(t, netip.MustParseAddr("169.254.169.254").AsSlice(), p)
+	checkNotExistInFrontEndMap(t, netip.MustParseAddr("169.254.0.1").AsSlice(), p)
+	// while the others are still redirected
+	assert.Equal(t, p.hashName.Hash(managed.ResourceName()), checkFrontEndMap(t, netip.MustParseAddr("10.96.0.10").AsSlice(), p))
+	assert.Equal(t, p.hashName.Hash(managedWorkload.GetUid()), checkFrontEndMap(t, netip.MustParseAddr("10.244.0.1").AsSlice(), p))
+
+	hashNameClean(p)
+}
+
+func TestEgressGateway(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+
+	// the ServiceEntry of an external service uses the egress gateway of another namespace as its waypoint
+	gateway := &workloadapi.Service{
+		Name:      "egress-gateway",
+		Namespace: "istio-egress",
+		Hostname:  "egress-gateway.istio-egress.svc.cluster.local",
+		Addresses: []*workloadapi.NetworkAddress{{Address: netip.MustParseAddr("10.96.0.20").AsSlice()}},
+		Ports: []*workloadapi.Port{
+			{ServicePort: 15021, TargetPort: 15021},
+			{ServicePort: 15008, TargetPort: 15008},
+		},
+	}
+	external := common.CreateFakeService("external-api", "240.240.240.1", "istio-egress/egress-gateway.istio-egress.svc.cluster.local",
+		createLoadBalancing(workloadapi.LoadBalancing_UNSPECIFIED_MODE, make([]workloadapi.LoadBalancing_Scope, 0)))
+	gatewayWorkload := createWorkload("egress-gateway-0", "10.244.0.20", "other", workloadapi.NetworkMode_STANDARD, nil, "egress-gateway")
+	gatewayWorkload.Services = map[string]*workloadapi.PortList{
+		"istio-egress/egress-gateway.istio-egress.svc.cluster.local": {Ports: []*workloadapi.Port{{ServicePort: 15008, TargetPort: 15008}}},
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{external, gateway}, []*workloadapi.Workload{gatewayWorkload})
+
+	// the connections to the external service are redirected to the egress gateway
+	externalID := checkFrontEndMap(t, external.Addresses[0].Address, p)
+	var sv bpfcache.ServiceValue
+	assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: externalID}, &sv))
+	assert.True(t, test.EqualIp(sv.WaypointAddr, gateway.Addresses[0].Address))
+	assert.Equal(t, nets.ConvertPortToBigEndian(15008), sv.WaypointPort)
+
+	// which serves them on the kmesh waypoint port though it is not named after a waypoint
+	gatewayID := checkFrontEndMap(t, gateway.Addresses[0].Address, p)
+	assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: gatewayID}, &sv))
+	assert.Equal(t, nets.ConvertPortToBigEndian(15008), sv.ServicePort[1])
+	assert.Equal(t, nets.ConvertPortToBigEndian(KmeshWaypointPort), sv.TargetPort[1])
+	checkEndpointMap(t, p, gateway, []uint32{p.hashName.Hash(gatewayWorkload.GetUid())})
+
+	hashNameClean(p)
+}
+
+func TestServiceSelectorChange(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_UNSPECIFIED_MODE, nil))
+	svcId := p.hashName.Hash(svc.ResourceName())
+	// the pods of two deployments, the selector of the service first matches the v1 ones
+	deployment := func(version int, selected bool) []*workloadapi.Workload {
+		var services []string
+		if selected {
+			services = append(services, "svc1")
+		}
+		var wls []*workloadapi.Workload
+		for i := 1; i <= 2; i++ {
+			wls = append(wls, createWorkload(fmt.Sprintf("v%d-%d", version, i), fmt.Sprintf("10.244.%d.%d", version, i),
+				"other", workloadapi.NetworkMode_STANDARD, nil, services...))
+		}
+		return wls
+	}
+	backendUids := func(wls []*workloadapi.Workload) []uint32 {
+		var uids []uint32
+		for _, wl := range wls {
+			uids = append(uids, p.hashName.Hash(wl.GetUid()))
+		}
+		return uids
+	}
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, append(deployment(1, true), deployment(2, false)...))
+	checkEndpointMap(t, p, svc, backendUids(deployment(1, true)))
+
+	// the selector flips to the v2 pods, istiod pushes the v1 pods without the service first
+	flip := append(deployment(1, false), deployment(2, true)...)
+	// the v2 pods are added to the service before the v1 ones are removed from it
+	for _, wl := range flip {
+		assert.NoError(t, p.updateWorkload(wl))
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.NotZero(t, sv.EndpointCount[0], "service left without endpoints")
+	}
+	checkEndpointMap(t, p, svc, append(backendUids(deployment(1, true)), backendUids(deployment(2, true))...))
+	for _, wl := range flip {
+		assert.NoError(t, p.unbindWorkloadServices(wl))
+	}
+	checkEndpointMap(t, p, svc, backendUids(deployment(2, true)))
+	checkNotExistInEndpointMap(t, p, svc, backendUids(deployment(1, true)))
+
+	// and flips back in a single push
+	p.handleServicesAndWorkloads(nil, append(deployment(1, true), deployment(2, false)...))
+	checkServiceMap(t, p, svcId, svc, 0, 2)
+	checkEndpointMap(t, p, svc, backendUids(deployment(1, true)))
+	checkNotExistInEndpointMap(t, p, svc, backendUids(deployment(2, true)))
+	assert.Equal(t, 2, p.bpf.EndpointCount())
+
+	hashNameClean(p)
+}
+
+func TestPendingWorkload(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_UNSPECIFIED_MODE, nil))
+	svcId := p.hashName.Hash(svc.ResourceName())
+	ready := createWorkload("ready", "10.244.0.1", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{ready})
+
+	// the pod is scheduled but not yet assigned an ip
+	pending := createWorkload("pending", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	backendUid := p.hashName.Hash(pending.GetUid())
+	for _, addresses := range [][][]byte{nil, {{}}} {
+		pending.Addresses = addresses
+		p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{pending})
+		assert.Nil(t, p.WorkloadCache.GetWorkloadByUid(pending.GetUid()))
+		assert.Error(t, p.bpf.BackendLookup(&bpfcache.BackendKey{BackendUid: backendUid}, &bpfcache.BackendValue{}))
+		checkServiceMap(t, p, svcId, svc, 0, 1)
+		checkNotExistInEndpointMap(t, p, svc, []uint32{backendUid})
+	}
+
+	// it is added once it is assigned one
+	assigned := createWorkload("pending", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{assigned})
+	assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(assigned.GetUid()))
+	checkServiceMap(t, p, svcId, svc, 0, 2)
+	checkEndpointMap(t, p, svc, []uint32{p.hashName.Hash(ready.GetUid()), backendUid})
+	checkFrontEndMap(t, assigned.Addresses[0], p)
+
+	// and removed if it loses it, leaving no endpoint without address behind
+	pending.Addresses = nil
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{pending})
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid(pending.GetUid()))
+	assert.Error(t, p.bpf.BackendLookup(&bpfcache.BackendKey{BackendUid: backendUid}, &bpfcache.BackendValue{}))
+	checkServiceMap(t, p, svcId, svc, 0, 1)
+	checkNotExistInEndpointMap(t, p, svc, []uint32{backendUid})
+	checkNotExistInFrontEndMap(t, assigned.Addresses[0], p)
+
+	hashNameClean(p)
+}
+
+func TestLargeEndpointSet(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.applyBatchSize = 100
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_UNSPECIFIED_MODE, nil))
+	svcId := p.hashName.Hash(svc.ResourceName())
+	const count = 900
+	var workloads []*workloadapi.Workload
+	var backendUids []uint32
+	for i := 0; i < count; i++ {
+		wl := createWorkload(fmt.Sprintf("pod-%d", i), fmt.Sprintf("10.244.%d.%d", i/250, i%250+1),
+			"other", workloadapi.NetworkMode_STANDARD, nil, "svc1")
+		workloads = append(workloads, wl)
+		backendUids = append(backendUids, p.hashName.Hash(wl.GetUid()))
+	}
+
+	// the endpoints are applied incrementally, the lock is released between the batches
+	p.mutex.Lock()
+	var applied []int
+	var batchDurations []time.Duration
+	last := time.Now()
+	p.yieldApply = func() {
+		batchDurations = append(batchDurations, time.Since(last))
+		applied = append(applied, len(p.bpf.GetAllEndpointsForService(svcId)))
+		p.yieldLock()
+		last = time.Now()
+	}
+	// an update waiting for the lock gets it before the whole response is applied
+	waited := make(chan int, 1)
+	go func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		waited <- len(p.bpf.GetAllEndpointsForService(svcId))
+	}()
+	serviceErr, workloadErr := p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, workloads)
+	p.yieldApply = nil
+	p.mutex.Unlock()
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
+
+	assert.Equal(t, []int{100, 200, 300, 400, 500, 600, 700, 800}, applied)
+	for _, d := range batchDurations {
+		assert.Less(t, d, 5*time.Second, "batch apply latency is not bounded")
+	}
+	assert.Less(t, <-waited, count)
+
+	checkServiceMap(t, p, svcId, svc, 0, count)
+	checkEndpointMap(t, p, svc, backendUids)
+	assert.Equal(t, count, len(p.WorkloadCache.List()))
+
+	hashNameClean(p)
+}
+
+func TestEndpointWeightsWithinPriority(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.EndpointWeightsAnnotation: "v1=1, v2=3"})
+
+	localityLBScope := []workloadapi.LoadBalancing_Scope{
+		workloadapi.LoadBalancing_REGION,
+		workloadapi.LoadBalancing_ZONE,
+		workloadapi.LoadBalancing_SUBZONE,
+	}
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, localityLBScope))
+	svcId := p.hashName.Hash(svc.ResourceName())
+
+	// the two remote endpoints share the same subzone and so the same prio
+	local := createWorkload("local", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	sub2a := createWorkload("sub2a", "10.244.1.1", "other", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s2"), "svc1")
+	sub2a.CanonicalRevision = "v1"
+	sub2b := createWorkload("sub2b", "10.244.1.2", "other", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s2"), "svc1")
+	sub2b.CanonicalRevision = "v2"
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{local, sub2a, sub2b})
+
+	// shares returns the share of the traffic of the prio each endpoint gets, by workload name
+	shares := func(prio uint32) map[string]float64 {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		weights := make(map[string]uint32)
+		total := uint32(0)
+		for i := uint32(1); i <= sv.EndpointCount[prio]; i++ {
+			var ev bpfcache.EndpointValue
+			assert.NoError(t, p.bpf.EndpointLookup(&bpfcache.EndpointKey{ServiceId: svcId, Prio: prio, BackendIndex: i}, &ev))
+			assert.LessOrEqual(t, ev.Weight, max(sv.MaxEndpointWeight, 1))
+			weights[p.WorkloadCache.GetWorkloadByUid(p.hashName.NumToStr(ev.BackendUid)).GetName()] = ev.Weight
+			total += ev.Weight
+		}
+		result := make(map[string]float64)
+		for name, weight := range weights {
+			result[name] = float64(weight) / float64(total)
+		}
+		return result
+	}
+
+	assert.Equal(t, map[string]float64{"local": 1}, shares(0))
+	assert.Equal(t, map[string]float64{"sub2a": 0.25, "sub2b": 0.75}, shares(1))
+
+	// weights updated
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.EndpointWeightsAnnotation: "v1=4"})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	assert.Equal(t, map[string]float64{"sub2a": 0.8, "sub2b": 0.2}, shares(1))
+
+	// invalid weights are ignored, the endpoints are picked evenly
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.EndpointWeightsAnnotation: "v1=0"})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	assert.Equal(t, map[string]float64{"sub2a": 0.5, "sub2b": 0.5}, shares(1))
+
+	hashNameClean(p)
+}
+
+func TestEndpointSlowStart(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	now := time.Now()
+	p.slowStart.now = func() time.Time { return now }
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{constants.SlowStartWindowAnnotation: "100s"})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	old1 := createWorkload("old1", "10.244.0.1", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	old2 := createWorkload("old2", "10.244.0.2", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{old1, old2})
+	// the endpoints of the first address response are not new
+	p.slowStart.synced = true
+
+	// share returns the share of the traffic the endpoint of the workload gets
+	share := func(name string) float64 {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, uint32(bpfcache.MaxEndpointWeight), sv.MaxEndpointWeight)
+		total, weight := uint32(0), uint32(0)
+		for i := uint32(1); i <= sv.EndpointCount[0]; i++ {
+			var ev bpfcache.EndpointValue
+			assert.NoError(t, p.bpf.EndpointLookup(&bpfcache.EndpointKey{ServiceId: svcId, Prio: 0, BackendIndex: i}, &ev))
+			assert.LessOrEqual(t, ev.Weight, sv.MaxEndpointWeight)
+			if p.WorkloadCache.GetWorkloadByUid(p.hashName.NumToStr(ev.BackendUid)).GetName() == name {
+				weight = ev.Weight
+			}
+			total += ev.Weight
+		}
+		return float64(weight) / float64(total)
+	}
+	assert.Equal(t, 0.5, share("old1"))
+
+	// the new endpoint begins with a tenth of its weight
+	added := createWorkload("new", "10.244.0.3", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{added})
+	assert.Equal(t, 10.0/210, share("new"))
+
+	// and ramps up over the window
+	now = now.Add(50 * time.Second)
+	p.refreshSlowStart()
+	assert.Equal(t, 50.0/250, share("new"))
+	now = now.Add(50 * time.Second)
+	p.refreshSlowStart()
+	assert.Equal(t, 1.0/3, share("new"))
+	assert.Empty(t, p.slowStart.readyAt)
+
+	hashNameClean(p)
+}
+
+func TestEndpointWarmUp(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	now := time.Now()
+	p.slowStart.now = func() time.Time { return now }
+	var (
+		mutex  sync.Mutex
+		dialed []netip.AddrPort
+	)
+	release := make(chan struct{})
+	p.slowStart.dial = func(addr netip.AddrPort) error {
+		<-release
+		mutex.Lock()
+		defer mutex.Unlock()
+		dialed = append(dialed, addr)
+		return nil
+	}
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.SlowStartWindowAnnotation:   "100s",
+		constants.WarmUpConnectionsAnnotation: "2",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	old1 := createWorkload("old1", "10.244.0.1", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	old2 := createWorkload("old2", "10.244.0.2", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{old1, old2})
+	p.slowStart.synced = true
+
+	share := func(name string) float64 {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		total, weight := uint32(0), uint32(0)
+		for i := uint32(1); i <= sv.EndpointCount[0]; i++ {
+			var ev bpfcache.EndpointValue
+			assert.NoError(t, p.bpf.EndpointLookup(&bpfcache.EndpointKey{ServiceId: svcId, Prio: 0, BackendIndex: i}, &ev))
+			if p.WorkloadCache.GetWorkloadByUid(p.hashName.NumToStr(ev.BackendUid)).GetName() == name {
+				weight = ev.Weight
+			}
+			total += ev.Weight
+		}
+		return float64(weight) / float64(total)
+	}
+
+	// the new endpoint keeps a tenth of its weight while it is warmed up
+	added := createWorkload("new", "10.244.0.3", "node1", workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{added})
+	assert.Equal(t, 10.0/210, share("new"))
+	now = now.Add(50 * time.Second)
+	p.refreshSlowStart()
+	assert.Equal(t, 10.0/210, share("new"))
+
+	// the warm-up connections are opened to each target port of the endpoint
+	close(release)
+	assert.Eventually(t, func() bool {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		return len(p.slowStart.warming) == 0
+	}, time.Second, 10*time.Millisecond)
+	mutex.Lock()
+	assert.ElementsMatch(t, []netip.AddrPort{
+		netip.MustParseAddrPort("10.244.0.3:8080"), netip.MustParseAddrPort("10.244.0.3:8080"),
+		netip.MustParseAddrPort("10.244.0.3:8180"), netip.MustParseAddrPort("10.244.0.3:8180"),
+		netip.MustParseAddrPort("10.244.0.3:82"), netip.MustParseAddrPort("10.244.0.3:82"),
+	}, dialed)
+	mutex.Unlock()
+
+	// then its weight ramps up over the window from the end of the warm-up
+	p.refreshSlowStart()
+	assert.Equal(t, 10.0/210, share("new"))
+	now = now.Add(50 * time.Second)
+	p.refreshSlowStart()
+	assert.Equal(t, 50.0/250, share("new"))
+	now = now.Add(50 * time.Second)
+	p.refreshSlowStart()
+	assert.Equal(t, 1.0/3, share("new"))
+	assert.Empty(t, p.slowStart.readyAt)
+
+	hashNameClean(p)
+}
+
+func TestServiceConnectPolicy(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.FailedBackendRepicksAnnotation: "2",
+		constants.ConnectTimeoutAnnotation:       "500ms",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	checkPolicy := func(repicks, timeout uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, repicks, sv.FailedBackendRepicks)
+		assert.Equal(t, timeout, sv.ConnectTimeout)
+	}
+	checkPolicy(2, 500)
+
+	// invalid values are ignored
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.FailedBackendRepicksAnnotation: "10",
+		constants.ConnectTimeoutAnnotation:       "1s",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkPolicy(0, 1000)
+
+	// annotations removed
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkPolicy(0, 0)
+
+	hashNameClean(p)
+}
+
+func TestServiceIdleTimeout(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.IdleTimeoutAnnotation: "300s",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	checkTimeout := func(timeout uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, timeout, sv.IdleTimeout)
+	}
+	checkTimeout(300000)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.IdleTimeoutAnnotation: "1m",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkTimeout(60000)
+
+	// too short to be meaningful, ignored
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.IdleTimeoutAnnotation: "10ms",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkTimeout(0)
+
+	hashNameClean(p)
+}
+
+func TestServiceDscp(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.DscpAnnotation: "46",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	checkDscp := func(dscp uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, dscp, sv.Dscp)
+	}
+	checkDscp(46)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.DscpAnnotation: "10",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkDscp(10)
+
+	// does not fit the 6 bits of the DSCP, ignored
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.DscpAnnotation: "64",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkDscp(0)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.DscpAnnotation: "46",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkDscp(0)
+
+	hashNameClean(p)
+}
+
+func TestServiceLbAlgorithm(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.LoadBalancerAnnotation: "ROUND_ROBIN",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	checkLbAlgorithm := func(algorithm uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, algorithm, sv.LbAlgorithm)
+	}
+	checkLbAlgorithm(bpfcache.LbAlgorithmRoundRobin)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.LoadBalancerAnnotation: "least_request",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkLbAlgorithm(bpfcache.LbAlgorithmLeastConn)
+
+	// not an algorithm of the data plane, ignored
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.LoadBalancerAnnotation: "MAGLEV",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkLbAlgorithm(bpfcache.LbAlgorithmRandom)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.LoadBalancerAnnotation: "RING_HASH",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkLbAlgorithm(bpfcache.LbAlgorithmRingHash)
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkLbAlgorithm(bpfcache.LbAlgorithmRandom)
+
+	hashNameClean(p)
+}
+
+func TestServiceBandwidth(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.BandwidthAnnotation: "10Mbps",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	lookup := func() bpfcache.ServiceValue {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		return sv
+	}
+	checkBandwidth := func(egress, ingress uint32) {
+		assert.Equal(t, [bpfcache.BandwidthDirections]uint32{egress, ingress}, lookup().Bandwidth)
+	}
+	checkBandwidth(1250000, 1250000)
+
+	// the state of the data plane is kept by the updates of the service
+	sk := bpfcache.ServiceKey{ServiceId: svcId}
+	sv := lookup()
+	sv.BandwidthThrottled = [bpfcache.BandwidthDirections]uint32{3, 0}
+	sv.BandwidthTatNs = [bpfcache.BandwidthDirections]uint64{1000, 0}
+	assert.NoError(t, p.bpf.ServiceUpdate(&sk, &sv))
+	svc = common.CreateFakeService("svc1", "10.240.10.1", "10.240.10.2", nil)
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+	sv = lookup()
+	assert.Equal(t, [bpfcache.BandwidthDirections]uint32{3, 0}, sv.BandwidthThrottled)
+	assert.Equal(t, [bpfcache.BandwidthDirections]uint64{1000, 0}, sv.BandwidthTatNs)
+
+	p.refreshBandwidthMetrics()
+	assert.Equal(t, map[string][bpfcache.BandwidthDirections]uint32{svc.ResourceName(): {3, 0}}, p.bandwidthThrottled)
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.BandwidthAnnotation: "egress=1Mbps, ingress=80Kbps",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkBandwidth(125000, 10000)
+
+	for _, invalid := range []string{"10", "10MB", "-1Mbps", "1bps", "100Gbps", "egress=1Mbps,up=1Mbps"} {
+		p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+			constants.BandwidthAnnotation: invalid,
+		})
+		p.HandleServiceAnnotationUpdate("default", "svc1")
+		checkBandwidth(0, 0)
+	}
+
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.BandwidthAnnotation: "ingress=1Gbps",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkBandwidth(0, 125000000)
+	p.ServiceAnnotationCache.Delete("default", "svc1")
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkBandwidth(0, 0)
+
+	// the metrics of the services no longer limited are forgotten
+	p.refreshBandwidthMetrics()
+	assert.Empty(t, p.bandwidthThrottled)
+
+	hashNameClean(p)
+}
+
+func TestBackendDataPlaneStateKept(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	wl := common.CreateFakeWorkload("1.2.3.4", "", common.WithWorkloadBasicInfo("wl1", "uid1", ""))
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{wl})
+
+	// the data plane counted the connections established to the backend and its connect failures
+	bk := bpfcache.BackendKey{BackendUid: p.hashName.Hash("uid1")}
+	var bv bpfcache.BackendValue
+	assert.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+	bv.ActiveConnections = 3
+	bv.ConnectFailNs = uint64(100 * time.Second)
+	bv.ConnectFailCount = 1
+	assert.NoError(t, p.bpf.BackendUpdate(&bk, &bv))
+
+	// the workload update rewrites the backend
+	wl = common.CreateFakeWorkload("1.2.3.4", "10.0.0.1", common.WithWorkloadBasicInfo("wl1", "uid1", ""))
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{wl})
+
+	assert.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+	assert.Equal(t, uint32(3), bv.ActiveConnections)
+	assert.Equal(t, uint64(100*time.Second), bv.ConnectFailNs)
+	assert.Equal(t, uint32(1), bv.ConnectFailCount)
+	assert.Equal(t, nets.ConvertPortToBigEndian(15008), bv.WaypointPort)
+
+	hashNameClean(p)
+}
+
+func TestEjectedBackendStaysEjectedOnRepush(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	wl := createWorkload("wl1", "10.244.0.1", "node1", workloadapi.NetworkMode_STANDARD, nil, "svc1", "svc2", "svc3")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{wl})
+
+	// the outlier detection of the service ejected the backend after its connect failures
+	sv := bpfcache.ServiceValue{OutlierConsecutiveErrors: 2, OutlierEjectionTime: 10000}
+	bk := bpfcache.BackendKey{BackendUid: p.hashName.Hash(wl.GetUid())}
+	var bv bpfcache.BackendValue
+	assert.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+	bv.ConnectFailNs = uint64(100 * time.Second)
+	bv.ConnectFailCount = 2
+	assert.NoError(t, p.bpf.BackendUpdate(&bk, &bv))
+	ejected := bv
+
+	// xds pushes the workload again unchanged, as on a resync, then with a new waypoint
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{proto.Clone(wl).(*workloadapi.Workload)})
+	assert.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+	assert.Equal(t, ejected, bv)
+	assert.True(t, bv.EjectedBy(&sv, 101*time.Second))
+
+	wl = proto.Clone(wl).(*workloadapi.Workload)
+	wl.Waypoint = &workloadapi.GatewayAddress{
+		Destination:   &workloadapi.GatewayAddress_Address{Address: &workloadapi.NetworkAddress{Address: netip.MustParseAddr("10.244.0.10").AsSlice()}},
+		HboneMtlsPort: 15008,
+	}
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{wl})
+	assert.NoError(t, p.bpf.BackendLookup(&bk, &bv))
+	assert.Equal(t, nets.ConvertPortToBigEndian(15008), bv.WaypointPort)
+	assert.True(t, bv.EjectedBy(&sv, 101*time.Second))
+
+	hashNameClean(p)
+}
+
+func TestDuplicateServiceAddress(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	oldSvc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	p.handleServicesAndWorkloads([]*workloadapi.Service{oldSvc}, nil)
+	assert.Equal(t, p.hashName.Hash(oldSvc.ResourceName()), checkFrontEndMap(t, oldSvc.Addresses[0].Address, p))
+
+	// the service is recreated under another name with the same ClusterIP before the old one is removed
+	newSvc := common.CreateFakeService("svc2", "10.240.10.1", "", nil)
+	newSvcId := p.hashName.Hash(newSvc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{newSvc}, nil)
+	assert.Equal(t, newSvcId, checkFrontEndMap(t, newSvc.Addresses[0].Address, p))
+
+	// an update of the old service does not take the address back
+	oldSvc = common.CreateFakeService("svc1", "10.240.10.1", "", &workloadapi.LoadBalancing{Mode: workloadapi.LoadBalancing_FAILOVER})
+	p.handleServicesAndWorkloads([]*workloadapi.Service{oldSvc}, nil)
+	assert.Equal(t, newSvcId, checkFrontEndMap(t, newSvc.Addresses[0].Address, p))
+
+	// removing the old service leaves the address to the new one
+	assert.NoError(t, p.removeServiceResources([]string{oldSvc.ResourceName()}))
+	assert.Equal(t, newSvcId, checkFrontEndMap(t, newSvc.Addresses[0].Address, p))
+	assert.Equal(t, newSvc, p.getServiceByAddress(newSvc.Addresses[0].Address))
+
+	assert.NoError(t, p.removeServiceResources([]string{newSvc.ResourceName()}))
+	checkNotExistInFrontEndMap(t, newSvc.Addresses[0].Address, p)
+	assert.Nil(t, p.getServiceByAddress(newSvc.Addresses[0].Address))
+
+	hashNameClean(p)
+}
+
+func TestServiceOutlierDetection(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.OutlierDetectionAnnotation: "consecutiveErrors=3,baseEjectionTime=10s",
+	})
+
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+
+	checkOutlierDetection := func(consecutiveErrors, ejectionTime uint32) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		assert.Equal(t, consecutiveErrors, sv.OutlierConsecutiveErrors)
+		assert.Equal(t, ejectionTime, sv.OutlierEjectionTime)
+	}
+	checkOutlierDetection(3, 10000)
+
+	// the fields not set take the defaults of a DestinationRule
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.OutlierDetectionAnnotation: "consecutiveErrors=2",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkOutlierDetection(2, 30000)
+
+	// unknown fields are rejected
+	p.ServiceAnnotationCache.AddOrUpdate("default", "svc1", map[string]string{
+		constants.OutlierDetectionAnnotation: "consecutiveErrors=2,interval=10s",
+	})
+	p.HandleServiceAnnotationUpdate("default", "svc1")
+	checkOutlierDetection(0, 0)
+
+	// a backend is ejected once it failed enough times in a row, until the ejection time passed
+	sv := bpfcache.ServiceValue{OutlierConsecutiveErrors: 2, OutlierEjectionTime: 10000}
+	bv := bpfcache.BackendValue{ConnectFailNs: uint64(100 * time.Second), ConnectFailCount: 1}
+	assert.False(t, bv.EjectedBy(&sv, 101*time.Second))
+	bv.ConnectFailCount = 2
+	assert.True(t, bv.EjectedBy(&sv, 101*time.Second))
+	assert.False(t, bv.EjectedBy(&sv, 111*time.Second))
+
+	hashNameClean(p)
+}
+
+func TestServicePortUpdate(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", createLoadBalancing(workloadapi.LoadBalancing_UNSPECIFIED_MODE, nil))
+	wl := createWorkload("wl1", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	svcId := p.hashName.Hash(svc.ResourceName())
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, []*workloadapi.Workload{wl})
+
+	// dnat looks up the target port a connection to the service port is routed to, as the data plane does
+	dnat := func(port uint32) (uint32, bool) {
+		var sv bpfcache.ServiceValue
+		assert.NoError(t, p.bpf.ServiceLookup(&bpfcache.ServiceKey{ServiceId: svcId}, &sv))
+		for i, servicePort := range sv.ServicePort {
+			if servicePort == nets.ConvertPortToBigEndian(port) {
+				return nets.ConvertPortToLittleEndian(sv.TargetPort[i]), true
+			}
+		}
+		return 0, false
+	}
+	checkRouted := func(port, targetPort uint32) {
+		got, ok := dnat(port)
+		assert.True(t, ok, "port %d is not routed", port)
+		assert.Equal(t, targetPort, got)
+	}
+	checkRouted(80, 8080)
+	checkRouted(81, 8180)
+
+	// 1. service port 80 changed to 90
+	updated := proto.Clone(svc).(*workloadapi.Service)
+	updated.Ports[0].ServicePort = 90
+	p.handleServicesAndWorkloads([]*workloadapi.Service{updated}, nil)
+	_, ok := dnat(80)
+	assert.False(t, ok)
+	checkRouted(90, 8080)
+	checkRouted(81, 8180)
+	checkServiceMap(t, p, svcId, updated, 0, 1)
+
+	// 2. port removed and target port changed together with the lb policy and the address
+	llbSvc := proto.Clone(updated).(*workloadapi.Service)
+	llbSvc.LoadBalancing = createLoadBalancing(workloadapi.LoadBalancing_FAILOVER, []workloadapi.LoadBalancing_Scope{workloadapi.LoadBalancing_REGION})
+	llbSvc.Ports = llbSvc.Ports[1:]
+	llbSvc.Ports[0].TargetPort = 8181
+	llbSvc.Addresses[0].Address = netip.MustParseAddr("10.240.10.2").AsSlice()
+	p.handleServicesAndWorkloads([]*workloadapi.Service{llbSvc}, nil)
+	_, ok = dnat(90)
+	assert.False(t, ok)
+	checkRouted(81, 8181)
+	checkRouted(82, 82)
+	checkNotExistInFrontEndMap(t, svc.Addresses[0].Address, p)
+	assert.Equal(t, svcId, checkFrontEndMap(t, llbSvc.Addresses[0].Address, p))
+	assert.Len(t, p.bpf.GetAllEndpointsForService(svcId), 1)
+
+	// 3. back to random with the original ports
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc}, nil)
+	checkRouted(80, 8080)
+	checkRouted(81, 8180)
+	checkNotExistInFrontEndMap(t, llbSvc.Addresses[0].Address, p)
+	assert.Equal(t, svcId, checkFrontEndMap(t, svc.Addresses[0].Address, p))
+	checkServiceMap(t, p, svcId, svc, 0, 1)
+
+	hashNameClean(p)
+}
+
+func TestWorkloadPolicySelector(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	// two deployments on the node, the control plane resolved the selector of the policy into the selected one
+	selected := createWorkload("v1", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	selected.AuthorizationPolicies = []string{"default/deny-v1"}
+	other := createWorkload("v2", "10.244.0.2", p.nodeName, workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{selected, other})
+
+	lookup := func(workload *workloadapi.Workload) (bpfcache.WorkloadPolicyValue, error) {
+		var value bpfcache.WorkloadPolicyValue
+		err := p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(workload.GetUid())}, &value)
+		return value, err
+	}
+	value, err := lookup(selected)
+	assert.NoError(t, err)
+	assert.Equal(t, [4]uint32{p.hashName.Hash("default/deny-v1")}, value.PolicyIds)
+	_, err = lookup(other)
+	assert.Error(t, err)
+
+	// the policy now selects the other deployment
+	selected = proto.Clone(selected).(*workloadapi.Workload)
+	selected.AuthorizationPolicies = nil
+	other = proto.Clone(other).(*workloadapi.Workload)
+	other.AuthorizationPolicies = []string{"default/deny-v1"}
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{selected, other})
+	_, err = lookup(selected)
+	assert.Error(t, err)
+	value, err = lookup(other)
+	assert.NoError(t, err)
+	assert.Equal(t, [4]uint32{p.hashName.Hash("default/deny-v1")}, value.PolicyIds)
+
+	hashNameClean(p)
+}
+
+func TestNamespaceIsolationWorkloadPolicies(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.SetNamespaceIsolation(true)
+	selected := createWorkload("v1", "10.244.0.1", p.nodeName, workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	selected.AuthorizationPolicies = []string{"default/deny-v1"}
+	other := createWorkload("v2", "10.244.0.2", p.nodeName, workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{selected, other})
+
+	// every workload of the node has the isolation policy of its namespace first, so that the
+	// connections no other policy matches in xdp are authorized in userspace
+	isolation := p.hashName.Hash(auth.NamespaceIsolationPolicy(selected.GetNamespace()).ResourceName())
+	for _, workload := range []*workloadapi.Workload{selected, other} {
+		var value bpfcache.WorkloadPolicyValue
+		err := p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(workload.GetUid())}, &value)
+		assert.NoError(t, err)
+		assert.Equal(t, isolation, value.PolicyIds[0])
+	}
+	var value bpfcache.WorkloadPolicyValue
+	assert.NoError(t, p.bpf.WorkloadPolicyLookup(&bpfcache.WorkloadPolicyKey{WorklodId: p.hashName.Hash(selected.GetUid())}, &value))
+	assert.Equal(t, [4]uint32{isolation, p.hashName.Hash("default/deny-v1")}, value.PolicyIds)
+
+	hashNameClean(p)
+}
 func TestGetServiceByAddress(t *testing.T) {
 	t.Run("test get service in serviceCache", func(t *testing.T) {
 		workloadMap := bpfcache.NewFakeWorkloadMap(t)
@@ -783,3 +2056,73 @@ func TestUpdateWorkloadInFrontendMap(t *testing.T) {
 		assert.NoError(t, err)
 	})
 }
+
+func TestCacheMaxEntries(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	p.SetCacheMaxEntries(1)
+
+	// the services are still in xds, so none is evicted
+	svc1 := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	svc2 := common.CreateFakeService("svc2", "10.240.10.2", "", nil)
+	p.handleServicesAndWorkloads([]*workloadapi.Service{svc1, svc2}, nil)
+	assert.Len(t, p.ServiceCache.List(), 2)
+
+	// an unhealthy workload is not in the backend map but still in xds, it is kept
+	wl1 := common.CreateFakeWorkload("1.2.3.4", "", common.WithWorkloadBasicInfo("wl1", "uid1", ""))
+	wl2 := common.CreateFakeWorkload("1.2.3.5", "", common.WithWorkloadBasicInfo("wl2", "uid2", ""))
+	wl2.Status = workloadapi.WorkloadStatus_UNHEALTHY
+	wl3 := common.CreateFakeWorkload("1.2.3.6", "", common.WithWorkloadBasicInfo("wl3", "uid3", ""))
+	p.handleServicesAndWorkloads(nil, []*workloadapi.Workload{wl1, wl2, wl3})
+
+	for _, uid := range []string{"uid1", "uid2", "uid3"} {
+		assert.NotNil(t, p.WorkloadCache.GetWorkloadByUid(uid))
+	}
+	var bv bpfcache.BackendValue
+	for _, uid := range []string{"uid1", "uid3"} {
+		assert.NoError(t, p.bpf.BackendLookup(&bpfcache.BackendKey{BackendUid: p.hashName.StrToNum(uid)}, &bv))
+	}
+
+	// the workloads removed from xds are deleted
+	p.handleRemovedAddresses([]string{wl1.ResourceName(), wl2.ResourceName()})
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid("uid1"))
+	assert.Nil(t, p.WorkloadCache.GetWorkloadByUid("uid2"))
+	assert.Len(t, p.WorkloadCache.List(), 1)
+}
+
+func TestHeadlessService(t *testing.T) {
+	workloadMap := bpfcache.NewFakeWorkloadMap(t)
+	defer bpfcache.CleanupFakeWorkloadMap(workloadMap)
+
+	p := NewProcessor(workloadMap)
+	svc := common.CreateFakeService("svc1", "10.240.10.1", "", nil)
+	headless := proto.Clone(svc).(*workloadapi.Service)
+	headless.Addresses = nil
+
+	wl1 := createWorkload("wl1", "10.244.0.1", os.Getenv("NODE_NAME"), workloadapi.NetworkMode_STANDARD, createLocality("r1", "z1", "s1"), "svc1")
+	wl2 := createWorkload("wl2", "10.244.0.2", "other", workloadapi.NetworkMode_STANDARD, createLocality("r2", "z2", "s2"), "svc1")
+	serviceErr, workloadErr := p.handleServicesAndWorkloads([]*workloadapi.Service{headless}, []*workloadapi.Workload{wl1, wl2})
+	assert.NoError(t, serviceErr)
+	assert.NoError(t, workloadErr)
+
+	// the clients of a headless service resolve the addresses of its pods and connect to them directly,
+	// the frontends of the pods route to their own backends and no frontend routes to the service
+	serviceId := p.hashName.Hash(headless.ResourceName())
+	assert.Empty(t, p.bpf.FrontendIterFindKey(serviceId))
+	for _, wl := range []*workloadapi.Workload{wl1, wl2} {
+		assert.Equal(t, p.hashName.Hash(wl.GetUid()), checkFrontEndMap(t, wl.Addresses[0], p))
+		checkBackendMap(t, p, p.hashName.Hash(wl.GetUid()), wl)
+	}
+	assert.Equal(t, 2, p.bpf.FrontendCount())
+
+	// the service gets a cluster IP, then is made headless again
+	assert.NoError(t, p.handleService(svc))
+	assert.Equal(t, serviceId, checkFrontEndMap(t, svc.Addresses[0].Address, p))
+	assert.NoError(t, p.handleService(proto.Clone(headless).(*workloadapi.Service)))
+	checkNotExistInFrontEndMap(t, svc.Addresses[0].Address, p)
+	assert.Equal(t, p.hashName.Hash(wl1.GetUid()), checkFrontEndMap(t, wl1.Addresses[0], p))
+
+	hashNameClean(p)
+}
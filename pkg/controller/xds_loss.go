@@ -0,0 +1,177 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"kmesh.net/kmesh/daemon/options"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/bpf"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+)
+
+// xdsLossHandler applies the --on-xds-loss mode once the xds connection has been lost for the
+// grace period, and enforces the authorization policies again when the connection is recovered.
+// The bpf maps are left untouched, the last configuration received keeps being used for routing.
+type xdsLossHandler struct {
+	mode        string
+	gracePeriod time.Duration
+	// enforce changes how the new connections are authorized
+	enforce func(auth.Enforcement) error
+
+	mutex   sync.Mutex
+	lost    bool
+	applied bool
+	// generation invalidates the grace period timers of the previous losses
+	generation uint64
+	timer      *time.Timer
+}
+
+func newXdsLossHandler(mode string, gracePeriod time.Duration, enforce func(auth.Enforcement) error) *xdsLossHandler {
+	telemetry.SetXdsLossState(mode, telemetry.XdsLossStateConnected)
+	return &xdsLossHandler{
+		mode:        mode,
+		gracePeriod: gracePeriod,
+		enforce:     enforce,
+	}
+}
+
+// disconnected starts the grace period when the xds connection is lost
+func (h *xdsLossHandler) disconnected() {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.lost {
+		return
+	}
+	h.lost = true
+	telemetry.SetXdsLossState(h.mode, telemetry.XdsLossStateDisconnected)
+	if h.mode == options.XdsLossFailStatic {
+		log.Warnf("xds connection lost, keep using the last configuration received")
+		return
+	}
+
+	log.Warnf("xds connection lost, %s will be applied in %v unless it is recovered", h.mode, h.gracePeriod)
+	h.generation++
+	generation := h.generation
+	h.timer = time.AfterFunc(h.gracePeriod, func() {
+		h.expire(generation)
+	})
+}
+
+// expire applies the mode once the grace period of the loss of generation is over
+func (h *xdsLossHandler) expire(generation uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.lost || h.generation != generation {
+		return
+	}
+
+	enforcement := auth.AllowAll
+	if h.mode == options.XdsLossFailClosed {
+		enforcement = auth.DenyAll
+	}
+	if err := h.enforce(enforcement); err != nil {
+		log.Errorf("failed to apply %s after losing the xds connection: %v", h.mode, err)
+		return
+	}
+	h.applied = true
+	telemetry.SetXdsLossState(h.mode, telemetry.XdsLossStateApplied)
+	log.Warnf("xds connection lost for more than %v, %s applied", h.gracePeriod, h.mode)
+}
+
+// connected reverts the mode once the xds connection is recovered
+func (h *xdsLossHandler) connected() {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.lost {
+		return
+	}
+	h.lost = false
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if h.applied {
+		if err := h.enforce(auth.EnforcePolicies); err != nil {
+			log.Errorf("failed to enforce the authorization policies again after recovering the xds connection: %v", err)
+		} else {
+			log.Infof("xds connection recovered, %s reverted", h.mode)
+		}
+		h.applied = false
+	}
+	telemetry.SetXdsLossState(h.mode, telemetry.XdsLossStateConnected)
+}
+
+// authzEnforcer changes the enforcement of rbac, the xdp authorization is suspended meanwhile so
+// that all the connections are authorized in userspace
+func authzEnforcer(loader *bpf.BpfLoader, rbac *auth.Rbac) func(auth.Enforcement) error {
+	var resume func() error
+	return func(enforcement auth.Enforcement) error {
+		if enforcement == auth.EnforcePolicies {
+			rbac.SetEnforcement(enforcement)
+			if resume == nil {
+				return nil
+			}
+			err := resume()
+			resume = nil
+			return err
+		}
+
+		if resume == nil {
+			var err error
+			if resume, err = loader.SuspendAuthzOffload(); err != nil {
+				return err
+			}
+		}
+		rbac.SetEnforcement(enforcement)
+		return nil
+	}
+}
+
+// authzHandoff suspends the xdp authorization while the policies of a response are written to the bpf maps
+// so that the new connections are authorized in userspace, which swaps the policies at once, and resumes it
+// after.
+func authzHandoff(loader *bpf.BpfLoader) func(bool) error {
+	var resume func() error
+	return func(handoff bool) error {
+		if !handoff {
+			if resume == nil {
+				return nil
+			}
+			err := resume()
+			resume = nil
+			return err
+		}
+
+		if resume != nil {
+			return nil
+		}
+		var err error
+		resume, err = loader.SuspendAuthzOffload()
+		return err
+	}
+}
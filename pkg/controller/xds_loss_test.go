@@ -0,0 +1,97 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package controller
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"kmesh.net/kmesh/daemon/options"
+	"kmesh.net/kmesh/pkg/auth"
+)
+
+type fakeEnforcer struct {
+	mutex        sync.Mutex
+	enforcements []auth.Enforcement
+}
+
+func (f *fakeEnforcer) enforce(enforcement auth.Enforcement) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.enforcements = append(f.enforcements, enforcement)
+	return nil
+}
+
+func (f *fakeEnforcer) get() []auth.Enforcement {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return slices.Clone(f.enforcements)
+}
+
+func TestXdsLossHandler(t *testing.T) {
+	const gracePeriod = 50 * time.Millisecond
+
+	tests := []struct {
+		mode string
+		// enforcements applied after a loss longer than the grace period and its recovery
+		want []auth.Enforcement
+	}{
+		{
+			mode: options.XdsLossFailStatic,
+			want: nil,
+		},
+		{
+			mode: options.XdsLossFailOpen,
+			want: []auth.Enforcement{auth.AllowAll, auth.EnforcePolicies},
+		},
+		{
+			mode: options.XdsLossFailClosed,
+			want: []auth.Enforcement{auth.DenyAll, auth.EnforcePolicies},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			enforcer := &fakeEnforcer{}
+			h := newXdsLossHandler(tt.mode, gracePeriod, enforcer.enforce)
+
+			// a loss shorter than the grace period changes nothing
+			h.disconnected()
+			h.connected()
+			time.Sleep(2 * gracePeriod)
+			assert.Empty(t, enforcer.get())
+
+			// the reconnection attempts do not restart the grace period
+			h.disconnected()
+			time.Sleep(gracePeriod / 2)
+			h.disconnected()
+			if len(tt.want) == 0 {
+				time.Sleep(2 * gracePeriod)
+				assert.Empty(t, enforcer.get())
+			} else {
+				assert.Eventually(t, func() bool { return len(enforcer.get()) == 1 }, gracePeriod, time.Millisecond)
+				assert.Equal(t, tt.want[:1], enforcer.get())
+			}
+
+			h.connected()
+			assert.Equal(t, tt.want, enforcer.get())
+		})
+	}
+}
@@ -261,7 +261,10 @@ func (r *DNSResolver) GetDomainAddress(domain string) ([]string, bool) {
 	r.RLock()
 	addresses, ok := r.cache[domain]
 	r.RUnlock()
-	return addresses.Addresses, ok
+	if !ok {
+		return nil, false
+	}
+	return addresses.Addresses, true
 }
 
 func (r *DNSResolver) GetBatchAddressesFromCache(domains map[string]struct{}) map[string]*DomainCacheEntry {
@@ -112,3 +112,13 @@ func (r *DNSResolver) GetDNSAddresses(domain string) []string {
 	}
 	return nil
 }
+
+// NewFakeDNSResolver returns a resolver querying the fake dns server instead of the servers of /etc/resolv.conf
+func NewFakeDNSResolver(s *fakeDNSServer) (*DNSResolver, error) {
+	r, err := NewDNSResolver()
+	if err != nil {
+		return nil, err
+	}
+	r.resolvConfServers = []string{s.Server.PacketConn.LocalAddr().String()}
+	return r, nil
+}
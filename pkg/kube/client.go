@@ -19,15 +19,19 @@ package kube
 import (
 	"context"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	istioclient "istio.io/client-go/pkg/clientset/versioned"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
+	kubescheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/utils/ptr"
 	gatewayapiclient "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
 )
@@ -45,6 +49,9 @@ type Client interface {
 
 	// GatewayAPI returns the gateway-api kube client.
 	GatewayAPI() gatewayapiclient.Interface
+
+	// Istio returns the Istio kube client.
+	Istio() istioclient.Interface
 }
 
 // CLIClient extends the Client interface with additional functionality for CLI operations.
@@ -57,6 +64,10 @@ type CLIClient interface {
 	// NewPortForwarder creates a new PortForwarder configured for the given pod. If localPort=0, a port will be
 	// dynamically selected. If localAddress is empty, "localhost" is used.
 	NewPortForwarder(podName string, ns string, localAddress string, localPort int, podPort int) (PortForwarder, error)
+
+	// PodExec runs the command in the container of the pod, the default one if container is empty, and streams
+	// its output to stdout and stderr until it exits or ctx is done.
+	PodExec(ctx context.Context, podName string, ns string, container string, command []string, stdout, stderr io.Writer) error
 }
 
 func NewCLIClient(opts ...ClientOption) (CLIClient, error) {
@@ -70,6 +81,7 @@ type client struct {
 
 	kube          kubernetes.Interface
 	gatewayapi    gatewayapiclient.Interface
+	istio         istioclient.Interface
 	clientFactory *genericclioptions.ConfigFlags
 }
 
@@ -142,6 +154,11 @@ func newClientInternal(opts ...ClientOption) (*client, error) {
 		return nil, err
 	}
 
+	c.istio, err = istioclient.NewForConfig(c.config)
+	if err != nil {
+		return nil, err
+	}
+
 	return &c, nil
 }
 
@@ -153,8 +170,31 @@ func (c *client) GatewayAPI() gatewayapiclient.Interface {
 	return c.gatewayapi
 }
 
+func (c *client) Istio() istioclient.Interface {
+	return c.istio
+}
+
 func (c *client) PodsForSelector(ctx context.Context, namespace string, labelSelectors ...string) (*v1.PodList, error) {
 	return c.kube.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: strings.Join(labelSelectors, ","),
 	})
 }
+
+func (c *client) PodExec(ctx context.Context, podName string, ns string, container string, command []string, stdout, stderr io.Writer) error {
+	req := c.kube.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(ns).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    stdout != nil,
+			Stderr:    stderr != nil,
+		}, kubescheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(c.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create executor for pod %s/%s: %v", ns, podName, err)
+	}
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+}
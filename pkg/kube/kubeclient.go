@@ -17,6 +17,7 @@
 package kube
 
 import (
+	istioclient "istio.io/client-go/pkg/clientset/versioned"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -27,14 +28,7 @@ import (
 // CreateKubeClient creates a kube client with the given kubeconfig file, if no kubeconfig specified, in cluster kubeconfig will be used.
 // applyFuncs is optional, which can be used to tune client rest.Config
 func CreateKubeClient(kubeConfig string, applyFuncs ...func(c *rest.Config)) (kubernetes.Interface, error) {
-	var restConfig *rest.Config
-	var err error
-
-	if kubeConfig != "" {
-		restConfig, err = clientcmd.BuildConfigFromFlags("", kubeConfig)
-	} else {
-		restConfig, err = rest.InClusterConfig()
-	}
+	restConfig, err := buildRestConfig(kubeConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +40,22 @@ func CreateKubeClient(kubeConfig string, applyFuncs ...func(c *rest.Config)) (ku
 	return kubernetes.NewForConfig(restConfig)
 }
 
+// CreateIstioClient creates an istio client with the given kubeconfig file, the in cluster one if empty
+func CreateIstioClient(kubeConfig string) (istioclient.Interface, error) {
+	restConfig, err := buildRestConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return istioclient.NewForConfig(restConfig)
+}
+
+func buildRestConfig(kubeConfig string) (*rest.Config, error) {
+	if kubeConfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeConfig)
+	}
+	return rest.InClusterConfig()
+}
+
 func GetKmeshNodeInfoClient() (nodeinfo.Interface, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
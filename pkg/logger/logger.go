@@ -130,6 +130,10 @@ func StartLogReader(ctx context.Context, logMapFd *ebpf.Map) {
 
 func handleLogEvents(ctx context.Context, rbMap *ebpf.Map) {
 	log := NewLoggerScope("ebpf")
+	// the kernels without ring buffers are older than 5.13, where the bpf logs go to the trace pipe
+	if rbMap.Type() != ebpf.RingBuf {
+		return
+	}
 	events, err := ringbuf.NewReader(rbMap)
 	if err != nil {
 		log.Errorf("ringbuf new reader from rb map failed:%v", err)
@@ -0,0 +1,397 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/bpf/preflight"
+	"kmesh.net/kmesh/pkg/bpf/verifier"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/logger"
+	"kmesh.net/kmesh/pkg/utils"
+	"kmesh.net/kmesh/pkg/version"
+)
+
+const adminGrpcAddr = "localhost:15201"
+
+// newPrerequisitesProber probes the kernel of the node for CheckPrerequisites
+var newPrerequisitesProber = preflight.NewHostProber
+
+// adminServer implements the KmeshAdmin grpc service on top of the status server,
+// it answers the same requests as the http debug endpoints with typed messages.
+type adminServer struct {
+	adminapi.UnimplementedKmeshAdminServer
+	s *Server
+}
+
+// mode returns the mode the daemon runs in
+func (a *adminServer) mode() adminapi.Mode {
+	client := a.s.xdsClient
+	switch {
+	case client == nil:
+		return adminapi.Mode_MODE_UNSPECIFIED
+	case client.WorkloadController != nil:
+		return adminapi.Mode_DUAL_ENGINE
+	case client.AdsController != nil:
+		return adminapi.Mode_KERNEL_NATIVE
+	}
+	return adminapi.Mode_MODE_UNSPECIFIED
+}
+
+// checkMode resolves an unspecified mode to the running one and fails when they mismatch
+func (a *adminServer) checkMode(mode adminapi.Mode) (adminapi.Mode, error) {
+	running := a.mode()
+	if running == adminapi.Mode_MODE_UNSPECIFIED {
+		return running, grpcstatus.Error(codes.FailedPrecondition, invalidModeErrMessage)
+	}
+	if mode != adminapi.Mode_MODE_UNSPECIFIED && mode != running {
+		return running, grpcstatus.Errorf(codes.FailedPrecondition, "daemon runs in %s mode, not %s", running, mode)
+	}
+	return running, nil
+}
+
+func (a *adminServer) GetAuthz(ctx context.Context, req *adminapi.GetAuthzRequest) (*adminapi.AuthzStatus, error) {
+	if a.s.loader == nil {
+		return nil, grpcstatus.Error(codes.Unavailable, "bpf loader is not running")
+	}
+	return &adminapi.AuthzStatus{Enabled: a.s.loader.GetAuthzOffload() == constants.ENABLED}, nil
+}
+
+func (a *adminServer) SetAuthz(ctx context.Context, req *adminapi.SetAuthzRequest) (*adminapi.AuthzStatus, error) {
+	if a.s.loader == nil {
+		return nil, grpcstatus.Error(codes.Unavailable, "bpf loader is not running")
+	}
+	authzOffload := uint32(constants.DISABLED)
+	if req.GetEnabled() {
+		authzOffload = constants.ENABLED
+	}
+	if err := a.s.loader.UpdateAuthzOffload(authzOffload); err != nil {
+		return nil, grpcstatus.Errorf(codes.Internal, "update bpf authz failed: %v", err)
+	}
+	return &adminapi.AuthzStatus{Enabled: req.GetEnabled()}, nil
+}
+
+func (a *adminServer) ConfigDump(ctx context.Context, req *adminapi.ConfigDumpRequest) (*adminapi.ConfigDumpResponse, error) {
+	mode, err := a.checkMode(req.GetMode())
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if mode == adminapi.Mode_DUAL_ENGINE {
+		data, err = json.MarshalIndent(a.s.workloadDump(), "", "    ")
+	} else {
+		data, err = protojson.MarshalOptions{Multiline: true}.Marshal(a.s.adsConfigDump())
+	}
+	if err != nil {
+		return nil, grpcstatus.Errorf(codes.Internal, "failed to marshal config dump: %v", err)
+	}
+	return &adminapi.ConfigDumpResponse{Mode: mode, Json: string(data)}, nil
+}
+
+func (a *adminServer) BpfMapDump(ctx context.Context, req *adminapi.BpfMapDumpRequest) (*adminapi.BpfMapDumpResponse, error) {
+	mode, err := a.checkMode(req.GetMode())
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if mode == adminapi.Mode_DUAL_ENGINE {
+		data, err = json.MarshalIndent(a.s.workloadBpfDump(), "", "    ")
+	} else {
+		data, err = protojson.MarshalOptions{Multiline: true}.Marshal(a.s.adsBpfDump())
+	}
+	if err != nil {
+		return nil, grpcstatus.Errorf(codes.Internal, "failed to marshal bpf map dump: %v", err)
+	}
+	return &adminapi.BpfMapDumpResponse{Mode: mode, Json: string(data)}, nil
+}
+
+func (a *adminServer) ListLoggers(ctx context.Context, req *adminapi.ListLoggersRequest) (*adminapi.ListLoggersResponse, error) {
+	return &adminapi.ListLoggersResponse{Names: append(logger.GetLoggerNames(), bpfLoggerName)}, nil
+}
+
+func (a *adminServer) GetLoggerLevel(ctx context.Context, req *adminapi.GetLoggerLevelRequest) (*adminapi.LoggerLevel, error) {
+	name := req.GetName()
+	if name == bpfLoggerName {
+		if a.s.loader == nil {
+			return nil, grpcstatus.Error(codes.Unavailable, "bpf loader is not running")
+		}
+		info, err := a.s.getBpfLogLevel()
+		if err != nil {
+			return nil, grpcstatus.Error(codes.Internal, err.Error())
+		}
+		return &adminapi.LoggerLevel{Name: info.Name, Level: info.Level}, nil
+	}
+
+	level, err := logger.GetLoggerLevel(name)
+	if err != nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	return &adminapi.LoggerLevel{Name: name, Level: level.String()}, nil
+}
+
+func (a *adminServer) SetLoggerLevel(ctx context.Context, req *adminapi.LoggerLevel) (*adminapi.LoggerLevel, error) {
+	name := req.GetName()
+	if name == bpfLoggerName {
+		if a.s.loader == nil {
+			return nil, grpcstatus.Error(codes.Unavailable, "bpf loader is not running")
+		}
+		level, err := parseBpfLogLevel(req.GetLevel())
+		if err != nil {
+			return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := a.s.loader.UpdateBpfLogLevel(uint32(level)); err != nil {
+			return nil, grpcstatus.Errorf(codes.Internal, "update bpf log level error: %v", err)
+		}
+		return a.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: name})
+	}
+
+	level, err := logrus.ParseLevel(req.GetLevel())
+	if err != nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := logger.SetLoggerLevel(name, level); err != nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	return &adminapi.LoggerLevel{Name: name, Level: level.String()}, nil
+}
+
+func (a *adminServer) ExplainAuthz(ctx context.Context, req *adminapi.ExplainAuthzRequest) (*adminapi.AuthzExplanation, error) {
+	// authorization policies only apply in dual-engine mode
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		return nil, err
+	}
+	src, err := netip.ParseAddr(req.GetSrc())
+	if err != nil {
+		return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid source ip: %v", err)
+	}
+	dst, err := netip.ParseAddr(req.GetDst())
+	if err != nil {
+		return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid destination ip: %v", err)
+	}
+	if req.GetPort() == 0 || req.GetPort() > 65535 {
+		return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid destination port %d", req.GetPort())
+	}
+
+	var candidate *security.Authorization
+	if req.GetPolicyJson() != "" {
+		candidate = &security.Authorization{}
+		if err := protojson.Unmarshal([]byte(req.GetPolicyJson()), candidate); err != nil {
+			return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid candidate policy: %v", err)
+		}
+	}
+
+	verdict := a.s.xdsClient.WorkloadController.Rbac.ExplainWith(src, dst, req.GetPort(), candidate,
+		req.GetPolicySelectsDestination())
+	resp := &adminapi.AuthzExplanation{
+		Allowed:             verdict.Allowed,
+		Reason:              verdict.Reason,
+		Rule:                int32(verdict.Rule),
+		SourceIdentity:      verdict.SrcIdentity,
+		DestinationWorkload: verdict.DstWorkload,
+	}
+	if policy := verdict.Policy; policy != nil {
+		resp.Policy = policy.ResourceName()
+		resp.Action = policy.GetAction().String()
+		data, err := protojson.MarshalOptions{Multiline: true}.Marshal(policy.GetRules()[verdict.Rule])
+		if err != nil {
+			return nil, grpcstatus.Errorf(codes.Internal, "failed to marshal rule: %v", err)
+		}
+		resp.RuleJson = string(data)
+	}
+	return resp, nil
+}
+
+func (a *adminServer) GetServiceLoad(ctx context.Context, req *adminapi.GetServiceLoadRequest) (*adminapi.GetServiceLoadResponse, error) {
+	// connections are only counted per service in dual-engine mode
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		return nil, err
+	}
+	metricController := a.s.xdsClient.WorkloadController.MetricController
+	if metricController == nil {
+		return nil, grpcstatus.Error(codes.Unavailable, "metric controller is not running")
+	}
+
+	resp := &adminapi.GetServiceLoadResponse{MonitoringEnabled: metricController.EnableMonitoring.Load()}
+	for _, load := range metricController.ServiceLoad.Loads(req.GetNamespace(), req.GetName()) {
+		resp.Loads = append(resp.Loads, &adminapi.ServiceLoad{
+			Namespace:         load.Namespace,
+			Name:              load.Name,
+			Reporter:          load.Reporter,
+			ActiveConnections: load.ActiveConnections,
+			OpenedConnections: load.OpenedConnections,
+			ConnectionRate:    load.ConnectionRate,
+		})
+	}
+	return resp, nil
+}
+
+func (a *adminServer) ListConnections(ctx context.Context, req *adminapi.ListConnectionsRequest) (*adminapi.ListConnectionsResponse, error) {
+	// connections are only reported in dual-engine mode
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		return nil, err
+	}
+	metricController := a.s.xdsClient.WorkloadController.MetricController
+	if metricController == nil {
+		return nil, grpcstatus.Error(codes.Unavailable, "metric controller is not running")
+	}
+	var src, dst netip.Addr
+	var err error
+	if req.GetSrc() != "" {
+		if src, err = netip.ParseAddr(req.GetSrc()); err != nil {
+			return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid source ip: %v", err)
+		}
+	}
+	if req.GetDst() != "" {
+		if dst, err = netip.ParseAddr(req.GetDst()); err != nil {
+			return nil, grpcstatus.Errorf(codes.InvalidArgument, "invalid destination ip: %v", err)
+		}
+	}
+
+	resp := &adminapi.ListConnectionsResponse{MonitoringEnabled: metricController.EnableMonitoring.Load()}
+	now := time.Now()
+	for _, conn := range metricController.ConnTracker.Connections(src, dst) {
+		resp.Connections = append(resp.Connections, &adminapi.Connection{
+			Protocol:    "tcp",
+			Source:      conn.Source.String(),
+			Destination: conn.Destination.String(),
+			Backend:     conn.Backend.String(),
+			Direction:   conn.Direction,
+			State:       conn.State,
+			AgeMs:       now.Sub(conn.StartTime).Milliseconds(),
+		})
+	}
+	return resp, nil
+}
+
+// CheckPrerequisites probes the kernel of the node, it does not depend on the bpf programs being loaded
+func (a *adminServer) CheckPrerequisites(ctx context.Context, req *adminapi.CheckPrerequisitesRequest) (*adminapi.PrerequisitesReport, error) {
+	report := preflight.Run(newPrerequisitesProber())
+	check := verifierCheck()
+	report.Checks = append(report.Checks, check)
+	report.Passed = report.Passed && check.Passed
+	resp := &adminapi.PrerequisitesReport{Passed: report.Passed}
+	for _, check := range report.Checks {
+		resp.Checks = append(resp.Checks, &adminapi.PrerequisiteCheck{
+			Name:        check.Name,
+			Passed:      check.Passed,
+			Message:     check.Message,
+			Remediation: check.Remediation,
+		})
+	}
+	return resp, nil
+}
+
+// verifierCheck reports the bpf programs of the daemon the kernel verifier rejected
+func verifierCheck() preflight.CheckResult {
+	failures := verifier.Failures()
+	if len(failures) == 0 {
+		return preflight.CheckResult{Name: "bpf verifier", Passed: true, Message: "no bpf program rejected"}
+	}
+	messages := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		messages = append(messages, failure.Format())
+	}
+	return preflight.CheckResult{
+		Name:        "bpf verifier",
+		Message:     strings.Join(messages, "\n"),
+		Remediation: "the kernel does not accept the bpf programs of this kmesh version, run a supported kernel or report the verifier log",
+	}
+}
+
+// ListEnrolledWorkloads returns the pods of the node that should be managed by kmesh and their enrollment
+func (a *adminServer) ListEnrolledWorkloads(ctx context.Context, req *adminapi.ListEnrolledWorkloadsRequest) (*adminapi.ListEnrolledWorkloadsResponse, error) {
+	if a.s.enrollments == nil {
+		return nil, grpcstatus.Error(codes.Unavailable, "kmesh manage controller is not running")
+	}
+
+	resp := &adminapi.ListEnrolledWorkloadsResponse{}
+	for _, e := range a.s.enrollments.List(req.GetNamespace(), req.GetName()) {
+		workload := &adminapi.EnrolledWorkload{
+			Namespace: e.Namespace,
+			Name:      e.Name,
+			Mode:      adminapi.Mode_MODE_UNSPECIFIED,
+			Error:     e.Error,
+		}
+		switch e.Mode {
+		case constants.KernelNativeMode:
+			workload.Mode = adminapi.Mode_KERNEL_NATIVE
+		case constants.DualEngineMode:
+			workload.Mode = adminapi.Mode_DUAL_ENGINE
+		}
+		if !e.EnrolledAt.IsZero() {
+			workload.EnrolledAt = e.EnrolledAt.Unix()
+		}
+		resp.Workloads = append(resp.Workloads, workload)
+	}
+	return resp, nil
+}
+
+func (a *adminServer) SimulateLocality(ctx context.Context, req *adminapi.SimulateLocalityRequest) (*adminapi.LocalitySimulation, error) {
+	// endpoints are only ranked by locality in dual-engine mode
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		return nil, err
+	}
+	if req.GetName() == "" || req.GetClientNode() == "" {
+		return nil, grpcstatus.Error(codes.InvalidArgument, "service name and client node are required")
+	}
+
+	simulation, err := a.s.xdsClient.WorkloadController.Processor.SimulateLocality(req.GetNamespace(), req.GetName(), req.GetClientNode())
+	if err != nil {
+		return nil, grpcstatus.Error(codes.NotFound, err.Error())
+	}
+	resp := &adminapi.LocalitySimulation{
+		Mode:           simulation.Mode.String(),
+		ClientLocality: simulation.ClientLocality,
+	}
+	for _, tier := range simulation.Tiers {
+		t := &adminapi.LocalityTier{Priority: tier.Priority, Load: tier.Load}
+		for _, ep := range tier.Endpoints {
+			t.Endpoints = append(t.Endpoints, &adminapi.LocalityEndpoint{
+				Namespace: ep.Namespace,
+				Name:      ep.Name,
+				Address:   ep.Address,
+				Node:      ep.Node,
+				Locality:  ep.Locality,
+				Healthy:   ep.Healthy,
+			})
+		}
+		resp.Tiers = append(resp.Tiers, t)
+	}
+	return resp, nil
+}
+
+func (a *adminServer) GetStatus(ctx context.Context, req *adminapi.GetStatusRequest) (*adminapi.DaemonStatus, error) {
+	return &adminapi.DaemonStatus{
+		Mode:    a.mode(),
+		Version: version.Get().GitVersion,
+		Kernel:  utils.GetKernelVersion(),
+	}, nil
+}
@@ -0,0 +1,414 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	bpf2go "kmesh.net/kmesh/bpf/kmesh/bpf2go/dualengine"
+	"kmesh.net/kmesh/pkg/adminclient"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/bpf/preflight"
+	"kmesh.net/kmesh/pkg/bpf/verifier"
+	"kmesh.net/kmesh/pkg/constants"
+	"kmesh.net/kmesh/pkg/controller"
+	"kmesh.net/kmesh/pkg/controller/ads"
+	manage "kmesh.net/kmesh/pkg/controller/manage"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/workload"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+	"kmesh.net/kmesh/pkg/logger"
+	"kmesh.net/kmesh/pkg/version"
+)
+
+// newTestAdminClient serves the admin api of server in process and returns a client of it
+func newTestAdminClient(t *testing.T, server *Server) *adminclient.Client {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	adminapi.RegisterKmeshAdminServer(srv, &adminServer{s: server})
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+
+	c, err := adminclient.New("passthrough:///bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestAdminServer_loggers(t *testing.T) {
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{},
+		},
+	})
+	ctx := context.Background()
+
+	resp, err := client.ListLoggers(ctx, &adminapi.ListLoggersRequest{})
+	require.NoError(t, err)
+	expectedLoggerNames := append(logger.GetLoggerNames(), bpfLoggerName)
+	actualLoggerNames := resp.GetNames()
+	sort.Strings(expectedLoggerNames)
+	sort.Strings(actualLoggerNames)
+	assert.Equal(t, expectedLoggerNames, actualLoggerNames)
+
+	level, err := client.SetLoggerLevel(ctx, &adminapi.LoggerLevel{Name: "default", Level: logrus.DebugLevel.String()})
+	require.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel.String(), level.GetLevel())
+
+	level, err = client.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: "default"})
+	require.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel.String(), level.GetLevel())
+
+	_, err = client.SetLoggerLevel(ctx, &adminapi.LoggerLevel{Name: "default", Level: "verbose"})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+
+	_, err = client.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: "not-exist"})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+
+	// the bpf logger and authz live in the bpf maps, which are not loaded here
+	_, err = client.GetLoggerLevel(ctx, &adminapi.GetLoggerLevelRequest{Name: bpfLoggerName})
+	assert.Equal(t, codes.Unavailable, grpcstatus.Code(err))
+	_, err = client.GetAuthz(ctx, &adminapi.GetAuthzRequest{})
+	assert.Equal(t, codes.Unavailable, grpcstatus.Code(err))
+}
+
+func TestAdminServer_configDump(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{
+				Processor: &workload.Processor{
+					WorkloadCache: workloadCache,
+					ServiceCache:  cache.NewServiceCache(),
+				},
+				Rbac: auth.NewRbac(workloadCache),
+			},
+		},
+	})
+	ctx := context.Background()
+
+	for _, mode := range []adminapi.Mode{adminapi.Mode_MODE_UNSPECIFIED, adminapi.Mode_DUAL_ENGINE} {
+		resp, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: mode})
+		require.NoError(t, err)
+		assert.Equal(t, adminapi.Mode_DUAL_ENGINE, resp.GetMode())
+
+		var dump WorkloadDump
+		require.NoError(t, json.Unmarshal([]byte(resp.GetJson()), &dump))
+		assert.Empty(t, dump.Workloads)
+		assert.Empty(t, dump.Services)
+		assert.Empty(t, dump.Policies)
+	}
+
+	_, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_KERNEL_NATIVE})
+	assert.Equal(t, codes.FailedPrecondition, grpcstatus.Code(err))
+	_, err = client.BpfMapDump(ctx, &adminapi.BpfMapDumpRequest{Mode: adminapi.Mode_KERNEL_NATIVE})
+	assert.Equal(t, codes.FailedPrecondition, grpcstatus.Code(err))
+}
+
+func TestAdminServer_explainAuthz(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	workloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+		Uid:       "cluster0//Pod/default/httpbin",
+		Namespace: "default",
+		Addresses: [][]byte{{10, 244, 0, 2}},
+	})
+	rbac := auth.NewRbac(workloadCache)
+	require.NoError(t, rbac.UpdatePolicy(&security.Authorization{
+		Name:      "deny-8080",
+		Namespace: "default",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+		Rules: []*security.Rule{{
+			Clauses: []*security.Clause{{
+				Matches: []*security.Match{{DestinationPorts: []uint32{8080}}},
+			}},
+		}},
+	}))
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{Rbac: rbac},
+		},
+	})
+	ctx := context.Background()
+
+	resp, err := client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 8080})
+	require.NoError(t, err)
+	assert.False(t, resp.GetAllowed())
+	assert.Equal(t, "default/deny-8080", resp.GetPolicy())
+	assert.Equal(t, "DENY", resp.GetAction())
+	assert.Equal(t, int32(0), resp.GetRule())
+	assert.Contains(t, resp.GetRuleJson(), "destinationPorts")
+	assert.Equal(t, "cluster0//Pod/default/httpbin", resp.GetDestinationWorkload())
+
+	resp, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 9090})
+	require.NoError(t, err)
+	assert.True(t, resp.GetAllowed())
+	assert.Empty(t, resp.GetPolicy())
+
+	_, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "httpbin", Port: 8080})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+
+	// a candidate replacing the loaded policy is evaluated without being applied
+	candidate := `{"name":"deny-8080","namespace":"default","scope":"NAMESPACE","action":"DENY",
+		"rules":[{"clauses":[{"matches":[{"destinationPorts":[9090]}]}]}]}`
+	resp, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 9090, PolicyJson: candidate})
+	require.NoError(t, err)
+	assert.False(t, resp.GetAllowed())
+	assert.Equal(t, "default/deny-8080", resp.GetPolicy())
+	resp, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 8080, PolicyJson: candidate})
+	require.NoError(t, err)
+	assert.True(t, resp.GetAllowed())
+	resp, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 8080})
+	require.NoError(t, err)
+	assert.False(t, resp.GetAllowed())
+
+	_, err = client.ExplainAuthz(ctx, &adminapi.ExplainAuthzRequest{Src: "10.244.0.3", Dst: "10.244.0.2", Port: 8080, PolicyJson: "{"})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+}
+
+func TestAdminServer_serviceLoad(t *testing.T) {
+	workloadCache := cache.NewWorkloadCache()
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{
+				MetricController: telemetry.NewMetric(workloadCache, cache.NewServiceCache(), false),
+			},
+		},
+	})
+	ctx := context.Background()
+
+	resp, err := client.GetServiceLoad(ctx, &adminapi.GetServiceLoadRequest{Namespace: "default", Name: "foo"})
+	require.NoError(t, err)
+	assert.False(t, resp.GetMonitoringEnabled())
+	assert.Empty(t, resp.GetLoads())
+
+	client = newTestAdminClient(t, &Server{})
+	_, err = client.GetServiceLoad(ctx, &adminapi.GetServiceLoadRequest{})
+	assert.Equal(t, codes.FailedPrecondition, grpcstatus.Code(err))
+}
+
+func TestAdminServer_listConnections(t *testing.T) {
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{
+				MetricController: telemetry.NewMetric(cache.NewWorkloadCache(), cache.NewServiceCache(), true),
+			},
+		},
+	})
+	ctx := context.Background()
+
+	resp, err := client.ListConnections(ctx, &adminapi.ListConnectionsRequest{Src: "10.244.0.5", Dst: "10.96.0.10"})
+	require.NoError(t, err)
+	assert.True(t, resp.GetMonitoringEnabled())
+	assert.Empty(t, resp.GetConnections())
+
+	_, err = client.ListConnections(ctx, &adminapi.ListConnectionsRequest{Dst: "foo"})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+
+	client = newTestAdminClient(t, &Server{})
+	_, err = client.ListConnections(ctx, &adminapi.ListConnectionsRequest{})
+	assert.Equal(t, codes.FailedPrecondition, grpcstatus.Code(err))
+}
+
+func TestAdminServer_simulateLocality(t *testing.T) {
+	processor := workload.NewProcessor(bpf2go.KmeshCgroupSockWorkloadMaps{})
+	processor.ServiceCache.AddOrUpdateService(&workloadapi.Service{
+		Name:      "foo",
+		Namespace: "default",
+		Hostname:  "foo.default.svc.cluster.local",
+		LoadBalancing: &workloadapi.LoadBalancing{
+			Mode:              workloadapi.LoadBalancing_FAILOVER,
+			RoutingPreference: []workloadapi.LoadBalancing_Scope{workloadapi.LoadBalancing_NODE},
+		},
+	})
+	for _, node := range []string{"node1", "node2"} {
+		processor.WorkloadCache.AddOrUpdateWorkload(&workloadapi.Workload{
+			Uid:       "cluster0//Pod/default/foo-" + node,
+			Name:      "foo-" + node,
+			Namespace: "default",
+			Node:      node,
+			Addresses: [][]byte{{10, 244, 0, byte(len(node))}},
+			Services:  map[string]*workloadapi.PortList{"default/foo.default.svc.cluster.local": {}},
+		})
+	}
+	client := newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{Processor: processor},
+		},
+	})
+	ctx := context.Background()
+
+	resp, err := client.SimulateLocality(ctx, &adminapi.SimulateLocalityRequest{Namespace: "default", Name: "foo", ClientNode: "node2"})
+	require.NoError(t, err)
+	assert.Equal(t, "FAILOVER", resp.GetMode())
+	require.Len(t, resp.GetTiers(), 2)
+	assert.Equal(t, uint32(100), resp.GetTiers()[0].GetLoad())
+	assert.Equal(t, "foo-node2", resp.GetTiers()[0].GetEndpoints()[0].GetName())
+	assert.Equal(t, uint32(1), resp.GetTiers()[1].GetPriority())
+	assert.Equal(t, "foo-node1", resp.GetTiers()[1].GetEndpoints()[0].GetName())
+
+	_, err = client.SimulateLocality(ctx, &adminapi.SimulateLocalityRequest{Namespace: "default", Name: "bar", ClientNode: "node2"})
+	assert.Equal(t, codes.NotFound, grpcstatus.Code(err))
+	_, err = client.SimulateLocality(ctx, &adminapi.SimulateLocalityRequest{Namespace: "default", Name: "foo"})
+	assert.Equal(t, codes.InvalidArgument, grpcstatus.Code(err))
+}
+
+// oldKernelProber is a kernel without ringbuf
+type oldKernelProber struct{}
+
+func (oldKernelProber) KernelVersion() string { return "5.4.0-150-generic" }
+
+func (oldKernelProber) HaveProgramType(ebpf.ProgramType) error { return nil }
+
+func (oldKernelProber) HaveMapType(mt ebpf.MapType) error {
+	if mt == ebpf.RingBuf {
+		return ebpf.ErrNotSupported
+	}
+	return nil
+}
+
+func (oldKernelProber) Filesystems() ([]string, error) { return []string{"cgroup2"}, nil }
+
+func TestAdminServer_checkPrerequisites(t *testing.T) {
+	newPrerequisitesProber = func() preflight.Prober { return oldKernelProber{} }
+	t.Cleanup(func() { newPrerequisitesProber = preflight.NewHostProber })
+
+	// the daemon does not need to run a mode
+	client := newTestAdminClient(t, &Server{})
+	resp, err := client.CheckPrerequisites(context.Background(), &adminapi.CheckPrerequisitesRequest{})
+	require.NoError(t, err)
+	assert.False(t, resp.GetPassed())
+	failed := map[string]string{}
+	for _, check := range resp.GetChecks() {
+		if !check.GetPassed() {
+			failed[check.GetName()] = check.GetRemediation()
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"kernel version":  "upgrade the kernel to 5.10 or later",
+		"bpf map ringbuf": "upgrade the kernel to 5.8 or later",
+	}, failed)
+}
+
+func TestAdminServer_checkPrerequisitesVerifier(t *testing.T) {
+	newPrerequisitesProber = func() preflight.Prober { return oldKernelProber{} }
+	t.Cleanup(func() { newPrerequisitesProber = preflight.NewHostProber })
+
+	t.Cleanup(verifier.Reset)
+
+	client := newTestAdminClient(t, &Server{})
+	resp, err := client.CheckPrerequisites(context.Background(), &adminapi.CheckPrerequisitesRequest{})
+	require.NoError(t, err)
+	checks := resp.GetChecks()
+	require.NotEmpty(t, checks)
+	assert.Equal(t, "bpf verifier", checks[len(checks)-1].GetName())
+	assert.True(t, checks[len(checks)-1].GetPassed())
+
+	ve := &ebpf.VerifierError{Cause: syscall.EACCES, Log: []string{"0: (95) exit", "R0 !read_ok"}}
+	require.NotNil(t, verifier.Record(fmt.Errorf("program cgroup_connect4_prog: %w", ve)))
+	resp, err = client.CheckPrerequisites(context.Background(), &adminapi.CheckPrerequisitesRequest{})
+	require.NoError(t, err)
+	assert.False(t, resp.GetPassed())
+	checks = resp.GetChecks()
+	check := checks[len(checks)-1]
+	assert.False(t, check.GetPassed())
+	assert.Contains(t, check.GetMessage(), "bpf program cgroup_connect4_prog rejected by the verifier")
+	assert.Contains(t, check.GetMessage(), "\n  R0 !read_ok")
+}
+
+func TestAdminServer_listEnrolledWorkloads(t *testing.T) {
+	client := newTestAdminClient(t, &Server{})
+	_, err := client.ListEnrolledWorkloads(context.Background(), &adminapi.ListEnrolledWorkloadsRequest{})
+	assert.Equal(t, codes.Unavailable, grpcstatus.Code(err))
+
+	enrollments := manage.NewEnrollmentStore()
+	enrollments.Record("default", "sleep", constants.DualEngineMode, true, nil)
+	enrollments.Record("default", "httpbin", constants.DualEngineMode, true, errors.New("failed to link xdp"))
+	enrollments.Record("foo", "sleep", constants.DualEngineMode, false, errors.New("failed to enable Kmesh manage: no such file"))
+	enrollments.Record("foo", "removed", constants.DualEngineMode, true, nil)
+	enrollments.Remove("foo", "removed")
+
+	client = newTestAdminClient(t, &Server{enrollments: enrollments})
+	resp, err := client.ListEnrolledWorkloads(context.Background(), &adminapi.ListEnrolledWorkloadsRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetWorkloads(), 3)
+	names := []string{}
+	for _, w := range resp.GetWorkloads() {
+		names = append(names, w.GetNamespace()+"/"+w.GetName())
+		assert.Equal(t, adminapi.Mode_DUAL_ENGINE, w.GetMode())
+	}
+	assert.Equal(t, []string{"default/httpbin", "default/sleep", "foo/sleep"}, names)
+	assert.NotZero(t, resp.GetWorkloads()[0].GetEnrolledAt())
+	assert.Equal(t, "failed to link xdp", resp.GetWorkloads()[0].GetError())
+	assert.Empty(t, resp.GetWorkloads()[1].GetError())
+	// never managed
+	assert.Zero(t, resp.GetWorkloads()[2].GetEnrolledAt())
+
+	resp, err = client.ListEnrolledWorkloads(context.Background(), &adminapi.ListEnrolledWorkloadsRequest{Name: "sleep"})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetWorkloads(), 2)
+	resp, err = client.ListEnrolledWorkloads(context.Background(), &adminapi.ListEnrolledWorkloadsRequest{Namespace: "foo", Name: "sleep"})
+	require.NoError(t, err)
+	require.Len(t, resp.GetWorkloads(), 1)
+	assert.Equal(t, "failed to enable Kmesh manage: no such file", resp.GetWorkloads()[0].GetError())
+}
+
+func TestAdminServer_getStatus(t *testing.T) {
+	ctx := context.Background()
+
+	// the mode is the one of the controller running, not of the flag
+	resp, err := newTestAdminClient(t, &Server{}).GetStatus(ctx, &adminapi.GetStatusRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.Mode_MODE_UNSPECIFIED, resp.GetMode())
+	assert.NotEmpty(t, resp.GetKernel())
+
+	resp, err = newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{AdsController: &ads.Controller{}},
+	}).GetStatus(ctx, &adminapi.GetStatusRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.Mode_KERNEL_NATIVE, resp.GetMode())
+
+	resp, err = newTestAdminClient(t, &Server{
+		xdsClient: &controller.XdsClient{WorkloadController: &workload.Controller{}},
+	}).GetStatus(ctx, &adminapi.GetStatusRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, adminapi.Mode_DUAL_ENGINE, resp.GetMode())
+	assert.Equal(t, version.Get().GitVersion, resp.GetVersion())
+}
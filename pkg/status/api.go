@@ -21,9 +21,11 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"time"
 
 	"kmesh.net/kmesh/api/v2/workloadapi"
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/controller/workload"
 	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
 	"kmesh.net/kmesh/pkg/nets"
 	"kmesh.net/kmesh/pkg/utils"
@@ -209,6 +211,17 @@ type BpfServiceValue struct {
 	TargetPort    prettyArray[uint32] `json:"targetPort,omitempty"`
 	WaypointAddr  string              `json:"waypointAddr,omitempty"`
 	WaypointPort  uint32              `json:"waypointPort,omitempty"`
+	// LbAlgorithm is the algorithm picking the endpoints within a priority, empty for random
+	LbAlgorithm string `json:"lbAlgorithm,omitempty"`
+	// Unavailable is set while the service has fewer healthy endpoints than its kmesh.net/min-healthy-endpoints
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// lbAlgorithmNames names the algorithms of the kmesh.net/load-balancer annotation
+var lbAlgorithmNames = map[uint32]string{
+	bpfcache.LbAlgorithmRoundRobin: "ROUND_ROBIN",
+	bpfcache.LbAlgorithmLeastConn:  "LEAST_CONN",
+	bpfcache.LbAlgorithmRingHash:   "RING_HASH",
 }
 
 type BpfBackendValue struct {
@@ -217,6 +230,12 @@ type BpfBackendValue struct {
 	Services     []string `json:"services"`
 	WaypointAddr string   `json:"waypointAddr,omitempty"`
 	WaypointPort uint32   `json:"waypointPort,omitempty"`
+	// ConnectFailures is the number of connections to the backend which failed to establish in a row
+	ConnectFailures uint32 `json:"connectFailures,omitempty"`
+	// EjectedBy lists the services whose outlier detection currently ejects the backend
+	EjectedBy []string `json:"ejectedBy,omitempty"`
+	// ActiveConnections is the number of connections to the backend counted by the least connection load balancing
+	ActiveConnections uint32 `json:"activeConnections,omitempty"`
 }
 
 type BpfFrontendValue struct {
@@ -231,6 +250,18 @@ type BpfEndpointValue struct {
 	BackendUid string `json:"backendUid,omitempty"`
 }
 
+// EndpointHealth is the health of an endpoint as last received from xds
+type EndpointHealth struct {
+	Uid       string   `json:"uid"`
+	Addresses []string `json:"addresses,omitempty"`
+	Healthy   bool     `json:"healthy"`
+	// LastHealthy is when the endpoint was last observed healthy in RFC 3339, empty if never
+	LastHealthy string `json:"lastHealthy,omitempty"`
+	// LastTransition is when the health of the endpoint last changed in RFC 3339, empty if it never did
+	LastTransition string `json:"lastTransition,omitempty"`
+	Transitions    uint32 `json:"transitions,omitempty"`
+}
+
 type WorkloadBpfDump struct {
 	hashName *utils.HashName
 
@@ -239,6 +270,7 @@ type WorkloadBpfDump struct {
 	Endpoints        []BpfEndpointValue       `json:"endpoints"`
 	Frontends        []BpfFrontendValue       `json:"frontends"`
 	Services         []BpfServiceValue        `json:"services"`
+	EndpointHealth   []EndpointHealth         `json:"endpointHealth,omitempty"`
 }
 
 func NewWorkloadBpfDump(hashName *utils.HashName) WorkloadBpfDump {
@@ -260,7 +292,8 @@ func (wd WorkloadBpfDump) WithWorkloadPolicies(workloadPolicies []bpfcache.Workl
 	return wd
 }
 
-func (wd WorkloadBpfDump) WithBackends(backends []bpfcache.BackendValue) WorkloadBpfDump {
+// WithBackends converts the backends, ejectedBy returns the ids of the services ejecting a backend
+func (wd WorkloadBpfDump) WithBackends(backends []bpfcache.BackendValue, ejectedBy func(*bpfcache.BackendValue) []uint32) WorkloadBpfDump {
 	converted := make([]BpfBackendValue, 0, len(backends))
 	for _, backend := range backends {
 		waypointAddr := ""
@@ -268,10 +301,15 @@ func (wd WorkloadBpfDump) WithBackends(backends []bpfcache.BackendValue) Workloa
 			waypointAddr = nets.IpString(backend.WaypointAddr)
 		}
 		bac := BpfBackendValue{
-			Ip:           nets.IpString(backend.Ip),
-			ServiceCount: backend.ServiceCount,
-			WaypointAddr: waypointAddr,
-			WaypointPort: nets.ConvertPortToLittleEndian(backend.WaypointPort),
+			Ip:                nets.IpString(backend.Ip),
+			ServiceCount:      backend.ServiceCount,
+			WaypointAddr:      waypointAddr,
+			WaypointPort:      nets.ConvertPortToLittleEndian(backend.WaypointPort),
+			ConnectFailures:   backend.ConnectFailCount,
+			ActiveConnections: backend.ActiveConnections,
+		}
+		for _, id := range ejectedBy(&backend) {
+			bac.EjectedBy = append(bac.EjectedBy, wd.hashName.NumToStr(id))
 		}
 		services := make([]string, 0, len(backend.Services))
 		for _, s := range backend.Services {
@@ -288,6 +326,29 @@ func (wd WorkloadBpfDump) WithBackends(backends []bpfcache.BackendValue) Workloa
 	return wd
 }
 
+// WithEndpointHealth adds the health of the endpoints recorded by the workload controller
+func (wd WorkloadBpfDump) WithEndpointHealth(health []workload.EndpointHealth) WorkloadBpfDump {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	converted := make([]EndpointHealth, 0, len(health))
+	for _, h := range health {
+		converted = append(converted, EndpointHealth{
+			Uid:            h.Uid,
+			Addresses:      h.Addresses,
+			Healthy:        h.Healthy,
+			LastHealthy:    formatTime(h.LastHealthy),
+			LastTransition: formatTime(h.LastTransition),
+			Transitions:    h.Transitions,
+		})
+	}
+	wd.EndpointHealth = converted
+	return wd
+}
+
 func (wd WorkloadBpfDump) WithEndpoints(endpoints []bpfcache.EndpointValue) WorkloadBpfDump {
 	converted := make([]BpfEndpointValue, 0, len(endpoints))
 	for _, endpoint := range endpoints {
@@ -322,6 +383,8 @@ func (wd WorkloadBpfDump) WithServices(services []bpfcache.ServiceValue) Workloa
 			LbPolicy:      workloadapi.LoadBalancing_Mode_name[int32(s.LbPolicy)],
 			WaypointAddr:  waypointAddr,
 			WaypointPort:  nets.ConvertPortToLittleEndian(s.WaypointPort),
+			LbAlgorithm:   lbAlgorithmNames[s.LbAlgorithm],
+			Unavailable:   s.Unavailable != 0,
 		}
 
 		for _, c := range s.EndpointCount {
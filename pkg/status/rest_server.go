@@ -0,0 +1,191 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+)
+
+const (
+	adminRestAddr = "localhost:15203"
+
+	restPrefix        = "/api/v1"
+	patternRestSvcs   = restPrefix + "/services"
+	patternRestEps    = restPrefix + "/endpoints"
+	patternRestAuthz  = restPrefix + "/authz"
+	patternRestMetric = restPrefix + "/metrics"
+)
+
+// RestAuthz is the authorization state of the node served by the REST admin api
+type RestAuthz struct {
+	// Offload is whether the authorization is enforced in xdp, nil when the bpf loader is not running
+	Offload  *bool                  `json:"offload,omitempty"`
+	Policies []*AuthorizationPolicy `json:"policies"`
+}
+
+// newAdminRestServer serves the read-only REST admin api for the dashboards, its clients must send
+// the token as a bearer token. It answers from the same data as the grpc admin api.
+func newAdminRestServer(s *Server, tokenFile string) (*http.Server, error) {
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the token of the REST admin api: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s of the REST admin api is empty", tokenFile)
+	}
+	return &http.Server{
+		Addr:         adminRestAddr,
+		Handler:      newAdminRestHandler(&adminServer{s: s}, token),
+		ReadTimeout:  httpTimeout,
+		WriteTimeout: httpTimeout,
+	}, nil
+}
+
+func newAdminRestHandler(a *adminServer, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(patternRestSvcs, a.restServices)
+	mux.HandleFunc(patternRestEps, a.restEndpoints)
+	mux.HandleFunc(patternRestAuthz, a.restAuthz)
+	mux.HandleFunc(patternRestMetric, a.restMetrics)
+
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "invalid or missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "the admin api is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// restServices returns the services of the mesh, filtered by the namespace query parameter
+func (a *adminServer) restServices(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		writeRestError(w, err)
+		return
+	}
+	namespace := r.URL.Query().Get("namespace")
+	services := []*Service{}
+	for _, svc := range a.s.xdsClient.WorkloadController.Processor.ServiceCache.List() {
+		if namespace == "" || svc.GetNamespace() == namespace {
+			services = append(services, ConvertService(svc))
+		}
+	}
+	writeRestJSON(w, services)
+}
+
+// restEndpoints returns the workloads of the mesh, filtered by the namespace query parameter and by
+// the service query parameter, a service given as <namespace>/<hostname>
+func (a *adminServer) restEndpoints(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		writeRestError(w, err)
+		return
+	}
+	namespace, service := r.URL.Query().Get("namespace"), r.URL.Query().Get("service")
+	endpoints := []*Workload{}
+	for _, wl := range a.s.xdsClient.WorkloadController.Processor.WorkloadCache.List() {
+		if namespace != "" && wl.GetNamespace() != namespace {
+			continue
+		}
+		if _, ok := wl.GetServices()[service]; service != "" && !ok {
+			continue
+		}
+		endpoints = append(endpoints, ConvertWorkload(wl))
+	}
+	writeRestJSON(w, endpoints)
+}
+
+func (a *adminServer) restAuthz(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.checkMode(adminapi.Mode_DUAL_ENGINE); err != nil {
+		writeRestError(w, err)
+		return
+	}
+	authz := RestAuthz{Policies: []*AuthorizationPolicy{}}
+	if status, err := a.GetAuthz(r.Context(), &adminapi.GetAuthzRequest{}); err == nil {
+		enabled := status.GetEnabled()
+		authz.Offload = &enabled
+	}
+	for _, p := range a.s.xdsClient.WorkloadController.Rbac.PoliciesList() {
+		authz.Policies = append(authz.Policies, ConvertAuthorizationPolicy(p))
+	}
+	writeRestJSON(w, authz)
+}
+
+// restMetrics returns the connection load of the services, the same as GetServiceLoad
+func (a *adminServer) restMetrics(w http.ResponseWriter, r *http.Request) {
+	resp, err := a.GetServiceLoad(r.Context(), &adminapi.GetServiceLoadRequest{
+		Namespace: r.URL.Query().Get("namespace"),
+		Name:      r.URL.Query().Get("name"),
+	})
+	if err != nil {
+		writeRestError(w, err)
+		return
+	}
+	writeRestProto(w, resp)
+}
+
+func writeRestJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func writeRestProto(w http.ResponseWriter, m proto.Message) {
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// writeRestError writes the error of the grpc admin api with the matching http status
+func writeRestError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch grpcstatus.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		code = http.StatusBadRequest
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	}
+	http.Error(w, grpcstatus.Convert(err).Message(), code)
+}
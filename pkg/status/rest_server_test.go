@@ -0,0 +1,209 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"kmesh.net/kmesh/api/v2/workloadapi"
+	"kmesh.net/kmesh/api/v2/workloadapi/security"
+	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/controller"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/workload"
+	"kmesh.net/kmesh/pkg/controller/workload/cache"
+)
+
+const testRestToken = "secret"
+
+func newTestRestServer() *Server {
+	workloadCache := cache.NewWorkloadCache()
+	serviceCache := cache.NewServiceCache()
+	for _, wl := range []*workloadapi.Workload{
+		{
+			Uid:       "cluster0//Pod/default/foo-1",
+			Namespace: "default",
+			Name:      "foo-1",
+			Addresses: [][]byte{netip.MustParseAddr("10.244.0.3").AsSlice()},
+			Status:    workloadapi.WorkloadStatus_HEALTHY,
+			Services:  map[string]*workloadapi.PortList{"default/foo.default.svc.cluster.local": {}},
+		},
+		{
+			Uid:       "cluster0//Pod/other/bar-1",
+			Namespace: "other",
+			Name:      "bar-1",
+			Addresses: [][]byte{netip.MustParseAddr("10.244.0.4").AsSlice()},
+			Status:    workloadapi.WorkloadStatus_HEALTHY,
+		},
+	} {
+		workloadCache.AddOrUpdateWorkload(wl)
+	}
+	serviceCache.AddOrUpdateService(&workloadapi.Service{
+		Name:      "foo",
+		Namespace: "default",
+		Hostname:  "foo.default.svc.cluster.local",
+	})
+	serviceCache.AddOrUpdateService(&workloadapi.Service{
+		Name:      "bar",
+		Namespace: "other",
+		Hostname:  "bar.other.svc.cluster.local",
+	})
+	rbac := auth.NewRbac(workloadCache)
+	_ = rbac.UpdatePolicy(&security.Authorization{
+		Name:      "deny-bar",
+		Namespace: "default",
+		Scope:     security.Scope_NAMESPACE,
+		Action:    security.Action_DENY,
+	})
+	return &Server{
+		xdsClient: &controller.XdsClient{
+			WorkloadController: &workload.Controller{
+				Processor: &workload.Processor{
+					WorkloadCache: workloadCache,
+					ServiceCache:  serviceCache,
+				},
+				Rbac:             rbac,
+				MetricController: telemetry.NewMetric(workloadCache, serviceCache, false),
+			},
+		},
+	}
+}
+
+func restGet(t *testing.T, handler http.Handler, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+testRestToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRest_services(t *testing.T) {
+	handler := newAdminRestHandler(&adminServer{s: newTestRestServer()}, testRestToken)
+
+	w := restGet(t, handler, patternRestSvcs)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var services []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &services))
+	assert.Len(t, services, 2)
+	for _, key := range []string{"name", "namespace", "hostname", "vips", "ports", "loadBalancer", "waypoint"} {
+		assert.Contains(t, services[0], key)
+	}
+
+	w = restGet(t, handler, patternRestSvcs+"?namespace=other")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name":"bar","namespace":"other","hostname":"bar.other.svc.cluster.local",
+		"vips":[],"ports":null,"loadBalancer":null,"waypoint":{"destination":""}}]`, w.Body.String())
+}
+
+func TestAdminRest_endpoints(t *testing.T) {
+	handler := newAdminRestHandler(&adminServer{s: newTestRestServer()}, testRestToken)
+
+	w := restGet(t, handler, patternRestEps)
+	require.Equal(t, http.StatusOK, w.Code)
+	var endpoints []*Workload
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &endpoints))
+	assert.Len(t, endpoints, 2)
+
+	w = restGet(t, handler, patternRestEps+"?service=default/foo.default.svc.cluster.local")
+	require.Equal(t, http.StatusOK, w.Code)
+	var raw []map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+	require.Len(t, raw, 1)
+	assert.Equal(t, "foo-1", raw[0]["name"])
+	assert.Equal(t, []any{"10.244.0.3"}, raw[0]["addresses"])
+	assert.Equal(t, "HEALTHY", raw[0]["status"])
+	assert.Equal(t, []any{"default/foo.default.svc.cluster.local"}, raw[0]["services"])
+
+	w = restGet(t, handler, patternRestEps+"?namespace=none")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
+
+func TestAdminRest_authz(t *testing.T) {
+	handler := newAdminRestHandler(&adminServer{s: newTestRestServer()}, testRestToken)
+
+	w := restGet(t, handler, patternRestAuthz)
+	require.Equal(t, http.StatusOK, w.Code)
+	// offload is left out without a bpf loader
+	assert.JSONEq(t, `{"policies":[{"name":"deny-bar","namespace":"default","scope":"NAMESPACE",
+		"action":"DENY","rules":null}]}`, w.Body.String())
+}
+
+func TestAdminRest_metrics(t *testing.T) {
+	handler := newAdminRestHandler(&adminServer{s: newTestRestServer()}, testRestToken)
+
+	w := restGet(t, handler, patternRestMetric+"?namespace=default&name=foo")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"monitoringEnabled":false,"loads":[]}`, w.Body.String())
+
+	// the metrics are only collected in dual-engine mode
+	handler = newAdminRestHandler(&adminServer{s: &Server{}}, testRestToken)
+	w = restGet(t, handler, patternRestMetric)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminRest_access(t *testing.T) {
+	handler := newAdminRestHandler(&adminServer{s: newTestRestServer()}, testRestToken)
+
+	for _, header := range []string{"", "Bearer wrong", testRestToken} {
+		req := httptest.NewRequest(http.MethodGet, patternRestSvcs, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, patternRestSvcs, nil)
+	req.Header.Set("Authorization", "Bearer "+testRestToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = restGet(t, handler, restPrefix+"/unknown")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNewAdminRestServer(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte(testRestToken+"\n"), 0o600))
+
+	server, err := newAdminRestServer(&Server{}, tokenFile)
+	require.NoError(t, err)
+	assert.Equal(t, adminRestAddr, server.Addr)
+
+	emptyFile := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+	_, err = newAdminRestServer(&Server{}, emptyFile)
+	assert.Error(t, err)
+
+	_, err = newAdminRestServer(&Server{}, filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
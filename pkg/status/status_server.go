@@ -21,22 +21,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/pprof"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 	"google.golang.org/protobuf/encoding/protojson"
 
 	adminv2 "kmesh.net/kmesh/api/v2/admin"
+	"kmesh.net/kmesh/api/v2/adminapi"
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/bpf"
 	bpfads "kmesh.net/kmesh/pkg/bpf/ads"
+	"kmesh.net/kmesh/pkg/bpf/selftest"
+	bpfutils "kmesh.net/kmesh/pkg/bpf/utils"
+	"kmesh.net/kmesh/pkg/bpf/verifier"
 	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
 	"kmesh.net/kmesh/pkg/constants"
 	"kmesh.net/kmesh/pkg/controller"
 	"kmesh.net/kmesh/pkg/controller/ads"
+	manage "kmesh.net/kmesh/pkg/controller/manage"
+	"kmesh.net/kmesh/pkg/controller/telemetry"
+	"kmesh.net/kmesh/pkg/controller/trace"
+	"kmesh.net/kmesh/pkg/controller/workload"
 	"kmesh.net/kmesh/pkg/logger"
 	"kmesh.net/kmesh/pkg/version"
 )
@@ -45,6 +56,8 @@ var log = logger.NewLoggerScope("status")
 
 const (
 	adminAddr = "localhost:15200"
+	// pprofAddr serves net/http/pprof when enabled with --enable-pprof
+	pprofAddr = "localhost:15202"
 
 	patternVersion            = "/version"
 	patternBpfAdsMaps         = "/debug/config_dump/bpf/kernel-native"
@@ -59,11 +72,18 @@ const (
 	patternWorkloadMetrics    = "/workload_metrics"
 	patternConnectionMetrics  = "/connection_metrics"
 	patternAuthz              = "/authz"
+	patternTrace              = "/debug/trace"
+	patternResync             = "/debug/resync"
+	patternMapGC              = "/debug/gc"
+	patternOutliers           = "/debug/outliers"
 
 	bpfLoggerName = "bpf"
 
 	httpTimeout = time.Second * 20
 
+	defaultTraceTimeout = time.Minute
+	maxTraceTimeout     = 10 * time.Minute
+
 	invalidModeErrMessage = "\tInvalid Client Mode\n"
 )
 
@@ -73,14 +93,23 @@ type Server struct {
 	mux       *http.ServeMux
 	server    *http.Server
 	loader    *bpf.BpfLoader
+	// enrollments of the pods of the node, nil if unknown
+	enrollments *manage.EnrollmentStore
+	// grpcServer serves the admin api, see admin_server.go
+	grpcServer *grpc.Server
+	// pprofServer serves the go runtime profiles, nil unless enabled
+	pprofServer *http.Server
+	// adminRestServer serves the read-only REST admin api, nil unless enabled
+	adminRestServer *http.Server
 }
 
-func NewServer(c *controller.XdsClient, configs *options.BootstrapConfigs, loader *bpf.BpfLoader) *Server {
+func NewServer(c *controller.XdsClient, enrollments *manage.EnrollmentStore, configs *options.BootstrapConfigs, loader *bpf.BpfLoader) *Server {
 	s := &Server{
-		config:    configs,
-		xdsClient: c,
-		mux:       http.NewServeMux(),
-		loader:    loader,
+		config:      configs,
+		xdsClient:   c,
+		mux:         http.NewServeMux(),
+		loader:      loader,
+		enrollments: enrollments,
 	}
 	s.server = &http.Server{
 		Addr:         adminAddr,
@@ -88,6 +117,8 @@ func NewServer(c *controller.XdsClient, configs *options.BootstrapConfigs, loade
 		ReadTimeout:  httpTimeout,
 		WriteTimeout: httpTimeout,
 	}
+	s.grpcServer = grpc.NewServer()
+	adminapi.RegisterKmeshAdminServer(s.grpcServer, &adminServer{s: s})
 
 	s.mux.HandleFunc(patternVersion, s.version)
 	s.mux.HandleFunc(patternBpfAdsMaps, s.bpfAdsMaps)
@@ -100,21 +131,48 @@ func NewServer(c *controller.XdsClient, configs *options.BootstrapConfigs, loade
 	s.mux.HandleFunc(patternWorkloadMetrics, s.workloadMetricHandler)
 	s.mux.HandleFunc(patternConnectionMetrics, s.connectionMetricHandler)
 	s.mux.HandleFunc(patternAuthz, s.authzHandler)
+	s.mux.HandleFunc(patternTrace, s.traceHandler)
+	s.mux.HandleFunc(patternResync, s.resyncHandler)
+	s.mux.HandleFunc(patternMapGC, s.mapGCHandler)
+	s.mux.HandleFunc(patternOutliers, s.outliersHandler)
 
 	// TODO: add dump certificate, authorizationPolicies and services
 	s.mux.HandleFunc(patternReadyProbe, s.readyProbe)
 
-	// support pprof
-	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
-	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	if configs != nil && configs.DebugConfig != nil && configs.DebugConfig.EnablePprof {
+		s.pprofServer = newPprofServer(pprofAddr)
+	}
+	if configs != nil && configs.DebugConfig != nil && configs.DebugConfig.AdminRestTokenFile != "" {
+		restServer, err := newAdminRestServer(s, configs.DebugConfig.AdminRestTokenFile)
+		if err != nil {
+			log.Errorf("REST admin api is disabled: %v", err)
+		} else {
+			s.adminRestServer = restServer
+		}
+	}
 	return s
 }
 
+// newPprofServer serves pprof on its own server, the profiles are collected
+// for longer than the write timeout of the status server
+func newPprofServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		ReadTimeout: httpTimeout,
+	}
+}
+
 func (s *Server) version(w http.ResponseWriter, r *http.Request) {
 	v := version.Get()
+	v.EventMechanism = bpfutils.EventMechanism()
+	v.XdpMode = manage.ActiveXdpMode()
 
 	data, err := json.MarshalIndent(&v, "", "  ")
 	if err != nil {
@@ -151,16 +209,19 @@ func (s *Server) bpfWorkloadMaps(w http.ResponseWriter, r *http.Request) {
 	if !s.checkWorkloadMode(w) {
 		return
 	}
+	printWorkloadBpfDump(w, s.workloadBpfDump())
+}
+
+func (s *Server) workloadBpfDump() WorkloadBpfDump {
 	client := s.xdsClient
 	bpfMaps := client.WorkloadController.Processor.GetBpfCache()
-	workloadBpfDump := NewWorkloadBpfDump(s.xdsClient.WorkloadController.Processor.GetHashName()).
-		WithBackends(bpfMaps.BackendLookupAll()).
+	return NewWorkloadBpfDump(s.xdsClient.WorkloadController.Processor.GetHashName()).
+		WithBackends(bpfMaps.BackendLookupAll(), bpfMaps.BackendEjectedBy).
 		WithEndpoints(bpfMaps.EndpointLookupAll()).
 		WithFrontends(bpfMaps.FrontendLookupAll()).
 		WithServices(bpfMaps.ServiceLookupAll()).
-		WithWorkloadPolicies(bpfMaps.WorkloadPolicyLookupAll())
-
-	printWorkloadBpfDump(w, workloadBpfDump)
+		WithWorkloadPolicies(bpfMaps.WorkloadPolicyLookupAll()).
+		WithEndpointHealth(client.WorkloadController.Processor.EndpointHealth())
 }
 
 func printWorkloadBpfDump(w http.ResponseWriter, wbd WorkloadBpfDump) {
@@ -178,6 +239,12 @@ func (s *Server) bpfAdsMaps(w http.ResponseWriter, r *http.Request) {
 	if !s.checkAdsMode(w) {
 		return
 	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, protojson.Format(s.adsBpfDump()))
+}
+
+func (s *Server) adsBpfDump() *adminv2.ConfigDump {
 	var err error
 	dynamicRes := &adminv2.ConfigResources{}
 	dynamicRes.ClusterConfigs, err = maps_v2.ClusterLookupAll()
@@ -196,10 +263,9 @@ func (s *Server) bpfAdsMaps(w http.ResponseWriter, r *http.Request) {
 	}
 	ads.SetApiVersionInfo(dynamicRes)
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, protojson.Format(&adminv2.ConfigDump{
+	return &adminv2.ConfigDump{
 		DynamicResources: dynamicRes,
-	}))
+	}
 }
 
 type LoggerInfo struct {
@@ -360,6 +426,156 @@ func (s *Server) authzHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// resyncHandler drops the state received from xds, the full state is received again and applied to the bpf maps
+func (s *Server) resyncHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkWorkloadMode(w) {
+		return
+	}
+
+	s.xdsClient.WorkloadController.Resync()
+	w.WriteHeader(http.StatusOK)
+}
+
+// mapGCHandler removes the entries of the bpf maps with no backing xds resource, and returns the number
+// of entries removed by map
+func (s *Server) mapGCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkWorkloadMode(w) {
+		return
+	}
+
+	removed := s.xdsClient.WorkloadController.GCMaps()
+	data, err := json.MarshalIndent(removed, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal the removed entries: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// outliersHandler returns the backends the outlier detection of the services currently ejects on GET, and
+// re-admits them on POST. The service query parameter, namespace/hostname, restricts them to a service.
+func (s *Server) outliersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkWorkloadMode(w) {
+		return
+	}
+
+	var (
+		ejections []workload.OutlierEjection
+		err       error
+	)
+	service := r.URL.Query().Get("service")
+	if r.Method == http.MethodPost {
+		ejections, err = s.xdsClient.WorkloadController.ClearOutlierEjections(service)
+	} else {
+		ejections, err = s.xdsClient.WorkloadController.OutlierEjections(service)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if ejections == nil {
+		ejections = []workload.OutlierEjection{}
+	}
+	data, err := json.MarshalIndent(ejections, "", "    ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to marshal the ejections: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// traceHandler streams the data plane decisions hit by the connections matching
+// the src and dst query parameters, one json event per line, until timeout.
+func (s *Server) traceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.checkWorkloadMode(w) {
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := trace.ParseFilter(query.Get("src"), query.Get("dst"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeout := defaultTraceTimeout
+	if t := query.Get("timeout"); t != "" {
+		if timeout, err = time.ParseDuration(t); err != nil || timeout <= 0 || timeout > maxTraceTimeout {
+			http.Error(w, fmt.Sprintf("invalid timeout %s, should be a duration no longer than %v", t, maxTraceTimeout), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Connection reports and userspace authz are needed to observe the decisions, hold the monitoring and
+	// suspend the xdp authz of the traced workloads of the node only for the duration of the trace.
+	var restore func()
+	if s.loader != nil {
+		release, err := s.loader.HoldMonitoring()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("enable bpf monitoring failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		resume := s.xdsClient.WorkloadController.Processor.SuspendTracedAuthzOffload(&filter)
+		restore = func() {
+			resume()
+			if err := release(); err != nil {
+				log.Errorf("restore bpf monitoring after trace failed: %v", err)
+			}
+		}
+	}
+	tracer := s.xdsClient.WorkloadController.Tracer
+	events, err := tracer.Start(filter, timeout, restore)
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer tracer.Stop()
+	log.Infof("start tracing %s for %v", filter.String(), timeout)
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(timeout + httpTimeout))
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := encoder.Encode(ev); err != nil {
+				log.Errorf("write trace event failed: %v", err)
+				return
+			}
+			_ = rc.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
 func (s *Server) getLoggerNames(w http.ResponseWriter) {
 	loggerNames := append(logger.GetLoggerNames(), bpfLoggerName)
 	data, err := json.MarshalIndent(&loggerNames, "", "    ")
@@ -452,9 +668,12 @@ func (s *Server) configDumpAds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := s.xdsClient
 	w.WriteHeader(http.StatusOK)
-	cache := client.AdsController.Processor.Cache
+	fmt.Fprintln(w, protojson.Format(s.adsConfigDump()))
+}
+
+func (s *Server) adsConfigDump() *adminv2.ConfigDump {
+	cache := s.xdsClient.AdsController.Processor.Cache
 	dynamicRes := &adminv2.ConfigResources{}
 
 	dynamicRes.ClusterConfigs = cache.ClusterCache.Dump()
@@ -462,9 +681,9 @@ func (s *Server) configDumpAds(w http.ResponseWriter, r *http.Request) {
 	dynamicRes.RouteConfigs = cache.RouteCache.Dump()
 	ads.SetApiVersionInfo(dynamicRes)
 
-	fmt.Fprintln(w, protojson.Format(&adminv2.ConfigDump{
+	return &adminv2.ConfigDump{
 		DynamicResources: dynamicRes,
-	}))
+	}
 }
 
 type WorkloadDump struct {
@@ -478,6 +697,10 @@ func (s *Server) configDumpWorkload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	printWorkloadDump(w, s.workloadDump())
+}
+
+func (s *Server) workloadDump() WorkloadDump {
 	client := s.xdsClient
 
 	workloads := client.WorkloadController.Processor.WorkloadCache.List()
@@ -497,11 +720,29 @@ func (s *Server) configDumpWorkload(w http.ResponseWriter, r *http.Request) {
 	for _, p := range policies {
 		workloadDump.Policies = append(workloadDump.Policies, ConvertAuthorizationPolicy(p))
 	}
-	printWorkloadDump(w, workloadDump)
+	return workloadDump
 }
 
 func (s *Server) readyProbe(w http.ResponseWriter, r *http.Request) {
 	// TODO: Add some components check
+	if failure := verifier.LastFailure(); failure != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(failure.Format()))
+		return
+	}
+	if err := selftest.LastResult().Err(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	if s.config != nil && s.config.XdsConfig != nil && s.config.XdsConfig.ReconcileStaleThreshold > 0 {
+		threshold := s.config.XdsConfig.ReconcileStaleThreshold
+		if stale := telemetry.StaleControllers(threshold); len(stale) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = fmt.Fprintf(w, "controllers %s have been reconciling for more than %v", strings.Join(stale, ", "), threshold)
+			return
+		}
+	}
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("OK"))
 }
@@ -527,6 +768,22 @@ func (s *Server) getBpfLogLevel() (*LoggerInfo, error) {
 }
 
 func (s *Server) setBpfLogLevel(w http.ResponseWriter, levelStr string) {
+	level, err := parseBpfLogLevel(levelStr)
+	if err != nil {
+		http.Error(w, "Invalid log level", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.loader.UpdateBpfLogLevel(uint32(level)); err != nil {
+		http.Error(w, fmt.Sprintf("update bpf log level error: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, "set BPF Log Level: %d\n", level)
+}
+
+// parseBpfLogLevel accepts either a level name or its numeric value
+func parseBpfLogLevel(levelStr string) (int, error) {
 	level, err := strconv.Atoi(levelStr)
 	if err != nil {
 		logLevelMap := map[string]int{
@@ -537,21 +794,13 @@ func (s *Server) setBpfLogLevel(w http.ResponseWriter, levelStr string) {
 		}
 		var exists bool
 		if level, exists = logLevelMap[levelStr]; !exists {
-			http.Error(w, "Invalid log level", http.StatusBadRequest)
-			return
+			return 0, fmt.Errorf("invalid bpf log level %q", levelStr)
 		}
 	}
 	if level < constants.BPF_LOG_ERR || level > constants.BPF_LOG_DEBUG {
-		http.Error(w, "Invalid log level", http.StatusBadRequest)
-		return
-	}
-
-	if err := s.loader.UpdateBpfLogLevel(uint32(level)); err != nil {
-		http.Error(w, fmt.Sprintf("update bpf log level error: %v", err), http.StatusBadRequest)
-		return
+		return 0, fmt.Errorf("invalid bpf log level %q", levelStr)
 	}
-
-	fmt.Fprintf(w, "set BPF Log Level: %d\n", level)
+	return level, nil
 }
 
 func (s *Server) StartServer() {
@@ -561,9 +810,45 @@ func (s *Server) StartServer() {
 			log.Errorf("Failed to start status server: %v", err)
 		}
 	}()
+
+	go func() {
+		lis, err := net.Listen("tcp", adminGrpcAddr)
+		if err != nil {
+			log.Errorf("Failed to listen on admin grpc address %s: %v", adminGrpcAddr, err)
+			return
+		}
+		if err := s.grpcServer.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Errorf("Failed to start admin grpc server: %v", err)
+		}
+	}()
+
+	if s.pprofServer != nil {
+		go func() {
+			err := s.pprofServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("Failed to start pprof server: %v", err)
+			}
+		}()
+	}
+
+	if s.adminRestServer != nil {
+		go func() {
+			err := s.adminRestServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Errorf("Failed to start REST admin server: %v", err)
+			}
+		}()
+	}
 }
 
 func (s *Server) StopServer() error {
+	s.grpcServer.Stop()
+	if s.pprofServer != nil {
+		_ = s.pprofServer.Close()
+	}
+	if s.adminRestServer != nil {
+		_ = s.adminRestServer.Close()
+	}
 	return s.server.Close()
 }
 
@@ -25,10 +25,13 @@ import (
 	"net/http/httptest"
 	"net/netip"
 	"sort"
+	"syscall"
 	"testing"
 
+	"github.com/cilium/ebpf"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/encoding/protojson"
 	"istio.io/istio/pilot/test/util"
 
@@ -40,6 +43,7 @@ import (
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 	"kmesh.net/kmesh/daemon/options"
 	"kmesh.net/kmesh/pkg/auth"
+	"kmesh.net/kmesh/pkg/bpf/verifier"
 	maps_v2 "kmesh.net/kmesh/pkg/cache/v2/maps"
 	"kmesh.net/kmesh/pkg/constants"
 	"kmesh.net/kmesh/pkg/controller"
@@ -550,3 +554,20 @@ func TestServerMonitoringHandler(t *testing.T) {
 		assert.Equal(t, constants.ENABLED, enableMonitoring)
 	})
 }
+
+func TestReadyProbeVerifierFailure(t *testing.T) {
+	t.Cleanup(verifier.Reset)
+	server := &Server{}
+
+	w := httptest.NewRecorder()
+	server.readyProbe(w, httptest.NewRequest(http.MethodGet, patternReadyProbe, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	ve := &ebpf.VerifierError{Cause: syscall.EACCES, Log: []string{"0: (95) exit", "R0 !read_ok"}}
+	require.NotNil(t, verifier.Record(fmt.Errorf("program cgroup_connect4_prog: %w", ve)))
+	w = httptest.NewRecorder()
+	server.readyProbe(w, httptest.NewRequest(http.MethodGet, patternReadyProbe, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "bpf program cgroup_connect4_prog rejected by the verifier")
+	assert.Contains(t, w.Body.String(), "permission denied: R0 !read_ok")
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"kmesh.net/kmesh/pkg/constants"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+// cgroup2Mount is a mount of the cgroup2 filesystem
+type cgroup2Mount struct {
+	// root is the cgroup mounted, "/" for the root of the hierarchy
+	root       string
+	mountPoint string
+}
+
+// ResolveCgroup2Path returns the absolute path of the cgroup2 mount the bpf programs attach to.
+// A path set must be a cgroup2 mount, an empty one resolves to constants.Cgroup2Path if it is a
+// cgroup2 mount and else to the first mount of the root cgroup of the cgroup2 hierarchy.
+func ResolveCgroup2Path(path string) (string, error) {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the mounts: %v", err)
+	}
+	defer f.Close()
+
+	mounts, err := parseCgroup2Mounts(f)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s: %v", mountInfoPath, err)
+	}
+	return resolveCgroup2Path(path, mounts)
+}
+
+func resolveCgroup2Path(path string, mounts []cgroup2Mount) (string, error) {
+	isMounted := func(path string) bool {
+		for _, m := range mounts {
+			if m.mountPoint == path {
+				return true
+			}
+		}
+		return false
+	}
+
+	if path != "" {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		if !isMounted(path) {
+			return "", fmt.Errorf("%s is not a cgroup2 mount, mount one with `mount -t cgroup2 none %s` "+
+				"or set --cgroup-path to an existing one", path, path)
+		}
+		return path, nil
+	}
+
+	if isMounted(constants.Cgroup2Path) {
+		return constants.Cgroup2Path, nil
+	}
+	for _, m := range mounts {
+		if m.root == "/" {
+			log.Infof("%s is not a cgroup2 mount, use the cgroup2 mount %s", constants.Cgroup2Path, m.mountPoint)
+			return m.mountPoint, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup2 mount of the root cgroup found, mount one with `mount -t cgroup2 none %s` "+
+		"or set --cgroup-path to an existing one", constants.Cgroup2Path)
+}
+
+// parseCgroup2Mounts returns the cgroup2 mounts of a mountinfo file, whose lines are like
+// "42 32 0:38 / /sys/fs/cgroup/unified rw,relatime - cgroup2 cgroup2 rw"
+func parseCgroup2Mounts(r io.Reader) ([]cgroup2Mount, error) {
+	var mounts []cgroup2Mount
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// the optional fields end with a "-", followed by the filesystem type
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+1 >= len(fields) {
+			return nil, fmt.Errorf("invalid mount %q", scanner.Text())
+		}
+		if fields[sep+1] != "cgroup2" {
+			continue
+		}
+		mounts = append(mounts, cgroup2Mount{
+			root:       unescapeMountPath(fields[3]),
+			mountPoint: unescapeMountPath(fields[4]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountPath decodes the octal escapes of the spaces, tabs, newlines and backslashes of a mountinfo path
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(path[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// cgroup v1 with the unified hierarchy mounted as well
+	hybridMountInfo = `24 30 0:22 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755
+33 32 0:29 / /sys/fs/cgroup/cpu rw,relatime - cgroup cgroup rw,cpu
+41 32 0:37 / /sys/fs/cgroup/systemd rw,relatime shared:9 - cgroup cgroup rw,name=systemd
+42 32 0:38 / /sys/fs/cgroup/unified rw,relatime shared:10 - cgroup2 cgroup2 rw
+`
+	// cgroup v2 only, with a container mounting its own cgroup
+	unifiedMountInfo = `29 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate
+812 790 0:26 /kubepods.slice/pod1 /var/lib/kubelet/pods/1/cgroup\040dir rw,relatime - cgroup2 cgroup2 rw
+`
+	kmeshMountInfo = `29 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate
+900 880 0:26 / /mnt/kmesh_cgroup2 rw,relatime - cgroup2 none rw
+`
+)
+
+func TestParseCgroup2Mounts(t *testing.T) {
+	mounts, err := parseCgroup2Mounts(strings.NewReader(hybridMountInfo))
+	require.NoError(t, err)
+	assert.Equal(t, []cgroup2Mount{{root: "/", mountPoint: "/sys/fs/cgroup/unified"}}, mounts)
+
+	mounts, err = parseCgroup2Mounts(strings.NewReader(unifiedMountInfo))
+	require.NoError(t, err)
+	assert.Equal(t, []cgroup2Mount{
+		{root: "/", mountPoint: "/sys/fs/cgroup"},
+		{root: "/kubepods.slice/pod1", mountPoint: "/var/lib/kubelet/pods/1/cgroup dir"},
+	}, mounts)
+
+	_, err = parseCgroup2Mounts(strings.NewReader("42 32 0:38 / /sys/fs/cgroup/unified rw,relatime\n"))
+	assert.Error(t, err)
+}
+
+func TestResolveCgroup2Path(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountInfo string
+		path      string
+		want      string
+		wantErr   string
+	}{
+		{
+			name:      "kmesh mount preferred",
+			mountInfo: kmeshMountInfo,
+			want:      "/mnt/kmesh_cgroup2",
+		},
+		{
+			name:      "unified hierarchy of cgroup v1 detected",
+			mountInfo: hybridMountInfo,
+			want:      "/sys/fs/cgroup/unified",
+		},
+		{
+			name:      "root cgroup detected",
+			mountInfo: unifiedMountInfo,
+			want:      "/sys/fs/cgroup",
+		},
+		{
+			name:      "path set",
+			mountInfo: kmeshMountInfo,
+			path:      "/sys/fs/cgroup/",
+			want:      "/sys/fs/cgroup",
+		},
+		{
+			name:      "path set is not a cgroup2 mount",
+			mountInfo: hybridMountInfo,
+			path:      "/sys/fs/cgroup",
+			wantErr:   "/sys/fs/cgroup is not a cgroup2 mount",
+		},
+		{
+			name:      "no cgroup2 mount",
+			mountInfo: "32 24 0:28 / /sys/fs/cgroup rw,relatime - tmpfs tmpfs rw,mode=755\n",
+			wantErr:   "no cgroup2 mount of the root cgroup found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mounts, err := parseCgroup2Mounts(strings.NewReader(tt.mountInfo))
+			require.NoError(t, err)
+			got, err := resolveCgroup2Path(tt.path, mounts)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
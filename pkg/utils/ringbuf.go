@@ -0,0 +1,261 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// ringbufQueueSize is the number of events read from a ring buffer which may wait for its handler
+	ringbufQueueSize = 4096
+	// ringbufWatchdogInterval is how long a consumer may leave pending events unhandled before it is restarted
+	ringbufWatchdogInterval = 10 * time.Second
+	// perfBufferPages is the size of the per cpu buffers of a perf event array read in place of a ring buffer
+	perfBufferPages = 16
+)
+
+var (
+	ringbufRestarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_ringbuf_restart_total",
+			Help: "The total number of times the consumer of a bpf ring buffer was restarted because it stopped draining it, by ring buffer.",
+		}, []string{"ringbuf"})
+	ringbufDroppedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_ringbuf_dropped_events_total",
+			Help: "The total number of events read from a bpf ring buffer and dropped because its handler did not keep up or was restarted, by ring buffer.",
+		}, []string{"ringbuf"})
+	ringbufLostEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kmesh_ringbuf_lost_events_total",
+			Help: "The total number of events lost by the perf buffer used in place of a bpf ring buffer on the kernels without them, by ring buffer.",
+		}, []string{"ringbuf"})
+)
+
+// RingbufMetrics returns the metrics of the ring buffer consumers
+func RingbufMetrics() []prometheus.Collector {
+	return []prometheus.Collector{ringbufRestarts, ringbufDroppedEvents, ringbufLostEvents}
+}
+
+type ringbufReader interface {
+	ReadInto(rec *ringbuf.Record) error
+	AvailableBytes() int
+	Close() error
+}
+
+// RingbufConsumer reads the events of a bpf ring buffer and hands them to its handler. The events are
+// queued in between, so that a slow handler drops them here, where they are counted, rather than let
+// the ring buffer fill up, where the bpf programs lose them silently. A watchdog restarts the consumer
+// when events are pending but none was handled for a whole interval.
+type RingbufConsumer struct {
+	name      string
+	handler   func(sample []byte)
+	newReader func() (ringbufReader, error)
+	interval  time.Duration
+	queueSize int
+
+	// handled is the number of events handled since the start, the watchdog checks it moves
+	handled atomic.Uint64
+}
+
+// ringbufGeneration is a run of the consumer, the watchdog replaces it on restart
+type ringbufGeneration struct {
+	reader ringbufReader
+	queue  chan []byte
+	cancel context.CancelFunc
+}
+
+// NewRingbufConsumer returns a consumer of the ring buffer m, name labels its metrics. The handler
+// is called by one goroutine at a time, but a handler stuck when its consumer is restarted keeps
+// running alongside the new one until it returns. On the kernels without ring buffers m is a perf
+// event array, its samples are cut to sampleSize, the size of the events of m.
+func NewRingbufConsumer(name string, m *ebpf.Map, sampleSize int, handler func(sample []byte)) *RingbufConsumer {
+	return &RingbufConsumer{
+		name:    name,
+		handler: handler,
+		newReader: func() (ringbufReader, error) {
+			if m.Type() == ebpf.PerfEventArray {
+				reader, err := perf.NewReader(m, perfBufferPages*os.Getpagesize())
+				if err != nil {
+					return nil, err
+				}
+				return &perfReader{name: name, reader: reader, sampleSize: sampleSize}, nil
+			}
+			return ringbuf.NewReader(m)
+		},
+		interval:  ringbufWatchdogInterval,
+		queueSize: ringbufQueueSize,
+	}
+}
+
+// Run consumes the ring buffer until ctx is done
+func (c *RingbufConsumer) Run(ctx context.Context) {
+	g, err := c.start(ctx)
+	if err != nil {
+		log.Errorf("open ringbuf %s failed: %v", c.name, err)
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	handled := c.handled.Load()
+	for {
+		select {
+		case <-ctx.Done():
+			c.stop(g)
+			return
+		case <-ticker.C:
+		}
+
+		last := handled
+		handled = c.handled.Load()
+		if handled != last || (len(g.queue) == 0 && g.reader.AvailableBytes() == 0) {
+			continue
+		}
+
+		log.Warnf("consumer of ringbuf %s handled no event for %v while some are pending, restarting it", c.name, c.interval)
+		ringbufRestarts.WithLabelValues(c.name).Inc()
+		c.stop(g)
+		if g, err = c.start(ctx); err != nil {
+			log.Errorf("reopen ringbuf %s failed: %v", c.name, err)
+			return
+		}
+	}
+}
+
+func (c *RingbufConsumer) start(ctx context.Context) (*ringbufGeneration, error) {
+	reader, err := c.newReader()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	g := &ringbufGeneration{
+		reader: reader,
+		queue:  make(chan []byte, c.queueSize),
+		cancel: cancel,
+	}
+	go c.read(g)
+	go c.handle(ctx, g.queue)
+	return g, nil
+}
+
+// stop closes the reader and abandons the handler, the events still queued are dropped
+func (c *RingbufConsumer) stop(g *ringbufGeneration) {
+	g.cancel()
+	if err := g.reader.Close(); err != nil {
+		log.Errorf("close ringbuf %s reader failed: %v", c.name, err)
+	}
+	if n := len(g.queue); n > 0 {
+		ringbufDroppedEvents.WithLabelValues(c.name).Add(float64(n))
+	}
+}
+
+func (c *RingbufConsumer) read(g *ringbufGeneration) {
+	defer close(g.queue)
+
+	rec := ringbuf.Record{}
+	for {
+		if err := g.reader.ReadInto(&rec); err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return
+			}
+			log.Errorf("read ringbuf %s failed: %v", c.name, err)
+			continue
+		}
+
+		// the record buffer is reused by the next read
+		sample := make([]byte, len(rec.RawSample))
+		copy(sample, rec.RawSample)
+		select {
+		case g.queue <- sample:
+		default:
+			ringbufDroppedEvents.WithLabelValues(c.name).Inc()
+		}
+	}
+}
+
+func (c *RingbufConsumer) handle(ctx context.Context, queue <-chan []byte) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sample, ok := <-queue:
+			// the events left to an abandoned handler are dropped
+			if !ok || ctx.Err() != nil {
+				return
+			}
+			c.handler(sample)
+			c.handled.Add(1)
+		}
+	}
+}
+
+type perfRecordReader interface {
+	ReadInto(rec *perf.Record) error
+	Close() error
+}
+
+// perfReader reads a perf event array like a ring buffer, so that the events are consumed alike on
+// the kernels without ring buffers
+type perfReader struct {
+	name       string
+	reader     perfRecordReader
+	record     perf.Record
+	sampleSize int
+}
+
+func (r *perfReader) ReadInto(rec *ringbuf.Record) error {
+	for {
+		if err := r.reader.ReadInto(&r.record); err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				return ringbuf.ErrClosed
+			}
+			return err
+		}
+		if r.record.LostSamples > 0 {
+			ringbufLostEvents.WithLabelValues(r.name).Add(float64(r.record.LostSamples))
+			continue
+		}
+
+		// the samples of a perf buffer are padded to 8 bytes
+		rec.RawSample = r.record.RawSample
+		if len(rec.RawSample) > r.sampleSize {
+			rec.RawSample = rec.RawSample[:r.sampleSize]
+		}
+		return nil
+	}
+}
+
+// AvailableBytes is unknown for a perf buffer, the watchdog only restarts a consumer whose handler is stuck
+func (r *perfReader) AvailableBytes() int {
+	return 0
+}
+
+func (r *perfReader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRingbufReader reads the records of a ring buffer shared by all its readers,
+// a stalled one never returns a record although some are pending
+type fakeRingbufReader struct {
+	records   chan []byte
+	stalled   bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *fakeRingbufReader) ReadInto(rec *ringbuf.Record) error {
+	if r.stalled {
+		<-r.closed
+		return ringbuf.ErrClosed
+	}
+	select {
+	case sample := <-r.records:
+		rec.RawSample = sample
+		return nil
+	case <-r.closed:
+		return ringbuf.ErrClosed
+	}
+}
+
+func (r *fakeRingbufReader) AvailableBytes() int {
+	return len(r.records)
+}
+
+func (r *fakeRingbufReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+func newTestRingbufConsumer(name string, records chan []byte, stalledReaders int, queueSize int, handler func([]byte)) *RingbufConsumer {
+	readers := 0
+	return &RingbufConsumer{
+		name:    name,
+		handler: handler,
+		newReader: func() (ringbufReader, error) {
+			readers++
+			return &fakeRingbufReader{
+				records: records,
+				stalled: readers <= stalledReaders,
+				closed:  make(chan struct{}),
+			}, nil
+		},
+		interval:  20 * time.Millisecond,
+		queueSize: queueSize,
+	}
+}
+
+func TestRingbufConsumerRestartsStalledReader(t *testing.T) {
+	name := "stalled_reader"
+	ringbufRestarts.DeleteLabelValues(name)
+	ringbufDroppedEvents.DeleteLabelValues(name)
+	records := make(chan []byte, 8)
+	for i := 0; i < 3; i++ {
+		records <- []byte{byte(i)}
+	}
+
+	handled := make(chan []byte, 8)
+	c := newTestRingbufConsumer(name, records, 1, 8, func(sample []byte) {
+		handled <- sample
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// the events piled up behind the stalled reader are handled once it is replaced
+	for i := 0; i < 3; i++ {
+		select {
+		case sample := <-handled:
+			assert.Equal(t, []byte{byte(i)}, sample)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d was not handled after the consumer restarted", i)
+		}
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(ringbufRestarts.WithLabelValues(name)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(ringbufDroppedEvents.WithLabelValues(name)))
+
+	// a drained ring buffer is not restarted
+	time.Sleep(5 * c.interval)
+	assert.Equal(t, float64(1), testutil.ToFloat64(ringbufRestarts.WithLabelValues(name)))
+}
+
+func TestRingbufConsumerRestartsStuckHandler(t *testing.T) {
+	name := "stuck_handler"
+	ringbufRestarts.DeleteLabelValues(name)
+	ringbufDroppedEvents.DeleteLabelValues(name)
+	records := make(chan []byte, 8)
+	for i := 0; i < 6; i++ {
+		records <- []byte{byte(i)}
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	handled := make(chan []byte, 8)
+	var once sync.Once
+	c := newTestRingbufConsumer(name, records, 0, 2, func(sample []byte) {
+		stuck := false
+		once.Do(func() { stuck = true })
+		if stuck {
+			<-release
+			return
+		}
+		handled <- sample
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	// the handler is stuck on the first event, two wait in the queue and the others are dropped
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(ringbufRestarts.WithLabelValues(name)) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	// the restart drops the events queued for the stuck handler
+	assert.Equal(t, float64(5), testutil.ToFloat64(ringbufDroppedEvents.WithLabelValues(name)))
+
+	// the new handler takes the next events
+	records <- []byte{6}
+	records <- []byte{7}
+	for i := 6; i < 8; i++ {
+		select {
+		case sample := <-handled:
+			assert.Equal(t, []byte{byte(i)}, sample)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d was not handled after the consumer restarted", i)
+		}
+	}
+	assert.Equal(t, float64(1), testutil.ToFloat64(ringbufRestarts.WithLabelValues(name)))
+}
+
+// fakePerfRecordReader reads the records of a perf event array
+type fakePerfRecordReader struct {
+	records chan perf.Record
+	closed  chan struct{}
+}
+
+func (r *fakePerfRecordReader) ReadInto(rec *perf.Record) error {
+	select {
+	case record := <-r.records:
+		*rec = record
+		return nil
+	case <-r.closed:
+		return perf.ErrClosed
+	}
+}
+
+func (r *fakePerfRecordReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func TestRingbufConsumerReadsPerfBuffer(t *testing.T) {
+	name := "perf_buffer"
+	ringbufLostEvents.DeleteLabelValues(name)
+	records := make(chan perf.Record, 8)
+	// the samples are padded to 8 bytes, the padding is cut like the ring buffer never had it
+	records <- perf.Record{RawSample: []byte{1, 2, 3, 0, 0, 0, 0, 0}}
+	records <- perf.Record{LostSamples: 2}
+	records <- perf.Record{RawSample: []byte{4, 5, 6, 0}}
+
+	handled := make(chan []byte, 8)
+	c := &RingbufConsumer{
+		name:    name,
+		handler: func(sample []byte) { handled <- sample },
+		newReader: func() (ringbufReader, error) {
+			return &perfReader{
+				name:       name,
+				reader:     &fakePerfRecordReader{records: records, closed: make(chan struct{})},
+				sampleSize: 3,
+			}, nil
+		},
+		interval:  20 * time.Millisecond,
+		queueSize: 8,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	for _, want := range [][]byte{{1, 2, 3}, {4, 5, 6}} {
+		select {
+		case sample := <-handled:
+			assert.Equal(t, want, sample)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %v was not handled", want)
+		}
+	}
+	assert.Equal(t, float64(2), testutil.ToFloat64(ringbufLostEvents.WithLabelValues(name)))
+}
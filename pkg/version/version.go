@@ -38,6 +38,10 @@ type Info struct {
 	GoVersion    string `json:"goVersion"`
 	Compiler     string `json:"compiler"`
 	Platform     string `json:"platform"`
+	// EventMechanism is how the bpf programs of a daemon stream their events, ringbuf or perf buffer
+	EventMechanism string `json:"eventMechanism,omitempty"`
+	// XdpMode is the mode the xdp program of a dual-engine daemon is attached to the pod interfaces in, driver or generic
+	XdpMode string `json:"xdpMode,omitempty"`
 }
 
 // String returns a Go-syntax representation of the Info.
@@ -19,11 +19,11 @@
 package bpftests
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
-	"log"
 	"net"
+	"net/netip"
 	"os"
 	"path"
 	"strconv"
@@ -34,7 +34,10 @@ import (
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
-	"github.com/cilium/ebpf/ringbuf"
+	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"kmesh.net/kmesh/api/v2/workloadapi/security"
 	bpf2go "kmesh.net/kmesh/bpf/kmesh/bpf2go/dualengine"
@@ -47,11 +50,15 @@ import (
 	"kmesh.net/kmesh/pkg/constants"
 	controllerWorkload "kmesh.net/kmesh/pkg/controller/workload"
 	"kmesh.net/kmesh/pkg/controller/workload/bpfcache"
+	"kmesh.net/kmesh/pkg/utils"
 )
 
 func testWorkload(t *testing.T) {
 	t.Run("XDP", testXDP)
 	t.Run("SockOps", testSockOps)
+	t.Run("LoadBalance", testLoadBalance)
+	t.Run("Bandwidth", testBandwidth)
+	t.Run("RedirectPorts", testRedirectPorts)
 }
 
 func testXDP(t *testing.T) {
@@ -252,6 +259,161 @@ func testXDP(t *testing.T) {
 						}
 					},
 				},
+				{
+					name: "5_deny_policy_when_conditions_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// istiod converts each `when` condition on source.ip,
+						// destination.ip and destination.port into a clause
+						workload_xdp_setPolicy(t, coll, 2, &security.Authorization{
+							Name:   "bpfut_deny_when__10.0.0.15->10.1.0.15:80",
+							Action: security.Action_DENY,
+							Rules: []*security.Rule{
+								{
+									Clauses: []*security.Clause{
+										{Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{10, 0, 0, 0}, Length: 8}}}}},
+										{Matches: []*security.Match{{DestinationIps: []*security.Address{{Address: []byte{10, 1, 0, 15}, Length: 32}}}}},
+										{Matches: []*security.Match{{NotDestinationPorts: []uint32{8080}}}},
+										{Matches: []*security.Match{{DestinationPorts: []uint32{80}}}},
+									},
+								},
+							},
+						})
+					},
+				},
+				{
+					name: "6_deny_policy_l7_condition_skipped",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// a `when` condition on an L7 attribute is an empty match,
+						// it is left to the waypoint
+						workload_xdp_setPolicy(t, coll, 3, &security.Authorization{
+							Name:   "bpfut_deny_l7__10.0.0.15->10.1.0.15:80",
+							Action: security.Action_DENY,
+							Rules: []*security.Rule{
+								{
+									Clauses: []*security.Clause{
+										{Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{10, 0, 0, 15}, Length: 32}}}}},
+										{Matches: []*security.Match{{}}},
+									},
+								},
+							},
+						})
+					},
+				},
+				{
+					name: "7_deny_policy_workload_offload",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// the authz offload is disabled on the node, the kmesh.net/authz label
+						// of the workload enforces its policies in xdp all the same
+						workload_xdp_setPolicyWithOffload(t, coll, 4, &security.Authorization{
+							Name:   "bpfut_deny_offload__10.0.0.15->10.1.0.15:80",
+							Action: security.Action_DENY,
+							Rules: []*security.Rule{
+								{
+									Clauses: []*security.Clause{
+										{Matches: []*security.Match{{SourceIps: []*security.Address{{Address: []byte{10, 0, 0, 15}, Length: 32}}}}},
+									},
+								},
+							},
+						}, constants.DISABLED, bpfcache.AuthzOffloadEnabled)
+					},
+				},
+				{
+					name: "8_network_policy_allowed_source",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						workload_xdp_setPolicy(t, coll, 5, workload_xdp_networkPolicy(t, []networkingv1.NetworkPolicyIngressRule{{
+							From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.0.0.15/32"}}},
+						}}))
+					},
+				},
+				{
+					name: "9_network_policy_denied_source",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// only the client pod of 10.0.0.16 is allowed
+						workload_xdp_setPolicy(t, coll, 6, workload_xdp_networkPolicy(t, []networkingv1.NetworkPolicyIngressRule{{
+							From: []networkingv1.NetworkPolicyPeer{{
+								PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "client"}},
+							}},
+						}}))
+					},
+				},
+				{
+					name: "10_network_policy_deny_all",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// an ALLOW policy without rules
+						workload_xdp_setPolicy(t, coll, 7, workload_xdp_networkPolicy(t, nil))
+					},
+				},
+				{
+					name: "11_ipv6_ipblock_deny_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// the v4 block of the policy does not match the v6 connection, the v6 one does
+						workload_xdp_setPolicy(t, coll, 8, workload_xdp_denySources(
+							"bpfut_deny_ipv6__fd00::f->fd00:1::f:80", "10.0.0.0/8", "fd00::/64"))
+					},
+				},
+				{
+					name: "12_ipv6_ipblock_deny_ipv4_unaffected",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// a v6 block matching any address does not match the v4 connections
+						workload_xdp_setPolicy(t, coll, 9, workload_xdp_denySources(
+							"bpfut_deny_ipv6__any", "::/0"))
+					},
+				},
+				{
+					name: "13_mixed_ipblocks_deny_ipv4_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						workload_xdp_setPolicy(t, coll, 10, workload_xdp_denySources(
+							"bpfut_deny_mixed__10.0.0.15->10.1.0.15:80", "fd00::/64", "10.0.0.0/8"))
+					},
+				},
+				{
+					name: "14_two_rules_deny_second_rule_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// the rules of a policy are OR-ed, the second one alone denies the connection
+						workload_xdp_setPolicy(t, coll, 11, &security.Authorization{
+							Name:   "bpfut_deny_two_rules__10.0.0.15->10.1.0.15:80",
+							Action: security.Action_DENY,
+							Rules: []*security.Rule{
+								workload_xdp_fromToRule("192.168.0.0/16", 0),
+								workload_xdp_fromToRule("", 80),
+							},
+						})
+					},
+				},
+				{
+					name: "15_two_rules_deny_no_rule_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						workload_xdp_setPolicy(t, coll, 12, &security.Authorization{
+							Name:   "bpfut_deny_two_rules__none",
+							Action: security.Action_DENY,
+							Rules: []*security.Rule{
+								workload_xdp_fromToRule("192.168.0.0/16", 0),
+								workload_xdp_fromToRule("", 8080),
+							},
+						})
+					},
+				},
+				{
+					name: "16_from_to_rule_deny_both_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						// the from and to of a rule are AND-ed
+						workload_xdp_setPolicy(t, coll, 13, &security.Authorization{
+							Name:   "bpfut_deny_from_to__10.0.0.15->10.1.0.15:80",
+							Action: security.Action_DENY,
+							Rules:  []*security.Rule{workload_xdp_fromToRule("10.0.0.0/8", 80)},
+						})
+					},
+				},
+				{
+					name: "17_from_to_rule_deny_only_from_matched",
+					setupInUserSpace: func(t *testing.T, coll *ebpf.Collection) {
+						workload_xdp_setPolicy(t, coll, 14, &security.Authorization{
+							Name:   "bpfut_deny_from_to__10.0.0.15->10.1.0.15:8080",
+							Action: security.Action_DENY,
+							Rules:  []*security.Rule{workload_xdp_fromToRule("10.0.0.0/8", 8080)},
+						})
+					},
+				},
 			},
 		},
 	}
@@ -262,6 +424,150 @@ func testXDP(t *testing.T) {
 }
 
 // workload_xdp_registerTailCall registers the tail call for XDP programs.
+// workload_xdp_setPolicy applies the policy, stored at policyId, to the dual-stack workload of 10.1.0.15 and fd00:1::f
+func workload_xdp_setPolicy(t *testing.T, coll *ebpf.Collection, policyId uint32, policy *security.Authorization) {
+	workload_xdp_setPolicyWithOffload(t, coll, policyId, policy, constants.ENABLED, bpfcache.AuthzOffloadNode)
+}
+
+// workload_xdp_setPolicyWithOffload applies the policy like workload_xdp_setPolicy, with the authz offload
+// of the node and the one the kmesh.net/authz label of the workload sets
+func workload_xdp_setPolicyWithOffload(t *testing.T, coll *ebpf.Collection, policyId uint32, policy *security.Authorization,
+	nodeOffload, workloadOffload uint32) {
+	setBpfConfig(t, coll, &factory.GlobalBpfConfig{
+		BpfLogLevel:  constants.BPF_LOG_DEBUG,
+		AuthzOffload: nodeOffload,
+	})
+
+	workload_xdp_registerTailCall(t, coll)
+	workload_setMapsEnv(t, coll)
+	if workload, err := bpfWorkload.NewBpfWorkload(&options.BpfConfig{
+		Mode:        constants.DualEngineMode,
+		BpfFsPath:   constants.BpfFsPath,
+		Cgroup2Path: constants.Cgroup2Path,
+	}); err != nil {
+		t.Fatalf("NewBpfWorkload failed: %v", err)
+	} else {
+		if err := workload.DeserialInit(); err != nil {
+			t.Fatalf("DeserialInit failed: %v", err)
+		}
+	}
+	workloadProcessor := controllerWorkload.NewProcessor(bpf2go.KmeshCgroupSockWorkloadMaps{
+		KmWlpolicy: coll.Maps["km_wlpolicy"],
+		KmFrontend: coll.Maps["km_frontend"],
+	})
+
+	workloadbpf := workloadProcessor.GetBpfCache()
+	if err := workloadbpf.FrontendUpdate(&bpfcache.FrontendKey{
+		Ip: [16]byte{10, 1, 0, 15},
+	}, &bpfcache.FrontendValue{
+		UpstreamId: 0x01,
+	}); err != nil {
+		t.Fatalf("FrontendUpdate failed: %v", err)
+	}
+	if err := workloadbpf.FrontendUpdate(&bpfcache.FrontendKey{
+		Ip: netip.MustParseAddr("fd00:1::f").As16(),
+	}, &bpfcache.FrontendValue{
+		UpstreamId: 0x01,
+	}); err != nil {
+		t.Fatalf("FrontendUpdate failed: %v", err)
+	}
+	if err := workloadbpf.WorkloadPolicyUpdate(&bpfcache.WorkloadPolicyKey{
+		WorklodId: 0x01,
+	}, &bpfcache.WorkloadPolicyValue{
+		PolicyIds:    [4]uint32{policyId},
+		AuthzOffload: workloadOffload,
+	}); err != nil {
+		t.Fatalf("WorkloadPolicyUpdate failed: %v", err)
+	}
+	if err := maps.AuthorizationUpdate(policyId, policy); err != nil {
+		t.Fatalf("AuthorizationUpdate failed: %v", err)
+	}
+}
+
+// workload_xdp_denySources builds the DENY policy of the connections from the cidrs
+func workload_xdp_denySources(name string, cidrs ...string) *security.Authorization {
+	var ips []*security.Address
+	for _, cidr := range cidrs {
+		prefix := netip.MustParsePrefix(cidr)
+		ips = append(ips, &security.Address{Address: prefix.Addr().AsSlice(), Length: uint32(prefix.Bits())})
+	}
+	return &security.Authorization{
+		Name:   name,
+		Action: security.Action_DENY,
+		Rules: []*security.Rule{
+			{
+				Clauses: []*security.Clause{
+					{Matches: []*security.Match{{SourceIps: ips}}},
+				},
+			},
+		},
+	}
+}
+
+// workload_xdp_fromToRule builds the rule istiod translates a from on the source cidr and a to on the destination
+// port into, a clause each, the empty ones are left out
+func workload_xdp_fromToRule(cidr string, port uint32) *security.Rule {
+	rule := &security.Rule{}
+	if cidr != "" {
+		prefix := netip.MustParsePrefix(cidr)
+		rule.Clauses = append(rule.Clauses, &security.Clause{Matches: []*security.Match{{
+			SourceIps: []*security.Address{{Address: prefix.Addr().AsSlice(), Length: uint32(prefix.Bits())}},
+		}}})
+	}
+	if port != 0 {
+		rule.Clauses = append(rule.Clauses, &security.Clause{Matches: []*security.Match{{
+			DestinationPorts: []uint32{port},
+		}}})
+	}
+	return rule
+}
+
+// networkPolicyIndex lists the pods of the NetworkPolicy tests: the server of 10.1.0.15,
+// the sleep pod of 10.0.0.15 and the client pod of 10.0.0.16
+type networkPolicyIndex struct {
+	networkPolicies []*networkingv1.NetworkPolicy
+	pods            []*corev1.Pod
+}
+
+func (i *networkPolicyIndex) NetworkPolicies(string) []*networkingv1.NetworkPolicy {
+	return i.networkPolicies
+}
+
+func (i *networkPolicyIndex) Pods(string) []*corev1.Pod {
+	return i.pods
+}
+
+func (i *networkPolicyIndex) NamespaceLabels(string) map[string]string {
+	return nil
+}
+
+// workload_xdp_networkPolicy translates the NetworkPolicy with the ingress rules selecting the server
+func workload_xdp_networkPolicy(t *testing.T, ingress []networkingv1.NetworkPolicyIngressRule) *security.Authorization {
+	pod := func(name, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": name}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		}
+	}
+	server := pod("server", "10.1.0.15")
+	index := &networkPolicyIndex{
+		pods: []*corev1.Pod{server, pod("sleep", "10.0.0.15"), pod("client", "10.0.0.16")},
+		networkPolicies: []*networkingv1.NetworkPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "bpfut", Namespace: "default"},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "server"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress:     ingress,
+			},
+		}},
+	}
+	policies := auth.NetworkPolicies(server, index)
+	if len(policies) != 1 {
+		t.Fatalf("expected the ingress policy of the server, got %v", policies)
+	}
+	return policies[0]
+}
+
 func workload_xdp_registerTailCall(t *testing.T, coll *ebpf.Collection) {
 	if coll == nil {
 		t.Fatal("coll is nil")
@@ -467,6 +773,18 @@ func testSockOps(t *testing.T) {
 				},
 				{
 					name: "BPF_SOCK_OPS_PASSIVE_ESTABLISHED_CB__auth_ip_tuple",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						testAuthIpTuple(t, cgroupPath, objFilePath, bpfUtils.EventRingbuf)
+					},
+				},
+				{
+					name: "BPF_SOCK_OPS_PASSIVE_ESTABLISHED_CB__auth_ip_tuple_perf_buffer",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						testAuthIpTuple(t, cgroupPath, objFilePath, bpfUtils.EventPerfBuffer)
+					},
+				},
+				{
+					name: "BPF_SOCK_OPS_STATE_CB__clean_auth_map",
 					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
 						localIP := get_local_ipv4(t)
 						clientPort := 12345
@@ -489,6 +807,23 @@ func testSockOps(t *testing.T) {
 						})
 						startLogReader(coll)
 
+						// update km_auth_res map
+						mapOfAuth, ok := coll.Maps["km_auth_res"]
+						if !ok {
+							t.Fatal("Failed to get km_auth_res map from collection")
+						}
+						key := make([]byte, auth.TUPLE_LEN)                                                       // struct ipv4
+						binary.BigEndian.PutUint32(key[0:4], binary.BigEndian.Uint32(net.ParseIP(localIP).To4())) // __be32 saddr;
+						binary.BigEndian.PutUint32(key[4:8], binary.BigEndian.Uint32(net.ParseIP(localIP).To4())) // __be32 daddr;
+						binary.BigEndian.PutUint16(key[8:10], uint16(serverPort))                                 // __be16 sport;
+						binary.BigEndian.PutUint16(key[10:12], uint16(clientPort))                                // __be16 dport;
+						for i := auth.IPV4_TUPLE_LENGTH; i < len(key); i++ {
+							key[i] = 0
+						}
+						if err := mapOfAuth.Update(key, uint32(1), ebpf.UpdateAny); err != nil {
+							t.Fatalf("Failed to update km_auth_res map: %v", err)
+						}
+
 						// record_kmesh_managed_ip
 						enableAddr := constants.ControlCommandIp4 + ":" + strconv.Itoa(int(constants.OperEnableControl))
 						(&net.Dialer{
@@ -519,53 +854,126 @@ func testSockOps(t *testing.T) {
 						} else {
 							t.Logf("Connect success: %s:%d -> %s:%d", localIP, clientPort, localIP, serverPort)
 						}
-						defer conn.Close()
+						conn.Close()
 
-						// Now, the TCP connection between localIP:12345(client) and localIP:54321(server) has been established
+						// Now, the TCP connection between between localIP:12345(client) and localIP:54321(server) has been established and closed
 						time.Sleep(1 * time.Second)
 
-						// Check the contents of ringbuf km_auth_req
-						kmAuthReqMap := coll.Maps["km_auth_req"]
-						if kmAuthReqMap == nil {
-							t.Fatal("Failed to get km_auth_req map from collection")
+						// Check if the entry was deleted from km_auth_res map
+						// The same key we inserted earlier should no longer exist in the map
+						var value uint32
+						err = mapOfAuth.Lookup(key, &value)
+						if err == nil {
+							t.Fatalf("km_auth_res map entry was not deleted as expected")
+						} else if !errors.Is(err, ebpf.ErrKeyNotExist) {
+							t.Fatalf("Unexpected error when looking up km_auth_res map: %v", err)
+						} else {
+							t.Logf("km_auth_res map entry was successfully cleaned up")
 						}
-						rd, err := ringbuf.NewReader(kmAuthReqMap)
-						if err != nil {
-							t.Fatalf("Failed to create ringbuf reader: %v", err)
+					},
+				},
+				{
+					name: "BPF_SOCK_OPS_STATE_CB__record_connect_failure",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						localIP := get_local_ipv4(t)
+						clientPort := 12346
+						serverPort := 54322
+						serverSocket := localIP + ":" + strconv.Itoa(serverPort)
+
+						// mount cgroup2
+						mount_cgroup2(t, cgroupPath)
+						defer syscall.Unmount(cgroupPath, 0)
+
+						// load the eBPF program
+						coll, lk := load_bpf_2_cgroup(t, objFilePath, cgroupPath)
+						defer coll.Close()
+						defer lk.Close()
+
+						// Set the BPF configuration
+						setBpfConfig(t, coll, &factory.GlobalBpfConfig{
+							BpfLogLevel:  constants.BPF_LOG_DEBUG,
+							AuthzOffload: constants.DISABLED,
+						})
+						startLogReader(coll)
+
+						// the mocked sock storage blames backend 1 for the connections
+						kmBackendMap, ok := coll.Maps["km_backend"]
+						if !ok {
+							t.Fatal("Failed to get km_backend map from collection")
+						}
+						backendKey := bpfcache.BackendKey{BackendUid: 1}
+						if err := kmBackendMap.Update(&backendKey, &bpfcache.BackendValue{}, ebpf.UpdateAny); err != nil {
+							t.Fatalf("Failed to update km_backend map: %v", err)
+						}
+
+						// record_kmesh_managed_ip
+						enableAddr := constants.ControlCommandIp4 + ":" + strconv.Itoa(int(constants.OperEnableControl))
+						(&net.Dialer{
+							LocalAddr: &net.TCPAddr{
+								IP:   net.ParseIP(localIP),
+								Port: clientPort,
+							},
+							Timeout: 2 * time.Second,
+						}).Dial("tcp4", enableAddr)
+
+						dial := func() (net.Conn, error) {
+							return (&net.Dialer{
+								LocalAddr: &net.TCPAddr{
+									IP:   net.ParseIP(localIP),
+									Port: clientPort,
+								},
+								Timeout: 2 * time.Second,
+							}).Dial("tcp4", serverSocket)
+						}
+
+						// nobody listens on the server port, the backend refuses the connections
+						for i := 0; i < 2; i++ {
+							if conn, err := dial(); err == nil {
+								conn.Close()
+								t.Fatalf("Connect to %s should be refused", serverSocket)
+							}
+						}
+						time.Sleep(1 * time.Second)
+
+						var value bpfcache.BackendValue
+						if err := kmBackendMap.Lookup(&backendKey, &value); err != nil {
+							t.Fatalf("Failed to lookup km_backend map: %v", err)
+						}
+						if value.ConnectFailNs == 0 {
+							t.Fatalf("connect failure of backend 1 was not recorded")
+						}
+						// the outlier detection ejects the backends by their failures in a row
+						if value.ConnectFailCount != 2 {
+							t.Fatalf("backend 1 failed to connect 2 times in a row, recorded %d", value.ConnectFailCount)
 						}
-						defer rd.Close()
 
-						var event [40]byte // sizeof(struct ringbuf_msg_type)
-						record, err := rd.Read()
+						// a successful connection clears the failure
+						listener, err := net.Listen("tcp4", serverSocket)
 						if err != nil {
-							t.Fatalf("Failed to read from ringbuf: %v", err)
+							t.Fatalf("Failed to start TCP server: %v", err)
 						}
-						if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-							log.Printf("parsing ringbuf event: %s", err)
+						defer listener.Close()
+						conn, err := dial()
+						if err != nil {
+							t.Fatalf("Failed to connect to server: %v", err)
 						}
-						protoType := binary.LittleEndian.Uint32(event[0:4])
-						srcIP := net.IPv4(event[4], event[5], event[6], event[7])
-						dstIP := net.IPv4(event[8], event[9], event[10], event[11])
-						srcPort := binary.BigEndian.Uint16(event[12:14])
-						dstPort := binary.BigEndian.Uint16(event[14:16])
-						t.Logf("Received km_auth_req ringbuf_msg: type=%d, src=%s:%d, dst=%s:%d", protoType, srcIP, srcPort, dstIP, dstPort)
+						conn.Close()
+						time.Sleep(1 * time.Second)
 
-						// Check
-						if protoType != constants.MSG_TYPE_IPV4 ||
-							srcIP.String() != localIP || int(srcPort) != clientPort ||
-							dstIP.String() != localIP || int(dstPort) != serverPort {
-							t.Fatalf("Expected {protoType: %d, srcIP: %s, srcPort: %d, dstIP: %s, dstPort: %d}, but got {protoType: %d, srcIP: %s, srcPort: %d, dstIP: %s, dstPort: %d}",
-								constants.MSG_TYPE_IPV4, localIP, clientPort, localIP, serverPort,
-								protoType, srcIP, srcPort, dstIP, dstPort)
+						if err := kmBackendMap.Lookup(&backendKey, &value); err != nil {
+							t.Fatalf("Failed to lookup km_backend map: %v", err)
+						}
+						if value.ConnectFailNs != 0 || value.ConnectFailCount != 0 {
+							t.Fatalf("connect failure of backend 1 was not cleared after a successful connection")
 						}
 					},
 				},
 				{
-					name: "BPF_SOCK_OPS_STATE_CB__clean_auth_map",
+					name: "BPF_SOCK_OPS_STATE_CB__count_active_connections",
 					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
 						localIP := get_local_ipv4(t)
-						clientPort := 12345
-						serverPort := 54321
+						clientPort := 12348
+						serverPort := 54324
 						serverSocket := localIP + ":" + strconv.Itoa(serverPort)
 
 						// mount cgroup2
@@ -584,21 +992,14 @@ func testSockOps(t *testing.T) {
 						})
 						startLogReader(coll)
 
-						// update km_auth_res map
-						mapOfAuth, ok := coll.Maps["km_auth_res"]
+						// the mocked sock storage counts the connections on backend 1
+						kmBackendMap, ok := coll.Maps["km_backend"]
 						if !ok {
-							t.Fatal("Failed to get km_auth_res map from collection")
-						}
-						key := make([]byte, auth.TUPLE_LEN)                                                       // struct ipv4
-						binary.BigEndian.PutUint32(key[0:4], binary.BigEndian.Uint32(net.ParseIP(localIP).To4())) // __be32 saddr;
-						binary.BigEndian.PutUint32(key[4:8], binary.BigEndian.Uint32(net.ParseIP(localIP).To4())) // __be32 daddr;
-						binary.BigEndian.PutUint16(key[8:10], uint16(serverPort))                                 // __be16 sport;
-						binary.BigEndian.PutUint16(key[10:12], uint16(clientPort))                                // __be16 dport;
-						for i := auth.IPV4_TUPLE_LENGTH; i < len(key); i++ {
-							key[i] = 0
+							t.Fatal("Failed to get km_backend map from collection")
 						}
-						if err := mapOfAuth.Update(key, uint32(1), ebpf.UpdateAny); err != nil {
-							t.Fatalf("Failed to update km_auth_res map: %v", err)
+						backendKey := bpfcache.BackendKey{BackendUid: 1}
+						if err := kmBackendMap.Update(&backendKey, &bpfcache.BackendValue{}, ebpf.UpdateAny); err != nil {
+							t.Fatalf("Failed to update km_backend map: %v", err)
 						}
 
 						// record_kmesh_managed_ip
@@ -611,14 +1012,22 @@ func testSockOps(t *testing.T) {
 							Timeout: 2 * time.Second,
 						}).Dial("tcp4", enableAddr)
 
-						// Create a TCP server listener
 						listener, err := net.Listen("tcp4", serverSocket)
 						if err != nil {
 							t.Fatalf("Failed to start TCP server: %v", err)
 						}
 						defer listener.Close()
 
-						// try to connect to the server using the specified client port
+						checkActiveConnections := func(expected uint32) {
+							var value bpfcache.BackendValue
+							if err := kmBackendMap.Lookup(&backendKey, &value); err != nil {
+								t.Fatalf("Failed to lookup km_backend map: %v", err)
+							}
+							if value.ActiveConnections != expected {
+								t.Fatalf("Expected %d active connections on backend 1, but got %d", expected, value.ActiveConnections)
+							}
+						}
+
 						conn, err := (&net.Dialer{
 							LocalAddr: &net.TCPAddr{
 								IP:   net.ParseIP(localIP),
@@ -628,24 +1037,340 @@ func testSockOps(t *testing.T) {
 						}).Dial("tcp4", serverSocket)
 						if err != nil {
 							t.Fatalf("Failed to connect to server: %v", err)
-						} else {
-							t.Logf("Connect success: %s:%d -> %s:%d", localIP, clientPort, localIP, serverPort)
 						}
-						conn.Close()
+						time.Sleep(1 * time.Second)
+						checkActiveConnections(1)
 
-						// Now, the TCP connection between between localIP:12345(client) and localIP:54321(server) has been established and closed
+						// the least connection load balancing no longer counts the closed connection
+						conn.Close()
 						time.Sleep(1 * time.Second)
+						checkActiveConnections(0)
+					},
+				},
+				{
+					name: "BPF_SOCK_OPS_TCP_CONNECT_CB__mark_dscp",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						localIP := get_local_ipv4(t)
+						clientPort := 12347
+						serverPort := 54323
+						serverSocket := localIP + ":" + strconv.Itoa(serverPort)
 
-						// Check if the entry was deleted from km_auth_res map
-						// The same key we inserted earlier should no longer exist in the map
-						var value uint32
-						err = mapOfAuth.Lookup(key, &value)
-						if err == nil {
-							t.Fatalf("km_auth_res map entry was not deleted as expected")
-						} else if !errors.Is(err, ebpf.ErrKeyNotExist) {
-							t.Fatalf("Unexpected error when looking up km_auth_res map: %v", err)
-						} else {
-							t.Logf("km_auth_res map entry was successfully cleaned up")
+						// mount cgroup2
+						mount_cgroup2(t, cgroupPath)
+						defer syscall.Unmount(cgroupPath, 0)
+
+						// load the eBPF program
+						coll, lk := load_bpf_2_cgroup(t, objFilePath, cgroupPath)
+						defer coll.Close()
+						defer lk.Close()
+
+						// Set the BPF configuration
+						setBpfConfig(t, coll, &factory.GlobalBpfConfig{
+							BpfLogLevel:  constants.BPF_LOG_DEBUG,
+							AuthzOffload: constants.DISABLED,
+						})
+						startLogReader(coll)
+
+						// record_kmesh_managed_ip
+						enableAddr := constants.ControlCommandIp4 + ":" + strconv.Itoa(int(constants.OperEnableControl))
+						(&net.Dialer{
+							LocalAddr: &net.TCPAddr{
+								IP:   net.ParseIP(localIP),
+								Port: clientPort,
+							},
+							Timeout: 2 * time.Second,
+						}).Dial("tcp4", enableAddr)
+
+						listener, err := net.Listen("tcp4", serverSocket)
+						if err != nil {
+							t.Fatalf("Failed to start TCP server: %v", err)
+						}
+						defer listener.Close()
+
+						// the mocked sock storage marks the connections with the DSCP 46
+						conn, err := (&net.Dialer{
+							LocalAddr: &net.TCPAddr{
+								IP:   net.ParseIP(localIP),
+								Port: clientPort,
+							},
+							Timeout: 2 * time.Second,
+						}).Dial("tcp4", serverSocket)
+						if err != nil {
+							t.Fatalf("Failed to connect to server: %v", err)
+						}
+						defer conn.Close()
+
+						// the kernel stamps the TOS of the socket on each packet it sends, the SYN included
+						rawConn, err := conn.(*net.TCPConn).SyscallConn()
+						if err != nil {
+							t.Fatalf("Failed to get the raw connection: %v", err)
+						}
+						var tos int
+						var sockErr error
+						if err := rawConn.Control(func(fd uintptr) {
+							tos, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+						}); err != nil || sockErr != nil {
+							t.Fatalf("Failed to get the TOS of the connection: %v %v", err, sockErr)
+						}
+						if tos>>2 != 46 {
+							t.Fatalf("Expected the packets to be marked with DSCP 46, but got %d", tos>>2)
+						}
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.objFilename, tt.run())
+	}
+}
+
+func testLoadBalance(t *testing.T) {
+	// backend 1 holds its connections 8 times longer than backend 2
+	slowBackend, fastBackend := uint32(1), uint32(2)
+
+	tests := []unitTests_BUILD_CONTEXT{
+		{
+			objFilename: "workload_lb_test.o",
+			uts: []unitTest_BUILD_CONTEXT{
+				{
+					name: "round_robin__spreads_evenly_whatever_the_latency",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						picks := workload_lb_simulate(t, objFilePath, bpfcache.LbAlgorithmRoundRobin, 1)
+						if picks[slowBackend] != picks[fastBackend] {
+							t.Fatalf("Expected the round robin to pick the backends evenly, but got %v", picks)
+						}
+					},
+				},
+				{
+					name: "least_conn__favors_the_fast_backend",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						picks := workload_lb_simulate(t, objFilePath, bpfcache.LbAlgorithmLeastConn, 1)
+						if picks[slowBackend] == 0 || picks[fastBackend] < 3*picks[slowBackend] {
+							t.Fatalf("Expected the least connection to pick the fast backend far more often, but got %v", picks)
+						}
+					},
+				},
+				{
+					name: "ring_hash__sticks_to_a_backend",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						picked := map[uint32]bool{}
+						for cookie := uint64(1); cookie <= 16; cookie++ {
+							picks := workload_lb_simulate(t, objFilePath, bpfcache.LbAlgorithmRingHash, cookie)
+							if len(picks) != 1 {
+								t.Fatalf("Expected the ring hash to pick a single backend for netns %d, but got %v", cookie, picks)
+							}
+							for uid := range picks {
+								picked[uid] = true
+							}
+						}
+						if !picked[slowBackend] || !picked[fastBackend] {
+							t.Fatalf("Expected the ring hash to spread the netns over the backends, but got %v", picked)
+						}
+					},
+				},
+				{
+					name: "failed_backend_repicks__next_connect_avoids_the_failed_backend",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						// the connect failure recorded by sockops on backend 1, see BPF_SOCK_OPS_STATE_CB__record_connect_failure
+						if uid := workload_lb_select_after_failure(t, objFilePath, 0); uid != slowBackend {
+							t.Fatalf("Expected the service without repicks to keep the failed backend, but got %d", uid)
+						}
+						if uid := workload_lb_select_after_failure(t, objFilePath, bpfcache.MaxBackendRepicks); uid != fastBackend {
+							t.Fatalf("Expected the next connect to land on the healthy backend, but got %d", uid)
+						}
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.objFilename, tt.run())
+	}
+}
+
+// workload_lb_simulate opens a connection per tick to a service of two backends with the given algorithm,
+// the connections to backend 1 last 8 ticks and the ones to backend 2 a single tick. Like sockops, the
+// simulation counts the active connections of the backends the least connection load balancing reads.
+// It returns the number of connections picking each backend.
+func workload_lb_simulate(t *testing.T, objFilename string, algorithm uint32, netnsCookie uint64) map[uint32]int {
+	const (
+		serviceId   = uint32(1)
+		connections = 400
+	)
+	latency := map[uint32]int{1: 8, 2: 1}
+
+	spec := loadAndPrepSpec(t, path.Join(*testPath, objFilename))
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		var ve *ebpf.VerifierError
+		if errors.As(err, &ve) {
+			t.Fatalf("verifier error: %+v", ve)
+		} else {
+			t.Fatal("loading collection:", err)
+		}
+	}
+	defer coll.Close()
+
+	for name, value := range map[string]interface{}{
+		"test_service_id":   serviceId,
+		"mock_netns_cookie": netnsCookie,
+	} {
+		v, ok := coll.Variables[name]
+		if !ok {
+			t.Fatalf("Failed to get %s variable from collection", name)
+		}
+		if err := v.Set(value); err != nil {
+			t.Fatalf("Failed to set %s: %v", name, err)
+		}
+	}
+
+	sv := bpfcache.ServiceValue{LbAlgorithm: algorithm}
+	sv.EndpointCount[0] = uint32(len(latency))
+	if err := coll.Maps["km_service"].Update(&bpfcache.ServiceKey{ServiceId: serviceId}, &sv, ebpf.UpdateAny); err != nil {
+		t.Fatalf("Failed to update km_service map: %v", err)
+	}
+	for uid := range latency {
+		ek := bpfcache.EndpointKey{ServiceId: serviceId, BackendIndex: uid}
+		if err := coll.Maps["km_endpoint"].Update(&ek, &bpfcache.EndpointValue{BackendUid: uid}, ebpf.UpdateAny); err != nil {
+			t.Fatalf("Failed to update km_endpoint map: %v", err)
+		}
+		if err := coll.Maps["km_backend"].Update(&bpfcache.BackendKey{BackendUid: uid}, &bpfcache.BackendValue{}, ebpf.UpdateAny); err != nil {
+			t.Fatalf("Failed to update km_backend map: %v", err)
+		}
+	}
+
+	addActiveConnections := func(uid uint32, delta int32) {
+		bk := bpfcache.BackendKey{BackendUid: uid}
+		var bv bpfcache.BackendValue
+		if err := coll.Maps["km_backend"].Lookup(&bk, &bv); err != nil {
+			t.Fatalf("Failed to lookup km_backend map: %v", err)
+		}
+		bv.ActiveConnections = uint32(int32(bv.ActiveConnections) + delta)
+		if err := coll.Maps["km_backend"].Update(&bk, &bv, ebpf.UpdateAny); err != nil {
+			t.Fatalf("Failed to update km_backend map: %v", err)
+		}
+	}
+
+	picks := map[uint32]int{}
+	// backends of the connections closing at each tick
+	closing := map[int][]uint32{}
+	for tick := 0; tick < connections; tick++ {
+		for _, uid := range closing[tick] {
+			addActiveConnections(uid, -1)
+		}
+		delete(closing, tick)
+
+		// a socket filter needs at least an ethernet header to run
+		uid, err := coll.Programs["lb_pick_prog"].Run(&ebpf.RunOptions{Data: make([]byte, 14)})
+		if err != nil {
+			t.Fatalf("Failed to run lb_pick_prog: %v", err)
+		}
+		if _, ok := latency[uid]; !ok {
+			t.Fatalf("lb_pick_prog picked the unknown backend %d", uid)
+		}
+		picks[uid]++
+		addActiveConnections(uid, 1)
+		closing[tick+latency[uid]] = append(closing[tick+latency[uid]], uid)
+	}
+	return picks
+}
+
+// workload_lb_select_after_failure selects the endpoint of a new connection to a round robin service of two
+// backends with the given failed backend repicks, backend 1 failed to connect just before and is picked first.
+// The picks after the first one go through the endpoints in order. The ipv4 address of a backend is its uid,
+// it returns the backend the connection is redirected to.
+func workload_lb_select_after_failure(t *testing.T, objFilename string, repicks uint32) uint32 {
+	const serviceId = uint32(1)
+
+	spec := loadAndPrepSpec(t, path.Join(*testPath, objFilename))
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		var ve *ebpf.VerifierError
+		if errors.As(err, &ve) {
+			t.Fatalf("verifier error: %+v", ve)
+		} else {
+			t.Fatal("loading collection:", err)
+		}
+	}
+	defer coll.Close()
+
+	for name, value := range map[string]interface{}{
+		"test_service_id": serviceId,
+		"mock_prandom":    uint32(1),
+	} {
+		v, ok := coll.Variables[name]
+		if !ok {
+			t.Fatalf("Failed to get %s variable from collection", name)
+		}
+		if err := v.Set(value); err != nil {
+			t.Fatalf("Failed to set %s: %v", name, err)
+		}
+	}
+
+	sv := bpfcache.ServiceValue{LbAlgorithm: bpfcache.LbAlgorithmRoundRobin, FailedBackendRepicks: repicks}
+	sv.EndpointCount[0] = 2
+	if err := coll.Maps["km_service"].Update(&bpfcache.ServiceKey{ServiceId: serviceId}, &sv, ebpf.UpdateAny); err != nil {
+		t.Fatalf("Failed to update km_service map: %v", err)
+	}
+
+	var now unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &now); err != nil {
+		t.Fatalf("Failed to get the monotonic time: %v", err)
+	}
+	for uid, bv := range map[uint32]bpfcache.BackendValue{
+		1: {ConnectFailNs: uint64(now.Nano()), ConnectFailCount: 1},
+		2: {},
+	} {
+		binary.NativeEndian.PutUint32(bv.Ip[:4], uid)
+		ek := bpfcache.EndpointKey{ServiceId: serviceId, BackendIndex: uid}
+		if err := coll.Maps["km_endpoint"].Update(&ek, &bpfcache.EndpointValue{BackendUid: uid}, ebpf.UpdateAny); err != nil {
+			t.Fatalf("Failed to update km_endpoint map: %v", err)
+		}
+		if err := coll.Maps["km_backend"].Update(&bpfcache.BackendKey{BackendUid: uid}, &bv, ebpf.UpdateAny); err != nil {
+			t.Fatalf("Failed to update km_backend map: %v", err)
+		}
+	}
+
+	// a socket filter needs at least an ethernet header to run
+	uid, err := coll.Programs["lb_select_prog"].Run(&ebpf.RunOptions{Data: make([]byte, 14)})
+	if err != nil {
+		t.Fatalf("Failed to run lb_select_prog: %v", err)
+	}
+	return uid
+}
+
+func testBandwidth(t *testing.T) {
+	// 10Mbps
+	const bandwidth = 1250000
+
+	tests := []unitTests_BUILD_CONTEXT{
+		{
+			objFilename: "workload_bandwidth_test.o",
+			uts: []unitTest_BUILD_CONTEXT{
+				{
+					name: "egress__tcp_is_throttled_near_the_bandwidth",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						passed, dropped := workload_bandwidth_simulate(t, objFilePath, bpfcache.BandwidthEgress, bandwidth, true)
+						if passed < bandwidth*9/10 || passed > bandwidth*105/100 {
+							t.Fatalf("Expected about %d bytes to pass in a second, but got %d", bandwidth, passed)
+						}
+						if dropped != 0 {
+							t.Fatalf("Expected the sender slowing down on congestion to be throttled, but %d packets were dropped", dropped)
+						}
+					},
+				},
+				{
+					name: "ingress__sender_not_slowing_down_is_dropped",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						passed, dropped := workload_bandwidth_simulate(t, objFilePath, bpfcache.BandwidthIngress, bandwidth, false)
+						if passed < bandwidth*9/10 || passed > bandwidth*105/100 {
+							t.Fatalf("Expected about %d bytes to pass in a second, but got %d", bandwidth, passed)
+						}
+						if dropped == 0 {
+							t.Fatal("Expected the packets beyond the bandwidth to be dropped")
 						}
 					},
 				},
@@ -658,6 +1383,87 @@ func testSockOps(t *testing.T) {
 	}
 }
 
+// workload_bandwidth_simulate sends packets of 1500 bytes for a simulated second to a service limited to
+// bandwidth bytes per second in the direction, starting at four times the bandwidth. Like tcp, a sender
+// slowing down halves its rate on each packet throttled or dropped and else grows it by a sixteenth
+// of the bandwidth. It returns the bytes which passed and the number of packets dropped.
+func workload_bandwidth_simulate(t *testing.T, objFilename string, direction, bandwidth uint32, slowDown bool) (uint64, int) {
+	const (
+		serviceId = uint32(1)
+		packetLen = 1500
+
+		verdictThrottle = 1
+		verdictDrop     = 2
+	)
+
+	spec := loadAndPrepSpec(t, path.Join(*testPath, objFilename))
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		var ve *ebpf.VerifierError
+		if errors.As(err, &ve) {
+			t.Fatalf("verifier error: %+v", ve)
+		} else {
+			t.Fatal("loading collection:", err)
+		}
+	}
+	defer coll.Close()
+
+	setVariable := func(name string, value interface{}) {
+		v, ok := coll.Variables[name]
+		if !ok {
+			t.Fatalf("Failed to get %s variable from collection", name)
+		}
+		if err := v.Set(value); err != nil {
+			t.Fatalf("Failed to set %s: %v", name, err)
+		}
+	}
+	setVariable("test_service_id", serviceId)
+	setVariable("test_direction", direction)
+
+	sv := bpfcache.ServiceValue{}
+	sv.Bandwidth[direction] = bandwidth
+	if err := coll.Maps["km_service"].Update(&bpfcache.ServiceKey{ServiceId: serviceId}, &sv, ebpf.UpdateAny); err != nil {
+		t.Fatalf("Failed to update km_service map: %v", err)
+	}
+
+	var (
+		passed  uint64
+		dropped int
+		// a socket filter sees the packet without its ethernet header
+		data = make([]byte, 14+packetLen)
+		rate = 4 * float64(bandwidth)
+	)
+	for now := time.Duration(0); now < time.Second; now += time.Duration(packetLen / rate * float64(time.Second)) {
+		setVariable("mock_now_ns", uint64(now))
+		verdict, err := coll.Programs["bandwidth_charge_prog"].Run(&ebpf.RunOptions{Data: data})
+		if err != nil {
+			t.Fatalf("Failed to run bandwidth_charge_prog: %v", err)
+		}
+		if verdict == verdictDrop {
+			dropped++
+		} else {
+			passed += packetLen
+		}
+		if !slowDown {
+			continue
+		}
+		if verdict == verdictThrottle || verdict == verdictDrop {
+			rate /= 2
+		} else {
+			rate += float64(bandwidth) / 16
+		}
+	}
+
+	var throttled bpfcache.ServiceValue
+	if err := coll.Maps["km_service"].Lookup(&bpfcache.ServiceKey{ServiceId: serviceId}, &throttled); err != nil {
+		t.Fatalf("Failed to lookup km_service map: %v", err)
+	}
+	if throttled.BandwidthThrottled[direction] == 0 {
+		t.Fatal("Expected the throttled packets to be counted")
+	}
+	return passed, dropped
+}
+
 // mount_cgroup2 mounts a cgroup v2 filesystem at the specified path.
 // It creates the directory at cgroupPath if it doesn't exist, then attempts
 // to mount a cgroup2 filesystem at that location.
@@ -697,13 +1503,14 @@ func mount_cgroup2(t *testing.T, cgroupPath string) {
 //   - t: Testing context for reporting failures
 //   - objFilename: Name of the eBPF object file to load (must not be empty)
 //   - cgroupPath: Path to the cgroup where the program will be attached (must not be empty)
+//   - prep: Functions modifying the collection spec before it is loaded
 //
 // Returns:
 //   - *ebpf.Collection: The loaded eBPF collection containing programs and maps
 //   - link.Link: The link representing the attachment to the cgroup
 //
 // The function will call t.Fatal if any error occurs during loading or attachment.
-func load_bpf_2_cgroup(t *testing.T, objFilename string, cgroupPath string) (*ebpf.Collection, link.Link) {
+func load_bpf_2_cgroup(t *testing.T, objFilename string, cgroupPath string, prep ...func(spec *ebpf.CollectionSpec)) (*ebpf.Collection, link.Link) {
 	if cgroupPath == "" {
 		t.Fatal("cgroupPath is empty")
 	}
@@ -713,6 +1520,9 @@ func load_bpf_2_cgroup(t *testing.T, objFilename string, cgroupPath string) (*eb
 
 	// load the eBPF program
 	spec := loadAndPrepSpec(t, path.Join(*testPath, objFilename))
+	for _, p := range prep {
+		p(spec)
+	}
 	var (
 		coll *ebpf.Collection
 		err  error
@@ -767,3 +1577,184 @@ func get_local_ipv4(t *testing.T) string {
 	}
 	return localAddr
 }
+
+// testAuthIpTuple checks the auth request of a connection accepted under the cgroup is streamed to the
+// daemon by mechanism, the events read through perf buffers are the same as through ring buffers
+func testAuthIpTuple(t *testing.T, cgroupPath, objFilePath, mechanism string) {
+	localIP := get_local_ipv4(t)
+	clientPort := 12345
+	serverPort := 54321
+	serverSocket := localIP + ":" + strconv.Itoa(serverPort)
+
+	// mount cgroup2
+	mount_cgroup2(t, cgroupPath)
+	defer syscall.Unmount(cgroupPath, 0)
+
+	// load the eBPF program
+	coll, lk := load_bpf_2_cgroup(t, objFilePath, cgroupPath, func(spec *ebpf.CollectionSpec) {
+		if err := bpfUtils.SetEventMechanism(spec, mechanism); err != nil {
+			t.Fatalf("Failed to set the event mechanism: %v", err)
+		}
+		// the test programs log through a ring buffer, the kernels running them have ring buffers
+		spec.Maps["km_log_event"].Type = ebpf.RingBuf
+	})
+	defer coll.Close()
+	defer lk.Close()
+
+	// Set the BPF configuration
+	setBpfConfig(t, coll, &factory.GlobalBpfConfig{
+		BpfLogLevel:  constants.BPF_LOG_DEBUG,
+		AuthzOffload: constants.DISABLED,
+	})
+	startLogReader(coll)
+
+	// the events are output to a perf buffer only once it is read, read km_auth_req like the daemon does
+	kmAuthReqMap := coll.Maps["km_auth_req"]
+	if kmAuthReqMap == nil {
+		t.Fatal("Failed to get km_auth_req map from collection")
+	}
+	samples := make(chan []byte, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go utils.NewRingbufConsumer("km_auth_req", kmAuthReqMap, auth.MSG_LEN, func(sample []byte) {
+		samples <- sample
+	}).Run(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	// record_kmesh_managed_ip
+	enableAddr := constants.ControlCommandIp4 + ":" + strconv.Itoa(int(constants.OperEnableControl))
+	(&net.Dialer{
+		LocalAddr: &net.TCPAddr{
+			IP:   net.ParseIP(localIP),
+			Port: clientPort,
+		},
+		Timeout: 2 * time.Second,
+	}).Dial("tcp4", enableAddr)
+
+	// Create a TCP server listener
+	listener, err := net.Listen("tcp4", serverSocket)
+	if err != nil {
+		t.Fatalf("Failed to start TCP server: %v", err)
+	}
+	defer listener.Close()
+
+	// try to connect to the server using the specified client port
+	conn, err := (&net.Dialer{
+		LocalAddr: &net.TCPAddr{
+			IP:   net.ParseIP(localIP),
+			Port: clientPort,
+		},
+		Timeout: 2 * time.Second,
+	}).Dial("tcp4", serverSocket)
+	if err != nil {
+		t.Fatalf("Failed to connect to server: %v", err)
+	} else {
+		t.Logf("Connect success: %s:%d -> %s:%d", localIP, clientPort, localIP, serverPort)
+	}
+	defer conn.Close()
+
+	// Now, the TCP connection between localIP:12345(client) and localIP:54321(server) has been established
+	// Check the contents of km_auth_req
+	var sample []byte
+	select {
+	case sample = <-samples:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No km_auth_req event read through %s", mechanism)
+	}
+	var event [40]byte // sizeof(struct ringbuf_msg_type)
+	if len(sample) != len(event) {
+		t.Fatalf("Expected a km_auth_req event of %d bytes through %s, but got %d", len(event), mechanism, len(sample))
+	}
+	copy(event[:], sample)
+	protoType := binary.LittleEndian.Uint32(event[0:4])
+	srcIP := net.IPv4(event[4], event[5], event[6], event[7])
+	dstIP := net.IPv4(event[8], event[9], event[10], event[11])
+	srcPort := binary.BigEndian.Uint16(event[12:14])
+	dstPort := binary.BigEndian.Uint16(event[14:16])
+	t.Logf("Received km_auth_req ringbuf_msg through %s: type=%d, src=%s:%d, dst=%s:%d", mechanism, protoType, srcIP, srcPort, dstIP, dstPort)
+
+	// Check
+	if protoType != constants.MSG_TYPE_IPV4 ||
+		srcIP.String() != localIP || int(srcPort) != clientPort ||
+		dstIP.String() != localIP || int(dstPort) != serverPort {
+		t.Fatalf("Expected {protoType: %d, srcIP: %s, srcPort: %d, dstIP: %s, dstPort: %d}, but got {protoType: %d, srcIP: %s, srcPort: %d, dstIP: %s, dstPort: %d}",
+			constants.MSG_TYPE_IPV4, localIP, clientPort, localIP, serverPort,
+			protoType, srcIP, srcPort, dstIP, dstPort)
+	}
+}
+
+func testRedirectPorts(t *testing.T) {
+	ports := []uint16{80, 443, 8080}
+
+	tests := []unitTests_BUILD_CONTEXT{
+		{
+			objFilename: "workload_redirect_port_test.o",
+			uts: []unitTest_BUILD_CONTEXT{
+				{
+					name: "listed__only_the_listed_ports_are_redirected",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						redirected := workload_redirect_port_run(t, objFilePath, ports, []uint16{80, 443, 8080, 22, 3306, 8081})
+						want := map[uint16]bool{80: true, 443: true, 8080: true, 22: false, 3306: false, 8081: false}
+						for port, ok := range want {
+							if redirected[port] != ok {
+								t.Fatalf("Expected the redirection of port %d to be %v with --redirect-ports %v, but got %v", port, ok, ports, redirected[port])
+							}
+						}
+					},
+				},
+				{
+					name: "empty__all_the_ports_are_redirected",
+					workFunc: func(t *testing.T, cgroupPath, objFilePath string) {
+						redirected := workload_redirect_port_run(t, objFilePath, nil, []uint16{80, 22, 3306})
+						for port, ok := range redirected {
+							if !ok {
+								t.Fatalf("Expected port %d to be redirected without --redirect-ports", port)
+							}
+						}
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.objFilename, tt.run())
+	}
+}
+
+// workload_redirect_port_run loads the allowlist of the redirected ports like the daemon does for --redirect-ports,
+// and returns whether the connect programs redirect the connections to each of the probed ports
+func workload_redirect_port_run(t *testing.T, objFilename string, ports, probed []uint16) map[uint16]bool {
+	spec := loadAndPrepSpec(t, path.Join(*testPath, objFilename))
+	if err := bpfUtils.SetRedirectPortFilter(spec, ports); err != nil {
+		t.Fatalf("Failed to set the redirect port filter: %v", err)
+	}
+	coll, err := ebpf.NewCollection(spec)
+	if err != nil {
+		var ve *ebpf.VerifierError
+		if errors.As(err, &ve) {
+			t.Fatalf("verifier error: %+v", ve)
+		} else {
+			t.Fatal("loading collection:", err)
+		}
+	}
+	defer coll.Close()
+
+	if err := bpfUtils.UpdateRedirectPorts(coll.Maps["km_redirect_port"], ports); err != nil {
+		t.Fatalf("Failed to update km_redirect_port map: %v", err)
+	}
+
+	redirected := map[uint16]bool{}
+	for _, port := range probed {
+		if err := coll.Variables["test_port"].Set(uint32(port)); err != nil {
+			t.Fatalf("Failed to set test_port: %v", err)
+		}
+		// a socket filter needs at least an ethernet header to run
+		ret, err := coll.Programs["redirect_port_prog"].Run(&ebpf.RunOptions{Data: make([]byte, 14)})
+		if err != nil {
+			t.Fatalf("Failed to run redirect_port_prog: %v", err)
+		}
+		redirected[port] = ret == 1
+	}
+	return redirected
+}
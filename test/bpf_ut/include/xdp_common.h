@@ -86,6 +86,36 @@
         __ret;                                                                                                         \
     })
 
+/* build_xdp_packet_v6 builds the ipv6 TCP packet of the headers, with the default ethernet header */
+#define build_xdp_packet_v6(ctx, p_ipv6hdr, p_tcphdr)                                                                  \
+    ({                                                                                                                 \
+        unsigned int data_len = (ctx)->data_end - (ctx)->data;                                                         \
+        int offset = 4096 - 256 - 320 - data_len;                                                                      \
+        if (bpf_xdp_adjust_tail(ctx, offset) != 0) {                                                                   \
+            return TEST_ERROR;                                                                                         \
+        }                                                                                                              \
+                                                                                                                       \
+        void *data = (void *)(long)((ctx)->data);                                                                      \
+        void *data_end = (void *)(long)((ctx)->data_end);                                                              \
+        const struct ethhdr eth = {                                                                                    \
+            .h_source = {0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},                                                          \
+            .h_dest = {0x12, 0x23, 0x34, 0x45, 0x56, 0x67},                                                            \
+            .h_proto = bpf_htons(ETH_P_IPV6)};                                                                         \
+                                                                                                                       \
+        if (data + sizeof(struct ethhdr) + sizeof(struct ipv6hdr) + sizeof(struct tcphdr) > data_end)                  \
+            return TEST_ERROR;                                                                                         \
+        bpf_memcpy(data, &eth, sizeof(struct ethhdr));                                                                 \
+        data += sizeof(struct ethhdr);                                                                                 \
+        bpf_memcpy(data, (p_ipv6hdr), sizeof(struct ipv6hdr));                                                         \
+        data += sizeof(struct ipv6hdr);                                                                                \
+        bpf_memcpy(data, (p_tcphdr), sizeof(struct tcphdr));                                                           \
+        data += sizeof(struct tcphdr);                                                                                 \
+                                                                                                                       \
+        offset = (int)((long)data - (long)data_end);                                                                   \
+        bpf_xdp_adjust_tail(ctx, offset);                                                                              \
+        TEST_PASS;                                                                                                     \
+    })
+
 /**
  * @brief Verifies that a processed packet matches expected values
  *
@@ -0,0 +1,34 @@
+#include <linux/in.h>
+#include <linux/bpf.h>
+#include <sys/socket.h>
+#include <bpf/bpf_helpers.h>
+#include "bpf_log.h"
+#include "bpf_common.h"
+
+// mock bpf_ktime_get_ns, the test simulates the time the packets are sent at
+__u64 mock_now_ns = 0;
+
+#define bpf_ktime_get_ns() mock_now_ns
+
+#include "bandwidth.h"
+
+// service and direction whose bandwidth the packets are charged to, set by the test
+__u32 test_service_id = 0;
+__u32 test_direction = BANDWIDTH_EGRESS;
+
+// charge a packet of the length of the test data to the bandwidth of the service, returns the verdict
+SEC("socket")
+int bandwidth_charge_prog(struct __sk_buff *skb)
+{
+    service_key service_k = {0};
+    service_value *service_v = NULL;
+
+    service_k.service_id = test_service_id;
+    service_v = bpf_map_lookup_elem(&map_of_service, &service_k);
+    if (!service_v)
+        return BANDWIDTH_PASS;
+    return bandwidth_charge(service_v, test_direction, skb->len);
+}
+
+char _license[] SEC("license") = "Dual BSD/GPL";
+int _version SEC("version") = 1;
@@ -0,0 +1,80 @@
+#include <linux/in.h>
+#include <linux/bpf.h>
+#include <sys/socket.h>
+#include <bpf/bpf_helpers.h>
+#include "bpf_log.h"
+#include "ctx/sock_addr.h"
+#include "bpf_common.h"
+
+// mock bpf_get_netns_cookie, a socket filter has no netns cookie to hash the client pods by
+__u64 mock_netns_cookie = 1;
+
+#define bpf_get_netns_cookie(ctx) mock_netns_cookie
+
+// the test may replace bpf_get_prandom_u32 by a counter to pick the endpoints in a known order
+__u32 mock_prandom = 0;
+__u32 mock_prandom_next = 0;
+
+static inline __u32 test_get_prandom_u32(void)
+{
+    if (mock_prandom)
+        return mock_prandom_next++;
+    return bpf_get_prandom_u32();
+}
+
+#define bpf_get_prandom_u32 test_get_prandom_u32
+
+#include "service.h"
+
+// service whose endpoints are picked, set by the test
+__u32 test_service_id = 0;
+
+// pick an endpoint of the first prio of the service like the connect programs, returns its backend uid
+SEC("socket")
+int lb_pick_prog(struct __sk_buff *skb)
+{
+    struct kmesh_context kmesh_ctx = {0};
+    service_key service_k = {0};
+    service_value *service_v = NULL;
+    endpoint_key endpoint_k = {0};
+    endpoint_value *endpoint_v = NULL;
+    __u32 count;
+
+    service_k.service_id = test_service_id;
+    service_v = map_lookup_service(&service_k);
+    if (!service_v)
+        return 0;
+    count = service_v->prio_endpoint_count[0];
+    if (count == 0)
+        return 0;
+
+    endpoint_k.service_id = test_service_id;
+    endpoint_v = lb_pick_endpoint(&kmesh_ctx, &endpoint_k, service_v, count, 0);
+    return endpoint_v ? endpoint_v->backend_uid : 0;
+}
+
+// select an endpoint of the first prio of the service like the connect programs, picking again when the
+// backend recently failed to connect, returns the ipv4 address the connection is redirected to
+SEC("socket")
+int lb_select_prog(struct __sk_buff *skb)
+{
+    struct kmesh_context kmesh_ctx = {0};
+    struct bpf_sock_addr sock_addr = {0};
+    service_key service_k = {0};
+    service_value *service_v = NULL;
+
+    // the connection is to the first port of the service
+    sock_addr.user_family = AF_INET;
+    kmesh_ctx.ctx = &sock_addr;
+
+    service_k.service_id = test_service_id;
+    service_v = map_lookup_service(&service_k);
+    if (!service_v)
+        return 0;
+    if (lb_select_endpoint(&kmesh_ctx, test_service_id, service_v, 0))
+        return 0;
+    return kmesh_ctx.dnat_ip.ip4;
+}
+
+char _license[] SEC("license") = "Dual BSD/GPL";
+int _version SEC("version") = 1;
@@ -0,0 +1,20 @@
+#include <linux/in.h>
+#include <linux/bpf.h>
+#include <sys/socket.h>
+#include <bpf/bpf_helpers.h>
+#include "bpf_log.h"
+#include "bpf_common.h"
+#include "redirect_port.h"
+
+// destination port of the connection, in host byte order, set by the test
+__u32 test_port = 0;
+
+// whether the connect programs redirect the connections to the port, returns 1 if they do
+SEC("socket")
+int redirect_port_prog(struct __sk_buff *skb)
+{
+    return is_redirect_port(bpf_htons((__u16)test_port));
+}
+
+char _license[] SEC("license") = "Dual BSD/GPL";
+int _version SEC("version") = 1;
@@ -6,6 +6,8 @@
 // mock bpf_sk_storage_get
 struct sock_storage_data mock_storage = {
     .via_waypoint = 1,
+    .backend_uid = 1,
+    .dscp = 46,
 };
 
 static void *mock_bpf_sk_storage_get(void *map, void *sk, void *value, __u64 flags)
@@ -106,3 +106,550 @@ int test2_check(const struct xdp_md *ctx)
     check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
     test_finish();
 }
+
+PKTGEN("xdp", "5_deny_policy_when_conditions_matched")
+int test3_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "5_deny_policy_when_conditions_matched")
+int test3_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "5_deny_policy_when_conditions_matched")
+int test3_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "6_deny_policy_l7_condition_skipped")
+int test4_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "6_deny_policy_l7_condition_skipped")
+int test4_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "6_deny_policy_l7_condition_skipped")
+int test4_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_PASS;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "7_deny_policy_workload_offload")
+int test5_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "7_deny_policy_workload_offload")
+int test5_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "7_deny_policy_workload_offload")
+int test5_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "8_network_policy_allowed_source")
+int test6_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "8_network_policy_allowed_source")
+int test6_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "8_network_policy_allowed_source")
+int test6_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_PASS;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "9_network_policy_denied_source")
+int test7_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "9_network_policy_denied_source")
+int test7_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "9_network_policy_denied_source")
+int test7_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "10_network_policy_deny_all")
+int test8_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "10_network_policy_deny_all")
+int test8_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "10_network_policy_deny_all")
+int test8_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+/* [fd00::f]:23445 -> [fd00:1::f]:80, the server of DEST_IP is dual-stack */
+#define SRC_IP6  {0xfd, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x0f}
+#define DEST_IP6 {0xfd, 0, 0, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x0f}
+
+PKTGEN("xdp", "11_ipv6_ipblock_deny_matched")
+int test9_pktgen(struct xdp_md *ctx)
+{
+    const struct ipv6hdr l3 = {
+        .version = 6,
+        .payload_len = bpf_htons(sizeof(struct tcphdr)),
+        .nexthdr = IPPROTO_TCP,
+        .hop_limit = 64,
+        .saddr = {.in6_u.u6_addr8 = SRC_IP6},
+        .daddr = {.in6_u.u6_addr8 = DEST_IP6},
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet_v6(ctx, &l3, &l4);
+}
+
+JUMP("xdp", "11_ipv6_ipblock_deny_matched")
+int test9_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "11_ipv6_ipblock_deny_matched")
+int test9_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "12_ipv6_ipblock_deny_ipv4_unaffected")
+int test10_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "12_ipv6_ipblock_deny_ipv4_unaffected")
+int test10_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "12_ipv6_ipblock_deny_ipv4_unaffected")
+int test10_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_PASS;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "13_mixed_ipblocks_deny_ipv4_matched")
+int test11_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "13_mixed_ipblocks_deny_ipv4_matched")
+int test11_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "13_mixed_ipblocks_deny_ipv4_matched")
+int test11_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "14_two_rules_deny_second_rule_matched")
+int test12_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "14_two_rules_deny_second_rule_matched")
+int test12_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "14_two_rules_deny_second_rule_matched")
+int test12_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "15_two_rules_deny_no_rule_matched")
+int test13_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "15_two_rules_deny_no_rule_matched")
+int test13_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "15_two_rules_deny_no_rule_matched")
+int test13_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_PASS;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "16_from_to_rule_deny_both_matched")
+int test14_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "16_from_to_rule_deny_both_matched")
+int test14_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "16_from_to_rule_deny_both_matched")
+int test14_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_DROP;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
+
+PKTGEN("xdp", "17_from_to_rule_deny_only_from_matched")
+int test15_pktgen(struct xdp_md *ctx)
+{
+    const struct iphdr l3 = {
+        .version = 4,
+        .ihl = 5,
+        .tot_len = 40, /* 20 bytes l3 + 20 bytes l4 + 20 bytes data */
+        .id = 0x5438,
+        .frag_off = bpf_htons(IP_DF),
+        .ttl = 64,
+        .protocol = IPPROTO_TCP,
+        .saddr = SRC_IP,
+        .daddr = DEST_IP,
+    };
+    const struct tcphdr l4 = {
+        .source = bpf_htons(SRC_PORT),
+        .dest = bpf_htons(DEST_PORT),
+        .seq = 2922048129,
+        .doff = 0, /* no options */
+        .syn = 1,
+        .window = 64240,
+    };
+
+    return build_xdp_packet(ctx, NULL, &l3, &l4, NULL, 0);
+}
+
+JUMP("xdp", "17_from_to_rule_deny_only_from_matched")
+int test15_jump(struct xdp_md *ctx)
+{
+    bpf_tail_call(ctx, &entry_call_map, 0);
+    return TEST_ERROR;
+}
+
+CHECK("xdp", "17_from_to_rule_deny_only_from_matched")
+int test15_check(const struct xdp_md *ctx)
+{
+    const __u32 exp_status_code = XDP_PASS;
+    test_init();
+    check_xdp_packet(ctx, &exp_status_code, NULL, NULL, NULL, NULL, 0);
+    test_finish();
+}
@@ -25,11 +25,15 @@ package kmesh
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand/v2"
 	"net/http"
 	"net/netip"
 	"os/exec"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -39,6 +43,7 @@ import (
 	"istio.io/api/label"
 	"istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/test"
 	echot "istio.io/istio/pkg/test/echo"
 	"istio.io/istio/pkg/test/echo/common/scheme"
@@ -51,6 +56,7 @@ import (
 	"istio.io/istio/pkg/test/framework/components/echo/config/param"
 	"istio.io/istio/pkg/test/framework/components/echo/echotest"
 	"istio.io/istio/pkg/test/framework/components/echo/util/traffic"
+	"istio.io/istio/pkg/test/framework/components/namespace"
 	"istio.io/istio/pkg/test/framework/components/prometheus"
 	testKube "istio.io/istio/pkg/test/kube"
 	"istio.io/istio/pkg/test/shell"
@@ -58,6 +64,12 @@ import (
 	"istio.io/istio/pkg/util/sets"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+
+	"kmesh.net/kmesh/api/v2/adminapi"
+	"kmesh.net/kmesh/ctl/utils"
+	"kmesh.net/kmesh/ctl/waypoint"
+	"kmesh.net/kmesh/pkg/adminclient"
+	"kmesh.net/kmesh/test/e2e/fixtures"
 )
 
 func IsL7() echo.Checker {
@@ -461,6 +473,327 @@ spec:
 	})
 }
 
+// Test that the backends behind a waypoint annotated with the PROXY protocol observe the original client address.
+func TestWaypointProxyProtocol(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		cls := t.Clusters().Default()
+		gwc := cls.GatewayAPI().GatewayV1().Gateways(apps.Namespace.Name())
+		efc := cls.Istio().NetworkingV1alpha3().EnvoyFilters(apps.Namespace.Name())
+
+		gw, err := gwc.Get(context.Background(), "waypoint", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gw.Annotations[waypoint.KmeshProxyProtocolAnnotation] = waypoint.ProxyProtocolV2
+		if gw, err = gwc.Update(context.Background(), gw, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		ef, err := waypoint.ProxyProtocolEnvoyFilter(gw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := efc.Create(context.Background(), ef, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := efc.Delete(context.Background(), ef.Name, metav1.DeleteOptions{}); err != nil {
+				t.Logf("failed to delete EnvoyFilter %s: %v", ef.Name, err)
+			}
+			gw, err := gwc.Get(context.Background(), "waypoint", metav1.GetOptions{})
+			if err != nil {
+				t.Logf("failed to get waypoint: %v", err)
+				return
+			}
+			delete(gw.Annotations, waypoint.KmeshProxyProtocolAnnotation)
+			if _, err := gwc.Update(context.Background(), gw, metav1.UpdateOptions{}); err != nil {
+				t.Logf("failed to update waypoint: %v", err)
+			}
+		})
+
+		for _, src := range apps.EnrolledToKmesh {
+			t.NewSubTestf("from %v", src.Config().Service).Run(func(t framework.TestContext) {
+				src.CallOrFail(t, echo.CallOptions{
+					To:      apps.ServiceWithWaypointAtServiceGranularity,
+					Port:    echo.Port{Name: ports.HTTPWithProxy.Name},
+					Scheme:  scheme.HTTP,
+					Count:   5,
+					Timeout: 10 * time.Second,
+					Check: check.And(
+						check.OK(),
+						check.ProxyProtocolVersion("2"),
+						OriginalSourceCheck(t, src)),
+				})
+			})
+		}
+	})
+}
+
+// Test that the waypoint originates TLS to the upstream of a ServiceEntry as configured by a DestinationRule,
+// the client sends plaintext while the upstream only accepts TLS.
+func TestWaypointTLSOrigination(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		ns := apps.Namespace.Name()
+		upstream := apps.EnrolledToKmesh[0]
+		t.ConfigIstio().Eval(ns, map[string]any{
+			"IP":       upstream.WorkloadsOrFail(t)[0].Address(),
+			"Port":     upstream.Config().Ports.MustForName(ports.HTTPS.Name).WorkloadPort,
+			"Waypoint": "waypoint",
+		}, `apiVersion: networking.istio.io/v1
+kind: ServiceEntry
+metadata:
+  name: external-tls
+  labels:
+    istio.io/use-waypoint: {{.Waypoint}}
+spec:
+  hosts:
+  - external-tls.example.com
+  addresses:
+  - 240.240.240.254
+  ports:
+  - number: 80
+    name: tcp
+    protocol: TCP
+    targetPort: {{.Port}}
+  resolution: STATIC
+  location: MESH_EXTERNAL
+  endpoints:
+  - address: {{.IP}}
+---
+apiVersion: networking.istio.io/v1
+kind: DestinationRule
+metadata:
+  name: external-tls
+spec:
+  host: external-tls.example.com
+  trafficPolicy:
+    tls:
+      mode: SIMPLE
+      # the certificate of the echo server is self-signed
+      insecureSkipVerify: true
+`).ApplyOrFail(t)
+
+		cls := t.Clusters().Default()
+		dr, err := cls.Istio().NetworkingV1().DestinationRules(ns).Get(context.Background(), "external-tls", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ef, err := waypoint.TLSOriginationEnvoyFilter(dr, "waypoint", []uint32{80})
+		if err != nil {
+			t.Fatal(err)
+		}
+		efc := cls.Istio().NetworkingV1alpha3().EnvoyFilters(ns)
+		if _, err := efc.Create(context.Background(), ef, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := efc.Delete(context.Background(), ef.Name, metav1.DeleteOptions{}); err != nil {
+				t.Logf("failed to delete EnvoyFilter %s: %v", ef.Name, err)
+			}
+		})
+
+		for _, src := range apps.EnrolledToKmesh {
+			t.NewSubTestf("from %v", src.Config().Service).Run(func(t framework.TestContext) {
+				// a plaintext request reaching the https port of the echo server would be rejected
+				src.CallOrFail(t, echo.CallOptions{
+					Address: "240.240.240.254",
+					Port:    echo.Port{ServicePort: 80, Protocol: protocol.HTTP},
+					Scheme:  scheme.HTTP,
+					Count:   5,
+					Timeout: 10 * time.Second,
+					Check:   check.OK(),
+				})
+			})
+		}
+	})
+}
+
+// Test that the traffic to an external service leaves the mesh through the egress gateway the ServiceEntry
+// uses as its waypoint, which lives in a namespace of its own and originates TLS as configured by a DestinationRule.
+func TestEgressGateway(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		egress := namespace.NewOrFail(t, namespace.Config{
+			Prefix: "egress",
+			Inject: false,
+		})
+		gateway := "egress-gateway"
+		newWaypointProxyOrFail(t, t, egress, gateway, constants.ServiceTraffic)
+		t.Cleanup(func() {
+			deleteWaypointProxyOrFail(t, t, egress, gateway)
+		})
+
+		ns := egress.Name()
+		upstream := apps.EnrolledToKmesh[0]
+		t.ConfigIstio().Eval(ns, map[string]any{
+			"IP":      upstream.WorkloadsOrFail(t)[0].Address(),
+			"Port":    upstream.Config().Ports.MustForName(ports.HTTPS.Name).WorkloadPort,
+			"Gateway": gateway,
+		}, `apiVersion: networking.istio.io/v1
+kind: ServiceEntry
+metadata:
+  name: external-egress
+  labels:
+    istio.io/use-waypoint: {{.Gateway}}
+spec:
+  exportTo:
+  - "*"
+  hosts:
+  - external-egress.example.com
+  addresses:
+  - 240.240.240.253
+  ports:
+  - number: 80
+    name: tcp
+    protocol: TCP
+    targetPort: {{.Port}}
+  resolution: STATIC
+  location: MESH_EXTERNAL
+  endpoints:
+  - address: {{.IP}}
+---
+apiVersion: networking.istio.io/v1
+kind: DestinationRule
+metadata:
+  name: external-egress
+spec:
+  exportTo:
+  - "*"
+  host: external-egress.example.com
+  trafficPolicy:
+    tls:
+      mode: SIMPLE
+      # the certificate of the echo server is self-signed
+      insecureSkipVerify: true
+`).ApplyOrFail(t)
+
+		cls := t.Clusters().Default()
+		dr, err := cls.Istio().NetworkingV1().DestinationRules(ns).Get(context.Background(), "external-egress", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ef, err := waypoint.TLSOriginationEnvoyFilter(dr, gateway, []uint32{80})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cls.Istio().NetworkingV1alpha3().EnvoyFilters(ns).Create(context.Background(), ef, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, src := range apps.EnrolledToKmesh {
+			t.NewSubTestf("from %v", src.Config().Service).Run(func(t framework.TestContext) {
+				// the plaintext request is only accepted by the https port of the echo server once the egress
+				// gateway originated TLS, and the gateway sets the request id
+				src.CallOrFail(t, echo.CallOptions{
+					Address: "240.240.240.253",
+					Port:    echo.Port{ServicePort: 80, Protocol: protocol.HTTP},
+					Scheme:  scheme.HTTP,
+					Count:   5,
+					Timeout: 10 * time.Second,
+					Check:   check.And(check.OK(), IsL7()),
+				})
+			})
+		}
+	})
+}
+
+// Test that the waypoint closes its upstream connections to a service after the maxRequestsPerConnection
+// of a DestinationRule, each request then opens a connection of its own to the backends.
+func TestWaypointMaxRequestsPerConnection(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		ns := apps.Namespace.Name()
+		svc := apps.ServiceWithWaypointAtServiceGranularity.Config().Service
+		t.ConfigIstio().Eval(ns, map[string]any{
+			"Service": svc,
+		}, `apiVersion: networking.istio.io/v1
+kind: DestinationRule
+metadata:
+  name: max-requests
+spec:
+  host: {{.Service}}
+  trafficPolicy:
+    connectionPool:
+      http:
+        maxRequestsPerConnection: 1
+`).ApplyOrFail(t)
+
+		cls := t.Clusters().Default()
+		dr, err := cls.Istio().NetworkingV1().DestinationRules(ns).Get(context.Background(), "max-requests", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ef, err := waypoint.MaxRequestsEnvoyFilter(dr, "waypoint")
+		if err != nil {
+			t.Fatal(err)
+		}
+		efc := cls.Istio().NetworkingV1alpha3().EnvoyFilters(ns)
+		if _, err := efc.Create(context.Background(), ef, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := efc.Delete(context.Background(), ef.Name, metav1.DeleteOptions{}); err != nil {
+				t.Logf("failed to delete EnvoyFilter %s: %v", ef.Name, err)
+			}
+		})
+
+		port := apps.ServiceWithWaypointAtServiceGranularity.Config().Ports.MustForName(ports.HTTP.Name).ServicePort
+		cluster := fmt.Sprintf("inbound-vip|%d|http|%s.%s.svc.cluster.local", port, svc, ns)
+		src := apps.EnrolledToKmesh[0]
+		opt := echo.CallOptions{
+			To:      apps.ServiceWithWaypointAtServiceGranularity,
+			Port:    echo.Port{Name: ports.HTTP.Name},
+			Scheme:  scheme.HTTP,
+			Count:   1,
+			Timeout: 10 * time.Second,
+			Check:   check.And(check.OK(), IsL7()),
+		}
+		// wait for the EnvoyFilter to be pushed to the waypoint, until then the pool reuses its connections
+		retry.UntilSuccessOrFail(t, func() error {
+			before := waypointUpstreamConnections(t, ns, "waypoint", cluster)
+			src.CallOrFail(t, opt)
+			src.CallOrFail(t, opt)
+			if after := waypointUpstreamConnections(t, ns, "waypoint", cluster); after-before < 2 {
+				return fmt.Errorf("2 requests opened %d upstream connections", after-before)
+			}
+			return nil
+		}, retry.Timeout(time.Minute), retry.Delay(time.Second))
+
+		before := waypointUpstreamConnections(t, ns, "waypoint", cluster)
+		opt.Count = 10
+		src.CallOrFail(t, opt)
+		if after := waypointUpstreamConnections(t, ns, "waypoint", cluster); after-before < 10 {
+			t.Fatalf("10 requests opened %d upstream connections, expected one per request", after-before)
+		}
+	})
+}
+
+// waypointUpstreamConnections returns the number of the connections the pods of the waypoint opened to the cluster
+func waypointUpstreamConnections(t framework.TestContext, ns, name, cluster string) int {
+	cls := t.Clusters().Default()
+	pods, err := cls.PodsForSelector(context.Background(), ns, fmt.Sprintf("%s=%s", label.IoK8sNetworkingGatewayGatewayName.Name, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := fmt.Sprintf("cluster.%s.upstream_cx_total", cluster)
+	total := 0
+	for _, pod := range pods.Items {
+		out, _, err := cls.PodExec(pod.Name, ns, "istio-proxy", "pilot-agent request GET stats?filter="+stat)
+		if err != nil {
+			t.Fatalf("failed to get the stats of waypoint pod %s: %v", pod.Name, err)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			value, found := strings.CutPrefix(line, stat+": ")
+			if !found {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				t.Fatalf("invalid stat %q: %v", line, err)
+			}
+			total += n
+		}
+	}
+	return total
+}
+
 // Test add/remove waypoint at pod granularity.
 func TestAddRemovePodWaypoint(t *testing.T) {
 	framework.NewTest(t).Run(func(t framework.TestContext) {
@@ -677,80 +1010,409 @@ func TestAuthorizationL4(t *testing.T) {
 				return check.OK()
 			}
 
-			count := 0
-			workloads := dst.WorkloadsOrFail(t)
-			for _, client := range workloads {
-				if count == len(workloads) {
-					break
-				}
-				podName := client.PodName()
-				namespace := apps.Namespace.Name()
-				timeout := time.After(5 * time.Second)
-				ticker := time.NewTicker(500 * time.Millisecond)
-				defer ticker.Stop()
-			InnerLoop:
-				for {
-					select {
-					case <-timeout:
-						t.Fatalf("Timeout: XDP eBPF program not found on pod %s", podName)
-					case <-ticker.C:
-						cmd := exec.Command("kubectl", "exec", "-n", namespace, podName, "--", "sh", "-c", "ip a | grep xdp")
-						output, err := cmd.CombinedOutput()
-						if err == nil && len(output) > 0 {
-							t.Logf("XDP program is loaded on pod %s", podName)
-							count++
-							break InnerLoop
+			waitForXdp(t, dst.WorkloadsOrFail(t))
+
+			for _, tc := range authzCases {
+				// the policy of a case is deleted once it ends, not to apply to the next one
+				t.NewSubTest(tc.name).Run(func(t framework.TestContext) {
+					// the policy is named after the case, so waiting for it is not fooled by the one of the previous case
+					policyName := "policy-" + tc.name
+					t.ConfigIstio().Eval(apps.Namespace.Name(), map[string]string{
+						"Destination": dst.Config().Service,
+						"Ip":          selectedAddress,
+						"Name":        policyName,
+					}, `apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: "{{.Name}}"
+spec:
+  selector:
+    matchLabels:
+      app: "{{.Destination}}"
+`+tc.spec+`
+  rules:
+  - from:
+    - source:
+        ipBlocks:
+        - "{{.Ip}}"
+`).ApplyOrFail(t)
+					for _, workload := range dst.WorkloadsOrFail(t) {
+						waitForPolicyApplied(t, workload, policyName)
+					}
+
+					for _, client := range clients {
+						opt := echo.CallOptions{
+							To:                      dst,
+							Port:                    echo.Port{Name: "tcp"},
+							Scheme:                  scheme.TCP,
+							NewConnectionPerRequest: true,
+							// Due to the mechanism of Kmesh L4 authorization, we need to set the timeout slightly longer.
+							Timeout: time.Minute * 2,
 						}
-						t.Logf("Waiting for XDP program to load on pod %s: %v", podName, err)
+
+						var name string
+						if client.Address() != selectedAddress {
+							name = tc.name + ", not selected address"
+						} else {
+							name = tc.name + ", selected address"
+						}
+
+						opt.Check = chooseChecker(tc.name, client.Address())
+
+						t.NewSubTestf("%v", name).Run(func(t framework.TestContext) {
+							src.WithWorkloads(client).CallOrFail(t, opt)
+						})
 					}
+				})
+			}
+		})
+	})
+}
+
+// waitForXdp waits until the xdp authz program is attached to the workloads
+func waitForXdp(t framework.TestContext, workloads echo.Workloads) {
+	for _, workload := range workloads {
+		podName := workload.PodName()
+		namespace := apps.Namespace.Name()
+		timeout := time.After(5 * time.Second)
+		ticker := time.NewTicker(500 * time.Millisecond)
+	InnerLoop:
+		for {
+			select {
+			case <-timeout:
+				ticker.Stop()
+				t.Fatalf("Timeout: XDP eBPF program not found on pod %s", podName)
+			case <-ticker.C:
+				cmd := exec.Command("kubectl", "exec", "-n", namespace, podName, "--", "sh", "-c", "ip a | grep xdp")
+				output, err := cmd.CombinedOutput()
+				if err == nil && len(output) > 0 {
+					t.Logf("XDP program is loaded on pod %s", podName)
+					break InnerLoop
 				}
+				t.Logf("Waiting for XDP program to load on pod %s: %v", podName, err)
 			}
+		}
+		ticker.Stop()
+	}
+}
 
-			for _, tc := range authzCases {
+// policyDump is the part of the dual-engine config dump of a kmesh daemon telling which policies it loaded
+type policyDump struct {
+	Workloads []struct {
+		Name                  string   `json:"name"`
+		Namespace             string   `json:"namespace"`
+		AuthorizationPolicies []string `json:"authorizationPolicies"`
+	} `json:"workloads"`
+	Policies []dumpedPolicy `json:"policies"`
+}
+
+type dumpedPolicy struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Scope     string `json:"scope"`
+}
+
+const (
+	// policyAppliedTimeout is how long a kmesh daemon is given to load an authorization policy
+	policyAppliedTimeout = time.Minute
+	// policyAppliedMaxDelay caps the backoff between two polls of a kmesh daemon
+	policyAppliedMaxDelay = 5 * time.Second
+)
+
+// waitForPolicyApplied waits until the kmesh daemon on the node of the pod has loaded the authorization policy
+// policyName of the test namespace, and the pod references it if the policy selects workloads. The daemon is polled
+// through its admin api with a jittered backoff, so the waits of the parallel tests are not in lockstep.
+func waitForPolicyApplied(t framework.TestContext, pod echo.Workload, policyName string) {
+	t.Helper()
+	ns := apps.Namespace.Name()
+	cls := t.Clusters().Default()
+	p, err := cls.Kube().CoreV1().Pods(ns).Get(context.Background(), pod.PodName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get pod %s/%s: %v", ns, pod.PodName(), err)
+	}
+	daemons, err := cls.Kube().CoreV1().Pods(KmeshNamespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: "app=kmesh",
+		FieldSelector: "spec.nodeName=" + p.Spec.NodeName,
+	})
+	if err != nil || len(daemons.Items) == 0 {
+		t.Fatalf("failed to find the kmesh daemon on node %s: %v", p.Spec.NodeName, err)
+	}
+	daemon := daemons.Items[0].Name
+	fw, err := cls.NewPortForwarder(daemon, KmeshNamespace, "", 0, utils.KmeshAdminGrpcPort)
+	if err != nil {
+		t.Fatalf("failed to create port forwarder for %s: %v", daemon, err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("failed to start port forwarder for %s: %v", daemon, err)
+	}
+	defer fw.Close()
+	client, err := adminclient.New(fw.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	applied := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		resp, err := client.ConfigDump(ctx, &adminapi.ConfigDumpRequest{Mode: adminapi.Mode_DUAL_ENGINE})
+		if err != nil {
+			return err
+		}
+		var dump policyDump
+		if err := json.Unmarshal([]byte(resp.GetJson()), &dump); err != nil {
+			return err
+		}
+		i := slices.IndexFunc(dump.Policies, func(policy dumpedPolicy) bool {
+			return policy.Namespace == ns && policy.Name == policyName
+		})
+		if i < 0 {
+			return fmt.Errorf("policy %s/%s is not loaded", ns, policyName)
+		}
+		// the policies of a namespace or the root namespace apply to all its workloads
+		if dump.Policies[i].Scope != "WORKLOAD_SELECTOR" {
+			return nil
+		}
+		for _, workload := range dump.Workloads {
+			if workload.Namespace == ns && workload.Name == pod.PodName() &&
+				slices.Contains(workload.AuthorizationPolicies, ns+"/"+policyName) {
+				return nil
+			}
+		}
+		return fmt.Errorf("pod %s does not reference policy %s/%s", pod.PodName(), ns, policyName)
+	}
+
+	deadline := time.Now().Add(policyAppliedTimeout)
+	delay := 200 * time.Millisecond
+	for {
+		err := applied()
+		if err == nil {
+			t.Logf("policy %s/%s is applied to pod %s by %s", ns, policyName, pod.PodName(), daemon)
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("policy %s/%s is not applied to pod %s after %v: %v", ns, policyName, pod.PodName(), policyAppliedTimeout, err)
+		}
+		time.Sleep(delay/2 + rand.N(delay))
+		delay = min(2*delay, policyAppliedMaxDelay)
+	}
+}
+
+// TestAuthorizationL4WorkloadSelector checks a policy only applies to the workloads it selects,
+// the deployments of the same service which are not selected are not denied.
+func TestAuthorizationL4WorkloadSelector(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		src := apps.ServiceWithWaypointAtServiceGranularity[0]
+		dst := apps.EnrolledToKmesh
+		workloads := dst.WorkloadsOrFail(t)
+		if len(workloads) < 2 {
+			t.Fatal(fmt.Errorf("need at least 2 deployments of %s", EnrolledToKmesh))
+		}
+		waitForXdp(t, workloads)
+		port := dst.Config().Ports.MustForName("tcp").WorkloadPort
+
+		for _, version := range []string{"v1", "v2"} {
+			t.NewSubTestf("deny %s", version).Run(func(t framework.TestContext) {
 				t.ConfigIstio().Eval(apps.Namespace.Name(), map[string]string{
 					"Destination": dst.Config().Service,
-					"Ip":          selectedAddress,
+					"Version":     version,
+					"Port":        strconv.Itoa(port),
 				}, `apiVersion: security.istio.io/v1beta1
 kind: AuthorizationPolicy
 metadata:
-  name: policy
+  name: deny-version
 spec:
   selector:
     matchLabels:
       app: "{{.Destination}}"
-`+tc.spec+`
+      version: "{{.Version}}"
+  action: DENY
   rules:
-  - from:
-    - source:
-        ipBlocks:
-        - "{{.Ip}}"
+  - to:
+    - operation:
+        ports:
+        - "{{.Port}}"
 `).ApplyOrFail(t)
+				// the pods of the deployments are named after the service and their version
+				selected := func(workload echo.Workload) bool {
+					return strings.HasPrefix(workload.PodName(), dst.Config().Service+"-"+version+"-")
+				}
+				for _, workload := range workloads {
+					if selected(workload) {
+						waitForPolicyApplied(t, workload, "deny-version")
+					}
+				}
 
-				for _, client := range clients {
+				for _, workload := range workloads {
 					opt := echo.CallOptions{
-						To:                      dst,
-						Port:                    echo.Port{Name: "tcp"},
+						Address:                 workload.Address(),
+						Port:                    echo.Port{Name: "tcp", ServicePort: port},
 						Scheme:                  scheme.TCP,
 						NewConnectionPerRequest: true,
 						// Due to the mechanism of Kmesh L4 authorization, we need to set the timeout slightly longer.
 						Timeout: time.Minute * 2,
+						Check:   check.OK(),
 					}
-
-					var name string
-					if client.Address() != selectedAddress {
-						name = tc.name + ", not selected address"
-					} else {
-						name = tc.name + ", selected address"
+					if selected(workload) {
+						opt.Check = check.NotOK()
 					}
-
-					opt.Check = chooseChecker(tc.name, client.Address())
-
-					t.NewSubTestf("%v", name).Run(func(t framework.TestContext) {
-						src.WithWorkloads(client).CallOrFail(t, opt)
+					t.NewSubTestf("to %s", workload.PodName()).Run(func(t framework.TestContext) {
+						src.CallOrFail(t, opt)
 					})
 				}
-			}
+			})
+		}
+	})
+}
+
+// TestAuthorizationEnforceEstablished checks a connection established to a pod annotated with
+// kmesh.net/authz-enforce-established is closed once a DENY policy matching it is applied.
+func TestAuthorizationEnforceEstablished(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		ns := apps.Namespace.Name()
+		dst := apps.EnrolledToKmesh
+		workload := dst.WorkloadsOrFail(t)[0]
+		port := dst.Config().Ports.MustForName("tcp").WorkloadPort
+
+		clientName := "enforce-established-client"
+		t.ConfigKube().YAML(ns, fixtures.NewSleep(clientName, ns).YAML()).ApplyOrFail(t)
+		clientPod, clientIP := waitForPod(t, ns, clientName)
+
+		annotation := "kmesh.net/authz-enforce-established"
+		if out, err := exec.Command("kubectl", "annotate", "pod", "-n", ns, workload.PodName(),
+			annotation+"=true", "--overwrite").CombinedOutput(); err != nil {
+			t.Fatalf("failed to annotate pod %s: %v, %s", workload.PodName(), err, out)
+		}
+		t.Cleanup(func() {
+			_ = exec.Command("kubectl", "annotate", "pod", "-n", ns, workload.PodName(), annotation+"-").Run()
 		})
+
+		// nc keeps the connection open as long as its stdin is, which is never written nor closed
+		conn := exec.Command("kubectl", "exec", "-i", "-n", ns, clientPod, "--",
+			"nc", workload.Address(), strconv.Itoa(port))
+		stdin, err := conn.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stdin.Close()
+		if err := conn.Start(); err != nil {
+			t.Fatalf("failed to open the connection: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = conn.Process.Kill()
+		})
+		closed := make(chan error, 1)
+		go func() {
+			closed <- conn.Wait()
+		}()
+
+		select {
+		case err := <-closed:
+			t.Fatalf("the connection was closed before the policy was applied: %v", err)
+		case <-time.After(10 * time.Second):
+		}
+
+		t.ConfigIstio().Eval(ns, map[string]string{
+			"Destination": dst.Config().Service,
+			"Ip":          clientIP,
+		}, `apiVersion: security.istio.io/v1
+kind: AuthorizationPolicy
+metadata:
+  name: deny-established
+spec:
+  selector:
+    matchLabels:
+      app: "{{.Destination}}"
+  action: DENY
+  rules:
+  - from:
+    - source:
+        ipBlocks:
+        - "{{.Ip}}"
+`).ApplyOrFail(t)
+		waitForPolicyApplied(t, workload, "deny-established")
+
+		select {
+		case <-closed:
+			t.Logf("the connection from %s to %s was closed", clientIP, workload.Address())
+		case <-time.After(time.Minute):
+			t.Fatalf("the connection from %s to %s is still open after the DENY policy was applied", clientIP, workload.Address())
+		}
+	})
+}
+
+// waitForPod waits until the pod with the app label is ready and returns its name and ip
+func waitForPod(t framework.TestContext, namespace, app string) (string, string) {
+	if out, err := exec.Command("kubectl", "wait", "pod", "-n", namespace, "-l", "app="+app,
+		"--for=condition=Ready", "--timeout=2m").CombinedOutput(); err != nil {
+		t.Fatalf("pod %s/%s is not ready: %v, %s", namespace, app, err, out)
+	}
+	out, err := exec.Command("kubectl", "get", "pod", "-n", namespace, "-l", "app="+app,
+		"-o", "jsonpath={.items[0].metadata.name} {.items[0].status.podIP}").CombinedOutput()
+	if err != nil {
+		t.Fatalf("failed to get pod %s/%s: %v, %s", namespace, app, err, out)
+	}
+	name, ip, _ := strings.Cut(string(out), " ")
+	return name, ip
+}
+
+// TestAuthorizationWaypointPrincipals checks the waypoint does not trust an unauthenticated source identity. Kmesh
+// connects to the waypoint over the plain kmesh-listener rather than over HBONE, so the source.principals and
+// source.namespaces of the authorization policies targeting its service never match, and an ALLOW policy with
+// them denies even the client it names.
+func TestAuthorizationWaypointPrincipals(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		src := apps.EnrolledToKmesh[0]
+		dst := apps.ServiceWithWaypointAtServiceGranularity
+
+		cases := []struct {
+			name   string
+			source string
+		}{
+			{
+				name: "principals",
+				// the service accounts of the echo instances are named after their service
+				source: `principals:
+        - "cluster.local/ns/{{.Namespace}}/sa/{{.Source}}"`,
+			},
+			{
+				name: "namespaces",
+				source: `namespaces:
+        - "{{.Namespace}}"`,
+			},
+		}
+		for _, tc := range cases {
+			t.NewSubTest(tc.name).Run(func(t framework.TestContext) {
+				t.ConfigIstio().Eval(apps.Namespace.Name(), map[string]string{
+					"Destination": dst.Config().Service,
+					"Namespace":   apps.Namespace.Name(),
+					"Source":      src.Config().Service,
+				}, `apiVersion: security.istio.io/v1
+kind: AuthorizationPolicy
+metadata:
+  name: allow-identity
+spec:
+  targetRefs:
+  - kind: Service
+    group: ""
+    name: "{{.Destination}}"
+  action: ALLOW
+  rules:
+  - from:
+    - source:
+        `+tc.source+`
+`).ApplyOrFail(t)
+
+				// the waypoint denies the request with the RBAC filter
+				src.CallOrFail(t, echo.CallOptions{
+					To:     dst,
+					Port:   echo.Port{Name: "http"},
+					Scheme: scheme.HTTP,
+					Count:  5,
+					Check:  check.Status(http.StatusForbidden),
+				})
+			})
+		}
 	})
 }
 
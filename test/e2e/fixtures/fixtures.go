@@ -0,0 +1,236 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package fixtures builds the manifests of the kubernetes resources the e2e tests deploy
+// besides the echo apps, so that the tests do not copy inline YAML around.
+package fixtures
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SleepImage is the image of the sleep client
+	SleepImage = "curlimages/curl"
+	// appLabel selects the pods of a deployment, and the backends of a service
+	appLabel = "app"
+)
+
+// Join joins manifests into a single multi-document YAML
+func Join(manifests ...string) string {
+	docs := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		docs = append(docs, strings.TrimSpace(manifest))
+	}
+	return strings.Join(docs, "\n---\n") + "\n"
+}
+
+// ServiceBuilder builds a Service selecting the pods with app: <name> by default
+type ServiceBuilder struct {
+	svc corev1.Service
+}
+
+func NewService(name, namespace string) *ServiceBuilder {
+	return &ServiceBuilder{
+		svc: corev1.Service{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{appLabel: name},
+			},
+			Spec: corev1.ServiceSpec{
+				Selector: map[string]string{appLabel: name},
+			},
+		},
+	}
+}
+
+// WithLabel adds a label to the service
+func (b *ServiceBuilder) WithLabel(key, value string) *ServiceBuilder {
+	b.svc.Labels[key] = value
+	return b
+}
+
+// WithAnnotation adds an annotation to the service
+func (b *ServiceBuilder) WithAnnotation(key, value string) *ServiceBuilder {
+	if b.svc.Annotations == nil {
+		b.svc.Annotations = map[string]string{}
+	}
+	b.svc.Annotations[key] = value
+	return b
+}
+
+// WithSelector replaces the selector of the service
+func (b *ServiceBuilder) WithSelector(selector map[string]string) *ServiceBuilder {
+	b.svc.Spec.Selector = selector
+	return b
+}
+
+// WithPort adds a TCP port of the service forwarded to targetPort of the pods
+func (b *ServiceBuilder) WithPort(name string, port, targetPort int32) *ServiceBuilder {
+	b.svc.Spec.Ports = append(b.svc.Spec.Ports, corev1.ServicePort{
+		Name:       name,
+		Protocol:   corev1.ProtocolTCP,
+		Port:       port,
+		TargetPort: intstr.FromInt32(targetPort),
+	})
+	return b
+}
+
+// Headless makes the service headless
+func (b *ServiceBuilder) Headless() *ServiceBuilder {
+	b.svc.Spec.ClusterIP = corev1.ClusterIPNone
+	return b
+}
+
+// Build returns the service built
+func (b *ServiceBuilder) Build() *corev1.Service {
+	return b.svc.DeepCopy()
+}
+
+// YAML returns the manifest of the service
+func (b *ServiceBuilder) YAML() string {
+	return toYAML(&b.svc)
+}
+
+// DeploymentBuilder builds a Deployment of one replica of a single container, whose pods are labeled app: <name>
+type DeploymentBuilder struct {
+	deploy appsv1.Deployment
+}
+
+func NewDeployment(name, namespace, image string) *DeploymentBuilder {
+	replicas := int32(1)
+	labels := map[string]string{appLabel: name}
+	return &DeploymentBuilder{
+		deploy: appsv1.Deployment{
+			TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{appLabel: name}},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{
+							Name:            name,
+							Image:           image,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// NewSleep builds the deployment of a client which sleeps forever, for the tests to exec curl in
+func NewSleep(name, namespace string) *DeploymentBuilder {
+	return NewDeployment(name, namespace, SleepImage).
+		WithCommand("/bin/sleep", "infinity")
+}
+
+// WithReplicas sets the number of replicas of the deployment
+func (b *DeploymentBuilder) WithReplicas(replicas int32) *DeploymentBuilder {
+	b.deploy.Spec.Replicas = &replicas
+	return b
+}
+
+// WithPodLabel adds a label to the pods of the deployment
+func (b *DeploymentBuilder) WithPodLabel(key, value string) *DeploymentBuilder {
+	b.deploy.Spec.Template.Labels[key] = value
+	return b
+}
+
+// WithPodAnnotation adds an annotation to the pods of the deployment
+func (b *DeploymentBuilder) WithPodAnnotation(key, value string) *DeploymentBuilder {
+	if b.deploy.Spec.Template.Annotations == nil {
+		b.deploy.Spec.Template.Annotations = map[string]string{}
+	}
+	b.deploy.Spec.Template.Annotations[key] = value
+	return b
+}
+
+// WithCommand sets the command of the container
+func (b *DeploymentBuilder) WithCommand(command ...string) *DeploymentBuilder {
+	b.container().Command = command
+	return b
+}
+
+// WithArgs sets the arguments of the container
+func (b *DeploymentBuilder) WithArgs(args ...string) *DeploymentBuilder {
+	b.container().Args = args
+	return b
+}
+
+// WithEnv adds an environment variable to the container
+func (b *DeploymentBuilder) WithEnv(name, value string) *DeploymentBuilder {
+	c := b.container()
+	c.Env = append(c.Env, corev1.EnvVar{Name: name, Value: value})
+	return b
+}
+
+// WithContainerPort adds a TCP port the container listens on
+func (b *DeploymentBuilder) WithContainerPort(port int32) *DeploymentBuilder {
+	c := b.container()
+	c.Ports = append(c.Ports, corev1.ContainerPort{ContainerPort: port, Protocol: corev1.ProtocolTCP})
+	return b
+}
+
+// WithNodeName pins the pods of the deployment to a node
+func (b *DeploymentBuilder) WithNodeName(node string) *DeploymentBuilder {
+	b.deploy.Spec.Template.Spec.NodeName = node
+	return b
+}
+
+// WithServiceAccount runs the pods of the deployment as a service account
+func (b *DeploymentBuilder) WithServiceAccount(serviceAccount string) *DeploymentBuilder {
+	b.deploy.Spec.Template.Spec.ServiceAccountName = serviceAccount
+	return b
+}
+
+func (b *DeploymentBuilder) container() *corev1.Container {
+	return &b.deploy.Spec.Template.Spec.Containers[0]
+}
+
+// Build returns the deployment built
+func (b *DeploymentBuilder) Build() *appsv1.Deployment {
+	return b.deploy.DeepCopy()
+}
+
+// YAML returns the manifest of the deployment
+func (b *DeploymentBuilder) YAML() string {
+	return toYAML(&b.deploy)
+}
+
+func toYAML(obj any) string {
+	out, err := yaml.Marshal(obj)
+	if err != nil {
+		// the typed objects built always marshal
+		panic(fmt.Sprintf("marshal %T failed: %v", obj, err))
+	}
+	return string(out)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright The Kmesh Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at:
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fixtures
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+func TestServiceBuilder(t *testing.T) {
+	manifest := NewService("helloworld", "sample").
+		WithLabel("version", "v1").
+		WithAnnotation("kmesh.net/bandwidth", "10Mbps").
+		WithPort("http", 5000, 8080).
+		YAML()
+
+	var svc corev1.Service
+	require.NoError(t, yaml.UnmarshalStrict([]byte(manifest), &svc))
+	assert.Equal(t, "Service", svc.Kind)
+	assert.Equal(t, "v1", svc.APIVersion)
+	assert.Equal(t, "helloworld", svc.Name)
+	assert.Equal(t, "sample", svc.Namespace)
+	assert.Equal(t, map[string]string{"app": "helloworld", "version": "v1"}, svc.Labels)
+	assert.Equal(t, map[string]string{"kmesh.net/bandwidth": "10Mbps"}, svc.Annotations)
+	assert.Equal(t, map[string]string{"app": "helloworld"}, svc.Spec.Selector)
+	assert.Equal(t, []corev1.ServicePort{{
+		Name:       "http",
+		Protocol:   corev1.ProtocolTCP,
+		Port:       5000,
+		TargetPort: intstr.FromInt32(8080),
+	}}, svc.Spec.Ports)
+	assert.Empty(t, svc.Spec.ClusterIP)
+
+	headless := NewService("helloworld", "sample").
+		WithSelector(map[string]string{"app": "other"}).
+		Headless().
+		Build()
+	assert.Equal(t, corev1.ClusterIPNone, headless.Spec.ClusterIP)
+	assert.Equal(t, map[string]string{"app": "other"}, headless.Spec.Selector)
+}
+
+func TestDeploymentBuilder(t *testing.T) {
+	manifest := NewDeployment("helloworld", "sample", "docker.io/istio/examples-helloworld-v1:1.0").
+		WithReplicas(2).
+		WithPodLabel("version", "v1").
+		WithPodAnnotation("sidecar.istio.io/inject", "false").
+		WithContainerPort(5000).
+		WithEnv("SERVICE_VERSION", "v1").
+		WithNodeName("kmesh-testing-worker").
+		WithServiceAccount("helloworld").
+		YAML()
+
+	var deploy appsv1.Deployment
+	require.NoError(t, yaml.UnmarshalStrict([]byte(manifest), &deploy))
+	assert.Equal(t, "Deployment", deploy.Kind)
+	assert.Equal(t, "apps/v1", deploy.APIVersion)
+	assert.Equal(t, "helloworld", deploy.Name)
+	assert.Equal(t, "sample", deploy.Namespace)
+	assert.Equal(t, int32(2), *deploy.Spec.Replicas)
+	// the selector is not widened by the pod labels added
+	assert.Equal(t, map[string]string{"app": "helloworld"}, deploy.Spec.Selector.MatchLabels)
+	assert.Equal(t, map[string]string{"app": "helloworld", "version": "v1"}, deploy.Spec.Template.Labels)
+	assert.Equal(t, map[string]string{"sidecar.istio.io/inject": "false"}, deploy.Spec.Template.Annotations)
+
+	pod := deploy.Spec.Template.Spec
+	assert.Equal(t, "kmesh-testing-worker", pod.NodeName)
+	assert.Equal(t, "helloworld", pod.ServiceAccountName)
+	require.Len(t, pod.Containers, 1)
+	assert.Equal(t, corev1.Container{
+		Name:            "helloworld",
+		Image:           "docker.io/istio/examples-helloworld-v1:1.0",
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Ports:           []corev1.ContainerPort{{ContainerPort: 5000, Protocol: corev1.ProtocolTCP}},
+		Env:             []corev1.EnvVar{{Name: "SERVICE_VERSION", Value: "v1"}},
+	}, pod.Containers[0])
+
+	sleep := NewSleep("sleep", "sample").Build()
+	assert.Equal(t, SleepImage, sleep.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, []string{"/bin/sleep", "infinity"}, sleep.Spec.Template.Spec.Containers[0].Command)
+}
+
+func TestJoin(t *testing.T) {
+	svc := NewService("sleep", "sample").WithPort("http", 80, 80).YAML()
+	deploy := NewSleep("sleep", "sample").YAML()
+
+	docs := strings.Split(Join(svc, deploy), "\n---\n")
+	require.Len(t, docs, 2)
+	assert.Equal(t, strings.TrimSpace(svc), docs[0])
+	assert.Equal(t, deploy, docs[1])
+}
@@ -29,8 +29,10 @@ import (
 	"testing"
 	"time"
 
+	"istio.io/istio/pkg/http/headers"
 	"istio.io/istio/pkg/test/framework"
 	"istio.io/istio/pkg/test/framework/components/echo"
+	"istio.io/istio/pkg/test/framework/components/echo/check"
 	"istio.io/istio/pkg/test/framework/components/echo/util/traffic"
 	kubetest "istio.io/istio/pkg/test/kube"
 	"istio.io/istio/pkg/test/util/retry"
@@ -66,6 +68,104 @@ func TestKmeshRestart(t *testing.T) {
 	})
 }
 
+// TestHeaderRoutingRestart sends the requests of a canary with a header to v2 and the others to v1
+// through the waypoint, the routing holds while kmesh restarts.
+func TestHeaderRoutingRestart(t *testing.T) {
+	framework.NewTest(t).Run(func(t framework.TestContext) {
+		src := apps.EnrolledToKmesh[0]
+		dst := apps.ServiceWithWaypointAtServiceGranularity
+		t.ConfigIstio().Eval(apps.Namespace.Name(), map[string]string{
+			"Destination": dst.Config().Service,
+		}, `apiVersion: networking.istio.io/v1
+kind: VirtualService
+metadata:
+  name: canary
+spec:
+  hosts:
+  - "{{.Destination}}"
+  http:
+  - match:
+    - headers:
+        x-canary:
+          exact: "true"
+    route:
+    - destination:
+        host: "{{.Destination}}"
+        subset: v2
+  - route:
+    - destination:
+        host: "{{.Destination}}"
+        subset: v1
+---
+apiVersion: networking.istio.io/v1
+kind: DestinationRule
+metadata:
+  name: canary
+spec:
+  host: "{{.Destination}}"
+  subsets:
+  - name: v1
+    labels:
+      version: v1
+  - name: v2
+    labels:
+      version: v2
+`).ApplyOrFail(t)
+
+		canary := echo.CallOptions{
+			To:    dst,
+			Count: 1,
+			Port: echo.Port{
+				Name: "http",
+			},
+			HTTP: echo.HTTP{
+				Headers: headers.New().With("x-canary", "true").Build(),
+			},
+			Check: check.And(httpValidator, versionValidator("v2")),
+			Retry: echo.Retry{NoRetry: true},
+		}
+		stable := echo.CallOptions{
+			To:    dst,
+			Count: 1,
+			Port: echo.Port{
+				Name: "http",
+			},
+			Check: check.And(httpValidator, versionValidator("v1")),
+			Retry: echo.Retry{NoRetry: true},
+		}
+		// wait for the waypoint to route with the VirtualService before counting
+		canaryRetry := canary
+		canaryRetry.Retry = echo.Retry{Options: []retry.Option{retry.Timeout(time.Minute)}}
+		src.CallOrFail(t, canaryRetry)
+
+		generators := []traffic.Generator{}
+		for _, options := range []echo.CallOptions{canary, stable} {
+			generators = append(generators, traffic.NewGenerator(t, traffic.Config{
+				Source:   src,
+				Options:  options,
+				Interval: 50 * time.Millisecond,
+			}).Start())
+		}
+
+		restartKmesh(t)
+
+		for _, g := range generators {
+			g.Stop().CheckSuccessRate(t, 1)
+		}
+	})
+}
+
+func versionValidator(version string) echo.Checker {
+	return func(result echo.CallResult, _ error) error {
+		for _, r := range result.Responses {
+			if r.Version != version {
+				return fmt.Errorf("expected service version %q, got %q", version, r.Version)
+			}
+		}
+		return nil
+	}
+}
+
 func restartKmesh(t framework.TestContext) {
 	patchOpts := metav1.PatchOptions{}
 	patchData := fmt.Sprintf(`{